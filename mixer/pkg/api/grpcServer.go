@@ -32,6 +32,7 @@ import (
 	"istio.io/istio/mixer/pkg/adapterManager"
 	"istio.io/istio/mixer/pkg/aspect"
 	"istio.io/istio/mixer/pkg/attribute"
+	mixerlog "istio.io/istio/mixer/pkg/log"
 	"istio.io/istio/mixer/pkg/pool"
 	"istio.io/istio/mixer/pkg/runtime"
 	"istio.io/istio/mixer/pkg/status"
@@ -153,7 +154,7 @@ func (s *grpcServer) Check(legacyCtx legacyContext.Context, req *mixerpb.CheckRe
 
 	if glog.V(2) {
 		glog.Info("Dispatching to main adapters after running processors")
-		glog.Info("Attribute Bag: \n", mutableBag.DebugString())
+		glog.Info("Attribute Bag: ", mixerlog.AttributesField(mutableBag).Interface)
 	}
 
 	glog.V(1).Info("Dispatching Check")
@@ -313,7 +314,7 @@ func (s *grpcServer) Report(legacyCtx legacyContext.Context, req *mixerpb.Report
 
 		if glog.V(2) {
 			glog.Info("Dispatching to main adapters after running processors")
-			glog.Info("Attribute Bag: \n", mutableBag.DebugString())
+			glog.Info("Attribute Bag: ", mixerlog.AttributesField(mutableBag).Interface)
 		}
 
 		glog.V(1).Infof("Dispatching Report %d out of %d", i, len(req.Attributes))
@@ -694,6 +694,44 @@ func TestReferenceTracking(t *testing.T) {
 	}
 }
 
+func TestPeek(t *testing.T) {
+	globalWordList := []string{"G0", "G1"}
+	globalDict := map[string]int32{globalWordList[0]: 0, globalWordList[1]: 1}
+	messageWordList := []string{"N1", "N2", "N3"}
+
+	sm := mixerpb.StringMap{Entries: map[int32]int32{-2: -3}} // "N2":"N3"
+	attrs := mixerpb.CompressedAttributes{
+		Words:      messageWordList,
+		Strings:    map[int32]int32{0: 1}, // "G0":"G1"
+		StringMaps: map[int32]mixerpb.StringMap{-1: sm},
+	}
+
+	b := NewProtoBag(&attrs, globalDict, globalWordList)
+	mb := GetMutableBag(b)
+	mb.Set("M0", int64(1))
+
+	cases := []struct {
+		name     string
+		expected interface{}
+		found    bool
+	}{
+		{"G0", "G1", true},
+		{"N1", map[string]string{"N2": "N3"}, true},
+		{"M0", int64(1), true},
+		{"XX", nil, false},
+	}
+
+	for _, c := range cases {
+		if v, found := mb.Peek(c.name); found != c.found || !reflect.DeepEqual(v, c.expected) {
+			t.Errorf("Got %v, %v for %s, expecting %v, %v", v, found, c.name, c.expected, c.found)
+		}
+	}
+
+	if ra := b.GetReferencedAttributes(globalDict, len(globalDict)); len(ra.AttributeMatches) != 0 {
+		t.Errorf("Got %d matches, expecting none", len(ra.AttributeMatches))
+	}
+}
+
 func TestGlobalWordCount(t *testing.T) {
 	// ensure that a component with a larger global word list can
 	// produce an attribute message with a shorter word list to handle
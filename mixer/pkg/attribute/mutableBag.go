@@ -130,6 +130,29 @@ func (mb *MutableBag) Get(name string) (interface{}, bool) {
 	return r, b
 }
 
+// Peek returns an attribute value without recording the access in the parent bag, when the
+// parent supports it. String maps are returned as plain map[string]string values.
+func (mb *MutableBag) Peek(name string) (interface{}, bool) {
+	// prevent use of a bag that's in the pool
+	if mb.parent == nil {
+		panic(fmt.Errorf("attempt to use a bag after its Done method has been called"))
+	}
+
+	if r, b := mb.values[name]; b {
+		if sm, isMap := r.(StringMap); isMap {
+			return sm.entries, true
+		}
+		return r, true
+	}
+
+	if p, ok := mb.parent.(interface {
+		Peek(name string) (interface{}, bool)
+	}); ok {
+		return p.Peek(name)
+	}
+	return mb.parent.Get(name)
+}
+
 // Names returns the names of all the attributes known to this bag.
 func (mb *MutableBag) Names() []string {
 	if mb == nil {
@@ -114,6 +114,22 @@ func (pb *ProtoBag) Get(name string) (interface{}, bool) {
 	return result, ok
 }
 
+// Peek returns an attribute value without recording the access, for uses such as logging which
+// mustn't affect the calculation of referenced attributes. String maps are returned as plain
+// map[string]string values.
+func (pb *ProtoBag) Peek(name string) (interface{}, bool) {
+	index, ok := pb.getIndex(name)
+	if !ok {
+		return nil, false
+	}
+
+	result, ok := pb.internalGet(name, index)
+	if sm, isMap := result.(StringMap); isMap {
+		return sm.entries, ok
+	}
+	return result, ok
+}
+
 // GetReferencedAttributes returns the set of attributes that have been referenced through this bag.
 func (pb *ProtoBag) GetReferencedAttributes(globalDict map[string]int32, globalWordCount int) mixerpb.ReferencedAttributes {
 	output := mixerpb.ReferencedAttributes{}
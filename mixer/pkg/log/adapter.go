@@ -0,0 +1,68 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"istio.io/istio/mixer/pkg/adapter"
+)
+
+// AdapterScopePrefix prefixes the names of the scopes of the loggers returned by NewAdapterLogger,
+// so that the level of an adapter can be set with SetScopeOutputLevel("adapter.prometheus", ...).
+const AdapterScopePrefix = "adapter."
+
+// adapterLogger outputs the entries of an adapter under a scope of its own.
+type adapterLogger struct {
+	sugar *zap.SugaredLogger
+	scope string
+}
+
+var _ adapter.Logger = &adapterLogger{}
+
+// NewAdapterLogger returns a logger for Mixer's adapters to output their entries through, under
+// the scope of the adapter with the given name and with the name in an adapter field. Infof
+// outputs entries at the info level, Warningf at the warn level, and Errorf at the error level.
+// VerbosityLevel follows the verbosity set with SetVerbosity, for the adapters whose scope outputs
+// debug entries. The logger follows later calls to Configure.
+func NewAdapterLogger(adapterName string) adapter.Logger {
+	scope := AdapterScopePrefix + adapterName
+	return &adapterLogger{
+		sugar: zap.New(newGlobalCore()).Named(scope).With(zap.String("adapter", adapterName)).Sugar(),
+		scope: scope,
+	}
+}
+
+func (a *adapterLogger) VerbosityLevel(level adapter.VerbosityLevel) bool {
+	return int(level) <= GetVerbosity() && scopeEnabled(a.scope, zapcore.DebugLevel) && a.sugar.Desugar().Core().Enabled(zapcore.DebugLevel)
+}
+
+func (a *adapterLogger) Infof(format string, args ...interface{}) {
+	a.sugar.Infof(format, args...)
+}
+
+func (a *adapterLogger) Warningf(format string, args ...interface{}) {
+	a.sugar.Warnf(format, args...)
+}
+
+func (a *adapterLogger) Errorf(format string, args ...interface{}) error {
+	s := fmt.Sprintf(format, args...)
+	a.sugar.Error(s)
+	return errors.New(s)
+}
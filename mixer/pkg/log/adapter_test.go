@@ -0,0 +1,82 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestAdapterLogger(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+
+	// the logger follows the configuration set up after it was created
+	l := NewAdapterLogger("statsd")
+	configureWithoutOutput(t)
+
+	l.Infof("Got FlushBytes of '%d', defaulting to '%d'", 0, 512)
+	l.Warningf("Unable to flush %s", "metrics")
+	if err := l.Errorf("Unable to connect to %s", "localhost:8125"); err == nil || err.Error() != "Unable to connect to localhost:8125" {
+		t.Errorf("Got err '%v', expecting the message", err)
+	}
+
+	expected := `{"level":"info","logger":"adapter.statsd","msg":"Got FlushBytes of '0', defaulting to '512'","adapter":"statsd"}` + "\n" +
+		`{"level":"warn","logger":"adapter.statsd","msg":"Unable to flush metrics","adapter":"statsd"}` + "\n" +
+		`{"level":"error","logger":"adapter.statsd","msg":"Unable to connect to localhost:8125","adapter":"statsd"}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Got\n%s\nexpecting\n%s", buf, expected)
+	}
+}
+
+func TestAdapterLoggerLevels(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.Verbosity = 4
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer configureWithoutOutput(t)
+
+	l := NewAdapterLogger("statsd")
+	if l.VerbosityLevel(4) {
+		t.Error("Got true, expecting the verbosity to require the debug level")
+	}
+
+	if err := SetScopeOutputLevel("adapter.statsd", zapcore.DebugLevel); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer ResetScopeOutputLevel("adapter.statsd")
+
+	if !l.VerbosityLevel(4) || l.VerbosityLevel(5) {
+		t.Error("Got the wrong verbosity, expecting that of the options once the scope outputs debug entries")
+	}
+	if NewAdapterLogger("prometheus").VerbosityLevel(1) {
+		t.Error("Got true, expecting the level of the other adapters left alone")
+	}
+
+	if err := SetScopeOutputLevel("adapter.statsd", zapcore.ErrorLevel); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	l.Warningf("Unable to flush %s", "metrics")
+	if buf.Len() != 0 {
+		t.Errorf("Got '%s', expecting the warning below the level of the adapter dropped", buf)
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	asyncDefaultBuffer = 8192
+	asyncErrorInterval = 10 * time.Second
+)
+
+// The policies for entries logged while the queue of the asynchronous mode is full.
+const (
+	// wait for room in the queue
+	asyncBlock = "block"
+
+	// drop the entry being logged
+	asyncDropNewest = "drop-newest"
+
+	// drop the oldest entry of the queue to make room
+	asyncDropOldest = "drop-oldest"
+)
+
+// asyncErrorKey rate-limits the reporting of failures.
+type asyncErrorKey string
+
+// asyncEntry is an entry waiting to be written.
+type asyncEntry struct {
+	core   zapcore.Core
+	ent    zapcore.Entry
+	fields []zapcore.Field
+
+	// the position of the entry in the sequence of entries queued
+	seq uint64
+}
+
+// asyncQueue holds the entries of asyncCores until a background goroutine writes them out.
+type asyncQueue struct {
+	policy string
+	drops  *dropTally
+
+	mu sync.Mutex
+
+	// signaled when an entry is queued or the queue is stopped
+	ready *sync.Cond
+
+	// broadcast when an entry is written or the queue is stopped
+	progress *sync.Cond
+
+	// a ring buffer of n entries starting at head
+	entries []asyncEntry
+	head    int
+	n       int
+
+	// the sequence numbers of the last entries queued and written
+	queued  uint64
+	written uint64
+
+	// set once no more entries may be queued
+	stopped bool
+
+	done chan struct{}
+}
+
+func newAsyncQueue(size int, policy string, drops *dropTally) *asyncQueue {
+	q := &asyncQueue{
+		policy:  policy,
+		drops:   drops,
+		entries: make([]asyncEntry, size),
+		done:    make(chan struct{}),
+	}
+	q.ready = sync.NewCond(&q.mu)
+	q.progress = sync.NewCond(&q.mu)
+
+	go q.run()
+	return q
+}
+
+func (q *asyncQueue) push(e asyncEntry) {
+	q.entries[(q.head+q.n)%len(q.entries)] = e
+	q.n++
+}
+
+func (q *asyncQueue) pop() asyncEntry {
+	e := q.entries[q.head]
+	q.entries[q.head] = asyncEntry{}
+	q.head = (q.head + 1) % len(q.entries)
+	q.n--
+	return e
+}
+
+func (q *asyncQueue) run() {
+	defer close(q.done)
+
+	// when the queue started filling up
+	var start time.Time
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		for q.n == 0 && !q.stopped {
+			q.ready.Wait()
+		}
+		if q.n == 0 {
+			// stopped, with everything written out
+			q.written = q.queued
+			q.progress.Broadcast()
+			return
+		}
+
+		if start.IsZero() {
+			start = time.Now()
+		}
+
+		e := q.pop()
+		q.mu.Unlock()
+		q.write(e)
+		q.mu.Lock()
+
+		q.written = e.seq
+		q.progress.Broadcast()
+		asyncQueueDepth.Set(float64(q.n))
+
+		if q.n == 0 {
+			asyncFlushLatency.Observe(time.Since(start).Seconds())
+			start = time.Time{}
+		}
+	}
+}
+
+func (q *asyncQueue) write(e asyncEntry) {
+	// this can't go through the logger itself
+	if err := e.core.Write(e.ent, e.fields); err != nil && limits.every(asyncErrorKey("write"), asyncErrorInterval, now()) {
+		reportError("write error: %v", err)
+	}
+}
+
+// enqueue hands an entry over to the background goroutine, applying the policy of the queue if
+// it is full. It returns false if the queue has been stopped, or true if the entry was queued or
+// dropped.
+func (q *asyncQueue) enqueue(e asyncEntry) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.policy == asyncBlock {
+		for q.n == len(q.entries) && !q.stopped {
+			q.progress.Wait()
+		}
+	}
+
+	if q.stopped {
+		return false
+	}
+
+	if q.n == len(q.entries) {
+		if q.policy != asyncDropOldest {
+			q.drops.record(e.ent)
+			return true
+		}
+		q.drops.record(q.pop().ent)
+	}
+
+	q.queued++
+	e.seq = q.queued
+	q.push(e)
+	asyncQueueDepth.Set(float64(q.n))
+	q.ready.Signal()
+	return true
+}
+
+// drain waits for the entries queued so far to be written or dropped.
+func (q *asyncQueue) drain() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// entries are written in order, so all those up to the last one queued have been dealt with
+	// once it has, or once a later one has when it got dropped
+	target := q.queued
+	for q.written < target {
+		q.progress.Wait()
+	}
+}
+
+// close writes out the entries still queued and stops the background goroutine. Entries sent to
+// the cores afterwards are written right away.
+func (q *asyncQueue) close() {
+	q.mu.Lock()
+	q.stopped = true
+	q.ready.Signal()
+	q.progress.Broadcast()
+	q.mu.Unlock()
+
+	<-q.done
+	asyncQueueDepth.Set(0)
+}
+
+// asyncCore queues entries for a background goroutine to write them to the wrapped core, so that
+// logging doesn't wait on slow outputs. Fields are encoded by the background goroutine, so they
+// mustn't refer to data modified after logging.
+type asyncCore struct {
+	zapcore.Core
+
+	q *asyncQueue
+}
+
+func newAsyncCore(core zapcore.Core, q *asyncQueue) zapcore.Core {
+	return &asyncCore{Core: core, q: q}
+}
+
+func (c *asyncCore) With(fields []zapcore.Field) zapcore.Core {
+	return &asyncCore{Core: c.Core.With(fields), q: c.q}
+}
+
+func (c *asyncCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *asyncCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	// the process may be about to exit, the entries queued so far and this one go out right away
+	if ent.Level > zapcore.ErrorLevel {
+		c.q.drain()
+		return c.Core.Write(ent, fields)
+	}
+
+	if !c.q.enqueue(asyncEntry{core: c.Core, ent: ent, fields: fields}) {
+		return c.Core.Write(ent, fields)
+	}
+	return nil
+}
+
+func (c *asyncCore) Sync() error {
+	c.q.drain()
+	return c.Core.Sync()
+}
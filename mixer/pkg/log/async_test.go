@@ -0,0 +1,279 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// blockingCore holds up writes until released.
+type blockingCore struct {
+	zapcore.Core
+	release chan struct{}
+}
+
+func (c *blockingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &blockingCore{Core: c.Core.With(fields), release: c.release}
+}
+
+func (c *blockingCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	<-c.release
+	return c.Core.Write(ent, fields)
+}
+
+// messageCore sends the messages of the entries it receives to a channel.
+type messageCore struct {
+	zapcore.LevelEnabler
+	messages chan string
+}
+
+func (c *messageCore) With([]zapcore.Field) zapcore.Core {
+	return c
+}
+
+func (c *messageCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *messageCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	c.messages <- ent.Message
+	return nil
+}
+
+func (c *messageCore) Sync() error {
+	return nil
+}
+
+func configureAsync(t *testing.T, size int, policy string) {
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.Async = true
+	o.AsyncBufferSize = size
+	o.AsyncDropPolicy = policy
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+}
+
+func TestAsync(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+
+	configureAsync(t, 0, "")
+	defer configureWithoutOutput(t)
+
+	Info("Hello", zap.String("authorization", "secret"))
+	With(zap.String("user", "bob")).Warn("World")
+	Debug("Not output")
+	Sync()
+
+	expected := `{"level":"info","msg":"Hello","authorization":"[REDACTED]"}` + "\n" +
+		`{"level":"warn","msg":"World","user":"bob"}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Got\n%s\nexpecting\n%s", buf, expected)
+	}
+}
+
+func TestAsyncSlowOutput(t *testing.T) {
+	collector, buf := newCollectingCore(zapcore.DebugLevel)
+	core := &blockingCore{Core: collector, release: make(chan struct{})}
+	defer AddCore(core)()
+
+	configureAsync(t, 2, "")
+	defer configureWithoutOutput(t)
+	before := counterValue(t, "istio_log_async_dropped_entries_total", "info", "default")
+
+	// logging carries on while the output is stuck, dropping what doesn't fit in the queue
+	for i := 0; i < 10; i++ {
+		Info("Hello")
+	}
+
+	close(core.release)
+	Sync()
+
+	n := strings.Count(buf.String(), "Hello")
+	if n < 2 || n > 3 {
+		t.Errorf("Got %d entries, expecting those of the queue and the one being written", n)
+	}
+
+	if got := counterValue(t, "istio_log_async_dropped_entries_total", "info", "default") - before; got != float64(10-n) {
+		t.Errorf("Got %v dropped entries, expecting %d", got, 10-n)
+	}
+}
+
+func TestAsyncDropOldest(t *testing.T) {
+	collector, buf := newCollectingCore(zapcore.DebugLevel)
+	core := &blockingCore{Core: collector, release: make(chan struct{})}
+	defer AddCore(core)()
+
+	configureAsync(t, 2, "drop-oldest")
+	defer configureWithoutOutput(t)
+
+	for i := 1; i <= 10; i++ {
+		Info(strconv.Itoa(i))
+	}
+
+	close(core.release)
+	Sync()
+
+	// the first entry may have been taken off the queue before the others came along
+	s := buf.String()
+	if !strings.HasSuffix(s, `{"level":"info","msg":"9"}`+"\n"+`{"level":"info","msg":"10"}`+"\n") || strings.Contains(s, `"msg":"5"`) {
+		t.Errorf("Got '%s', expecting the last entries only", s)
+	}
+}
+
+func TestAsyncBlock(t *testing.T) {
+	collector, buf := newCollectingCore(zapcore.DebugLevel)
+	core := &blockingCore{Core: collector, release: make(chan struct{})}
+	defer AddCore(core)()
+
+	configureAsync(t, 1, "block")
+	defer configureWithoutOutput(t)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			Info("Hello")
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Logging returned, expecting it to wait for room in the queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(core.release)
+	<-done
+	Sync()
+
+	if n := strings.Count(buf.String(), "Hello"); n != 5 {
+		t.Errorf("Got %d entries, expecting 5", n)
+	}
+}
+
+func TestAsyncDropSummary(t *testing.T) {
+	release := make(chan struct{})
+	messages := make(chan string, 100)
+	core := &blockingCore{Core: &messageCore{LevelEnabler: zapcore.DebugLevel, messages: messages}, release: release}
+	defer AddCore(core)()
+
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.Async = true
+	o.AsyncBufferSize = 1
+	o.AsyncDropSummaryInterval = 10 * time.Millisecond
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer configureWithoutOutput(t)
+
+	for i := 0; i < 10; i++ {
+		Warn("Hello")
+	}
+	close(release)
+
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case m := <-messages:
+			if strings.HasPrefix(m, "dropped ") && strings.HasSuffix(m, " warn messages in the last 10ms as the log queue was full") {
+				return
+			}
+		case <-deadline:
+			t.Fatal("Timed out waiting for the summary of dropped entries")
+		}
+	}
+}
+
+func TestAsyncReconfigure(t *testing.T) {
+	collector, buf := newCollectingCore(zapcore.DebugLevel)
+	core := &blockingCore{Core: collector, release: make(chan struct{})}
+	defer AddCore(core)()
+
+	configureAsync(t, 0, "")
+	Info("One")
+	Info("Two")
+
+	// reconfiguring writes out the entries still queued
+	close(core.release)
+	configureWithoutOutput(t)
+
+	if s := buf.String(); !strings.Contains(s, "One") || !strings.Contains(s, "Two") {
+		t.Errorf("Got '%s', expecting the queued entries", s)
+	}
+}
+
+func TestAsyncCore(t *testing.T) {
+	collector, buf := newCollectingCore(zapcore.DebugLevel)
+	core := &blockingCore{Core: collector, release: make(chan struct{})}
+	q := newAsyncQueue(10, asyncDropNewest, newDropTally(asyncDroppedEntriesTotal, ""))
+
+	c := newAsyncCore(core, q)
+	if err := c.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "Queued"}, nil); err != nil {
+		t.Errorf("Got err '%v', expecting success", err)
+	}
+
+	close(core.release)
+
+	// entries at the DPanic level and above are written right away, after the queued ones
+	if err := c.Write(zapcore.Entry{Level: zapcore.DPanicLevel, Message: "Immediate"}, nil); err != nil {
+		t.Errorf("Got err '%v', expecting success", err)
+	}
+	if s := buf.String(); strings.Index(s, "Queued") < 0 || strings.Index(s, "Queued") > strings.Index(s, "Immediate") {
+		t.Errorf("Got '%s', expecting Queued followed by Immediate", s)
+	}
+
+	// once the queue is stopped, entries are written right away
+	q.close()
+	if err := c.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "Stopped"}, nil); err != nil {
+		t.Errorf("Got err '%v', expecting success", err)
+	}
+	if err := c.Sync(); err != nil {
+		t.Errorf("Got err '%v', expecting success", err)
+	}
+	if !strings.Contains(buf.String(), "Stopped") {
+		t.Errorf("Got '%s', expecting Stopped", buf)
+	}
+}
+
+func TestAsyncErrors(t *testing.T) {
+	o := NewOptions()
+	o.Async = true
+	o.AsyncBufferSize = -1
+	if err := Configure(o); err == nil {
+		t.Error("Got success, expecting error")
+	}
+
+	o = NewOptions()
+	o.Async = true
+	o.AsyncDropPolicy = "drop-some"
+	if err := Configure(o); err == nil {
+		t.Error("Got success, expecting error")
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// AttributeBag is the part of a Mixer attribute bag read by AttributesField. The bags of the
+// attribute package implement it.
+type AttributeBag interface {
+	// Names returns the names of all the attributes known to the bag.
+	Names() []string
+
+	// Get returns an attribute value.
+	Get(name string) (interface{}, bool)
+}
+
+// attributePeeker is implemented by the bags able to return values without recording the access,
+// so that logging a bag doesn't change the attributes reported as referenced.
+type attributePeeker interface {
+	Peek(name string) (interface{}, bool)
+}
+
+const (
+	// attributesKey is the key of the fields constructed by AttributesField.
+	attributesKey = "attributes"
+
+	// omittedKey is the key of the number of attributes left out of the field.
+	omittedKey = "omitted"
+)
+
+// The limits of the attributes output by AttributesField, past which attributes are left out and
+// values are cut.
+var (
+	maxAttributes        = 64
+	maxAttributeValueLen = 256
+)
+
+// AttributesField constructs a field holding the attributes of the given bag, as an object with
+// an entry per attribute sorted by name, in place of dumping the bag with fmt or DebugString:
+//
+//		log.Debug("Dispatching check", log.AttributesField(bag))
+//
+// The bag is read only once the entry is known to be output, by the goroutine logging the entry,
+// and without recording the attributes as referenced when the bag supports it. Past the first 64
+// attributes the rest are left out and counted under "omitted", and values are cut to 256 bytes.
+// The registered redactors apply to each attribute, and to each entry of string map attributes
+// such as request.headers. The value of the field is a fmt.Stringer, so the attributes can also be
+// output through other loggers such as glog:
+//
+//		glog.Info("Attribute Bag: ", log.AttributesField(bag).Interface)
+func AttributesField(bag AttributeBag) zapcore.Field {
+	return Lazy(attributesKey, func() interface{} {
+		return readAttributes(bag)
+	})
+}
+
+// attribute is the name and the value of an attribute, ready to be output.
+type attribute struct {
+	name  string
+	value interface{}
+}
+
+// attributes is a snapshot of the attributes of a bag, bounded and redacted.
+type attributes struct {
+	attrs   []attribute
+	omitted int
+}
+
+func readAttributes(bag AttributeBag) *attributes {
+	get := bag.Get
+	if p, ok := bag.(attributePeeker); ok {
+		get = p.Peek
+	}
+
+	names := bag.Names()
+	sort.Strings(names)
+
+	result := &attributes{}
+	if len(names) > maxAttributes {
+		result.omitted = len(names) - maxAttributes
+		names = names[:maxAttributes]
+	}
+
+	rs := redactors.Load().([]Redactor)
+	result.attrs = make([]attribute, 0, len(names))
+	for _, name := range names {
+		v, ok := get(name)
+		if !ok {
+			continue
+		}
+		if rv, redacted := redactValue(rs, name, v); redacted {
+			v = rv
+		}
+		result.attrs = append(result.attrs, attribute{name, boundValue(v)})
+	}
+
+	return result
+}
+
+// boundValue returns the attribute value in a form which can be output, cut down to size.
+func boundValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		s, _ := truncate(t, maxAttributeValueLen)
+		return s
+
+	case int64, float64, bool, time.Time, time.Duration:
+		return t
+
+	case []byte:
+		// addresses, such as source.ip, are held as bytes
+		if len(t) == net.IPv4len || len(t) == net.IPv6len {
+			return net.IP(t).String()
+		}
+		s, _ := truncate(fmt.Sprintf("%x", t), maxAttributeValueLen)
+		return s
+
+	case map[string]string:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		m := &attributes{}
+		if len(keys) > maxAttributes {
+			m.omitted = len(keys) - maxAttributes
+			keys = keys[:maxAttributes]
+		}
+		m.attrs = make([]attribute, len(keys))
+		for i, k := range keys {
+			m.attrs[i] = attribute{k, boundValue(t[k])}
+		}
+		return m
+	}
+
+	s, _ := truncate(fmt.Sprint(v), maxAttributeValueLen)
+	return s
+}
+
+// MarshalLogObject outputs the attributes as the entries of an object.
+func (a *attributes) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for _, attr := range a.attrs {
+		switch v := attr.value.(type) {
+		case string:
+			enc.AddString(attr.name, v)
+		case int64:
+			enc.AddInt64(attr.name, v)
+		case float64:
+			enc.AddFloat64(attr.name, v)
+		case bool:
+			enc.AddBool(attr.name, v)
+		case time.Time:
+			enc.AddTime(attr.name, v)
+		case time.Duration:
+			enc.AddDuration(attr.name, v)
+		case *attributes:
+			if err := enc.AddObject(attr.name, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	if a.omitted > 0 {
+		enc.AddInt(omittedKey, a.omitted)
+	}
+	return nil
+}
+
+// String is used by the cores other than those set up by Configure, which output the attributes
+// as a string.
+func (a *attributes) String() string {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, attr := range a.attrs {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		_, _ = fmt.Fprintf(&buf, "%s: %v", attr.name, attr.value)
+	}
+	if a.omitted > 0 {
+		if len(a.attrs) > 0 {
+			buf.WriteString(", ")
+		}
+		_, _ = fmt.Fprintf(&buf, "%s: %d", omittedKey, a.omitted)
+	}
+	buf.WriteByte('}')
+	return buf.String()
+}
@@ -0,0 +1,134 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// testBag is an attribute bag counting the reads of its attributes.
+type testBag struct {
+	values map[string]interface{}
+	gets   int
+	peeks  int
+}
+
+func (b *testBag) Names() []string {
+	names := make([]string, 0, len(b.values))
+	for name := range b.values {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (b *testBag) Get(name string) (interface{}, bool) {
+	b.gets++
+	v, ok := b.values[name]
+	return v, ok
+}
+
+// peekingBag adds a Peek method to the bag it wraps.
+type peekingBag struct {
+	*testBag
+}
+
+func (b peekingBag) Peek(name string) (interface{}, bool) {
+	b.peeks++
+	v, ok := b.values[name]
+	return v, ok
+}
+
+func TestAttributesField(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	configureWithoutOutput(t)
+	defer configureWithoutOutput(t)
+
+	bag := &testBag{values: map[string]interface{}{
+		"request.path":     "/" + strings.Repeat("a", 300),
+		"request.size":     int64(12),
+		"request.time":     time.Unix(0, 0).UTC(),
+		"response.latency": 5 * time.Millisecond,
+		"source.ip":        []byte{10, 0, 0, 1},
+		"request.headers": map[string]string{
+			"authorization": "Basic dXNlcjpwYXNz",
+			"x-request-id":  "42",
+		},
+		"request.auth.token": "Bearer abc",
+	}}
+
+	// nothing is read for the entries discarded
+	Debug("Not output", AttributesField(bag))
+	if bag.gets != 0 {
+		t.Errorf("Got %d reads, expecting none", bag.gets)
+	}
+
+	Info("Hello", AttributesField(peekingBag{bag}))
+	if bag.gets != 0 || bag.peeks == 0 {
+		t.Errorf("Got %d reads with Get, expecting the bag to be peeked at", bag.gets)
+	}
+
+	expected := `{"level":"info","msg":"Hello","attributes":{` +
+		`"request.auth.token":"Bearer [REDACTED]",` +
+		`"request.headers":{"authorization":"[REDACTED]","x-request-id":"42"},` +
+		`"request.path":"/` + strings.Repeat("a", 255) + `",` +
+		`"request.size":12,` +
+		`"request.time":"1970-01-01T00:00:00.000Z",` +
+		`"response.latency":"5ms",` +
+		`"source.ip":"10.0.0.1"}}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Got\n%s\nexpecting\n%s", buf, expected)
+	}
+}
+
+func TestAttributesFieldLimit(t *testing.T) {
+	defer func(n int) { maxAttributes = n }(maxAttributes)
+	maxAttributes = 2
+
+	bag := &testBag{values: map[string]interface{}{
+		"a": "1",
+		"b": map[string]string{"x": "1", "y": "2", "z": "3"},
+		"c": "3",
+	}}
+
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	zap.New(newLazyCore(core)).Info("Hello", AttributesField(bag))
+	expected := `{"level":"info","msg":"Hello","attributes":{"a":"1","b":{"x":"1","y":"2","omitted":1},"omitted":1}}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Got\n%s\nexpecting\n%s", buf, expected)
+	}
+	if bag.gets != 2 {
+		t.Errorf("Got %d reads, expecting only those of the attributes output", bag.gets)
+	}
+
+	// cores outside of the configured log output the attributes as a string
+	core, buf = newCollectingCore(zapcore.DebugLevel)
+	zap.New(core).Info("Hello", AttributesField(bag))
+	expected = `{"level":"info","msg":"Hello","attributes":"{a: 1, b: {x: 1, y: 2, omitted: 1}, omitted: 1}"}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Got\n%s\nexpecting\n%s", buf, expected)
+	}
+
+	// as do other loggers, such as glog
+	if got := fmt.Sprint(AttributesField(bag).Interface); got != "{a: 1, b: {x: 1, y: 2, omitted: 1}, omitted: 1}" {
+		t.Errorf("Got '%s', expecting the attributes as a string", got)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"crypto"
+	"io"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// The name under which audit entries are output.
+const auditScopeName = "audit"
+
+var (
+	// The logger against which all audit entries are output.
+	auditLogger = zap.NewNop()
+
+	// Serializes audit output, so entries are written in the order they were added to the hash chain.
+	auditMu sync.Mutex
+)
+
+// auditStream is the audit logger set up by a call to Configure, along with the files it writes to
+// and the checkpoints of its hash chain. It is held by the generation of that call, which closes it
+// once the audit stream of the next one has taken over.
+type auditStream struct {
+	logger *zap.Logger
+
+	// the hash chain to output checkpoints of, and how often
+	chain              *auditChain
+	checkpointInterval time.Duration
+
+	// closed to stop writing checkpoints, once they are started
+	stop chan struct{}
+
+	// closers for the files opened
+	closers []io.Closer
+}
+
+// newAuditStream sets up an audit stream, reporting its errors to the given output and creating its
+// files with the given settings. Unlike the diagnostic output, the audit stream is never sampled or
+// filtered, and flushed after every entry. Audit entries are only written to it once started.
+func newAuditStream(options *Options, errorOutput zapcore.WriteSyncer, fs *fileSettings) (s *auditStream, err error) {
+	s = &auditStream{logger: zap.NewNop()}
+	if len(options.AuditOutputPaths) == 0 {
+		return s, nil
+	}
+
+	var signer crypto.Signer
+	if options.AuditHashChain && options.AuditSigningKeyPath != "" {
+		if signer, err = loadSigner(options.AuditSigningKeyPath); err != nil {
+			return nil, err
+		}
+	}
+
+	// close the files already opened if the others can't be
+	defer func() {
+		if err != nil {
+			s.close()
+		}
+	}()
+
+	// the audit stream rotates on a schedule of its own
+	rs := &rotationSettings{interval: options.AuditRotationInterval, compress: options.RotationCompress}
+	paths, rotated := splitRotatedFiles(options.AuditOutputPaths, rs)
+
+	var syncers []zapcore.WriteSyncer
+	if len(paths) > 0 {
+		sink, closeSink, err := zap.Open(paths...)
+		if err != nil {
+			return nil, err
+		}
+		s.closers = append(s.closers, closerFunc(closeSink))
+		syncers = append(syncers, sink)
+	}
+	for _, p := range rotated {
+		f, err := newRotatingFile(p, rs, fs)
+		if err != nil {
+			return nil, err
+		}
+		s.closers = append(s.closers, f)
+		syncers = append(syncers, f)
+	}
+	sink := zapcore.NewMultiWriteSyncer(syncers...)
+
+	var enc zapcore.Encoder
+	switch options.AuditEncoding {
+	case cefEncoding:
+		enc = newSIEMEncoder(false, zapcore.DefaultLineEnding)
+	case leefEncoding:
+		enc = newSIEMEncoder(true, zapcore.DefaultLineEnding)
+	default:
+		// the layout of the diagnostic output doesn't apply, so that the entries and checkpoints
+		// keep the keys VerifyAuditLog and the tools reading the stream expect
+		enc = zapcore.NewJSONEncoder(newEncoderConfig())
+	}
+
+	if options.AuditHashChain {
+		s.chain = &auditChain{signer: signer}
+		s.checkpointInterval = options.AuditCheckpointInterval
+		enc = newChainEncoder(enc, s.chain)
+	}
+
+	opts := []zap.Option{zap.ErrorOutput(errorOutput), zap.AddCallerSkip(1), zap.WrapCore(newRedactingCore), zap.WrapCore(newClockCore), zap.Hooks(countEntry)}
+	if options.IncludeCallerSourceLocation {
+		opts = append(opts, zap.AddCaller())
+	}
+
+	s.logger = zap.New(zapcore.NewCore(enc, sink, zapcore.InfoLevel), opts...).Named(auditScopeName)
+	return s, nil
+}
+
+// start makes Audit output to the stream, and starts writing its checkpoints.
+func (s *auditStream) start() {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	auditLogger = s.logger
+	if s.chain != nil && s.checkpointInterval > 0 {
+		s.stop = make(chan struct{})
+		go writeCheckpoints(s.chain, s.logger, s.checkpointInterval, s.stop)
+	}
+}
+
+// close stops writing checkpoints and closes the files of the stream. The checkpoints are written
+// while holding auditMu, so none is being written once it is acquired here.
+func (s *auditStream) close() {
+	if s.stop != nil {
+		auditMu.Lock()
+		close(s.stop)
+		auditMu.Unlock()
+	}
+
+	closeSinks(s.closers)
+}
+
+// Audit outputs a security-relevant event, such as a policy denial or a configuration change,
+// to the audit stream.
+//
+// Audit entries are written independently of the output level and are never sampled or filtered.
+// Each entry is flushed to its destination before this call returns.
+func Audit(msg string, fields ...zapcore.Field) {
+	auditMu.Lock()
+	auditLogger.Info(msg, fields...)
+	_ = auditLogger.Sync()
+	auditMu.Unlock()
+}
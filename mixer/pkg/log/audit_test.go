@@ -0,0 +1,136 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestAudit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	auditPath := filepath.Join(dir, "audit.log")
+
+	lines, err := captureStdout(func() {
+		o := NewOptions()
+		o.AuditOutputPaths = []string{auditPath}
+		o.MessageFilters = []string{"exclude=denied"}
+		_ = o.SetOutputLevel(None)
+		if err := Configure(o); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		for i := 0; i < 150; i++ {
+			Audit("Policy denied", zap.String("user", "bob"), zap.String("authorization", "secret"))
+		}
+		Error("Not output")
+		Sync()
+	})
+
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	if len(lines) != 1 || lines[0] != "" {
+		t.Errorf("Got '%v', expecting no diagnostic output", lines)
+	}
+
+	content, err := ioutil.ReadFile(auditPath)
+	if err != nil {
+		t.Fatalf("Unable to read audit log: %v", err)
+	}
+
+	audit := strings.Split(string(content), "\n")
+	if len(audit)-1 != 150 {
+		t.Errorf("Got %d audit entries, expecting 150", len(audit)-1)
+	}
+
+	pat := "{\"level\":\"info\",\"time\":\".*\",\"logger\":\"audit\",\"msg\":\"Policy denied\",\"user\":\"bob\",\"authorization\":\"\\[REDACTED\\]\"}"
+	if match, _ := regexp.MatchString(pat, audit[0]); !match {
+		t.Errorf("Got '%s', expecting to match '%s'", audit[0], pat)
+	}
+}
+
+func TestAuditDisabled(t *testing.T) {
+	lines, err := captureStdout(func() {
+		o := NewOptions()
+		o.AuditOutputPaths = nil
+		if err := Configure(o); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		Audit("Policy denied")
+		Sync()
+	})
+
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	if len(lines) != 1 || lines[0] != "" {
+		t.Errorf("Got '%v', expecting no output", lines)
+	}
+}
+
+func TestAuditKeptOnFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	first := filepath.Join(dir, "first.log")
+	second := filepath.Join(dir, "second.log")
+
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = []string{first}
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer configureWithoutOutput(t)
+	Audit("One")
+
+	// the audit stream is set up, but the outputs then fail
+	o.AuditOutputPaths = []string{second}
+	o.OutputPaths = []string{"nats://localhost/logs?buffer=0"}
+	if err := Configure(o); err == nil {
+		t.Fatal("Got success, expecting error")
+	}
+	Audit("Two")
+
+	content, err := ioutil.ReadFile(first)
+	if err != nil {
+		t.Fatalf("Unable to read audit log: %v", err)
+	}
+	if !strings.Contains(string(content), `"msg":"One"`) || !strings.Contains(string(content), `"msg":"Two"`) {
+		t.Errorf("Got '%s', expecting both entries in the previous audit stream", content)
+	}
+
+	if content, _ = ioutil.ReadFile(second); len(content) != 0 {
+		t.Errorf("Got '%s', expecting nothing in the audit stream which failed to be set up", content)
+	}
+}
@@ -0,0 +1,336 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// Hash chaining of audit entries
+//
+// When hash chaining is enabled, every audit entry is extended with two extra keys which are
+// always the last ones on the line:
+//
+//		{...,"seq":<n>,"chain":"<hex>"}
+//
+// seq counts the entries written since the process started, beginning at 1. chain is the hex-encoded
+// SHA-256 digest of the previous entry's chain value (32 zero bytes for the first entry) followed by
+// the bytes of the entry up to and including the seq value. Modifying, removing, or reordering entries
+// therefore breaks the chain from that point on.
+//
+// Periodic checkpoint entries record the sequence number and chain value reached so far, signed with
+// a private key. Comparing the latest checkpoint against the end of the log reveals truncation.
+
+const (
+	auditCheckpointMsg = "audit checkpoint"
+	auditSeqKey        = "seq"
+	auditChainKey      = "chain"
+)
+
+var (
+	auditBufferPool  = buffer.NewPool()
+	auditChainSuffix = regexp.MustCompile(`,"` + auditChainKey + `":"([0-9a-f]{64})"}$`)
+	auditSeqSuffix   = regexp.MustCompile(`,"` + auditSeqKey + `":([0-9]+)$`)
+)
+
+// auditChain holds the running state of the hash chain.
+type auditChain struct {
+	mu     sync.Mutex
+	seq    uint64
+	last   [sha256.Size]byte
+	signer crypto.Signer
+}
+
+// extend appends the next sequence number to the given entry body and adds the result to the chain.
+// It returns the new chain value.
+func (c *auditChain) extend(body *buffer.Buffer) [sha256.Size]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seq++
+	body.AppendString(`,"` + auditSeqKey + `":`)
+	body.AppendUint(c.seq)
+
+	h := sha256.New()
+	_, _ = h.Write(c.last[:])
+	_, _ = h.Write(body.Bytes())
+	copy(c.last[:], h.Sum(nil))
+
+	return c.last
+}
+
+// current returns the sequence number and chain value of the last entry.
+func (c *auditChain) current() (uint64, [sha256.Size]byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.seq, c.last
+}
+
+// chainEncoder extends the entries produced by a JSON encoder with a sequence number and chain value.
+type chainEncoder struct {
+	zapcore.Encoder
+	chain *auditChain
+}
+
+func newChainEncoder(enc zapcore.Encoder, chain *auditChain) zapcore.Encoder {
+	return &chainEncoder{enc, chain}
+}
+
+func (e *chainEncoder) Clone() zapcore.Encoder {
+	return &chainEncoder{e.Encoder.Clone(), e.chain}
+}
+
+func (e *chainEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	buf, err := e.Encoder.EncodeEntry(ent, fields)
+	if err != nil {
+		return nil, err
+	}
+	defer buf.Free()
+
+	// strip the closing brace and line ending, the sequence number and chain value go there
+	encoded := bytes.TrimRight(buf.Bytes(), "\r\n")
+	if len(encoded) == 0 || encoded[len(encoded)-1] != '}' {
+		return nil, errors.New("unable to chain audit entry, not a JSON object")
+	}
+
+	body := auditBufferPool.Get()
+	_, _ = body.Write(encoded[:len(encoded)-1])
+
+	chain := e.chain.extend(body)
+	body.AppendString(`,"` + auditChainKey + `":"`)
+	body.AppendString(hex.EncodeToString(chain[:]))
+	body.AppendString("\"}\n")
+
+	return body, nil
+}
+
+// writeCheckpoint outputs a checkpoint recording the current state of the chain, signed if the chain has a signer.
+func (c *auditChain) writeCheckpoint(l *zap.Logger) error {
+	seq, last := c.current()
+	fields := []zapcore.Field{
+		zap.Uint64("checkpoint_seq", seq),
+		zap.String("checkpoint_chain", hex.EncodeToString(last[:])),
+	}
+
+	if c.signer != nil {
+		digest := checkpointDigest(seq, last[:])
+		sig, err := c.signer.Sign(rand.Reader, digest, crypto.SHA256)
+		if err != nil {
+			return fmt.Errorf("unable to sign audit checkpoint: %v", err)
+		}
+		fields = append(fields, zap.String("signature", base64.StdEncoding.EncodeToString(sig)))
+	}
+
+	l.Info(auditCheckpointMsg, fields...)
+	return l.Sync()
+}
+
+func checkpointDigest(seq uint64, chain []byte) []byte {
+	d := sha256.Sum256([]byte(strconv.FormatUint(seq, 10) + ":" + hex.EncodeToString(chain)))
+	return d[:]
+}
+
+// writeCheckpoints periodically outputs checkpoints to the given logger until the stop channel is
+// closed.
+func writeCheckpoints(c *auditChain, l *zap.Logger, interval time.Duration, stop <-chan struct{}) {
+	t := newTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C():
+			auditMu.Lock()
+			select {
+			case <-stop:
+				// the audit stream was reconfigured while waiting for the lock
+			default:
+				if err := c.writeCheckpoint(l); err != nil {
+					Errora(err)
+				}
+			}
+			auditMu.Unlock()
+		}
+	}
+}
+
+// loadSigner reads a PEM-encoded PKCS#8, EC, or PKCS#1 private key from the given file.
+func loadSigner(path string) (crypto.Signer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read audit signing key: %v", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("unable to decode audit signing key %s: no PEM data found", path)
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, fmt.Errorf("unsupported audit signing key type in %s", path)
+	}
+
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unable to parse audit signing key %s", path)
+}
+
+// VerifyAuditLog checks the integrity of an audit log produced with hash chaining enabled.
+//
+// It recomputes the hash chain over every entry and checks that each checkpoint matches the chain.
+// If pub is not nil, the checkpoint signatures are verified against it. The chain restarts whenever
+// an entry with a sequence number of 1 is found, which happens each time a process starts appending
+// to the log.
+//
+// It returns the sequence number of the last checkpoint found, which callers can compare against
+// their own records to detect truncation.
+func VerifyAuditLog(r io.Reader, pub crypto.PublicKey) (uint64, error) {
+	var last [sha256.Size]byte
+	var seq, lastCheckpoint uint64
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for line := 1; s.Scan(); line++ {
+		entry := s.Bytes()
+		if len(entry) == 0 {
+			continue
+		}
+
+		m := auditChainSuffix.FindSubmatchIndex(entry)
+		if m == nil {
+			return lastCheckpoint, fmt.Errorf("line %d: missing chain value", line)
+		}
+		body := entry[:m[0]]
+		chain := entry[m[2]:m[3]]
+
+		sm := auditSeqSuffix.FindSubmatch(body)
+		if sm == nil {
+			return lastCheckpoint, fmt.Errorf("line %d: missing sequence number", line)
+		}
+
+		n, err := strconv.ParseUint(string(sm[1]), 10, 64)
+		if err != nil {
+			return lastCheckpoint, fmt.Errorf("line %d: invalid sequence number: %v", line, err)
+		}
+
+		if n == 1 {
+			// a new process started appending to the log
+			last = [sha256.Size]byte{}
+		} else if n != seq+1 {
+			return lastCheckpoint, fmt.Errorf("line %d: expecting sequence number %d, got %d", line, seq+1, n)
+		}
+
+		var cp struct {
+			Msg       string `json:"msg"`
+			Seq       uint64 `json:"checkpoint_seq"`
+			Chain     string `json:"checkpoint_chain"`
+			Signature string `json:"signature"`
+		}
+		if bytes.Contains(body, []byte(auditCheckpointMsg)) {
+			if err = json.Unmarshal(append(append([]byte(nil), body...), '}'), &cp); err != nil {
+				return lastCheckpoint, fmt.Errorf("line %d: unable to parse entry: %v", line, err)
+			}
+		}
+
+		if cp.Msg == auditCheckpointMsg {
+			if cp.Seq != seq || cp.Chain != hex.EncodeToString(last[:]) {
+				return lastCheckpoint, fmt.Errorf("line %d: checkpoint does not match the chain", line)
+			}
+
+			if pub != nil {
+				if err = verifyCheckpoint(pub, cp.Seq, last[:], cp.Signature); err != nil {
+					return lastCheckpoint, fmt.Errorf("line %d: %v", line, err)
+				}
+			}
+
+			lastCheckpoint = n
+		}
+
+		h := sha256.New()
+		_, _ = h.Write(last[:])
+		_, _ = h.Write(body)
+		copy(last[:], h.Sum(nil))
+
+		if hex.EncodeToString(last[:]) != string(chain) {
+			return lastCheckpoint, fmt.Errorf("line %d: chain value mismatch, the log has been altered", line)
+		}
+
+		seq = n
+	}
+
+	return lastCheckpoint, s.Err()
+}
+
+func verifyCheckpoint(pub crypto.PublicKey, seq uint64, chain []byte, signature string) error {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(sig) == 0 {
+		return errors.New("missing or malformed checkpoint signature")
+	}
+
+	digest := checkpointDigest(seq, chain)
+
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		var es struct{ R, S *big.Int }
+		if _, err = asn1.Unmarshal(sig, &es); err != nil || !ecdsa.Verify(k, digest, es.R, es.S) {
+			return errors.New("invalid checkpoint signature")
+		}
+	case *rsa.PublicKey:
+		if err = rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, sig); err != nil {
+			return errors.New("invalid checkpoint signature")
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+
+	return nil
+}
@@ -0,0 +1,287 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func writeChainedAudit(t *testing.T) []byte {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	auditPath := filepath.Join(dir, "audit.log")
+
+	o := NewOptions()
+	o.AuditOutputPaths = []string{auditPath}
+	o.AuditHashChain = true
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		Audit("Policy denied", zap.Int("attempt", i))
+	}
+
+	content, err := ioutil.ReadFile(auditPath)
+	if err != nil {
+		t.Fatalf("Unable to read audit log: %v", err)
+	}
+
+	return content
+}
+
+func TestAuditHashChainEncoderSettings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	auditPath := filepath.Join(dir, "audit.log")
+
+	// the layout of the diagnostic output doesn't affect the audit stream
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = []string{auditPath}
+	o.AuditHashChain = true
+	o.EncoderKeys = []string{"msg=message", "time=ts"}
+	o.TimeFormat = "epoch-millis"
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer configureWithoutOutput(t)
+
+	Audit("Policy denied")
+	Audit("Policy denied")
+
+	// write a checkpoint rather than waiting for the ticker
+	auditMu.Lock()
+	err = activeGeneration.audit.chain.writeCheckpoint(auditLogger)
+	auditMu.Unlock()
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	content, err := ioutil.ReadFile(auditPath)
+	if err != nil {
+		t.Fatalf("Unable to read audit log: %v", err)
+	}
+
+	if !strings.Contains(string(content), `"time":"`) || !strings.Contains(string(content), `"msg":"Policy denied"`) {
+		t.Errorf("Got '%s', expecting the keys of the audit stream", content)
+	}
+
+	seq, err := VerifyAuditLog(bytes.NewReader(content), nil)
+	if err != nil {
+		t.Errorf("Got err '%v', expecting success", err)
+	}
+	// the checkpoint follows the two entries in the chain
+	if seq != 3 {
+		t.Errorf("Got last checkpoint %d, expecting 3", seq)
+	}
+}
+
+// newChainTestLogger returns a logger which outputs hash chained entries to the given buffer.
+func newChainTestLogger(buf *bytes.Buffer, chain *auditChain) *zap.Logger {
+	enc := newChainEncoder(zapcore.NewJSONEncoder(newEncoderConfig()), chain)
+	return zap.New(zapcore.NewCore(enc, zapcore.AddSync(buf), zapcore.InfoLevel))
+}
+
+func writeKey(t *testing.T, dir string) (string, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %v", err)
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Unable to marshal key: %v", err)
+	}
+
+	path := filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Unable to write key: %v", err)
+	}
+
+	return path, key
+}
+
+func TestAuditHashChain(t *testing.T) {
+	content := writeChainedAudit(t)
+
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 10 {
+		t.Fatalf("Got %d audit entries, expecting 10", len(lines))
+	}
+
+	if !strings.Contains(lines[0], `"attempt":0,"seq":1,"chain":"`) {
+		t.Errorf("Got '%s', expecting a sequence number and chain value", lines[0])
+	}
+
+	if _, err := VerifyAuditLog(bytes.NewReader(content), nil); err != nil {
+		t.Errorf("Got err '%v', expecting success", err)
+	}
+
+	cases := []struct {
+		name   string
+		tamper func([]string) []string
+	}{
+		{"modified", func(l []string) []string {
+			l[3] = strings.Replace(l[3], "Policy denied", "Policy allowed", 1)
+			return l
+		}},
+		{"removed", func(l []string) []string {
+			return append(l[:3], l[4:]...)
+		}},
+		{"reordered", func(l []string) []string {
+			l[3], l[4] = l[4], l[3]
+			return l
+		}},
+		{"unchained", func(l []string) []string {
+			l[3] = "{\"msg\":\"Policy denied\"}"
+			return l
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tampered := c.tamper(append([]string(nil), lines...))
+			if _, err := VerifyAuditLog(strings.NewReader(strings.Join(tampered, "\n")), nil); err == nil {
+				t.Error("Got success, expecting error")
+			}
+		})
+	}
+}
+
+func TestAuditCheckpoints(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	keyPath, key := writeKey(t, dir)
+	signer, err := loadSigner(keyPath)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	// drive the chain directly rather than waiting for the checkpoint ticker
+	chain := &auditChain{signer: signer}
+
+	var buf bytes.Buffer
+	l := newChainTestLogger(&buf, chain)
+	for i := 0; i < 5; i++ {
+		l.Info("Policy denied", zap.Int("attempt", i))
+		if i == 2 {
+			if err := chain.writeCheckpoint(l); err != nil {
+				t.Fatalf("Got err '%v', expecting success", err)
+			}
+		}
+	}
+	if err := chain.writeCheckpoint(l); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	seq, err := VerifyAuditLog(bytes.NewReader(buf.Bytes()), &key.PublicKey)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	if seq != 7 {
+		t.Errorf("Got last checkpoint %d, expecting 7", seq)
+	}
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %v", err)
+	}
+	if _, err := VerifyAuditLog(bytes.NewReader(buf.Bytes()), &other.PublicKey); err == nil {
+		t.Error("Got success verifying with the wrong key, expecting error")
+	}
+}
+
+func TestAuditCheckpointTicker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	auditPath := filepath.Join(dir, "audit.log")
+	o := NewOptions()
+	o.AuditOutputPaths = []string{auditPath}
+	o.AuditHashChain = true
+	o.AuditCheckpointInterval = time.Millisecond
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	Audit("Policy denied")
+	time.Sleep(20 * time.Millisecond)
+
+	// stop the checkpoints
+	o.AuditHashChain = false
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	content, err := ioutil.ReadFile(auditPath)
+	if err != nil {
+		t.Fatalf("Unable to read audit log: %v", err)
+	}
+
+	if !strings.Contains(string(content), auditCheckpointMsg) {
+		t.Errorf("Got '%s', expecting checkpoints", content)
+	}
+}
+
+func TestLoadSignerErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	garbage := filepath.Join(dir, "garbage.pem")
+	_ = ioutil.WriteFile(garbage, []byte("not a key"), 0600)
+
+	for _, path := range []string{filepath.Join(dir, "missing.pem"), garbage} {
+		o := NewOptions()
+		o.AuditOutputPaths = []string{filepath.Join(dir, "audit.log")}
+		o.AuditHashChain = true
+		o.AuditSigningKeyPath = path
+		if err := Configure(o); err == nil {
+			t.Errorf("Got success loading %s, expecting error", path)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	batcherMinBackoff    = 100 * time.Millisecond
+	batcherMaxBackoff    = 30 * time.Second
+	batcherErrorInterval = 10 * time.Second
+)
+
+var errBatcherFull = errors.New("log sink buffer full, entry dropped")
+
+// retryableError marks the failures of a batch which are worth retrying. When only some of the
+// entries of a batch failed, retry holds the ones to send again.
+type retryableError struct {
+	error
+	retry []interface{}
+}
+
+// batcherErrorKey rate-limits the reporting of failures.
+type batcherErrorKey string
+
+// batchSettings control how a batcher groups entries.
+type batchSettings struct {
+	// maximum number of entries in a batch
+	size int
+
+	// maximum time an entry waits for its batch to fill up
+	interval time.Duration
+
+	// maximum number of entries held waiting to be sent
+	buffer int
+
+	// maximum time Sync waits for the buffered entries to be sent
+	timeout time.Duration
+}
+
+// parseBatchSettings reads the batch, flush, buffer, and timeout query parameters, falling back to the given defaults.
+func parseBatchSettings(q url.Values, defaults batchSettings) (batchSettings, error) {
+	s := defaults
+
+	if b := q.Get("batch"); b != "" {
+		n, err := strconv.Atoi(b)
+		if err != nil || n < 1 {
+			return s, fmt.Errorf("invalid batch size %s", b)
+		}
+		s.size = n
+	}
+
+	if f := q.Get("flush"); f != "" {
+		d, err := time.ParseDuration(f)
+		if err != nil || d <= 0 {
+			return s, fmt.Errorf("invalid flush interval %s", f)
+		}
+		s.interval = d
+	}
+
+	if b := q.Get("buffer"); b != "" {
+		n, err := strconv.Atoi(b)
+		if err != nil || n < 1 {
+			return s, fmt.Errorf("invalid buffer size %s", b)
+		}
+		s.buffer = n
+	}
+
+	if t := q.Get("timeout"); t != "" {
+		d, err := time.ParseDuration(t)
+		if err != nil || d <= 0 {
+			return s, fmt.Errorf("invalid timeout %s", t)
+		}
+		s.timeout = d
+	}
+
+	return s, nil
+}
+
+// batcher buffers entries and hands them over in batches to a send function, from a background
+// goroutine. Batches failing with a retryableError are retried with an increasing delay, others
+// are dropped. Entries are dropped when the buffer is full.
+type batcher struct {
+	name     string
+	settings batchSettings
+	send     func(batch []interface{}) error
+
+	queue chan interface{}
+	flush chan chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+
+	// the status of the output, if tracked
+	stats atomic.Value // *sinkStats
+}
+
+func newBatcher(name string, settings batchSettings, send func([]interface{}) error) *batcher {
+	b := &batcher{
+		name:     name,
+		settings: settings,
+		send:     send,
+		queue:    make(chan interface{}, settings.buffer),
+		flush:    make(chan chan struct{}),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go b.run()
+	return b
+}
+
+// enqueue hands an entry over to the background goroutine, without blocking.
+func (b *batcher) enqueue(entry interface{}) error {
+	select {
+	case b.queue <- entry:
+		return nil
+	default:
+		return errBatcherFull
+	}
+}
+
+// sync waits for the entries buffered so far to be sent.
+func (b *batcher) sync() error {
+	ch := make(chan struct{})
+	timeout := time.After(b.settings.timeout)
+
+	select {
+	case b.flush <- ch:
+	case <-b.done:
+		return nil
+	case <-timeout:
+		return fmt.Errorf("timed out flushing log entries to %s", b.name)
+	}
+
+	select {
+	case <-ch:
+		return nil
+	case <-timeout:
+		return fmt.Errorf("timed out flushing log entries to %s", b.name)
+	}
+}
+
+func (b *batcher) reportStatus(s *sinkStats) {
+	s.background = true
+	b.stats.Store(s)
+}
+
+func (b *batcher) status() *sinkStats {
+	s, _ := b.stats.Load().(*sinkStats)
+	return s
+}
+
+// Close sends any buffered entries, making a single attempt, and stops the background goroutine.
+func (b *batcher) Close() error {
+	close(b.stop)
+	<-b.done
+	return nil
+}
+
+func (b *batcher) run() {
+	defer close(b.done)
+
+	var pending []interface{}
+	var timer *time.Timer
+	var expired <-chan time.Time
+
+	deliver := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, expired = nil, nil
+		}
+		if len(pending) > 0 {
+			b.deliver(pending)
+			pending = nil
+		}
+	}
+
+	for {
+		select {
+		case entry := <-b.queue:
+			pending = append(pending, entry)
+			if len(pending) >= b.settings.size {
+				deliver()
+			} else if timer == nil {
+				timer = time.NewTimer(b.settings.interval)
+				expired = timer.C
+			}
+
+		case <-expired:
+			timer, expired = nil, nil
+			deliver()
+
+		case ch := <-b.flush:
+			for len(b.queue) > 0 {
+				if pending = append(pending, <-b.queue); len(pending) >= b.settings.size {
+					deliver()
+				}
+			}
+			deliver()
+			close(ch)
+
+		case <-b.stop:
+			for len(b.queue) > 0 && len(pending) < b.settings.size {
+				pending = append(pending, <-b.queue)
+			}
+			if len(pending) > 0 {
+				err := b.send(pending)
+				b.report(err)
+				if err != nil {
+					b.status().drop(len(pending))
+				}
+			}
+			b.status().drop(len(b.queue))
+			return
+		}
+	}
+}
+
+// deliver sends a batch, retrying with an increasing delay until it succeeds, fails for good,
+// or the batcher is stopped.
+func (b *batcher) deliver(batch []interface{}) {
+	backoff := batcherMinBackoff
+
+	for {
+		err := b.send(batch)
+		b.report(err)
+
+		r, ok := err.(retryableError)
+		if !ok {
+			if err != nil {
+				b.status().drop(len(batch))
+			}
+			return
+		}
+		if r.retry != nil {
+			batch = r.retry
+		}
+
+		select {
+		case <-b.stop:
+			b.status().drop(len(batch))
+			return
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > batcherMaxBackoff {
+			backoff = batcherMaxBackoff
+		}
+	}
+}
+
+// report tracks the outcome of an attempt at sending a batch in the status of the output, and
+// outputs failures on stderr, at most once per batcherErrorInterval. This can't go through the
+// logger itself.
+func (b *batcher) report(err error) {
+	if err == nil {
+		b.status().recovered()
+		return
+	}
+
+	b.status().failed(err)
+	if limits.every(batcherErrorKey(b.name), batcherErrorInterval, now()) {
+		reportError("unable to send log entries to %s: %v", b.name, err)
+	}
+}
+
+// postBatch sends a request body with the given headers, gzip-compressing it if asked to, and returns
+// the body of the response. Failures to reach the server and responses with a 429 or 5xx status are retryable.
+func postBatch(client *http.Client, url string, body []byte, compress bool, header http.Header) ([]byte, error) {
+	if compress {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write(body)
+		_ = zw.Close()
+		body = buf.Bytes()
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if compress {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, retryableError{error: err}
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, retryableError{error: err}
+		}
+		return respBody, nil
+	}
+
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("server responded with %s: %s", resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return nil, retryableError{error: err}
+	}
+	return nil, err
+}
@@ -0,0 +1,287 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchRecorder records the batches it is given, failing the first ones with the given errors.
+type batchRecorder struct {
+	sync.Mutex
+	batches [][]interface{}
+	errs    []error
+}
+
+func (r *batchRecorder) send(batch []interface{}) error {
+	r.Lock()
+	defer r.Unlock()
+
+	r.batches = append(r.batches, append([]interface{}(nil), batch...))
+	if len(r.errs) > 0 {
+		err := r.errs[0]
+		r.errs = r.errs[1:]
+		return err
+	}
+	return nil
+}
+
+func (r *batchRecorder) get() [][]interface{} {
+	r.Lock()
+	defer r.Unlock()
+	return r.batches
+}
+
+func testBatchSettings(size int, interval time.Duration) batchSettings {
+	return batchSettings{size: size, interval: interval, buffer: 100, timeout: 5 * time.Second}
+}
+
+func TestBatcherSize(t *testing.T) {
+	r := &batchRecorder{}
+	b := newBatcher("test", testBatchSettings(2, time.Hour), r.send)
+	defer func() { _ = b.Close() }()
+
+	for i := 0; i < 5; i++ {
+		if err := b.enqueue(i); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+	}
+
+	if err := b.sync(); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	expected := [][]interface{}{{0, 1}, {2, 3}, {4}}
+	if got := r.get(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Got %v, expecting %v", got, expected)
+	}
+}
+
+func TestBatcherInterval(t *testing.T) {
+	r := &batchRecorder{}
+	b := newBatcher("test", testBatchSettings(100, 10*time.Millisecond), r.send)
+	defer func() { _ = b.Close() }()
+
+	_ = b.enqueue("a")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(r.get()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the batch to be sent")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if got := r.get(); !reflect.DeepEqual(got, [][]interface{}{{"a"}}) {
+		t.Errorf("Got %v, expecting a single batch", got)
+	}
+}
+
+func TestBatcherRetry(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		attempts int
+	}{
+		{"Retryable", retryableError{error: errors.New("unavailable")}, 2},
+		{"Permanent", errors.New("bad request"), 1},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := &batchRecorder{errs: []error{c.err}}
+			b := newBatcher("test", testBatchSettings(1, time.Hour), r.send)
+			defer func() { _ = b.Close() }()
+
+			_ = b.enqueue("a")
+			if err := b.sync(); err != nil {
+				t.Fatalf("Got err '%v', expecting success", err)
+			}
+
+			if got := len(r.get()); got != c.attempts {
+				t.Errorf("Got %d attempts, expecting %d", got, c.attempts)
+			}
+		})
+	}
+}
+
+func TestBatcherPartialRetry(t *testing.T) {
+	r := &batchRecorder{errs: []error{retryableError{error: errors.New("throttled"), retry: []interface{}{"b"}}}}
+	b := newBatcher("test", testBatchSettings(2, time.Hour), r.send)
+	defer func() { _ = b.Close() }()
+
+	_ = b.enqueue("a")
+	_ = b.enqueue("b")
+	if err := b.sync(); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	expected := [][]interface{}{{"a", "b"}, {"b"}}
+	if got := r.get(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Got %v, expecting %v", got, expected)
+	}
+}
+
+func TestBatcherStatus(t *testing.T) {
+	r := &batchRecorder{errs: []error{errors.New("bad request")}}
+	b := newBatcher("test", testBatchSettings(1, time.Hour), r.send)
+	defer func() { _ = b.Close() }()
+
+	stats := &sinkStats{name: "test"}
+	b.reportStatus(stats)
+
+	_ = b.enqueue("a")
+	_ = b.sync()
+	if s := stats.status(); !s.Failing || s.Errors != 1 || s.Dropped != 1 {
+		t.Errorf("Got %+v, expecting a failing output with the entry dropped", s)
+	}
+
+	// the output recovers once a batch goes through
+	_ = b.enqueue("b")
+	_ = b.sync()
+	if s := stats.status(); s.Failing {
+		t.Errorf("Got %+v, expecting the output to have recovered", s)
+	}
+}
+
+func TestBatcherClose(t *testing.T) {
+	r := &batchRecorder{}
+	b := newBatcher("test", testBatchSettings(100, time.Hour), r.send)
+
+	_ = b.enqueue("a")
+	_ = b.enqueue("b")
+	_ = b.Close()
+
+	if got := r.get(); !reflect.DeepEqual(got, [][]interface{}{{"a", "b"}}) {
+		t.Errorf("Got %v, expecting the buffered entries", got)
+	}
+
+	if err := b.sync(); err != nil {
+		t.Errorf("Got err '%v', expecting success once closed", err)
+	}
+}
+
+func TestBatcherFull(t *testing.T) {
+	b := &batcher{queue: make(chan interface{}, 1)}
+
+	if err := b.enqueue("a"); err != nil {
+		t.Errorf("Got err '%v', expecting success", err)
+	}
+
+	if err := b.enqueue("b"); err != errBatcherFull {
+		t.Errorf("Got err '%v', expecting %v", err, errBatcherFull)
+	}
+}
+
+func TestParseBatchSettings(t *testing.T) {
+	defaults := batchSettings{size: 10, interval: time.Second, buffer: 100, timeout: time.Minute}
+
+	s, err := parseBatchSettings(url.Values{}, defaults)
+	if err != nil || s != defaults {
+		t.Errorf("Got %v, %v, expecting the defaults", s, err)
+	}
+
+	q := url.Values{"batch": {"5"}, "flush": {"2s"}, "buffer": {"50"}, "timeout": {"3s"}}
+	expected := batchSettings{size: 5, interval: 2 * time.Second, buffer: 50, timeout: 3 * time.Second}
+	if s, err = parseBatchSettings(q, defaults); err != nil || s != expected {
+		t.Errorf("Got %v, %v, expecting %v", s, err, expected)
+	}
+
+	for _, k := range []string{"batch", "flush", "buffer", "timeout"} {
+		for _, v := range []string{"0", "x"} {
+			if _, err := parseBatchSettings(url.Values{k: {v}}, defaults); err == nil {
+				t.Errorf("Got success for %s=%s, expecting error", k, v)
+			}
+		}
+	}
+}
+
+func TestPostBatch(t *testing.T) {
+	var mu sync.Mutex
+	var body string
+	var header http.Header
+	status := http.StatusOK
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		header = r.Header
+		reader := r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			reader, _ = gzip.NewReader(r.Body)
+		}
+		b, _ := ioutil.ReadAll(reader)
+		body = string(b)
+
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("response"))
+	}))
+	defer server.Close()
+
+	for _, compress := range []bool{false, true} {
+		resp, err := postBatch(http.DefaultClient, server.URL, []byte("payload"), compress, http.Header{"X-Test": {"1"}})
+		if err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		mu.Lock()
+		if string(resp) != "response" || body != "payload" || header.Get("X-Test") != "1" {
+			t.Errorf("Got response %q, body %q, header %v", resp, body, header)
+		}
+		mu.Unlock()
+	}
+
+	cases := []struct {
+		status    int
+		retryable bool
+	}{
+		{http.StatusBadRequest, false},
+		{http.StatusTooManyRequests, true},
+		{http.StatusServiceUnavailable, true},
+	}
+
+	for _, c := range cases {
+		mu.Lock()
+		status = c.status
+		mu.Unlock()
+
+		_, err := postBatch(http.DefaultClient, server.URL, nil, false, nil)
+		if err == nil {
+			t.Errorf("Got success for status %d, expecting error", c.status)
+			continue
+		}
+
+		if _, ok := err.(retryableError); ok != c.retryable {
+			t.Errorf("Got retryable %v for status %d, expecting %v", ok, c.status, c.retryable)
+		}
+	}
+
+	server.Close()
+	if _, err := postBatch(http.DefaultClient, server.URL, nil, false, nil); err == nil {
+		t.Error("Got success, expecting error")
+	} else if _, ok := err.(retryableError); !ok {
+		t.Errorf("Got err '%v', expecting a retryable error", err)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package binlog implements a compact binary log format, for the cases where encoding entries
+// as JSON is too costly.
+//
+// A binary log is a sequence of protocol buffer messages, each one preceded by its size as a
+// varint, as written by writeDelimitedTo in the Java implementation. The messages follow this
+// schema:
+//
+//	message Entry {
+//	  int64 time = 1;        // nanoseconds since the epoch
+//	  sint32 level = 2;      // the zap level, -1 for debug up to 5 for fatal
+//	  string logger = 3;
+//	  string caller = 4;
+//	  string message = 5;
+//	  string stack = 6;
+//	  repeated Field fields = 7;
+//	}
+//
+//	message Field {
+//	  string key = 1;        // the fields of objects and namespaces get dotted keys
+//	  oneof value {
+//	    string string = 2;
+//	    sint64 int = 3;
+//	    uint64 uint = 4;
+//	    double float = 5;
+//	    bool bool = 6;
+//	    bytes binary = 7;
+//	    string json = 8;     // arrays and reflected values
+//	    sint64 duration = 9; // nanoseconds
+//	    sint64 time = 10;    // nanoseconds since the epoch
+//	  }
+//	}
+//
+// NewEncoder returns a zapcore.Encoder producing this format, and NewReader reads it back.
+package binlog
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Field numbers of Entry.
+const (
+	entryTime    = 1
+	entryLevel   = 2
+	entryLogger  = 3
+	entryCaller  = 4
+	entryMessage = 5
+	entryStack   = 6
+	entryFields  = 7
+)
+
+// Field numbers of Field.
+const (
+	fieldKey      = 1
+	fieldString   = 2
+	fieldInt      = 3
+	fieldUint     = 4
+	fieldFloat    = 5
+	fieldBool     = 6
+	fieldBinary   = 7
+	fieldJSON     = 8
+	fieldDuration = 9
+	fieldTime     = 10
+)
+
+// Wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendTag(b []byte, num int, wireType int) []byte {
+	return appendVarint(b, uint64(num)<<3|uint64(wireType))
+}
+
+func appendUintField(b []byte, num int, v uint64) []byte {
+	b = appendTag(b, num, wireVarint)
+	return appendVarint(b, v)
+}
+
+func appendSintField(b []byte, num int, v int64) []byte {
+	return appendUintField(b, num, uint64(v<<1)^uint64(v>>63))
+}
+
+func appendBoolField(b []byte, num int, v bool) []byte {
+	if v {
+		return appendUintField(b, num, 1)
+	}
+	return appendUintField(b, num, 0)
+}
+
+func appendDoubleField(b []byte, num int, v float64) []byte {
+	b = appendTag(b, num, wireFixed64)
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+	return append(b, buf[:]...)
+}
+
+func appendStringField(b []byte, num int, v string) []byte {
+	b = appendTag(b, num, wireBytes)
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendBytesField(b []byte, num int, v []byte) []byte {
+	b = appendTag(b, num, wireBytes)
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func decodeZigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
@@ -0,0 +1,85 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlog
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestVarint(t *testing.T) {
+	cases := []struct {
+		v        uint64
+		expected []byte
+	}{
+		{0, []byte{0}},
+		{1, []byte{1}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{300, []byte{0xac, 0x02}},
+		{math.MaxUint64, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}},
+	}
+
+	for _, c := range cases {
+		if got := appendVarint(nil, c.v); !bytes.Equal(got, c.expected) {
+			t.Errorf("Got %x for %d, expecting %x", got, c.v, c.expected)
+		}
+	}
+}
+
+func TestZigzag(t *testing.T) {
+	cases := []struct {
+		v        int64
+		expected []byte
+	}{
+		{0, []byte{0x08, 0}},
+		{-1, []byte{0x08, 1}},
+		{1, []byte{0x08, 2}},
+		{-2, []byte{0x08, 3}},
+		{math.MinInt64, []byte{0x08, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}},
+	}
+
+	for _, c := range cases {
+		got := appendSintField(nil, 1, c.v)
+		if !bytes.Equal(got, c.expected) {
+			t.Errorf("Got %x for %d, expecting %x", got, c.v, c.expected)
+		}
+
+		m := message{b: got}
+		if !m.next() || decodeZigzag(m.varint) != c.v {
+			t.Errorf("Got %d after decoding %x, expecting %d", decodeZigzag(m.varint), got, c.v)
+		}
+	}
+}
+
+func TestFieldEncodings(t *testing.T) {
+	cases := []struct {
+		got      []byte
+		expected []byte
+	}{
+		{appendStringField(nil, 3, "ab"), []byte{0x1a, 2, 'a', 'b'}},
+		{appendBytesField(nil, 7, nil), []byte{0x3a, 0}},
+		{appendBoolField(nil, 6, true), []byte{0x30, 1}},
+		{appendUintField(nil, 4, 150), []byte{0x20, 0x96, 0x01}},
+		{appendDoubleField(nil, 5, 1), []byte{0x29, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f}},
+	}
+
+	for i, c := range cases {
+		if !bytes.Equal(c.got, c.expected) {
+			t.Errorf("%d: Got %x, expecting %x", i, c.got, c.expected)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	bufferPool = buffer.NewPool()
+
+	// encoders of entries, whose buffers are reused
+	encoderPool = sync.Pool{New: func() interface{} { return &encoder{} }}
+)
+
+// encoder encodes entries as delimited Entry messages. The fields added with With are encoded
+// right away into buf, and copied into each entry.
+type encoder struct {
+	buf     []byte
+	scratch []byte
+	prefix  string
+}
+
+// NewEncoder returns an encoder producing binary log entries.
+func NewEncoder() zapcore.Encoder {
+	return &encoder{}
+}
+
+func (e *encoder) Clone() zapcore.Encoder {
+	return &encoder{buf: append([]byte(nil), e.buf...), prefix: e.prefix}
+}
+
+func (e *encoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	out := encoderPool.Get().(*encoder)
+	defer encoderPool.Put(out)
+
+	b := out.buf[:0]
+	if !ent.Time.IsZero() {
+		b = appendUintField(b, entryTime, uint64(ent.Time.UnixNano()))
+	}
+	if ent.Level != 0 {
+		b = appendSintField(b, entryLevel, int64(ent.Level))
+	}
+	if ent.LoggerName != "" {
+		b = appendStringField(b, entryLogger, ent.LoggerName)
+	}
+	if ent.Caller.Defined {
+		b = appendStringField(b, entryCaller, ent.Caller.TrimmedPath())
+	}
+	if ent.Message != "" {
+		b = appendStringField(b, entryMessage, ent.Message)
+	}
+	if ent.Stack != "" {
+		b = appendStringField(b, entryStack, ent.Stack)
+	}
+	b = append(b, e.buf...)
+
+	out.buf = b
+	out.prefix = e.prefix
+	for _, f := range fields {
+		f.AddTo(out)
+	}
+
+	buf := bufferPool.Get()
+	var size [10]byte
+	_, _ = buf.Write(appendVarint(size[:0], uint64(len(out.buf))))
+	_, _ = buf.Write(out.buf)
+	return buf, nil
+}
+
+// beginField starts a Field message in the scratch buffer, the value being appended to the
+// returned slice before passing it to endField.
+func (e *encoder) beginField(key string) []byte {
+	return appendStringField(e.scratch[:0], fieldKey, e.prefix+key)
+}
+
+func (e *encoder) endField(m []byte) {
+	e.buf = appendBytesField(e.buf, entryFields, m)
+	e.scratch = m
+}
+
+func (e *encoder) AddArray(key string, arr zapcore.ArrayMarshaler) error {
+	enc := zapcore.NewMapObjectEncoder()
+	err := enc.AddArray(key, arr)
+	if err != nil {
+		return err
+	}
+	return e.AddReflected(key, enc.Fields[key])
+}
+
+func (e *encoder) AddObject(key string, obj zapcore.ObjectMarshaler) error {
+	nested := &encoder{buf: e.buf, scratch: e.scratch, prefix: e.prefix + key + "."}
+	err := obj.MarshalLogObject(nested)
+	e.buf, e.scratch = nested.buf, nested.scratch
+	return err
+}
+
+func (e *encoder) AddBinary(key string, value []byte) {
+	e.endField(appendBytesField(e.beginField(key), fieldBinary, value))
+}
+
+func (e *encoder) AddByteString(key string, value []byte) {
+	e.endField(appendBytesField(e.beginField(key), fieldString, value))
+}
+
+func (e *encoder) AddBool(key string, value bool) {
+	e.endField(appendBoolField(e.beginField(key), fieldBool, value))
+}
+
+func (e *encoder) AddComplex128(key string, value complex128) {
+	e.AddString(key, fmt.Sprint(value))
+}
+
+func (e *encoder) AddComplex64(key string, value complex64) {
+	e.AddComplex128(key, complex128(value))
+}
+
+func (e *encoder) AddDuration(key string, value time.Duration) {
+	e.endField(appendSintField(e.beginField(key), fieldDuration, int64(value)))
+}
+
+func (e *encoder) AddFloat64(key string, value float64) {
+	e.endField(appendDoubleField(e.beginField(key), fieldFloat, value))
+}
+
+func (e *encoder) AddFloat32(key string, value float32) { e.AddFloat64(key, float64(value)) }
+
+func (e *encoder) AddInt(key string, value int)     { e.AddInt64(key, int64(value)) }
+func (e *encoder) AddInt32(key string, value int32) { e.AddInt64(key, int64(value)) }
+func (e *encoder) AddInt16(key string, value int16) { e.AddInt64(key, int64(value)) }
+func (e *encoder) AddInt8(key string, value int8)   { e.AddInt64(key, int64(value)) }
+
+func (e *encoder) AddInt64(key string, value int64) {
+	e.endField(appendSintField(e.beginField(key), fieldInt, value))
+}
+
+func (e *encoder) AddString(key, value string) {
+	e.endField(appendStringField(e.beginField(key), fieldString, value))
+}
+
+func (e *encoder) AddTime(key string, value time.Time) {
+	e.endField(appendSintField(e.beginField(key), fieldTime, value.UnixNano()))
+}
+
+func (e *encoder) AddUint(key string, value uint)       { e.AddUint64(key, uint64(value)) }
+func (e *encoder) AddUint32(key string, value uint32)   { e.AddUint64(key, uint64(value)) }
+func (e *encoder) AddUint16(key string, value uint16)   { e.AddUint64(key, uint64(value)) }
+func (e *encoder) AddUint8(key string, value uint8)     { e.AddUint64(key, uint64(value)) }
+func (e *encoder) AddUintptr(key string, value uintptr) { e.AddUint64(key, uint64(value)) }
+
+func (e *encoder) AddUint64(key string, value uint64) {
+	e.endField(appendUintField(e.beginField(key), fieldUint, value))
+}
+
+func (e *encoder) AddReflected(key string, value interface{}) error {
+	j, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	e.endField(appendBytesField(e.beginField(key), fieldJSON, j))
+	return nil
+}
+
+func (e *encoder) OpenNamespace(key string) {
+	e.prefix += key + "."
+}
@@ -0,0 +1,121 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type user struct {
+	name string
+	id   int
+}
+
+func (u user) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("name", u.name)
+	enc.AddInt("id", u.id)
+	return nil
+}
+
+func TestEncodeDecode(t *testing.T) {
+	enc := NewEncoder()
+	enc.AddString("pod", "mixer-1")
+
+	clone := enc.Clone()
+	clone.OpenNamespace("request")
+
+	ts := time.Unix(1500000000, 123456789).UTC()
+	buf, err := clone.EncodeEntry(zapcore.Entry{
+		Time:       ts,
+		Level:      zapcore.DebugLevel,
+		LoggerName: "dispatcher",
+		Caller:     zapcore.EntryCaller{Defined: true, File: "/src/mixer/pkg/log/log.go", Line: 42},
+		Message:    "Hello",
+		Stack:      "stack",
+	}, []zapcore.Field{
+		zap.Int("int", -3),
+		zap.Uint("uint", 3),
+		zap.Float64("float", 1.5),
+		zap.Bool("bool", true),
+		zap.Binary("binary", []byte{1, 2}),
+		zap.ByteString("bytes", []byte("abc")),
+		zap.Duration("duration", time.Second),
+		zap.Time("time", ts),
+		zap.Strings("strings", []string{"a", "b"}),
+		zap.Object("user", user{"bob", 7}),
+		zap.Reflect("map", map[string]int{"a": 1}),
+	})
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	e, err := NewReader(bytes.NewReader(buf.Bytes())).Next()
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	expected := &Entry{
+		Time:    ts,
+		Level:   zapcore.DebugLevel,
+		Logger:  "dispatcher",
+		Caller:  "log/log.go:42",
+		Message: "Hello",
+		Stack:   "stack",
+		Fields: []Field{
+			{"pod", "mixer-1"},
+			{"request.int", int64(-3)},
+			{"request.uint", uint64(3)},
+			{"request.float", 1.5},
+			{"request.bool", true},
+			{"request.binary", []byte{1, 2}},
+			{"request.bytes", "abc"},
+			{"request.duration", time.Second},
+			{"request.time", ts},
+			{"request.strings", json.RawMessage(`["a","b"]`)},
+			{"request.user.name", "bob"},
+			{"request.user.id", int64(7)},
+			{"request.map", json.RawMessage(`{"a":1}`)},
+		},
+	}
+	if !reflect.DeepEqual(e, expected) {
+		t.Errorf("Got\n%+v\nexpecting\n%+v", e, expected)
+	}
+
+	// the original encoder is unaffected by the clone
+	buf, _ = enc.EncodeEntry(zapcore.Entry{}, []zapcore.Field{zap.String("x", "y")})
+	e, _ = NewReader(bytes.NewReader(buf.Bytes())).Next()
+	if !reflect.DeepEqual(e.Fields, []Field{{"pod", "mixer-1"}, {"x", "y"}}) {
+		t.Errorf("Got fields %+v, expecting pod and x", e.Fields)
+	}
+}
+
+func BenchmarkEncodeEntry(b *testing.B) {
+	enc := NewEncoder()
+	ent := zapcore.Entry{Time: time.Now(), Message: "Request processed"}
+	fields := []zapcore.Field{zap.String("method", "Report"), zap.Int("attributes", 42), zap.Duration("latency", time.Millisecond)}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, _ := enc.EncodeEntry(ent, fields)
+		buf.Free()
+	}
+}
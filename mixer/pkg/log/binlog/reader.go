@@ -0,0 +1,288 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// The largest entry accepted by Reader, guarding against reading garbage as a huge size.
+const maxEntrySize = 64 << 20
+
+var errTruncated = errors.New("truncated binary log message")
+
+// Entry is a log entry read back from a binary log. Times are in UTC.
+type Entry struct {
+	Time    time.Time
+	Level   zapcore.Level
+	Logger  string
+	Caller  string
+	Message string
+	Stack   string
+	Fields  []Field
+}
+
+// Field is a structured field of an entry. Value is a string, int64, uint64, float64, bool,
+// []byte, json.RawMessage, time.Duration, or time.Time.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Reader reads the entries of a binary log.
+type Reader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+// NewReader returns a reader of the binary log in r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next entry of the log, or io.EOF at the end of the log.
+func (r *Reader) Next() (*Entry, error) {
+	size, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("unable to read binary log entry size: %v", err)
+	}
+
+	if size > maxEntrySize {
+		return nil, fmt.Errorf("binary log entry of %d bytes exceeds the maximum of %d bytes", size, maxEntrySize)
+	}
+
+	if uint64(cap(r.buf)) < size {
+		r.buf = make([]byte, size)
+	}
+	r.buf = r.buf[:size]
+	if _, err := io.ReadFull(r.r, r.buf); err != nil {
+		return nil, fmt.Errorf("unable to read binary log entry: %v", err)
+	}
+
+	return decodeEntry(r.buf)
+}
+
+// message iterates over the fields of an encoded protocol buffer message.
+type message struct {
+	b []byte
+
+	num      int
+	wireType int
+	varint   uint64
+	bytes    []byte
+	err      error
+}
+
+func (m *message) next() bool {
+	if len(m.b) == 0 || m.err != nil {
+		return false
+	}
+
+	tag, n := binary.Uvarint(m.b)
+	if n <= 0 {
+		m.err = errTruncated
+		return false
+	}
+	m.b = m.b[n:]
+	m.num, m.wireType = int(tag>>3), int(tag&7)
+	m.varint, m.bytes = 0, nil
+
+	switch m.wireType {
+	case wireVarint:
+		if m.varint, n = binary.Uvarint(m.b); n <= 0 {
+			m.err = errTruncated
+			return false
+		}
+		m.b = m.b[n:]
+	case wireFixed64:
+		if len(m.b) < 8 {
+			m.err = errTruncated
+			return false
+		}
+		m.varint = binary.LittleEndian.Uint64(m.b)
+		m.b = m.b[8:]
+	case wireFixed32:
+		if len(m.b) < 4 {
+			m.err = errTruncated
+			return false
+		}
+		m.varint = uint64(binary.LittleEndian.Uint32(m.b))
+		m.b = m.b[4:]
+	case wireBytes:
+		size, n := binary.Uvarint(m.b)
+		if n <= 0 || uint64(len(m.b)-n) < size {
+			m.err = errTruncated
+			return false
+		}
+		m.bytes = m.b[n : n+int(size)]
+		m.b = m.b[n+int(size):]
+	default:
+		m.err = fmt.Errorf("unsupported wire type %d in binary log message", m.wireType)
+		return false
+	}
+
+	return true
+}
+
+func decodeEntry(b []byte) (*Entry, error) {
+	e := &Entry{}
+
+	m := message{b: b}
+	for m.next() {
+		switch m.num {
+		case entryTime:
+			e.Time = time.Unix(0, int64(m.varint)).UTC()
+		case entryLevel:
+			e.Level = zapcore.Level(decodeZigzag(m.varint))
+		case entryLogger:
+			e.Logger = string(m.bytes)
+		case entryCaller:
+			e.Caller = string(m.bytes)
+		case entryMessage:
+			e.Message = string(m.bytes)
+		case entryStack:
+			e.Stack = string(m.bytes)
+		case entryFields:
+			f, err := decodeField(m.bytes)
+			if err != nil {
+				return nil, err
+			}
+			e.Fields = append(e.Fields, f)
+		}
+	}
+
+	return e, m.err
+}
+
+func decodeField(b []byte) (Field, error) {
+	var f Field
+
+	m := message{b: b}
+	for m.next() {
+		switch m.num {
+		case fieldKey:
+			f.Key = string(m.bytes)
+		case fieldString:
+			f.Value = string(m.bytes)
+		case fieldInt:
+			f.Value = decodeZigzag(m.varint)
+		case fieldUint:
+			f.Value = m.varint
+		case fieldFloat:
+			f.Value = math.Float64frombits(m.varint)
+		case fieldBool:
+			f.Value = m.varint != 0
+		case fieldBinary:
+			f.Value = append([]byte(nil), m.bytes...)
+		case fieldJSON:
+			f.Value = json.RawMessage(append([]byte(nil), m.bytes...))
+		case fieldDuration:
+			f.Value = time.Duration(decodeZigzag(m.varint))
+		case fieldTime:
+			f.Value = time.Unix(0, decodeZigzag(m.varint)).UTC()
+		}
+	}
+
+	return f, m.err
+}
+
+// Zap converts the entry back to what zap passes to encoders.
+func (e *Entry) Zap() (zapcore.Entry, []zapcore.Field) {
+	ent := zapcore.Entry{
+		Level:      e.Level,
+		Time:       e.Time,
+		LoggerName: e.Logger,
+		Message:    e.Message,
+		Stack:      e.Stack,
+	}
+
+	if i := strings.LastIndexByte(e.Caller, ':'); i > 0 {
+		if line, err := strconv.Atoi(e.Caller[i+1:]); err == nil {
+			ent.Caller = zapcore.EntryCaller{Defined: true, File: e.Caller[:i], Line: line}
+		}
+	}
+
+	fields := make([]zapcore.Field, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		fields = append(fields, f.Zap())
+	}
+
+	return ent, fields
+}
+
+// Zap converts the field back to a zap field.
+func (f Field) Zap() zapcore.Field {
+	switch v := f.Value.(type) {
+	case string:
+		return zap.String(f.Key, v)
+	case int64:
+		return zap.Int64(f.Key, v)
+	case uint64:
+		return zap.Uint64(f.Key, v)
+	case float64:
+		return zap.Float64(f.Key, v)
+	case bool:
+		return zap.Bool(f.Key, v)
+	case []byte:
+		return zap.Binary(f.Key, v)
+	case time.Duration:
+		return zap.Duration(f.Key, v)
+	case time.Time:
+		return zap.Time(f.Key, v)
+	default:
+		return zap.Reflect(f.Key, v)
+	}
+}
+
+// Dump re-encodes the entries of the binary log in r with enc, writing them to w. This converts
+// binary logs to JSON or console output.
+func Dump(w io.Writer, r io.Reader, enc zapcore.Encoder) error {
+	br := NewReader(r)
+	for {
+		e, err := br.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		ent, fields := e.Zap()
+		buf, err := enc.EncodeEntry(ent, fields)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(buf.Bytes())
+		buf.Free()
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlog
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func encode(t *testing.T, ent zapcore.Entry, fields ...zapcore.Field) []byte {
+	buf, err := NewEncoder().EncodeEntry(ent, fields)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	return buf.Bytes()
+}
+
+func TestReaderMultiple(t *testing.T) {
+	var log []byte
+	for _, m := range []string{"one", "two", "three"} {
+		log = append(log, encode(t, zapcore.Entry{Message: m})...)
+	}
+
+	r := NewReader(bytes.NewReader(log))
+	for _, m := range []string{"one", "two", "three"} {
+		e, err := r.Next()
+		if err != nil || e.Message != m {
+			t.Errorf("Got %+v, %v, expecting %s", e, err, m)
+		}
+	}
+
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("Got %v, expecting EOF", err)
+	}
+}
+
+func TestReaderUnknownFields(t *testing.T) {
+	// a message written by a newer version, with fields of all wire types this one does not know
+	var m []byte
+	m = appendStringField(m, entryMessage, "Hello")
+	m = appendUintField(m, 20, 1)
+	m = appendDoubleField(m, 21, 1)
+	m = appendStringField(m, 22, "x")
+	m = append(appendTag(m, 23, wireFixed32), 1, 2, 3, 4)
+	m = appendBytesField(m, entryFields, appendUintField(appendStringField(nil, fieldKey, "k"), 30, 5))
+
+	log := append(appendVarint(nil, uint64(len(m))), m...)
+	e, err := NewReader(bytes.NewReader(log)).Next()
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	if e.Message != "Hello" || len(e.Fields) != 1 || e.Fields[0].Key != "k" || e.Fields[0].Value != nil {
+		t.Errorf("Got %+v, expecting the unknown fields to be skipped", e)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	entry := encode(t, zapcore.Entry{Message: "Hello"}, zap.String("user", "bob"))
+
+	cases := map[string][]byte{
+		"truncated size":    {0x80},
+		"truncated entry":   entry[:len(entry)-1],
+		"oversized entry":   appendVarint(nil, maxEntrySize+1),
+		"truncated field":   {3, 0x3a, 5, 0x0a},
+		"unknown wire type": {1, 0x0b},
+	}
+
+	for name, log := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewReader(bytes.NewReader(log)).Next(); err == nil || err == io.EOF {
+				t.Errorf("Got %v, expecting an error", err)
+			}
+		})
+	}
+}
+
+func TestDump(t *testing.T) {
+	ts := time.Date(2017, 9, 1, 10, 0, 0, 0, time.UTC)
+	log := encode(t, zapcore.Entry{Time: ts, Level: zapcore.WarnLevel, Message: "Hello",
+		Caller: zapcore.EntryCaller{Defined: true, File: "log/log.go", Line: 42}},
+		zap.String("user", "bob"), zap.Strings("tags", []string{"a"}), zap.Duration("latency", time.Second))
+
+	cfg := zapcore.EncoderConfig{
+		TimeKey:        "time",
+		LevelKey:       "level",
+		CallerKey:      "caller",
+		MessageKey:     "msg",
+		LineEnding:     zapcore.DefaultLineEnding,
+		EncodeLevel:    zapcore.LowercaseLevelEncoder,
+		EncodeCaller:   zapcore.ShortCallerEncoder,
+		EncodeTime:     zapcore.ISO8601TimeEncoder,
+		EncodeDuration: zapcore.StringDurationEncoder,
+	}
+
+	var out bytes.Buffer
+	if err := Dump(&out, bytes.NewReader(log), zapcore.NewJSONEncoder(cfg)); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	expected := `{"level":"warn","time":"2017-09-01T10:00:00.000Z","caller":"log/log.go:42","msg":"Hello",` +
+		`"user":"bob","tags":["a"],"latency":"1s"}` + "\n"
+	if out.String() != expected {
+		t.Errorf("Got %s, expecting %s", out.String(), expected)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !windows
+
+package log
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/sys/unix"
+)
+
+// CaptureFD outputs each line written to the given file descriptor, such as 2 for stderr, as an
+// entry at the given level under the given scope, or the default scope when empty. The descriptor
+// is replaced by a pipe drained into the log, so that what cgo libraries and child processes write
+// to it shows up as entries rather than raw bytes interleaved with the log:
+//
+//		c, err := log.CaptureFD(2, zapcore.WarnLevel, "iptables")
+//		...
+//		defer c.Close()
+//
+// Closing the returned io.Closer points the descriptor back to what it was, and waits for the lines
+// written until then to be output, which requires child processes holding on to the pipe to have
+// exited.
+//
+// Stdout and stderr can't be captured while the outputs or the error output of the log write to
+// them, as the entries would then be captured in turn, endlessly. Capturing stderr as above takes
+// setting Options.ErrorOutputPaths, which defaults to stderr, to another destination.
+func CaptureFD(fd int, level zapcore.Level, scope string) (io.Closer, error) {
+	if s, ok := stdStreams[fd]; ok && logOutputsTo(s) {
+		return nil, fmt.Errorf("unable to capture %s, which the log outputs to", s)
+	}
+
+	saved, err := unix.Dup(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		_ = unix.Close(saved)
+		return nil, err
+	}
+
+	// the descriptor holds the only write end of the pipe from now on
+	err = unix.Dup2(int(w.Fd()), fd)
+	_ = w.Close()
+	if err != nil {
+		_ = r.Close()
+		_ = unix.Close(saved)
+		return nil, err
+	}
+
+	c := &fdCapture{fd: fd, saved: saved, done: make(chan struct{})}
+	go func() {
+		lw := &lineWriter{core: newGlobalCore(), level: level, scope: scope}
+		_, _ = io.Copy(lw, r)
+		_ = lw.Close()
+		_ = r.Close()
+		close(c.done)
+	}()
+
+	return c, nil
+}
+
+// stdStreams are the names of the descriptors of the standard streams the log can output to.
+var stdStreams = map[int]string{
+	1: "stdout",
+	2: "stderr",
+}
+
+// fdCapture restores a file descriptor captured by CaptureFD when closed.
+type fdCapture struct {
+	fd    int
+	saved int
+
+	// closed once the pipe is drained
+	done chan struct{}
+
+	once sync.Once
+	err  error
+}
+
+func (c *fdCapture) Close() error {
+	c.once.Do(func() {
+		// pointing the descriptor elsewhere closes the write end of the pipe
+		c.err = unix.Dup2(c.saved, c.fd)
+		if err := unix.Close(c.saved); c.err == nil {
+			c.err = err
+		}
+		if c.err == nil {
+			<-c.done
+		}
+	})
+	return c.err
+}
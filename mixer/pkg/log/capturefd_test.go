@@ -0,0 +1,102 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !windows
+
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestCaptureFD(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	configureWithoutOutput(t)
+
+	f, err := ioutil.TempFile("", "log_test")
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	defer func() { _ = f.Close() }()
+
+	c, err := CaptureFD(int(f.Fd()), zapcore.WarnLevel, "exec")
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	// output of the process itself, and of a child process
+	_, _ = f.WriteString("One\nTw")
+	cmd := exec.Command("sh", "-c", "echo o; echo Three")
+	cmd.Stdout = f
+	if err = cmd.Run(); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	if err = c.Close(); err != nil {
+		t.Errorf("Got err '%v', expecting success", err)
+	}
+	if err = c.Close(); err != nil {
+		t.Errorf("Got err '%v', expecting closing again to succeed", err)
+	}
+
+	expected := `{"level":"warn","logger":"exec","msg":"One"}` + "\n" +
+		`{"level":"warn","logger":"exec","msg":"Two"}` + "\n" +
+		`{"level":"warn","logger":"exec","msg":"Three"}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Got\n%s\nexpecting\n%s", buf, expected)
+	}
+
+	// the descriptor is back to the file
+	_, _ = f.WriteString("After\n")
+	if content, err := ioutil.ReadFile(f.Name()); err != nil || string(content) != "After\n" {
+		t.Errorf("Got '%s', %v, expecting only the output written after the capture", content, err)
+	}
+}
+
+func TestCaptureFDOutput(t *testing.T) {
+	defer configureWithoutOutput(t)
+
+	cases := []struct {
+		outputPaths      []string
+		errorOutputPaths []string
+		fd               int
+	}{
+		// the error output defaults to stderr
+		{nil, nil, 2},
+		{[]string{"stderr"}, []string{os.DevNull}, 2},
+		{[]string{"stdout"}, nil, 1},
+	}
+
+	for _, c := range cases {
+		o := NewOptions()
+		o.OutputPaths = c.outputPaths
+		o.ErrorOutputPaths = c.errorOutputPaths
+		o.AuditOutputPaths = nil
+		if err := Configure(o); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		if closer, err := CaptureFD(c.fd, zapcore.WarnLevel, ""); err == nil {
+			_ = closer.Close()
+			t.Errorf("Got success, expecting error")
+		}
+	}
+}
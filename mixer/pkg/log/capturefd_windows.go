@@ -0,0 +1,31 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build windows
+
+package log
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// CaptureFD outputs each line written to the given file descriptor as an entry. Windows has no file
+// descriptors to capture, so it always fails there.
+func CaptureFD(fd int, level zapcore.Level, scope string) (io.Closer, error) {
+	return nil, fmt.Errorf("capturing file descriptors isn't supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,171 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Clock tells the time to the package: the timestamps of the entries, the periods of the rotated
+// files, the intervals of the throttled logging functions, and the ticks of the periodic summaries
+// and syncs. Tests set one with Options.Clock or SetClock so that what they log is deterministic,
+// such as with the clock of the logtest package.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// NewTicker returns a ticker sending the time on its channel at the given interval.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker sends the time on its channel at regular intervals, until stopped.
+type Ticker interface {
+	// C returns the channel the ticks are sent on.
+	C() <-chan time.Time
+
+	// Stop turns the ticker off. No more ticks are sent once it returns, and the channel isn't
+	// closed.
+	Stop()
+}
+
+// systemClock is the clock of the system, used unless another is set.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+// systemTicker is a ticker of the system clock.
+type systemTicker struct {
+	t *time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t systemTicker) Stop() {
+	t.t.Stop()
+}
+
+// clockSetting holds the clock in effect, and whether it was set rather than the system one.
+type clockSetting struct {
+	clock Clock
+	set   bool
+}
+
+var currentClock atomic.Value // clockSetting
+
+func init() {
+	currentClock.Store(clockSetting{clock: systemClock{}})
+}
+
+// setClock makes the package tell the time with the given clock, the system clock when nil, and
+// returns the clock in effect before.
+func setClock(c Clock) Clock {
+	previous := currentClock.Load().(clockSetting)
+	if c == nil {
+		currentClock.Store(clockSetting{clock: systemClock{}})
+	} else {
+		currentClock.Store(clockSetting{clock: c, set: true})
+	}
+
+	if !previous.set {
+		return nil
+	}
+	return previous.clock
+}
+
+// SetClock makes the package tell the time with the given clock, the system clock when nil, until
+// the returned function is called, which puts back the clock in effect before. Configure sets the
+// clock of its options in turn.
+//
+//		clock := logtest.NewClock(time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC))
+//		defer log.SetClock(clock)()
+func SetClock(c Clock) func() {
+	previous := setClock(c)
+	return func() {
+		setClock(previous)
+	}
+}
+
+// now returns the current time of the clock in effect.
+func now() time.Time {
+	return currentClock.Load().(clockSetting).clock.Now()
+}
+
+// newTicker returns a ticker of the clock in effect.
+func newTicker(d time.Duration) Ticker {
+	return currentClock.Load().(clockSetting).clock.NewTicker(d)
+}
+
+// afterFunc calls f in its own goroutine once the clock in effect has moved by the given duration,
+// unless the returned function is called first.
+func afterFunc(d time.Duration, f func()) func() {
+	if d <= 0 {
+		d = time.Nanosecond
+	}
+
+	t := newTicker(d)
+	stop := make(chan struct{})
+	go func() {
+		defer t.Stop()
+		select {
+		case <-t.C():
+			f()
+		case <-stop:
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(stop) })
+	}
+}
+
+// clockCore stamps the entries with the time of the clock set, if any, ahead of the cores it wraps.
+type clockCore struct {
+	zapcore.Core
+}
+
+func newClockCore(core zapcore.Core) zapcore.Core {
+	return &clockCore{core}
+}
+
+func (c *clockCore) With(fields []zapcore.Field) zapcore.Core {
+	return &clockCore{c.Core.With(fields)}
+}
+
+func (c *clockCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if s := currentClock.Load().(clockSetting); s.set {
+		ent.Time = s.clock.Now()
+	}
+	return c.Core.Check(ent, ce)
+}
+
+func (c *clockCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if s := currentClock.Load().(clockSetting); s.set {
+		ent.Time = s.clock.Now()
+	}
+	return c.Core.Write(ent, fields)
+}
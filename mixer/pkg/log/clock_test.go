@@ -0,0 +1,153 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testClock is a clock which only moves when told to.
+type testClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*testTicker
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) NewTicker(d time.Duration) Ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &testTicker{clock: c, c: make(chan time.Time, 1), period: d, next: c.now.Add(d)}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+func (c *testClock) add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	for _, t := range c.tickers {
+		for !t.next.After(c.now) {
+			select {
+			case t.c <- t.next:
+			default:
+			}
+			t.next = t.next.Add(t.period)
+		}
+	}
+}
+
+// testTicker is a ticker of a testClock, which ticks as the clock moves.
+type testTicker struct {
+	clock  *testClock
+	c      chan time.Time
+	period time.Duration
+	next   time.Time
+}
+
+func (t *testTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *testTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	for i, other := range t.clock.tickers {
+		if other == t {
+			t.clock.tickers = append(t.clock.tickers[:i], t.clock.tickers[i+1:]...)
+			return
+		}
+	}
+}
+
+func TestClock(t *testing.T) {
+	clock := &testClock{now: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)}
+	defer configureWithoutOutput(t)
+
+	lines, err := captureStdout(func() {
+		o := NewOptions()
+		o.JSONEncoding = true
+		o.Clock = clock
+		if err := Configure(o); err != nil {
+			t.Errorf("Got err '%v', expecting success", err)
+		}
+
+		Info("Hello")
+		for i := 0; i < 3; i++ {
+			ErrorfThrottled(time.Minute, "Failed %d", i)
+			clock.add(40 * time.Second)
+		}
+		Sync()
+	})
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	if len(lines) < 3 || strings.Contains(strings.Join(lines, "\n"), "Failed 1") {
+		t.Fatalf("Got %v, expecting the entry and two throttled errors", lines)
+	}
+	if !strings.HasPrefix(lines[0], `{"level":"info","time":"2017-01-01T00:00:00.000Z","msg":"Hello"`) {
+		t.Errorf("Got '%s', expecting the time of the clock", lines[0])
+	}
+	if !strings.Contains(lines[2], `"time":"2017-01-01T00:01:20.000Z","msg":"Failed 2"`) {
+		t.Errorf("Got '%s', expecting the third error output a minute after the first", lines[2])
+	}
+
+	// Configure puts back the system clock unless given one
+	configureWithoutOutput(t)
+	if s := currentClock.Load().(clockSetting); s.set {
+		t.Errorf("Got clock %v, expecting the system clock", s.clock)
+	}
+}
+
+func TestSetClock(t *testing.T) {
+	clock := &testClock{now: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)}
+	restore := SetClock(clock)
+	if got := now(); !got.Equal(clock.now) {
+		t.Errorf("Got %v, expecting the time of the clock", got)
+	}
+
+	restore()
+	if s := currentClock.Load().(clockSetting); s.set {
+		t.Errorf("Got clock %v, expecting the system clock put back", s.clock)
+	}
+}
+
+func TestConfigureFailureKeepsClock(t *testing.T) {
+	defer configureWithoutOutput(t)
+
+	o := NewOptions()
+	o.OutputPaths = []string{"tcp://"}
+	o.AuditOutputPaths = nil
+	o.Clock = &testClock{now: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if err := Configure(o); err == nil {
+		t.Fatal("Got success, expecting error")
+	}
+
+	if s := currentClock.Load().(clockSetting); s.set {
+		t.Errorf("Got clock %v, expecting the system clock kept", s.clock)
+	}
+}
@@ -0,0 +1,395 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"go.uber.org/zap/zapcore"
+)
+
+// CloudWatch Logs output
+//
+// Entries are sent to AWS CloudWatch Logs when OutputPaths contains cloudwatch://?group=name.
+// Entries are JSON-encoded. Credentials and the region are found the usual way for the AWS SDK:
+// from the environment, the shared configuration files, or the instance metadata. These query
+// parameters are supported:
+//
+//		group     the log group, required
+//		stream    the log stream, the host name by default
+//		region    the AWS region, overriding the one from the environment
+//		create    whether to create the log group and stream when missing, true by default
+//		batch     the maximum number of entries sent at once, 10000 by default, which is the most CloudWatch accepts
+//		flush     the maximum time an entry waits to be sent, 1s by default
+//		buffer    the maximum number of entries held while CloudWatch is unreachable, 20000 by default
+//		timeout   the maximum time Sync waits for the buffered entries to be sent, 10s by default
+//
+// Batches are split further to respect the limits of PutLogEvents: 1MB per request, and 24 hours
+// between the first and last entries. Entries larger than 256KB are truncated.
+
+const (
+	cloudWatchMaxBatchCount = 10000
+	cloudWatchMaxBatchBytes = 1048576
+	cloudWatchMaxBatchSpan  = 24 * time.Hour
+	cloudWatchMaxEventBytes = 262144
+
+	// the overhead CloudWatch counts for each entry against the size limits
+	cloudWatchEventOverhead = 26
+)
+
+var cloudWatchDefaultBatch = batchSettings{
+	size:     cloudWatchMaxBatchCount,
+	interval: time.Second,
+	buffer:   20000,
+	timeout:  10 * time.Second,
+}
+
+// Creates the CloudWatch Logs clients, replaced by tests.
+var newCloudWatchClient = func(region string) (cloudwatchlogsiface.CloudWatchLogsAPI, error) {
+	cfg := aws.NewConfig()
+	if region != "" {
+		cfg = cfg.WithRegion(region)
+	}
+
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return cloudwatchlogs.New(sess), nil
+}
+
+func init() {
+	RegisterSink("cloudwatch", newCloudWatchSink)
+}
+
+// cloudWatchEvent is an entry waiting to be sent.
+type cloudWatchEvent struct {
+	timestamp int64 // in milliseconds
+	message   string
+}
+
+// cloudWatchStream sends entries to a log stream, keeping track of its sequence token. It is only
+// used by the background goroutine of a batcher.
+type cloudWatchStream struct {
+	client cloudwatchlogsiface.CloudWatchLogsAPI
+	group  string
+	stream string
+	create bool
+
+	ready bool
+	token *string
+}
+
+// send splits a batch according to the limits of PutLogEvents and sends the parts in order. When a
+// part can be retried, it is returned for retrying along with the parts which follow it.
+func (s *cloudWatchStream) send(batch []interface{}) error {
+	sort.SliceStable(batch, func(i, j int) bool {
+		return batch[i].(*cloudWatchEvent).timestamp < batch[j].(*cloudWatchEvent).timestamp
+	})
+
+	var failure error
+	for start, end := 0, 0; start < len(batch); start = end {
+		end = cloudWatchChunkEnd(batch, start)
+
+		err := s.put(batch[start:end])
+		if r, ok := err.(retryableError); ok {
+			r.retry = batch[start:]
+			return r
+		}
+
+		if err != nil {
+			failure = err
+		}
+	}
+
+	return failure
+}
+
+// cloudWatchChunkEnd returns the end of the largest part of a sorted batch, starting at the given
+// index, which PutLogEvents accepts.
+func cloudWatchChunkEnd(batch []interface{}, start int) int {
+	first := batch[start].(*cloudWatchEvent).timestamp
+	size := 0
+
+	for i := start; i < len(batch); i++ {
+		e := batch[i].(*cloudWatchEvent)
+		size += len(e.message) + cloudWatchEventOverhead
+
+		if i-start >= cloudWatchMaxBatchCount || size > cloudWatchMaxBatchBytes ||
+			time.Duration(e.timestamp-first)*time.Millisecond >= cloudWatchMaxBatchSpan {
+			return i
+		}
+	}
+
+	return len(batch)
+}
+
+// put makes an attempt at sending a part of a batch. A stale sequence token, which happens when
+// something else writes to the same stream, is refreshed and the part sent again.
+func (s *cloudWatchStream) put(events []interface{}) error {
+	if !s.ready {
+		if err := s.prepare(); err != nil {
+			return cloudWatchError(err)
+		}
+		s.ready = true
+	}
+
+	input := &cloudwatchlogs.PutLogEventsInput{
+		LogGroupName:  aws.String(s.group),
+		LogStreamName: aws.String(s.stream),
+		LogEvents:     make([]*cloudwatchlogs.InputLogEvent, len(events)),
+	}
+	for i, e := range events {
+		event := e.(*cloudWatchEvent)
+		input.LogEvents[i] = &cloudwatchlogs.InputLogEvent{
+			Message:   aws.String(event.message),
+			Timestamp: aws.Int64(event.timestamp),
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		input.SequenceToken = s.token
+		output, err := s.client.PutLogEvents(input)
+		if err == nil {
+			s.token = output.NextSequenceToken
+			return cloudWatchRejected(output.RejectedLogEventsInfo)
+		}
+
+		aerr, ok := err.(awserr.Error)
+		if !ok {
+			return retryableError{error: err}
+		}
+
+		switch aerr.Code() {
+		case cloudwatchlogs.ErrCodeInvalidSequenceTokenException:
+			if attempt > 0 {
+				return retryableError{error: err}
+			}
+			if err := s.refreshToken(); err != nil {
+				return cloudWatchError(err)
+			}
+
+		case cloudwatchlogs.ErrCodeDataAlreadyAcceptedException:
+			// a previous attempt went through after all
+			return cloudWatchError(s.refreshToken())
+
+		case cloudwatchlogs.ErrCodeResourceNotFoundException:
+			// the group or the stream were deleted, create them again if allowed to
+			s.ready = false
+			return cloudWatchError(err)
+
+		default:
+			return cloudWatchError(err)
+		}
+	}
+}
+
+// prepare creates the log group and stream if needed, and fetches the sequence token of the stream.
+func (s *cloudWatchStream) prepare() error {
+	if s.create {
+		_, err := s.client.CreateLogGroup(&cloudwatchlogs.CreateLogGroupInput{
+			LogGroupName: aws.String(s.group),
+		})
+		if err != nil && !isAWSError(err, cloudwatchlogs.ErrCodeResourceAlreadyExistsException) {
+			return err
+		}
+
+		_, err = s.client.CreateLogStream(&cloudwatchlogs.CreateLogStreamInput{
+			LogGroupName:  aws.String(s.group),
+			LogStreamName: aws.String(s.stream),
+		})
+		if err != nil && !isAWSError(err, cloudwatchlogs.ErrCodeResourceAlreadyExistsException) {
+			return err
+		}
+	}
+
+	return s.refreshToken()
+}
+
+func (s *cloudWatchStream) refreshToken() error {
+	output, err := s.client.DescribeLogStreams(&cloudwatchlogs.DescribeLogStreamsInput{
+		LogGroupName:        aws.String(s.group),
+		LogStreamNamePrefix: aws.String(s.stream),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, ls := range output.LogStreams {
+		if aws.StringValue(ls.LogStreamName) == s.stream {
+			s.token = ls.UploadSequenceToken
+			return nil
+		}
+	}
+
+	return fmt.Errorf("log stream %s not found in log group %s", s.stream, s.group)
+}
+
+func isAWSError(err error, code string) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == code
+}
+
+// cloudWatchError marks the errors worth retrying: all but those caused by invalid requests or
+// missing permissions.
+func cloudWatchError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case cloudwatchlogs.ErrCodeInvalidParameterException, "AccessDeniedException", "UnrecognizedClientException":
+			return err
+		}
+	}
+
+	return retryableError{error: err}
+}
+
+// cloudWatchRejected reports the entries CloudWatch refused for being too old or too far in the future.
+func cloudWatchRejected(info *cloudwatchlogs.RejectedLogEventsInfo) error {
+	if info == nil {
+		return nil
+	}
+
+	var b bytes.Buffer
+	if i := info.TooOldLogEventEndIndex; i != nil {
+		fmt.Fprintf(&b, "entries up to %d too old, ", *i)
+	}
+	if i := info.ExpiredLogEventEndIndex; i != nil {
+		fmt.Fprintf(&b, "entries up to %d expired, ", *i)
+	}
+	if i := info.TooNewLogEventStartIndex; i != nil {
+		fmt.Fprintf(&b, "entries from %d too new, ", *i)
+	}
+	if b.Len() == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("cloudwatch rejected %s", bytes.TrimSuffix(b.Bytes(), []byte(", ")))
+}
+
+// cloudWatchCore outputs entries to a CloudWatch Logs stream.
+type cloudWatchCore struct {
+	zapcore.LevelEnabler
+
+	enc     zapcore.Encoder
+	batcher *batcher
+}
+
+func newCloudWatchSink(u *url.URL, enab zapcore.LevelEnabler) (zapcore.Core, io.Closer, error) {
+	q := u.Query()
+
+	group := q.Get("group")
+	if group == "" {
+		return nil, nil, fmt.Errorf("missing cloudwatch log group in %s", u)
+	}
+
+	stream := q.Get("stream")
+	if stream == "" {
+		var err error
+		if stream, err = os.Hostname(); err != nil {
+			return nil, nil, fmt.Errorf("unable to determine cloudwatch log stream for %s: %v", u, err)
+		}
+	}
+
+	create := true
+	if c := q.Get("create"); c != "" {
+		var err error
+		if create, err = strconv.ParseBool(c); err != nil {
+			return nil, nil, fmt.Errorf("invalid cloudwatch create setting %s: %v", c, err)
+		}
+	}
+
+	settings, err := parseBatchSettings(q, cloudWatchDefaultBatch)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid cloudwatch settings in %s: %v", u, err)
+	}
+	if settings.size > cloudWatchMaxBatchCount {
+		return nil, nil, fmt.Errorf("invalid cloudwatch batch size %d, must be at most %d", settings.size, cloudWatchMaxBatchCount)
+	}
+
+	client, err := newCloudWatchClient(q.Get("region"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create cloudwatch client for %s: %v", u, err)
+	}
+
+	s := &cloudWatchStream{client: client, group: group, stream: stream, create: create}
+	b := newBatcher("cloudwatch log stream "+group+"/"+stream, settings, s.send)
+	return &cloudWatchCore{
+		LevelEnabler: enab,
+		enc:          newJSONEncoder(sinkEncoder),
+		batcher:      b,
+	}, b, nil
+}
+
+func (c *cloudWatchCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.enc = c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(clone.enc)
+	}
+	return &clone
+}
+
+func (c *cloudWatchCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *cloudWatchCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	msg := bytes.TrimRight(buf.Bytes(), "\n")
+
+	// truncate oversized entries, without splitting a character
+	if max := cloudWatchMaxEventBytes - cloudWatchEventOverhead; len(msg) > max {
+		for max > 0 && !utf8.RuneStart(msg[max]) {
+			max--
+		}
+		msg = msg[:max]
+	}
+
+	event := &cloudWatchEvent{
+		timestamp: ent.Time.UnixNano() / int64(time.Millisecond),
+		message:   string(msg),
+	}
+	buf.Free()
+
+	return c.batcher.enqueue(event)
+}
+
+func (c *cloudWatchCore) Sync() error {
+	return c.batcher.sync()
+}
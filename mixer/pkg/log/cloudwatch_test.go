@@ -0,0 +1,304 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// fakeCloudWatch holds the log streams of a single log group, enforcing sequence tokens.
+type fakeCloudWatch struct {
+	cloudwatchlogsiface.CloudWatchLogsAPI
+
+	sync.Mutex
+	group   string
+	streams map[string][]*cloudwatchlogs.InputLogEvent
+	tokens  map[string]int
+}
+
+func newFakeCloudWatch() *fakeCloudWatch {
+	return &fakeCloudWatch{
+		streams: make(map[string][]*cloudwatchlogs.InputLogEvent),
+		tokens:  make(map[string]int),
+	}
+}
+
+func (f *fakeCloudWatch) CreateLogGroup(in *cloudwatchlogs.CreateLogGroupInput) (*cloudwatchlogs.CreateLogGroupOutput, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.group != "" {
+		return nil, awserr.New(cloudwatchlogs.ErrCodeResourceAlreadyExistsException, "exists", nil)
+	}
+	f.group = *in.LogGroupName
+	return &cloudwatchlogs.CreateLogGroupOutput{}, nil
+}
+
+func (f *fakeCloudWatch) CreateLogStream(in *cloudwatchlogs.CreateLogStreamInput) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if _, ok := f.streams[*in.LogStreamName]; ok {
+		return nil, awserr.New(cloudwatchlogs.ErrCodeResourceAlreadyExistsException, "exists", nil)
+	}
+	f.streams[*in.LogStreamName] = nil
+	return &cloudwatchlogs.CreateLogStreamOutput{}, nil
+}
+
+func (f *fakeCloudWatch) DescribeLogStreams(in *cloudwatchlogs.DescribeLogStreamsInput) (*cloudwatchlogs.DescribeLogStreamsOutput, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	out := &cloudwatchlogs.DescribeLogStreamsOutput{}
+	for name := range f.streams {
+		if strings.HasPrefix(name, *in.LogStreamNamePrefix) {
+			out.LogStreams = append(out.LogStreams, &cloudwatchlogs.LogStream{
+				LogStreamName:       aws.String(name),
+				UploadSequenceToken: f.token(name),
+			})
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeCloudWatch) PutLogEvents(in *cloudwatchlogs.PutLogEventsInput) (*cloudwatchlogs.PutLogEventsOutput, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	name := *in.LogStreamName
+	if _, ok := f.streams[name]; !ok || *in.LogGroupName != f.group {
+		return nil, awserr.New(cloudwatchlogs.ErrCodeResourceNotFoundException, "not found", nil)
+	}
+
+	if aws.StringValue(in.SequenceToken) != aws.StringValue(f.token(name)) {
+		return nil, awserr.New(cloudwatchlogs.ErrCodeInvalidSequenceTokenException, "invalid token", nil)
+	}
+
+	for i := 1; i < len(in.LogEvents); i++ {
+		if *in.LogEvents[i].Timestamp < *in.LogEvents[i-1].Timestamp {
+			return nil, awserr.New(cloudwatchlogs.ErrCodeInvalidParameterException, "out of order", nil)
+		}
+	}
+
+	f.streams[name] = append(f.streams[name], in.LogEvents...)
+	f.tokens[name]++
+	return &cloudwatchlogs.PutLogEventsOutput{NextSequenceToken: f.token(name)}, nil
+}
+
+// token returns the expected sequence token of a stream, none before the first write.
+func (f *fakeCloudWatch) token(name string) *string {
+	if f.tokens[name] == 0 {
+		return nil
+	}
+	return aws.String(strconv.Itoa(f.tokens[name]))
+}
+
+func (f *fakeCloudWatch) events(name string) []*cloudwatchlogs.InputLogEvent {
+	f.Lock()
+	defer f.Unlock()
+	return f.streams[name]
+}
+
+func withFakeCloudWatch(t *testing.T, f *fakeCloudWatch) func() {
+	orig := newCloudWatchClient
+	newCloudWatchClient = func(region string) (cloudwatchlogsiface.CloudWatchLogsAPI, error) {
+		if region != "us-west-2" {
+			t.Errorf("Got region %s, expecting us-west-2", region)
+		}
+		return f, nil
+	}
+	return func() { newCloudWatchClient = orig }
+}
+
+func TestCloudWatch(t *testing.T) {
+	f := newFakeCloudWatch()
+	defer withFakeCloudWatch(t, f)()
+
+	o := NewOptions()
+	o.OutputPaths = []string{"cloudwatch://?group=/istio/mixer&stream=mixer-1&region=us-west-2"}
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	With(zap.String("pod", "mixer-1")).Info("Hello", zap.Int("count", 3))
+	Sync()
+	Warn("Again")
+	Sync()
+
+	if f.group != "/istio/mixer" {
+		t.Errorf("Got log group %s, expecting /istio/mixer", f.group)
+	}
+
+	events := f.events("mixer-1")
+	if len(events) != 2 {
+		t.Fatalf("Got %d events, expecting 2", len(events))
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(*events[0].Message), &entry); err != nil {
+		t.Fatalf("Unable to decode event: %v", err)
+	}
+
+	if entry["msg"] != "Hello" || entry["count"] != float64(3) || entry["pod"] != "mixer-1" {
+		t.Errorf("Got %v, expecting the encoded entry", entry)
+	}
+}
+
+func TestCloudWatchSequenceToken(t *testing.T) {
+	f := newFakeCloudWatch()
+	defer withFakeCloudWatch(t, f)()
+
+	u := mustParseURL(t, "cloudwatch://?group=istio&stream=mixer&region=us-west-2&create=true")
+	core, closer, err := newCloudWatchSink(u, zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = closer.Close() }()
+
+	now := time.Now()
+	_ = core.Write(zapcore.Entry{Message: "one", Time: now}, nil)
+	_ = core.Sync()
+
+	// another writer moves the sequence token forward
+	f.Lock()
+	f.tokens["mixer"]++
+	f.Unlock()
+
+	// entries arriving out of order are sorted
+	_ = core.Write(zapcore.Entry{Message: "three", Time: now.Add(time.Second)}, nil)
+	_ = core.Write(zapcore.Entry{Message: "two", Time: now}, nil)
+	if err := core.Sync(); err != nil {
+		t.Errorf("Got err '%v', expecting success", err)
+	}
+
+	events := f.events("mixer")
+	if len(events) != 3 {
+		t.Fatalf("Got %d events, expecting 3", len(events))
+	}
+
+	for i, msg := range []string{"one", "two", "three"} {
+		if !strings.Contains(*events[i].Message, `"msg":"`+msg+`"`) {
+			t.Errorf("Got %s at %d, expecting %s", *events[i].Message, i, msg)
+		}
+	}
+}
+
+func TestCloudWatchChunkEnd(t *testing.T) {
+	event := func(ts int64, size int) interface{} {
+		return &cloudWatchEvent{timestamp: ts, message: strings.Repeat("x", size)}
+	}
+
+	var batch []interface{}
+	for i := 0; i < cloudWatchMaxBatchCount+5; i++ {
+		batch = append(batch, event(0, 1))
+	}
+	if end := cloudWatchChunkEnd(batch, 0); end != cloudWatchMaxBatchCount {
+		t.Errorf("Got %d, expecting the count limit of %d", end, cloudWatchMaxBatchCount)
+	}
+	if end := cloudWatchChunkEnd(batch, cloudWatchMaxBatchCount); end != len(batch) {
+		t.Errorf("Got %d, expecting %d", end, len(batch))
+	}
+
+	size := cloudWatchMaxEventBytes - cloudWatchEventOverhead
+	batch = []interface{}{event(0, size), event(0, size), event(0, size), event(0, size), event(0, size)}
+	if end := cloudWatchChunkEnd(batch, 0); end != 4 {
+		t.Errorf("Got %d, expecting the size limit to allow 4 entries", end)
+	}
+
+	day := int64(cloudWatchMaxBatchSpan / time.Millisecond)
+	batch = []interface{}{event(0, 1), event(day-1, 1), event(day, 1)}
+	if end := cloudWatchChunkEnd(batch, 0); end != 2 {
+		t.Errorf("Got %d, expecting the span limit to allow 2 entries", end)
+	}
+}
+
+func TestCloudWatchTruncate(t *testing.T) {
+	f := newFakeCloudWatch()
+	defer withFakeCloudWatch(t, f)()
+
+	core, closer, err := newCloudWatchSink(mustParseURL(t, "cloudwatch://?group=istio&stream=mixer&region=us-west-2"), zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = closer.Close() }()
+
+	_ = core.Write(zapcore.Entry{Message: strings.Repeat("é", cloudWatchMaxEventBytes), Time: time.Now()}, nil)
+	_ = core.Sync()
+
+	events := f.events("mixer")
+	if len(events) != 1 {
+		t.Fatalf("Got %d events, expecting 1", len(events))
+	}
+
+	msg := *events[0].Message
+	if len(msg) > cloudWatchMaxEventBytes-cloudWatchEventOverhead || !utf8.ValidString(msg) {
+		t.Errorf("Got %d bytes, valid UTF-8 %v, expecting a truncated entry", len(msg), utf8.ValidString(msg))
+	}
+}
+
+func TestCloudWatchError(t *testing.T) {
+	cases := []struct {
+		err       error
+		retryable bool
+	}{
+		{awserr.New(cloudwatchlogs.ErrCodeServiceUnavailableException, "unavailable", nil), true},
+		{awserr.New("ThrottlingException", "slow down", nil), true},
+		{awserr.New(cloudwatchlogs.ErrCodeInvalidParameterException, "invalid", nil), false},
+		{awserr.New("AccessDeniedException", "denied", nil), false},
+	}
+
+	for _, c := range cases {
+		if _, ok := cloudWatchError(c.err).(retryableError); ok != c.retryable {
+			t.Errorf("Got retryable %v for %v, expecting %v", ok, c.err, c.retryable)
+		}
+	}
+
+	if err := cloudWatchRejected(&cloudwatchlogs.RejectedLogEventsInfo{TooOldLogEventEndIndex: aws.Int64(2)}); err == nil {
+		t.Error("Got success, expecting rejected entries to be reported")
+	}
+}
+
+func TestCloudWatchErrors(t *testing.T) {
+	f := newFakeCloudWatch()
+	defer withFakeCloudWatch(t, f)()
+
+	cases := []string{
+		"cloudwatch://?stream=mixer&region=us-west-2",
+		"cloudwatch://?group=istio&create=maybe&region=us-west-2",
+		"cloudwatch://?group=istio&batch=10001&region=us-west-2",
+		"cloudwatch://?group=istio&flush=never&region=us-west-2",
+	}
+
+	for _, c := range cases {
+		t.Run(c, func(t *testing.T) {
+			if _, _, err := newCloudWatchSink(mustParseURL(t, c), zapcore.InfoLevel); err == nil {
+				t.Error("Got success, expecting error")
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"os"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// isTerminal reports whether the given file is a terminal, rather than a file or a pipe.
+var isTerminal = func(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// levelEncoder returns the encoder of the levels of the outputs to the given paths in the given
+// encoding. The levels are colored in the console encoding when the options ask for it, as long as
+// all the paths are terminals, unless the options force the colors.
+func levelEncoder(options *Options, encoding string, paths []string) zapcore.LevelEncoder {
+	if encoding != "console" || !(options.ForceColoredLevels || (options.UseColoredLevels && terminals(paths))) {
+		return zapcore.LowercaseLevelEncoder
+	}
+	return zapcore.CapitalColorLevelEncoder
+}
+
+// terminals returns whether the given paths are all standard streams attached to a terminal.
+func terminals(paths []string) bool {
+	for _, p := range paths {
+		switch p {
+		case "stdout":
+			if !isTerminal(os.Stdout) {
+				return false
+			}
+		case "stderr":
+			if !isTerminal(os.Stderr) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return len(paths) > 0
+}
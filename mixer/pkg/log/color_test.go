@@ -0,0 +1,87 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// replaceIsTerminal makes stdout and stderr look like terminals or not, returning a function which
+// restores the detection.
+func replaceIsTerminal(terminal bool) func() {
+	old := isTerminal
+	isTerminal = func(*os.File) bool { return terminal }
+	return func() { isTerminal = old }
+}
+
+func TestColoredLevels(t *testing.T) {
+	cases := []struct {
+		use      bool
+		force    bool
+		terminal bool
+		encoding string
+		colored  bool
+	}{
+		{false, false, true, "", false},
+		{true, false, true, "", true},
+		{true, false, false, "", false},
+		{false, true, false, "", true},
+		{true, false, true, "json", false},
+		{false, true, false, "json", false},
+	}
+
+	for _, c := range cases {
+		restore := replaceIsTerminal(c.terminal)
+		lines, err := captureStdout(func() {
+			o := NewOptions()
+			o.AuditOutputPaths = nil
+			o.UseColoredLevels = c.use
+			o.ForceColoredLevels = c.force
+			o.Encoding = c.encoding
+			if err := Configure(o); err != nil {
+				t.Fatalf("Got err '%v', expecting success", err)
+			}
+
+			Warn("Hello")
+			Sync()
+		})
+		restore()
+		if err != nil {
+			t.Fatalf("Got error '%v', expected success", err)
+		}
+
+		if colored := strings.Contains(lines[0], "\x1b[33mWARN\x1b[0m"); colored != c.colored {
+			t.Errorf("Got '%s', expecting colored %v for %+v", lines[0], c.colored, c)
+		}
+	}
+	configureWithoutOutput(t)
+}
+
+func TestTerminals(t *testing.T) {
+	defer replaceIsTerminal(true)()
+
+	// files stay free of color codes, even alongside a terminal
+	if terminals([]string{"stdout", "/var/log/mixer.log"}) {
+		t.Error("Got true, expecting a file not to be a terminal")
+	}
+	if terminals(nil) {
+		t.Error("Got true, expecting no paths not to be terminals")
+	}
+	if !terminals([]string{"stdout", "stderr"}) {
+		t.Error("Got false, expecting the standard streams to be terminals")
+	}
+}
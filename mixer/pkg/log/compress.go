@@ -0,0 +1,163 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// The suffixes of the compressed files, and of the files being compressed.
+	compressedSuffix  = ".gz"
+	compressingSuffix = ".gz.tmp"
+
+	// The size of the chunks files are compressed in.
+	compressChunkBytes = 64 * 1024
+)
+
+var (
+	// The pause between the chunks of a file being compressed, which keeps the compression from
+	// competing with the process for the CPU.
+	compressPause = 10 * time.Millisecond
+
+	// Allows a single file to be compressed at a time.
+	compressSlot = make(chan struct{}, 1)
+
+	// The files queued for compression, which are compressed only once however often the outputs
+	// are reconfigured.
+	compressQueued   = make(map[string]bool)
+	compressQueuedMu sync.Mutex
+
+	// The compressions in progress, waited for by tests.
+	compressions sync.WaitGroup
+)
+
+// compressLater compresses the file with the given name in the background, creating the compressed
+// file with the given settings. The file is removed once compressed.
+func compressLater(name string, fs *fileSettings) {
+	compressQueuedMu.Lock()
+	defer compressQueuedMu.Unlock()
+
+	if compressQueued[name] {
+		return
+	}
+	compressQueued[name] = true
+
+	compressions.Add(1)
+	go func() {
+		defer compressions.Done()
+		defer func() {
+			compressQueuedMu.Lock()
+			delete(compressQueued, name)
+			compressQueuedMu.Unlock()
+		}()
+
+		compressSlot <- struct{}{}
+		defer func() { <-compressSlot }()
+
+		if err := compressFile(name, fs); err != nil {
+			reportError("unable to compress the rotated log file %s: %v", name, err)
+		}
+	}()
+}
+
+// resumeCompression removes the files left half-compressed by a crash, and compresses the given
+// rotated files in the background.
+func resumeCompression(rotated []string, fs *fileSettings) {
+	for _, name := range rotated {
+		compressQueuedMu.Lock()
+		queued := compressQueued[name]
+		compressQueuedMu.Unlock()
+
+		if !queued {
+			_ = os.Remove(name + compressingSuffix)
+			compressLater(name, fs)
+		}
+	}
+}
+
+// compressFile gzips the file with the given name, then removes it. The compressed file only gets
+// its final name once complete, so a crash never leaves a truncated one behind.
+func compressFile(name string, fs *fileSettings) (err error) {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	mode := fi.Mode().Perm()
+	if fs.mode != 0 {
+		mode = fs.mode
+	}
+
+	tmp := name + compressingSuffix
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = out.Close()
+			_ = os.Remove(tmp)
+		}
+	}()
+
+	if fs.uid >= 0 || fs.gid >= 0 {
+		if err = out.Chown(fs.uid, fs.gid); err != nil {
+			return err
+		}
+	}
+
+	gz := gzip.NewWriter(out)
+	buf := make([]byte, compressChunkBytes)
+	for {
+		n, readErr := in.Read(buf)
+		if n > 0 {
+			if _, err = gz.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+		time.Sleep(compressPause)
+	}
+
+	if err = gz.Close(); err != nil {
+		return err
+	}
+	if err = out.Sync(); err != nil {
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, name+compressedSuffix); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
@@ -0,0 +1,140 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// readCompressed returns the content of the gzipped file with the given name.
+func readCompressed(t *testing.T, name string) string {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	content, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	return string(content)
+}
+
+func TestCompressFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	name := filepath.Join(dir, "mixer-20171231.log")
+	if err = ioutil.WriteFile(name, []byte("Hello\n"), 0640); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	if err = compressFile(name, &fileSettings{uid: -1, gid: -1}); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	if content := readCompressed(t, name+compressedSuffix); content != "Hello\n" {
+		t.Errorf("Got '%s', expecting the content of the rotated file", content)
+	}
+	if fi, err := os.Stat(name + compressedSuffix); err != nil || fi.Mode().Perm() != 0640 {
+		t.Errorf("Got %v, %v, expecting the compressed file to keep mode 0640", fi.Mode(), err)
+	}
+	for _, n := range []string{name, name + compressingSuffix} {
+		if _, err := os.Stat(n); !os.IsNotExist(err) {
+			t.Errorf("Got err '%v' for %s, expecting the file to be removed", err, n)
+		}
+	}
+
+	if err = compressFile(filepath.Join(dir, "missing.log"), &fileSettings{uid: -1, gid: -1}); err == nil {
+		t.Error("Got success, expecting an error for a missing file")
+	}
+}
+
+func TestRotationCompress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	now := time.Date(2017, time.December, 31, 23, 30, 0, 0, time.Local)
+	rs := &rotationSettings{interval: rotateDaily, compress: true}
+	f, err := openRotatingFile(filepath.Join(dir, "mixer.log"), rs, &fileSettings{uid: -1, gid: -1}, func() time.Time { return now })
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	_, _ = f.Write([]byte("before\n"))
+	now = now.Add(time.Hour)
+	_, _ = f.Write([]byte("after\n"))
+	compressions.Wait()
+
+	if content := readCompressed(t, filepath.Join(dir, "mixer-20171231.log.gz")); content != "before\n" {
+		t.Errorf("Got '%s', expecting the entry of the past period", content)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "mixer-20171231.log")); !os.IsNotExist(err) {
+		t.Errorf("Got err '%v', expecting the rotated file to be removed once compressed", err)
+	}
+}
+
+func TestResumeCompression(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	// a crash left a rotated file half-compressed
+	rotated := filepath.Join(dir, "mixer-20171230.log")
+	if err = ioutil.WriteFile(rotated, []byte("old\n"), 0644); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	if err = ioutil.WriteFile(rotated+compressingSuffix, []byte("partial"), 0644); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	now := time.Date(2017, time.December, 31, 12, 0, 0, 0, time.Local)
+	rs := &rotationSettings{interval: rotateDaily, compress: true}
+	f, err := openRotatingFile(filepath.Join(dir, "mixer.log"), rs, &fileSettings{uid: -1, gid: -1}, func() time.Time { return now })
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	_ = f.Close()
+	compressions.Wait()
+
+	if content := readCompressed(t, rotated+compressedSuffix); content != "old\n" {
+		t.Errorf("Got '%s', expecting the content of the rotated file", content)
+	}
+	for _, n := range []string{rotated, rotated + compressingSuffix, filepath.Join(dir, "mixer.log.gz")} {
+		if _, err := os.Stat(n); !os.IsNotExist(err) {
+			t.Errorf("Got err '%v' for %s, expecting no such file", err, n)
+		}
+	}
+}
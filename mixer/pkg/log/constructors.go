@@ -0,0 +1,163 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// The field constructors below let callers of the package-level functions attach structured
+// context without importing zap themselves. They are thin wrappers around the zap constructors
+// of the same names.
+
+// String constructs a field with the given key and value.
+func String(key string, val string) zapcore.Field {
+	return zap.String(key, val)
+}
+
+// Strings constructs a field that carries a slice of strings.
+func Strings(key string, vals []string) zapcore.Field {
+	return zap.Strings(key, vals)
+}
+
+// Stringer constructs a field with the given key and the output of the value's String method,
+// which is only called when the entry is written.
+func Stringer(key string, val fmt.Stringer) zapcore.Field {
+	return zap.Stringer(key, val)
+}
+
+// ByteString constructs a field that carries UTF-8 encoded text as a []byte.
+func ByteString(key string, val []byte) zapcore.Field {
+	return zap.ByteString(key, val)
+}
+
+// Binary constructs a field that carries an opaque binary blob.
+func Binary(key string, val []byte) zapcore.Field {
+	return zap.Binary(key, val)
+}
+
+// Bool constructs a field that carries a bool.
+func Bool(key string, val bool) zapcore.Field {
+	return zap.Bool(key, val)
+}
+
+// Int constructs a field with the given key and value.
+func Int(key string, val int) zapcore.Field {
+	return zap.Int(key, val)
+}
+
+// Ints constructs a field that carries a slice of integers.
+func Ints(key string, vals []int) zapcore.Field {
+	return zap.Ints(key, vals)
+}
+
+// Int32 constructs a field with the given key and value.
+func Int32(key string, val int32) zapcore.Field {
+	return zap.Int32(key, val)
+}
+
+// Int64 constructs a field with the given key and value.
+func Int64(key string, val int64) zapcore.Field {
+	return zap.Int64(key, val)
+}
+
+// Uint constructs a field with the given key and value.
+func Uint(key string, val uint) zapcore.Field {
+	return zap.Uint(key, val)
+}
+
+// Uint32 constructs a field with the given key and value.
+func Uint32(key string, val uint32) zapcore.Field {
+	return zap.Uint32(key, val)
+}
+
+// Uint64 constructs a field with the given key and value.
+func Uint64(key string, val uint64) zapcore.Field {
+	return zap.Uint64(key, val)
+}
+
+// Float64 constructs a field that carries a float64.
+func Float64(key string, val float64) zapcore.Field {
+	return zap.Float64(key, val)
+}
+
+// Duration constructs a field with the given key and value.
+func Duration(key string, val time.Duration) zapcore.Field {
+	return zap.Duration(key, val)
+}
+
+// Time constructs a field with the given key and value.
+func Time(key string, val time.Time) zapcore.Field {
+	return zap.Time(key, val)
+}
+
+// Err constructs a field that carries an error under the "error" key. It is a no-op if the error
+// is nil. The name avoids the clash with the Error logging function.
+func Err(err error) zapcore.Field {
+	return zap.Error(err)
+}
+
+// errorFields returns the fields describing an error for WithError, which are none if the error
+// is nil.
+func errorFields(err error) []zapcore.Field {
+	if err == nil {
+		return nil
+	}
+
+	msg := err.Error()
+	fields := []zapcore.Field{zap.String("error", msg), zap.String("errorType", fmt.Sprintf("%T", err))}
+
+	// errors with more to tell, such as where they were created, describe it in their verbose form
+	if f, ok := err.(fmt.Formatter); ok {
+		if verbose := fmt.Sprintf("%+v", f); verbose != msg {
+			fields = append(fields, zap.String("errorStack", verbose))
+		}
+	}
+
+	return fields
+}
+
+// NamedError constructs a field that carries an error under the given key. It is a no-op if the
+// error is nil.
+func NamedError(key string, err error) zapcore.Field {
+	return zap.NamedError(key, err)
+}
+
+// Object constructs a field with the given key and an object which marshals itself.
+func Object(key string, val zapcore.ObjectMarshaler) zapcore.Field {
+	return zap.Object(key, val)
+}
+
+// Namespace creates a named, isolated scope within the entry, in which the fields that follow are
+// nested.
+func Namespace(key string) zapcore.Field {
+	return zap.Namespace(key)
+}
+
+// Stack constructs a field that stores the stack trace of the current goroutine under the given
+// key. Capturing stack traces is expensive, so this should be used sparingly.
+func Stack(key string) zapcore.Field {
+	return zap.Stack(key)
+}
+
+// Any constructs a field with the given key and an arbitrary value, choosing the best way to
+// represent it. Prefer the typed constructors, which are faster and allocate less.
+func Any(key string, val interface{}) zapcore.Field {
+	return zap.Any(key, val)
+}
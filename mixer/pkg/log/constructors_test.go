@@ -0,0 +1,78 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+type testObject struct{}
+
+func (testObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("name", "x")
+	return nil
+}
+
+func TestFieldConstructors(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	configureWithoutOutput(t)
+
+	Info("Hello",
+		String("string", "a"),
+		Strings("strings", []string{"b", "c"}),
+		Stringer("stringer", net.IPv4(10, 0, 0, 1)),
+		ByteString("bytestring", []byte("d")),
+		Binary("binary", []byte{1, 2}),
+		Bool("bool", true),
+		Int("int", -1),
+		Ints("ints", []int{2, 3}),
+		Int32("int32", 4),
+		Int64("int64", 5),
+		Uint("uint", 6),
+		Uint32("uint32", 7),
+		Uint64("uint64", 8),
+		Float64("float64", 1.5),
+		Duration("duration", 2*time.Second),
+		Time("time", time.Date(2017, 9, 1, 10, 0, 0, 0, time.UTC)),
+		Err(errors.New("failed")),
+		Err(nil),
+		NamedError("cause", errors.New("timeout")),
+		Object("object", testObject{}),
+		Any("any", map[string]int{"e": 9}),
+		Namespace("nested"),
+		String("inner", "f"),
+	)
+
+	expected := `{"level":"info","msg":"Hello","string":"a","strings":["b","c"],"stringer":"10.0.0.1",` +
+		`"bytestring":"d","binary":"AQI=","bool":true,"int":-1,"ints":[2,3],"int32":4,"int64":5,` +
+		`"uint":6,"uint32":7,"uint64":8,"float64":1.5,"duration":"2s","time":"2017-09-01T10:00:00.000Z",` +
+		`"error":"failed","cause":"timeout","object":{"name":"x"},"any":{"e":9},"nested":{"inner":"f"}}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Got\n%s\nexpecting\n%s", buf, expected)
+	}
+
+	buf.Reset()
+	Info("Trace", Stack("stack"))
+	if s := buf.String(); !strings.Contains(s, `"stack":"`) || !strings.Contains(s, "TestFieldConstructors") {
+		t.Errorf("Got '%s', expecting a stack trace", s)
+	}
+}
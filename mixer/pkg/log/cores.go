@@ -0,0 +1,232 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// addedCore is a core attached with AddCore. Cores are compared by the address of their
+// addedCore, as not all cores are comparable.
+type addedCore struct {
+	zapcore.Core
+}
+
+var (
+	addedCoresMu sync.Mutex
+	addedCores   atomic.Value // []*addedCore
+)
+
+func init() {
+	addedCores.Store([]*addedCore(nil))
+}
+
+// AddCore attaches a core to the log, which then receives the entries sent to the outputs, after
+// filtering, sampling, and redaction. This lets embedders tee the log into their own sinks, such as
+// in-memory buffers or test collectors. The core only receives entries at or above the output level
+// configured through Configure, and is kept across calls to Configure.
+//
+// The returned function detaches the core again.
+func AddCore(core zapcore.Core) func() {
+	added := &addedCore{core}
+
+	addedCoresMu.Lock()
+	current := addedCores.Load().([]*addedCore)
+	updated := make([]*addedCore, len(current), len(current)+1)
+	copy(updated, current)
+	addedCores.Store(append(updated, added))
+	addedCoresMu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			addedCoresMu.Lock()
+			current := addedCores.Load().([]*addedCore)
+			updated := make([]*addedCore, 0, len(current))
+			for _, a := range current {
+				if a != added {
+					updated = append(updated, a)
+				}
+			}
+			addedCores.Store(updated)
+			addedCoresMu.Unlock()
+		})
+	}
+}
+
+// addedCoresCore outputs entries to the cores attached with AddCore. It sits alongside the
+// outputs, and picks up the cores attached or detached since the log was configured.
+type addedCoresCore struct {
+	zapcore.LevelEnabler
+
+	fields []zapcore.Field
+	cache  atomic.Value // *addedCoresCache
+}
+
+// addedCoresCache holds the attached cores with the fields of the addedCoresCore applied.
+type addedCoresCache struct {
+	added []*addedCore
+	cores []zapcore.Core
+}
+
+func newAddedCoresCore(enab zapcore.LevelEnabler) zapcore.Core {
+	return &addedCoresCore{LevelEnabler: enab}
+}
+
+// current returns the attached cores, updating the cache when cores have been attached or detached.
+func (c *addedCoresCore) current() []zapcore.Core {
+	added := addedCores.Load().([]*addedCore)
+	if cache, ok := c.cache.Load().(*addedCoresCache); ok && sameAddedCores(cache.added, added) {
+		return cache.cores
+	}
+
+	cores := make([]zapcore.Core, len(added))
+	for i, a := range added {
+		cores[i] = a.Core
+		if len(c.fields) > 0 {
+			cores[i] = a.With(c.fields)
+		}
+	}
+
+	c.cache.Store(&addedCoresCache{added, cores})
+	return cores
+}
+
+func sameAddedCores(a, b []*addedCore) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *addedCoresCore) Enabled(l zapcore.Level) bool {
+	if !c.LevelEnabler.Enabled(l) {
+		return false
+	}
+
+	for _, core := range c.current() {
+		if core.Enabled(l) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *addedCoresCore) With(fields []zapcore.Field) zapcore.Core {
+	return &addedCoresCore{
+		LevelEnabler: c.LevelEnabler,
+		fields:       append(c.fields[:len(c.fields):len(c.fields)], fields...),
+	}
+}
+
+func (c *addedCoresCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.LevelEnabler.Enabled(ent.Level) {
+		return ce
+	}
+
+	for _, core := range c.current() {
+		ce = core.Check(ent, ce)
+	}
+	return ce
+}
+
+// Write is used by the cores wrapping the outputs, which write entries without checking each
+// output, so the level of each attached core is checked here.
+func (c *addedCoresCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if !c.LevelEnabler.Enabled(ent.Level) {
+		return nil
+	}
+
+	var err error
+	for _, core := range c.current() {
+		if core.Enabled(ent.Level) {
+			if e := core.Write(ent, fields); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+func (c *addedCoresCore) Sync() error {
+	var err error
+	for _, core := range c.current() {
+		if e := core.Sync(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// globalCore forwards entries to the core of the current loggers, picking up the changes made by
+// Configure.
+type globalCore struct {
+	fields []zapcore.Field
+	cache  atomic.Value // *globalCoreCache
+}
+
+// globalCoreCache holds the core of the loggers with the fields of the globalCore applied.
+type globalCoreCache struct {
+	loggers *loggers
+	core    zapcore.Core
+}
+
+func newGlobalCore() zapcore.Core {
+	return &globalCore{}
+}
+
+// current returns the core of the current loggers, updating the cache when they have changed.
+func (c *globalCore) current() zapcore.Core {
+	l := currentLoggers.Load().(*loggers)
+	if cache, ok := c.cache.Load().(*globalCoreCache); ok && cache.loggers == l {
+		return cache.core
+	}
+
+	core := l.base.Core()
+	if len(c.fields) > 0 {
+		core = core.With(c.fields)
+	}
+
+	c.cache.Store(&globalCoreCache{l, core})
+	return core
+}
+
+func (c *globalCore) Enabled(l zapcore.Level) bool {
+	return c.current().Enabled(l)
+}
+
+func (c *globalCore) With(fields []zapcore.Field) zapcore.Core {
+	return &globalCore{fields: append(c.fields[:len(c.fields):len(c.fields)], fields...)}
+}
+
+func (c *globalCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return c.current().Check(ent, ce)
+}
+
+func (c *globalCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.current().Write(ent, fields)
+}
+
+func (c *globalCore) Sync() error {
+	return c.current().Sync()
+}
@@ -0,0 +1,132 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func newCollectingCore(level zapcore.Level) (zapcore.Core, *bytes.Buffer) {
+	cfg := newEncoderConfig()
+	cfg.TimeKey = ""
+
+	var buf bytes.Buffer
+	return zapcore.NewCore(zapcore.NewJSONEncoder(cfg), zapcore.AddSync(&buf), level), &buf
+}
+
+func configureWithoutOutput(t testing.TB) {
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+}
+
+func TestAddCore(t *testing.T) {
+	configureWithoutOutput(t)
+
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	remove := AddCore(core)
+
+	Debug("Not output")
+	Info("Hello", zap.String("authorization", "secret"))
+	With(zap.String("user", "bob")).Warn("World")
+
+	remove()
+	remove()
+	Info("Removed")
+
+	expected := `{"level":"info","msg":"Hello","authorization":"[REDACTED]"}` + "\n" +
+		`{"level":"warn","msg":"World","user":"bob"}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Got\n%s\nexpecting\n%s", buf, expected)
+	}
+}
+
+func TestAddCoreLevel(t *testing.T) {
+	configureWithoutOutput(t)
+
+	core, buf := newCollectingCore(zapcore.ErrorLevel)
+	defer AddCore(core)()
+
+	if !ErrorEnabled() || WarnEnabled() {
+		t.Errorf("Got error %v and warn %v, expecting only error to be enabled", ErrorEnabled(), WarnEnabled())
+	}
+
+	Warn("Not output")
+	Error("Hello")
+
+	if s := buf.String(); strings.Contains(s, "Not output") || !strings.Contains(s, "Hello") {
+		t.Errorf("Got '%s', expecting the error only", s)
+	}
+}
+
+func TestAddCoreReconfigure(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+
+	configureWithoutOutput(t)
+	logger := With(zap.String("user", "bob"))
+	Info("One")
+
+	// cores added after With are picked up by the child logger
+	other, otherBuf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(other)()
+	logger.Info("Two")
+
+	configureWithoutOutput(t)
+	Info("Three")
+
+	for _, m := range []string{"One", "Two", "Three"} {
+		if !strings.Contains(buf.String(), `"msg":"`+m+`"`) {
+			t.Errorf("Got '%s', expecting %s", buf, m)
+		}
+	}
+
+	if s := otherBuf.String(); !strings.Contains(s, `"msg":"Two","user":"bob"`) || strings.Contains(s, "One") {
+		t.Errorf("Got '%s', expecting Two with the fields of the child logger", s)
+	}
+}
+
+func TestGlobalCore(t *testing.T) {
+	defer configureWithoutOutput(t)
+
+	first, firstBuf := newCollectingCore(zapcore.InfoLevel)
+	SetLogger(zap.New(first))
+
+	l := zap.New(Core()).With(zap.String("user", "bob"))
+	l.Debug("Not output")
+	l.Info("One")
+
+	second, secondBuf := newCollectingCore(zapcore.DebugLevel)
+	SetLogger(zap.New(second))
+	l.Debug("Two")
+	if err := l.Sync(); err != nil {
+		t.Errorf("Got err '%v', expecting success", err)
+	}
+
+	if s := firstBuf.String(); s != `{"level":"info","msg":"One","user":"bob"}`+"\n" {
+		t.Errorf("Got '%s', expecting One", s)
+	}
+	if s := secondBuf.String(); s != `{"level":"debug","msg":"Two","user":"bob"}`+"\n" {
+		t.Errorf("Got '%s', expecting Two", s)
+	}
+}
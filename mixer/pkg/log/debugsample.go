@@ -0,0 +1,80 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"hash/fnv"
+	"sync/atomic"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// the share of requests whose debug entries are output, in hundredths of a percent
+var debugSampleRate int32
+
+// debugSampleBuckets is the number of buckets the request IDs are hashed into, one per hundredth
+// of a percent.
+const debugSampleBuckets = 10000
+
+// setDebugSamplePercentage sets the percentage of requests whose debug entries are output.
+func setDebugSamplePercentage(percentage float64) {
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+
+	atomic.StoreInt32(&debugSampleRate, int32(percentage*debugSampleBuckets/100+0.5))
+	updateLowestLevel()
+}
+
+// debugSampling returns whether the debug entries of some requests are output.
+func debugSampling() bool {
+	return atomic.LoadInt32(&debugSampleRate) > 0
+}
+
+// debugSampled returns whether the debug entries of the request of the given ID are output. The
+// decision only depends on the ID, so that every process sampling the same percentage of requests
+// picks the same ones.
+func debugSampled(id string) bool {
+	rate := atomic.LoadInt32(&debugSampleRate)
+	if rate <= 0 || id == "" {
+		return false
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(id))
+	return int32(h.Sum32()%debugSampleBuckets) < rate
+}
+
+// debugSampledKey is the key of the field marking the loggers of the requests whose debug entries
+// are output. The field itself is never output.
+const debugSampledKey = "debugSampled"
+
+// debugSampledMarker is the value of the field marking the loggers of sampled requests.
+type debugSampledMarker struct{}
+
+// debugSampledField marks the logger it is added to with With as that of a sampled request, which
+// scopeLevelCore then lets the debug entries of through.
+func debugSampledField() zapcore.Field {
+	return zapcore.Field{Key: debugSampledKey, Type: zapcore.SkipType, Interface: debugSampledMarker{}}
+}
+
+// hasDebugSampledField returns whether the given fields include the marker of sampled requests.
+func hasDebugSampledField(fields []zapcore.Field) bool {
+	for _, f := range fields {
+		if _, ok := f.Interface.(debugSampledMarker); ok && f.Type == zapcore.SkipType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestDebugSampling(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.DisableSampling = true
+	o.DebugSamplePercentage = 100
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer configureWithoutOutput(t)
+	if err := SetScopeOutputLevel("quiet", None); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	sampled := WithRequestID(context.Background(), "abc")
+	FromContext(sampled).Debug("Sampled")
+	FromContext(sampled).Named("quiet").Debug("Scope off")
+	FromContext(context.Background()).Debug("No request")
+	Debug("Not sampled")
+
+	if s := buf.String(); !strings.Contains(s, `"msg":"Sampled","requestId":"abc"`) ||
+		strings.Contains(s, "Scope off") || strings.Contains(s, "No request") || strings.Contains(s, "Not sampled") {
+		t.Errorf("Got\n%s\nexpecting only the debug entry of the sampled request", s)
+	}
+
+	// nothing is sampled once turned off
+	buf.Reset()
+	setDebugSamplePercentage(0)
+	FromContext(sampled).Debug("Sampled")
+	if buf.Len() != 0 {
+		t.Errorf("Got\n%s\nexpecting no entries", buf)
+	}
+	if l := lowestLevel.Level(); l != zapcore.InfoLevel {
+		t.Errorf("Got %v, expecting the outputs back at the output level", l)
+	}
+}
+
+func TestDebugSampled(t *testing.T) {
+	defer setDebugSamplePercentage(0)
+
+	cases := []struct {
+		percentage float64
+		min        int
+		max        int
+	}{
+		{0, 0, 0},
+		{10, 50, 150},
+		{50, 400, 600},
+		{100, 1000, 1000},
+	}
+
+	for _, c := range cases {
+		setDebugSamplePercentage(c.percentage)
+
+		n := 0
+		for i := 0; i < 1000; i++ {
+			if debugSampled(strconv.Itoa(i)) {
+				n++
+			}
+		}
+
+		if n < c.min || n > c.max {
+			t.Errorf("Got %d requests sampled out of 1000 at %g%%, expecting between %d and %d", n, c.percentage, c.min, c.max)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// DefaultDebugTriggerPath is the conventional path of the file whose presence turns debug messages
+// on, as set with Options.DebugTriggerPath.
+const DefaultDebugTriggerPath = "/var/run/istio/debug"
+
+// How often the presence of the debug trigger file is checked.
+var debugTriggerInterval = time.Second
+
+// watchDebugTrigger sets the output level to debug while the file at the given path exists, and
+// back to the level it replaced once the file is removed, until the stop channel is closed. The
+// level isn't restored when stopping, as Configure sets it anew.
+func watchDebugTrigger(l *zap.Logger, path string, stop <-chan struct{}) {
+	t := newTicker(debugTriggerInterval)
+	defer t.Stop()
+
+	triggered := false
+	previous := zapcore.InfoLevel
+	for {
+		_, err := os.Stat(path)
+		switch present := err == nil; {
+		case present && !triggered:
+			triggered, previous = true, GetOutputLevel()
+			_ = SetOutputLevel(zapcore.DebugLevel)
+			l.Info("Outputting debug messages until the trigger file is removed", zap.String("path", path))
+		case !present && triggered:
+			triggered = false
+			l.Info("Restoring the output level as the trigger file was removed",
+				zap.String("path", path), zap.String("level", levelToString[previous]))
+			_ = SetOutputLevel(previous)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-t.C():
+		}
+	}
+}
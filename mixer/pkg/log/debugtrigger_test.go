@@ -0,0 +1,150 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// syncBuffer is a buffer safe for concurrent use, for collecting the entries of background
+// goroutines.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitForEntry waits for an entry with the given message to be output to the buffer.
+func waitForEntry(t *testing.T, buf *syncBuffer, msg string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(buf.String(), `"msg":"`+msg+`"`) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Got '%s', expecting the entry %s", buf, msg)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// waitForOutputLevel waits for the output level to become the given one.
+func waitForOutputLevel(t *testing.T, level zapcore.Level) {
+	deadline := time.Now().Add(5 * time.Second)
+	for GetOutputLevel() != level {
+		if time.Now().After(deadline) {
+			t.Fatalf("Got output level %v, expecting %v", GetOutputLevel(), level)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDebugTrigger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	interval := debugTriggerInterval
+	debugTriggerInterval = time.Millisecond
+	defer func() { debugTriggerInterval = interval }()
+
+	// the watcher outputs from its own goroutine
+	cfg := newEncoderConfig()
+	cfg.TimeKey = ""
+	buf := &syncBuffer{}
+	defer AddCore(zapcore.NewCore(zapcore.NewJSONEncoder(cfg), zapcore.AddSync(buf), zapcore.DebugLevel))()
+
+	path := filepath.Join(dir, "debug")
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.DebugTriggerPath = path
+	_ = o.SetOutputLevel(zapcore.WarnLevel)
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer configureWithoutOutput(t)
+
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatalf("Unable to create the trigger file: %v", err)
+	}
+	waitForOutputLevel(t, zapcore.DebugLevel)
+	waitForEntry(t, buf, "Outputting debug messages until the trigger file is removed")
+	Debug("Resolved attributes")
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("Unable to remove the trigger file: %v", err)
+	}
+	// the restoration is noted ahead of restoring the level
+	waitForOutputLevel(t, zapcore.WarnLevel)
+	Debug("Resolved attributes again")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Got '%v', expecting the debug messages output only while the file existed", lines)
+	}
+	if !strings.Contains(lines[0], `"msg":"Outputting debug messages until the trigger file is removed","path":"`+path+`"`) {
+		t.Errorf("Got '%s', expecting the trigger noted", lines[0])
+	}
+	if !strings.Contains(lines[1], `"msg":"Resolved attributes"`) {
+		t.Errorf("Got '%s', expecting the debug message", lines[1])
+	}
+	if !strings.Contains(lines[2], `"msg":"Restoring the output level as the trigger file was removed","path":"`+path+`","level":"warn"`) {
+		t.Errorf("Got '%s', expecting the restoration noted", lines[2])
+	}
+}
+
+func TestDebugTriggerPresentAtStart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	path := filepath.Join(dir, "debug")
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatalf("Unable to create the trigger file: %v", err)
+	}
+
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.DebugTriggerPath = path
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer configureWithoutOutput(t)
+
+	waitForOutputLevel(t, zapcore.DebugLevel)
+}
@@ -0,0 +1,181 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const repeatedKey = "repeated"
+
+// dedupState is shared by a dedup core and all of its descendants.
+type dedupState struct {
+	mu sync.Mutex
+
+	// the last entry that was output
+	last       *dedupCore
+	lastEntry  zapcore.Entry
+	lastFields []zapcore.Field
+
+	// repeats of the last entry that were suppressed
+	repeats      int
+	repeatEntry  zapcore.Entry
+	repeatFields []zapcore.Field
+	stopTimer    func()
+}
+
+// repeatSummary is the last of a series of repeats annotated with their count, output once the
+// lock of the state is released.
+type repeatSummary struct {
+	core   *dedupCore
+	ent    zapcore.Entry
+	fields []zapcore.Field
+}
+
+// dedupCore collapses consecutive identical entries output within a window into a
+// single entry annotated with the number of times it was repeated.
+//
+// The first of a series of identical entries is output as is. Repeats that occur within the
+// window are held back and, once the window expires or a different entry comes along, the
+// last of them is output annotated with the repeat count.
+type dedupCore struct {
+	zapcore.Core
+
+	window time.Duration
+	state  *dedupState
+}
+
+func newDedupCore(core zapcore.Core, window time.Duration) zapcore.Core {
+	return &dedupCore{
+		Core:   core,
+		window: window,
+		state:  &dedupState{},
+	}
+}
+
+func (d *dedupCore) With(fields []zapcore.Field) zapcore.Core {
+	return &dedupCore{
+		Core:   d.Core.With(fields),
+		window: d.window,
+		state:  d.state,
+	}
+}
+
+func (d *dedupCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if d.Enabled(ent.Level) {
+		return ce.AddCore(ent, d)
+	}
+	return ce
+}
+
+func (d *dedupCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	s := d.state
+	s.mu.Lock()
+
+	if d.isRepeatLocked(ent, fields) {
+		s.repeats++
+		s.repeatEntry = ent
+		s.repeatFields = fields
+
+		if s.stopTimer == nil {
+			s.stopTimer = afterFunc(d.window-ent.Time.Sub(s.lastEntry.Time), s.flush)
+		}
+
+		s.mu.Unlock()
+		return nil
+	}
+
+	summary := s.takeRepeatsLocked()
+
+	s.last = d
+	s.lastEntry = ent
+	s.lastFields = fields
+	s.mu.Unlock()
+
+	// a slow output mustn't hold up the other callers
+	summary.write()
+	return d.write(ent, fields)
+}
+
+// isRepeatLocked returns whether the given entry repeats the last one output, within the window.
+func (d *dedupCore) isRepeatLocked(ent zapcore.Entry, fields []zapcore.Field) bool {
+	s := d.state
+
+	// never hold back entries which are about to bring the process down
+	if ent.Level >= zapcore.DPanicLevel {
+		return false
+	}
+
+	return s.last == d &&
+		ent.Time.Sub(s.lastEntry.Time) < d.window &&
+		ent.Level == s.lastEntry.Level &&
+		ent.Message == s.lastEntry.Message &&
+		ent.LoggerName == s.lastEntry.LoggerName &&
+		reflect.DeepEqual(s.lastFields, fields)
+}
+
+func (d *dedupCore) Sync() error {
+	d.state.flush()
+	return d.Core.Sync()
+}
+
+// write outputs an entry through the wrapped core, giving it a chance to filter or sample it.
+func (d *dedupCore) write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if ce := d.Core.Check(ent, nil); ce != nil {
+		ce.Write(fields...)
+	}
+	return nil
+}
+
+// flush outputs any pending repeats and resets the window.
+func (s *dedupState) flush() {
+	s.mu.Lock()
+	summary := s.takeRepeatsLocked()
+	s.mu.Unlock()
+
+	summary.write()
+}
+
+// takeRepeatsLocked resets the window, returning the summary of the pending repeats to output, if
+// any.
+func (s *dedupState) takeRepeatsLocked() *repeatSummary {
+	if s.stopTimer != nil {
+		s.stopTimer()
+		s.stopTimer = nil
+	}
+
+	var summary *repeatSummary
+	if s.repeats > 0 {
+		fields := append(s.repeatFields[:len(s.repeatFields):len(s.repeatFields)], zap.Int(repeatedKey, s.repeats))
+		summary = &repeatSummary{core: s.last, ent: s.repeatEntry, fields: fields}
+		s.repeats = 0
+	}
+
+	// start a fresh window for whatever comes next
+	s.last = nil
+	s.repeatFields = nil
+	return summary
+}
+
+func (r *repeatSummary) write() {
+	if r != nil {
+		_ = r.core.write(r.ent, r.fields)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestDedup(t *testing.T) {
+	lines, err := captureStdout(func() {
+		o := NewOptions()
+		o.DedupWindow = time.Hour
+		if err := Configure(o); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		for i := 0; i < 5; i++ {
+			Info("Flap", zap.String("peer", "a"))
+		}
+		Info("Flap", zap.String("peer", "b"))
+		Info("Flap", zap.String("peer", "b"))
+		Warn("Flap", zap.String("peer", "b"))
+		Info("Different")
+		Info("Different")
+		Sync()
+	})
+
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	patterns := []string{
+		"\tinfo\tFlap\t{\"peer\": \"a\"}$",
+		"\tinfo\tFlap\t{\"peer\": \"a\", \"repeated\": 4}$",
+		"\tinfo\tFlap\t{\"peer\": \"b\"}$",
+		"\tinfo\tFlap\t{\"peer\": \"b\", \"repeated\": 1}$",
+		"\twarn\tFlap\t{\"peer\": \"b\"}$",
+		"\tinfo\tDifferent$",
+		"\tinfo\tDifferent\t{\"repeated\": 1}$",
+		"^$",
+	}
+
+	if len(lines) != len(patterns) {
+		t.Fatalf("Got %d lines, expecting %d:\n%s", len(lines), len(patterns), strings.Join(lines, "\n"))
+	}
+
+	for i, pat := range patterns {
+		if match, _ := regexp.MatchString(pat, lines[i]); !match {
+			t.Errorf("Got '%s', expecting to match '%s'", lines[i], pat)
+		}
+	}
+}
+
+func TestDedupWindow(t *testing.T) {
+	lines, err := captureStdout(func() {
+		o := NewOptions()
+		o.DedupWindow = 20 * time.Millisecond
+		if err := Configure(o); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		Info("Flap")
+		Info("Flap")
+		Info("Flap")
+
+		// the pending repeats get flushed when the window expires
+		time.Sleep(100 * time.Millisecond)
+
+		Info("Flap")
+		Sync()
+	})
+
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	patterns := []string{
+		"\tinfo\tFlap$",
+		"\tinfo\tFlap\t{\"repeated\": 2}$",
+		"\tinfo\tFlap$",
+		"^$",
+	}
+
+	if len(lines) != len(patterns) {
+		t.Fatalf("Got %d lines, expecting %d:\n%s", len(lines), len(patterns), strings.Join(lines, "\n"))
+	}
+
+	for i, pat := range patterns {
+		if match, _ := regexp.MatchString(pat, lines[i]); !match {
+			t.Errorf("Got '%s', expecting to match '%s'", lines[i], pat)
+		}
+	}
+}
+
+func TestDedupWindowClock(t *testing.T) {
+	clock := &testClock{now: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)}
+	defer SetClock(clock)()
+
+	cfg := newEncoderConfig()
+	cfg.TimeKey = ""
+	buf := &syncBuffer{}
+	d := newDedupCore(zapcore.NewCore(zapcore.NewJSONEncoder(cfg), zapcore.AddSync(buf), zapcore.DebugLevel), time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if err := d.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "Flap", Time: now()}, nil); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+	}
+
+	// the window follows the clock rather than the time of the system
+	time.Sleep(50 * time.Millisecond)
+	if out := buf.String(); strings.Contains(out, repeatedKey) {
+		t.Fatalf("Got '%s', expecting the repeats held back until the clock moves", out)
+	}
+
+	clock.add(time.Minute)
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(buf.String(), `"msg":"Flap","repeated":2}`) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Got '%s', expecting the repeats output once the window is over", buf)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
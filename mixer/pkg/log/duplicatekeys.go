@@ -0,0 +1,144 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// duplicateKeysKey identifies the call sites already warned about.
+type duplicateKeysKey string
+
+// duplicateKeyCore warns about the entries carrying several fields with the same key, whether
+// passed together or added with With, as they encode to ambiguous JSON. Each call site is warned
+// about once.
+type duplicateKeyCore struct {
+	zapcore.Core
+
+	// the keys of the fields added with With, and those added more than once
+	keys       map[string]bool
+	duplicates []string
+}
+
+func newDuplicateKeyCore(core zapcore.Core) zapcore.Core {
+	return &duplicateKeyCore{Core: core}
+}
+
+func (c *duplicateKeyCore) With(fields []zapcore.Field) zapcore.Core {
+	keys := make(map[string]bool, len(c.keys)+len(fields))
+	for k := range c.keys {
+		keys[k] = true
+	}
+
+	duplicates := c.duplicates[:len(c.duplicates):len(c.duplicates)]
+	for _, f := range fields {
+		if keys[f.Key] {
+			duplicates = append(duplicates, f.Key)
+		}
+		keys[f.Key] = true
+	}
+
+	return &duplicateKeyCore{Core: c.Core.With(fields), keys: keys, duplicates: duplicates}
+}
+
+func (c *duplicateKeyCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *duplicateKeyCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if duplicates := c.findDuplicates(fields); len(duplicates) > 0 {
+		site := callSiteOf(ent)
+		if limits.once(duplicateKeysKey(site)) {
+			warning := zapcore.Entry{
+				Level:      zapcore.WarnLevel,
+				Time:       ent.Time,
+				LoggerName: ent.LoggerName,
+				Message:    fmt.Sprintf("duplicate keys %s logged at %s", strings.Join(duplicates, ", "), site),
+				Caller:     ent.Caller,
+			}
+			if err := c.Core.Write(warning, []zapcore.Field{zap.String("message", ent.Message)}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return c.Core.Write(ent, fields)
+}
+
+// findDuplicates returns the keys found more than once among the given fields and those added with
+// With, sorted.
+func (c *duplicateKeyCore) findDuplicates(fields []zapcore.Field) []string {
+	if len(c.duplicates) == 0 && len(fields) == 0 {
+		return nil
+	}
+
+	found := make(map[string]bool)
+	for _, k := range c.duplicates {
+		found[k] = true
+	}
+
+	for i, f := range fields {
+		if c.keys[f.Key] {
+			found[f.Key] = true
+			continue
+		}
+		for _, g := range fields[:i] {
+			if g.Key == f.Key {
+				found[f.Key] = true
+				break
+			}
+		}
+	}
+
+	if len(found) == 0 {
+		return nil
+	}
+
+	duplicates := make([]string, 0, len(found))
+	for k := range found {
+		duplicates = append(duplicates, k)
+	}
+	sort.Strings(duplicates)
+	return duplicates
+}
+
+// callSiteOf returns the location of the code logging the given entry: its caller when recorded,
+// or else the first call outside zap and this package on the stack of the calling goroutine.
+func callSiteOf(ent zapcore.Entry) string {
+	if ent.Caller.Defined {
+		return ent.Caller.TrimmedPath()
+	}
+
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !isInternalFrame(frame.Function) {
+			return zapcore.EntryCaller{Defined: true, File: frame.File, Line: frame.Line}.TrimmedPath()
+		}
+		if !more {
+			return "unknown location"
+		}
+	}
+}
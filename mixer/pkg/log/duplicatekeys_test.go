@@ -0,0 +1,81 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestDuplicateKeys(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.DetectDuplicateKeys = true
+	o.IncludeCallerSourceLocation = true
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer configureWithoutOutput(t)
+
+	for i := 0; i < 2; i++ {
+		Infow("Sugared", "adapter", "a", "adapter", "b")
+	}
+	Logger().With(zap.String("adapter", "a")).Info("Conflicting", zap.String("adapter", "b"), zap.Int("attempt", 1))
+	Logger().With(zap.String("adapter", "a")).With(zap.String("adapter", "b")).Info("Conflicting context")
+	Info("Distinct", zap.String("adapter", "a"), zap.Int("attempt", 1))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	expected := []string{
+		`"level":"warn",.*"msg":"duplicate keys adapter logged at log/duplicatekeys_test.go:[0-9]+","message":"Sugared"`,
+		`"msg":"Sugared"`,
+		`"msg":"Sugared"`,
+		`"level":"warn",.*"msg":"duplicate keys adapter logged at .*","message":"Conflicting"`,
+		`"msg":"Conflicting"`,
+		`"level":"warn",.*"msg":"duplicate keys adapter logged at .*","message":"Conflicting context"`,
+		`"msg":"Conflicting context"`,
+		`"msg":"Distinct"`,
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("Got '%v', expecting %d entries, the call site repeated being warned about once", lines, len(expected))
+	}
+	for i, line := range lines {
+		if !regexp.MustCompile(expected[i]).MatchString(line) {
+			t.Errorf("Got '%s', expecting it to match '%s'", line, expected[i])
+		}
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	c := newDuplicateKeyCore(zapcore.NewNopCore()).With([]zapcore.Field{zap.String("a", "1"), zap.String("b", "2")})
+
+	duplicates := c.(*duplicateKeyCore).findDuplicates([]zapcore.Field{
+		zap.String("c", "3"), zap.String("b", "4"), zap.String("c", "5"), zap.String("d", "6"),
+	})
+	if strings.Join(duplicates, ",") != "b,c" {
+		t.Errorf("Got %v, expecting b and c", duplicates)
+	}
+
+	if duplicates := c.(*duplicateKeyCore).findDuplicates([]zapcore.Field{zap.String("d", "6")}); duplicates != nil {
+		t.Errorf("Got %v, expecting none", duplicates)
+	}
+}
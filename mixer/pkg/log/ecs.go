@@ -0,0 +1,156 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"runtime"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// ECS encoding
+//
+// The ecs encoding outputs JSON entries following the Elastic Common Schema, so that they fit the
+// dashboards of the Elastic stack without ingest pipelines of their own. Entries have an
+// @timestamp, a log.level, a message, and the ecs.version they follow, the name of their logger is
+// output as log.logger and their source location as log.origin. Fields keyed trace and span are
+// turned into trace.id and span.id, and an error field along with the stack trace of the entry into
+// error.message, error.type, and error.stack_trace.
+
+const (
+	ecsEncoding = "ecs"
+
+	// the version of the Elastic Common Schema followed
+	ecsVersion = "1.6.0"
+
+	ecsTraceKey  = "trace.id"
+	ecsSpanKey   = "span.id"
+	ecsOriginKey = "log.origin"
+	ecsErrorKey  = "error"
+)
+
+func init() {
+	registerEncoder(ecsEncoding, func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		return newECSEncoder(cfg.LineEnding), nil
+	})
+}
+
+// ecsEncoder wraps a JSON encoder, moving the trace, span, caller, and error information of entries
+// to the fields of the Elastic Common Schema.
+type ecsEncoder struct {
+	zapcore.Encoder
+}
+
+func newECSEncoder(lineEnding string) zapcore.Encoder {
+	enc := zapcore.NewJSONEncoder(zapcore.EncoderConfig{
+		TimeKey:        "@timestamp",
+		LevelKey:       "log.level",
+		NameKey:        "log.logger",
+		MessageKey:     "message",
+		LineEnding:     lineEnding,
+		EncodeLevel:    zapcore.LowercaseLevelEncoder,
+		EncodeTime:     encodeStackdriverTime,
+		EncodeDuration: zapcore.StringDurationEncoder,
+	})
+	enc.AddString("ecs.version", ecsVersion)
+
+	return &ecsEncoder{enc}
+}
+
+func (e *ecsEncoder) Clone() zapcore.Encoder {
+	return &ecsEncoder{e.Encoder.Clone()}
+}
+
+func (e *ecsEncoder) AddString(key, value string) {
+	switch key {
+	case traceKey:
+		e.Encoder.AddString(ecsTraceKey, value)
+	case spanKey:
+		e.Encoder.AddString(ecsSpanKey, value)
+	default:
+		e.Encoder.AddString(key, value)
+	}
+}
+
+func (e *ecsEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	out := make([]zapcore.Field, 0, len(fields)+2)
+	ecsErr := ecsError{stack: ent.Stack}
+	for _, f := range fields {
+		switch {
+		case f.Type == zapcore.StringType && f.Key == traceKey:
+			f = zap.String(ecsTraceKey, f.String)
+		case f.Type == zapcore.StringType && f.Key == spanKey:
+			f = zap.String(ecsSpanKey, f.String)
+		case f.Type == zapcore.ErrorType && f.Key == ecsErrorKey && ecsErr.err == nil:
+			if err, ok := f.Interface.(error); ok {
+				ecsErr.err = err
+				continue
+			}
+		}
+		out = append(out, f)
+	}
+
+	if ecsErr.err != nil || ecsErr.stack != "" {
+		out = append(out, zap.Object(ecsErrorKey, ecsErr))
+		ent.Stack = ""
+	}
+
+	if ent.Caller.Defined {
+		out = append(out, zap.Object(ecsOriginKey, ecsOrigin(ent.Caller)))
+		ent.Caller = zapcore.EntryCaller{}
+	}
+
+	return e.Encoder.EncodeEntry(ent, out)
+}
+
+// ecsError is the error of an entry, along with its stack trace.
+type ecsError struct {
+	err   error
+	stack string
+}
+
+func (e ecsError) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if e.err != nil {
+		enc.AddString("message", e.err.Error())
+		enc.AddString("type", fmt.Sprintf("%T", e.err))
+	}
+	if e.stack != "" {
+		enc.AddString("stack_trace", e.stack)
+	}
+	return nil
+}
+
+// ecsOrigin is the location in the code an entry was logged from.
+type ecsOrigin zapcore.EntryCaller
+
+func (o ecsOrigin) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	err := enc.AddObject("file", ecsFile(o))
+	if fn := runtime.FuncForPC(o.PC); fn != nil {
+		enc.AddString("function", fn.Name())
+	}
+	return err
+}
+
+// ecsFile is the source file an entry was logged from.
+type ecsFile zapcore.EntryCaller
+
+func (f ecsFile) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("name", f.File)
+	enc.AddInt("line", f.Line)
+	return nil
+}
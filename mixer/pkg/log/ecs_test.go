@@ -0,0 +1,113 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestECS(t *testing.T) {
+	lines, err := captureStdout(func() {
+		o := NewOptions()
+		o.Encoding = ecsEncoding
+		o.IncludeCallerSourceLocation = true
+		if err := Configure(o); err != nil {
+			t.Errorf("Got err '%v', expecting success", err)
+		}
+
+		Warn("Hello", zap.String("trace", "abc"), zap.String("span", "123"), zap.Int("count", 3))
+		Sync()
+	})
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("Unable to decode '%s': %v", lines[0], err)
+	}
+
+	expected := map[string]interface{}{
+		"log.level":   "warn",
+		"message":     "Hello",
+		"ecs.version": ecsVersion,
+		"count":       float64(3),
+		ecsTraceKey:   "abc",
+		ecsSpanKey:    "123",
+	}
+	for k, v := range expected {
+		if entry[k] != v {
+			t.Errorf("Got %s=%v, expecting %v", k, entry[k], v)
+		}
+	}
+
+	if _, err := time.Parse(time.RFC3339Nano, entry["@timestamp"].(string)); err != nil {
+		t.Errorf("Got timestamp %v, expecting RFC 3339: %v", entry["@timestamp"], err)
+	}
+
+	if _, ok := entry["caller"]; ok {
+		t.Error("Got a caller field, expecting the origin only")
+	}
+
+	origin, ok := entry[ecsOriginKey].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Got %v, expecting an origin", entry)
+	}
+	file, _ := origin["file"].(map[string]interface{})
+	if !strings.HasSuffix(file["name"].(string), "ecs_test.go") || file["line"] == float64(0) ||
+		!strings.HasSuffix(origin["function"].(string), "TestECS.func1") {
+		t.Errorf("Got origin %v, expecting this test", origin)
+	}
+}
+
+func TestECSError(t *testing.T) {
+	enc := newECSEncoder(zapcore.DefaultLineEnding)
+	enc.AddString("trace", "abc")
+
+	buf, err := enc.EncodeEntry(zapcore.Entry{Level: zapcore.ErrorLevel, LoggerName: "adapters", Stack: "goroutine 1"}, []zapcore.Field{
+		zap.Error(errors.New("disk full")),
+		zap.String("other", "value"),
+	})
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Unable to decode '%s': %v", buf, err)
+	}
+
+	if entry[ecsTraceKey] != "abc" || entry["log.logger"] != "adapters" || entry["other"] != "value" {
+		t.Errorf("Got %v, expecting the trace, logger, and other fields", entry)
+	}
+
+	e, ok := entry[ecsErrorKey].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Got %v, expecting an error object", entry)
+	}
+	if e["message"] != "disk full" || e["type"] != "*errors.errorString" || e["stack_trace"] != "goroutine 1" {
+		t.Errorf("Got error %v, expecting the message, type, and stack trace", e)
+	}
+	if _, ok := entry["stacktrace"]; ok {
+		t.Errorf("Got %v, expecting the stack trace within the error only", entry)
+	}
+}
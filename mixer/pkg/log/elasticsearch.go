@@ -0,0 +1,282 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Elasticsearch output
+//
+// Entries are indexed into Elasticsearch using bulk requests when OutputPaths contains
+// elasticsearch://host[:port] or elasticsearch+https://host[:port], the port defaulting to 9200.
+// Entries are JSON-encoded, with their time under @timestamp. These query parameters are supported:
+//
+//		index     the index the entries are stored in, istio-{2006.01.02} by default. Text in braces
+//		          is a Go time layout, replaced by the UTC date of each entry
+//		type      the document type, required by Elasticsearch versions before 7 and omitted by default
+//		batch     the maximum number of entries indexed at once, 1000 by default
+//		flush     the maximum time an entry waits to be indexed, 1s by default
+//		buffer    the maximum number of entries held while Elasticsearch is unreachable, 10000 by default
+//		timeout   the timeout of each bulk request, 10s by default
+//
+// Credentials included in the URL are sent using basic authentication. Bulk requests rejected
+// with a 429 or 5xx status are retried with an increasing delay, as are the individual entries
+// rejected for the same reasons. Entries rejected for other reasons are dropped.
+
+const (
+	elasticsearchDefaultPort  = "9200"
+	elasticsearchDefaultIndex = "istio-{2006.01.02}"
+)
+
+var elasticsearchDefaultBatch = batchSettings{
+	size:     1000,
+	interval: time.Second,
+	buffer:   10000,
+	timeout:  10 * time.Second,
+}
+
+func init() {
+	RegisterSink("elasticsearch", newElasticsearchSink)
+	RegisterSink("elasticsearch+https", newElasticsearchSink)
+}
+
+// elasticsearchDoc is an entry waiting to be indexed, along with its bulk action.
+type elasticsearchDoc struct {
+	action []byte
+	source []byte
+}
+
+// elasticsearchCore outputs entries to Elasticsearch.
+type elasticsearchCore struct {
+	zapcore.LevelEnabler
+
+	enc     zapcore.Encoder
+	batcher *batcher
+	index   []indexPart
+	docType string
+}
+
+// indexPart is either literal text or, when layout is set, a time layout of an index name template.
+type indexPart struct {
+	text   string
+	layout bool
+}
+
+func newElasticsearchSink(u *url.URL, enab zapcore.LevelEnabler) (zapcore.Core, io.Closer, error) {
+	if u.Hostname() == "" {
+		return nil, nil, fmt.Errorf("missing elasticsearch address in %s", u)
+	}
+
+	q := u.Query()
+	settings, err := parseBatchSettings(q, elasticsearchDefaultBatch)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid elasticsearch settings in %s: %v", u, err)
+	}
+
+	index := q.Get("index")
+	if index == "" {
+		index = elasticsearchDefaultIndex
+	}
+
+	parts, err := parseIndexTemplate(index)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid elasticsearch index in %s: %v", u, err)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = elasticsearchDefaultPort
+	}
+
+	target := url.URL{Scheme: "http", Host: net.JoinHostPort(u.Hostname(), port), Path: "/_bulk"}
+	if u.Scheme == "elasticsearch+https" {
+		target.Scheme = "https"
+	}
+
+	header := http.Header{"Content-Type": []string{"application/x-ndjson"}}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + password))
+		header.Set("Authorization", "Basic "+auth)
+	}
+
+	client := newSinkHTTPClient(settings.timeout, false)
+	send := func(batch []interface{}) error {
+		var body bytes.Buffer
+		for _, d := range batch {
+			doc := d.(*elasticsearchDoc)
+			body.Write(doc.action)
+			body.Write(doc.source)
+		}
+
+		resp, err := postBatch(client, target.String(), body.Bytes(), false, header)
+		if err != nil {
+			return err
+		}
+		return elasticsearchBulkError(batch, resp)
+	}
+
+	cfg := sinkEncoder
+	cfg.TimeKey = "@timestamp"
+
+	b := newBatcher("elasticsearch at "+target.Host, settings, send)
+	return &elasticsearchCore{
+		LevelEnabler: enab,
+		enc:          newJSONEncoder(cfg),
+		batcher:      b,
+		index:        parts,
+		docType:      q.Get("type"),
+	}, b, nil
+}
+
+// parseIndexTemplate splits an index name template into literal text and time layouts.
+func parseIndexTemplate(template string) ([]indexPart, error) {
+	var parts []indexPart
+
+	for template != "" {
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			parts = append(parts, indexPart{text: template})
+			break
+		}
+
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated time layout in %s", template)
+		}
+
+		if start > 0 {
+			parts = append(parts, indexPart{text: template[:start]})
+		}
+		parts = append(parts, indexPart{text: template[start+1 : start+end], layout: true})
+		template = template[start+end+1:]
+	}
+
+	return parts, nil
+}
+
+// indexName returns the name of the index an entry logged at the given time is stored in.
+func (c *elasticsearchCore) indexName(t time.Time) string {
+	var b bytes.Buffer
+	for _, p := range c.index {
+		if p.layout {
+			b.WriteString(t.UTC().Format(p.text))
+		} else {
+			b.WriteString(p.text)
+		}
+	}
+	return b.String()
+}
+
+// elasticsearchBulkError reports the entries rejected in a bulk response, asking for those rejected
+// with a 429 or 5xx status to be retried.
+func elasticsearchBulkError(batch []interface{}, resp []byte) error {
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return fmt.Errorf("unable to parse bulk response: %v", err)
+	}
+
+	if !result.Errors {
+		return nil
+	}
+
+	var retry []interface{}
+	var rejected int
+	var reason json.RawMessage
+
+	for i, item := range result.Items {
+		for _, r := range item {
+			if r.Status < 300 || i >= len(batch) {
+				continue
+			}
+
+			if r.Status == http.StatusTooManyRequests || r.Status >= 500 {
+				retry = append(retry, batch[i])
+			} else {
+				rejected++
+			}
+
+			if reason == nil {
+				reason = r.Error
+			}
+		}
+	}
+
+	err := fmt.Errorf("%d entries rejected and %d to retry, first error: %s", rejected, len(retry), reason)
+	if len(retry) > 0 {
+		return retryableError{error: err, retry: retry}
+	}
+	return err
+}
+
+func (c *elasticsearchCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.enc = c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(clone.enc)
+	}
+	return &clone
+}
+
+func (c *elasticsearchCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *elasticsearchCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	source := append([]byte(nil), buf.Bytes()...)
+	buf.Free()
+
+	meta := map[string]string{"_index": c.indexName(ent.Time)}
+	if c.docType != "" {
+		meta["_type"] = c.docType
+	}
+
+	action, err := json.Marshal(map[string]interface{}{"index": meta})
+	if err != nil {
+		return err
+	}
+
+	return c.batcher.enqueue(&elasticsearchDoc{action: append(action, '\n'), source: source})
+}
+
+func (c *elasticsearchCore) Sync() error {
+	return c.batcher.sync()
+}
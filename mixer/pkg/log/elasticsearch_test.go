@@ -0,0 +1,222 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type bulkRequest struct {
+	r       *http.Request
+	actions []map[string]map[string]string
+	docs    []map[string]interface{}
+}
+
+// newFakeElasticsearch records the bulk requests it receives. The first requests get the given
+// per-item statuses, the others succeed.
+func newFakeElasticsearch(t *testing.T, statuses ...[]int) (*httptest.Server, chan bulkRequest) {
+	requests := make(chan bulkRequest, 100)
+	var count int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := bulkRequest{r: r}
+		for dec := json.NewDecoder(r.Body); dec.More(); {
+			var action map[string]map[string]string
+			var doc map[string]interface{}
+			if err := dec.Decode(&action); err != nil {
+				t.Errorf("Unable to decode action: %v", err)
+				return
+			}
+			if err := dec.Decode(&doc); err != nil {
+				t.Errorf("Unable to decode document: %v", err)
+				return
+			}
+			req.actions = append(req.actions, action)
+			req.docs = append(req.docs, doc)
+		}
+		requests <- req
+
+		var items []string
+		errors := false
+		n := int(atomic.AddInt32(&count, 1))
+		for i := range req.docs {
+			status := http.StatusCreated
+			if n <= len(statuses) {
+				status = statuses[n-1][i]
+			}
+			if status >= 300 {
+				errors = true
+				items = append(items, fmt.Sprintf(`{"index":{"status":%d,"error":{"type":"failure"}}}`, status))
+			} else {
+				items = append(items, fmt.Sprintf(`{"index":{"status":%d}}`, status))
+			}
+		}
+		_, _ = fmt.Fprintf(w, `{"took":1,"errors":%v,"items":[%s]}`, errors, strings.Join(items, ","))
+	}))
+
+	return server, requests
+}
+
+func nextBulkRequest(t *testing.T, requests chan bulkRequest) bulkRequest {
+	select {
+	case r := <-requests:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for bulk request")
+		return bulkRequest{}
+	}
+}
+
+func TestElasticsearch(t *testing.T) {
+	server, requests := newFakeElasticsearch(t)
+	defer server.Close()
+
+	u := strings.Replace(server.URL, "http://", "elasticsearch://user:secret@", 1) + "?index=logs-{2006.01}&type=entry"
+
+	o := NewOptions()
+	o.OutputPaths = []string{u}
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	With(zap.String("pod", "mixer-1")).Info("Hello", zap.Int("count", 3))
+	Sync()
+
+	r := nextBulkRequest(t, requests)
+
+	if r.r.URL.Path != "/_bulk" {
+		t.Errorf("Got path %s, expecting /_bulk", r.r.URL.Path)
+	}
+
+	if user, password, ok := r.r.BasicAuth(); !ok || user != "user" || password != "secret" {
+		t.Errorf("Got credentials %s:%s, expecting user:secret", user, password)
+	}
+
+	if len(r.docs) != 1 {
+		t.Fatalf("Got %d documents, expecting 1", len(r.docs))
+	}
+
+	expected := map[string]string{"_index": "logs-" + time.Now().UTC().Format("2006.01"), "_type": "entry"}
+	if !reflect.DeepEqual(r.actions[0]["index"], expected) {
+		t.Errorf("Got action %v, expecting %v", r.actions[0], expected)
+	}
+
+	doc := r.docs[0]
+	if doc["msg"] != "Hello" || doc["count"] != float64(3) || doc["pod"] != "mixer-1" || doc["@timestamp"] == nil {
+		t.Errorf("Got document %v, expecting the encoded entry", doc)
+	}
+}
+
+func TestElasticsearchRetry(t *testing.T) {
+	server, requests := newFakeElasticsearch(t, []int{201, 429, 400})
+	defer server.Close()
+
+	u := strings.Replace(server.URL, "http://", "elasticsearch://", 1)
+	core, closer, err := newElasticsearchSink(mustParseURL(t, u), zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = closer.Close() }()
+
+	for _, msg := range []string{"indexed", "throttled", "rejected"} {
+		ent := zapcore.Entry{Message: msg, Time: time.Date(2017, 10, 16, 23, 0, 0, 0, time.FixedZone("", -3600))}
+		if err := core.Write(ent, nil); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+	}
+
+	if err := core.Sync(); err != nil {
+		t.Errorf("Got err '%v', expecting success", err)
+	}
+
+	if r := nextBulkRequest(t, requests); len(r.docs) != 3 {
+		t.Fatalf("Got %d documents, expecting 3", len(r.docs))
+	}
+
+	r := nextBulkRequest(t, requests)
+	if len(r.docs) != 1 || r.docs[0]["msg"] != "throttled" {
+		t.Fatalf("Got %v, expecting only the throttled entry to be retried", r.docs)
+	}
+
+	if index := r.actions[0]["index"]["_index"]; index != "istio-2017.10.17" {
+		t.Errorf("Got index %s, expecting istio-2017.10.17", index)
+	}
+}
+
+func TestElasticsearchBulkError(t *testing.T) {
+	batch := []interface{}{"a", "b"}
+
+	if err := elasticsearchBulkError(batch, []byte(`{"errors":false,"items":[]}`)); err != nil {
+		t.Errorf("Got err '%v', expecting success", err)
+	}
+
+	err := elasticsearchBulkError(batch, []byte(`{"errors":true,"items":[{"index":{"status":400}},{"index":{"status":201}}]}`))
+	if _, ok := err.(retryableError); err == nil || ok {
+		t.Errorf("Got err '%v', expecting a permanent error", err)
+	}
+
+	if err := elasticsearchBulkError(batch, []byte(`not json`)); err == nil {
+		t.Error("Got success, expecting error")
+	}
+}
+
+func TestParseIndexTemplate(t *testing.T) {
+	cases := []struct {
+		template string
+		expected []indexPart
+	}{
+		{"logs", []indexPart{{text: "logs"}}},
+		{"istio-{2006.01.02}", []indexPart{{text: "istio-"}, {text: "2006.01.02", layout: true}}},
+		{"{2006}-logs", []indexPart{{text: "2006", layout: true}, {text: "-logs"}}},
+	}
+
+	for _, c := range cases {
+		parts, err := parseIndexTemplate(c.template)
+		if err != nil || !reflect.DeepEqual(parts, c.expected) {
+			t.Errorf("Got %v, %v for %s, expecting %v", parts, err, c.template, c.expected)
+		}
+	}
+
+	if _, err := parseIndexTemplate("istio-{2006"); err == nil {
+		t.Error("Got success, expecting error")
+	}
+}
+
+func TestElasticsearchErrors(t *testing.T) {
+	cases := []string{
+		"elasticsearch://",
+		"elasticsearch://localhost?index=istio-{2006",
+		"elasticsearch://localhost?buffer=0",
+	}
+
+	for _, c := range cases {
+		t.Run(c, func(t *testing.T) {
+			if _, _, err := newElasticsearchSink(mustParseURL(t, c), zapcore.InfoLevel); err == nil {
+				t.Error("Got success, expecting error")
+			}
+		})
+	}
+}
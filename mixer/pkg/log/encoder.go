@@ -0,0 +1,220 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Settings of Options.TimeFormat. Any other value is a layout for time.Format.
+const (
+	timeISO8601     = "iso8601"
+	timeRFC3339Nano = "rfc3339nano"
+	timeEpochMillis = "epoch-millis"
+)
+
+// Settings of Options.DurationEncoding.
+const (
+	durationString  = "string"
+	durationSeconds = "seconds"
+	durationMillis  = "millis"
+	durationNanos   = "nanos"
+)
+
+// Settings of Options.LineEnding.
+const (
+	lineEndingLF   = "lf"
+	lineEndingCRLF = "crlf"
+	lineEndingNUL  = "nul"
+	lineEndingRS   = "rs"
+)
+
+// lineEndings are the characters ending the entries for each setting of Options.LineEnding.
+var lineEndings = map[string]string{
+	lineEndingLF:   zapcore.DefaultLineEnding,
+	lineEndingCRLF: "\r\n",
+	lineEndingNUL:  "\x00",
+	lineEndingRS:   "\x1e",
+}
+
+// Settings of Options.CallerEncoding.
+const (
+	callerFull    = "full"
+	callerShort   = "short"
+	callerTrimmed = "trimmed"
+)
+
+// The import path of the repository, which trimmed callers leave out.
+const repositoryPath = "istio.io/istio/"
+
+// encoders are the constructors of the encodings known to zap, for the outputs the package builds
+// itself.
+var encoders = map[string]func(zapcore.EncoderConfig) (zapcore.Encoder, error){
+	"console": func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) { return zapcore.NewConsoleEncoder(cfg), nil },
+	"json":    func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) { return zapcore.NewJSONEncoder(cfg), nil },
+}
+
+// registerEncoder makes the encoding with the given name available to zap and to the outputs the
+// package builds itself.
+func registerEncoder(name string, f func(zapcore.EncoderConfig) (zapcore.Encoder, error)) {
+	encoders[name] = f
+	_ = zap.RegisterEncoder(name, f)
+}
+
+// newEncoder builds an encoder of the encoding with the given name.
+func newEncoder(name string, cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+	f, ok := encoders[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown encoding: %s", name)
+	}
+	return f(cfg)
+}
+
+// encoderKeys are the names of the keys Options.EncoderKeys can rename, with the fields of the
+// encoder settings holding them.
+var encoderKeys = map[string]func(*zapcore.EncoderConfig) *string{
+	"time":   func(c *zapcore.EncoderConfig) *string { return &c.TimeKey },
+	"level":  func(c *zapcore.EncoderConfig) *string { return &c.LevelKey },
+	"logger": func(c *zapcore.EncoderConfig) *string { return &c.NameKey },
+	"caller": func(c *zapcore.EncoderConfig) *string { return &c.CallerKey },
+	"msg":    func(c *zapcore.EncoderConfig) *string { return &c.MessageKey },
+	"stack":  func(c *zapcore.EncoderConfig) *string { return &c.StacktraceKey },
+}
+
+// The encoder settings of the outputs opened by the last call to Configure, which the sinks encode
+// their entries with.
+var sinkEncoder = newEncoderConfig()
+
+// newOutputEncoderConfig produces the encoder settings described by the options.
+func newOutputEncoderConfig(o *Options) (zapcore.EncoderConfig, error) {
+	cfg := newEncoderConfig()
+	cfg.EncodeTime = timeEncoder(o.TimeFormat, o.UTC)
+
+	switch o.DurationEncoding {
+	case "", durationString:
+		cfg.EncodeDuration = zapcore.StringDurationEncoder
+	case durationSeconds:
+		cfg.EncodeDuration = zapcore.SecondsDurationEncoder
+	case durationMillis:
+		cfg.EncodeDuration = millisDurationEncoder
+	case durationNanos:
+		cfg.EncodeDuration = zapcore.NanosDurationEncoder
+	default:
+		return cfg, fmt.Errorf("unknown duration encoding: %s", o.DurationEncoding)
+	}
+
+	switch o.CallerEncoding {
+	case "", callerShort:
+		cfg.EncodeCaller = zapcore.ShortCallerEncoder
+	case callerFull:
+		cfg.EncodeCaller = zapcore.FullCallerEncoder
+	case callerTrimmed:
+		cfg.EncodeCaller = trimmedCallerEncoder
+	default:
+		return cfg, fmt.Errorf("unknown caller encoding: %s", o.CallerEncoding)
+	}
+
+	if o.LineEnding != "" {
+		ending, ok := lineEndings[o.LineEnding]
+		if !ok {
+			return cfg, fmt.Errorf("unknown line ending: %s", o.LineEnding)
+		}
+		cfg.LineEnding = ending
+	}
+
+	// the names of the keys of the schema come first, for the options to rename them further
+	keys := o.EncoderKeys
+	if schema := logSchemas[o.LogSchema]; len(schema.keys) > 0 {
+		keys = append(append([]string(nil), schema.keys...), o.EncoderKeys...)
+	}
+
+	for _, k := range keys {
+		eq := strings.Index(k, "=")
+		if eq < 0 {
+			return cfg, fmt.Errorf("invalid encoder key '%s', expecting <key>=<name>", k)
+		}
+
+		key, ok := encoderKeys[k[:eq]]
+		if !ok {
+			return cfg, fmt.Errorf("unknown encoder key '%s', expecting one of time, level, logger, caller, msg, or stack", k[:eq])
+		}
+		*key(&cfg) = k[eq+1:]
+	}
+
+	return cfg, nil
+}
+
+// trimmedCallerEncoder encodes callers as their import path within the repository, such as
+// mixer/pkg/log/log.go:42, or within the vendor directory or GOPATH for the code of other
+// repositories.
+func trimmedCallerEncoder(caller zapcore.EntryCaller, enc zapcore.PrimitiveArrayEncoder) {
+	if !caller.Defined {
+		enc.AppendString("undefined")
+		return
+	}
+	enc.AppendString(trimCallerPath(caller.File) + ":" + strconv.Itoa(caller.Line))
+}
+
+// trimCallerPath returns the given source file path without the directories leading to the import
+// path of its package, or the whole path when it isn't found.
+func trimCallerPath(file string) string {
+	for _, marker := range []string{"/vendor/", "/" + repositoryPath, "/src/"} {
+		if i := strings.LastIndex(file, marker); i >= 0 {
+			return file[i+len(marker):]
+		}
+	}
+	return file
+}
+
+// timeEncoder returns the encoder of the timestamps in the given format, converted to UTC if asked
+// to.
+func timeEncoder(format string, utc bool) zapcore.TimeEncoder {
+	var enc zapcore.TimeEncoder
+	switch format {
+	case "", timeISO8601:
+		enc = zapcore.ISO8601TimeEncoder
+	case timeEpochMillis:
+		enc = zapcore.EpochMillisTimeEncoder
+	case timeRFC3339Nano:
+		enc = layoutTimeEncoder(time.RFC3339Nano)
+	default:
+		enc = layoutTimeEncoder(format)
+	}
+
+	if !utc {
+		return enc
+	}
+	return func(t time.Time, pae zapcore.PrimitiveArrayEncoder) {
+		enc(t.UTC(), pae)
+	}
+}
+
+// layoutTimeEncoder returns an encoder formatting timestamps with the given layout.
+func layoutTimeEncoder(layout string) zapcore.TimeEncoder {
+	return func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
+		enc.AppendString(t.Format(layout))
+	}
+}
+
+// millisDurationEncoder encodes durations as floating-point milliseconds.
+func millisDurationEncoder(d time.Duration, enc zapcore.PrimitiveArrayEncoder) {
+	enc.AppendFloat64(float64(d) / float64(time.Millisecond))
+}
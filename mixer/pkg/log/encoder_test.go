@@ -0,0 +1,270 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// encodeEntry encodes an entry with the encoder settings described by the options.
+func encodeEntry(t *testing.T, o *Options, ent zapcore.Entry, fields ...zapcore.Field) string {
+	cfg, err := newOutputEncoderConfig(o)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	buf, err := zapcore.NewJSONEncoder(cfg).EncodeEntry(ent, fields)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+func TestTimeFormat(t *testing.T) {
+	ts := time.Date(2017, 9, 1, 10, 0, 0, 123456789, time.FixedZone("", 2*3600))
+
+	cases := []struct {
+		format   string
+		utc      bool
+		expected string
+	}{
+		{"", false, `"2017-09-01T10:00:00.123+0200"`},
+		{"iso8601", false, `"2017-09-01T10:00:00.123+0200"`},
+		{"iso8601", true, `"2017-09-01T08:00:00.123Z"`},
+		{"rfc3339nano", false, `"2017-09-01T10:00:00.123456789+02:00"`},
+		{"rfc3339nano", true, `"2017-09-01T08:00:00.123456789Z"`},
+		{"epoch-millis", false, `1504252800123.4568`},
+		{"Jan 2 15:04:05", true, `"Sep 1 08:00:00"`},
+	}
+
+	for _, c := range cases {
+		o := NewOptions()
+		o.TimeFormat = c.format
+		o.UTC = c.utc
+
+		expected := `{"level":"info","time":` + c.expected + `,"msg":"Hello"}`
+		if got := encodeEntry(t, o, zapcore.Entry{Level: zapcore.InfoLevel, Time: ts, Message: "Hello"}); got != expected {
+			t.Errorf("Got '%s', expecting '%s' for %+v", got, expected, c)
+		}
+	}
+}
+
+func TestConfigureTimeFormat(t *testing.T) {
+	lines, err := captureStdout(func() {
+		o := NewOptions()
+		o.AuditOutputPaths = nil
+		o.JSONEncoding = true
+		o.TimeFormat = "rfc3339nano"
+		o.UTC = true
+		if err := Configure(o); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		Info("Hello")
+		Sync()
+	})
+	configureWithoutOutput(t)
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	pat := `^{"level":"info","time":"\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(\.\d+)?Z","msg":"Hello","log_schema":2}$`
+	if match, _ := regexp.MatchString(pat, lines[0]); !match {
+		t.Errorf("Got '%s', expecting to match '%s'", lines[0], pat)
+	}
+}
+
+func TestDurationEncoding(t *testing.T) {
+	cases := []struct {
+		encoding string
+		expected string
+	}{
+		{"", `"1.5ms"`},
+		{"string", `"1.5ms"`},
+		{"seconds", `0.0015`},
+		{"millis", `1.5`},
+		{"nanos", `1500000`},
+	}
+
+	for _, c := range cases {
+		o := NewOptions()
+		o.DurationEncoding = c.encoding
+
+		expected := `"msg":"Hello","latency":` + c.expected + `}`
+		if got := encodeEntry(t, o, zapcore.Entry{Message: "Hello"}, Duration("latency", 1500*time.Microsecond)); !strings.HasSuffix(got, expected) {
+			t.Errorf("Got '%s', expecting '%s' for %s", got, expected, c.encoding)
+		}
+	}
+
+	o := NewOptions()
+	o.DurationEncoding = "hours"
+	if _, err := newOutputEncoderConfig(o); err == nil {
+		t.Error("Got success, expecting error")
+	}
+	if err := Configure(o); err == nil {
+		t.Error("Got success, expecting error")
+	}
+}
+
+func TestCallerEncoding(t *testing.T) {
+	file := "/go/src/istio.io/istio/mixer/pkg/log/log.go"
+	cases := []struct {
+		encoding string
+		expected string
+	}{
+		{"", `"log/log.go:42"`},
+		{"short", `"log/log.go:42"`},
+		{"full", `"/go/src/istio.io/istio/mixer/pkg/log/log.go:42"`},
+		{"trimmed", `"mixer/pkg/log/log.go:42"`},
+	}
+
+	for _, c := range cases {
+		o := NewOptions()
+		o.CallerEncoding = c.encoding
+
+		ent := zapcore.Entry{Message: "Hello", Caller: zapcore.NewEntryCaller(0, file, 42, true)}
+		expected := `"caller":` + c.expected + `,"msg":"Hello"}`
+		if got := encodeEntry(t, o, ent); !strings.HasSuffix(got, expected) {
+			t.Errorf("Got '%s', expecting '%s' for %s", got, expected, c.encoding)
+		}
+	}
+
+	o := NewOptions()
+	o.CallerEncoding = "long"
+	if _, err := newOutputEncoderConfig(o); err == nil {
+		t.Error("Got success, expecting error")
+	}
+}
+
+func TestTrimCallerPath(t *testing.T) {
+	cases := []struct {
+		file     string
+		expected string
+	}{
+		{"/go/src/istio.io/istio/mixer/pkg/log/log.go", "mixer/pkg/log/log.go"},
+		{"/go/src/istio.io/istio/vendor/go.uber.org/zap/logger.go", "go.uber.org/zap/logger.go"},
+		{"/go/src/github.com/golang/glog/glog.go", "github.com/golang/glog/glog.go"},
+		{"/build/main.go", "/build/main.go"},
+	}
+
+	for _, c := range cases {
+		if got := trimCallerPath(c.file); got != c.expected {
+			t.Errorf("Got %s, expecting %s for %s", got, c.expected, c.file)
+		}
+	}
+}
+
+func TestLineEnding(t *testing.T) {
+	cases := []struct {
+		ending   string
+		expected string
+	}{
+		{"", "\n"},
+		{"lf", "\n"},
+		{"crlf", "\r\n"},
+		{"nul", "\x00"},
+		{"rs", "\x1e"},
+	}
+
+	for _, c := range cases {
+		cfg, err := newOutputEncoderConfig(&Options{LineEnding: c.ending})
+		if err != nil {
+			t.Fatalf("Got err '%v', expecting success for %s", err, c.ending)
+		}
+
+		buf, _ := zapcore.NewConsoleEncoder(cfg).EncodeEntry(zapcore.Entry{Message: "Hello"}, nil)
+		if got := buf.String(); !strings.HasSuffix(got, "Hello"+c.expected) {
+			t.Errorf("Got %q, expecting the entry to end with %q for %s", got, c.expected, c.ending)
+		}
+	}
+
+	if _, err := newOutputEncoderConfig(&Options{LineEnding: "cr"}); err == nil {
+		t.Error("Got success, expecting error")
+	}
+}
+
+func TestConfigureLineEnding(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "mixer.log")
+
+	o := NewOptions()
+	o.OutputPaths = []string{path}
+	o.AuditOutputPaths = nil
+	o.LineEnding = "nul"
+	o.RecentEntries = 10
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer configureWithoutOutput(t)
+
+	Info("Hello\nworld")
+	Warn("Goodbye")
+	Sync()
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	records := strings.Split(string(b), "\x00")
+	if len(records) != 3 || !strings.Contains(records[0], "Hello") || !strings.Contains(records[1], "Goodbye") || records[2] != "" {
+		t.Errorf("Got %q, expecting two records ended by NUL", b)
+	}
+
+	// the sinks and the recent entries keep to their own framing
+	if sinkEncoder.LineEnding != zapcore.DefaultLineEnding {
+		t.Errorf("Got %q, expecting the sinks to end entries with newlines", sinkEncoder.LineEnding)
+	}
+	for _, e := range RecentEntries() {
+		if strings.ContainsRune(e, 0) {
+			t.Errorf("Got %q, expecting the recent entry without the line ending", e)
+		}
+	}
+}
+
+func TestEncoderKeys(t *testing.T) {
+	o := NewOptions()
+	o.EncoderKeys = []string{"time=@timestamp", "level=log.level", "logger=log.logger", "msg=message", "caller="}
+
+	ent := zapcore.Entry{
+		Level:      zapcore.WarnLevel,
+		Time:       time.Date(2017, 9, 1, 10, 0, 0, 0, time.UTC),
+		LoggerName: "adapters",
+		Message:    "Hello",
+		Caller:     zapcore.NewEntryCaller(0, "log/log.go", 10, true),
+	}
+	expected := `{"log.level":"warn","@timestamp":"2017-09-01T10:00:00.000Z","log.logger":"adapters","message":"Hello"}`
+	if got := encodeEntry(t, o, ent); got != expected {
+		t.Errorf("Got '%s', expecting '%s'", got, expected)
+	}
+
+	for _, keys := range [][]string{{"time"}, {"timestamp=ts"}} {
+		o.EncoderKeys = keys
+		if _, err := newOutputEncoderConfig(o); err == nil {
+			t.Errorf("Got success, expecting error for %v", keys)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// errorSink is where the errors of the log itself are output, such as failures to encode entries
+// or to reach the sinks, which can't go through the log.
+type errorSink struct {
+	zapcore.WriteSyncer
+}
+
+var currentErrorOutput atomic.Value // errorSink
+
+func init() {
+	currentErrorOutput.Store(errorSink{zapcore.Lock(os.Stderr)})
+}
+
+// openErrorOutput opens the given error output paths, which default to stderr.
+func openErrorOutput(paths []string) (zapcore.WriteSyncer, func(), error) {
+	if len(paths) == 0 {
+		paths = []string{"stderr"}
+	}
+
+	ws, closer, err := zap.Open(paths...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to open the error output: %v", err)
+	}
+	return ws, closer, nil
+}
+
+// errorOutput returns the error output opened by the last call to Configure.
+func errorOutput() zapcore.WriteSyncer {
+	return currentErrorOutput.Load().(errorSink)
+}
+
+// reportError outputs an error of the log itself, prefixed with the current time.
+func reportError(format string, args ...interface{}) {
+	fmt.Fprintf(errorOutput(), "%v "+format+"\n", append([]interface{}{time.Now()}, args...)...)
+}
@@ -0,0 +1,92 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// failingCore fails to write any entry.
+type failingCore struct {
+	zapcore.LevelEnabler
+}
+
+func (c *failingCore) With([]zapcore.Field) zapcore.Core {
+	return c
+}
+
+func (c *failingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *failingCore) Write(zapcore.Entry, []zapcore.Field) error {
+	return errors.New("disk full")
+}
+
+func (c *failingCore) Sync() error {
+	return nil
+}
+
+func TestErrorOutputPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "errors.log")
+
+	defer AddCore(&failingCore{zapcore.DebugLevel})()
+
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.ErrorOutputPaths = []string{path}
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	// errors of the log and of the sinks go to the error output
+	Info("Hello")
+	reportError("unable to send log entries to %s: %v", "test", "unavailable")
+
+	// which is closed once the log is configured again
+	configureWithoutOutput(t)
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "write error: disk full") ||
+		!strings.HasSuffix(lines[1], " unable to send log entries to test: unavailable") {
+		t.Errorf("Got '%v', expecting the write error and the sink error", lines)
+	}
+
+	o.ErrorOutputPaths = []string{filepath.Join(dir, "missing", "errors.log")}
+	if err := Configure(o); err == nil || !strings.Contains(err.Error(), o.ErrorOutputPaths[0]) {
+		t.Errorf("Got '%v', expecting an error naming the error output", err)
+	}
+}
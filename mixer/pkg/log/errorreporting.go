@@ -0,0 +1,257 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"istio.io/istio/mixer/pkg/version"
+)
+
+// Stackdriver Error Reporting exporter
+//
+// An ErrorReportingExporter reports the entries handed to its Hook to Stackdriver Error Reporting,
+// which groups them by stack trace. It is registered with RegisterErrorHook:
+//
+//		e, err := log.NewErrorReportingExporter("", "mixer")
+//		if err != nil {
+//			// print an error and quit
+//		}
+//		defer e.Close()
+//		defer log.RegisterErrorHook(e.Hook)()
+//
+// Requests are authorized with the token of the default service account of the instance, as
+// handed out by the metadata server of GCE and GKE. Events are sent from a background goroutine,
+// except for those of the entries above the error level, which are waited for since the process
+// may be about to exit.
+
+const (
+	errorReportingURL = "https://clouderrorreporting.googleapis.com/v1beta1/projects/%s/events:report"
+	metadataTokenURL  = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+var errorReportingDefaultBatch = batchSettings{
+	size:     100,
+	interval: 100 * time.Millisecond,
+	buffer:   1000,
+	timeout:  10 * time.Second,
+}
+
+// ErrorReportingExporter reports error entries to Stackdriver Error Reporting.
+type ErrorReportingExporter struct {
+	client   *http.Client
+	url      string
+	tokenURL string
+	service  string
+	version  string
+	batcher  *batcher
+
+	// the access token and its expiry, only used by the goroutine of the batcher
+	token       string
+	tokenExpiry time.Time
+}
+
+// errorReportingEvent is an event as accepted by the events.report method of Error Reporting.
+type errorReportingEvent struct {
+	EventTime      string                 `json:"eventTime"`
+	ServiceContext errorReportingService  `json:"serviceContext"`
+	Message        string                 `json:"message"`
+	Context        *errorReportingContext `json:"context,omitempty"`
+}
+
+type errorReportingService struct {
+	Service string `json:"service"`
+	Version string `json:"version,omitempty"`
+}
+
+type errorReportingContext struct {
+	ReportLocation errorReportingLocation `json:"reportLocation"`
+}
+
+type errorReportingLocation struct {
+	FilePath     string `json:"filePath"`
+	LineNumber   int    `json:"lineNumber"`
+	FunctionName string `json:"functionName,omitempty"`
+}
+
+// metadataToken is an access token as handed out by the metadata server.
+type metadataToken struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// NewErrorReportingExporter returns an exporter reporting errors to the given Google Cloud project,
+// or to the project in $GOOGLE_CLOUD_PROJECT when empty, as those of the given service.
+func NewErrorReportingExporter(project string, service string) (*ErrorReportingExporter, error) {
+	if project == "" {
+		project = os.Getenv("GOOGLE_CLOUD_PROJECT")
+	}
+	if project == "" {
+		return nil, errors.New("missing Google Cloud project for Error Reporting")
+	}
+	if service == "" {
+		return nil, errors.New("missing service name for Error Reporting")
+	}
+
+	e := &ErrorReportingExporter{
+		client:   newSinkHTTPClient(errorReportingDefaultBatch.timeout, false),
+		url:      fmt.Sprintf(errorReportingURL, url.PathEscape(project)),
+		tokenURL: metadataTokenURL,
+		service:  service,
+		version:  version.Info.Version,
+	}
+	e.batcher = newBatcher("Error Reporting", errorReportingDefaultBatch, e.send)
+
+	return e, nil
+}
+
+// Hook reports the given entry to Error Reporting. It is meant to be registered with
+// RegisterErrorHook.
+func (e *ErrorReportingExporter) Hook(entry zapcore.Entry, fields []zapcore.Field) {
+	body, err := json.Marshal(e.event(entry, fields))
+	if err == nil {
+		err = e.batcher.enqueue(body)
+	}
+	e.batcher.report(err)
+
+	if entry.Level > zapcore.ErrorLevel {
+		e.batcher.report(e.batcher.sync())
+	}
+}
+
+// Close sends the events still buffered, and stops the exporter.
+func (e *ErrorReportingExporter) Close() error {
+	return e.batcher.Close()
+}
+
+// event builds the event of an entry. Error Reporting takes no fields, so they are appended to the
+// message, which is followed by the stack trace in the format of the Go runtime for it to be parsed.
+func (e *ErrorReportingExporter) event(ent zapcore.Entry, fields []zapcore.Field) *errorReportingEvent {
+	var msg bytes.Buffer
+	if ent.LoggerName != "" {
+		msg.WriteString(ent.LoggerName + ": ")
+	}
+	msg.WriteString(ent.Message)
+
+	if len(fields) > 0 {
+		enc := zapcore.NewMapObjectEncoder()
+		for _, f := range fields {
+			f.AddTo(enc)
+		}
+		if b, err := json.Marshal(enc.Fields); err == nil {
+			msg.WriteString(" ")
+			msg.Write(b)
+		}
+	}
+
+	frames := parseStack(ent.Stack)
+	if len(frames) > 0 {
+		msg.WriteString("\n\ngoroutine 1 [running]:\n")
+		for _, f := range frames {
+			fmt.Fprintf(&msg, "%s(...)\n\t%s:%d\n", f.function, f.file, f.line)
+		}
+	}
+
+	ev := &errorReportingEvent{
+		EventTime:      ent.Time.UTC().Format(time.RFC3339Nano),
+		ServiceContext: errorReportingService{Service: e.service, Version: e.version},
+		Message:        msg.String(),
+	}
+
+	// the location is the innermost call of the stack, or else the call to the logger
+	if len(frames) > 0 {
+		ev.Context = &errorReportingContext{ReportLocation: errorReportingLocation{
+			FilePath:     frames[0].file,
+			LineNumber:   frames[0].line,
+			FunctionName: frames[0].function,
+		}}
+	} else if ent.Caller.Defined {
+		ev.Context = &errorReportingContext{ReportLocation: errorReportingLocation{
+			FilePath:   ent.Caller.File,
+			LineNumber: ent.Caller.Line,
+		}}
+	}
+
+	return ev
+}
+
+// send reports each event of the batch, retrying the events from the first one failing with a
+// retryable error.
+func (e *ErrorReportingExporter) send(batch []interface{}) error {
+	token, err := e.accessToken()
+	if err != nil {
+		return retryableError{error: err}
+	}
+
+	header := http.Header{
+		"Content-Type":  []string{"application/json"},
+		"Authorization": []string{"Bearer " + token},
+	}
+
+	for i, body := range batch {
+		_, perr := postBatch(e.client, e.url, body.([]byte), false, header)
+		if r, ok := perr.(retryableError); ok {
+			r.retry = batch[i:]
+			return r
+		}
+		if perr != nil && err == nil {
+			err = perr
+		}
+	}
+	return err
+}
+
+// accessToken returns the access token of the default service account, fetching a new one from the
+// metadata server once the last one is about to expire.
+func (e *ErrorReportingExporter) accessToken() (string, error) {
+	if e.token != "" && time.Now().Before(e.tokenExpiry) {
+		return e.token, nil
+	}
+
+	req, err := http.NewRequest("GET", e.tokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unable to get an access token from the metadata server: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to get an access token from the metadata server: %s", resp.Status)
+	}
+
+	var t metadataToken
+	if err = json.NewDecoder(resp.Body).Decode(&t); err != nil || t.AccessToken == "" {
+		return "", fmt.Errorf("invalid access token from the metadata server: %v", err)
+	}
+
+	// renew the token a minute ahead of its expiry
+	e.token = t.AccessToken
+	e.tokenExpiry = time.Now().Add(time.Duration(t.ExpiresIn)*time.Second - time.Minute)
+	return e.token, nil
+}
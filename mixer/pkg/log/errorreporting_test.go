@@ -0,0 +1,166 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type errorReportingRequest struct {
+	r     *http.Request
+	event errorReportingEvent
+}
+
+// newFakeErrorReporting records the events it receives, and hands out tokens like the metadata
+// server, counting them.
+func newFakeErrorReporting(t *testing.T) (*httptest.Server, chan errorReportingRequest, *int32) {
+	requests := make(chan errorReportingRequest, 100)
+	var tokens int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if r.Header.Get("Metadata-Flavor") != "Google" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			atomic.AddInt32(&tokens, 1)
+			_, _ = w.Write([]byte(`{"access_token":"secret","expires_in":3600,"token_type":"Bearer"}`))
+			return
+		}
+
+		var ev errorReportingEvent
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Errorf("Unable to decode event: %v", err)
+		}
+
+		requests <- errorReportingRequest{r: r, event: ev}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	return server, requests, &tokens
+}
+
+func newTestErrorReportingExporter(t *testing.T, server *httptest.Server) *ErrorReportingExporter {
+	e, err := NewErrorReportingExporter("my-project", "mixer")
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	e.url = server.URL + "/report"
+	e.tokenURL = server.URL + "/token"
+	return e
+}
+
+func TestErrorReportingExporter(t *testing.T) {
+	server, requests, tokens := newFakeErrorReporting(t)
+	defer server.Close()
+
+	e := newTestErrorReportingExporter(t, server)
+	defer e.Close()
+
+	configureWithoutOutput(t)
+	defer RegisterErrorHook(e.Hook)()
+
+	Named("dispatcher").Error("Unable to dispatch", zap.String("adapter", "a"))
+	Error("Unable to dispatch again")
+
+	for i := 0; i < 2; i++ {
+		var req errorReportingRequest
+		select {
+		case req = <-requests:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the event")
+		}
+
+		if auth := req.r.Header.Get("Authorization"); auth != "Bearer secret" {
+			t.Errorf("Got authorization '%s', expecting the token of the metadata server", auth)
+		}
+
+		ev := req.event
+		if ev.ServiceContext.Service != "mixer" {
+			t.Errorf("Got service %+v, expecting mixer", ev.ServiceContext)
+		}
+
+		// the frames of this package, the tests included, are left out
+		if ev.Context == nil || ev.Context.ReportLocation.FunctionName != "testing.tRunner" {
+			t.Errorf("Got context %+v, expecting the location of the innermost call outside the package", ev.Context)
+		}
+		if !strings.Contains(ev.Message, "\n\ngoroutine 1 [running]:\ntesting.tRunner(...)\n\t") {
+			t.Errorf("Got message '%s', expecting the stack trace in the format of the runtime", ev.Message)
+		}
+
+		if i == 0 && !strings.HasPrefix(ev.Message, `dispatcher: Unable to dispatch {"adapter":"a"}`) {
+			t.Errorf("Got message '%s', expecting the scope, message, and fields of the entry", ev.Message)
+		}
+	}
+
+	if n := atomic.LoadInt32(tokens); n != 1 {
+		t.Errorf("Got %d tokens fetched, expecting the token to be reused", n)
+	}
+}
+
+func TestErrorReportingExporterWaitsForFatalEntries(t *testing.T) {
+	server, requests, _ := newFakeErrorReporting(t)
+	defer server.Close()
+
+	e := newTestErrorReportingExporter(t, server)
+	defer e.Close()
+
+	configureWithoutOutput(t)
+	defer RegisterErrorHook(e.Hook)()
+
+	Logger().DPanic("Inconsistent state")
+
+	select {
+	case req := <-requests:
+		if !strings.HasPrefix(req.event.Message, "Inconsistent state") {
+			t.Errorf("Got message '%s', expecting the entry", req.event.Message)
+		}
+	default:
+		t.Error("Got no event, expecting it sent before the entry returned")
+	}
+}
+
+func TestNewErrorReportingExporterErrors(t *testing.T) {
+	project := os.Getenv("GOOGLE_CLOUD_PROJECT")
+	defer func() { _ = os.Setenv("GOOGLE_CLOUD_PROJECT", project) }()
+	_ = os.Unsetenv("GOOGLE_CLOUD_PROJECT")
+
+	if _, err := NewErrorReportingExporter("", "mixer"); err == nil {
+		t.Error("Got success, expecting an error without a project")
+	}
+	if _, err := NewErrorReportingExporter("my-project", ""); err == nil {
+		t.Error("Got success, expecting an error without a service")
+	}
+
+	_ = os.Setenv("GOOGLE_CLOUD_PROJECT", "my-project")
+	e, err := NewErrorReportingExporter("", "mixer")
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting the project of the environment", err)
+	}
+	defer e.Close()
+
+	if !strings.Contains(e.url, "/projects/my-project/events:report") {
+		t.Errorf("Got URL %s, expecting the project of the environment", e.url)
+	}
+}
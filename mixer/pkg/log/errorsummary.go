@@ -0,0 +1,146 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// the number of distinct messages tallied per interval, beyond which entries only add to the
+	// totals, so that messages embedding variable data can't exhaust memory
+	errorSummaryMaxMessages = 1000
+
+	// the number of messages listed in a summary
+	errorSummaryTop = 3
+)
+
+type errorSummaryKey struct {
+	scope   string
+	message string
+}
+
+// errorTally counts the warnings and errors logged, by scope and message.
+type errorTally struct {
+	mu       sync.Mutex
+	errors   uint64
+	warnings uint64
+	counts   map[errorSummaryKey]uint64
+}
+
+func newErrorTally() *errorTally {
+	return &errorTally{counts: make(map[errorSummaryKey]uint64)}
+}
+
+func (t *errorTally) record(ent zapcore.Entry) {
+	key := errorSummaryKey{scopeOf(ent), ent.Message}
+
+	t.mu.Lock()
+	if ent.Level >= zapcore.ErrorLevel {
+		t.errors++
+	} else {
+		t.warnings++
+	}
+	if _, ok := t.counts[key]; ok || len(t.counts) < errorSummaryMaxMessages {
+		t.counts[key]++
+	}
+	t.mu.Unlock()
+}
+
+// summary returns the summary of the entries tallied since the last call, or an empty string if
+// there were none, and starts a new tally.
+func (t *errorTally) summary(interval time.Duration) string {
+	t.mu.Lock()
+	errorCount, warningCount, counts := t.errors, t.warnings, t.counts
+	t.errors, t.warnings, t.counts = 0, 0, make(map[errorSummaryKey]uint64)
+	t.mu.Unlock()
+
+	if errorCount == 0 && warningCount == 0 {
+		return ""
+	}
+
+	keys := make([]errorSummaryKey, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		if keys[i].scope != keys[j].scope {
+			return keys[i].scope < keys[j].scope
+		}
+		return keys[i].message < keys[j].message
+	})
+	if len(keys) > errorSummaryTop {
+		keys = keys[:errorSummaryTop]
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "last %v: %d errors, %d warnings, top:", interval, errorCount, warningCount)
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, " %s: %s x %d", k.scope, k.message, counts[k])
+	}
+	return b.String()
+}
+
+// errorSummaryCore tallies the warnings and errors reaching it.
+type errorSummaryCore struct {
+	zapcore.Core
+	tally *errorTally
+}
+
+func newErrorSummaryCore(core zapcore.Core, tally *errorTally) zapcore.Core {
+	return &errorSummaryCore{core, tally}
+}
+
+func (c *errorSummaryCore) With(fields []zapcore.Field) zapcore.Core {
+	return &errorSummaryCore{c.Core.With(fields), c.tally}
+}
+
+func (c *errorSummaryCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ent.Level >= zapcore.WarnLevel {
+		c.tally.record(ent)
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// reportErrorSummaries periodically outputs a summary of the entries tallied to the given logger,
+// until the stop channel is closed. Nothing is output for the intervals without warnings or errors.
+func reportErrorSummaries(l *zap.Logger, t *errorTally, interval time.Duration, stop <-chan struct{}) {
+	ticker := newTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C():
+			if s := t.summary(interval); s != "" {
+				l.Info(s)
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestErrorTally(t *testing.T) {
+	tally := newErrorTally()
+
+	if s := tally.summary(time.Minute); s != "" {
+		t.Errorf("Got '%s', expecting no summary without warnings or errors", s)
+	}
+
+	for i := 0; i < 5; i++ {
+		tally.record(zapcore.Entry{Level: zapcore.ErrorLevel, LoggerName: "dispatcher", Message: "Unable to dispatch"})
+	}
+	for i := 0; i < 3; i++ {
+		tally.record(zapcore.Entry{Level: zapcore.WarnLevel, Message: "Slow check"})
+	}
+	tally.record(zapcore.Entry{Level: zapcore.ErrorLevel, Message: "Bad config"})
+	tally.record(zapcore.Entry{Level: zapcore.ErrorLevel, Message: "Bad request"})
+
+	expected := "last 5m0s: 7 errors, 3 warnings, top: dispatcher: Unable to dispatch x 5, default: Slow check x 3, default: Bad config x 1"
+	if s := tally.summary(5 * time.Minute); s != expected {
+		t.Errorf("Got '%s', expecting '%s'", s, expected)
+	}
+
+	// the tally starts over
+	if s := tally.summary(time.Minute); s != "" {
+		t.Errorf("Got '%s', expecting the tally to be reset", s)
+	}
+}
+
+func TestErrorTallyBounded(t *testing.T) {
+	tally := newErrorTally()
+	for i := 0; i < errorSummaryMaxMessages*2; i++ {
+		tally.record(zapcore.Entry{Level: zapcore.ErrorLevel, Message: fmt.Sprintf("Error %d", i)})
+	}
+
+	if len(tally.counts) != errorSummaryMaxMessages {
+		t.Errorf("Got %d messages tallied, expecting %d", len(tally.counts), errorSummaryMaxMessages)
+	}
+	if s := tally.summary(time.Minute); !strings.HasPrefix(s, "last 1m0s: 2000 errors, 0 warnings") {
+		t.Errorf("Got '%s', expecting every error counted", s)
+	}
+}
+
+func TestErrorSummary(t *testing.T) {
+	lines, err := captureStdout(func() {
+		o := NewOptions()
+		o.ErrorSummaryInterval = 50 * time.Millisecond
+		o.SamplingInitial = 1
+		o.SamplingThereafter = 1000
+		if err := Configure(o); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		for i := 0; i < 20; i++ {
+			Error("Unable to dispatch")
+		}
+
+		time.Sleep(150 * time.Millisecond)
+		Sync()
+
+		// stop the summary reporting
+		_ = Configure(NewOptions())
+	})
+
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	// the summary accounts for the entries dropped by sampling
+	expected := "\tinfo\tlast 50ms: 20 errors, 0 warnings, top: default: Unable to dispatch x 20"
+	found := 0
+	for _, l := range lines {
+		if strings.HasSuffix(l, expected) {
+			found++
+		}
+	}
+	if found != 1 {
+		t.Errorf("Got '%v', expecting a single line ending with '%s'", strings.Join(lines, "\n"), expected)
+	}
+}
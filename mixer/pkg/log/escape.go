@@ -0,0 +1,119 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// The console encoding writes messages as they are, so a message holding a newline or an ANSI
+// control sequence, such as a request path, can forge entries or tamper with the terminal of whoever
+// reads the log. The escaped console encoding writes these characters as escape sequences instead,
+// like the JSON-encoded fields of the console encoding already are.
+
+const escapedConsoleEncoding = "console-escaped"
+
+// Settings of Options.ConsoleEscaping.
+const (
+	escapeAuto   = "auto"
+	escapeAlways = "always"
+	escapeNever  = "never"
+)
+
+func init() {
+	registerEncoder(escapedConsoleEncoding, func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		return &escapingEncoder{zapcore.NewConsoleEncoder(cfg)}, nil
+	})
+}
+
+// checkConsoleEscaping verifies that the console escaping setting is one of those supported.
+func checkConsoleEscaping(escaping string) error {
+	switch escaping {
+	case "", escapeAuto, escapeAlways, escapeNever:
+		return nil
+	}
+	return fmt.Errorf("unknown console escaping: %s", escaping)
+}
+
+// consoleEncoding returns the encoding to build the outputs to the given paths in the given encoding
+// with, which is the escaped console encoding in place of the console encoding when the options ask
+// for it, by default when the paths aren't terminals.
+func consoleEncoding(options *Options, encoding string, paths []string) string {
+	if encoding != "console" {
+		return encoding
+	}
+
+	switch options.ConsoleEscaping {
+	case escapeAlways:
+		return escapedConsoleEncoding
+	case escapeNever:
+		return encoding
+	}
+
+	if terminals(paths) {
+		return encoding
+	}
+	return escapedConsoleEncoding
+}
+
+// escapingEncoder escapes the control characters of the messages and logger names of the console
+// encoding.
+type escapingEncoder struct {
+	zapcore.Encoder
+}
+
+func (e *escapingEncoder) Clone() zapcore.Encoder {
+	return &escapingEncoder{e.Encoder.Clone()}
+}
+
+func (e *escapingEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	ent.Message = escapeControl(ent.Message)
+	ent.LoggerName = escapeControl(ent.LoggerName)
+	return e.Encoder.EncodeEntry(ent, fields)
+}
+
+// isControl returns whether a rune is a C0 or C1 control character, or DEL.
+func isControl(r rune) bool {
+	return r < 0x20 || (r >= 0x7f && r <= 0x9f)
+}
+
+// escapeControl returns the given string with its control characters escaped the way JSON escapes
+// them.
+func escapeControl(s string) string {
+	if strings.IndexFunc(s, isControl) < 0 {
+		return s
+	}
+
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case isControl(r):
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
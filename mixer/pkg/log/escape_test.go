@@ -0,0 +1,86 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEscapeControl(t *testing.T) {
+	cases := []struct {
+		in       string
+		expected string
+	}{
+		{"GET /index.html", "GET /index.html"},
+		{"héllo wörld", "héllo wörld"},
+		{"GET /\n2017-09-01T10:00:00.000Z\tinfo\tforged", `GET /\n2017-09-01T10:00:00.000Z\tinfo\tforged`},
+		{"red \x1b[31mtext\x1b[0m\r", `red \u001b[31mtext\u001b[0m\r`},
+		{"del \x7f csi \u009b", `del \u007f csi \u009b`},
+	}
+
+	for _, c := range cases {
+		if s := escapeControl(c.in); s != c.expected {
+			t.Errorf("Got '%s', expecting '%s'", s, c.expected)
+		}
+	}
+}
+
+func TestConsoleEscaping(t *testing.T) {
+	cases := []struct {
+		escaping string
+		terminal bool
+		escaped  bool
+	}{
+		{"", false, true},
+		{"auto", false, true},
+		{"auto", true, false},
+		{"always", true, true},
+		{"never", false, false},
+	}
+
+	for _, c := range cases {
+		restore := replaceIsTerminal(c.terminal)
+		lines, err := captureStdout(func() {
+			o := NewOptions()
+			o.AuditOutputPaths = nil
+			o.ConsoleEscaping = c.escaping
+			if err := Configure(o); err != nil {
+				t.Fatalf("Got err '%v', expecting success", err)
+			}
+
+			Named("http\x1b[2J").Info("GET /\nforged", String("path", "/\n"))
+			Sync()
+		})
+		restore()
+		if err != nil {
+			t.Fatalf("Got error '%v', expected success", err)
+		}
+
+		if escaped := strings.HasSuffix(lines[0], "\tinfo\thttp\\u001b[2J\tGET /\\nforged\t{\"path\": \"/\\n\"}"); escaped != c.escaped {
+			t.Errorf("Got '%v', expecting escaped %v for %+v", lines, c.escaped, c)
+		}
+		if escaped := len(lines) == 2; escaped != c.escaped {
+			t.Errorf("Got %d lines, expecting escaped %v for %+v", len(lines), c.escaped, c)
+		}
+	}
+	configureWithoutOutput(t)
+
+	o := NewOptions()
+	o.ConsoleEscaping = "sometimes"
+	if err := Configure(o); err == nil {
+		t.Error("Got success, expecting error")
+	}
+}
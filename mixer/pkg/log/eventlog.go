@@ -0,0 +1,129 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build windows
+
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// Windows Event Log output
+//
+// Entries are reported to the Windows Event Log when OutputPaths contains eventlog://<source>.
+// The event source defaults to the name of the executable when omitted, as in eventlog://. The
+// source should be registered beforehand, for example with eventcreate, for Windows to render
+// the events without complaining about missing descriptions.
+//
+// Debug and info entries are reported as information events, warnings as warning events, and
+// everything more severe as error events. Structured fields are appended to the message, one
+// per line.
+
+// Event IDs reported for each kind of event. Sources registered with eventcreate accept IDs up to 1000.
+const (
+	eventLogInfoID    = 1
+	eventLogWarningID = 2
+	eventLogErrorID   = 3
+)
+
+func init() {
+	RegisterSink("eventlog", newEventLogSink)
+}
+
+// eventLogCore outputs entries to the Windows Event Log.
+type eventLogCore struct {
+	zapcore.LevelEnabler
+
+	log    *eventlog.Log
+	fields []zapcore.Field
+}
+
+func newEventLogSink(u *url.URL, enab zapcore.LevelEnabler) (zapcore.Core, io.Closer, error) {
+	source := u.Host
+	if source == "" {
+		source = strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+	}
+
+	l, err := eventlog.Open(source)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to open the event log for source %s: %v", source, err)
+	}
+
+	return &eventLogCore{LevelEnabler: enab, log: l}, l, nil
+}
+
+func (c *eventLogCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	clone.fields = append(append(clone.fields, c.fields...), fields...)
+	return &clone
+}
+
+func (c *eventLogCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *eventLogCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	msg := c.format(ent, fields)
+
+	switch {
+	case ent.Level >= zapcore.ErrorLevel:
+		return c.log.Error(eventLogErrorID, msg)
+	case ent.Level == zapcore.WarnLevel:
+		return c.log.Warning(eventLogWarningID, msg)
+	default:
+		return c.log.Info(eventLogInfoID, msg)
+	}
+}
+
+func (c *eventLogCore) Sync() error {
+	return nil
+}
+
+// format produces the text of the event reported for an entry.
+func (c *eventLogCore) format(ent zapcore.Entry, fields []zapcore.Field) string {
+	var buf bytes.Buffer
+
+	if ent.LoggerName != "" {
+		buf.WriteString(ent.LoggerName + ": ")
+	}
+	buf.WriteString(ent.Message)
+
+	for _, p := range flattenFields(append(c.fields[:len(c.fields):len(c.fields)], fields...)) {
+		buf.WriteString("\r\n" + p[0] + "=" + p[1])
+	}
+
+	if ent.Caller.Defined {
+		buf.WriteString("\r\ncaller=" + ent.Caller.TrimmedPath())
+	}
+
+	if ent.Stack != "" {
+		buf.WriteString("\r\n\r\n" + strings.Replace(ent.Stack, "\n", "\r\n", -1))
+	}
+
+	return buf.String()
+}
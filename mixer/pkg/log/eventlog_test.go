@@ -0,0 +1,48 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build windows
+
+package log
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestEventLog(t *testing.T) {
+	o := NewOptions()
+	o.OutputPaths = []string{"eventlog://istio-log-test"}
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	Info("Hello", zap.String("user", "bob"))
+	Warn("Hello")
+	Error("Hello")
+}
+
+func TestEventLogFormat(t *testing.T) {
+	c := &eventLogCore{LevelEnabler: zapcore.InfoLevel}
+	core := c.With([]zapcore.Field{zap.String("adapter", "denier")}).(*eventLogCore)
+
+	msg := core.format(zapcore.Entry{LoggerName: "adapters", Message: "Hello", Stack: "a\nb"}, []zapcore.Field{zap.Int("count", 3)})
+
+	expected := "adapters: Hello\r\nadapter=denier\r\ncount=3\r\n\r\na\r\nb"
+	if msg != expected {
+		t.Errorf("Got %q, expecting %q", msg, expected)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// The longest the log is given to sync on termination.
+const exitSyncTimeout = 5 * time.Second
+
+var exitSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// raise terminates the process as the given signal would have, had it not been handled. Tests
+// replace it.
+var raise = func(sig os.Signal) {
+	signal.Reset(sig)
+	if p, err := os.FindProcess(os.Getpid()); err == nil && p.Signal(sig) == nil {
+		// give the signal time to be delivered
+		time.Sleep(time.Second)
+	}
+
+	// some platforms can't deliver signals to a process
+	os.Exit(1)
+}
+
+// RegisterExitHandlers makes the process sync the log when it receives SIGINT or SIGTERM, so that
+// buffered entries aren't lost, and then terminate as the signal would have. The given handlers are
+// called first, in order, which lets programs run their own shutdown logic, and have what it logs
+// synced as well. The sync is given at most 5 seconds, so that a dead output can't hold up
+// termination.
+//
+// Programs that handle these signals themselves without exiting shouldn't use this, and should call
+// SyncWithTimeout from their own handlers instead.
+//
+// The returned function uninstalls the handlers.
+func RegisterExitHandlers(handlers ...func(os.Signal)) func() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, exitSignals...)
+
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-ch:
+			handleExit(sig, handlers)
+		case <-stop:
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(stop)
+		})
+	}
+}
+
+// handleExit runs the handlers and syncs the log before terminating the process.
+func handleExit(sig os.Signal, handlers []func(os.Signal)) {
+	Infof("Received %v, exiting", sig)
+
+	for _, h := range handlers {
+		h(sig)
+	}
+
+	// this can't go through the logger itself
+	if err := SyncWithTimeout(exitSyncTimeout); err != nil {
+		reportError("%v", err)
+	}
+
+	raise(sig)
+}
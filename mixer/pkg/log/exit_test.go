@@ -0,0 +1,155 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// stuckSyncCore holds up syncs until released.
+type stuckSyncCore struct {
+	zapcore.Core
+	release chan struct{}
+}
+
+func (c *stuckSyncCore) With(fields []zapcore.Field) zapcore.Core {
+	return &stuckSyncCore{Core: c.Core.With(fields), release: c.release}
+}
+
+func (c *stuckSyncCore) Sync() error {
+	<-c.release
+	return c.Core.Sync()
+}
+
+// replaceRaise makes termination send the signal to a channel instead, until the returned function
+// is called.
+func replaceRaise() (chan os.Signal, func()) {
+	raised := make(chan os.Signal, 1)
+	old := raise
+	raise = func(sig os.Signal) {
+		raised <- sig
+	}
+	return raised, func() { raise = old }
+}
+
+func TestSyncWithTimeout(t *testing.T) {
+	configureWithoutOutput(t)
+
+	if err := SyncWithTimeout(time.Second); err != nil {
+		t.Errorf("Got err '%v', expecting success", err)
+	}
+
+	collector, _ := newCollectingCore(zapcore.DebugLevel)
+	core := &stuckSyncCore{Core: collector, release: make(chan struct{})}
+	defer AddCore(core)()
+	defer close(core.release)
+
+	start := time.Now()
+	err := SyncWithTimeout(20 * time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Got err '%v', expecting a timeout", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Got a sync taking %v, expecting it to give up after the timeout", d)
+	}
+}
+
+func TestHandleExit(t *testing.T) {
+	raised, restore := replaceRaise()
+	defer restore()
+
+	collector, buf := newCollectingCore(zapcore.DebugLevel)
+	core := &blockingCore{Core: collector, release: make(chan struct{})}
+	defer AddCore(core)()
+
+	configureAsync(t, 0, "")
+	defer configureWithoutOutput(t)
+
+	var calls []string
+	handlers := []func(os.Signal){
+		func(sig os.Signal) {
+			calls = append(calls, "first "+sig.String())
+			Info("Shutting down")
+		},
+		func(sig os.Signal) {
+			calls = append(calls, "second "+sig.String())
+			close(core.release)
+		},
+	}
+	handleExit(os.Interrupt, handlers)
+
+	if got := strings.Join(calls, ", "); got != "first interrupt, second interrupt" {
+		t.Errorf("Got handler calls '%s', expecting both handlers in order", got)
+	}
+
+	// what the handlers logged is written out before the process is terminated
+	if s := buf.String(); !strings.Contains(s, "Received interrupt, exiting") || !strings.Contains(s, "Shutting down") {
+		t.Errorf("Got '%s', expecting the entries logged on exit", s)
+	}
+
+	select {
+	case sig := <-raised:
+		if sig != os.Interrupt {
+			t.Errorf("Got %v, expecting %v", sig, os.Interrupt)
+		}
+	default:
+		t.Error("Got no termination, expecting the signal to be raised again")
+	}
+}
+
+func TestRegisterExitHandlers(t *testing.T) {
+	raised, restore := replaceRaise()
+	defer restore()
+	configureWithoutOutput(t)
+
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	handled := make(chan os.Signal, 1)
+	stop := RegisterExitHandlers(func(sig os.Signal) {
+		handled <- sig
+	})
+	defer stop()
+
+	if err := p.Signal(os.Interrupt); err != nil {
+		t.Skipf("Can't signal the process: %v", err)
+	}
+
+	select {
+	case sig := <-handled:
+		if sig != os.Interrupt {
+			t.Errorf("Got %v, expecting %v", sig, os.Interrupt)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the handler to be called")
+	}
+
+	select {
+	case <-raised:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the signal to be raised again")
+	}
+
+	// stopping more than once is harmless
+	stop()
+	stop()
+}
@@ -0,0 +1,123 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// the number of consecutive errors of an output after which it is failed over
+const failoverErrorThreshold = 3
+
+// how long the entries go to the failover output before the failing output is tried again
+var failoverRetryInterval = 10 * time.Second
+
+// failoverState tracks the errors of an output, shared by the cores derived with With.
+type failoverState struct {
+	mu     sync.Mutex
+	errors int
+
+	// whether the output is failed over, and when to try it again
+	failedOver bool
+	retry      time.Time
+}
+
+// failoverCore writes entries to another output, such as stderr, while the output it wraps keeps
+// failing, so that the entries aren't lost while a collector restarts or a disk is full. A notice
+// is written to the failover output when it takes over and when the output recovers. While failed
+// over, the output is tried again every failoverRetryInterval.
+type failoverCore struct {
+	zapcore.Core
+	name     string
+	fallback zapcore.Core
+	state    *failoverState
+}
+
+func newFailoverCore(core zapcore.Core, name string, fallback zapcore.Core) zapcore.Core {
+	return &failoverCore{core, name, fallback, &failoverState{}}
+}
+
+func (c *failoverCore) With(fields []zapcore.Field) zapcore.Core {
+	return &failoverCore{c.Core.With(fields), c.name, c.fallback.With(fields), c.state}
+}
+
+func (c *failoverCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *failoverCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	now := now()
+
+	c.state.mu.Lock()
+	skip := c.state.failedOver && now.Before(c.state.retry)
+	c.state.mu.Unlock()
+	if skip {
+		return c.fallback.Write(ent, fields)
+	}
+
+	err := c.Core.Write(ent, fields)
+
+	c.state.mu.Lock()
+	var notice string
+	if err == nil {
+		if c.state.failedOver {
+			notice = fmt.Sprintf("the log output to %s recovered, switching back to it", c.name)
+		}
+		c.state.errors, c.state.failedOver = 0, false
+	} else {
+		c.state.errors++
+		if c.state.failedOver {
+			c.state.retry = now.Add(failoverRetryInterval)
+		} else if c.state.errors >= failoverErrorThreshold {
+			notice = fmt.Sprintf("the log output to %s is failing, switching over until it recovers: %v", c.name, err)
+			c.state.failedOver, c.state.retry = true, now.Add(failoverRetryInterval)
+		}
+	}
+	c.state.mu.Unlock()
+
+	if notice != "" {
+		_ = c.fallback.Write(zapcore.Entry{Level: zapcore.WarnLevel, Time: now, Message: notice}, nil)
+	}
+	if err == nil {
+		return nil
+	}
+
+	// the entry is kept rather than lost, even before the output is failed over
+	return c.fallback.Write(ent, fields)
+}
+
+func (c *failoverCore) Sync() error {
+	c.state.mu.Lock()
+	failedOver := c.state.failedOver
+	c.state.mu.Unlock()
+
+	err := c.fallback.Sync()
+	if failedOver {
+		_ = c.Core.Sync()
+		return err
+	}
+
+	if e := c.Core.Sync(); e != nil {
+		return e
+	}
+	return err
+}
@@ -0,0 +1,135 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// keyMatcher matches field keys against a set of patterns. A pattern is either an exact key,
+// or a prefix followed by '*'.
+type keyMatcher struct {
+	exact    map[string]bool
+	prefixes []string
+}
+
+func newKeyMatcher(patterns []string) *keyMatcher {
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	m := &keyMatcher{exact: make(map[string]bool)}
+	for _, p := range patterns {
+		if strings.HasSuffix(p, "*") {
+			m.prefixes = append(m.prefixes, strings.TrimSuffix(p, "*"))
+		} else {
+			m.exact[p] = true
+		}
+	}
+
+	return m
+}
+
+func (m *keyMatcher) matches(key string) bool {
+	if m.exact[key] {
+		return true
+	}
+
+	for _, p := range m.prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fieldFilter decides which structured fields are output.
+type fieldFilter struct {
+	allow *keyMatcher
+	deny  *keyMatcher
+}
+
+// newFieldFilter returns a filter which keeps only the fields matching the allowlist, if one
+// is supplied, and then drops the fields matching the denylist. It returns nil if both lists
+// are empty.
+func newFieldFilter(allowlist []string, denylist []string) *fieldFilter {
+	if len(allowlist) == 0 && len(denylist) == 0 {
+		return nil
+	}
+
+	return &fieldFilter{
+		allow: newKeyMatcher(allowlist),
+		deny:  newKeyMatcher(denylist),
+	}
+}
+
+func (f *fieldFilter) keep(key string) bool {
+	if f.allow != nil && !f.allow.matches(key) {
+		return false
+	}
+
+	return f.deny == nil || !f.deny.matches(key)
+}
+
+// apply returns the subset of the given fields which pass the filter. The input slice is left
+// untouched.
+func (f *fieldFilter) apply(fields []zapcore.Field) []zapcore.Field {
+	for i, fld := range fields {
+		if f.keep(fld.Key) {
+			continue
+		}
+
+		// found one to drop, switch over to building a new slice
+		result := make([]zapcore.Field, i, len(fields)-1)
+		copy(result, fields[:i])
+		for _, fld := range fields[i+1:] {
+			if f.keep(fld.Key) {
+				result = append(result, fld)
+			}
+		}
+
+		return result
+	}
+
+	return fields
+}
+
+// fieldFilterCore strips the fields rejected by a filter before handing entries to the wrapped core.
+type fieldFilterCore struct {
+	zapcore.Core
+	filter *fieldFilter
+}
+
+func newFieldFilterCore(core zapcore.Core, filter *fieldFilter) zapcore.Core {
+	return &fieldFilterCore{core, filter}
+}
+
+func (c *fieldFilterCore) With(fields []zapcore.Field) zapcore.Core {
+	return &fieldFilterCore{c.Core.With(c.filter.apply(fields)), c.filter}
+}
+
+func (c *fieldFilterCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *fieldFilterCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(ent, c.filter.apply(fields))
+}
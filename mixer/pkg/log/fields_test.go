@@ -0,0 +1,92 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestFieldFilter(t *testing.T) {
+	fields := []zapcore.Field{
+		zap.String("a", "1"),
+		zap.String("body", "2"),
+		zap.String("request.id", "3"),
+		zap.String("request.body", "4"),
+	}
+
+	cases := []struct {
+		allow  []string
+		deny   []string
+		result []string
+	}{
+		{nil, nil, []string{"a", "body", "request.id", "request.body"}},
+		{nil, []string{"body"}, []string{"a", "request.id", "request.body"}},
+		{nil, []string{"request.*"}, []string{"a", "body"}},
+		{[]string{"request.*"}, nil, []string{"request.id", "request.body"}},
+		{[]string{"request.*"}, []string{"request.body"}, []string{"request.id"}},
+		{[]string{"a", "body"}, []string{"*"}, []string{}},
+	}
+
+	for i, c := range cases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			result := fields
+			if f := newFieldFilter(c.allow, c.deny); f != nil {
+				result = f.apply(fields)
+			}
+
+			keys := []string{}
+			for _, f := range result {
+				keys = append(keys, f.Key)
+			}
+
+			if !reflect.DeepEqual(keys, c.result) {
+				t.Errorf("Got %v, expecting %v", keys, c.result)
+			}
+		})
+	}
+
+	if len(fields) != 4 || fields[1].Key != "body" {
+		t.Errorf("Got %v, expecting the input to be left untouched", fields)
+	}
+}
+
+func TestFieldFilterOptions(t *testing.T) {
+	lines, err := captureStdout(func() {
+		o := NewOptions()
+		o.FieldDenylist = []string{"body", "attr.*"}
+		if err := Configure(o); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		l := With(zap.String("attr.source", "x"), zap.String("id", "y"))
+		l.Info("Hello", zap.String("body", "lots of data"), zap.Int("status", 200))
+		Sync()
+	})
+
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	pat := "\tinfo\tHello\t{\"id\": \"y\", \"status\": 200}$"
+	if match, _ := regexp.MatchString(pat, lines[0]); !match {
+		t.Errorf("Got '%s', expecting to match '%s'", lines[0], pat)
+	}
+}
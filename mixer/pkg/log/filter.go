@@ -0,0 +1,142 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	includeFilter = "include"
+	excludeFilter = "exclude"
+)
+
+// messageFilter decides which messages are output based on regular expressions.
+type messageFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// parseMessageFilter parses filters of the form include=<regexp> or exclude=<regexp>. When
+// include filters are present, only messages matching at least one of them are output.
+// Messages matching any of the exclude filters are never output.
+//
+// It returns nil if there are no filters.
+func parseMessageFilter(filters []string) (*messageFilter, error) {
+	if len(filters) == 0 {
+		return nil, nil
+	}
+
+	mf := &messageFilter{}
+	for _, f := range filters {
+		eq := strings.Index(f, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("invalid message filter '%s', expecting include=<regexp> or exclude=<regexp>", f)
+		}
+
+		re, err := regexp.Compile(f[eq+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid message filter '%s': %v", f, err)
+		}
+
+		switch f[:eq] {
+		case includeFilter:
+			mf.include = append(mf.include, re)
+		case excludeFilter:
+			mf.exclude = append(mf.exclude, re)
+		default:
+			return nil, fmt.Errorf("invalid message filter '%s', expecting include=<regexp> or exclude=<regexp>", f)
+		}
+	}
+
+	return mf, nil
+}
+
+func (mf *messageFilter) allows(msg string) bool {
+	if mf == nil {
+		return true
+	}
+
+	if len(mf.include) > 0 {
+		included := false
+		for _, re := range mf.include {
+			if re.MatchString(msg) {
+				included = true
+				break
+			}
+		}
+
+		if !included {
+			return false
+		}
+	}
+
+	for _, re := range mf.exclude {
+		if re.MatchString(msg) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// The message filter currently in effect.
+var currentMessageFilter atomic.Value // *messageFilter
+
+func init() {
+	currentMessageFilter.Store((*messageFilter)(nil))
+}
+
+// SetMessageFilters replaces the set of message filters in effect, without otherwise affecting
+// the logging configuration.
+//
+// Each filter has the form include=<regexp> or exclude=<regexp>. When include filters are
+// present, only messages matching at least one of them are output. Messages matching any
+// of the exclude filters are never output. Passing no filters lets all messages through.
+func SetMessageFilters(filters []string) error {
+	mf, err := parseMessageFilter(filters)
+	if err != nil {
+		return err
+	}
+
+	currentMessageFilter.Store(mf)
+	return nil
+}
+
+// messageFilterCore discards the entries rejected by the current message filter before they
+// reach the wrapped core.
+type messageFilterCore struct {
+	zapcore.Core
+}
+
+func newMessageFilterCore(core zapcore.Core) zapcore.Core {
+	return &messageFilterCore{core}
+}
+
+func (c *messageFilterCore) With(fields []zapcore.Field) zapcore.Core {
+	return &messageFilterCore{c.Core.With(fields)}
+}
+
+func (c *messageFilterCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !currentMessageFilter.Load().(*messageFilter).allows(ent.Message) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
@@ -0,0 +1,105 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMessageFilter(t *testing.T) {
+	cases := []struct {
+		filters []string
+		msg     string
+		allowed bool
+	}{
+		{nil, "anything", true},
+		{[]string{"include=.*RBAC.*"}, "RBAC: access denied", true},
+		{[]string{"include=.*RBAC.*"}, "Quota exceeded", false},
+		{[]string{"exclude=^health"}, "health check ok", false},
+		{[]string{"exclude=^health"}, "RBAC: access denied", true},
+		{[]string{"include=RBAC", "include=Quota"}, "Quota exceeded", true},
+		{[]string{"include=RBAC", "exclude=allowed"}, "RBAC: access allowed", false},
+		{[]string{"include=RBAC", "exclude=allowed"}, "RBAC: access denied", true},
+	}
+
+	for i, c := range cases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			mf, err := parseMessageFilter(c.filters)
+			if err != nil {
+				t.Fatalf("Got error '%v', expecting success", err)
+			}
+
+			if allowed := mf.allows(c.msg); allowed != c.allowed {
+				t.Errorf("Got %v, expecting %v", allowed, c.allowed)
+			}
+		})
+	}
+
+	for _, bad := range []string{"include", "foo=bar", "exclude=[a-"} {
+		if _, err := parseMessageFilter([]string{bad}); err == nil {
+			t.Errorf("Got success for '%s', expecting failure", bad)
+		}
+	}
+}
+
+func TestMessageFilterOptions(t *testing.T) {
+	lines, err := captureStdout(func() {
+		o := NewOptions()
+		o.MessageFilters = []string{"exclude=noisy"}
+		if err := Configure(o); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		Info("a noisy message")
+		Info("Hello")
+
+		if err := SetMessageFilters([]string{"include=noisy"}); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		Info("another noisy message")
+		Info("Goodbye")
+
+		if err := SetMessageFilters([]string{"bad"}); err == nil {
+			t.Errorf("Got success, expecting failure")
+		}
+
+		Info("still noisy")
+		Sync()
+	})
+
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	expected := []string{"Hello", "another noisy message", "still noisy", ""}
+	if len(lines) != len(expected) {
+		t.Fatalf("Got %d lines, expecting %d:\n%s", len(lines), len(expected), strings.Join(lines, "\n"))
+	}
+
+	for i, msg := range expected {
+		if !strings.HasSuffix(lines[i], msg) {
+			t.Errorf("Got '%s', expecting it to end with '%s'", lines[i], msg)
+		}
+	}
+
+	o := NewOptions()
+	o.MessageFilters = []string{"bad"}
+	if err := Configure(o); err == nil {
+		t.Errorf("Got success, expecting failure")
+	}
+}
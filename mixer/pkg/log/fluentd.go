@@ -0,0 +1,251 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Fluentd output
+//
+// Entries are shipped to a fluentd or fluent-bit aggregator using the forward protocol when
+// OutputPaths contains fluentd://host[:port], or fluentd+tls://host[:port] for an aggregator
+// accepting TLS connections, the port defaulting to 24224. These query parameters are supported:
+//
+//		tag       the tag of the entries, istio by default
+//		ack       whether to wait for the aggregator to acknowledge each batch of entries, false by default
+//		buffer    the maximum number of entries held while the aggregator is unreachable, 8192 by default
+//		timeout   the timeout for connecting and for sending a batch of entries, 5s by default
+//
+// Entries are buffered and sent in batches by a background goroutine, which reconnects with a
+// jittered, increasing delay when the aggregator can't be reached. Entries are dropped once the
+// buffer is full, as are those the aggregator can't take within the timeout once the output is
+// closed, and counted by the istio_log_sink_dropped_entries_total metric.
+
+const (
+	fluentdDefaultPort    = "24224"
+	fluentdDefaultTag     = "istio"
+	fluentdDefaultBuffer  = 8192
+	fluentdDefaultTimeout = 5 * time.Second
+)
+
+func init() {
+	RegisterSink("fluentd", newFluentdSink)
+	RegisterSink("fluentd+tls", newFluentdSink)
+}
+
+// fluentdProtocol sends the entries of a networkWriter to an aggregator in forward mode.
+type fluentdProtocol struct {
+	addr    string
+	tag     string
+	ack     bool
+	tls     *tls.Config
+	timeout time.Duration
+}
+
+func (p *fluentdProtocol) connect() (net.Conn, error) {
+	return dialSink("tcp", p.addr, p.timeout, p.tls)
+}
+
+func (p *fluentdProtocol) send(conn net.Conn, entries [][]byte) ([][]byte, error) {
+	var chunk string
+	option := 1
+	if p.ack {
+		id := make([]byte, 16)
+		if _, err := io.ReadFull(rand.Reader, id); err != nil {
+			return nil, err
+		}
+		chunk = base64.StdEncoding.EncodeToString(id)
+		option++
+	}
+
+	// [tag, [entry, ...], {"size": n, "chunk": id}]
+	msg := appendMsgpackArrayHeader(nil, 3)
+	msg = appendMsgpackString(msg, p.tag)
+	msg = appendMsgpackArrayHeader(msg, len(entries))
+	for _, e := range entries {
+		msg = append(msg, e...)
+	}
+	msg = appendMsgpackMapHeader(msg, option)
+	msg = appendMsgpackString(msg, "size")
+	msg = appendMsgpackInt(msg, int64(len(entries)))
+	if p.ack {
+		msg = appendMsgpackString(msg, "chunk")
+		msg = appendMsgpackString(msg, chunk)
+	}
+
+	if err := p.exchange(conn, msg, chunk); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (p *fluentdProtocol) exchange(conn net.Conn, msg []byte, chunk string) error {
+	if err := conn.SetDeadline(time.Now().Add(p.timeout)); err != nil {
+		return err
+	}
+
+	if _, err := conn.Write(msg); err != nil {
+		return err
+	}
+
+	if !p.ack {
+		return nil
+	}
+
+	resp, err := readMsgpackValue(bufio.NewReader(conn))
+	if err != nil {
+		return fmt.Errorf("unable to read acknowledgement: %v", err)
+	}
+
+	if m, ok := resp.(map[string]interface{}); !ok || m["ack"] != chunk {
+		return fmt.Errorf("unexpected acknowledgement %v", resp)
+	}
+
+	return nil
+}
+
+// fluentdCore encodes entries as fluentd records and hands them over to a networkWriter sending them.
+type fluentdCore struct {
+	zapcore.LevelEnabler
+
+	w      *networkWriter
+	cfg    zapcore.EncoderConfig
+	fields []zapcore.Field
+}
+
+func newFluentdSink(u *url.URL, enab zapcore.LevelEnabler) (zapcore.Core, io.Closer, error) {
+	if u.Hostname() == "" {
+		return nil, nil, fmt.Errorf("missing fluentd address in %s", u)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = fluentdDefaultPort
+	}
+
+	q := u.Query()
+
+	tag := fluentdDefaultTag
+	if t := q.Get("tag"); t != "" {
+		tag = t
+	}
+
+	ack := false
+	if a := q.Get("ack"); a != "" {
+		var err error
+		if ack, err = strconv.ParseBool(a); err != nil {
+			return nil, nil, fmt.Errorf("invalid fluentd ack setting %s: %v", a, err)
+		}
+	}
+
+	buffer := fluentdDefaultBuffer
+	if b := q.Get("buffer"); b != "" {
+		var err error
+		if buffer, err = strconv.Atoi(b); err != nil || buffer < 1 {
+			return nil, nil, fmt.Errorf("invalid fluentd buffer size %s", b)
+		}
+	}
+
+	timeout := fluentdDefaultTimeout
+	if t := q.Get("timeout"); t != "" {
+		var err error
+		if timeout, err = time.ParseDuration(t); err != nil || timeout <= 0 {
+			return nil, nil, fmt.Errorf("invalid fluentd timeout %s", t)
+		}
+	}
+
+	var tlsConfig *tls.Config
+	if u.Scheme == "fluentd+tls" {
+		tlsConfig = sinkTLSConfig()
+	}
+
+	addr := net.JoinHostPort(u.Hostname(), port)
+	proto := &fluentdProtocol{addr: addr, tag: tag, ack: ack, tls: tlsConfig, timeout: timeout}
+	w := newNetworkWriter(u.Scheme+"://"+addr, proto, buffer, timeout)
+	return &fluentdCore{LevelEnabler: enab, w: w, cfg: sinkEncoder}, w, nil
+}
+
+func (c *fluentdCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	clone.fields = append(append(clone.fields, c.fields...), fields...)
+	return &clone
+}
+
+func (c *fluentdCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *fluentdCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.w.enqueue(c.encode(ent, fields))
+}
+
+func (c *fluentdCore) Sync() error {
+	return c.w.sync()
+}
+
+// encode produces the forward protocol representation of an entry: [time, record].
+func (c *fluentdCore) encode(ent zapcore.Entry, fields []zapcore.Field) []byte {
+	record := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(record)
+	}
+	for _, f := range fields {
+		f.AddTo(record)
+	}
+
+	// the keys of the record follow the encoder settings, which leave out those set to ""
+	cfg := c.cfg
+	if cfg.LevelKey != "" {
+		record.Fields[cfg.LevelKey] = ent.Level.String()
+	}
+	if cfg.MessageKey != "" {
+		record.Fields[cfg.MessageKey] = ent.Message
+	}
+	if ent.LoggerName != "" && cfg.NameKey != "" {
+		record.Fields[cfg.NameKey] = ent.LoggerName
+	}
+	if ent.Caller.Defined && cfg.CallerKey != "" {
+		record.Fields[cfg.CallerKey] = ent.Caller.TrimmedPath()
+	}
+	if ent.Stack != "" && cfg.StacktraceKey != "" {
+		record.Fields[cfg.StacktraceKey] = ent.Stack
+	}
+
+	// the time goes out as an EventTime, for nanosecond precision
+	var t [8]byte
+	binary.BigEndian.PutUint32(t[:4], uint32(ent.Time.Unix()))
+	binary.BigEndian.PutUint32(t[4:], uint32(ent.Time.Nanosecond()))
+
+	b := appendMsgpackArrayHeader(nil, 2)
+	b = appendMsgpackExt(b, 0, t[:])
+	return appendMsgpackValue(b, record.Fields)
+}
@@ -0,0 +1,231 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// fakeFluentd accepts forward protocol messages, acknowledging them when asked to.
+type fakeFluentd struct {
+	l        net.Listener
+	messages chan []interface{}
+}
+
+func newFakeFluentd(t *testing.T, addr string) *fakeFluentd {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+
+	f := &fakeFluentd{l: l, messages: make(chan []interface{}, 100)}
+	go f.serve()
+	return f
+}
+
+func (f *fakeFluentd) serve() {
+	for {
+		conn, err := f.l.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer func() { _ = conn.Close() }()
+
+			r := bufio.NewReader(conn)
+			for {
+				v, err := readMsgpackValue(r)
+				if err != nil {
+					return
+				}
+
+				msg := v.([]interface{})
+				f.messages <- msg
+
+				if option, ok := msg[2].(map[string]interface{}); ok && option["chunk"] != nil {
+					resp := appendMsgpackMapHeader(nil, 1)
+					resp = appendMsgpackString(resp, "ack")
+					resp = appendMsgpackString(resp, option["chunk"].(string))
+					_, _ = conn.Write(resp)
+				}
+			}
+		}()
+	}
+}
+
+func (f *fakeFluentd) close() {
+	_ = f.l.Close()
+}
+
+func (f *fakeFluentd) next(t *testing.T) []interface{} {
+	select {
+	case msg := <-f.messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for fluentd message")
+		return nil
+	}
+}
+
+func TestFluentd(t *testing.T) {
+	server := newFakeFluentd(t, "127.0.0.1:0")
+	defer server.close()
+
+	o := NewOptions()
+	o.OutputPaths = []string{"fluentd://" + server.l.Addr().String() + "?tag=mixer&ack=true"}
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	Info("Hello", zap.String("user", "bob"), zap.Int("count", 3))
+	Sync()
+
+	msg := server.next(t)
+	if msg[0] != "mixer" {
+		t.Errorf("Got tag %v, expecting mixer", msg[0])
+	}
+
+	entries := msg[1].([]interface{})
+	if len(entries) != 1 {
+		t.Fatalf("Got %d entries, expecting 1", len(entries))
+	}
+
+	entry := entries[0].([]interface{})
+	if ts, ok := entry[0].(msgpackExt); !ok || ts.Type != 0 || len(ts.Data) != 8 {
+		t.Errorf("Got time %v, expecting an EventTime", entry[0])
+	}
+
+	record := entry[1].(map[string]interface{})
+	expected := map[string]interface{}{"level": "info", "msg": "Hello", "user": "bob", "count": int64(3)}
+	for k, v := range expected {
+		if record[k] != v {
+			t.Errorf("Got %s=%v, expecting %v", k, record[k], v)
+		}
+	}
+}
+
+func TestFluentdReconnect(t *testing.T) {
+	// find a free port, and leave it unattended for now
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	core, closer, err := newFluentdSink(mustParseURL(t, "fluentd://"+addr), zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = closer.Close() }()
+
+	if err := core.Write(zapcore.Entry{Message: "Hello", Time: time.Now()}, nil); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	server := newFakeFluentd(t, addr)
+	defer server.close()
+
+	if err := core.Sync(); err != nil {
+		t.Errorf("Got err '%v', expecting success", err)
+	}
+
+	msg := server.next(t)
+	entry := msg[1].([]interface{})[0].([]interface{})
+	if record := entry[1].(map[string]interface{}); record["msg"] != "Hello" {
+		t.Errorf("Got %v, expecting the buffered entry", record)
+	}
+}
+
+func TestFluentdBufferFull(t *testing.T) {
+	w := &networkWriter{queue: make(chan []byte, 1), dropped: sinkDroppedEntriesTotal.WithLabelValues("fluentd://test")}
+
+	if err := w.enqueue([]byte{0xc0}); err != nil {
+		t.Errorf("Got err '%v', expecting success", err)
+	}
+
+	if err := w.enqueue([]byte{0xc0}); err != errNetworkBufferFull {
+		t.Errorf("Got err '%v', expecting %v", err, errNetworkBufferFull)
+	}
+}
+
+func TestFluentdCloseDropped(t *testing.T) {
+	// find a port nothing listens on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	core, closer, err := newFluentdSink(mustParseURL(t, "fluentd://"+addr+"?timeout=100ms"), zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	stats := &sinkStats{}
+	closer.(statusReporter).reportStatus(stats)
+
+	var m dto.Metric
+	dropped := sinkDroppedEntriesTotal.WithLabelValues("fluentd://" + addr)
+	_ = dropped.Write(&m)
+	before := m.GetCounter().GetValue()
+
+	for i := 0; i < 3; i++ {
+		if err := core.Write(zapcore.Entry{Message: "Hello", Time: time.Now()}, nil); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+	}
+
+	// the entries the aggregator can't take by the timeout are counted as dropped
+	start := time.Now()
+	_ = closer.Close()
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Got Close taking %v, expecting it bounded by the timeout", elapsed)
+	}
+
+	_ = dropped.Write(&m)
+	if got := m.GetCounter().GetValue() - before; got != 3 {
+		t.Errorf("Got %v dropped entries, expecting 3", got)
+	}
+	if s := stats.status(); s.Dropped != 3 {
+		t.Errorf("Got %+v, expecting the dropped entries in the status", s)
+	}
+}
+
+func TestFluentdErrors(t *testing.T) {
+	cases := []string{
+		"fluentd://",
+		"fluentd://localhost?ack=maybe",
+		"fluentd://localhost?buffer=0",
+		"fluentd://localhost?timeout=never",
+	}
+
+	for _, c := range cases {
+		t.Run(c, func(t *testing.T) {
+			if _, _, err := newFluentdSink(mustParseURL(t, c), zapcore.InfoLevel); err == nil {
+				t.Error("Got success, expecting error")
+			}
+		})
+	}
+}
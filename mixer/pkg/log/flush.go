@@ -0,0 +1,37 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// periodicSync syncs the given logger at the given interval, until the stop channel is closed.
+func periodicSync(l *zap.Logger, interval time.Duration, stop <-chan struct{}) {
+	t := newTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C():
+			// failures are commonplace, such as for terminals, and there's nowhere to report them
+			_ = l.Sync()
+		}
+	}
+}
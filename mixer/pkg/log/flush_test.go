@@ -0,0 +1,68 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// syncCountingCore counts the calls to Sync.
+type syncCountingCore struct {
+	zapcore.Core
+	syncs *int32
+}
+
+func (c *syncCountingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &syncCountingCore{Core: c.Core.With(fields), syncs: c.syncs}
+}
+
+func (c *syncCountingCore) Sync() error {
+	atomic.AddInt32(c.syncs, 1)
+	return c.Core.Sync()
+}
+
+func TestFlushInterval(t *testing.T) {
+	var syncs int32
+	collector, _ := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(&syncCountingCore{Core: collector, syncs: &syncs})()
+
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.FlushInterval = 5 * time.Millisecond
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&syncs) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Got %d syncs, expecting the log to be synced regularly", atomic.LoadInt32(&syncs))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// reconfiguring stops the syncing
+	configureWithoutOutput(t)
+	stopped := atomic.LoadInt32(&syncs)
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&syncs); n != stopped {
+		t.Errorf("Got %d more syncs, expecting none after reconfiguring", n-stopped)
+	}
+}
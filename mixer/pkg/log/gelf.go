@@ -0,0 +1,317 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// GELF encoding and output
+//
+// The gelf encoding outputs entries in the Graylog Extended Log Format, one JSON object per line.
+// Levels are mapped to syslog severities, and fields are output as additional fields, prefixed
+// with an underscore.
+//
+// Entries are also sent to Graylog when OutputPaths contains gelf+udp://host[:port] or
+// gelf+tcp://host[:port], the port defaulting to 12201. Over UDP, entries larger than a datagram
+// are split into chunks. These query parameters are supported:
+//
+//		chunk      the maximum size of UDP datagrams, 1420 by default, 8154 being a better fit for local networks
+//		compress   whether to gzip-compress UDP messages, false by default
+
+const (
+	gelfEncoding        = "gelf"
+	gelfDefaultPort     = "12201"
+	gelfDefaultChunk    = 1420
+	gelfMaxChunks       = 128
+	gelfChunkHeaderSize = 12
+)
+
+var gelfPool = buffer.NewPool()
+
+func init() {
+	registerEncoder(gelfEncoding, func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		return newGELFEncoder(cfg.LineEnding), nil
+	})
+
+	RegisterSink("gelf+udp", newGELFSink)
+	RegisterSink("gelf+tcp", newGELFSink)
+}
+
+// gelfEncoder encodes entries as GELF messages. Fields added with With are kept in the embedded
+// MapObjectEncoder.
+type gelfEncoder struct {
+	*zapcore.MapObjectEncoder
+
+	host       string
+	lineEnding string
+}
+
+func newGELFEncoder(lineEnding string) *gelfEncoder {
+	host, _ := os.Hostname()
+	return &gelfEncoder{
+		MapObjectEncoder: zapcore.NewMapObjectEncoder(),
+		host:             host,
+		lineEnding:       lineEnding,
+	}
+}
+
+func (e *gelfEncoder) Clone() zapcore.Encoder {
+	clone := &gelfEncoder{
+		MapObjectEncoder: zapcore.NewMapObjectEncoder(),
+		host:             e.host,
+		lineEnding:       e.lineEnding,
+	}
+	for k, v := range e.Fields {
+		clone.Fields[k] = v
+	}
+	return clone
+}
+
+func (e *gelfEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	extra := zapcore.NewMapObjectEncoder()
+	for k, v := range e.Fields {
+		extra.Fields[k] = v
+	}
+	for _, f := range fields {
+		f.AddTo(extra)
+	}
+
+	msg := make(map[string]interface{}, len(extra.Fields)+8)
+	for k, v := range extra.Fields {
+		msg[gelfFieldName(k)] = gelfValue(v)
+	}
+
+	ms := ent.Time.UnixNano() / int64(time.Millisecond)
+	msg["version"] = "1.1"
+	msg["host"] = e.host
+	msg["short_message"] = ent.Message
+	msg["timestamp"] = json.Number(fmt.Sprintf("%d.%03d", ms/1000, ms%1000))
+	msg["level"] = syslogSeverity(ent.Level)
+	if ent.Stack != "" {
+		msg["full_message"] = ent.Message + "\n" + ent.Stack
+	}
+	if ent.LoggerName != "" {
+		msg["_logger"] = ent.LoggerName
+	}
+	if ent.Caller.Defined {
+		msg["_caller"] = ent.Caller.TrimmedPath()
+	}
+
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := gelfPool.Get()
+	_, _ = buf.Write(b)
+	buf.AppendString(e.lineEnding)
+	return buf, nil
+}
+
+// gelfFieldName turns a field key into the name of an additional field: prefixed with an
+// underscore, and made of letters, digits, underscores, dashes, and dots. The reserved _id
+// becomes _id_.
+func gelfFieldName(key string) string {
+	b := []byte("_" + key)
+	for i, ch := range b {
+		if !(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch == '_' || ch == '-' || ch == '.') {
+			b[i] = '_'
+		}
+	}
+
+	if name := string(b); name != "_id" {
+		return name
+	}
+	return "_id_"
+}
+
+// gelfValue keeps numbers as they are, GELF only allowing numbers and strings.
+func gelfValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, uintptr:
+		return val
+	case float64:
+		if !math.IsNaN(val) && !math.IsInf(val, 0) {
+			return val
+		}
+	case float32:
+		if !math.IsNaN(float64(val)) && !math.IsInf(float64(val), 0) {
+			return val
+		}
+	}
+	return flatValue(v)
+}
+
+// gelfCore outputs entries to Graylog.
+type gelfCore struct {
+	zapcore.LevelEnabler
+
+	enc      zapcore.Encoder
+	conn     *syslogConn
+	udp      bool
+	chunk    int
+	compress bool
+}
+
+// gelfIDs generates the IDs of chunked messages.
+var gelfIDs = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+func newGELFSink(u *url.URL, enab zapcore.LevelEnabler) (zapcore.Core, io.Closer, error) {
+	if u.Hostname() == "" {
+		return nil, nil, fmt.Errorf("missing graylog address in %s", u)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = gelfDefaultPort
+	}
+
+	c := &gelfCore{
+		LevelEnabler: enab,
+		enc:          newGELFEncoder(""),
+		udp:          u.Scheme == "gelf+udp",
+		chunk:        gelfDefaultChunk,
+	}
+
+	q := u.Query()
+	if s := q.Get("chunk"); s != "" {
+		var err error
+		if c.chunk, err = strconv.Atoi(s); err != nil || c.chunk <= gelfChunkHeaderSize {
+			return nil, nil, fmt.Errorf("invalid gelf chunk size %s", s)
+		}
+	}
+
+	if s := q.Get("compress"); s != "" {
+		var err error
+		if c.compress, err = strconv.ParseBool(s); err != nil {
+			return nil, nil, fmt.Errorf("invalid gelf compress setting %s: %v", s, err)
+		}
+	}
+
+	// the same redialing connection as for syslog
+	c.conn = &syslogConn{network: "tcp", addrs: []string{net.JoinHostPort(u.Hostname(), port)}}
+	if c.udp {
+		c.conn.network = "udp"
+	}
+
+	c.conn.mu.Lock()
+	err := c.conn.dialLocked()
+	c.conn.mu.Unlock()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c, c.conn, nil
+}
+
+func (c *gelfCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.enc = c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(clone.enc)
+	}
+	return &clone
+}
+
+func (c *gelfCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *gelfCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+
+	if !c.udp {
+		// messages are delimited by null bytes over TCP
+		return c.conn.write(append(buf.Bytes(), 0))
+	}
+
+	msg := buf.Bytes()
+	if c.compress {
+		var zbuf bytes.Buffer
+		zw := gzip.NewWriter(&zbuf)
+		_, _ = zw.Write(msg)
+		_ = zw.Close()
+		msg = zbuf.Bytes()
+	}
+
+	if len(msg) <= c.chunk {
+		return c.conn.write(msg)
+	}
+
+	return c.writeChunks(msg)
+}
+
+// writeChunks splits a message into datagrams sharing a random ID, each one carrying its
+// sequence number and the total number of chunks.
+func (c *gelfCore) writeChunks(msg []byte) error {
+	size := c.chunk - gelfChunkHeaderSize
+	count := (len(msg) + size - 1) / size
+	if count > gelfMaxChunks {
+		return fmt.Errorf("gelf message of %d bytes is too large to be sent in %d chunks", len(msg), gelfMaxChunks)
+	}
+
+	header := make([]byte, gelfChunkHeaderSize)
+	header[0], header[1] = 0x1e, 0x0f
+	gelfIDs.Lock()
+	binary.BigEndian.PutUint64(header[2:10], gelfIDs.Uint64())
+	gelfIDs.Unlock()
+	header[11] = byte(count)
+
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(msg) {
+			end = len(msg)
+		}
+
+		header[10] = byte(i)
+		if err := c.conn.write(append(append([]byte(nil), header...), msg[i*size:end]...)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Sync is a no-op, entries are sent as they are written.
+func (c *gelfCore) Sync() error {
+	return nil
+}
@@ -0,0 +1,303 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func decodeGELF(t *testing.T, b []byte) map[string]interface{} {
+	var msg map[string]interface{}
+	if err := json.Unmarshal(b, &msg); err != nil {
+		t.Fatalf("Unable to decode '%s': %v", b, err)
+	}
+	return msg
+}
+
+func TestGELFEncoding(t *testing.T) {
+	lines, err := captureStdout(func() {
+		o := NewOptions()
+		o.Encoding = gelfEncoding
+		o.IncludeCallerSourceLocation = true
+		if err := Configure(o); err != nil {
+			t.Errorf("Got err '%v', expecting success", err)
+		}
+
+		Warn("Hello", zap.String("id", "42"), zap.Int("count", 3), zap.String("user name", "bob"))
+		Sync()
+	})
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	msg := decodeGELF(t, []byte(lines[0]))
+	expected := map[string]interface{}{
+		"version":       "1.1",
+		"short_message": "Hello",
+		"level":         float64(4),
+		"_id_":          "42",
+		"_count":        float64(3),
+		"_user_name":    "bob",
+	}
+	for k, v := range expected {
+		if msg[k] != v {
+			t.Errorf("Got %s=%v, expecting %v", k, msg[k], v)
+		}
+	}
+
+	if _, ok := msg["timestamp"].(float64); !ok {
+		t.Errorf("Got timestamp %v, expecting a number", msg["timestamp"])
+	}
+
+	if caller, _ := msg["_caller"].(string); !strings.HasPrefix(caller, "log/gelf_test.go:") {
+		t.Errorf("Got caller %v, expecting this test", msg["_caller"])
+	}
+}
+
+func TestGELFEncoderWith(t *testing.T) {
+	enc := newGELFEncoder("")
+	zap.String("pod", "mixer-1").AddTo(enc)
+
+	clone := enc.Clone()
+	zap.String("user", "bob").AddTo(clone)
+
+	buf, err := clone.EncodeEntry(zapcore.Entry{
+		Message:    "Hello",
+		Level:      zapcore.ErrorLevel,
+		LoggerName: "dispatcher",
+		Stack:      "stack",
+		Time:       time.Unix(1, 5e8),
+	}, nil)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	msg := decodeGELF(t, buf.Bytes())
+	expected := map[string]interface{}{
+		"_pod":         "mixer-1",
+		"_user":        "bob",
+		"_logger":      "dispatcher",
+		"level":        float64(3),
+		"timestamp":    1.5,
+		"full_message": "Hello\nstack",
+	}
+	for k, v := range expected {
+		if msg[k] != v {
+			t.Errorf("Got %s=%v, expecting %v", k, msg[k], v)
+		}
+	}
+
+	if _, ok := enc.Fields["user"]; ok {
+		t.Error("Got fields of the clone in the original encoder")
+	}
+}
+
+func TestGELFUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	read := func() []byte {
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		b := make([]byte, 65536)
+		n, _, err := conn.ReadFrom(b)
+		if err != nil {
+			t.Fatalf("Unable to read datagram: %v", err)
+		}
+		return b[:n]
+	}
+
+	u := "gelf+udp://" + conn.LocalAddr().String() + "?chunk=100&compress=true"
+	core, closer, err := newGELFSink(mustParseURL(t, u), zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = closer.Close() }()
+
+	long := strings.Repeat("abcdefghij", 50)
+	if err := core.Write(zapcore.Entry{Message: "Hello", Time: time.Now()}, []zapcore.Field{zap.String("long", long)}); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	// reassemble the chunks
+	var chunks [][]byte
+	var id []byte
+	for {
+		d := read()
+		if len(d) < gelfChunkHeaderSize || d[0] != 0x1e || d[1] != 0x0f {
+			t.Fatalf("Got datagram %x, expecting a chunk", d)
+		}
+
+		if id == nil {
+			id = d[2:10]
+			chunks = make([][]byte, d[11])
+		} else if !bytes.Equal(id, d[2:10]) {
+			t.Fatalf("Got message ID %x, expecting %x", d[2:10], id)
+		}
+
+		chunks[d[10]] = d[gelfChunkHeaderSize:]
+		if d[10] == d[11]-1 {
+			break
+		}
+	}
+
+	if len(chunks) < 2 {
+		t.Errorf("Got %d chunks, expecting the message to be split", len(chunks))
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(bytes.Join(chunks, nil)))
+	if err != nil {
+		t.Fatalf("Unable to decompress message: %v", err)
+	}
+	b, _ := ioutil.ReadAll(zr)
+
+	if msg := decodeGELF(t, b); msg["short_message"] != "Hello" || msg["_long"] != long {
+		t.Errorf("Got %v, expecting the entry", msg)
+	}
+}
+
+func TestGELFTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer func() { _ = l.Close() }()
+
+	messages := make(chan []byte, 10)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		r := bufio.NewReader(conn)
+		for {
+			b, err := r.ReadBytes(0)
+			if err != nil {
+				return
+			}
+			messages <- b
+		}
+	}()
+
+	core, closer, err := newGELFSink(mustParseURL(t, "gelf+tcp://"+l.Addr().String()), zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = closer.Close() }()
+
+	core = core.With([]zapcore.Field{zap.String("pod", "mixer-1")})
+	for _, m := range []string{"one", "two"} {
+		if err := core.Write(zapcore.Entry{Message: m, Time: time.Now()}, nil); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+	}
+
+	for _, m := range []string{"one", "two"} {
+		select {
+		case b := <-messages:
+			msg := decodeGELF(t, bytes.TrimSuffix(b, []byte{0}))
+			if msg["short_message"] != m || msg["_pod"] != "mixer-1" {
+				t.Errorf("Got %v, expecting %s", msg, m)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for gelf message")
+		}
+	}
+}
+
+func TestGELFTooManyChunks(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	core, closer, err := newGELFSink(mustParseURL(t, "gelf+udp://"+conn.LocalAddr().String()+"?chunk=13"), zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = closer.Close() }()
+
+	if err := core.Write(zapcore.Entry{Message: strings.Repeat("x", 200)}, nil); err == nil {
+		t.Error("Got success, expecting error")
+	}
+}
+
+func TestGELFFieldName(t *testing.T) {
+	cases := map[string]string{
+		"user":       "_user",
+		"user name":  "_user_name",
+		"request.id": "_request.id",
+		"x-b3":       "_x-b3",
+		"id":         "_id_",
+	}
+
+	for in, expected := range cases {
+		if got := gelfFieldName(in); got != expected {
+			t.Errorf("Got %s for %s, expecting %s", got, in, expected)
+		}
+	}
+}
+
+func TestGELFValue(t *testing.T) {
+	cases := []struct {
+		in       interface{}
+		expected interface{}
+	}{
+		{int64(3), int64(3)},
+		{1.5, 1.5},
+		{math.NaN(), "NaN"},
+		{true, "true"},
+		{[]interface{}{"a"}, `["a"]`},
+	}
+
+	for _, c := range cases {
+		if got := gelfValue(c.in); got != c.expected {
+			t.Errorf("Got %v for %v, expecting %v", got, c.in, c.expected)
+		}
+	}
+}
+
+func TestGELFErrors(t *testing.T) {
+	cases := []string{
+		"gelf+udp://",
+		"gelf+udp://localhost?chunk=12",
+		"gelf+udp://localhost?compress=maybe",
+	}
+
+	for _, c := range cases {
+		t.Run(c, func(t *testing.T) {
+			if _, _, err := newGELFSink(mustParseURL(t, c), zapcore.InfoLevel); err == nil {
+				t.Error("Got success, expecting error")
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// goroutineID returns the ID of the calling goroutine, which the runtime only reveals in the header
+// of stack traces: "goroutine 18 [running]:". It returns 0 if the header can't be parsed.
+func goroutineID() int64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+
+	id, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// goroutineCore annotates entries with the ID of the goroutine logging them. It has to write
+// entries from that goroutine, so it wraps the asynchronous mode.
+type goroutineCore struct {
+	zapcore.Core
+}
+
+func newGoroutineCore(core zapcore.Core) zapcore.Core {
+	return &goroutineCore{core}
+}
+
+func (c *goroutineCore) With(fields []zapcore.Field) zapcore.Core {
+	return &goroutineCore{c.Core.With(fields)}
+}
+
+func (c *goroutineCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *goroutineCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	withID := make([]zapcore.Field, 0, len(fields)+1)
+	withID = append(withID, zap.Int64("goroutine", goroutineID()))
+	return c.Core.Write(ent, append(withID, fields...))
+}
@@ -0,0 +1,58 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestGoroutineID(t *testing.T) {
+	ids := make(chan int64)
+	go func() {
+		ids <- goroutineID()
+	}()
+
+	main, other := goroutineID(), <-ids
+	if main <= 0 || other <= 0 || main == other {
+		t.Errorf("Got %d and %d, expecting distinct goroutine IDs", main, other)
+	}
+}
+
+func TestIncludeGoroutineID(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.IncludeGoroutineID = true
+	o.Async = true
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer configureWithoutOutput(t)
+
+	// the ID is that of the goroutine logging, not of the one writing the queue out
+	With(Int("count", 1)).Info("Hello", String("id", "a"))
+	Sync()
+
+	expected := fmt.Sprintf(`{"level":"info","msg":"Hello","count":1,"goroutine":%d,"id":"a"}`+"\n", goroutineID())
+	if buf.String() != expected {
+		t.Errorf("Got\n%s\nexpecting\n%s", buf, expected)
+	}
+}
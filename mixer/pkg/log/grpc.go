@@ -0,0 +1,200 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// GRPCScope is the scope of the entries output by the gRPC interceptors. Successful calls are
+// output at the debug level and failed ones at the warn level, so setting the level of the scope
+// with SetScopeOutputLevel selects which calls get logged.
+const GRPCScope = "grpc"
+
+// grpcLogger returns the logger of the interceptors, which follows later calls to Configure.
+func grpcLogger() *zap.Logger {
+	return zap.New(newGlobalCore()).Named(GRPCScope)
+}
+
+// logGRPCCall outputs an entry for a call which completed with the given error.
+func logGRPCCall(l *zap.Logger, msg string, method string, remote zapcore.Field, requestID zapcore.Field, start time.Time, err error) {
+	level := zapcore.DebugLevel
+	if err != nil {
+		level = zapcore.WarnLevel
+	}
+
+	if ce := l.Check(level, msg); ce != nil {
+		ce.Write(
+			zap.String("method", method),
+			remote,
+			requestID,
+			zap.String("code", grpc.Code(err).String()),
+			zap.Duration("latency", time.Since(start)))
+	}
+}
+
+// peerField returns the address of the peer of a server call.
+func peerField(ctx context.Context) zapcore.Field {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return zap.String("peer", p.Addr.String())
+	}
+	return zap.Skip()
+}
+
+// targetField returns the target of a client connection.
+func targetField(cc *grpc.ClientConn) zapcore.Field {
+	if cc == nil {
+		return zap.Skip()
+	}
+	return zap.String("target", cc.Target())
+}
+
+// incomingRequestID returns the request ID of the metadata of a server call, or a new one when the
+// client sent none.
+func incomingRequestID(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md[RequestIDHeader]; len(ids) > 0 && ids[0] != "" {
+			return ids[0]
+		}
+	}
+	return NewRequestID()
+}
+
+// outgoingRequestID returns a copy of the context of a client call which passes its request ID
+// along to the server in the metadata of the call, if it carries one.
+func outgoingRequestID(ctx context.Context) context.Context {
+	id := RequestIDFromContext(ctx)
+	if id == "" {
+		return ctx
+	}
+
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	md[RequestIDHeader] = []string{id}
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// UnaryServerInterceptor returns an interceptor which outputs an entry for each unary call handled
+// by a gRPC server, with its method, peer, request ID, status code and latency.
+//
+// The request ID is that sent by the client in the x-request-id metadata, or a new one. It is
+// added to the context of the handler, for the loggers of FromContext to output, and sent back to
+// the client in the x-request-id header.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	l := grpcLogger()
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		id := incomingRequestID(ctx)
+		ctx = WithRequestID(ctx, id)
+		// setting the header only fails when not called by a gRPC server
+		_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, id))
+
+		resp, err := handler(ctx, req)
+		logGRPCCall(l, "Handled gRPC call", info.FullMethod, peerField(ctx), requestIDField(ctx), start, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns an interceptor which outputs an entry for each streaming call
+// handled by a gRPC server once it completes, with its method, peer, request ID, status code and
+// latency. The request ID is handled like by UnaryServerInterceptor.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	l := grpcLogger()
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		id := incomingRequestID(ss.Context())
+		ctx := WithRequestID(ss.Context(), id)
+		_ = ss.SetHeader(metadata.Pairs(RequestIDHeader, id))
+
+		err := handler(srv, &requestIDServerStream{ServerStream: ss, ctx: ctx})
+		logGRPCCall(l, "Handled gRPC call", info.FullMethod, peerField(ctx), requestIDField(ctx), start, err)
+		return err
+	}
+}
+
+// requestIDServerStream hands the handlers of streaming calls a context carrying the request ID.
+type requestIDServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *requestIDServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// UnaryClientInterceptor returns an interceptor which outputs an entry for each unary call made by
+// a gRPC client, with its method, target, status code and latency. The request ID of the context
+// of the call, if any, is output as well and passed along to the server in the x-request-id
+// metadata.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	l := grpcLogger()
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(outgoingRequestID(ctx), method, req, reply, cc, opts...)
+		logGRPCCall(l, "Made gRPC call", method, targetField(cc), requestIDField(ctx), start, err)
+		return err
+	}
+}
+
+// StreamClientInterceptor returns an interceptor which outputs an entry for each streaming call
+// made by a gRPC client once it completes, with its method, target, status code and latency. Calls
+// complete when receiving fails, or reaches the end of the stream. The request ID of the context
+// is handled like by UnaryClientInterceptor.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	l := grpcLogger()
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		cs, err := streamer(outgoingRequestID(ctx), desc, cc, method, opts...)
+		if err != nil {
+			logGRPCCall(l, "Made gRPC call", method, targetField(cc), requestIDField(ctx), start, err)
+			return nil, err
+		}
+
+		return &loggedClientStream{ClientStream: cs, done: func(err error) {
+			logGRPCCall(l, "Made gRPC call", method, targetField(cc), requestIDField(ctx), start, err)
+		}}, nil
+	}
+}
+
+// loggedClientStream reports the outcome of a client stream once it completes.
+type loggedClientStream struct {
+	grpc.ClientStream
+
+	once sync.Once
+	done func(err error)
+}
+
+func (s *loggedClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == io.EOF {
+		s.once.Do(func() { s.done(nil) })
+	} else if err != nil {
+		s.once.Do(func() { s.done(err) })
+	}
+	return err
+}
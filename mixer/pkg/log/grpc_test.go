@@ -0,0 +1,200 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// fakeServerStream is the server side of a stream with the given context.
+type fakeServerStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	header metadata.MD
+}
+
+func (s *fakeServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeServerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+// fakeClientStream is the client side of a stream receiving a number of messages.
+type fakeClientStream struct {
+	grpc.ClientStream
+	messages int
+}
+
+func (s *fakeClientStream) RecvMsg(m interface{}) error {
+	if s.messages == 0 {
+		return io.EOF
+	}
+	s.messages--
+	return nil
+}
+
+func checkGRPCEntries(t *testing.T, s string, patterns []string) {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) != len(patterns) {
+		t.Fatalf("Got '%v', expecting %d entries", lines, len(patterns))
+	}
+	for i, pat := range patterns {
+		if match, _ := regexp.MatchString(pat, lines[i]); !match {
+			t.Errorf("Got '%s', expecting to match '%s'", lines[i], pat)
+		}
+	}
+}
+
+func TestGRPCServerInterceptors(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	configureWithoutOutput(t)
+	defer configureWithoutOutput(t)
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1234}})
+	unary := UnaryServerInterceptor()
+	stream := StreamServerInterceptor()
+
+	// successful calls are only output once the scope is at the debug level
+	ok := func(ctx context.Context, req interface{}) (interface{}, error) { return "resp", nil }
+	_, _ = unary(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/istio.mixer.v1.Mixer/Check"}, ok)
+
+	_ = SetScopeOutputLevel(GRPCScope, zapcore.DebugLevel)
+	resp, err := unary(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/istio.mixer.v1.Mixer/Check"}, ok)
+	if resp != "resp" || err != nil {
+		t.Errorf("Got %v and err '%v', expecting the response of the handler", resp, err)
+	}
+
+	failed := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, grpc.Errorf(codes.InvalidArgument, "bad request")
+	}
+	if _, err := unary(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/istio.mixer.v1.Mixer/Report"}, failed); grpc.Code(err) != codes.InvalidArgument {
+		t.Errorf("Got err '%v', expecting the error of the handler", err)
+	}
+
+	_ = stream(nil, &fakeServerStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: "/istio.mixer.v1.Mixer/Watch"},
+		func(srv interface{}, ss grpc.ServerStream) error { return nil })
+
+	checkGRPCEntries(t, buf.String(), []string{
+		`^{"level":"debug","logger":"grpc","msg":"Handled gRPC call","method":"/istio.mixer.v1.Mixer/Check","peer":"10.0.0.1:1234","requestId":"[0-9a-f]{32}","code":"OK","latency":"[^"]+"}$`,
+		`^{"level":"warn","logger":"grpc","msg":"Handled gRPC call","method":"/istio.mixer.v1.Mixer/Report","peer":"10.0.0.1:1234","requestId":"[0-9a-f]{32}","code":"InvalidArgument","latency":"[^"]+"}$`,
+		`^{"level":"debug","logger":"grpc","msg":"Handled gRPC call","method":"/istio.mixer.v1.Mixer/Watch","peer":"10.0.0.1:1234","requestId":"[0-9a-f]{32}","code":"OK","latency":"[^"]+"}$`,
+	})
+}
+
+func TestGRPCClientInterceptors(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	configureWithoutOutput(t)
+	defer configureWithoutOutput(t)
+	_ = SetScopeOutputLevel(GRPCScope, zapcore.DebugLevel)
+
+	unary := UnaryClientInterceptor()
+	err := unary(context.Background(), "/istio.mixer.v1.Mixer/Check", "req", nil, nil,
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			return grpc.Errorf(codes.Unavailable, "no connection")
+		})
+	if grpc.Code(err) != codes.Unavailable {
+		t.Errorf("Got err '%v', expecting the error of the invoker", err)
+	}
+
+	stream := StreamClientInterceptor()
+	cs, err := stream(context.Background(), &grpc.StreamDesc{}, nil, "/istio.mixer.v1.Mixer/Watch",
+		func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return &fakeClientStream{messages: 2}, nil
+		})
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	// the call is output once the stream ends
+	for i := 0; i < 2; i++ {
+		if err := cs.RecvMsg(nil); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+	}
+	if buf.Len() == 0 || strings.Count(buf.String(), "\n") != 1 {
+		t.Errorf("Got '%s', expecting only the unary call", buf)
+	}
+	if err := cs.RecvMsg(nil); err != io.EOF {
+		t.Errorf("Got err '%v', expecting EOF", err)
+	}
+	_ = cs.RecvMsg(nil)
+
+	checkGRPCEntries(t, buf.String(), []string{
+		`^{"level":"warn","logger":"grpc","msg":"Made gRPC call","method":"/istio.mixer.v1.Mixer/Check","code":"Unavailable","latency":"[^"]+"}$`,
+		`^{"level":"debug","logger":"grpc","msg":"Made gRPC call","method":"/istio.mixer.v1.Mixer/Watch","code":"OK","latency":"[^"]+"}$`,
+	})
+}
+
+func TestGRPCRequestIDs(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	configureWithoutOutput(t)
+	defer configureWithoutOutput(t)
+	_ = SetScopeOutputLevel(GRPCScope, zapcore.DebugLevel)
+
+	// the servers keep the request IDs of the clients
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(RequestIDHeader, "abc"))
+	_, _ = UnaryServerInterceptor()(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/istio.mixer.v1.Mixer/Check"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			if id := RequestIDFromContext(ctx); id != "abc" {
+				t.Errorf("Got request ID '%s', expecting that of the client", id)
+			}
+			return nil, nil
+		})
+
+	ss := &fakeServerStream{ctx: context.Background()}
+	var streamID string
+	_ = StreamServerInterceptor()(nil, ss, &grpc.StreamServerInfo{FullMethod: "/istio.mixer.v1.Mixer/Watch"},
+		func(srv interface{}, ss grpc.ServerStream) error {
+			streamID = RequestIDFromContext(ss.Context())
+			return nil
+		})
+	if len(streamID) != 32 || len(ss.header[RequestIDHeader]) != 1 || ss.header[RequestIDHeader][0] != streamID {
+		t.Errorf("Got request ID '%s' and header %v, expecting a new ID sent back to the client", streamID, ss.header)
+	}
+
+	// and the clients pass theirs along, alongside the metadata of the calls
+	ctx = metadata.NewOutgoingContext(WithRequestID(context.Background(), "abc"), metadata.Pairs("user", "joe"))
+	_ = UnaryClientInterceptor()(ctx, "/istio.mixer.v1.Mixer/Check", "req", nil, nil,
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			md, _ := metadata.FromOutgoingContext(ctx)
+			if len(md[RequestIDHeader]) != 1 || md[RequestIDHeader][0] != "abc" || len(md["user"]) != 1 {
+				t.Errorf("Got metadata %v, expecting the request ID added", md)
+			}
+			return nil
+		})
+
+	checkGRPCEntries(t, buf.String(), []string{
+		`^{"level":"debug","logger":"grpc","msg":"Handled gRPC call","method":"/istio.mixer.v1.Mixer/Check","requestId":"abc","code":"OK","latency":"[^"]+"}$`,
+		`^{"level":"debug","logger":"grpc","msg":"Handled gRPC call","method":"/istio.mixer.v1.Mixer/Watch","requestId":"` + streamID + `","code":"OK","latency":"[^"]+"}$`,
+		`^{"level":"debug","logger":"grpc","msg":"Made gRPC call","method":"/istio.mixer.v1.Mixer/Check","requestId":"abc","code":"OK","latency":"[^"]+"}$`,
+	})
+}
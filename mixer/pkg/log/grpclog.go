@@ -0,0 +1,160 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// The environment variables gRPC reads the settings of its default logger from, which are honored
+// while its logging is captured.
+const (
+	grpcSeverityEnv  = "GRPC_GO_LOG_SEVERITY_LEVEL"
+	grpcVerbosityEnv = "GRPC_GO_LOG_VERBOSITY_LEVEL"
+)
+
+// the settings the gRPC logging goes through while captured
+var currentGRPCLogger atomic.Value // *grpcLogSettings
+
+// grpcLogSettings are the logger the gRPC logging goes through, along with the settings of the
+// environment variables of gRPC.
+type grpcLogSettings struct {
+	logger *zap.SugaredLogger
+
+	// the lowest severity of the gRPC entries output, all of them when the variable isn't set
+	severity zapcore.Level
+
+	// the highest verbosity level of gRPC, 0 when the variable isn't set
+	verbosity int
+}
+
+// newGRPCLogSettings returns the settings forwarding the gRPC logging to the given logger of the
+// package-level functions, as the environment variables of gRPC ask. Like gRPC, the values it
+// doesn't understand are ignored.
+func newGRPCLogSettings(logger *zap.Logger) *grpcLogSettings {
+	s := &grpcLogSettings{
+		// skip the forwarder and the package-level function of grpclog
+		logger:   logger.WithOptions(zap.AddCallerSkip(2)).Sugar(),
+		severity: zapcore.DebugLevel,
+	}
+
+	switch strings.ToLower(os.Getenv(grpcSeverityEnv)) {
+	case "info":
+		s.severity = zapcore.InfoLevel
+	case "warning":
+		s.severity = zapcore.WarnLevel
+	case "error":
+		s.severity = zapcore.ErrorLevel
+	}
+
+	if v, err := strconv.Atoi(os.Getenv(grpcVerbosityEnv)); err == nil {
+		s.verbosity = v
+	}
+	return s
+}
+
+// grpcLogForwarder forwards the gRPC logging to the logger of the last call to Configure, at the
+// levels matching the severities of gRPC. The logger of gRPC isn't replaced on each call, as that
+// isn't safe while gRPC is in use, which the sinks connecting over gRPC make it.
+type grpcLogForwarder struct{}
+
+func (grpcLogForwarder) settings() *grpcLogSettings {
+	return currentGRPCLogger.Load().(*grpcLogSettings)
+}
+
+// log outputs the given message at the given level, unless below the severity asked for. Fatal
+// entries are always output.
+func (f grpcLogForwarder) log(level zapcore.Level, msg string) {
+	s := f.settings()
+	if level < s.severity && level < zapcore.FatalLevel {
+		return
+	}
+
+	switch level {
+	case zapcore.InfoLevel:
+		s.logger.Info(msg)
+	case zapcore.WarnLevel:
+		s.logger.Warn(msg)
+	case zapcore.ErrorLevel:
+		s.logger.Error(msg)
+	default:
+		s.logger.Fatal(msg)
+	}
+}
+
+func (f grpcLogForwarder) Info(args ...interface{}) {
+	f.log(zapcore.InfoLevel, fmt.Sprint(args...))
+}
+
+func (f grpcLogForwarder) Infoln(args ...interface{}) {
+	f.log(zapcore.InfoLevel, sprintln(args))
+}
+
+func (f grpcLogForwarder) Infof(format string, args ...interface{}) {
+	f.log(zapcore.InfoLevel, fmt.Sprintf(format, args...))
+}
+
+func (f grpcLogForwarder) Warning(args ...interface{}) {
+	f.log(zapcore.WarnLevel, fmt.Sprint(args...))
+}
+
+func (f grpcLogForwarder) Warningln(args ...interface{}) {
+	f.log(zapcore.WarnLevel, sprintln(args))
+}
+
+func (f grpcLogForwarder) Warningf(format string, args ...interface{}) {
+	f.log(zapcore.WarnLevel, fmt.Sprintf(format, args...))
+}
+
+func (f grpcLogForwarder) Error(args ...interface{}) {
+	f.log(zapcore.ErrorLevel, fmt.Sprint(args...))
+}
+
+func (f grpcLogForwarder) Errorln(args ...interface{}) {
+	f.log(zapcore.ErrorLevel, sprintln(args))
+}
+
+func (f grpcLogForwarder) Errorf(format string, args ...interface{}) {
+	f.log(zapcore.ErrorLevel, fmt.Sprintf(format, args...))
+}
+
+func (f grpcLogForwarder) Fatal(args ...interface{}) {
+	f.log(zapcore.FatalLevel, fmt.Sprint(args...))
+}
+
+func (f grpcLogForwarder) Fatalln(args ...interface{}) {
+	f.log(zapcore.FatalLevel, sprintln(args))
+}
+
+func (f grpcLogForwarder) Fatalf(format string, args ...interface{}) {
+	f.log(zapcore.FatalLevel, fmt.Sprintf(format, args...))
+}
+
+// V returns whether gRPC outputs its messages of the given verbosity level.
+func (f grpcLogForwarder) V(l int) bool {
+	return l <= f.settings().verbosity
+}
+
+// sprintln formats the given arguments like fmt.Sprintln, without the newline.
+func sprintln(args []interface{}) string {
+	return strings.TrimSuffix(fmt.Sprintln(args...), "\n")
+}
@@ -0,0 +1,68 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc/grpclog"
+)
+
+func TestGRPCLogEnvironment(t *testing.T) {
+	cases := []struct {
+		severity  string
+		verbosity string
+		expected  string
+		verbose   bool
+	}{
+		{"", "", `{"level":"info","msg":"Connecting"}` + "\n" +
+			`{"level":"warn","msg":"Retrying in 1s"}` + "\n" +
+			`{"level":"error","msg":"Unable to connect"}` + "\n", false},
+		{"WARNING", "2", `{"level":"warn","msg":"Retrying in 1s"}` + "\n" +
+			`{"level":"error","msg":"Unable to connect"}` + "\n", true},
+		{"error", "1", `{"level":"error","msg":"Unable to connect"}` + "\n", false},
+		{"loud", "high", `{"level":"info","msg":"Connecting"}` + "\n" +
+			`{"level":"warn","msg":"Retrying in 1s"}` + "\n" +
+			`{"level":"error","msg":"Unable to connect"}` + "\n", false},
+	}
+
+	defer configureWithoutOutput(t)
+
+	for _, c := range cases {
+		restoreSeverity := setEnv(grpcSeverityEnv, c.severity)
+		restoreVerbosity := setEnv(grpcVerbosityEnv, c.verbosity)
+
+		core, buf := newCollectingCore(zapcore.DebugLevel)
+		remove := AddCore(core)
+		configureWithoutOutput(t)
+
+		grpclog.Infoln("Connecting")
+		grpclog.Warningf("Retrying in %v", "1s")
+		grpclog.Error("Unable to connect")
+		verbose := grpclog.V(2)
+
+		remove()
+		restoreVerbosity()
+		restoreSeverity()
+
+		if buf.String() != c.expected {
+			t.Errorf("Got\n%s\nexpecting\n%s\nfor %s", buf, c.expected, c.severity)
+		}
+		if verbose != c.verbose {
+			t.Errorf("Got %v, expecting %v for the verbosity %s", verbose, c.verbose, c.verbosity)
+		}
+	}
+}
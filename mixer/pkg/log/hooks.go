@@ -0,0 +1,180 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// The hooks registered with RegisterHook.
+var (
+	hooksMu sync.Mutex
+	hooks   atomic.Value // []*registeredHook
+)
+
+// registeredHook wraps a hook, so that it can be told apart when unregistered.
+type registeredHook struct {
+	hook func(zapcore.Entry) error
+}
+
+func init() {
+	hooks.Store([]*registeredHook(nil))
+}
+
+// RegisterHook has the given function called for each entry output, after filtering, sampling, and
+// redaction, like the hooks of zap.Hooks. It lets embedders count entries, raise alerts, or forward
+// them elsewhere without replacing the core. Hooks are kept across calls to Configure, and are
+// called synchronously from the goroutine logging the entry, which they should not hold up. The
+// errors they return are reported on the error output.
+//
+// The returned function unregisters the hook again.
+func RegisterHook(hook func(zapcore.Entry) error) func() {
+	registered := &registeredHook{hook}
+
+	hooksMu.Lock()
+	current := hooks.Load().([]*registeredHook)
+	updated := make([]*registeredHook, len(current), len(current)+1)
+	copy(updated, current)
+	hooks.Store(append(updated, registered))
+	hooksMu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			hooksMu.Lock()
+			current := hooks.Load().([]*registeredHook)
+			updated := make([]*registeredHook, 0, len(current))
+			for _, h := range current {
+				if h != registered {
+					updated = append(updated, h)
+				}
+			}
+			hooks.Store(updated)
+			hooksMu.Unlock()
+		})
+	}
+}
+
+// runHooks is a zap hook calling the hooks registered with RegisterHook, returning the first error.
+func runHooks(ent zapcore.Entry) error {
+	var err error
+	for _, h := range hooks.Load().([]*registeredHook) {
+		if e := h.hook(ent); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// ErrorHook is called with each entry at the error level and above, along with its fields,
+// including those added with With.
+type ErrorHook func(entry zapcore.Entry, fields []zapcore.Field)
+
+// RegisterErrorHook has the given hook called for each entry at the error level and above, so that
+// crash-level diagnostics can be forwarded to an error tracker such as Sentry. Entries without a
+// stack trace of their own are given the stack trace of the goroutine logging them.
+//
+// Hooks are called synchronously, from the goroutine logging the entry, after filtering, sampling,
+// and redaction, and before the process exits on fatal entries. They are kept across calls to
+// Configure, but aren't called while the log is configured with the None level. A panicking hook is
+// reported on the error output rather than crashing the process.
+//
+// The returned function unregisters the hook again.
+func RegisterErrorHook(hook ErrorHook) func() {
+	return AddCore(&errorHookCore{hook: hook})
+}
+
+// errorHookCore calls a hook for the entries at the error level and above.
+type errorHookCore struct {
+	hook   ErrorHook
+	fields []zapcore.Field
+}
+
+func (c *errorHookCore) Enabled(level zapcore.Level) bool {
+	return level >= zapcore.ErrorLevel
+}
+
+func (c *errorHookCore) With(fields []zapcore.Field) zapcore.Core {
+	return &errorHookCore{hook: c.hook, fields: append(c.fields[:len(c.fields):len(c.fields)], fields...)}
+}
+
+func (c *errorHookCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Enabled(ent.Level) {
+		return ce
+	}
+	return ce.AddCore(ent, c)
+}
+
+func (c *errorHookCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if ent.Stack == "" {
+		ent.Stack = zap.Stack("").String
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			reportError("the error hook panicked on '%s': %v", ent.Message, r)
+		}
+	}()
+
+	c.hook(ent, append(c.fields[:len(c.fields):len(c.fields)], fields...))
+	return nil
+}
+
+func (c *errorHookCore) Sync() error {
+	return nil
+}
+
+// stackFrame is a call of a stack trace.
+type stackFrame struct {
+	function string
+	file     string
+	line     int
+}
+
+// parseStack parses a stack trace as formatted by zap, innermost call first, leaving out the frames
+// of zap and of this package.
+func parseStack(stack string) []stackFrame {
+	lines := strings.Split(strings.TrimSpace(stack), "\n")
+
+	var frames []stackFrame
+	for i := 0; i+1 < len(lines); i += 2 {
+		function := strings.TrimSpace(lines[i])
+		location := strings.TrimSpace(lines[i+1])
+		if isInternalFrame(function) {
+			continue
+		}
+
+		frame := stackFrame{function: function, file: location}
+		if colon := strings.LastIndex(location, ":"); colon > 0 {
+			if line, err := strconv.Atoi(location[colon+1:]); err == nil {
+				frame.file, frame.line = location[:colon], line
+			}
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// isInternalFrame returns whether the given function of a stack trace belongs to zap or to this
+// package.
+func isInternalFrame(function string) bool {
+	return strings.HasPrefix(function, "go.uber.org/zap") || strings.HasPrefix(function, "istio.io/istio/mixer/pkg/log.")
+}
@@ -0,0 +1,149 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type hookCall struct {
+	entry  zapcore.Entry
+	fields []zapcore.Field
+}
+
+func TestRegisterErrorHook(t *testing.T) {
+	configureWithoutOutput(t)
+
+	var mu sync.Mutex
+	var calls []hookCall
+	unregister := RegisterErrorHook(func(entry zapcore.Entry, fields []zapcore.Field) {
+		mu.Lock()
+		calls = append(calls, hookCall{entry, fields})
+		mu.Unlock()
+	})
+
+	Warn("Not hooked")
+	Named("dispatcher").With(zap.String("adapter", "a")).Error("Hooked", zap.Int("attempt", 3))
+	unregister()
+	Error("Not hooked once unregistered")
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(calls) != 1 {
+		t.Fatalf("Got %d calls, expecting 1", len(calls))
+	}
+
+	c := calls[0]
+	if c.entry.Message != "Hooked" || c.entry.LoggerName != "dispatcher" {
+		t.Errorf("Got %+v, expecting the error entry", c.entry)
+	}
+	if !strings.Contains(c.entry.Stack, "TestRegisterErrorHook") {
+		t.Errorf("Got stack '%s', expecting the stack of the logging goroutine", c.entry.Stack)
+	}
+	if len(c.fields) != 2 || c.fields[0].Key != "adapter" || c.fields[1].Key != "attempt" {
+		t.Errorf("Got fields %v, expecting those added with With followed by those of the entry", c.fields)
+	}
+}
+
+func TestErrorHookPanic(t *testing.T) {
+	defer configureWithoutOutput(t)
+	defer RegisterErrorHook(func(zapcore.Entry, []zapcore.Field) { panic("broken") })()
+
+	lines, err := captureStdout(func() {
+		o := NewOptions()
+		o.OutputPaths = nil
+		o.AuditOutputPaths = nil
+		o.ErrorOutputPaths = []string{"stdout"}
+		if err := Configure(o); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		Error("Reported")
+	})
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	if len(lines) == 0 || !strings.Contains(lines[0], "the error hook panicked on 'Reported': broken") {
+		t.Errorf("Got '%v', expecting the panic to be reported", lines)
+	}
+}
+
+func TestRegisterHook(t *testing.T) {
+	// hooks are called for the entries output
+	core, _ := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	configureWithoutOutput(t)
+
+	var mu sync.Mutex
+	var messages []string
+	unregister := RegisterHook(func(entry zapcore.Entry) error {
+		mu.Lock()
+		messages = append(messages, entry.Message)
+		mu.Unlock()
+		return nil
+	})
+
+	Info("One")
+	Debug("Not output")
+
+	// hooks are kept across calls to Configure
+	configureWithoutOutput(t)
+	Named("dispatcher").Warn("Two")
+
+	unregister()
+	Error("Not hooked once unregistered")
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(messages) != 2 || messages[0] != "One" || messages[1] != "Two" {
+		t.Errorf("Got %v, expecting the entries output while registered", messages)
+	}
+}
+
+func TestHookError(t *testing.T) {
+	defer configureWithoutOutput(t)
+	defer RegisterHook(func(zapcore.Entry) error { return errors.New("unable to forward") })()
+
+	core, _ := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+
+	lines, err := captureStdout(func() {
+		o := NewOptions()
+		o.OutputPaths = nil
+		o.AuditOutputPaths = nil
+		o.ErrorOutputPaths = []string{"stdout"}
+		if err := Configure(o); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		Info("Reported")
+	})
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	if len(lines) == 0 || !strings.Contains(lines[0], "unable to forward") {
+		t.Errorf("Got '%v', expecting the error of the hook to be reported", lines)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bufio"
+	"errors"
+	stdlog "log"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// HTTPMiddleware returns a middleware which outputs an entry under the given scope for each request
+// handled: its method, path, status, latency, the bytes of the response body, the remote address,
+// and the request ID. Requests ending in a 5xx status are output at the error level, the others at
+// the info level.
+//
+// The request ID is that of the X-Request-Id header of the request, or a new one. It is added to
+// the context of the request, for the loggers of FromContext to output, and set in the X-Request-Id
+// header of the response, so that clients can quote it when reporting errors.
+//
+//		mux := http.NewServeMux()
+//		srv := &http.Server{Handler: log.HTTPMiddleware("admin")(mux), ErrorLog: log.HTTPErrorLog("admin")}
+func HTTPMiddleware(scope string) func(http.Handler) http.Handler {
+	l := zap.New(newGlobalCore()).Named(scope)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			id := r.Header.Get(RequestIDHeader)
+			if id == "" {
+				id = NewRequestID()
+			}
+			w.Header().Set(RequestIDHeader, id)
+			r = r.WithContext(WithRequestID(r.Context(), id))
+
+			rw := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rw, r)
+
+			level := zapcore.InfoLevel
+			if rw.status >= http.StatusInternalServerError {
+				level = zapcore.ErrorLevel
+			}
+
+			if ce := l.Check(level, "Handled HTTP request"); ce != nil {
+				ce.Write(
+					zap.String("method", r.Method),
+					zap.String("path", r.URL.Path),
+					zap.Int("status", rw.status),
+					zap.Duration("latency", time.Since(start)),
+					zap.Int64("bytes", rw.bytes),
+					zap.String("remoteAddr", r.RemoteAddr),
+					zap.String("requestId", id))
+			}
+		})
+	}
+}
+
+// HTTPErrorLog returns a logger for http.Server.ErrorLog, which outputs the errors of the server,
+// such as failed TLS handshakes, at the error level under the given scope.
+func HTTPErrorLog(scope string) *stdlog.Logger {
+	return stdlog.New(Writer(zapcore.ErrorLevel, scope), "", 0)
+}
+
+// responseRecorder keeps track of the status and size of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Flush supports streaming responses, when the wrapped writer does.
+func (r *responseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack supports protocol upgrades, when the wrapped writer does.
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the response writer doesn't support hijacking")
+	}
+	return h.Hijack()
+}
@@ -0,0 +1,102 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestHTTPMiddleware(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	configureWithoutOutput(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "hello")
+	})
+	mux.HandleFunc("/fail", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	h := HTTPMiddleware("admin")(mux)
+
+	for _, path := range []string{"/metrics", "/missing", "/fail?x=1"} {
+		r := httptest.NewRequest("GET", path, nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	patterns := []string{
+		`^{"level":"info","logger":"admin","msg":"Handled HTTP request","method":"GET","path":"/metrics","status":200,"latency":"[^"]+","bytes":5,"remoteAddr":"10.0.0.1:1234","requestId":"[0-9a-f]{32}"}$`,
+		`^{"level":"info","logger":"admin","msg":"Handled HTTP request","method":"GET","path":"/missing","status":404,"latency":"[^"]+","bytes":19,"remoteAddr":"10.0.0.1:1234","requestId":"[0-9a-f]{32}"}$`,
+		`^{"level":"error","logger":"admin","msg":"Handled HTTP request","method":"GET","path":"/fail","status":503,"latency":"[^"]+","bytes":0,"remoteAddr":"10.0.0.1:1234","requestId":"[0-9a-f]{32}"}$`,
+	}
+	if len(lines) != len(patterns) {
+		t.Fatalf("Got '%v', expecting %d entries", lines, len(patterns))
+	}
+	for i, pat := range patterns {
+		if match, _ := regexp.MatchString(pat, lines[i]); !match {
+			t.Errorf("Got '%s', expecting to match '%s'", lines[i], pat)
+		}
+	}
+}
+
+func TestHTTPErrorLog(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	configureWithoutOutput(t)
+
+	HTTPErrorLog("admin").Printf("http: panic serving %s: %v", "10.0.0.1:1234", "boom")
+
+	if s := buf.String(); s != `{"level":"error","logger":"admin","msg":"http: panic serving 10.0.0.1:1234: boom"}`+"\n" {
+		t.Errorf("Got '%s', expecting the error", s)
+	}
+}
+
+func TestHTTPMiddlewareRequestID(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	configureWithoutOutput(t)
+
+	h := HTTPMiddleware("admin")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context()).Info("Serving")
+	}))
+
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	r.Header.Set("X-Request-Id", "abc")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if id := w.Header().Get("X-Request-Id"); id != "abc" {
+		t.Errorf("Got request ID '%s', expecting that of the request echoed", id)
+	}
+	if strings.Count(buf.String(), `"requestId":"abc"`) != 2 {
+		t.Errorf("Got '%s', expecting the request ID in the entries of the handler and the middleware", buf)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if id := w.Header().Get("X-Request-Id"); len(id) != 32 {
+		t.Errorf("Got request ID '%s', expecting a new one", id)
+	}
+}
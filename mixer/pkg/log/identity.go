@@ -0,0 +1,90 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"istio.io/istio/mixer/pkg/version"
+)
+
+// The environment variables through which the Kubernetes downward API conventionally exposes the
+// name and namespace of the pod.
+const (
+	podNameEnv      = "POD_NAME"
+	podNamespaceEnv = "POD_NAMESPACE"
+)
+
+// buildVersion is the version of the binary output when Options.IncludeVersion is set.
+type buildVersion struct {
+	version string
+	sha     string
+}
+
+var currentVersion atomic.Value // buildVersion
+
+func init() {
+	currentVersion.Store(buildVersion{version.Info.Version, version.Info.ID})
+}
+
+// SetVersionInfo sets the version and the git SHA of the binary, which every entry carries when
+// Options.IncludeVersion is set, so that the logs can be segmented across a rolling upgrade. They
+// default to the version and build ID of Mixer's version package, and take effect at the next call
+// to Configure.
+func SetVersionInfo(version string, sha string) {
+	currentVersion.Store(buildVersion{version, sha})
+}
+
+// processFields returns the fields the options stamp onto every entry: the identity of the process
+// and the version of the binary, when asked for, followed by the global fields.
+func processFields(o *Options) ([]zapcore.Field, error) {
+	var fields []zapcore.Field
+
+	if o.IncludeProcessIdentity {
+		if host, err := os.Hostname(); err == nil {
+			fields = append(fields, zap.String("hostname", host))
+		}
+		if pod := os.Getenv(podNameEnv); pod != "" {
+			fields = append(fields, zap.String("pod", pod))
+		}
+		if ns := os.Getenv(podNamespaceEnv); ns != "" {
+			fields = append(fields, zap.String("namespace", ns))
+		}
+		if o.Component != "" {
+			fields = append(fields, zap.String("component", o.Component))
+		}
+	}
+
+	if o.IncludeVersion {
+		v := currentVersion.Load().(buildVersion)
+		fields = append(fields, zap.String("version", v.version), zap.String("sha", v.sha))
+	}
+
+	for _, f := range o.GlobalFields {
+		eq := strings.Index(f, "=")
+		if eq <= 0 {
+			return nil, fmt.Errorf("invalid global field '%s', expecting <key>=<value>", f)
+		}
+		fields = append(fields, zap.String(f[:eq], f[eq+1:]))
+	}
+
+	return fields, nil
+}
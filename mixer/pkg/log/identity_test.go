@@ -0,0 +1,113 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"os"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+
+	"istio.io/istio/mixer/pkg/version"
+)
+
+// setEnv sets an environment variable, returning a function which restores its previous value.
+func setEnv(key string, value string) func() {
+	old, ok := os.LookupEnv(key)
+	_ = os.Setenv(key, value)
+	return func() {
+		if ok {
+			_ = os.Setenv(key, old)
+		} else {
+			_ = os.Unsetenv(key)
+		}
+	}
+}
+
+func TestProcessFields(t *testing.T) {
+	defer setEnv(podNameEnv, "mixer-1234")()
+	defer setEnv(podNamespaceEnv, "istio-system")()
+
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.IncludeProcessIdentity = true
+	o.Component = "mixer"
+	o.GlobalFields = []string{"cluster=us-east1", "zone="}
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer configureWithoutOutput(t)
+
+	Info("Hello", String("id", "a"))
+	Logger().Named("adapters").Warn("World")
+
+	host, _ := os.Hostname()
+	identity := `"hostname":"` + host + `","pod":"mixer-1234","namespace":"istio-system","component":"mixer","cluster":"us-east1","zone":""`
+	expected := `{"level":"info","msg":"Hello",` + identity + `,"id":"a"}` + "\n" +
+		`{"level":"warn","logger":"adapters","msg":"World",` + identity + `}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Got\n%s\nexpecting\n%s", buf, expected)
+	}
+}
+
+func TestProcessFieldsDisabled(t *testing.T) {
+	o := NewOptions()
+	o.Component = "mixer"
+	if fields, err := processFields(o); err != nil || len(fields) != 0 {
+		t.Errorf("Got %v, %v, expecting no fields", fields, err)
+	}
+
+	for _, f := range []string{"cluster", "=us-east1"} {
+		o.GlobalFields = []string{f}
+		if _, err := processFields(o); err == nil {
+			t.Errorf("Got success, expecting error for %s", f)
+		}
+		if err := Configure(o); err == nil {
+			t.Errorf("Got success, expecting error for %s", f)
+		}
+	}
+}
+
+func TestVersionInfo(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+
+	if v := currentVersion.Load().(buildVersion); v.version != version.Info.Version || v.sha != version.Info.ID {
+		t.Errorf("Got %v, expecting the version package's", v)
+	}
+	defer SetVersionInfo(version.Info.Version, version.Info.ID)
+	SetVersionInfo("0.2.6", "a1b2c3d")
+
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.IncludeVersion = true
+	o.GlobalFields = []string{"cluster=us-east1"}
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer configureWithoutOutput(t)
+
+	Info("Hello")
+
+	expected := `{"level":"info","msg":"Hello","version":"0.2.6","sha":"a1b2c3d","cluster":"us-east1"}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Got\n%s\nexpecting\n%s", buf, expected)
+	}
+}
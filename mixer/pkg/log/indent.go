@@ -0,0 +1,81 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// The indented JSON encoding spreads the entries over several lines, for people to read them
+// without piping the log through jq. Collectors expect an entry per line, so it is unfit for
+// production.
+
+const indentedJSONEncoding = "json-indent"
+
+func init() {
+	registerEncoder(indentedJSONEncoding, func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		lineEnding := cfg.LineEnding
+		if lineEnding == "" {
+			lineEnding = zapcore.DefaultLineEnding
+		}
+		return &indentingEncoder{newJSONEncoder(cfg), lineEnding}, nil
+	})
+}
+
+// indentEncoding returns the encoding to build the outputs in the given encoding with, which in
+// place of the JSON encoding is the one stamping the entries with the version of their schema,
+// indented when the options ask for it.
+func indentEncoding(options *Options, encoding string) string {
+	if encoding != "json" {
+		return encoding
+	}
+	if options.JSONIndent {
+		return indentedJSONEncoding
+	}
+	return versionedJSONEncoding
+}
+
+// indentingEncoder indents the entries of the JSON encoding, which end with the given line ending.
+type indentingEncoder struct {
+	zapcore.Encoder
+	lineEnding string
+}
+
+func (e *indentingEncoder) Clone() zapcore.Encoder {
+	return &indentingEncoder{e.Encoder.Clone(), e.lineEnding}
+}
+
+func (e *indentingEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	buf, err := e.Encoder.EncodeEntry(ent, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	var indented bytes.Buffer
+	entry := bytes.TrimSuffix(buf.Bytes(), []byte(e.lineEnding))
+	if err = json.Indent(&indented, bytes.TrimSpace(entry), "", "  "); err != nil {
+		// output the entry as it is, rather than lose it
+		return buf, nil
+	}
+
+	buf.Reset()
+	_, _ = buf.Write(indented.Bytes())
+	buf.AppendString(e.lineEnding)
+	return buf, nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJSONIndent(t *testing.T) {
+	cases := []struct {
+		terminal bool
+		warned   bool
+	}{
+		{true, false},
+		{false, true},
+	}
+
+	for _, c := range cases {
+		restore := replaceIsTerminal(c.terminal)
+		lines, err := captureStdout(func() {
+			o := NewOptions()
+			o.AuditOutputPaths = nil
+			o.EncoderKeys = []string{"time="}
+			o.JSONEncoding = true
+			o.JSONIndent = true
+			if err := Configure(o); err != nil {
+				t.Fatalf("Got err '%v', expecting success", err)
+			}
+
+			Info("Hello", String("adapter", "a"))
+			Sync()
+		})
+		restore()
+		if err != nil {
+			t.Fatalf("Got error '%v', expected success", err)
+		}
+
+		output := strings.Join(lines, "\n")
+		expected := "{\n  \"level\": \"info\",\n  \"msg\": \"Hello\",\n  \"log_schema\": 2,\n  \"adapter\": \"a\"\n}\n"
+		if !strings.HasSuffix(output, expected) {
+			t.Errorf("Got\n%s\nexpecting it to end with\n%s", output, expected)
+		}
+		if warned := strings.Contains(output, "meant for reading them on a terminal"); warned != c.warned {
+			t.Errorf("Got\n%s\nexpecting warned %v for %+v", output, c.warned, c)
+		}
+	}
+	configureWithoutOutput(t)
+}
+
+func TestIndentEncoding(t *testing.T) {
+	o := NewOptions()
+	if e := indentEncoding(o, "json"); e != versionedJSONEncoding {
+		t.Errorf("Got %s, expecting %s unless asked for", e, versionedJSONEncoding)
+	}
+
+	o.JSONIndent = true
+	if e := indentEncoding(o, "json"); e != indentedJSONEncoding {
+		t.Errorf("Got %s, expecting %s", e, indentedJSONEncoding)
+	}
+	if e := indentEncoding(o, "console"); e != "console" {
+		t.Errorf("Got %s, expecting the console encoding left alone", e)
+	}
+}
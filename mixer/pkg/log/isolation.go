@@ -0,0 +1,196 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// the number of entries held for an output file written independently of the others
+const isolationBuffer = 1024
+
+// how long to wait for an output file written independently of the others to make room for an
+// entry, or to be flushed or closed, before giving up on it
+var isolationTimeout = time.Second
+
+// isolationFlush asks the goroutine of an isolatedWriter to write out the entries it holds and to
+// sync the given core.
+type isolationFlush struct {
+	core zapcore.Core
+	done chan error
+}
+
+// isolatedWriter writes the entries of one of several output files from a goroutine of its own, so
+// that a file which hangs, such as on an unresponsive NFS server, doesn't hold up the others. The
+// code logging waits for a file which is merely slower than the others, but once a file has made
+// no room in its buffer for isolationTimeout, it is deemed stalled and its entries are dropped
+// until it writes again.
+type isolatedWriter struct {
+	name    string
+	queue   chan asyncEntry
+	flush   chan isolationFlush
+	stop    chan struct{}
+	done    chan struct{}
+	stalled int32
+
+	// the status of the output, if tracked
+	stats atomic.Value // *sinkStats
+}
+
+func newIsolatedWriter(name string, size int) *isolatedWriter {
+	w := &isolatedWriter{
+		name:  name,
+		queue: make(chan asyncEntry, size),
+		flush: make(chan isolationFlush),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	go w.run()
+	return w
+}
+
+func (w *isolatedWriter) reportStatus(s *sinkStats) {
+	w.stats.Store(s)
+}
+
+func (w *isolatedWriter) status() *sinkStats {
+	s, _ := w.stats.Load().(*sinkStats)
+	return s
+}
+
+func (w *isolatedWriter) run() {
+	defer close(w.done)
+
+	for {
+		select {
+		case e := <-w.queue:
+			w.write(e)
+
+		case f := <-w.flush:
+			for len(w.queue) > 0 {
+				w.write(<-w.queue)
+			}
+			f.done <- f.core.Sync()
+
+		case <-w.stop:
+			for len(w.queue) > 0 {
+				w.write(<-w.queue)
+			}
+			return
+		}
+	}
+}
+
+// write writes an entry, whose errors are tracked by the cores wrapped.
+func (w *isolatedWriter) write(e asyncEntry) {
+	_ = e.core.Write(e.ent, e.fields)
+	atomic.StoreInt32(&w.stalled, 0)
+}
+
+// enqueue hands an entry over to the background goroutine, waiting for room in the buffer unless
+// the file is stalled.
+func (w *isolatedWriter) enqueue(e asyncEntry) {
+	select {
+	case w.queue <- e:
+		return
+	default:
+	}
+
+	if atomic.LoadInt32(&w.stalled) == 0 {
+		select {
+		case w.queue <- e:
+			return
+		case <-time.After(isolationTimeout):
+			atomic.StoreInt32(&w.stalled, 1)
+		}
+	}
+	w.status().drop(1)
+}
+
+// sync waits for the entries held so far to be written, and for the given core to be synced.
+func (w *isolatedWriter) sync(core zapcore.Core) error {
+	f := isolationFlush{core, make(chan error, 1)}
+	timeout := time.After(isolationTimeout)
+
+	select {
+	case w.flush <- f:
+	case <-w.done:
+		return nil
+	case <-timeout:
+		return fmt.Errorf("timed out flushing log entries to %s", w.name)
+	}
+
+	select {
+	case err := <-f.done:
+		return err
+	case <-timeout:
+		return fmt.Errorf("timed out flushing log entries to %s", w.name)
+	}
+}
+
+// Close writes out the entries held and stops the background goroutine, giving up on a file which
+// hangs.
+func (w *isolatedWriter) Close() error {
+	close(w.stop)
+
+	select {
+	case <-w.done:
+		return nil
+	case <-time.After(isolationTimeout):
+		return fmt.Errorf("timed out closing %s", w.name)
+	}
+}
+
+// isolatedCore hands the entries of the output file it wraps over to an isolatedWriter. Like with
+// the asynchronous mode, fields are encoded by the background goroutine.
+type isolatedCore struct {
+	zapcore.Core
+	w *isolatedWriter
+}
+
+func newIsolatedCore(core zapcore.Core, w *isolatedWriter) zapcore.Core {
+	return &isolatedCore{core, w}
+}
+
+func (c *isolatedCore) With(fields []zapcore.Field) zapcore.Core {
+	return &isolatedCore{c.Core.With(fields), c.w}
+}
+
+func (c *isolatedCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *isolatedCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	// the process may be about to exit, the entries held so far and this one go out right away
+	if ent.Level > zapcore.ErrorLevel {
+		_ = c.w.sync(c.Core)
+		return c.Core.Write(ent, fields)
+	}
+
+	c.w.enqueue(asyncEntry{core: c.Core, ent: ent, fields: fields})
+	return nil
+}
+
+func (c *isolatedCore) Sync() error {
+	return c.w.sync(c.Core)
+}
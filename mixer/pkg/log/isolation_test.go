@@ -0,0 +1,155 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// hungCore stands for an output which hangs, until released.
+type hungCore struct {
+	zapcore.LevelEnabler
+	release chan struct{}
+}
+
+func (c *hungCore) With([]zapcore.Field) zapcore.Core { return c }
+
+func (c *hungCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *hungCore) Write(zapcore.Entry, []zapcore.Field) error {
+	<-c.release
+	return nil
+}
+
+func (c *hungCore) Sync() error {
+	<-c.release
+	return nil
+}
+
+func TestIsolation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "mixer.log")
+	hungPath := filepath.Join(dir, "nfs.log")
+
+	timeout := isolationTimeout
+	isolationTimeout = 50 * time.Millisecond
+	defer func() { isolationTimeout = timeout }()
+
+	hung := &hungCore{zapcore.DebugLevel, make(chan struct{})}
+	released := false
+	release := func() {
+		if !released {
+			close(hung.release)
+			released = true
+		}
+	}
+	defer release()
+
+	o := NewOptions()
+	o.OutputPaths = []string{path, hungPath}
+	o.DisableSampling = true
+	o.AuditOutputPaths = nil
+	err = configure(o, func(c *zap.Config) (*zap.Logger, error) {
+		if len(c.OutputPaths) == 1 && c.OutputPaths[0] == hungPath {
+			return zap.New(hung), nil
+		}
+		return c.Build()
+	})
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer configureWithoutOutput(t)
+
+	n := isolationBuffer + 10
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < n; i++ {
+			Info("Hello")
+		}
+		Sync()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out logging, expecting the hung output not to hold up the others")
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	if got := strings.Count(string(b), "Hello"); got != n {
+		t.Errorf("Got %d entries, expecting %d written to the file", got, n)
+	}
+
+	status := SinkStatus()
+	if len(status) != 2 {
+		t.Fatalf("Got %+v, expecting the status of each output file", status)
+	}
+	if s := status[0]; s.Name != path || s.Entries != uint64(n) || s.Dropped != 0 {
+		t.Errorf("Got %+v, expecting all the entries written to the file", s)
+	}
+	if s := status[1]; s.Name != hungPath || s.Entries != 0 || s.Dropped == 0 {
+		t.Errorf("Got %+v, expecting the entries of the hung file dropped", s)
+	}
+
+	release()
+}
+
+func TestIsolationSingleFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "mixer.log")
+
+	o := NewOptions()
+	o.OutputPaths = []string{path}
+	o.AuditOutputPaths = nil
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer configureWithoutOutput(t)
+
+	// a single file is written directly
+	Info("Hello")
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	if !strings.Contains(string(b), "Hello") {
+		t.Errorf("Got '%s', expecting the entry written right away", b)
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build linux
+
+package log
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Journald output
+//
+// Entries are sent to the systemd journal using its native protocol when OutputPaths contains
+// journald://. The journal socket can be overridden with journald:///path/to/socket and the
+// SYSLOG_IDENTIFIER reported can be set with the identifier query parameter.
+//
+// The level is reported as PRIORITY and structured fields become journal fields, with their keys
+// upper-cased and any characters not allowed by the journal replaced with underscores.
+
+const journalSocket = "/run/systemd/journal/socket"
+
+func init() {
+	RegisterSink("journald", newJournalSink)
+}
+
+// journalConn sends entries to the journal. The socket isn't connected, so a restart of the
+// journal doesn't affect it.
+type journalConn struct {
+	addr *net.UnixAddr
+	conn *net.UnixConn
+}
+
+func newJournalConn(path string) (*journalConn, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("unable to find the journal: %v", err)
+	}
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open a socket to the journal: %v", err)
+	}
+
+	return &journalConn{
+		addr: &net.UnixAddr{Name: path, Net: "unixgram"},
+		conn: conn,
+	}, nil
+}
+
+func (c *journalConn) write(msg []byte) error {
+	_, _, err := c.conn.WriteMsgUnix(msg, nil, c.addr)
+	if err != nil && isMsgTooLarge(err) {
+		return c.writeLarge(msg)
+	}
+	return err
+}
+
+// writeLarge hands over entries too large for a datagram through a file descriptor, as
+// the journal protocol prescribes.
+func (c *journalConn) writeLarge(msg []byte) error {
+	f, err := ioutil.TempFile("/dev/shm", "istio-journal-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	if err = os.Remove(f.Name()); err != nil {
+		return err
+	}
+
+	if _, err = f.Write(msg); err != nil {
+		return err
+	}
+
+	_, _, err = c.conn.WriteMsgUnix(nil, syscall.UnixRights(int(f.Fd())), c.addr)
+	return err
+}
+
+func isMsgTooLarge(err error) bool {
+	if op, ok := err.(*net.OpError); ok {
+		if se, ok := op.Err.(*os.SyscallError); ok {
+			return se.Err == syscall.EMSGSIZE || se.Err == syscall.ENOBUFS
+		}
+	}
+	return false
+}
+
+func (c *journalConn) Close() error {
+	return c.conn.Close()
+}
+
+// journalCore outputs entries to the systemd journal.
+type journalCore struct {
+	zapcore.LevelEnabler
+
+	conn       *journalConn
+	identifier string
+	fields     []zapcore.Field
+}
+
+func newJournalSink(u *url.URL, enab zapcore.LevelEnabler) (zapcore.Core, io.Closer, error) {
+	path := journalSocket
+	if u.Path != "" {
+		path = u.Path
+	}
+
+	conn, err := newJournalConn(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c := &journalCore{
+		LevelEnabler: enab,
+		conn:         conn,
+		identifier:   filepath.Base(os.Args[0]),
+	}
+
+	if id := u.Query().Get("identifier"); id != "" {
+		c.identifier = id
+	}
+
+	return c, conn, nil
+}
+
+func (c *journalCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	clone.fields = append(append(clone.fields, c.fields...), fields...)
+	return &clone
+}
+
+func (c *journalCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *journalCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.conn.write(c.format(ent, fields))
+}
+
+func (c *journalCore) Sync() error {
+	return nil
+}
+
+// format produces the journal's native serialization of an entry.
+func (c *journalCore) format(ent zapcore.Entry, fields []zapcore.Field) []byte {
+	var b []byte
+
+	b = appendJournalField(b, "MESSAGE", ent.Message)
+	b = appendJournalField(b, "PRIORITY", strconv.Itoa(syslogSeverity(ent.Level)))
+	b = appendJournalField(b, "SYSLOG_IDENTIFIER", c.identifier)
+
+	if ent.LoggerName != "" {
+		b = appendJournalField(b, "LOGGER", ent.LoggerName)
+	}
+
+	if ent.Caller.Defined {
+		b = appendJournalField(b, "CODE_FILE", ent.Caller.File)
+		b = appendJournalField(b, "CODE_LINE", strconv.Itoa(ent.Caller.Line))
+	}
+
+	if ent.Stack != "" {
+		b = appendJournalField(b, "STACKTRACE", ent.Stack)
+	}
+
+	for _, p := range flattenFields(append(c.fields[:len(c.fields):len(c.fields)], fields...)) {
+		b = appendJournalField(b, journalFieldName(p[0]), p[1])
+	}
+
+	return b
+}
+
+// appendJournalField serializes a single journal field. Values containing line breaks are
+// length-prefixed, all others are written as KEY=value lines.
+func appendJournalField(b []byte, key string, val string) []byte {
+	b = append(b, key...)
+
+	if !strings.ContainsRune(val, '\n') {
+		b = append(b, '=')
+		b = append(b, val...)
+		return append(b, '\n')
+	}
+
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(val)))
+
+	b = append(b, '\n')
+	b = append(b, size[:]...)
+	b = append(b, val...)
+	return append(b, '\n')
+}
+
+// journalFieldName turns a field key into a valid journal field name. Journal field names are made
+// of upper-case letters, digits, and underscores, can't start with an underscore or a digit, and
+// are at most 64 characters long.
+func journalFieldName(key string) string {
+	b := make([]byte, 0, len(key))
+	for i := 0; i < len(key) && len(b) < 64; i++ {
+		ch := key[i]
+		switch {
+		case ch >= 'a' && ch <= 'z':
+			b = append(b, ch-'a'+'A')
+		case ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9':
+			b = append(b, ch)
+		case len(b) > 0:
+			b = append(b, '_')
+		}
+	}
+
+	if len(b) == 0 || (b[0] >= '0' && b[0] <= '9') {
+		b = append([]byte("F_"), b...)
+		if len(b) > 64 {
+			b = b[:64]
+		}
+	}
+
+	return string(b)
+}
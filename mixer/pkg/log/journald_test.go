@@ -0,0 +1,133 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build linux
+
+package log
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestJournald(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	path := filepath.Join(dir, "journal.sock")
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	o := NewOptions()
+	o.OutputPaths = []string{"journald://" + path + "?identifier=mixer"}
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	Warn("Hello", zap.String("user-name", "bob"), zap.String("_trusted", "no"), zap.String("multi", "a\nb"))
+
+	buf := make([]byte, 2048)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Unable to read journal message: %v", err)
+	}
+
+	expected := "MESSAGE=Hello\nPRIORITY=4\nSYSLOG_IDENTIFIER=mixer\nUSER_NAME=bob\nTRUSTED=no\n" +
+		"MULTI\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\n"
+	if string(buf[:n]) != expected {
+		t.Errorf("Got %q, expecting %q", buf[:n], expected)
+	}
+}
+
+func TestJournaldLargeEntry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	if _, err := os.Stat("/dev/shm"); err != nil {
+		t.Skip("/dev/shm unavailable")
+	}
+
+	path := filepath.Join(dir, "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetReadBuffer(4096)
+
+	core, closer, err := newJournalSink(mustParseURL(t, "journald://"+path), zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = closer.Close() }()
+
+	big := make([]byte, 1024*1024)
+	for i := range big {
+		big[i] = 'x'
+	}
+
+	if err := core.Write(zapcore.Entry{Message: string(big)}, nil); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	oob := make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, oobn, _, _, err := conn.ReadMsgUnix(nil, oob)
+	if err != nil {
+		t.Fatalf("Unable to read journal message: %v", err)
+	}
+
+	if oobn == 0 {
+		t.Error("Expecting the entry to be passed as a file descriptor")
+	}
+}
+
+func TestJournaldError(t *testing.T) {
+	if _, _, err := newJournalSink(mustParseURL(t, "journald:///nonexistent/journal.sock"), zapcore.InfoLevel); err == nil {
+		t.Error("Got success, expecting error")
+	}
+}
+
+func TestJournalFieldName(t *testing.T) {
+	cases := map[string]string{
+		"user":       "USER",
+		"user.name":  "USER_NAME",
+		"__internal": "INTERNAL",
+		"2fa":        "F_2FA",
+		"!!!":        "F_",
+	}
+
+	for key, expected := range cases {
+		if n := journalFieldName(key); n != expected {
+			t.Errorf("Got '%s' for '%s', expecting '%s'", n, key, expected)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap/zapcore"
+)
+
+// Kafka output
+//
+// Entries are produced to a Kafka topic when OutputPaths contains kafka://broker1,broker2/topic,
+// the brokers' port defaulting to 9092. Entries are JSON-encoded and keyed by scope, so all the
+// entries of a scope land on the same partition and keep their relative order. These query
+// parameters are supported:
+//
+//		acks          the acknowledgements required from the brokers: none, local (the default), or all
+//		flush         how often to send batches of entries, 500ms by default
+//		batch         the number of entries which triggers sending a batch early, disabled by default
+//		compression   the compression of batches: none (the default), gzip, snappy, or lz4
+//
+// Failures to deliver entries are reported on stderr, at most once per kafkaErrorInterval. Entries
+// are dropped once the input buffer of the producer is full, such as while the brokers can't be
+// reached, and counted by the istio_log_sink_dropped_entries_total metric.
+
+const (
+	kafkaDefaultPort   = "9092"
+	kafkaDefaultFlush  = 500 * time.Millisecond
+	kafkaErrorInterval = 10 * time.Second
+)
+
+var kafkaAcks = map[string]sarama.RequiredAcks{
+	"none":  sarama.NoResponse,
+	"local": sarama.WaitForLocal,
+	"all":   sarama.WaitForAll,
+}
+
+var kafkaCompression = map[string]sarama.CompressionCodec{
+	"none":   sarama.CompressionNone,
+	"gzip":   sarama.CompressionGZIP,
+	"snappy": sarama.CompressionSnappy,
+	"lz4":    sarama.CompressionLZ4,
+}
+
+// Creates the producers, replaced by tests.
+var newKafkaProducer = sarama.NewAsyncProducer
+
+// kafkaErrorKey rate-limits the reporting of delivery failures.
+type kafkaErrorKey string
+
+func init() {
+	RegisterSink("kafka", newKafkaSink)
+}
+
+var (
+	errKafkaClosed     = errors.New("kafka sink closed, entry dropped")
+	errKafkaBufferFull = errors.New("kafka buffer full, entry dropped")
+)
+
+// kafkaProducer guards a producer against entries written after it was closed, which can happen when
+// loggers obtained before a reconfiguration are still in use.
+type kafkaProducer struct {
+	mu       sync.RWMutex
+	closed   bool
+	producer sarama.AsyncProducer
+	dropped  prometheus.Counter
+
+	// the status of the output, if tracked
+	stats atomic.Value // *sinkStats
+}
+
+// send hands an entry over to the producer, without blocking.
+func (p *kafkaProducer) send(msg *sarama.ProducerMessage) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return errKafkaClosed
+	}
+
+	select {
+	case p.producer.Input() <- msg:
+		return nil
+	default:
+		p.dropped.Inc()
+		return errKafkaBufferFull
+	}
+}
+
+func (p *kafkaProducer) reportStatus(s *sinkStats) {
+	s.background = true
+	p.stats.Store(s)
+}
+
+func (p *kafkaProducer) status() *sinkStats {
+	s, _ := p.stats.Load().(*sinkStats)
+	return s
+}
+
+// watch tracks the deliveries of the producer in the status of the output until the producer is
+// closed, and reports failures on stderr, at most once per kafkaErrorInterval. This can't go
+// through the logger itself.
+func (p *kafkaProducer) watch(dest string) {
+	errs, successes := p.producer.Errors(), p.producer.Successes()
+	for errs != nil || successes != nil {
+		select {
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			p.status().failed(err)
+			if limits.every(kafkaErrorKey(dest), kafkaErrorInterval, now()) {
+				reportError("unable to produce log entries to kafka at %s: %v", dest, err)
+			}
+
+		case msg, ok := <-successes:
+			if !ok {
+				successes = nil
+				continue
+			}
+
+			p.status().wrote(msg.Value.Length())
+			p.status().recovered()
+		}
+	}
+}
+
+// Close flushes the entries sent so far and closes the producer.
+func (p *kafkaProducer) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	return p.producer.Close()
+}
+
+// kafkaCore outputs entries to a Kafka topic.
+type kafkaCore struct {
+	zapcore.LevelEnabler
+
+	enc      zapcore.Encoder
+	producer *kafkaProducer
+	topic    string
+}
+
+func newKafkaSink(u *url.URL, enab zapcore.LevelEnabler) (zapcore.Core, io.Closer, error) {
+	var brokers []string
+	for _, b := range strings.Split(u.Host, ",") {
+		if b == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(b); err != nil {
+			b = net.JoinHostPort(b, kafkaDefaultPort)
+		}
+		brokers = append(brokers, b)
+	}
+
+	if len(brokers) == 0 {
+		return nil, nil, fmt.Errorf("missing kafka brokers in %s", u)
+	}
+
+	topic := strings.Trim(u.Path, "/")
+	if topic == "" {
+		return nil, nil, fmt.Errorf("missing kafka topic in %s", u)
+	}
+
+	config, err := newKafkaConfig(u.Query())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	producer, err := newKafkaProducer(brokers, config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create kafka producer for %s: %v", u, err)
+	}
+
+	p := &kafkaProducer{producer: producer, dropped: sinkDroppedEntriesTotal.WithLabelValues("kafka://" + u.Host + "/" + topic)}
+	go p.watch(u.Host + "/" + topic)
+
+	return &kafkaCore{
+		LevelEnabler: enab,
+		enc:          newJSONEncoder(sinkEncoder),
+		producer:     p,
+		topic:        topic,
+	}, p, nil
+}
+
+func newKafkaConfig(q url.Values) (*sarama.Config, error) {
+	config := sarama.NewConfig()
+	config.ClientID = "istio"
+	config.Producer.Partitioner = sarama.NewHashPartitioner
+	config.Producer.Return.Errors = true
+	config.Producer.Return.Successes = true
+	config.Producer.Flush.Frequency = kafkaDefaultFlush
+
+	if a := q.Get("acks"); a != "" {
+		acks, ok := kafkaAcks[a]
+		if !ok {
+			return nil, fmt.Errorf("invalid kafka acks setting %s", a)
+		}
+		config.Producer.RequiredAcks = acks
+	}
+
+	if f := q.Get("flush"); f != "" {
+		d, err := time.ParseDuration(f)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid kafka flush frequency %s", f)
+		}
+		config.Producer.Flush.Frequency = d
+	}
+
+	if b := q.Get("batch"); b != "" {
+		n, err := strconv.Atoi(b)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid kafka batch size %s", b)
+		}
+		config.Producer.Flush.Messages = n
+	}
+
+	if c := q.Get("compression"); c != "" {
+		codec, ok := kafkaCompression[c]
+		if !ok {
+			return nil, fmt.Errorf("invalid kafka compression %s", c)
+		}
+		config.Producer.Compression = codec
+	}
+
+	return config, config.Validate()
+}
+
+func (c *kafkaCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.enc = c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(clone.enc)
+	}
+	return &clone
+}
+
+func (c *kafkaCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *kafkaCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	value := append([]byte(nil), bytes.TrimRight(buf.Bytes(), "\n")...)
+	buf.Free()
+
+	return c.producer.send(&sarama.ProducerMessage{
+		Topic: c.topic,
+		Key:   sarama.StringEncoder(scopeOf(ent)),
+		Value: sarama.ByteEncoder(value),
+	})
+}
+
+// Sync is a no-op, the producer sends entries according to its flush settings.
+func (c *kafkaCore) Sync() error {
+	return nil
+}
@@ -0,0 +1,244 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// observedProducer passes on the messages produced to the test as well as to the sink.
+type observedProducer struct {
+	sarama.AsyncProducer
+	successes chan *sarama.ProducerMessage
+	observed  chan *sarama.ProducerMessage
+}
+
+func newObservedProducer(p sarama.AsyncProducer) *observedProducer {
+	o := &observedProducer{
+		AsyncProducer: p,
+		successes:     make(chan *sarama.ProducerMessage, 10),
+		observed:      make(chan *sarama.ProducerMessage, 10),
+	}
+
+	go func() {
+		for msg := range p.Successes() {
+			o.observed <- msg
+			o.successes <- msg
+		}
+		close(o.successes)
+	}()
+	return o
+}
+
+func (o *observedProducer) Successes() <-chan *sarama.ProducerMessage {
+	return o.successes
+}
+
+func TestKafka(t *testing.T) {
+	var op *observedProducer
+	var brokers []string
+	var config *sarama.Config
+
+	newKafkaProducer = func(b []string, c *sarama.Config) (sarama.AsyncProducer, error) {
+		brokers, config = b, c
+		mp := mocks.NewAsyncProducer(t, c)
+		mp.ExpectInputAndSucceed()
+		mp.ExpectInputAndSucceed()
+		op = newObservedProducer(mp)
+		return op, nil
+	}
+	defer func() { newKafkaProducer = sarama.NewAsyncProducer }()
+
+	core, closer, err := newKafkaSink(mustParseURL(t, "kafka://broker1,broker2:9093/mixer-logs?acks=all&flush=1s&batch=10&compression=gzip"), zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	expected := []string{"broker1:9092", "broker2:9093"}
+	if !reflect.DeepEqual(brokers, expected) {
+		t.Errorf("Got brokers %v, expecting %v", brokers, expected)
+	}
+
+	if config.Producer.RequiredAcks != sarama.WaitForAll ||
+		config.Producer.Flush.Frequency != time.Second ||
+		config.Producer.Flush.Messages != 10 ||
+		config.Producer.Compression != sarama.CompressionGZIP {
+		t.Errorf("Got unexpected producer config %+v", config.Producer)
+	}
+
+	l := zap.New(core).With(zap.String("instance", "a"))
+	l.Info("Hello", zap.Int("count", 3))
+	l.Named("adapters").Warn("World")
+	l.Debug("Not output")
+
+	for _, c := range []struct {
+		key string
+		pat string
+	}{
+		{"default", `^{"level":"info","time":".*","msg":"Hello","log_schema":2,"instance":"a","count":3}$`},
+		{"adapters", `^{"level":"warn","time":".*","logger":"adapters","msg":"World","log_schema":2,"instance":"a"}$`},
+	} {
+		select {
+		case msg := <-op.observed:
+			key, _ := msg.Key.Encode()
+			value, _ := msg.Value.Encode()
+			if msg.Topic != "mixer-logs" || string(key) != c.key {
+				t.Errorf("Got topic %s and key %s, expecting mixer-logs and %s", msg.Topic, key, c.key)
+			}
+			if match, _ := regexp.Match(c.pat, value); !match {
+				t.Errorf("Got '%s', expecting to match '%s'", value, c.pat)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for kafka message")
+		}
+	}
+
+	if err := closer.Close(); err != nil {
+		t.Errorf("Got err '%v', expecting success", err)
+	}
+
+	if err := core.Write(zapcore.Entry{Message: "Late"}, nil); err != errKafkaClosed {
+		t.Errorf("Got err '%v', expecting %v", err, errKafkaClosed)
+	}
+}
+
+// stalledProducer is a producer whose brokers can't be reached, which never takes entries.
+type stalledProducer struct {
+	sarama.AsyncProducer
+	input  chan *sarama.ProducerMessage
+	errors chan *sarama.ProducerError
+}
+
+func (p *stalledProducer) Input() chan<- *sarama.ProducerMessage {
+	return p.input
+}
+
+func (p *stalledProducer) Errors() <-chan *sarama.ProducerError {
+	return p.errors
+}
+
+func (p *stalledProducer) Successes() <-chan *sarama.ProducerMessage {
+	return nil
+}
+
+func (p *stalledProducer) Close() error {
+	close(p.errors)
+	return nil
+}
+
+func TestKafkaBufferFull(t *testing.T) {
+	newKafkaProducer = func(b []string, c *sarama.Config) (sarama.AsyncProducer, error) {
+		return &stalledProducer{input: make(chan *sarama.ProducerMessage), errors: make(chan *sarama.ProducerError)}, nil
+	}
+	defer func() { newKafkaProducer = sarama.NewAsyncProducer }()
+
+	core, closer, err := newKafkaSink(mustParseURL(t, "kafka://broker1/mixer-logs"), zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	var m dto.Metric
+	dropped := sinkDroppedEntriesTotal.WithLabelValues("kafka://broker1/mixer-logs")
+	_ = dropped.Write(&m)
+	before := m.GetCounter().GetValue()
+
+	// the entry is dropped rather than holding up the caller
+	if err := core.Write(zapcore.Entry{Message: "Hello"}, nil); err != errKafkaBufferFull {
+		t.Errorf("Got err '%v', expecting %v", err, errKafkaBufferFull)
+	}
+
+	_ = dropped.Write(&m)
+	if got := m.GetCounter().GetValue() - before; got != 1 {
+		t.Errorf("Got %v dropped entries, expecting 1", got)
+	}
+
+	if err := closer.Close(); err != nil {
+		t.Errorf("Got err '%v', expecting success", err)
+	}
+}
+
+func TestKafkaStatus(t *testing.T) {
+	newKafkaProducer = func(b []string, c *sarama.Config) (sarama.AsyncProducer, error) {
+		mp := mocks.NewAsyncProducer(t, c)
+		mp.ExpectInputAndFail(errors.New("leader not available"))
+		mp.ExpectInputAndSucceed()
+		return mp, nil
+	}
+	defer func() { newKafkaProducer = sarama.NewAsyncProducer }()
+
+	core, closer, err := newKafkaSink(mustParseURL(t, "kafka://broker1/mixer-logs"), zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = closer.Close() }()
+
+	stats := &sinkStats{}
+	closer.(statusReporter).reportStatus(stats)
+
+	waitForStatus := func(desc string, cond func(SinkHealth) bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond(stats.status()) {
+			if time.Now().After(deadline) {
+				t.Fatalf("Got %+v, expecting %s", stats.status(), desc)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	_ = core.Write(zapcore.Entry{Message: "Hello"}, nil)
+	waitForStatus("a failing output", func(s SinkHealth) bool { return s.Failing && s.Errors == 1 })
+
+	// the output recovers once an entry is delivered
+	_ = core.Write(zapcore.Entry{Message: "World"}, nil)
+	waitForStatus("the output to have recovered", func(s SinkHealth) bool { return !s.Failing && s.Bytes > 0 })
+}
+
+func TestKafkaErrors(t *testing.T) {
+	cases := []string{
+		"kafka:///topic",
+		"kafka://broker",
+		"kafka://broker/topic?acks=some",
+		"kafka://broker/topic?flush=soon",
+		"kafka://broker/topic?batch=-1",
+		"kafka://broker/topic?compression=zip",
+	}
+
+	for _, c := range cases {
+		t.Run(c, func(t *testing.T) {
+			if _, _, err := newKafkaSink(mustParseURL(t, c), zapcore.InfoLevel); err == nil {
+				t.Error("Got success, expecting error")
+			}
+		})
+	}
+
+	newKafkaProducer = func([]string, *sarama.Config) (sarama.AsyncProducer, error) {
+		return nil, errors.New("no brokers")
+	}
+	defer func() { newKafkaProducer = sarama.NewAsyncProducer }()
+
+	if _, _, err := newKafkaSink(mustParseURL(t, "kafka://broker/topic"), zapcore.InfoLevel); err == nil {
+		t.Error("Got success, expecting error")
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Labeled outputs entries like the package-level functions, with the labels given to WithLabels
+// added to each of them.
+type Labeled struct {
+	logger *zap.Logger
+	sugar  *zap.SugaredLogger
+}
+
+// WithLabels returns a handle outputting entries like the package-level functions, with the given
+// labels added to each of them, so that request handlers can bind a few labels once and keep using
+// the familiar functions. The labels are pairs of keys and values, as taken by Infow, or fields.
+// Like the loggers returned by With, the handle outputs to the outputs set up when it was created.
+//
+//		l := log.WithLabels("method", r.Method, "path", r.URL.Path)
+//		l.Infof("Handled the request in %v", time.Since(start))
+func WithLabels(keysAndValues ...interface{}) *Labeled {
+	return newLabeled(currentSugar().With(keysAndValues...))
+}
+
+func newLabeled(s *zap.SugaredLogger) *Labeled {
+	return &Labeled{logger: s.Desugar(), sugar: s}
+}
+
+// WithLabels returns a handle adding the given labels to those of this one.
+func (l *Labeled) WithLabels(keysAndValues ...interface{}) *Labeled {
+	return newLabeled(l.sugar.With(keysAndValues...))
+}
+
+// enabled returns whether the handle outputs entries at the given level.
+func (l *Labeled) enabled(level zapcore.Level) bool {
+	return scopeEnabled(defaultScopeName, level) && l.logger.Core().Enabled(level)
+}
+
+// Debug outputs a message at debug level.
+func (l *Labeled) Debug(msg string, fields ...zapcore.Field) {
+	l.logger.Debug(msg, fields...)
+}
+
+// Debuga uses fmt.Sprint to construct and log a message at debug level.
+func (l *Labeled) Debuga(args ...interface{}) {
+	if l.enabled(zapcore.DebugLevel) {
+		l.sugar.Debug(args...)
+	}
+}
+
+// Debugf uses fmt.Sprintf to construct and log a message at debug level.
+func (l *Labeled) Debugf(template string, args ...interface{}) {
+	if l.enabled(zapcore.DebugLevel) {
+		l.sugar.Debugf(template, args...)
+	}
+}
+
+// Debugw logs a message at debug level with some additional context.
+func (l *Labeled) Debugw(msg string, keysAndValues ...interface{}) {
+	if l.enabled(zapcore.DebugLevel) {
+		l.sugar.Debugw(msg, keysAndValues...)
+	}
+}
+
+// DebugEnabled returns whether output of messages at the debug level is currently enabled.
+func (l *Labeled) DebugEnabled() bool {
+	return l.enabled(zapcore.DebugLevel)
+}
+
+// Info outputs a message at info level.
+func (l *Labeled) Info(msg string, fields ...zapcore.Field) {
+	l.logger.Info(msg, fields...)
+}
+
+// Infoa uses fmt.Sprint to construct and log a message at info level.
+func (l *Labeled) Infoa(args ...interface{}) {
+	if l.enabled(zapcore.InfoLevel) {
+		l.sugar.Info(args...)
+	}
+}
+
+// Infof uses fmt.Sprintf to construct and log a message at info level.
+func (l *Labeled) Infof(template string, args ...interface{}) {
+	if l.enabled(zapcore.InfoLevel) {
+		l.sugar.Infof(template, args...)
+	}
+}
+
+// Infow logs a message at info level with some additional context.
+func (l *Labeled) Infow(msg string, keysAndValues ...interface{}) {
+	if l.enabled(zapcore.InfoLevel) {
+		l.sugar.Infow(msg, keysAndValues...)
+	}
+}
+
+// InfoEnabled returns whether output of messages at the info level is currently enabled.
+func (l *Labeled) InfoEnabled() bool {
+	return l.enabled(zapcore.InfoLevel)
+}
+
+// Warn outputs a message at warn level.
+func (l *Labeled) Warn(msg string, fields ...zapcore.Field) {
+	l.logger.Warn(msg, fields...)
+}
+
+// Warna uses fmt.Sprint to construct and log a message at warn level.
+func (l *Labeled) Warna(args ...interface{}) {
+	if l.enabled(zapcore.WarnLevel) {
+		l.sugar.Warn(args...)
+	}
+}
+
+// Warnf uses fmt.Sprintf to construct and log a message at warn level.
+func (l *Labeled) Warnf(template string, args ...interface{}) {
+	if l.enabled(zapcore.WarnLevel) {
+		l.sugar.Warnf(template, args...)
+	}
+}
+
+// Warnw logs a message at warn level with some additional context.
+func (l *Labeled) Warnw(msg string, keysAndValues ...interface{}) {
+	if l.enabled(zapcore.WarnLevel) {
+		l.sugar.Warnw(msg, keysAndValues...)
+	}
+}
+
+// WarnEnabled returns whether output of messages at the warn level is currently enabled.
+func (l *Labeled) WarnEnabled() bool {
+	return l.enabled(zapcore.WarnLevel)
+}
+
+// Error outputs a message at error level.
+func (l *Labeled) Error(msg string, fields ...zapcore.Field) {
+	l.logger.Error(msg, fields...)
+}
+
+// Errora uses fmt.Sprint to construct and log a message at error level.
+func (l *Labeled) Errora(args ...interface{}) {
+	if l.enabled(zapcore.ErrorLevel) {
+		l.sugar.Error(args...)
+	}
+}
+
+// Errorf uses fmt.Sprintf to construct and log a message at error level.
+func (l *Labeled) Errorf(template string, args ...interface{}) {
+	if l.enabled(zapcore.ErrorLevel) {
+		l.sugar.Errorf(template, args...)
+	}
+}
+
+// Errorw logs a message at error level with some additional context.
+func (l *Labeled) Errorw(msg string, keysAndValues ...interface{}) {
+	if l.enabled(zapcore.ErrorLevel) {
+		l.sugar.Errorw(msg, keysAndValues...)
+	}
+}
+
+// ErrorEnabled returns whether output of messages at the error level is currently enabled.
+func (l *Labeled) ErrorEnabled() bool {
+	return l.enabled(zapcore.ErrorLevel)
+}
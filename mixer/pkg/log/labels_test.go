@@ -0,0 +1,73 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestWithLabels(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.IncludeCallerSourceLocation = true
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer configureWithoutOutput(t)
+
+	l := WithLabels("method", "GET", String("path", "/"))
+	_, _, line, _ := runtime.Caller(0)
+	l.Info("Handled")
+	l.Warnf("Handled in %dms", 1500)
+	l.WithLabels("status", 503).Errorw("Failed", "attempt", 2)
+	l.Debuga("Not output")
+
+	expected := fmt.Sprintf(`{"level":"info","caller":"log/labels_test.go:%d","msg":"Handled","method":"GET","path":"/"}`+"\n"+
+		`{"level":"warn","caller":"log/labels_test.go:%d","msg":"Handled in 1500ms","method":"GET","path":"/"}`+"\n"+
+		`{"level":"error","caller":"log/labels_test.go:%d","msg":"Failed","method":"GET","path":"/","status":503,"attempt":2}`+"\n",
+		line+1, line+2, line+3)
+	if buf.String() != expected {
+		t.Errorf("Got\n%s\nexpecting\n%s", buf, expected)
+	}
+}
+
+func TestLabeledEnabled(t *testing.T) {
+	core, _ := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+
+	configureWithoutOutput(t)
+	l := WithLabels("method", "GET")
+
+	if l.DebugEnabled() || !l.InfoEnabled() || !l.WarnEnabled() || !l.ErrorEnabled() {
+		t.Error("Got the wrong levels enabled, expecting those of the package-level functions")
+	}
+
+	if err := SetScopeOutputLevel(defaultScopeName, zapcore.ErrorLevel); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer ResetScopeOutputLevel(defaultScopeName)
+
+	if l.WarnEnabled() || !l.ErrorEnabled() {
+		t.Error("Got the wrong levels enabled, expecting the level of the default scope")
+	}
+}
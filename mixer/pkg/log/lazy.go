@@ -0,0 +1,91 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// lazyValue is the value of a field computed when the entry is output.
+type lazyValue struct {
+	fn func() interface{}
+}
+
+// String is used by the cores other than those set up by Configure, such as those of loggers
+// passed to SetLogger, which output the value as a string.
+func (v *lazyValue) String() string {
+	return fmt.Sprint(v.fn())
+}
+
+// Lazy constructs a field whose value is computed by calling fn only once the entry is known to be
+// output, so that expensive values such as marshaled protos cost nothing in the entries discarded
+// because of their level, filtering or sampling. The value is then output like with Any. Values
+// of fields attached with With are computed right away.
+//
+// fn is called by the goroutine logging the entry, so it may refer to data modified afterwards.
+func Lazy(key string, fn func() interface{}) zapcore.Field {
+	return zapcore.Field{Key: key, Type: zapcore.StringerType, Interface: &lazyValue{fn}}
+}
+
+// resolveLazy returns the given fields with the values of the lazy ones computed. The input slice
+// is left untouched.
+func resolveLazy(fields []zapcore.Field) []zapcore.Field {
+	for i, fld := range fields {
+		if _, ok := fld.Interface.(*lazyValue); !ok {
+			continue
+		}
+
+		// found one to compute, switch over to building a new slice
+		result := make([]zapcore.Field, len(fields))
+		copy(result, fields[:i])
+		for j := i; j < len(fields); j++ {
+			result[j] = fields[j]
+			if v, ok := fields[j].Interface.(*lazyValue); ok {
+				result[j] = zap.Any(fields[j].Key, v.fn())
+			}
+		}
+
+		return result
+	}
+
+	return fields
+}
+
+// lazyCore computes the values of lazy fields before handing entries to the wrapped core.
+type lazyCore struct {
+	zapcore.Core
+}
+
+func newLazyCore(core zapcore.Core) zapcore.Core {
+	return &lazyCore{core}
+}
+
+func (c *lazyCore) With(fields []zapcore.Field) zapcore.Core {
+	return &lazyCore{c.Core.With(resolveLazy(fields))}
+}
+
+func (c *lazyCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *lazyCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(ent, resolveLazy(fields))
+}
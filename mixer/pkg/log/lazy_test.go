@@ -0,0 +1,72 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLazy(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.MessageFilters = []string{"exclude=Filtered"}
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer configureWithoutOutput(t)
+
+	calls := 0
+	bag := Lazy("bag", func() interface{} {
+		calls++
+		return map[string]int{"a": 1}
+	})
+
+	// nothing is computed for the entries discarded
+	Debug("Not output", bag)
+	Info("Filtered", bag)
+	if calls != 0 {
+		t.Errorf("Got %d calls, expecting none", calls)
+	}
+
+	Info("Hello", bag, String("user", "bob"))
+	With(Lazy("count", func() interface{} { return 3 })).Warn("World")
+
+	expected := `{"level":"info","msg":"Hello","bag":{"a":1},"user":"bob"}` + "\n" +
+		`{"level":"warn","msg":"World","count":3}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Got\n%s\nexpecting\n%s", buf, expected)
+	}
+	if calls != 1 {
+		t.Errorf("Got %d calls, expecting 1", calls)
+	}
+}
+
+func TestLazyOtherCores(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+
+	// cores outside of the configured log output the value as a string
+	zap.New(core).Info("Hello", Lazy("count", func() interface{} { return 3 }))
+
+	if s := buf.String(); s != `{"level":"info","msg":"Hello","count":"3"}`+"\n" {
+		t.Errorf("Got '%s', expecting the value as a string", s)
+	}
+}
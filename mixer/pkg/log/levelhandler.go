@@ -0,0 +1,137 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// ScopeLevels are the levels of a scope, as served by LevelsHandler.
+type ScopeLevels struct {
+	// Scope is the name of the scope, default for the default scope.
+	Scope string `json:"scope"`
+
+	// OutputLevel is the minimum output level of the scope.
+	OutputLevel Level `json:"outputLevel"`
+
+	// StackTraceLevel is the level from which the entries of the scope include a stack trace.
+	StackTraceLevel Level `json:"stackTraceLevel"`
+}
+
+// Levels returns the levels of the default scope, followed by those of the scopes with levels of
+// their own, by name.
+func Levels() []ScopeLevels {
+	scopes := make(map[string]bool)
+	for s := range scopeLevels.Load().(map[string]zapcore.Level) {
+		scopes[s] = true
+	}
+	for s := range scopeStackTraceLevels.Load().(map[string]zapcore.Level) {
+		scopes[s] = true
+	}
+
+	names := make([]string, 0, len(scopes))
+	for s := range scopes {
+		names = append(names, s)
+	}
+	sort.Strings(names)
+
+	levels := make([]ScopeLevels, 0, len(names)+1)
+	levels = append(levels, ScopeLevels{defaultScopeName, Level(GetOutputLevel()), Level(GetStackTraceLevel())})
+	for _, s := range names {
+		levels = append(levels, ScopeLevels{s, Level(GetScopeOutputLevel(s)), Level(GetScopeStackTraceLevel(s))})
+	}
+	return levels
+}
+
+// LevelsHandler returns an HTTP handler serving and changing the levels of the scopes, for mounting
+// on an admin endpoint, which the logctl package talks to.
+//
+//		mux.Handle("/debug/log/levels", log.LevelsHandler())
+//
+// GET responds with the levels returned by Levels, in JSON. PUT sets the levels of the scope given
+// by the scope parameter, the default scope when left out, to the levels given by the level and
+// stacktrace parameters, either of which can be left out. DELETE makes the given scope use the
+// levels of the default scope again. PUT and DELETE respond with the levels in effect afterwards.
+func LevelsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope := r.FormValue("scope")
+		if scope == defaultScopeName {
+			scope = ""
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			if err := putLevels(scope, r.FormValue("level"), r.FormValue("stacktrace")); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		case http.MethodDelete:
+			if scope == "" {
+				http.Error(w, "the levels of the default scope can't be reset", http.StatusBadRequest)
+				return
+			}
+			ResetScopeOutputLevel(scope)
+			ResetScopeStackTraceLevel(scope)
+		default:
+			w.Header().Set("Allow", "GET, PUT, DELETE")
+			http.Error(w, "unsupported method: "+r.Method, http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(Levels())
+	})
+}
+
+// putLevels sets the levels of the given scope, or of the default scope when empty, to the given
+// levels, leaving those which are empty alone. Nothing is changed when either is unknown.
+func putLevels(scope, level, stackTraceLevel string) error {
+	var output, stack Level
+	var err error
+	if level != "" {
+		if output, err = ParseLevel(level); err != nil {
+			return err
+		}
+	}
+	if stackTraceLevel != "" {
+		if stack, err = ParseLevel(stackTraceLevel); err != nil {
+			return err
+		}
+	}
+
+	if level != "" {
+		if scope == "" {
+			err = SetOutputLevel(zapcore.Level(output))
+		} else {
+			err = SetScopeOutputLevel(scope, zapcore.Level(output))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if stackTraceLevel != "" {
+		if scope == "" {
+			err = SetStackTraceLevel(zapcore.Level(stack))
+		} else {
+			err = SetScopeStackTraceLevel(scope, zapcore.Level(stack))
+		}
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func serveLevels(t *testing.T, method, target string) ([]ScopeLevels, int) {
+	rec := httptest.NewRecorder()
+	LevelsHandler().ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	if rec.Code != http.StatusOK {
+		return nil, rec.Code
+	}
+
+	var levels []ScopeLevels
+	if err := json.Unmarshal(rec.Body.Bytes(), &levels); err != nil {
+		t.Fatalf("Unable to decode '%s': %v", rec.Body, err)
+	}
+	return levels, rec.Code
+}
+
+func TestLevelsHandler(t *testing.T) {
+	configureWithoutOutput(t)
+	defer configureWithoutOutput(t)
+	_ = SetOutputLevel(zapcore.InfoLevel)
+
+	levels, _ := serveLevels(t, "GET", "/debug/log/levels")
+	expected := []ScopeLevels{{"default", Level(zapcore.InfoLevel), Level(None)}}
+	if !reflect.DeepEqual(levels, expected) {
+		t.Errorf("Got %+v, expecting %+v", levels, expected)
+	}
+
+	levels, _ = serveLevels(t, "PUT", "/debug/log/levels?scope=adapters&level=debug&stacktrace=error")
+	expected = append(expected, ScopeLevels{"adapters", Level(zapcore.DebugLevel), Level(zapcore.ErrorLevel)})
+	if !reflect.DeepEqual(levels, expected) {
+		t.Errorf("Got %+v, expecting %+v", levels, expected)
+	}
+	if l := GetScopeOutputLevel("adapters"); l != zapcore.DebugLevel {
+		t.Errorf("Got %v, expecting the level of the scope set", l)
+	}
+
+	levels, _ = serveLevels(t, "PUT", "/debug/log/levels?scope=default&level=warn")
+	expected[0].OutputLevel = Level(zapcore.WarnLevel)
+	if !reflect.DeepEqual(levels, expected) {
+		t.Errorf("Got %+v, expecting %+v", levels, expected)
+	}
+
+	levels, _ = serveLevels(t, "DELETE", "/debug/log/levels?scope=adapters")
+	expected = expected[:1]
+	if !reflect.DeepEqual(levels, expected) {
+		t.Errorf("Got %+v, expecting %+v", levels, expected)
+	}
+
+	cases := []struct {
+		method string
+		target string
+		code   int
+	}{
+		{"PUT", "/debug/log/levels?scope=adapters&level=verbose", http.StatusBadRequest},
+		{"PUT", "/debug/log/levels?scope=adapters&level=debug&stacktrace=all", http.StatusBadRequest},
+		{"DELETE", "/debug/log/levels", http.StatusBadRequest},
+		{"POST", "/debug/log/levels", http.StatusMethodNotAllowed},
+	}
+	for _, c := range cases {
+		if _, code := serveLevels(t, c.method, c.target); code != c.code {
+			t.Errorf("Got %d for %s %s, expecting %d", code, c.method, c.target, c.code)
+		}
+	}
+
+	// nothing is changed by a request with an unknown level
+	if l := GetScopeOutputLevel("adapters"); l != zapcore.WarnLevel {
+		t.Errorf("Got %v, expecting the level of the default scope", l)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// The level overrides in effect, holding a *levelOverrides, or nil when there are none.
+var currentLevelOverrides atomic.Value
+
+func init() {
+	currentLevelOverrides.Store((*levelOverrides)(nil))
+}
+
+// levelOverride sets the output level of the code of the source files matching a pattern.
+type levelOverride struct {
+	pattern string
+	level   zapcore.Level
+}
+
+// levelOverrides are the output levels of the code of some source files, which take precedence
+// over the levels of the scopes of their entries.
+type levelOverrides struct {
+	overrides []levelOverride
+
+	// the lowest of the levels
+	lowest zapcore.Level
+
+	// the levels of the source files already matched, by path, as *callerLevel
+	files sync.Map
+}
+
+// callerLevel is the level of a source file, if overridden.
+type callerLevel struct {
+	level zapcore.Level
+	ok    bool
+}
+
+// parseLevelOverrides parses overrides of the form <pattern>=<level>, where pattern is matched
+// against the paths of the source files trimmed as by the trimmed caller encoding. It returns nil
+// when there are none.
+func parseLevelOverrides(specs []string) (*levelOverrides, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	o := &levelOverrides{lowest: None}
+	for _, spec := range specs {
+		eq := strings.LastIndex(spec, "=")
+		if eq <= 0 {
+			return nil, fmt.Errorf("invalid level override '%s', expecting <pattern>=<level>", spec)
+		}
+
+		pattern, name := spec[:eq], spec[eq+1:]
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern of level override '%s': %v", spec, err)
+		}
+		level, ok := stringToLevel[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown level of level override '%s': %s", spec, name)
+		}
+
+		o.overrides = append(o.overrides, levelOverride{pattern, level})
+		if level < o.lowest {
+			o.lowest = level
+		}
+	}
+	return o, nil
+}
+
+// setLevelOverrides puts the given level overrides in effect.
+func setLevelOverrides(o *levelOverrides) {
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+
+	currentLevelOverrides.Store(o)
+	updateLowestLevel()
+}
+
+// levelOf returns the level of the given source file, set by the first override matching it.
+func (o *levelOverrides) levelOf(file string) (zapcore.Level, bool) {
+	if cl, ok := o.files.Load(file); ok {
+		return cl.(*callerLevel).level, cl.(*callerLevel).ok
+	}
+
+	cl := &callerLevel{}
+	trimmed := trimCallerPath(file)
+	for _, ov := range o.overrides {
+		if match, _ := path.Match(ov.pattern, trimmed); match {
+			cl.level, cl.ok = ov.level, true
+			break
+		}
+	}
+
+	o.files.Store(file, cl)
+	return cl.level, cl.ok
+}
+
+// overriddenLevel returns the level overriding that of the scope of the entry being logged, set for
+// the source file of the code logging it.
+func overriddenLevel() (zapcore.Level, bool) {
+	o := currentLevelOverrides.Load().(*levelOverrides)
+	if o == nil {
+		return 0, false
+	}
+
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !isInternalFrame(frame.Function) {
+			return o.levelOf(frame.File)
+		}
+		if !more {
+			return 0, false
+		}
+	}
+}
+
+// overridesEnable returns whether the level overrides may have the code of some source files
+// output entries at the given level.
+func overridesEnable(level zapcore.Level) bool {
+	o := currentLevelOverrides.Load().(*levelOverrides)
+	return o != nil && level >= o.lowest
+}
@@ -0,0 +1,94 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLevelOverrides(t *testing.T) {
+	cases := []struct {
+		overrides []string
+		expected  string
+	}{
+		// the code of this package is left out when looking for the code logging, so the tests
+		// themselves are run by that of the testing package
+		{nil, "Dispatching,Unable to dispatch"},
+		{[]string{"testing/*.go=debug"}, "Resolved 3 attributes,Dispatching,Unable to dispatch"},
+		{[]string{"mixer/pkg/runtime/*.go=debug", "testing/testing.go=error"}, "Unable to dispatch"},
+		{[]string{"testing/*.go=info", "testing/*.go=debug"}, "Dispatching,Unable to dispatch"},
+	}
+
+	for _, c := range cases {
+		core, buf := newCollectingCore(zapcore.DebugLevel)
+		restore := AddCore(core)
+
+		o := NewOptions()
+		o.OutputPaths = nil
+		o.AuditOutputPaths = nil
+		o.LevelOverrides = c.overrides
+		if err := Configure(o); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		Debugf("Resolved %d attributes", 3)
+		Named("dispatcher").Info("Dispatching")
+		Error("Unable to dispatch")
+		restore()
+
+		var messages []string
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			messages = append(messages, line[strings.Index(line, `"msg":"`)+7:len(line)-2])
+		}
+		if got := strings.Join(messages, ","); got != c.expected {
+			t.Errorf("Got %s, expecting %s for %v", got, c.expected, c.overrides)
+		}
+	}
+	configureWithoutOutput(t)
+
+	if overridesEnable(zapcore.DebugLevel) {
+		t.Error("Got overrides, expecting them dropped by Configure")
+	}
+}
+
+func TestParseLevelOverrides(t *testing.T) {
+	o, err := parseLevelOverrides([]string{"mixer/pkg/runtime/*.go=debug", "mixer/pkg/api/grpcServer.go=error"})
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	if o.lowest != zapcore.DebugLevel || len(o.overrides) != 2 {
+		t.Errorf("Got %+v, expecting the overrides parsed", o)
+	}
+
+	if level, ok := o.levelOf("/go/src/istio.io/istio/mixer/pkg/runtime/dispatcher.go"); !ok || level != zapcore.DebugLevel {
+		t.Errorf("Got %v and %v, expecting the file of the package overridden", level, ok)
+	}
+	if _, ok := o.levelOf("/go/src/istio.io/istio/mixer/pkg/runtime/config/store.go"); ok {
+		t.Error("Got an override, expecting the files of the packages below left alone")
+	}
+
+	if o, err := parseLevelOverrides(nil); o != nil || err != nil {
+		t.Errorf("Got %v and err '%v', expecting no overrides", o, err)
+	}
+
+	for _, spec := range []string{"debug", "=debug", "mixer/pkg/[runtime=debug", "mixer/pkg/runtime/*.go=loud"} {
+		if _, err := parseLevelOverrides([]string{spec}); err == nil {
+			t.Errorf("Got success, expecting an error for %s", spec)
+		}
+	}
+}
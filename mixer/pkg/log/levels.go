@@ -0,0 +1,379 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// The output levels in effect. The outputs accept entries at the lowest level any scope is set to,
+// and scopeLevelCore holds each entry to the level of its scope before it reaches them.
+var (
+	// the level of the scopes without one of their own
+	outputLevel = zap.NewAtomicLevel()
+
+	// the level the outputs are built with
+	lowestLevel = zap.NewAtomicLevel()
+
+	// Serializes changes to the levels.
+	levelsMu sync.Mutex
+
+	// the levels of individual scopes
+	scopeLevels atomic.Value // map[string]zapcore.Level
+
+	// the LevelEnabler of the options, deciding in place of the levels above when set
+	currentLevelEnabler atomic.Value // levelEnablerSetting
+)
+
+// levelEnablerSetting holds a LevelEnabler, which can be nil, so that it can be stored in an
+// atomic.Value whatever its type.
+type levelEnablerSetting struct {
+	enabler zapcore.LevelEnabler
+}
+
+// The stack trace levels in effect, which stackTraceCore applies.
+var (
+	// the level from which the entries of the scopes without one of their own include a stack trace
+	currentStackTraceLevel = zap.NewAtomicLevelAt(None)
+
+	// the stack trace levels of individual scopes
+	scopeStackTraceLevels atomic.Value // map[string]zapcore.Level
+)
+
+func init() {
+	scopeLevels.Store(map[string]zapcore.Level{})
+	scopeStackTraceLevels.Store(map[string]zapcore.Level{})
+	currentLevelEnabler.Store(levelEnablerSetting{})
+}
+
+// SetOutputLevel changes the minimum output level of the scopes without a level of their own,
+// taking effect right away.
+//
+// The level can be one of zapcore.DebugLevel, zapcore.InfoLevel, zapcore.WarnLevel,
+// zapcore.ErrorLevel, or None. Configure resets it to the level of the options. It has no effect
+// while the log is configured with the None level, as no outputs are open then.
+func SetOutputLevel(level zapcore.Level) error {
+	if _, ok := levelToString[level]; !ok {
+		return fmt.Errorf("unknown output level: %v", level)
+	}
+
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+
+	outputLevel.SetLevel(level)
+	updateLowestLevel()
+	return nil
+}
+
+// GetOutputLevel returns the minimum output level of the scopes without a level of their own.
+func GetOutputLevel() zapcore.Level {
+	return outputLevel.Level()
+}
+
+// SetScopeOutputLevel changes the minimum output level of the given scope, taking effect right
+// away. Scopes are the names of the loggers; the entries of unnamed loggers belong to the default
+// scope.
+//
+// The level can be more or less verbose than that of the other scopes. Configure resets the levels
+// of all the scopes.
+func SetScopeOutputLevel(scope string, level zapcore.Level) error {
+	if _, ok := levelToString[level]; !ok {
+		return fmt.Errorf("unknown output level for %s: %v", scope, level)
+	}
+
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+
+	current := scopeLevels.Load().(map[string]zapcore.Level)
+	updated := make(map[string]zapcore.Level, len(current)+1)
+	for s, l := range current {
+		updated[s] = l
+	}
+	updated[scope] = level
+
+	scopeLevels.Store(updated)
+	updateLowestLevel()
+	return nil
+}
+
+// GetScopeOutputLevel returns the minimum output level of the given scope, which is the output
+// level unless the scope has a level of its own.
+func GetScopeOutputLevel(scope string) zapcore.Level {
+	if l, ok := scopeLevels.Load().(map[string]zapcore.Level)[scope]; ok {
+		return l
+	}
+	return outputLevel.Level()
+}
+
+// ResetScopeOutputLevel makes the given scope use the output level again.
+func ResetScopeOutputLevel(scope string) {
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+
+	current := scopeLevels.Load().(map[string]zapcore.Level)
+	updated := make(map[string]zapcore.Level, len(current))
+	for s, l := range current {
+		if s != scope {
+			updated[s] = l
+		}
+	}
+
+	scopeLevels.Store(updated)
+	updateLowestLevel()
+}
+
+// SetStackTraceLevel changes the minimum level from which the entries of the scopes without a
+// stack trace level of their own include a stack trace, taking effect right away. This allows
+// stack traces to be captured while chasing a problem, and turned off again afterwards.
+//
+// The level can be one of zapcore.DebugLevel, zapcore.InfoLevel, zapcore.WarnLevel,
+// zapcore.ErrorLevel, or None to turn stack traces off. Configure resets it to the stack trace
+// level of the options.
+func SetStackTraceLevel(level zapcore.Level) error {
+	if _, ok := levelToString[level]; !ok {
+		return fmt.Errorf("unknown stack trace level: %v", level)
+	}
+
+	currentStackTraceLevel.SetLevel(level)
+	return nil
+}
+
+// GetStackTraceLevel returns the minimum level from which the entries of the scopes without a
+// stack trace level of their own include a stack trace.
+func GetStackTraceLevel() zapcore.Level {
+	return currentStackTraceLevel.Level()
+}
+
+// SetScopeStackTraceLevel changes the minimum level from which the entries of the given scope
+// include a stack trace, taking effect right away, so that stack traces can be captured for the
+// subsystem under investigation only. Configure resets the stack trace levels of all the scopes.
+func SetScopeStackTraceLevel(scope string, level zapcore.Level) error {
+	if _, ok := levelToString[level]; !ok {
+		return fmt.Errorf("unknown stack trace level for %s: %v", scope, level)
+	}
+
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+
+	current := scopeStackTraceLevels.Load().(map[string]zapcore.Level)
+	updated := make(map[string]zapcore.Level, len(current)+1)
+	for s, l := range current {
+		updated[s] = l
+	}
+	updated[scope] = level
+
+	scopeStackTraceLevels.Store(updated)
+	return nil
+}
+
+// GetScopeStackTraceLevel returns the minimum level from which the entries of the given scope
+// include a stack trace, which is the stack trace level unless the scope has a level of its own.
+func GetScopeStackTraceLevel(scope string) zapcore.Level {
+	if l, ok := scopeStackTraceLevels.Load().(map[string]zapcore.Level)[scope]; ok {
+		return l
+	}
+	return currentStackTraceLevel.Level()
+}
+
+// ResetScopeStackTraceLevel makes the given scope use the stack trace level again.
+func ResetScopeStackTraceLevel(scope string) {
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+
+	current := scopeStackTraceLevels.Load().(map[string]zapcore.Level)
+	updated := make(map[string]zapcore.Level, len(current))
+	for s, l := range current {
+		if s != scope {
+			updated[s] = l
+		}
+	}
+
+	scopeStackTraceLevels.Store(updated)
+}
+
+// resetLevels sets the output and stack trace levels and the verbosity, and drops the levels of
+// individual scopes, except for the given stack trace levels.
+func resetLevels(level zapcore.Level, stackTraceLevel zapcore.Level, scopeStackTraces map[string]zapcore.Level, verbosity int) {
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+
+	if scopeStackTraces == nil {
+		scopeStackTraces = map[string]zapcore.Level{}
+	}
+
+	outputLevel.SetLevel(level)
+	currentStackTraceLevel.SetLevel(stackTraceLevel)
+	atomic.StoreInt32(&currentVerbosity, int32(verbosity))
+	scopeLevels.Store(map[string]zapcore.Level{})
+	scopeStackTraceLevels.Store(scopeStackTraces)
+	updateLowestLevel()
+}
+
+// levelSettings are the levels in effect at some point, to be put back later.
+type levelSettings struct {
+	output      zapcore.Level
+	stackTrace  zapcore.Level
+	verbosity   int32
+	scopes      map[string]zapcore.Level
+	stackTraces map[string]zapcore.Level
+}
+
+// saveLevels returns the levels in effect.
+func saveLevels() levelSettings {
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+
+	return levelSettings{
+		output:      outputLevel.Level(),
+		stackTrace:  currentStackTraceLevel.Level(),
+		verbosity:   atomic.LoadInt32(&currentVerbosity),
+		scopes:      scopeLevels.Load().(map[string]zapcore.Level),
+		stackTraces: scopeStackTraceLevels.Load().(map[string]zapcore.Level),
+	}
+}
+
+// restoreLevels puts back the given levels.
+func restoreLevels(s levelSettings) {
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+
+	outputLevel.SetLevel(s.output)
+	currentStackTraceLevel.SetLevel(s.stackTrace)
+	atomic.StoreInt32(&currentVerbosity, s.verbosity)
+	scopeLevels.Store(s.scopes)
+	scopeStackTraceLevels.Store(s.stackTraces)
+	updateLowestLevel()
+}
+
+// setLevelEnabler has the given LevelEnabler decide which entries are output, in place of the
+// output levels, or puts the output levels back in effect when nil.
+func setLevelEnabler(e zapcore.LevelEnabler) {
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+
+	currentLevelEnabler.Store(levelEnablerSetting{e})
+	updateLowestLevel()
+}
+
+// updateLowestLevel sets the level of the outputs to the lowest of the levels in effect, or lets
+// everything through to them for a LevelEnabler or the sampling of debug entries to decide.
+// Callers hold levelsMu.
+func updateLowestLevel() {
+	if currentLevelEnabler.Load().(levelEnablerSetting).enabler != nil || debugSampling() {
+		lowestLevel.SetLevel(zapcore.DebugLevel)
+		return
+	}
+
+	lowest := outputLevel.Level()
+	for _, l := range scopeLevels.Load().(map[string]zapcore.Level) {
+		if l < lowest {
+			lowest = l
+		}
+	}
+	if o := currentLevelOverrides.Load().(*levelOverrides); o != nil && o.lowest < lowest {
+		lowest = o.lowest
+	}
+	lowestLevel.SetLevel(lowest)
+}
+
+// scopeEnabled returns whether the given scope outputs entries at the given level, which the
+// LevelEnabler of the options decides for all the scopes when set.
+func scopeEnabled(scope string, level zapcore.Level) bool {
+	if e := currentLevelEnabler.Load().(levelEnablerSetting).enabler; e != nil {
+		return e.Enabled(level)
+	}
+	return level >= GetScopeOutputLevel(scope)
+}
+
+// scopeLevelCore discards the entries below the level of their scope before they reach the
+// wrapped core, or below the level overriding it for the source file of the code logging them.
+// The entries of the loggers of the requests sampled for debugging are let through at every level,
+// unless their scope is off.
+type scopeLevelCore struct {
+	zapcore.Core
+	debugSampled bool
+}
+
+func newScopeLevelCore(core zapcore.Core) zapcore.Core {
+	return &scopeLevelCore{Core: core}
+}
+
+func (c *scopeLevelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &scopeLevelCore{
+		Core:         c.Core.With(fields),
+		debugSampled: c.debugSampled || hasDebugSampledField(fields),
+	}
+}
+
+func (c *scopeLevelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if level, ok := overriddenLevel(); ok {
+		if ent.Level < level {
+			return ce
+		}
+	} else if scope := scopeOf(ent); !scopeEnabled(scope, ent.Level) && !c.sampled(scope) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// sampled returns whether the entries of the given scope are let through as those of a request
+// sampled for debugging.
+func (c *scopeLevelCore) sampled(scope string) bool {
+	return c.debugSampled && debugSampling() && GetScopeOutputLevel(scope) != None
+}
+
+// stackTraceCore adds a stack trace to the entries at or above the stack trace level of their
+// scope, once the wrapped core has accepted them. Handed an entry which other cores ahead of it
+// accepted already, it can't tell whether the wrapped core accepts it as well, and leaves the
+// stack trace out.
+type stackTraceCore struct {
+	zapcore.Core
+}
+
+func newStackTraceCore(core zapcore.Core) zapcore.Core {
+	return &stackTraceCore{core}
+}
+
+func (c *stackTraceCore) With(fields []zapcore.Field) zapcore.Core {
+	return &stackTraceCore{c.Core.With(fields)}
+}
+
+func (c *stackTraceCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	// the wrapped core added itself if it returned another checked entry than the one given
+	checked := c.Core.Check(ent, ce)
+	if checked != ce && checked.Entry.Stack == "" && ent.Level >= GetScopeStackTraceLevel(scopeOf(ent)) {
+		checked.Entry.Stack = takeStack()
+	}
+	return checked
+}
+
+// takeStack returns the stack trace of the calling goroutine, formatted like zap does, from the
+// first call outside zap and this package.
+func takeStack() string {
+	stack := zap.Stack("").String
+	lines := strings.Split(stack, "\n")
+
+	i := 0
+	for i+2 < len(lines) && isInternalFrame(lines[i]) {
+		i += 2
+	}
+	return strings.Join(lines[i:], "\n")
+}
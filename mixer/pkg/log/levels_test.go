@@ -0,0 +1,296 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSetOutputLevel(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	configureWithoutOutput(t)
+	defer configureWithoutOutput(t)
+
+	Debug("One")
+	if err := SetOutputLevel(zapcore.DebugLevel); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	if l := GetOutputLevel(); l != zapcore.DebugLevel {
+		t.Errorf("Got %v, expecting debug", l)
+	}
+	if !DebugEnabled() {
+		t.Error("Got debug disabled, expecting it enabled")
+	}
+	Debug("Two")
+
+	if err := SetOutputLevel(zapcore.ErrorLevel); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	Warn("Three")
+	Error("Four")
+
+	// reconfiguring restores the level of the options
+	configureWithoutOutput(t)
+	if l := GetOutputLevel(); l != zapcore.InfoLevel {
+		t.Errorf("Got %v, expecting info", l)
+	}
+	Info("Five")
+
+	expected := `{"level":"debug","msg":"Two"}` + "\n" +
+		`{"level":"error","msg":"Four"}` + "\n" +
+		`{"level":"info","msg":"Five"}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Got\n%s\nexpecting\n%s", buf, expected)
+	}
+
+	if err := SetOutputLevel(zapcore.Level(42)); err == nil {
+		t.Error("Got success, expecting error")
+	}
+}
+
+func TestLevelEnabler(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	defer configureWithoutOutput(t)
+
+	// let debug messages through while the window is open
+	var open atomic.Value
+	open.Store(true)
+
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.LevelEnabler = zap.LevelEnablerFunc(func(level zapcore.Level) bool {
+		return level >= zapcore.WarnLevel || open.Load().(bool)
+	})
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	if !DebugEnabled() {
+		t.Error("Got debug disabled, expecting it enabled")
+	}
+	Debug("One")
+	Named("dispatcher").Debug("Two")
+
+	// the levels of the scopes have no say
+	open.Store(false)
+	if err := SetScopeOutputLevel("dispatcher", zapcore.DebugLevel); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	Named("dispatcher").Info("Three")
+	Warn("Four")
+
+	// reconfiguring without it puts the levels back in effect
+	configureWithoutOutput(t)
+	Info("Five")
+	Debug("Six")
+
+	expected := `{"level":"debug","msg":"One"}` + "\n" +
+		`{"level":"debug","logger":"dispatcher","msg":"Two"}` + "\n" +
+		`{"level":"warn","msg":"Four"}` + "\n" +
+		`{"level":"info","msg":"Five"}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Got\n%s\nexpecting\n%s", buf, expected)
+	}
+}
+
+func TestSetScopeOutputLevel(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	configureWithoutOutput(t)
+	defer configureWithoutOutput(t)
+
+	if err := SetScopeOutputLevel("dispatcher", zapcore.DebugLevel); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	if err := SetScopeOutputLevel("default", zapcore.WarnLevel); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	dispatcher := zap.L().Named("dispatcher")
+	adapters := zap.L().Named("adapters")
+
+	dispatcher.Debug("One")
+	adapters.Debug("Not output")
+	adapters.Info("Two")
+	Info("Not output")
+	Warn("Three")
+
+	if InfoEnabled() {
+		t.Error("Got info enabled, expecting it disabled for the default scope")
+	}
+
+	if l := GetScopeOutputLevel("dispatcher"); l != zapcore.DebugLevel {
+		t.Errorf("Got %v, expecting debug", l)
+	}
+	if l := GetScopeOutputLevel("adapters"); l != zapcore.InfoLevel {
+		t.Errorf("Got %v, expecting the output level", l)
+	}
+
+	// the scope follows the output level again once reset
+	ResetScopeOutputLevel("dispatcher")
+	dispatcher.Debug("Not output")
+	dispatcher.Info("Four")
+
+	expected := `{"level":"debug","logger":"dispatcher","msg":"One"}` + "\n" +
+		`{"level":"info","logger":"adapters","msg":"Two"}` + "\n" +
+		`{"level":"warn","msg":"Three"}` + "\n" +
+		`{"level":"info","logger":"dispatcher","msg":"Four"}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Got\n%s\nexpecting\n%s", buf, expected)
+	}
+
+	// reconfiguring drops the levels of the scopes
+	_ = SetScopeOutputLevel("dispatcher", zapcore.ErrorLevel)
+	configureWithoutOutput(t)
+	if l := GetScopeOutputLevel("dispatcher"); l != zapcore.InfoLevel {
+		t.Errorf("Got %v, expecting the output level", l)
+	}
+
+	if err := SetScopeOutputLevel("dispatcher", zapcore.Level(42)); err == nil {
+		t.Error("Got success, expecting error")
+	}
+}
+
+func TestSetOutputLevelMinLevel(t *testing.T) {
+	lines, err := captureStdout(func() {
+		o := NewOptions()
+		o.OutputPaths = nil
+		o.Outputs = []OutputSpec{{Path: "stdout", MinLevel: "info"}}
+		if err := Configure(o); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		// the outputs don't go below their own level
+		_ = SetOutputLevel(zapcore.DebugLevel)
+		Debug("One")
+		Info("Two")
+		Sync()
+	})
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "\tinfo\tTwo") {
+		t.Errorf("Got '%v', expecting the info entry only", lines)
+	}
+}
+
+func TestSetStackTraceLevel(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	configureWithoutOutput(t)
+	defer configureWithoutOutput(t)
+
+	Warn("One")
+	if err := SetStackTraceLevel(zapcore.WarnLevel); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	if l := GetStackTraceLevel(); l != zapcore.WarnLevel {
+		t.Errorf("Got %v, expecting warn", l)
+	}
+	Info("Two")
+	Warn("Three")
+
+	if err := SetStackTraceLevel(None); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	Warn("Four")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Got '%v', expecting 4 entries", lines)
+	}
+	for i, line := range lines {
+		if stack := strings.Contains(line, `"stack":`); stack != (i == 2) {
+			t.Errorf("Got '%s', expecting a stack trace only for Three", line)
+		}
+	}
+
+	// reconfiguring restores the level of the options
+	_ = SetStackTraceLevel(zapcore.DebugLevel)
+	configureWithoutOutput(t)
+	if l := GetStackTraceLevel(); l != None {
+		t.Errorf("Got %v, expecting none", l)
+	}
+
+	if err := SetStackTraceLevel(zapcore.Level(42)); err == nil {
+		t.Error("Got success, expecting error")
+	}
+}
+
+func TestScopeStackTraceLevel(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.stackTraceLevel = "default:none,dispatcher:warn"
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer configureWithoutOutput(t)
+
+	if l := GetScopeStackTraceLevel("dispatcher"); l != zapcore.WarnLevel {
+		t.Errorf("Got %v, expecting the level of the options", l)
+	}
+
+	Error("One")
+	Named("dispatcher").Info("Two")
+	Named("dispatcher").Warn("Three")
+	Named("api").Error("Four")
+
+	if err := SetScopeStackTraceLevel("api", zapcore.ErrorLevel); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	Named("api").Error("Five")
+
+	ResetScopeStackTraceLevel("dispatcher")
+	Named("dispatcher").Error("Six")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("Got '%v', expecting 6 entries", lines)
+	}
+	for i, line := range lines {
+		if stack := strings.Contains(line, `"stack":`); stack != (i == 2 || i == 4) {
+			t.Errorf("Got '%s', expecting a stack trace only for Three and Five", line)
+		}
+	}
+
+	// the stack trace starts with the code logging the entry
+	if !strings.Contains(lines[2], `"stack":"testing.tRunner`) {
+		t.Errorf("Got '%s', expecting the frames of the log to be left out", lines[2])
+	}
+
+	if err := SetScopeStackTraceLevel("api", zapcore.Level(42)); err == nil {
+		t.Error("Got success, expecting error")
+	}
+
+	// reconfiguring restores the levels of the options
+	_ = SetScopeStackTraceLevel("api", zapcore.DebugLevel)
+	configureWithoutOutput(t)
+	if l := GetScopeStackTraceLevel("api"); l != None {
+		t.Errorf("Got %v, expecting none", l)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// limiter decides whether repeated log calls, identified by a key, should be output.
+type limiter struct {
+	mu     sync.Mutex
+	last   map[interface{}]time.Time
+	counts map[interface{}]uint64
+}
+
+func newLimiter() *limiter {
+	return &limiter{
+		last:   make(map[interface{}]time.Time),
+		counts: make(map[interface{}]uint64),
+	}
+}
+
+// The limiter shared by all the throttled logging functions.
+var limits = newLimiter()
+
+// every returns true if the key hasn't been allowed through during the last interval.
+func (l *limiter) every(key interface{}, interval time.Duration, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if last, ok := l.last[key]; ok && now.Sub(last) < interval {
+		return false
+	}
+
+	l.last[key] = now
+	return true
+}
+
+// everyN returns true for the first call with the given key and for every Nth call after that.
+func (l *limiter) everyN(key interface{}, n int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c := l.counts[key]
+	l.counts[key] = c + 1
+
+	return n <= 1 || c%uint64(n) == 0
+}
+
+// once returns true only the first time it is called with the given key.
+func (l *limiter) once(key interface{}) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.counts[key]; ok {
+		return false
+	}
+
+	l.counts[key] = 1
+	return true
+}
+
+// callSite identifies the code calling one of the package's throttled logging functions.
+type callSite uintptr
+
+func callerOf() callSite {
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+	return callSite(pcs[0])
+}
+
+// onceKey keeps user-supplied keys from colliding with call sites.
+type onceKey string
+
+// ErrorfThrottled uses fmt.Sprintf to construct and log a message at error level, unless a
+// message was already output from the same call site during the given interval.
+func ErrorfThrottled(interval time.Duration, template string, args ...interface{}) {
+	if enabled(zap.ErrorLevel) && limits.every(callerOf(), interval, now()) {
+		currentSugar().Errorf(template, args...)
+	}
+}
+
+// WarnEveryN outputs a message at warn level the first time it is called from a given call
+// site and every Nth time after that.
+func WarnEveryN(n int, msg string, fields ...zapcore.Field) {
+	if enabled(zap.WarnLevel) && limits.everyN(callerOf(), n) {
+		currentLogger().Warn(msg, fields...)
+	}
+}
+
+// InfoOnce outputs a message at info level only the first time it is called with the given key.
+func InfoOnce(key string, msg string, fields ...zapcore.Field) {
+	if enabled(zap.InfoLevel) && limits.once(onceKey(key)) {
+		currentLogger().Info(msg, fields...)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter()
+	now := time.Unix(1000, 0)
+
+	if !l.every("a", time.Second, now) {
+		t.Errorf("Got false, expecting the first call to be allowed")
+	}
+
+	if l.every("a", time.Second, now.Add(500*time.Millisecond)) {
+		t.Errorf("Got true, expecting a call within the interval to be suppressed")
+	}
+
+	if !l.every("b", time.Second, now.Add(500*time.Millisecond)) {
+		t.Errorf("Got false, expecting a different key to be allowed")
+	}
+
+	if !l.every("a", time.Second, now.Add(time.Second)) {
+		t.Errorf("Got false, expecting a call after the interval to be allowed")
+	}
+
+	var allowed []int
+	for i := 0; i < 10; i++ {
+		if l.everyN("c", 4) {
+			allowed = append(allowed, i)
+		}
+	}
+
+	if len(allowed) != 3 || allowed[0] != 0 || allowed[1] != 4 || allowed[2] != 8 {
+		t.Errorf("Got %v, expecting [0 4 8]", allowed)
+	}
+
+	if !l.once("d") {
+		t.Errorf("Got false, expecting the first call to be allowed")
+	}
+
+	if l.once("d") {
+		t.Errorf("Got true, expecting the second call to be suppressed")
+	}
+}
+
+func TestThrottledFunctions(t *testing.T) {
+	lines, err := captureStdout(func() {
+		o := NewOptions()
+		o.IncludeCallerSourceLocation = true
+		if err := Configure(o); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		for i := 0; i < 5; i++ {
+			ErrorfThrottled(time.Hour, "Throttled %d", i)
+			WarnEveryN(2, "EveryN")
+			InfoOnce("key", "Once")
+		}
+		InfoOnce("key", "Once again")
+		InfoOnce("other", "Other")
+		Sync()
+	})
+
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	patterns := []string{
+		".*Z\terror\tlog/limiter_test.go:.*\tThrottled 0",
+		".*Z\twarn\tlog/limiter_test.go:.*\tEveryN",
+		".*Z\tinfo\tlog/limiter_test.go:.*\tOnce",
+		".*Z\twarn\tlog/limiter_test.go:.*\tEveryN",
+		".*Z\twarn\tlog/limiter_test.go:.*\tEveryN",
+		".*Z\tinfo\tlog/limiter_test.go:.*\tOther",
+		"",
+	}
+
+	if len(lines) != len(patterns) {
+		t.Fatalf("Got %d lines, expecting %d: %v", len(lines), len(patterns), lines)
+	}
+
+	for i, pat := range patterns {
+		if match, _ := regexp.MatchString(pat, lines[i]); !match {
+			t.Errorf("Got '%s', expecting to match '%s'", lines[i], pat)
+		}
+	}
+}
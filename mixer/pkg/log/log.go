@@ -48,230 +48,1162 @@
 //		}
 //
 // Once configured, this package intercepts the output of the standard golang "log" package as well as anything
-// sent to the global zap logger (zap.L()).
+// sent to the global zap logger (zap.L()) and the gRPC logging package, unless Options.CaptureStdLog,
+// Options.ReplaceGlobalZap, or Options.CaptureGRPCLog are turned off.
 package log
 
 import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-	"go.uber.org/zap/zapgrpc"
 	"google.golang.org/grpc/grpclog"
 )
 
-// Global variables against which all our logging occurs.
-var logger *zap.Logger = zap.NewNop()
-var sugar *zap.SugaredLogger = logger.Sugar()
+// loggers are the global loggers against which all our logging occurs. They are replaced as a whole
+// when the log is reconfigured, so logging can carry on from other goroutines meanwhile.
+type loggers struct {
+	// the logger the others are derived from, for use by other packages
+	base *zap.Logger
+
+	// the loggers of the package-level functions
+	logger *zap.Logger
+	sugar  *zap.SugaredLogger
+}
+
+var currentLoggers atomic.Value // *loggers
+
+func init() {
+	setLoggers(zap.NewNop(), zap.NewNop())
+}
+
+func setLoggers(base *zap.Logger, logger *zap.Logger) {
+	currentLoggers.Store(&loggers{base: base, logger: logger, sugar: logger.Sugar()})
+}
+
+func currentLogger() *zap.Logger {
+	return currentLoggers.Load().(*loggers).logger
+}
+
+func currentSugar() *zap.SugaredLogger {
+	return currentLoggers.Load().(*loggers).sugar
+}
+
+// generation holds what a call to Configure set running, which is torn down once the loggers of
+// the next call have taken over.
+type generation struct {
+	// closed to stop the goroutines started, which are tracked by tasks
+	stop  chan struct{}
+	tasks sync.WaitGroup
+
+	// closers for the sinks opened
+	sinks []io.Closer
+
+	// the queue of entries, in asynchronous mode
+	queue *asyncQueue
+
+	// the output of the errors of the log itself, and its closer
+	errorOutput      zapcore.WriteSyncer
+	closeErrorOutput func()
+
+	// the audit stream, which outlives the outputs when they are replaced by SetLogger
+	audit *auditStream
+
+	// the standard streams the outputs and the error output write to, stdout or stderr
+	streams []string
+
+	// closed to stop watching the debug trigger file, ahead of the other goroutines, and closed in
+	// turn once the watcher returned
+	stopDebugTrigger chan struct{}
+	debugTriggerDone chan struct{}
+}
+
+func newGeneration() *generation {
+	return &generation{stop: make(chan struct{})}
+}
+
+// goBackground runs f in a goroutine, which is told to stop by closing the given channel when the
+// generation is torn down. Tearing down then waits for the goroutine to return.
+func (g *generation) goBackground(f func(stop <-chan struct{})) {
+	g.tasks.Add(1)
+	go func() {
+		defer g.tasks.Done()
+		f(g.stop)
+	}()
+}
+
+// watchDebugTrigger watches the debug trigger file at the given path in a goroutine, which is
+// stopped by stopWatchingDebugTrigger.
+func (g *generation) watchDebugTrigger(l *zap.Logger, path string) {
+	g.stopDebugTrigger = make(chan struct{})
+	g.debugTriggerDone = make(chan struct{})
+	go func() {
+		defer close(g.debugTriggerDone)
+		watchDebugTrigger(l, path, g.stopDebugTrigger)
+	}()
+}
+
+// stopWatchingDebugTrigger stops watching the debug trigger file, if watched, and waits for the
+// watcher to return, so that it no longer changes the output level. It is called ahead of resetting
+// the levels for the next generation.
+func (g *generation) stopWatchingDebugTrigger() {
+	if g.stopDebugTrigger != nil {
+		close(g.stopDebugTrigger)
+		<-g.debugTriggerDone
+		g.stopDebugTrigger = nil
+	}
+}
+
+func (g *generation) close() {
+	g.stopWatchingDebugTrigger()
+	close(g.stop)
+	g.tasks.Wait()
+
+	// write out the entries still queued before closing the outputs
+	if g.queue != nil {
+		g.queue.close()
+	}
+
+	closeSinks(g.sinks)
+	if g.audit != nil {
+		g.audit.close()
+	}
+
+	// the sinks report their errors until they are closed
+	if g.closeErrorOutput != nil {
+		g.closeErrorOutput()
+	}
+}
+
+var (
+	// Serializes calls to Configure.
+	configureMu sync.Mutex
+
+	// What the last successful call to Configure set running.
+	activeGeneration = newGeneration()
+)
 
 // Configure initializes Istio's logging subsystem.
 //
 // You typically call this once at process startup.
 // Once this call returns, the logging system is ready to accept data.
+//
+// Configure may be called again to change the settings, including while other goroutines are
+// logging: they switch over to the new settings without any entries getting lost, and the outputs
+// of the previous settings are closed once the entries they still hold are written out. If the new
+// settings can't be applied, the previous ones stay in effect.
 func Configure(options *Options) error {
 	return configure(options, func(c *zap.Config) (*zap.Logger, error) { return c.Build() })
 }
 
 type builder func(c *zap.Config) (*zap.Logger, error)
 
-func configure(options *Options, b builder) error {
-	outputLevel, err := options.GetOutputLevel()
+func newEncoderConfig() zapcore.EncoderConfig {
+	return zapcore.EncoderConfig{
+		TimeKey:        "time",
+		LevelKey:       "level",
+		NameKey:        "logger",
+		CallerKey:      "caller",
+		MessageKey:     "msg",
+		StacktraceKey:  "stack",
+		LineEnding:     zapcore.DefaultLineEnding,
+		EncodeLevel:    zapcore.LowercaseLevelEncoder,
+		EncodeCaller:   zapcore.ShortCallerEncoder,
+		EncodeTime:     zapcore.ISO8601TimeEncoder,
+		EncodeDuration: zapcore.StringDurationEncoder,
+	}
+}
+
+func configure(options *Options, b builder) (err error) {
+	if err = options.Validate(); err != nil {
+		return err
+	}
+
+	// the development mode stands for a combination of the other settings
+	if options.DevelopmentMode {
+		dev := *options
+		dev.UseColoredLevels = true
+		dev.DisableSampling = true
+		options = &dev
+	}
+
+	outputLevel, _ := options.GetOutputLevel()
+	stackTraceLevel, _ := options.GetStackTraceLevel()
+	scopeStackTraceLevels, _ := options.GetScopeStackTraceLevels()
+
+	stdLogLevel := zapcore.InfoLevel
+	if options.StdLogLevel != "" {
+		stdLogLevel = stringToLevel[options.StdLogLevel]
+	}
+
+	mf, err := parseMessageFilter(options.MessageFilters)
+	if err != nil {
+		return err
+	}
+
+	overrides, err := parseLevelOverrides(options.LevelOverrides)
+	if err != nil {
+		return err
+	}
+
+	tlsConfig, err := newTLSConfig(options)
+	if err != nil {
+		return err
+	}
+
+	encoderConfig, err := newOutputEncoderConfig(options)
 	if err != nil {
 		return err
 	}
 
-	stackTraceLevel, err := options.GetStackTraceLevel()
+	identity, err := processFields(options)
 	if err != nil {
 		return err
 	}
 
+	configureMu.Lock()
+	defer configureMu.Unlock()
+
+	// the previous generation keeps running until the new loggers take over, and the new one is
+	// torn down again if they can't be set up
+	gen := newGeneration()
+	gen.streams = outputStreams(options, outputLevel)
+	previousSinkTLS, previousSinkEncoder, previousLogSchema := sinkTLS, sinkEncoder, outputLogSchema
+	previousClock := currentClock.Load().(clockSetting)
+	defer func() {
+		if err != nil {
+			sinkTLS, sinkEncoder, outputLogSchema = previousSinkTLS, previousSinkEncoder, previousLogSchema
+			currentClock.Store(previousClock)
+			gen.close()
+			return
+		}
+
+		currentErrorOutput.Store(errorSink{gen.errorOutput})
+		setTraceSpanEvents(options.TraceSpanEvents)
+		gen.audit.start()
+		activeGeneration.close()
+		activeGeneration = gen
+	}()
+
+	// the outputs are set up with the time of the clock given, and the sinks with their settings,
+	// which are put back if the new loggers can't be set up
+	setClock(options.Clock)
+	sinkTLS = tlsConfig
+	sinkEncoder = encoderConfig
+	setLogSchema(options.LogSchema)
+
+	// the sinks frame the entries their own way
+	sinkEncoder.LineEnding = zapcore.DefaultLineEnding
+
+	// catch unusable output paths ahead of the outputs, which report them obscurely, once the clock
+	// tells the period of the rotated files
+	paths := append(rotationPaths(options.AuditOutputPaths, options.AuditRotationInterval), options.ErrorOutputPaths...)
+	if outputLevel != None {
+		paths = append(paths, rotationPaths(options.OutputPaths, options.RotationInterval)...)
+		for _, o := range options.Outputs {
+			paths = append(paths, rotationPaths([]string{o.Path}, options.RotationInterval)...)
+		}
+		if options.FailoverPath != "" {
+			paths = append(paths, options.FailoverPath)
+		}
+	}
+	fs, err := newFileSettings(options)
+	if err != nil {
+		return err
+	}
+	if err = prepareOutputPaths(paths, fs); err != nil {
+		return err
+	}
+
+	if gen.errorOutput, gen.closeErrorOutput, err = openErrorOutput(options.ErrorOutputPaths); err != nil {
+		return err
+	}
+
+	// the audit stream is independent of the diagnostic output settings, and only replaces the
+	// previous one once the new loggers take over
+	if gen.audit, err = newAuditStream(options, gen.errorOutput, fs); err != nil {
+		return err
+	}
+
 	if outputLevel == None {
 		// stick with the Nop default
-		logger = zap.NewNop()
-		sugar = logger.Sugar()
-		logger = zap.NewNop()
-		sugar = logger.Sugar()
+		setLevelOverrides(nil)
+		setLevelEnabler(nil)
+		activeGeneration.stopWatchingDebugTrigger()
+		resetLevels(None, stackTraceLevel, scopeStackTraceLevels, options.Verbosity)
+		setLoggers(zap.NewNop(), zap.NewNop())
+		currentRecent.Store((*recentBuffer)(nil))
+		currentSinkStats.Store([]*sinkStats(nil))
 		return nil
 	}
 
+	// rotated files are written by cores of the package's own, zap having no notion of rotation or
+	// quotas
+	rs := &rotationSettings{interval: options.RotationInterval, compress: options.RotationCompress, quota: options.DiskQuotaBytes}
+	files, rotated := splitRotatedFiles(options.OutputPaths, rs)
+	files, sinks := splitOutputPaths(files)
+
+	// several output files are written independently of one another, so that one which hangs or
+	// keeps failing doesn't hold up the others
+	var isolated []string
+	if len(files) > 1 {
+		isolated, files = files, nil
+	}
+
 	zapConfig := zap.Config{
-		Level:       zap.NewAtomicLevelAt(outputLevel),
-		Development: false,
-
-		Sampling: &zap.SamplingConfig{
-			Initial:    100,
-			Thereafter: 100,
-		},
-
-		Encoding: "console",
-		EncoderConfig: zapcore.EncoderConfig{
-			TimeKey:        "time",
-			LevelKey:       "level",
-			NameKey:        "logger",
-			CallerKey:      "caller",
-			MessageKey:     "msg",
-			StacktraceKey:  "stack",
-			LineEnding:     zapcore.DefaultLineEnding,
-			EncodeLevel:    zapcore.LowercaseLevelEncoder,
-			EncodeCaller:   zapcore.ShortCallerEncoder,
-			EncodeTime:     zapcore.ISO8601TimeEncoder,
-			EncodeDuration: zapcore.StringDurationEncoder,
-		},
-
-		OutputPaths:       options.OutputPaths,
-		ErrorOutputPaths:  []string{"stderr"},
-		DisableCaller:     !options.IncludeCallerSourceLocation,
-		DisableStacktrace: stackTraceLevel == None,
+		Level:       lowestLevel,
+		Development: options.DevelopmentMode,
+
+		Encoding:      "console",
+		EncoderConfig: encoderConfig,
+
+		OutputPaths:   files,
+		DisableCaller: !options.IncludeCallerSourceLocation,
+
+		// stack traces are added by a stackTraceCore, following the levels of the scopes
+		DisableStacktrace: true,
 	}
 
 	if options.JSONEncoding {
 		zapConfig.Encoding = "json"
 	}
+	if options.Encoding != "" {
+		zapConfig.Encoding = options.Encoding
+	}
+
+	// the outputs to terminals are built a little differently from those to files
+	encoding := indentEncoding(options, zapConfig.Encoding)
+	zapConfig.EncoderConfig.EncodeLevel = levelEncoder(options, encoding, files)
+	zapConfig.Encoding = consoleEncoding(options, encoding, files)
 
 	l, err := b(&zapConfig)
 	if err != nil {
 		return err
 	}
+	l = l.WithOptions(zap.ErrorOutput(gen.errorOutput))
+
+	// the outputs write to the failover output while they keep failing
+	var fallback zapcore.Core
+	if p := options.FailoverPath; p != "" {
+		failoverConfig := zapConfig
+		failoverConfig.OutputPaths = []string{p}
+		failoverConfig.EncoderConfig.EncodeLevel = levelEncoder(options, encoding, failoverConfig.OutputPaths)
+		failoverConfig.Encoding = consoleEncoding(options, encoding, failoverConfig.OutputPaths)
+
+		fl, err := b(&failoverConfig)
+		if err != nil {
+			return err
+		}
+		fallback = fl.Core()
+	}
+
+	// keep track of the health of the outputs, along with that of the writers reporting it
+	var stats []*sinkStats
+	output := func(core zapcore.Core, name string, w io.Closer) zapcore.Core {
+		s := &sinkStats{name: name}
+		if r, ok := w.(statusReporter); ok {
+			r.reportStatus(s)
+		}
+		stats = append(stats, s)
+
+		core = newSinkStatusCore(core, s)
+		if fallback != nil {
+			core = newFailoverCore(core, name, fallback)
+		}
+		return core
+	}
+
+	var cores []zapcore.Core
+	for _, p := range isolated {
+		isolatedConfig := zapConfig
+		isolatedConfig.OutputPaths = []string{p}
+		isolatedConfig.EncoderConfig.EncodeLevel = levelEncoder(options, encoding, isolatedConfig.OutputPaths)
+		isolatedConfig.Encoding = consoleEncoding(options, encoding, isolatedConfig.OutputPaths)
+
+		il, err := b(&isolatedConfig)
+		if err != nil {
+			return err
+		}
+		w := newIsolatedWriter(p, isolationBuffer)
+		gen.sinks = append(gen.sinks, w)
+		cores = append(cores, newIsolatedCore(output(il.Core(), p, w), w))
+	}
+
+	// outputs with their own settings get a core of their own, built like the main one
+	for _, o := range options.Outputs {
+		var core zapcore.Core
+		outputFiles, outputSinks := splitOutputPaths([]string{o.Path})
+		outputFiles, outputRotated := splitRotatedFiles(outputFiles, rs)
+		if len(outputSinks) > 0 {
+			sinkCores, closers, err := newSinkCores(outputSinks, zapConfig.Level)
+			if err != nil {
+				return err
+			}
+			gen.sinks = append(gen.sinks, closers...)
+			core = output(sinkCores[0], sinkName(outputSinks[0]), closers[0])
+		} else {
+			outputEncoding := encoding
+			if o.Encoding != "" {
+				outputEncoding = indentEncoding(options, o.Encoding)
+			}
+
+			outputConfig := zapConfig
+			outputConfig.OutputPaths = outputFiles
+			outputConfig.EncoderConfig.EncodeLevel = levelEncoder(options, outputEncoding, outputFiles)
+			outputConfig.Encoding = consoleEncoding(options, outputEncoding, outputFiles)
+
+			var closer io.Closer
+			if len(outputRotated) > 0 {
+				if core, closer, err = newRotatingCore(o.Path, rs, &outputConfig, fs); err != nil {
+					return err
+				}
+				gen.sinks = append(gen.sinks, closer)
+			} else {
+				ol, err := b(&outputConfig)
+				if err != nil {
+					return err
+				}
+				core = ol.Core()
+			}
+			core = output(core, o.Path, closer)
+		}
+
+		if minLevel, ok := stringToLevel[o.MinLevel]; ok {
+			core = leveledCore{core, minLevel}
+		}
+		if filter := newFieldFilter(o.FieldAllowlist, o.FieldDenylist); filter != nil {
+			core = newFieldFilterCore(core, filter)
+		}
+		cores = append(cores, core)
+	}
+
+	for _, p := range rotated {
+		rotatedConfig := zapConfig
+		rotatedConfig.EncoderConfig.EncodeLevel = levelEncoder(options, encoding, []string{p})
+		rotatedConfig.Encoding = consoleEncoding(options, encoding, []string{p})
+
+		core, closer, err := newRotatingCore(p, rs, &rotatedConfig, fs)
+		if err != nil {
+			return err
+		}
+		gen.sinks = append(gen.sinks, closer)
+		cores = append(cores, output(core, p, closer))
+	}
+
+	// send the output to any sinks alongside the plain output paths
+	if len(sinks) > 0 {
+		sinkCores, closers, err := newSinkCores(sinks, zapConfig.Level)
+		if err != nil {
+			return err
+		}
+		gen.sinks = append(gen.sinks, closers...)
+		for i, core := range sinkCores {
+			cores = append(cores, output(core, sinkName(sinks[i]), closers[i]))
+		}
+	}
+
+	// and to the cores attached with AddCore
+	cores = append(cores, newAddedCoresCore(zapConfig.Level))
+
+	l = l.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		if len(files) == 0 {
+			return zapcore.NewTee(cores...)
+		}
+		return zapcore.NewTee(append([]zapcore.Core{output(c, strings.Join(files, ", "), nil)}, cores...)...)
+	}))
+
+	// keep the stack traces on the lines of their entries, once they reach the outputs
+	if e := options.StackTraceEncoding; e != "" && e != stackMultiline {
+		l = l.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+			return newStackEncodingCore(c, encoderConfig.StacktraceKey, e)
+		}))
+	}
+
+	// hand entries over to a background goroutine, once filtered and redacted
+	if options.Async {
+		size := options.AsyncBufferSize
+		if size == 0 {
+			size = asyncDefaultBuffer
+		}
+
+		policy := options.AsyncDropPolicy
+		if policy == "" {
+			policy = asyncDropNewest
+		}
+
+		// the summary is written right away, rather than risk being dropped as well
+		drops := newDropTally(asyncDroppedEntriesTotal, "as the log queue was full")
+		if interval := options.AsyncDropSummaryInterval; interval > 0 {
+			reportLogger := l
+			gen.goBackground(func(stop <-chan struct{}) {
+				reportDrops(reportLogger, drops, interval, stop)
+			})
+		}
+
+		q := newAsyncQueue(size, policy, drops)
+		gen.queue = q
+		l = l.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+			return newAsyncCore(c, q)
+		}))
+	}
+
+	// drop unwanted fields and scrub sensitive data before they get encoded
+	if filter := newFieldFilter(options.FieldAllowlist, options.FieldDenylist); filter != nil {
+		l = l.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+			return newFieldFilterCore(c, filter)
+		}))
+	}
+	// cut oversized entries down to size, once redacted so the redactors see the whole values
+	if options.MaxMessageBytes > 0 || options.MaxFieldBytes > 0 {
+		l = l.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+			return newTruncatingCore(c, options.MaxMessageBytes, options.MaxFieldBytes)
+		}))
+	}
+	l = l.WithOptions(zap.WrapCore(newRedactingCore))
+
+	// compute lazy fields once the entries are known to be output, and ahead of the redaction
+	l = l.WithOptions(zap.WrapCore(newLazyCore))
+
+	// warn about duplicate keys, while still running on the goroutines logging to find the callers
+	if options.DetectDuplicateKeys {
+		l = l.WithOptions(zap.WrapCore(newDuplicateKeyCore))
+	}
+
+	// tell apart the goroutines logging, while still running on them
+	if options.IncludeGoroutineID {
+		l = l.WithOptions(zap.WrapCore(newGoroutineCore))
+	}
+
+	// stamp the identity of the process onto every entry, within reach of the field filter
+	if len(identity) > 0 {
+		l = l.With(identity...)
+	}
 
-	logger = l.WithOptions(zap.AddCallerSkip(1), zap.AddStacktrace(stackTraceLevel))
-	sugar = logger.Sugar()
+	// keep track of the volume of entries being output, and call the hooks registered
+	l = l.WithOptions(zap.Hooks(countEntry, runHooks))
 
+	// sample the output, keeping track of what gets dropped
+	if !options.DisableSampling {
+		drops := newDropTally(sampledEntriesTotal, "")
+		if interval := options.SamplingSummaryInterval; interval > 0 {
+			reportLogger := l
+			gen.goBackground(func(stop <-chan struct{}) {
+				reportDrops(reportLogger, drops, interval, stop)
+			})
+		}
+
+		var t *throttle
+		if options.SamplingBudget > 0 {
+			t = newThrottle(options.SamplingBudget, time.Second)
+		}
+		samplingFactor.Set(1)
+
+		scopes, err := parseScopeSampling(options.ScopeSampling)
+		if err != nil {
+			return err
+		}
+
+		l = l.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+			return newSampler(c, time.Second, options.SamplingInitial, options.SamplingThereafter, scopes, drops, t)
+		}))
+	}
+
+	// collapse repeated messages
+	if options.DedupWindow > 0 {
+		l = l.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+			return newDedupCore(c, options.DedupWindow)
+		}))
+	}
+
+	// tally the warnings and errors ahead of deduplication and sampling, so that the summaries
+	// account for them all
+	if interval := options.ErrorSummaryInterval; interval > 0 {
+		tally := newErrorTally()
+		reportLogger := l
+		gen.goBackground(func(stop <-chan struct{}) {
+			reportErrorSummaries(reportLogger, tally, interval, stop)
+		})
+
+		l = l.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+			return newErrorSummaryCore(c, tally)
+		}))
+	}
+
+	// filter messages ahead of everything else, so filtered entries don't affect sampling
+	currentMessageFilter.Store(mf)
+	l = l.WithOptions(zap.WrapCore(newMessageFilterCore))
+
+	// and hold entries to the levels of their scopes ahead of that
+	l = l.WithOptions(zap.WrapCore(newScopeLevelCore))
+
+	// capture the stack traces of the entries which made it through
+	l = l.WithOptions(zap.WrapCore(newStackTraceCore))
+
+	// keep the recent entries of every level, whatever the output levels
+	var recent *recentBuffer
+	if n := options.RecentEntries; n > 0 {
+		recent = newRecentBuffer(n, encoderConfig)
+		l = l.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+			return newRecentCore(c, recent)
+		}))
+	}
+	currentRecent.Store(recent)
+	currentSinkStats.Store(stats)
+
+	// and stamp the entries with the time of the clock set, ahead of everything else
+	l = l.WithOptions(zap.WrapCore(newClockCore))
+
+	setLevelOverrides(overrides)
+	setLevelEnabler(options.LevelEnabler)
+	setDebugSamplePercentage(options.DebugSamplePercentage)
+	activeGeneration.stopWatchingDebugTrigger()
+	resetLevels(outputLevel, stackTraceLevel, scopeStackTraceLevels, options.Verbosity)
+	logger := l.WithOptions(zap.AddCallerSkip(1))
+	setLoggers(l, logger)
+
+	// sync the log regularly, rather than rely on the program to
+	if interval := options.FlushInterval; interval > 0 {
+		flushLogger := l
+		gen.goBackground(func(stop <-chan struct{}) {
+			periodicSync(flushLogger, interval, stop)
+		})
+	}
+
+	// turn debug messages on and off with a file, which is at times the only way to change anything
+	// in a running pod
+	if path := options.DebugTriggerPath; path != "" {
+		gen.watchDebugTrigger(l, path)
+	}
+
+	if options.JSONIndent && !isTerminal(os.Stdout) {
+		l.Warn("JSON entries are indented, which is meant for reading them on a terminal rather than for production")
+	}
+
+	currentCapture = captureSettings{
+		stdLog:      options.CaptureStdLog,
+		stdLogScope: options.StdLogScope,
+		stdLogLevel: stdLogLevel,
+		globalZap:   options.ReplaceGlobalZap,
+		grpcLog:     options.CaptureGRPCLog,
+	}
+	captureLogging(l, logger)
+	return nil
+}
+
+// SetLogger makes the package-level functions output to the given logger instead of the outputs
+// set up by Configure, for example so that test harnesses or programs embedding Mixer can collect
+// the entries. Like with Configure, global zap logging and the output of the standard "log" and
+// gRPC logging packages are captured as well. The audit stream is left as is.
+//
+// The entries are output at the levels and with the stack traces of the given logger.
+// SetOutputLevel and SetScopeOutputLevel can restrict the output further. The outputs opened by
+// Configure are closed, once the entries they still hold are written out. Configure can be called
+// again to go back to them.
+func SetLogger(l *zap.Logger) {
+	configureMu.Lock()
+	defer configureMu.Unlock()
+
+	// let everything through to the logger, which applies its own level
+	activeGeneration.stopWatchingDebugTrigger()
+	setLevelOverrides(nil)
+	setLevelEnabler(nil)
+	resetLevels(zapcore.DebugLevel, None, nil, GetVerbosity())
+	l = l.WithOptions(zap.WrapCore(newScopeLevelCore), zap.WrapCore(newClockCore))
+
+	logger := l.WithOptions(zap.AddCallerSkip(1))
+	setLoggers(l, logger)
+	currentRecent.Store((*recentBuffer)(nil))
+	currentSinkStats.Store([]*sinkStats(nil))
+	captureLogging(l, logger)
+
+	// the audit stream is left running
+	gen := newGeneration()
+	gen.audit, activeGeneration.audit = activeGeneration.audit, nil
+	gen.streams = []string{"stderr"}
+
+	currentErrorOutput.Store(errorSink{zapcore.Lock(os.Stderr)})
+	activeGeneration.close()
+	activeGeneration = gen
+}
+
+// ReplaceLogger makes the package-level functions output to the given logger, like SetLogger, until
+// the returned function is called, which puts back the loggers and levels in effect before. This
+// lets tests collect the entries of the code under test for a while. Unlike with SetLogger, the
+// outputs set up by Configure are left open, and other logging keeps being captured by them.
+// Configure and SetLogger shouldn't be called until the loggers are put back.
+func ReplaceLogger(l *zap.Logger) func() {
+	configureMu.Lock()
+	defer configureMu.Unlock()
+
+	previous := currentLoggers.Load().(*loggers)
+	levels := saveLevels()
+
+	// let everything through to the logger, which applies its own level
+	setLevelOverrides(nil)
+	setLevelEnabler(nil)
+	resetLevels(zapcore.DebugLevel, None, nil, GetVerbosity())
+	l = l.WithOptions(zap.WrapCore(newScopeLevelCore), zap.WrapCore(newClockCore))
+	setLoggers(l, l.WithOptions(zap.AddCallerSkip(1)))
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			configureMu.Lock()
+			defer configureMu.Unlock()
+
+			setLoggers(previous.base, previous.logger)
+			restoreLevels(levels)
+		})
+	}
+}
+
+// captureSettings tell which other logging is captured. They are those of the last call to
+// Configure, which SetLogger follows as well.
+type captureSettings struct {
+	// whether to capture the output of the standard "log" package, and the scope and level of the
+	// lines without a level prefix
+	stdLog      bool
+	stdLogScope string
+	stdLogLevel zapcore.Level
+
+	// whether to replace the global zap loggers
+	globalZap bool
+
+	// whether to capture the gRPC logging, which can't be undone
+	grpcLog bool
+}
+
+var (
+	currentCapture = captureSettings{stdLog: true, globalZap: true, grpcLog: true}
+
+	// restore the standard logger to its settings from before it was first redirected, and the
+	// global zap loggers to those from before they were first replaced, nil while they aren't
+	restoreStdLog    func()
+	restoreGlobalZap func()
+)
+
+// captureLogging forces other logging through the given loggers, the second of which is used by
+// the package-level functions, as far as the current capture settings allow.
+func captureLogging(l *zap.Logger, logger *zap.Logger) {
 	// capture global zap logging and force it through our logger
-	_ = zap.ReplaceGlobals(l)
+	if currentCapture.globalZap {
+		restore := zap.ReplaceGlobals(l)
+		if restoreGlobalZap == nil {
+			restoreGlobalZap = restore
+		}
+	} else if restoreGlobalZap != nil {
+		restoreGlobalZap()
+		restoreGlobalZap = nil
+	}
 
 	// capture standard golang "log" package output and force it through our logger
-	_ = zap.RedirectStdLog(logger)
+	if currentCapture.stdLog {
+		restore := redirectStdLog(l, currentCapture.stdLogScope, currentCapture.stdLogLevel)
+		if restoreStdLog == nil {
+			restoreStdLog = restore
+		}
+	} else if restoreStdLog != nil {
+		restoreStdLog()
+		restoreStdLog = nil
+	}
 
 	// capture gRPC logging
-	grpclog.SetLogger(zapgrpc.NewLogger(logger.WithOptions(zap.AddCallerSkip(2))))
+	if currentCapture.grpcLog {
+		currentGRPCLogger.Store(newGRPCLogSettings(logger))
+		if !grpcLogCaptured {
+			grpclog.SetLoggerV2(grpcLogForwarder{})
+			grpcLogCaptured = true
+		}
+	} else {
+		grpcLogCaptured = false
+	}
+}
 
-	return nil
+// whether the logger of gRPC is set to a grpcLogForwarder, since it was last left alone
+var grpcLogCaptured bool
+
+// leveledCore is an output with a minimum level of its own, on top of the output levels. The cores
+// wrapping the outputs write entries to all of them without checking each one, so the level is
+// checked again when writing.
+type leveledCore struct {
+	zapcore.Core
+	min zapcore.Level
+}
+
+func (c leveledCore) Enabled(level zapcore.Level) bool {
+	return level >= c.min && c.Core.Enabled(level)
+}
+
+func (c leveledCore) With(fields []zapcore.Field) zapcore.Core {
+	return leveledCore{c.Core.With(fields), c.min}
+}
+
+func (c leveledCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Enabled(ent.Level) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
+
+func (c leveledCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if !c.Enabled(ent.Level) {
+		return nil
+	}
+	return c.Core.Write(ent, fields)
+}
+
+// checkEncoding verifies that an encoding is one of those supported.
+func checkEncoding(encoding string) error {
+	switch encoding {
+	case "", "console", "json", logfmtEncoding, stackdriverEncoding, ecsEncoding, gelfEncoding, cefEncoding, leefEncoding, protobufEncoding:
+		return nil
+	default:
+		return fmt.Errorf("unknown encoding: %s", encoding)
+	}
+}
+
+// argsPool holds the slices the arguments of the sugared functions are copied to before being handed
+// to the sugared logger. The variadic slices of the callers then don't escape, and cost nothing
+// when the level is disabled.
+var argsPool = sync.Pool{
+	New: func() interface{} {
+		args := make([]interface{}, 0, 8)
+		return &args
+	},
+}
+
+// copyArgs returns a pooled copy of the given arguments, to be released with releaseArgs once
+// logged.
+func copyArgs(args []interface{}) *[]interface{} {
+	a := argsPool.Get().(*[]interface{})
+	*a = append((*a)[:0], args...)
+	return a
+}
+
+// releaseArgs returns the given copy of arguments to the pool, without holding on to them.
+func releaseArgs(a *[]interface{}) {
+	for i := range *a {
+		(*a)[i] = nil
+	}
+	*a = (*a)[:0]
+	argsPool.Put(a)
+}
+
+// enabled returns whether the package-level functions output entries at the given level.
+func enabled(level zapcore.Level) bool {
+	return (scopeEnabled(defaultScopeName, level) || recording() || overridesEnable(level)) && currentLogger().Core().Enabled(level)
 }
 
 // Debug outputs a message at debug level.
 // This call is a wrapper around [Logger.Debug](https://godoc.org/go.uber.org/zap#Logger.Debug)
 func Debug(msg string, fields ...zapcore.Field) {
-	logger.Debug(msg, fields...)
+	currentLogger().Debug(msg, fields...)
 }
 
 // Debuga uses fmt.Sprint to construct and log a message at debug level.
 // This call is a wrapper around [Sugaredlogger.Debug](https://godoc.org/go.uber.org/zap#Sugaredlogger.Debug)
 func Debuga(args ...interface{}) {
-	sugar.Debug(args...)
+	if enabled(zapcore.DebugLevel) {
+		a := copyArgs(args)
+		currentSugar().Debug(*a...)
+		releaseArgs(a)
+	}
 }
 
 // Debugf uses fmt.Sprintf to construct and log a message at debug level.
 // This call is a wrapper around [Sugaredlogger.Debugf](https://godoc.org/go.uber.org/zap#Sugaredlogger.Debugf)
 func Debugf(template string, args ...interface{}) {
-	sugar.Debugf(template, args...)
+	if enabled(zapcore.DebugLevel) {
+		a := copyArgs(args)
+		currentSugar().Debugf(template, *a...)
+		releaseArgs(a)
+	}
 }
 
 // Debugw logs a message at debug level with some additional context.
 // This call is a wrapper around [Sugaredlogger.Debugw](https://godoc.org/go.uber.org/zap#Sugaredlogger.Debugw)
 func Debugw(msg string, keysAndValues ...interface{}) {
-	sugar.Debugw(msg, keysAndValues...)
+	if enabled(zapcore.DebugLevel) {
+		kv := copyArgs(keysAndValues)
+		currentSugar().Debugw(msg, *kv...)
+		releaseArgs(kv)
+	}
 }
 
 // DebugEnabled returns whether output of messages at the debug level is currently enabled.
 func DebugEnabled() bool {
-	return logger.Core().Enabled(zap.DebugLevel)
+	return enabled(zap.DebugLevel)
 }
 
 // Error outputs a message at error level.
 // This call is a wrapper around [logger.Error](https://godoc.org/go.uber.org/zap#logger.Error)
 func Error(msg string, fields ...zapcore.Field) {
-	logger.Error(msg, fields...)
+	currentLogger().Error(msg, fields...)
 }
 
 // Errora uses fmt.Sprint to construct and log a message at error level.
 // This call is a wrapper around [Sugaredlogger.Error](https://godoc.org/go.uber.org/zap#Sugaredlogger.Error)
 func Errora(args ...interface{}) {
-	sugar.Error(args...)
+	if enabled(zapcore.ErrorLevel) {
+		a := copyArgs(args)
+		currentSugar().Error(*a...)
+		releaseArgs(a)
+	}
 }
 
 // Errorf uses fmt.Sprintf to construct and log a message at error level.
 // This call is a wrapper around [Sugaredlogger.Errorf](https://godoc.org/go.uber.org/zap#Sugaredlogger.Errorf)
 func Errorf(template string, args ...interface{}) {
-	sugar.Errorf(template, args...)
+	if enabled(zapcore.ErrorLevel) {
+		a := copyArgs(args)
+		currentSugar().Errorf(template, *a...)
+		releaseArgs(a)
+	}
 }
 
 // Errorw logs a message at error level with some additional context.
 // This call is a wrapper around [Sugaredlogger.Errorw](https://godoc.org/go.uber.org/zap#Sugaredlogger.Errorw)
 func Errorw(msg string, keysAndValues ...interface{}) {
-	sugar.Errorw(msg, keysAndValues...)
+	if enabled(zapcore.ErrorLevel) {
+		kv := copyArgs(keysAndValues)
+		currentSugar().Errorw(msg, *kv...)
+		releaseArgs(kv)
+	}
 }
 
 // ErrorEnabled returns whether output of messages at the error level is currently enabled.
 func ErrorEnabled() bool {
-	return logger.Core().Enabled(zap.ErrorLevel)
+	return enabled(zap.ErrorLevel)
+}
+
+// DPanic outputs a message at dpanic level, which then panics in development mode, as set with the
+// DevelopmentMode option, and behaves like Error otherwise.
+// This call is a wrapper around [logger.DPanic](https://godoc.org/go.uber.org/zap#logger.DPanic)
+func DPanic(msg string, fields ...zapcore.Field) {
+	currentLogger().DPanic(msg, fields...)
+}
+
+// DPanica uses fmt.Sprint to construct and log a message at dpanic level.
+// This call is a wrapper around [Sugaredlogger.DPanic](https://godoc.org/go.uber.org/zap#Sugaredlogger.DPanic)
+func DPanica(args ...interface{}) {
+	currentSugar().DPanic(args...)
+}
+
+// DPanicf uses fmt.Sprintf to construct and log a message at dpanic level.
+// This call is a wrapper around [Sugaredlogger.DPanicf](https://godoc.org/go.uber.org/zap#Sugaredlogger.DPanicf)
+func DPanicf(template string, args ...interface{}) {
+	currentSugar().DPanicf(template, args...)
+}
+
+// DPanicw logs a message at dpanic level with some additional context.
+// This call is a wrapper around [Sugaredlogger.DPanicw](https://godoc.org/go.uber.org/zap#Sugaredlogger.DPanicw)
+func DPanicw(msg string, keysAndValues ...interface{}) {
+	currentSugar().DPanicw(msg, keysAndValues...)
+}
+
+// Panic outputs a message at panic level, then panics, whether or not the message is output.
+// This call is a wrapper around [logger.Panic](https://godoc.org/go.uber.org/zap#logger.Panic)
+func Panic(msg string, fields ...zapcore.Field) {
+	currentLogger().Panic(msg, fields...)
+}
+
+// Panica uses fmt.Sprint to construct and log a message at panic level, then panics.
+// This call is a wrapper around [Sugaredlogger.Panic](https://godoc.org/go.uber.org/zap#Sugaredlogger.Panic)
+func Panica(args ...interface{}) {
+	currentSugar().Panic(args...)
+}
+
+// Panicf uses fmt.Sprintf to construct and log a message at panic level, then panics.
+// This call is a wrapper around [Sugaredlogger.Panicf](https://godoc.org/go.uber.org/zap#Sugaredlogger.Panicf)
+func Panicf(template string, args ...interface{}) {
+	currentSugar().Panicf(template, args...)
+}
+
+// Panicw logs a message at panic level with some additional context, then panics.
+// This call is a wrapper around [Sugaredlogger.Panicw](https://godoc.org/go.uber.org/zap#Sugaredlogger.Panicw)
+func Panicw(msg string, keysAndValues ...interface{}) {
+	currentSugar().Panicw(msg, keysAndValues...)
 }
 
 // Warn outputs a message at warn level.
 // This call is a wrapper around [logger.Warn](https://godoc.org/go.uber.org/zap#logger.Warn)
 func Warn(msg string, fields ...zapcore.Field) {
-	logger.Warn(msg, fields...)
+	currentLogger().Warn(msg, fields...)
 }
 
 // Warna uses fmt.Sprint to construct and log a message at warn level.
 // This call is a wrapper around [Sugaredlogger.Warn](https://godoc.org/go.uber.org/zap#Sugaredlogger.Warn)
 func Warna(args ...interface{}) {
-	sugar.Warn(args...)
+	if enabled(zapcore.WarnLevel) {
+		a := copyArgs(args)
+		currentSugar().Warn(*a...)
+		releaseArgs(a)
+	}
 }
 
 // Warnf uses fmt.Sprintf to construct and log a message at warn level.
 // This call is a wrapper around [Sugaredlogger.Warnf](https://godoc.org/go.uber.org/zap#Sugaredlogger.Warnf)
 func Warnf(template string, args ...interface{}) {
-	sugar.Warnf(template, args...)
+	if enabled(zapcore.WarnLevel) {
+		a := copyArgs(args)
+		currentSugar().Warnf(template, *a...)
+		releaseArgs(a)
+	}
 }
 
 // Warnw logs a message at warn level with some additional context.
 // This call is a wrapper around [Sugaredlogger.Warnw](https://godoc.org/go.uber.org/zap#Sugaredlogger.Warnw)
 func Warnw(msg string, keysAndValues ...interface{}) {
-	sugar.Warnw(msg, keysAndValues...)
+	if enabled(zapcore.WarnLevel) {
+		kv := copyArgs(keysAndValues)
+		currentSugar().Warnw(msg, *kv...)
+		releaseArgs(kv)
+	}
 }
 
 // WarnEnabled returns whether output of messages at the warn level is currently enabled.
 func WarnEnabled() bool {
-	return logger.Core().Enabled(zap.WarnLevel)
+	return enabled(zap.WarnLevel)
 }
 
 // Info outputs a message at information level.
 // This call is a wrapper around [logger.Info](https://godoc.org/go.uber.org/zap#logger.Info)
 func Info(msg string, fields ...zapcore.Field) {
-	logger.Info(msg, fields...)
+	currentLogger().Info(msg, fields...)
 }
 
 // Infoa uses fmt.Sprint to construct and log a message at info level.
 // This call is a wrapper around [Sugaredlogger.Info](https://godoc.org/go.uber.org/zap#Sugaredlogger.Info)
 func Infoa(args ...interface{}) {
-	sugar.Info(args...)
+	if enabled(zapcore.InfoLevel) {
+		a := copyArgs(args)
+		currentSugar().Info(*a...)
+		releaseArgs(a)
+	}
 }
 
 // Infof uses fmt.Sprintf to construct and log a message at info level.
 // This call is a wrapper around [Sugaredlogger.Infof](https://godoc.org/go.uber.org/zap#Sugaredlogger.Infof)
 func Infof(template string, args ...interface{}) {
-	sugar.Infof(template, args...)
+	if enabled(zapcore.InfoLevel) {
+		a := copyArgs(args)
+		currentSugar().Infof(template, *a...)
+		releaseArgs(a)
+	}
 }
 
 // Infow logs a message at info level with some additional context.
 // This call is a wrapper around [Sugaredlogger.Infow](https://godoc.org/go.uber.org/zap#Sugaredlogger.Infow)
 func Infow(msg string, keysAndValues ...interface{}) {
-	sugar.Infow(msg, keysAndValues...)
+	if enabled(zapcore.InfoLevel) {
+		kv := copyArgs(keysAndValues)
+		currentSugar().Infow(msg, *kv...)
+		releaseArgs(kv)
+	}
 }
 
 // InfoEnabled returns whether output of messages at the info level is currently enabled.
 func InfoEnabled() bool {
-	return logger.Core().Enabled(zap.InfoLevel)
+	return enabled(zap.InfoLevel)
 }
 
 // With creates a child logger and adds structured context to it. Fields added
 // to the child don't affect the parent, and vice versa.
 // This call is a wrapper around [logger.With](https://godoc.org/go.uber.org/zap#logger.With)
 func With(fields ...zapcore.Field) *zap.Logger {
-	return logger.With(fields...)
+	return currentLogger().With(fields...)
+}
+
+// Named creates a child logger whose entries are output under the given name, in the "logger" key
+// of the entries. Naming a named logger again joins the names with a period, so the children of
+// Named("adapter") are output as "adapter.prometheus" and so on. The name is also the scope of the
+// entries, as set with SetScopeOutputLevel. The child logger outputs like the loggers returned by
+// Logger.
+//
+//	log.Named("adapter.prometheus").Info("Started the exporter")
+func Named(name string) *zap.Logger {
+	return Logger().Named(name)
+}
+
+// WithCallerSkip returns a logger for packages wrapping this one in helpers of their own, which
+// skips the given number of wrapping functions when reporting the caller, so that the "caller" key
+// of the entries points at the code calling the helpers rather than at the helpers. A helper
+// calling the logger directly skips one function. The logger outputs like the loggers returned by
+// Logger.
+//
+//	func logRequest(msg string) {
+//		log.WithCallerSkip(1).Info(msg, log.String("request", currentRequest))
+//	}
+func WithCallerSkip(skip int) *zap.Logger {
+	return Logger().WithOptions(zap.AddCallerSkip(skip))
+}
+
+// Check returns a checked entry if a message at the given level would be output, or nil otherwise.
+// Writing the entry outputs it with the given fields, so performance-critical code can avoid
+// building fields which would be discarded, at no cost when the level is disabled.
+//
+//	if ce := log.Check(zapcore.DebugLevel, "Dispatching"); ce != nil {
+//		ce.Write(log.Int("count", len(requests)))
+//	}
+//
+// This call is a wrapper around [logger.Check](https://godoc.org/go.uber.org/zap#logger.Check)
+func Check(level zapcore.Level, msg string) *zapcore.CheckedEntry {
+	return currentLogger().Check(level, msg)
+}
+
+// WithError creates a child logger like With, recording the given error as structured fields:
+// its message under "error", its type under "errorType", and under "errorStack" its detailed
+// description when it has one, such as the stack trace of the errors of the
+// github.com/pkg/errors package. The child logger outputs like the loggers returned by Logger.
+//
+//	log.WithError(err).Error("Unable to load the configuration")
+func WithError(err error) *zap.Logger {
+	return Logger().With(errorFields(err)...)
+}
+
+// Logger returns a logger outputting like the package-level functions, from which other packages
+// can derive loggers of their own, for example with Named or WithOptions. The entries of the
+// derived loggers go to the outputs in effect when they are logged, so they follow later calls to
+// Configure.
+func Logger() *zap.Logger {
+	return currentLoggers.Load().(*loggers).base.WithOptions(zap.WrapCore(func(zapcore.Core) zapcore.Core {
+		return newGlobalCore()
+	}))
+}
+
+// Core returns the core through which the package-level functions output entries. Like the
+// loggers returned by Logger, it follows later calls to Configure.
+func Core() zapcore.Core {
+	return newGlobalCore()
 }
 
 // Sync flushes any buffered log entries.
 // Processes should normally take care to call Sync before exiting.
 // This call is a wrapper around [logger.Sync](https://godoc.org/go.uber.org/zap#logger.Sync)
 func Sync() {
-	logger.Sync()
+	currentLogger().Sync()
+}
+
+// SyncWithTimeout flushes any buffered log entries like Sync, giving up after the given duration so
+// that an output which stopped responding can't hold up the process, such as when shutting down.
+// It returns the error reported by the outputs, or an error if the timeout expired.
+func SyncWithTimeout(d time.Duration) error {
+	l := currentLogger()
+	done := make(chan error, 1)
+	go func() {
+		done <- l.Sync()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(d):
+		return fmt.Errorf("timed out syncing the log after %v", d)
+	}
 }
@@ -16,13 +16,20 @@ package log
 
 import (
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -57,20 +64,32 @@ func TestBasic(t *testing.T) {
 		{func() { Errorw("Hello") }, ".*Z\terror\tHello", false, false, None},
 		{func() { Errora("Hello") }, ".*Z\terror\tHello", false, false, None},
 
+		{func() { DPanic("Hello") }, ".*Z\tdpanic\tHello", false, false, None},
+		{func() { DPanicf("Hello") }, ".*Z\tdpanic\tHello", false, false, None},
+		{func() { DPanicw("Hello") }, ".*Z\tdpanic\tHello", false, false, None},
+		{func() { DPanica("Hello") }, ".*Z\tdpanic\tHello", false, false, None},
+
+		{func() { defer recoverPanic(); Panic("Hello") }, ".*Z\tpanic\tHello", false, false, None},
+		{func() { defer recoverPanic(); Panicf("Hello") }, ".*Z\tpanic\tHello", false, false, None},
+		{func() { defer recoverPanic(); Panicw("Hello") }, ".*Z\tpanic\tHello", false, false, None},
+		{func() { defer recoverPanic(); Panica("Hello") }, ".*Z\tpanic\tHello", false, false, None},
+
 		{func() {
 			l := With(zap.String("key", "value"))
 			l.Debug("Hello")
 		}, ".*Z\tdebug\tHello\t{\"key\": \"value\"}", false, false, None},
 
 		{func() { Debug("Hello") }, ".*Z\tdebug\tlog/log_test.go:.*\tHello", false, true, None},
+		{func() { defer recoverPanic(); Panicf("Hello") }, ".*Z\tpanic\tlog/log_test.go:.*\tHello", false, true, None},
+		{func() { DPanicw("Hello") }, ".*Z\tdpanic\tlog/log_test.go:.*\tHello", false, true, None},
 
-		{func() { Debug("Hello") }, "{\"level\":\"debug\",\"time\":\".*T.*Z\",\"caller\":\"log/log_test.go:.*\",\"msg\":\"Hello\",\"stack\":\".*\"}",
+		{func() { Debug("Hello") }, "{\"level\":\"debug\",\"time\":\".*T.*Z\",\"caller\":\"log/log_test.go:.*\",\"msg\":\"Hello\",\"log_schema\":2,\"stack\":\".*\"}",
 			true, true, zapcore.DebugLevel},
-		{func() { Info("Hello") }, "{\"level\":\"info\",\"time\":\".*T.*Z\",\"caller\":\"log/log_test.go:.*\",\"msg\":\"Hello\",\"stack\":\".*\"}",
+		{func() { Info("Hello") }, "{\"level\":\"info\",\"time\":\".*T.*Z\",\"caller\":\"log/log_test.go:.*\",\"msg\":\"Hello\",\"log_schema\":2,\"stack\":\".*\"}",
 			true, true, zapcore.DebugLevel},
-		{func() { Warn("Hello") }, "{\"level\":\"warn\",\"time\":\".*T.*Z\",\"caller\":\"log/log_test.go:.*\",\"msg\":\"Hello\",\"stack\":\".*\"}",
+		{func() { Warn("Hello") }, "{\"level\":\"warn\",\"time\":\".*T.*Z\",\"caller\":\"log/log_test.go:.*\",\"msg\":\"Hello\",\"log_schema\":2,\"stack\":\".*\"}",
 			true, true, zapcore.DebugLevel},
-		{func() { Error("Hello") }, "{\"level\":\"error\",\"time\":\".*T.*Z\",\"caller\":\"log/log_test.go:.*\",\"msg\":\"Hello\",\"stack\":\".*\"}",
+		{func() { Error("Hello") }, "{\"level\":\"error\",\"time\":\".*T.*Z\",\"caller\":\"log/log_test.go:.*\",\"msg\":\"Hello\",\"log_schema\":2,\"stack\":\".*\"}",
 			true, true, zapcore.DebugLevel},
 	}
 
@@ -108,6 +127,61 @@ func TestBasic(t *testing.T) {
 	l.Sync()
 }
 
+// recoverPanic recovers from the panics of the Panic functions.
+func recoverPanic() {
+	_ = recover()
+}
+
+func TestPanic(t *testing.T) {
+	cases := []struct {
+		f           func()
+		development bool
+		panics      bool
+	}{
+		{func() { Panic("Hello") }, false, true},
+		{func() { Panicf("Hello %s", "world") }, false, true},
+		{func() { DPanicw("Hello") }, false, false},
+		{func() { DPanic("Hello") }, true, true},
+		{func() { DPanicf("Hello %s", "world") }, true, true},
+	}
+
+	defer configureWithoutOutput(t)
+	for i, c := range cases {
+		o := NewOptions()
+		o.OutputPaths = nil
+		o.AuditOutputPaths = nil
+		o.DevelopmentMode = c.development
+		if err := Configure(o); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		panicked := func() (panicked bool) {
+			defer func() {
+				panicked = recover() != nil
+			}()
+			c.f()
+			return false
+		}()
+		if panicked != c.panics {
+			t.Errorf("Got a panic %v, expecting %v for case %d", panicked, c.panics, i)
+		}
+	}
+
+	// the panics don't depend on the output
+	o := NewOptions()
+	o.AuditOutputPaths = nil
+	_ = o.SetOutputLevel(None)
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() {
+		if r := recover(); r != "Hello" {
+			t.Errorf("Got %v, expecting a panic with the message", r)
+		}
+	}()
+	Panic("Hello")
+}
+
 func TestEnabled(t *testing.T) {
 	cases := []struct {
 		level        zapcore.Level
@@ -173,6 +247,143 @@ func TestOddballs(t *testing.T) {
 	}
 }
 
+func TestOutputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	path := filepath.Join(dir, "mixer.json")
+
+	lines, err := captureStdout(func() {
+		o := NewOptions()
+		o.OutputPaths = nil
+		o.Outputs = []OutputSpec{{Path: "stdout", Encoding: "console"}, {Path: path, Encoding: "json"}}
+		if err := Configure(o); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		Info("Hello", zap.String("user", "bob"))
+		Sync()
+	})
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	if match, _ := regexp.MatchString(".*Z\tinfo\tHello\t{\"user\": \"bob\"}", lines[0]); !match || len(lines) != 2 {
+		t.Errorf("Got '%v', expecting a single console entry", lines)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unable to read log: %v", err)
+	}
+
+	pat := "{\"level\":\"info\",\"time\":\".*\",\"msg\":\"Hello\",\"log_schema\":2,\"user\":\"bob\"}\n"
+	if match, _ := regexp.MatchString(pat, string(content)); !match {
+		t.Errorf("Got '%s', expecting to match '%s'", content, pat)
+	}
+}
+
+func TestOutputMinLevel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	path := filepath.Join(dir, "mixer.log")
+
+	lines, err := captureStdout(func() {
+		o := NewOptions()
+		o.OutputPaths = nil
+		o.Outputs = []OutputSpec{{Path: "stdout", MinLevel: "warn"}, {Path: path}}
+		_ = o.SetOutputLevel(zapcore.DebugLevel)
+		if err := Configure(o); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		Debug("One")
+		Info("Two")
+		Warn("Three")
+		Sync()
+	})
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "\twarn\tThree") {
+		t.Errorf("Got '%v', expecting the warning only", lines)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unable to read log: %v", err)
+	}
+
+	if entries := strings.Split(strings.TrimSpace(string(content)), "\n"); len(entries) != 3 {
+		t.Errorf("Got '%v', expecting all three entries", entries)
+	}
+}
+
+func TestOutputFieldFilters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	path := filepath.Join(dir, "mixer.log")
+
+	lines, err := captureStdout(func() {
+		o := NewOptions()
+		o.OutputPaths = nil
+		o.Outputs = []OutputSpec{
+			{Path: "stdout", FieldDenylist: []string{"request.*"}},
+			{Path: path, FieldAllowlist: []string{"request.*"}},
+		}
+		if err := Configure(o); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		With(zap.String("request.id", "42")).Info("Hello", zap.String("user", "bob"), zap.String("request.path", "/"))
+		Sync()
+	})
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	if !strings.HasSuffix(lines[0], "\tHello\t{\"user\": \"bob\"}") {
+		t.Errorf("Got '%v', expecting the request fields stripped", lines)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unable to read log: %v", err)
+	}
+
+	if !strings.HasSuffix(string(content), "\tHello\t{\"request.id\": \"42\", \"request.path\": \"/\"}\n") {
+		t.Errorf("Got '%s', expecting only the request fields", content)
+	}
+}
+
+func TestOutputErrors(t *testing.T) {
+	cases := []OutputSpec{
+		{Path: "stdout", Encoding: "xml"},
+		{Path: "stdout", MinLevel: "loud"},
+		{Path: "syslog+udp://localhost", Encoding: "json"},
+	}
+
+	for _, c := range cases {
+		o := NewOptions()
+		o.Outputs = []OutputSpec{c}
+		if err := Configure(o); err == nil {
+			t.Errorf("Got success for %v, expecting error", c)
+		}
+	}
+}
+
 func TestCapture(t *testing.T) {
 	lines, _ := captureStdout(func() {
 		o := NewOptions()
@@ -205,6 +416,87 @@ func TestCapture(t *testing.T) {
 	}
 }
 
+func TestCaptureStdLogDisabled(t *testing.T) {
+	o := NewOptions()
+	o.AuditOutputPaths = nil
+	lines, _ := captureStdout(func() {
+		_ = Configure(o)
+		log.Println("Captured")
+
+		o.CaptureStdLog = false
+		_ = Configure(o)
+	})
+	defer configureWithoutOutput(t)
+
+	if !strings.Contains(lines[0], "Captured") {
+		t.Errorf("Got '%s', expecting the standard log to be captured", lines[0])
+	}
+
+	// the standard logger gets back its settings
+	if flags := log.Flags(); flags != log.LstdFlags {
+		t.Errorf("Got flags %d, expecting %d", flags, log.LstdFlags)
+	}
+
+	var buf strings.Builder
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	log.Println("Left alone")
+	Sync()
+	if !strings.HasSuffix(buf.String(), "Left alone\n") {
+		t.Errorf("Got '%s', expecting the standard log to be left alone", buf.String())
+	}
+}
+
+func TestReplaceGlobalZapDisabled(t *testing.T) {
+	o := NewOptions()
+	o.AuditOutputPaths = nil
+	o.ReplaceGlobalZap = false
+	lines, _ := captureStdout(func() {
+		_ = Configure(o)
+		zap.L().Info("Global")
+		Info("Package")
+	})
+	defer configureWithoutOutput(t)
+
+	if !strings.Contains(lines[0], "Package") || strings.Contains(strings.Join(lines, "\n"), "Global") {
+		t.Errorf("Got '%v', expecting only the entry of the package", lines)
+	}
+
+	// global loggers of the program's own survive reconfiguration
+	own := zap.NewExample()
+	restore := zap.ReplaceGlobals(own)
+	defer restore()
+
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	if zap.L() != own {
+		t.Error("Got the global logger replaced, expecting it to be left alone")
+	}
+}
+
+func TestCaptureGRPCLogDisabled(t *testing.T) {
+	var buf strings.Builder
+	grpclog.SetLoggerV2(grpclog.NewLoggerV2(&buf, ioutil.Discard, ioutil.Discard))
+
+	o := NewOptions()
+	o.AuditOutputPaths = nil
+	o.CaptureGRPCLog = false
+	lines, _ := captureStdout(func() {
+		_ = Configure(o)
+		grpclog.Info("Routed elsewhere")
+	})
+	defer configureWithoutOutput(t)
+
+	if strings.Contains(strings.Join(lines, "\n"), "Routed elsewhere") {
+		t.Errorf("Got '%v', expecting the gRPC logging to be left alone", lines)
+	}
+	if !strings.Contains(buf.String(), "Routed elsewhere") {
+		t.Errorf("Got '%s', expecting the entry in the gRPC logger of the program", buf.String())
+	}
+}
+
 // Runs the given function while capturing everything sent to stdout
 func captureStdout(f func()) ([]string, error) {
 	tf, err := ioutil.TempFile("", "log_test")
@@ -231,3 +523,412 @@ func captureStdout(f func()) ([]string, error) {
 
 	return strings.Split(string(content), "\n"), nil
 }
+
+// countingCore counts the entries written, from any number of goroutines.
+type countingCore struct {
+	zapcore.LevelEnabler
+	count *int64
+}
+
+func (c *countingCore) With([]zapcore.Field) zapcore.Core {
+	return c
+}
+
+func (c *countingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *countingCore) Write(zapcore.Entry, []zapcore.Field) error {
+	atomic.AddInt64(c.count, 1)
+	return nil
+}
+
+func (c *countingCore) Sync() error {
+	return nil
+}
+
+func TestConfigureConcurrently(t *testing.T) {
+	var count int64
+	defer AddCore(&countingCore{LevelEnabler: zapcore.InfoLevel, count: &count})()
+	defer configureWithoutOutput(t)
+
+	const goroutines = 4
+	const entries = 500
+
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < entries; j++ {
+				switch j % 4 {
+				case 0:
+					Info("Hello")
+				case 1:
+					Infof("Hello %d", j)
+				case 2:
+					With(zap.Int("j", j)).Info("Hello")
+				default:
+					Infow("Hello", "j", j)
+				}
+				_ = DebugEnabled()
+			}
+		}()
+	}
+
+	// entries logged while switching between settings all make it out
+	for i := 0; i < 20; i++ {
+		o := NewOptions()
+		o.OutputPaths = nil
+		o.AuditOutputPaths = nil
+		o.DisableSampling = true
+		o.Async = i%2 == 0
+		o.AsyncDropPolicy = "block"
+		o.FlushInterval = time.Millisecond
+		if err := Configure(o); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+	}
+
+	wg.Wait()
+	Sync()
+
+	if n := atomic.LoadInt64(&count); n != goroutines*entries {
+		t.Errorf("Got %d entries, expecting %d", n, goroutines*entries)
+	}
+}
+
+func TestConfigureFailureKeepsSettings(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	defer configureWithoutOutput(t)
+
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.Async = true
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	o = NewOptions()
+	o.OutputPaths = []string{"tcp://"}
+	o.AuditOutputPaths = nil
+	o.Async = true
+	o.EncoderKeys = []string{"msg=message"}
+	o.LogSchema = 1
+	if err := Configure(o); err == nil {
+		t.Fatal("Got success, expecting error")
+	}
+
+	// the settings of the sinks are put back as well
+	if sinkEncoder.MessageKey != "msg" || outputLogSchema != currentLogSchema {
+		t.Errorf("Got the key %s and schema %d, expecting the previous settings of the sinks", sinkEncoder.MessageKey, outputLogSchema)
+	}
+
+	Info("Hello")
+	Sync()
+	if s := buf.String(); s != `{"level":"info","msg":"Hello"}`+"\n" {
+		t.Errorf("Got '%s', expecting the entry output with the previous settings", s)
+	}
+}
+
+func TestSetLogger(t *testing.T) {
+	collector, previous := newCollectingCore(zapcore.DebugLevel)
+	remove := AddCore(collector)
+	configureAsync(t, 0, "")
+	defer configureWithoutOutput(t)
+	Info("Queued")
+
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	SetLogger(zap.New(core, zap.AddCaller()))
+	remove()
+
+	// the entries of the previous configuration are written out
+	if s := previous.String(); s != `{"level":"info","msg":"Queued"}`+"\n" {
+		t.Errorf("Got '%s', expecting the queued entry", s)
+	}
+
+	if !DebugEnabled() {
+		t.Error("Got debug disabled, expecting the level of the logger")
+	}
+
+	Debug("One")
+	log.Println("Two")
+	grpclog.Info("Three")
+	zap.L().Named("dispatcher").Info("Four")
+
+	_ = SetOutputLevel(zapcore.InfoLevel)
+	Debug("Not output")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	patterns := []string{
+		`^{"level":"debug","caller":"log/log_test.go:.*","msg":"One"}$`,
+		`^{"level":"info","caller":".*","msg":"Two"}$`,
+		`^{"level":"info","caller":"log/log_test.go:.*","msg":"Three"}$`,
+		`^{"level":"info","logger":"dispatcher","caller":"log/log_test.go:.*","msg":"Four"}$`,
+	}
+	if len(lines) != len(patterns) {
+		t.Fatalf("Got '%v', expecting %d entries", lines, len(patterns))
+	}
+	for i, pat := range patterns {
+		if match, _ := regexp.MatchString(pat, lines[i]); !match {
+			t.Errorf("Got '%s', expecting to match '%s'", lines[i], pat)
+		}
+	}
+}
+
+func TestReplaceLogger(t *testing.T) {
+	collector, configured := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(collector)()
+	configureWithoutOutput(t)
+	_ = SetScopeOutputLevel("dispatcher", zapcore.ErrorLevel)
+
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	restore := ReplaceLogger(zap.New(core))
+	Debug("Replaced")
+	restore()
+	restore()
+
+	Debug("Not output")
+	Info("Configured")
+
+	if s := buf.String(); s != `{"level":"debug","msg":"Replaced"}`+"\n" {
+		t.Errorf("Got '%s', expecting the entry logged while replaced", s)
+	}
+	if s := configured.String(); s != `{"level":"info","msg":"Configured"}`+"\n" {
+		t.Errorf("Got '%s', expecting the configured output back", s)
+	}
+	if l := GetScopeOutputLevel("dispatcher"); l != zapcore.ErrorLevel {
+		t.Errorf("Got %v, expecting the level of the scope to be put back", l)
+	}
+}
+
+func TestDisabledLevelsDontAllocate(t *testing.T) {
+	configureWithoutOutput(t)
+
+	cases := map[string]func(){
+		"Debuga": func() { Debuga("Not output", 1, "two") },
+		"Debugf": func() { Debugf("Not output %d %s", 1, "two") },
+		"Debugw": func() { Debugw("Not output", "one", 1, "two", 2) },
+	}
+	for name, f := range cases {
+		if allocs := testing.AllocsPerRun(100, f); allocs != 0 {
+			t.Errorf("%s: got %v allocations, expecting none at a disabled level", name, allocs)
+		}
+	}
+}
+
+func TestLogger(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	configureWithoutOutput(t)
+	defer configureWithoutOutput(t)
+
+	l := Logger().Named("adapters").With(zap.String("instance", "a"))
+	l.Info("One")
+	l.Debug("Not output")
+
+	// the logger follows the changes to the configuration
+	configureAsync(t, 0, "")
+	_ = SetScopeOutputLevel("adapters", zapcore.WarnLevel)
+	l.Info("Not output")
+	l.Warn("Two")
+	Sync()
+
+	expected := `{"level":"info","logger":"adapters","msg":"One","instance":"a"}` + "\n" +
+		`{"level":"warn","logger":"adapters","msg":"Two","instance":"a"}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Got\n%s\nexpecting\n%s", buf, expected)
+	}
+}
+
+func TestNamed(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	configureWithoutOutput(t)
+	defer configureWithoutOutput(t)
+
+	adapter := Named("adapter")
+	adapter.Info("One")
+	adapter.Named("prometheus").Info("Two")
+	Named("adapter.prometheus").With(zap.String("instance", "a")).Info("Three")
+
+	// the names are the scopes of the entries
+	_ = SetScopeOutputLevel("adapter.prometheus", zapcore.ErrorLevel)
+	Named("adapter.prometheus").Info("Not output")
+	adapter.Info("Four")
+
+	expected := `{"level":"info","logger":"adapter","msg":"One"}` + "\n" +
+		`{"level":"info","logger":"adapter.prometheus","msg":"Two"}` + "\n" +
+		`{"level":"info","logger":"adapter.prometheus","msg":"Three","instance":"a"}` + "\n" +
+		`{"level":"info","logger":"adapter","msg":"Four"}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Got\n%s\nexpecting\n%s", buf, expected)
+	}
+}
+
+// tracedError describes where it was created in its verbose form, like the errors of
+// github.com/pkg/errors.
+type tracedError struct{}
+
+func (tracedError) Error() string {
+	return "failed"
+}
+
+func (e tracedError) Format(s fmt.State, verb rune) {
+	_, _ = io.WriteString(s, e.Error())
+	if s.Flag('+') {
+		_, _ = io.WriteString(s, "\nmain.load\n\tmain.go:10")
+	}
+}
+
+func TestWithError(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	configureWithoutOutput(t)
+
+	WithError(errors.New("timeout")).Error("One")
+	WithError(tracedError{}).Warn("Two")
+	WithError(nil).Info("Three")
+
+	expected := `{"level":"error","msg":"One","error":"timeout","errorType":"*errors.errorString"}` + "\n" +
+		`{"level":"warn","msg":"Two","error":"failed","errorType":"log.tracedError","errorStack":"failed\nmain.load\n\tmain.go:10"}` + "\n" +
+		`{"level":"info","msg":"Three"}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Got\n%s\nexpecting\n%s", buf, expected)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.IncludeCallerSourceLocation = true
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer configureWithoutOutput(t)
+
+	if ce := Check(zapcore.DebugLevel, "Not output"); ce != nil {
+		t.Error("Got an entry, expecting nil for a disabled level")
+	}
+
+	_ = SetScopeOutputLevel("default", zapcore.ErrorLevel)
+	if ce := Check(zapcore.WarnLevel, "Not output"); ce != nil {
+		t.Error("Got an entry, expecting nil for a level disabled for the default scope")
+	}
+	_ = SetScopeOutputLevel("default", zapcore.InfoLevel)
+
+	ce := Check(zapcore.InfoLevel, "Hello")
+	if ce == nil {
+		t.Fatal("Got nil, expecting an entry")
+	}
+	ce.Write(Int("count", 3))
+
+	pat := `^{"level":"info","caller":"log/log_test.go:.*","msg":"Hello","count":3}$`
+	if match, _ := regexp.MatchString(pat, strings.TrimSpace(buf.String())); !match {
+		t.Errorf("Got '%s', expecting to match '%s'", buf, pat)
+	}
+}
+
+// logThroughHelper wraps the package like the helpers of other packages do.
+func logThroughHelper(msg string) {
+	WithCallerSkip(1).Info(msg)
+}
+
+func TestWithCallerSkip(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.IncludeCallerSourceLocation = true
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer configureWithoutOutput(t)
+
+	_, _, line, _ := runtime.Caller(0)
+	logThroughHelper("Hello")
+	WithCallerSkip(0).Info("World")
+
+	expected := fmt.Sprintf(`{"level":"info","caller":"log/log_test.go:%d","msg":"Hello"}`+"\n"+
+		`{"level":"info","caller":"log/log_test.go:%d","msg":"World"}`+"\n", line+1, line+2)
+	if buf.String() != expected {
+		t.Errorf("Got\n%s\nexpecting\n%s", buf, expected)
+	}
+}
+
+func TestDevelopmentMode(t *testing.T) {
+	defer replaceIsTerminal(true)()
+
+	lines, err := captureStdout(func() {
+		o := NewOptions()
+		o.AuditOutputPaths = nil
+		o.DevelopmentMode = true
+		if err := Configure(o); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+		defer configureWithoutOutput(t)
+
+		for i := 0; i < 200; i++ {
+			Warn("Hello")
+		}
+
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("Got no panic, expecting entries at the DPanic level to panic")
+			}
+		}()
+		Logger().DPanic("Inconsistent state")
+	})
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	// every entry is output, with its level colored
+	if len(lines) != 202 {
+		t.Fatalf("Got %d lines, expecting every entry output", len(lines))
+	}
+	if !strings.Contains(lines[199], "\x1b[33mWARN\x1b[0m") {
+		t.Errorf("Got '%s', expecting the level colored", lines[199])
+	}
+	if !strings.Contains(lines[200], "Inconsistent state") {
+		t.Errorf("Got '%s', expecting the entry written before the panic", lines[200])
+	}
+}
+
+func BenchmarkDisabledDebugf(b *testing.B) {
+	configureWithoutOutput(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Debugf("Not output %d %s", i, "two")
+	}
+}
+
+func BenchmarkDisabledDebugw(b *testing.B) {
+	configureWithoutOutput(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Debugw("Not output", "one", i, "two", 2)
+	}
+}
+
+func BenchmarkEnabledInfof(b *testing.B) {
+	configureWithoutOutput(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Infof("Output %d %s", i, "two")
+	}
+}
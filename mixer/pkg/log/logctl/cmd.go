@@ -0,0 +1,141 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logctl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"istio.io/istio/mixer/pkg/log"
+)
+
+// Command returns the log command, whose subcommands get and set the levels of the scopes of a
+// running process and tail its recent entries.
+func Command() *cobra.Command {
+	c := NewClient("http://localhost:9093")
+
+	logCmd := &cobra.Command{
+		Use:   "log",
+		Short: "Inspect and control the log of a running process",
+	}
+	logCmd.PersistentFlags().StringVar(&c.Address, "address", c.Address,
+		"The base URL of the admin endpoint of the process")
+	logCmd.PersistentFlags().StringVar(&c.LevelsPath, "levels_path", c.LevelsPath,
+		"The path the levels of the scopes are served on")
+	logCmd.PersistentFlags().StringVar(&c.EntriesPath, "entries_path", c.EntriesPath,
+		"The path the recent entries are served on")
+
+	logCmd.AddCommand(&cobra.Command{
+		Use:   "levels",
+		Short: "List the levels of the default scope and of the scopes with levels of their own",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			levels, err := c.Levels(context.Background())
+			if err != nil {
+				return err
+			}
+			return printLevels(cmd.OutOrStdout(), levels)
+		},
+	})
+
+	var level, stackTraceLevel string
+	setCmd := &cobra.Command{
+		Use:   "set [scope]",
+		Short: "Set the levels of a scope, or of the default scope when none is given",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if level == "" && stackTraceLevel == "" {
+				return fmt.Errorf("expecting --level, --stacktrace, or both")
+			}
+
+			var scope string
+			if len(args) > 0 {
+				scope = args[0]
+			}
+			levels, err := c.SetLevels(context.Background(), scope, level, stackTraceLevel)
+			if err != nil {
+				return err
+			}
+			return printLevels(cmd.OutOrStdout(), levels)
+		},
+	}
+	setCmd.Flags().StringVar(&level, "level", "",
+		"The minimum output level of the scope, can be one of debug, info, warn, error, or none")
+	setCmd.Flags().StringVar(&stackTraceLevel, "stacktrace", "",
+		"The level from which the entries of the scope include a stack trace, can be one of debug, info, warn, error, or none")
+	logCmd.AddCommand(setCmd)
+
+	logCmd.AddCommand(&cobra.Command{
+		Use:   "reset <scope>",
+		Short: "Make a scope use the levels of the default scope again",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			levels, err := c.ResetLevels(context.Background(), args[0])
+			if err != nil {
+				return err
+			}
+			return printLevels(cmd.OutOrStdout(), levels)
+		},
+	})
+
+	var interval time.Duration
+	tailCmd := &cobra.Command{
+		Use:   "tail",
+		Short: "Output the recent entries of the process, and those logged from then on until interrupted",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			interrupt := make(chan os.Signal, 1)
+			signal.Notify(interrupt, os.Interrupt)
+			defer signal.Stop(interrupt)
+			go func() {
+				select {
+				case <-interrupt:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+
+			out := cmd.OutOrStdout()
+			return c.Tail(ctx, interval, func(entry string) {
+				_, _ = fmt.Fprintln(out, entry)
+			})
+		},
+	}
+	tailCmd.Flags().DurationVar(&interval, "interval", time.Second,
+		"How often to poll the process for new entries")
+	logCmd.AddCommand(tailCmd)
+
+	return logCmd
+}
+
+// printLevels outputs the given levels as a table.
+func printLevels(w io.Writer, levels []log.ScopeLevels) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "SCOPE\tOUTPUT LEVEL\tSTACK TRACE LEVEL")
+	for _, l := range levels {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", l.Scope, l.OutputLevel, l.StackTraceLevel)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,61 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logctl
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+)
+
+func TestCommand(t *testing.T) {
+	s, done := newServer(t)
+	defer done()
+
+	cases := []struct {
+		args     []string
+		expected string
+		err      bool
+	}{
+		{[]string{"levels"}, `(?m)^SCOPE +OUTPUT LEVEL +STACK TRACE LEVEL\ndefault +info +none\n$`, false},
+		{[]string{"set", "adapters", "--level", "debug", "--stacktrace", "error"}, `(?m)^adapters +debug +error$`, false},
+		{[]string{"set", "--level", "warn"}, `(?m)^default +warn +none$`, false},
+		{[]string{"reset", "adapters"}, `^SCOPE +OUTPUT LEVEL +STACK TRACE LEVEL\ndefault +warn +none\n$`, false},
+		{[]string{"set", "adapters"}, ``, true},
+		{[]string{"set", "adapters", "--level", "verbose"}, ``, true},
+		{[]string{"reset"}, ``, true},
+	}
+
+	for _, c := range cases {
+		var out bytes.Buffer
+		cmd := Command()
+		cmd.SetOutput(&out)
+		cmd.SetArgs(append(c.args, "--address", s.URL))
+
+		err := cmd.Execute()
+		if c.err {
+			if err == nil {
+				t.Errorf("Got success for %v, expecting error", c.args)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Got err '%v' for %v, expecting success", err, c.args)
+		} else if match, _ := regexp.MatchString(c.expected, out.String()); !match {
+			t.Errorf("Got '%s' for %v, expecting to match '%s'", out.String(), c.args, c.expected)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logctl talks to the log endpoints of a running process, as served by log.LevelsHandler
+// and log.RecentEntriesHandler, to get and set the levels of its scopes and to tail its recent
+// entries. Command wraps the client in commands for istioctl or mixc:
+//
+//		rootCmd.AddCommand(logctl.Command())
+//
+// which are then used as:
+//
+//		mixc log levels --address http://localhost:9093
+//		mixc log set adapters --level debug --stacktrace error
+//		mixc log tail
+package logctl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"istio.io/istio/mixer/pkg/log"
+)
+
+// The paths the handlers of the log package are expected to be mounted on, as in their examples.
+const (
+	DefaultLevelsPath  = "/debug/log/levels"
+	DefaultEntriesPath = "/debug/log"
+)
+
+// Client talks to the log endpoints of a running process.
+type Client struct {
+	// Address is the base URL of the endpoints, such as http://localhost:9093.
+	Address string
+
+	// LevelsPath and EntriesPath are the paths log.LevelsHandler and log.RecentEntriesHandler are
+	// mounted on.
+	LevelsPath  string
+	EntriesPath string
+
+	// HTTPClient sends the requests, http.DefaultClient when nil.
+	HTTPClient *http.Client
+}
+
+// NewClient returns a client of the endpoints at the given address, mounted on the default paths.
+func NewClient(address string) *Client {
+	return &Client{
+		Address:     strings.TrimSuffix(address, "/"),
+		LevelsPath:  DefaultLevelsPath,
+		EntriesPath: DefaultEntriesPath,
+	}
+}
+
+// Levels returns the levels of the default scope and of the scopes with levels of their own.
+func (c *Client) Levels(ctx context.Context) ([]log.ScopeLevels, error) {
+	return c.levels(ctx, http.MethodGet, nil)
+}
+
+// SetLevels sets the output and stack trace levels of the given scope, or of the default scope
+// when empty. Either level can be left empty to keep it as it is. It returns the levels in effect
+// afterwards.
+func (c *Client) SetLevels(ctx context.Context, scope, level, stackTraceLevel string) ([]log.ScopeLevels, error) {
+	params := url.Values{}
+	if scope != "" {
+		params.Set("scope", scope)
+	}
+	if level != "" {
+		params.Set("level", level)
+	}
+	if stackTraceLevel != "" {
+		params.Set("stacktrace", stackTraceLevel)
+	}
+	return c.levels(ctx, http.MethodPut, params)
+}
+
+// ResetLevels makes the given scope use the levels of the default scope again. It returns the
+// levels in effect afterwards.
+func (c *Client) ResetLevels(ctx context.Context, scope string) ([]log.ScopeLevels, error) {
+	return c.levels(ctx, http.MethodDelete, url.Values{"scope": {scope}})
+}
+
+func (c *Client) levels(ctx context.Context, method string, params url.Values) ([]log.ScopeLevels, error) {
+	resp, err := c.do(ctx, method, c.LevelsPath, params)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var levels []log.ScopeLevels
+	if err = json.NewDecoder(resp.Body).Decode(&levels); err != nil {
+		return nil, fmt.Errorf("unable to decode the levels: %v", err)
+	}
+	return levels, nil
+}
+
+// RecentEntries returns the recent entries kept by the process, oldest first, encoded in JSON.
+func (c *Client) RecentEntries(ctx context.Context) ([]string, error) {
+	resp, err := c.do(ctx, http.MethodGet, c.EntriesPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var entries []string
+	s := bufio.NewScanner(resp.Body)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		entries = append(entries, s.Text())
+	}
+	if err = s.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read the recent entries: %v", err)
+	}
+	return entries, nil
+}
+
+// Tail calls f with the recent entries kept by the process, then with those logged since, polling
+// at the given interval until the context is done. The entries logged between two polls beyond
+// the capacity of the buffer of the process are missed, as are those identical to the last one
+// seen, which can't be told apart from it.
+func (c *Client) Tail(ctx context.Context, interval time.Duration, f func(entry string)) error {
+	var last string
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		entries, err := c.RecentEntries(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		for _, e := range newEntries(entries, last) {
+			f(e)
+		}
+		if len(entries) > 0 {
+			last = entries[len(entries)-1]
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// newEntries returns the entries following the last one seen, or all of them when it isn't found.
+func newEntries(entries []string, last string) []string {
+	if last == "" {
+		return entries
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i] == last {
+			return entries[i+1:]
+		}
+	}
+	return entries
+}
+
+// do sends a request to the given path with the given parameters, and returns the response unless
+// it failed.
+func (c *Client) do(ctx context.Context, method, path string, params url.Values) (*http.Response, error) {
+	u := c.Address + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logctl
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"istio.io/istio/mixer/pkg/log"
+)
+
+// newServer serves the log endpoints on the default paths, with the recent entries kept.
+func newServer(t *testing.T) (*httptest.Server, func()) {
+	o := log.NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.RecentEntries = 100
+	if err := log.Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(DefaultLevelsPath, log.LevelsHandler())
+	mux.Handle(DefaultEntriesPath, log.RecentEntriesHandler())
+	s := httptest.NewServer(mux)
+
+	return s, func() {
+		s.Close()
+		o := log.NewOptions()
+		o.OutputPaths = nil
+		o.AuditOutputPaths = nil
+		_ = log.Configure(o)
+	}
+}
+
+func TestLevels(t *testing.T) {
+	s, done := newServer(t)
+	defer done()
+	c := NewClient(s.URL + "/")
+	ctx := context.Background()
+
+	levels, err := c.SetLevels(ctx, "adapters", "debug", "")
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	expected := []log.ScopeLevels{
+		{Scope: "default", OutputLevel: log.Level(zapcore.InfoLevel), StackTraceLevel: log.Level(log.None)},
+		{Scope: "adapters", OutputLevel: log.Level(zapcore.DebugLevel), StackTraceLevel: log.Level(log.None)},
+	}
+	if !reflect.DeepEqual(levels, expected) {
+		t.Errorf("Got %+v, expecting %+v", levels, expected)
+	}
+	if l := log.GetScopeOutputLevel("adapters"); l != zapcore.DebugLevel {
+		t.Errorf("Got %v, expecting the level set", l)
+	}
+
+	if levels, err = c.Levels(ctx); err != nil || !reflect.DeepEqual(levels, expected) {
+		t.Errorf("Got %+v, %v, expecting %+v", levels, err, expected)
+	}
+
+	if levels, err = c.ResetLevels(ctx, "adapters"); err != nil || !reflect.DeepEqual(levels, expected[:1]) {
+		t.Errorf("Got %+v, %v, expecting %+v", levels, err, expected[:1])
+	}
+
+	if _, err = c.SetLevels(ctx, "adapters", "verbose", ""); err == nil || !strings.Contains(err.Error(), "unknown level: verbose") {
+		t.Errorf("Got err '%v', expecting the error of the endpoint", err)
+	}
+}
+
+func TestTail(t *testing.T) {
+	s, done := newServer(t)
+	defer done()
+	c := NewClient(s.URL)
+
+	log.Info("first")
+
+	var mu sync.Mutex
+	var got []string
+	seen := make(chan struct{}, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tailed := make(chan error)
+	go func() {
+		tailed <- c.Tail(ctx, 10*time.Millisecond, func(entry string) {
+			mu.Lock()
+			got = append(got, entry)
+			mu.Unlock()
+			seen <- struct{}{}
+		})
+	}()
+
+	<-seen
+	log.Info("second")
+	log.Info("third")
+	<-seen
+	<-seen
+	cancel()
+	if err := <-tailed; err != nil {
+		t.Errorf("Got err '%v', expecting success", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 3 || !strings.Contains(got[0], "first") || !strings.Contains(got[1], "second") || !strings.Contains(got[2], "third") {
+		t.Errorf("Got %v, expecting each entry once", got)
+	}
+}
+
+func TestNewEntries(t *testing.T) {
+	cases := []struct {
+		entries  []string
+		last     string
+		expected []string
+	}{
+		{[]string{"a", "b"}, "", []string{"a", "b"}},
+		{[]string{"a", "b", "c"}, "b", []string{"c"}},
+		{[]string{"a", "b"}, "b", []string{}},
+		{[]string{"c", "d"}, "b", []string{"c", "d"}},
+	}
+
+	for _, c := range cases {
+		if got := newEntries(c.entries, c.last); !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("Got %v after %s, expecting %v", got, c.last, c.expected)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// logfmt encoding
+//
+// The logfmt encoding outputs each entry as a line of key=value pairs: the time, level, logger,
+// caller, and message, followed by the fields in the order they were added and the stack trace.
+// Values containing spaces, quotes, equal signs, or control characters are quoted. Fields of
+// nested objects and namespaces get dotted keys, and arrays are output as quoted JSON.
+
+const logfmtEncoding = "logfmt"
+
+var logfmtPool = buffer.NewPool()
+
+func init() {
+	registerEncoder(logfmtEncoding, func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		return newLogfmtEncoder(cfg), nil
+	})
+}
+
+// logfmtEncoder encodes entries as logfmt lines. The fields added with With are encoded right
+// away into buf, and prepended to the fields of each entry.
+type logfmtEncoder struct {
+	cfg    *zapcore.EncoderConfig
+	buf    *buffer.Buffer
+	prefix string
+}
+
+func newLogfmtEncoder(cfg zapcore.EncoderConfig) *logfmtEncoder {
+	return &logfmtEncoder{cfg: &cfg, buf: logfmtPool.Get()}
+}
+
+func (e *logfmtEncoder) Clone() zapcore.Encoder {
+	clone := &logfmtEncoder{cfg: e.cfg, buf: logfmtPool.Get(), prefix: e.prefix}
+	_, _ = clone.buf.Write(e.buf.Bytes())
+	return clone
+}
+
+func (e *logfmtEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	out := &logfmtEncoder{cfg: e.cfg, buf: logfmtPool.Get()}
+
+	if e.cfg.TimeKey != "" {
+		out.AddTime(e.cfg.TimeKey, ent.Time)
+	}
+	if e.cfg.LevelKey != "" {
+		if e.cfg.EncodeLevel != nil {
+			out.addValue(e.cfg.LevelKey, encodePrimitive(func(arr zapcore.PrimitiveArrayEncoder) {
+				e.cfg.EncodeLevel(ent.Level, arr)
+			}))
+		} else {
+			out.AddString(e.cfg.LevelKey, ent.Level.String())
+		}
+	}
+	if e.cfg.NameKey != "" && ent.LoggerName != "" {
+		out.AddString(e.cfg.NameKey, ent.LoggerName)
+	}
+	if e.cfg.CallerKey != "" && ent.Caller.Defined {
+		if e.cfg.EncodeCaller != nil {
+			out.addValue(e.cfg.CallerKey, encodePrimitive(func(arr zapcore.PrimitiveArrayEncoder) {
+				e.cfg.EncodeCaller(ent.Caller, arr)
+			}))
+		} else {
+			out.AddString(e.cfg.CallerKey, ent.Caller.String())
+		}
+	}
+	if e.cfg.MessageKey != "" {
+		out.AddString(e.cfg.MessageKey, ent.Message)
+	}
+
+	if e.buf.Len() > 0 {
+		out.separate()
+		_, _ = out.buf.Write(e.buf.Bytes())
+	}
+
+	out.prefix = e.prefix
+	for _, f := range fields {
+		f.AddTo(out)
+	}
+	out.prefix = ""
+
+	if e.cfg.StacktraceKey != "" && ent.Stack != "" {
+		out.AddString(e.cfg.StacktraceKey, ent.Stack)
+	}
+
+	out.buf.AppendString(e.cfg.LineEnding)
+	return out.buf, nil
+}
+
+// encodePrimitive captures the value appended by one of the encoders of an EncoderConfig.
+func encodePrimitive(f func(zapcore.PrimitiveArrayEncoder)) interface{} {
+	enc := zapcore.NewMapObjectEncoder()
+	_ = enc.AddArray("v", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+		f(arr)
+		return nil
+	}))
+
+	if values, ok := enc.Fields["v"].([]interface{}); ok && len(values) > 0 {
+		return values[0]
+	}
+	return nil
+}
+
+func (e *logfmtEncoder) separate() {
+	if e.buf.Len() > 0 {
+		e.buf.AppendByte(' ')
+	}
+}
+
+func (e *logfmtEncoder) addKey(key string) {
+	e.separate()
+	for _, ch := range []byte(e.prefix + key) {
+		if ch <= ' ' || ch == '=' || ch == '"' {
+			ch = '_'
+		}
+		e.buf.AppendByte(ch)
+	}
+	e.buf.AppendByte('=')
+}
+
+func (e *logfmtEncoder) addValue(key string, v interface{}) {
+	switch val := v.(type) {
+	case string:
+		e.AddString(key, val)
+	case bool:
+		e.AddBool(key, val)
+	case int64:
+		e.AddInt64(key, val)
+	case uint64:
+		e.AddUint64(key, val)
+	case float64:
+		e.AddFloat64(key, val)
+	case nil:
+		e.addKey(key)
+		e.buf.AppendString("null")
+	default:
+		e.AddString(key, flatValue(val))
+	}
+}
+
+// logfmtNeedsQuotes checks whether a value has to be quoted to be read back unambiguously.
+func logfmtNeedsQuotes(s string) bool {
+	if s == "" {
+		return true
+	}
+
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || r == utf8.RuneError || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *logfmtEncoder) AddArray(key string, arr zapcore.ArrayMarshaler) error {
+	enc := zapcore.NewMapObjectEncoder()
+	err := enc.AddArray(key, arr)
+	e.AddString(key, flatValue(enc.Fields[key]))
+	return err
+}
+
+func (e *logfmtEncoder) AddObject(key string, obj zapcore.ObjectMarshaler) error {
+	nested := &logfmtEncoder{cfg: e.cfg, buf: e.buf, prefix: e.prefix + key + "."}
+	return obj.MarshalLogObject(nested)
+}
+
+func (e *logfmtEncoder) AddBinary(key string, value []byte) {
+	e.AddString(key, base64.StdEncoding.EncodeToString(value))
+}
+
+func (e *logfmtEncoder) AddByteString(key string, value []byte) {
+	e.AddString(key, string(value))
+}
+
+func (e *logfmtEncoder) AddBool(key string, value bool) {
+	e.addKey(key)
+	e.buf.AppendBool(value)
+}
+
+func (e *logfmtEncoder) AddComplex128(key string, value complex128) {
+	e.AddString(key, fmt.Sprint(value))
+}
+
+func (e *logfmtEncoder) AddComplex64(key string, value complex64) {
+	e.AddComplex128(key, complex128(value))
+}
+
+func (e *logfmtEncoder) AddDuration(key string, value time.Duration) {
+	if e.cfg.EncodeDuration == nil {
+		e.AddString(key, value.String())
+		return
+	}
+	e.addValue(key, encodePrimitive(func(arr zapcore.PrimitiveArrayEncoder) {
+		e.cfg.EncodeDuration(value, arr)
+	}))
+}
+
+func (e *logfmtEncoder) AddFloat64(key string, value float64) {
+	e.addKey(key)
+	e.buf.AppendString(strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+func (e *logfmtEncoder) AddFloat32(key string, value float32) {
+	e.addKey(key)
+	e.buf.AppendString(strconv.FormatFloat(float64(value), 'f', -1, 32))
+}
+
+func (e *logfmtEncoder) AddInt(key string, value int)     { e.AddInt64(key, int64(value)) }
+func (e *logfmtEncoder) AddInt32(key string, value int32) { e.AddInt64(key, int64(value)) }
+func (e *logfmtEncoder) AddInt16(key string, value int16) { e.AddInt64(key, int64(value)) }
+func (e *logfmtEncoder) AddInt8(key string, value int8)   { e.AddInt64(key, int64(value)) }
+
+func (e *logfmtEncoder) AddInt64(key string, value int64) {
+	e.addKey(key)
+	e.buf.AppendInt(value)
+}
+
+func (e *logfmtEncoder) AddString(key, value string) {
+	e.addKey(key)
+	if logfmtNeedsQuotes(value) {
+		e.buf.AppendString(strconv.Quote(value))
+	} else {
+		e.buf.AppendString(value)
+	}
+}
+
+func (e *logfmtEncoder) AddTime(key string, value time.Time) {
+	if e.cfg.EncodeTime == nil {
+		e.AddString(key, value.Format(time.RFC3339Nano))
+		return
+	}
+	e.addValue(key, encodePrimitive(func(arr zapcore.PrimitiveArrayEncoder) {
+		e.cfg.EncodeTime(value, arr)
+	}))
+}
+
+func (e *logfmtEncoder) AddUint(key string, value uint)       { e.AddUint64(key, uint64(value)) }
+func (e *logfmtEncoder) AddUint32(key string, value uint32)   { e.AddUint64(key, uint64(value)) }
+func (e *logfmtEncoder) AddUint16(key string, value uint16)   { e.AddUint64(key, uint64(value)) }
+func (e *logfmtEncoder) AddUint8(key string, value uint8)     { e.AddUint64(key, uint64(value)) }
+func (e *logfmtEncoder) AddUintptr(key string, value uintptr) { e.AddUint64(key, uint64(value)) }
+
+func (e *logfmtEncoder) AddUint64(key string, value uint64) {
+	e.addKey(key)
+	e.buf.AppendUint(value)
+}
+
+func (e *logfmtEncoder) AddReflected(key string, value interface{}) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	e.AddString(key, string(b))
+	return nil
+}
+
+func (e *logfmtEncoder) OpenNamespace(key string) {
+	e.prefix += key + "."
+}
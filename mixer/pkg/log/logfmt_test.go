@@ -0,0 +1,126 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type logfmtUser struct {
+	name string
+	id   int
+}
+
+func (u logfmtUser) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("name", u.name)
+	enc.AddInt("id", u.id)
+	return nil
+}
+
+func TestLogfmt(t *testing.T) {
+	lines, err := captureStdout(func() {
+		o := NewOptions()
+		o.Encoding = logfmtEncoding
+		o.IncludeCallerSourceLocation = true
+		if err := Configure(o); err != nil {
+			t.Errorf("Got err '%v', expecting success", err)
+		}
+
+		Warn("Hello world", zap.Int("count", 3), zap.String("path", "/a"))
+		Sync()
+	})
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	pattern := `^time=\S+ level=warn caller=log/logfmt_test.go:\d+ msg="Hello world" count=3 path=/a$`
+	if match, _ := regexp.MatchString(pattern, lines[0]); !match {
+		t.Errorf("Got '%s', expecting to match %s", lines[0], pattern)
+	}
+}
+
+func TestLogfmtEncoder(t *testing.T) {
+	cfg := newEncoderConfig()
+	cfg.LineEnding = ""
+	enc := newLogfmtEncoder(cfg)
+	enc.AddString("pod", "mixer-1")
+
+	clone := enc.Clone()
+	clone.OpenNamespace("request")
+	clone.AddString("id", "abc")
+
+	buf, err := clone.EncodeEntry(zapcore.Entry{
+		Message:    "Hello",
+		Level:      zapcore.ErrorLevel,
+		LoggerName: "dispatcher",
+		Time:       time.Date(2017, 9, 1, 10, 0, 0, 0, time.UTC),
+		Stack:      "goroutine 1\nmain()",
+	}, []zapcore.Field{
+		zap.Duration("latency", 1500*time.Millisecond),
+		zap.Object("user", logfmtUser{"bob", 7}),
+		zap.Strings("tags", []string{"a", "b"}),
+		zap.Bool("ok", true),
+		zap.Float64("ratio", 0.5),
+	})
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	expected := `time=2017-09-01T10:00:00.000Z level=error logger=dispatcher msg=Hello pod=mixer-1 request.id=abc ` +
+		`request.latency=1.5s request.user.name=bob request.user.id=7 request.tags="[\"a\",\"b\"]" ` +
+		`request.ok=true request.ratio=0.5 stack="goroutine 1\nmain()"`
+	if buf.String() != expected {
+		t.Errorf("Got\n%s\nexpecting\n%s", buf, expected)
+	}
+
+	buf, _ = enc.EncodeEntry(zapcore.Entry{Message: "Hello"}, []zapcore.Field{zap.String("x", "y")})
+	if s := buf.String(); strings.Contains(s, "request") || !strings.HasSuffix(s, " pod=mixer-1 x=y") {
+		t.Errorf("Got '%s', expecting the original encoder to be unchanged by the clone", s)
+	}
+}
+
+func TestLogfmtQuoting(t *testing.T) {
+	cases := []struct {
+		key      string
+		value    string
+		expected string
+	}{
+		{"a", "plain", "a=plain"},
+		{"a", "", `a=""`},
+		{"a", "two words", `a="two words"`},
+		{"a", "k=v", `a="k=v"`},
+		{"a", `say "hi"`, `a="say \"hi\""`},
+		{"a", `back\slash`, `a="back\\slash"`},
+		{"a", "tab\there", `a="tab\there"`},
+		{"a", "héllo", "a=héllo"},
+		{"a", "\xff", `a="\xff"`},
+		{"user name", "bob", "user_name=bob"},
+		{"k=v", "bob", "k_v=bob"},
+	}
+
+	for _, c := range cases {
+		enc := newLogfmtEncoder(zapcore.EncoderConfig{})
+		enc.AddString(c.key, c.value)
+		if got := enc.buf.String(); got != c.expected {
+			t.Errorf("Got %s for %q=%q, expecting %s", got, c.key, c.value, c.expected)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logtest
+
+import (
+	"sync"
+	"time"
+
+	"istio.io/istio/mixer/pkg/log"
+)
+
+// Clock is a clock for the log package whose time only moves when told to, so that the timestamps
+// of the entries, the throttling of the log, and its periodic summaries are the same from one run
+// to the next:
+//
+//		clock := logtest.NewClock(time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC))
+//		defer clock.Install()()
+//
+//		log.Info("Hello")
+//		clock.Add(time.Minute)
+//
+// Clocks are safe for concurrent use.
+type Clock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*clockTicker
+}
+
+var _ log.Clock = &Clock{}
+
+// clockTicker is a ticker of a Clock, which ticks once the clock has moved past its next tick.
+type clockTicker struct {
+	clock  *Clock
+	c      chan time.Time
+	period time.Duration
+	next   time.Time
+}
+
+// C returns the channel the ticks are sent on.
+func (t *clockTicker) C() <-chan time.Time {
+	return t.c
+}
+
+// Stop turns the ticker off, leaving it out of the ticks of the clock from then on.
+func (t *clockTicker) Stop() {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, other := range c.tickers {
+		if other == t {
+			c.tickers = append(c.tickers[:i], c.tickers[i+1:]...)
+			return
+		}
+	}
+}
+
+// NewClock returns a clock set to the given time.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Install makes the log package tell the time with the clock, until the returned function is
+// called.
+func (c *Clock) Install() func() {
+	return log.SetClock(c)
+}
+
+// Now returns the time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// NewTicker returns a ticker which ticks as the clock moves. Like with the tickers of the time
+// package, ticks are dropped for the readers which fall behind, and a stopped ticker sends no more.
+func (c *Clock) NewTicker(d time.Duration) log.Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &clockTicker{clock: c, c: make(chan time.Time, 1), period: d, next: c.now.Add(d)}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// Add moves the clock forward by the given duration, making its tickers tick along the way.
+func (c *Clock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	for _, t := range c.tickers {
+		for !t.next.After(c.now) {
+			select {
+			case t.c <- t.next:
+			default:
+			}
+			t.next = t.next.Add(t.period)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logtest
+
+import (
+	"testing"
+	"time"
+
+	"istio.io/istio/mixer/pkg/log"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewClock(start)
+	defer clock.Install()()
+
+	lt := Capture(t)
+	defer lt.Restore()
+
+	log.Info("Hello")
+	clock.Add(time.Minute)
+	log.Info("Goodbye")
+
+	entries := lt.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("Got %v, expecting two entries", entries)
+	}
+	if !entries[0].Time.Equal(start) || !entries[1].Time.Equal(start.Add(time.Minute)) {
+		t.Errorf("Got %v and %v, expecting the times of the clock", entries[0].Time, entries[1].Time)
+	}
+}
+
+func TestClockTicker(t *testing.T) {
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewClock(start)
+	ticker := clock.NewTicker(time.Second)
+
+	select {
+	case tick := <-ticker.C():
+		t.Fatalf("Got tick at %v, expecting none before the clock moves", tick)
+	default:
+	}
+
+	clock.Add(1500 * time.Millisecond)
+	if tick := <-ticker.C(); !tick.Equal(start.Add(time.Second)) {
+		t.Errorf("Got tick at %v, expecting one a second in", tick)
+	}
+
+	// the ticks of a reader falling behind are dropped
+	clock.Add(5 * time.Second)
+	if tick := <-ticker.C(); !tick.Equal(start.Add(2 * time.Second)) {
+		t.Errorf("Got tick at %v, expecting the first one missed", tick)
+	}
+	select {
+	case tick := <-ticker.C():
+		t.Errorf("Got tick at %v, expecting the others dropped", tick)
+	default:
+	}
+}
+
+func TestClockTickerStop(t *testing.T) {
+	clock := NewClock(time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC))
+	stopped := clock.NewTicker(time.Second)
+	running := clock.NewTicker(time.Second)
+
+	stopped.Stop()
+	clock.Add(time.Second)
+
+	select {
+	case tick := <-stopped.C():
+		t.Errorf("Got tick at %v, expecting none once stopped", tick)
+	default:
+	}
+	if _, ok := <-running.C(); !ok {
+		t.Error("Got the channel closed, expecting the other ticker to tick")
+	}
+	if len(clock.tickers) != 1 {
+		t.Errorf("Got %d tickers, expecting the stopped one dropped", len(clock.tickers))
+	}
+
+	// stopping twice is harmless
+	stopped.Stop()
+	running.Stop()
+	if len(clock.tickers) != 0 {
+		t.Errorf("Got %d tickers, expecting none left", len(clock.tickers))
+	}
+}
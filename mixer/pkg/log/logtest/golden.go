@@ -0,0 +1,134 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// The fields the log package stamps entries with that vary from one run or machine to the next,
+// which Normalize drops.
+var nondeterministicFields = []string{"goroutine", "hostname", "pod", "namespace", "version", "sha"}
+
+// Normalize returns the given entries without what varies from one run to the next: their
+// timestamps, callers, and stack traces are cleared, the fields with the given keys are dropped
+// along with those of the process identity and goroutine IDs, and time and duration values are
+// replaced by placeholders.
+func Normalize(entries []Entry, ignoredFields ...string) []Entry {
+	ignored := make(map[string]bool)
+	for _, k := range append(nondeterministicFields, ignoredFields...) {
+		ignored[k] = true
+	}
+
+	normalized := make([]Entry, len(entries))
+	for i, e := range entries {
+		e.Time = time.Time{}
+		e.Caller = zapcore.EntryCaller{}
+		e.Stack = ""
+
+		fields := make(map[string]interface{}, len(e.Fields))
+		for k, v := range e.Fields {
+			if ignored[k] {
+				continue
+			}
+			switch v.(type) {
+			case time.Time:
+				v = "<time>"
+			case time.Duration:
+				v = "<duration>"
+			}
+			fields[k] = v
+		}
+		e.Fields = fields
+
+		normalized[i] = e
+	}
+	return normalized
+}
+
+// Transcript formats the given entries one per line, with their level, scope, message, and fields
+// sorted by key.
+func Transcript(entries []Entry) string {
+	var b strings.Builder
+	for _, e := range entries {
+		fmt.Fprintf(&b, "%s\t%s\t%s", e.Level, e.LoggerName, e.Message)
+		if len(e.Fields) > 0 {
+			var fields bytes.Buffer
+			enc := json.NewEncoder(&fields)
+			enc.SetEscapeHTML(false)
+			if err := enc.Encode(e.Fields); err == nil {
+				fmt.Fprintf(&b, "\t%s", bytes.TrimSpace(fields.Bytes()))
+			} else {
+				fmt.Fprintf(&b, "\t%v", e.Fields)
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// Refresh returns whether golden files are rewritten rather than compared against. It is set using
+// the environment variable REFRESH_GOLDEN.
+func Refresh() bool {
+	v, exists := os.LookupEnv("REFRESH_GOLDEN")
+	return exists && v == "true"
+}
+
+// CompareGolden fails the test unless the transcript of the given entries, once normalized with the
+// given fields ignored, matches the content of the golden file at the given path. The golden file
+// is rewritten instead when refreshing.
+func CompareGolden(t testing.TB, entries []Entry, path string, ignoredFields ...string) {
+	t.Helper()
+
+	transcript := Transcript(Normalize(entries, ignoredFields...))
+	if Refresh() {
+		t.Logf("Refreshing golden file %s", path)
+		if err := ioutil.WriteFile(path, []byte(transcript), 0644); err != nil {
+			t.Errorf("Got err '%v', expecting the golden file to be written", err)
+		}
+		return
+	}
+
+	golden, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Errorf("Got err '%v', expecting to read the golden file, which REFRESH_GOLDEN=true creates", err)
+		return
+	}
+
+	got := strings.Split(transcript, "\n")
+	expected := strings.Split(string(golden), "\n")
+	for i := 0; i < len(got) || i < len(expected); i++ {
+		var g, e string
+		if i < len(got) {
+			g = got[i]
+		}
+		if i < len(expected) {
+			e = expected[i]
+		}
+		if g != e {
+			t.Errorf("Got line %d\n%s\nexpecting\n%s\nin the transcript\n%s\ncompared to %s", i+1, g, e, transcript, path)
+			return
+		}
+	}
+}
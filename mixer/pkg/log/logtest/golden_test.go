@@ -0,0 +1,73 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logtest
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"istio.io/istio/mixer/pkg/log"
+)
+
+// logRequest logs like a request handler, with fields varying from one run to the next.
+func logRequest(id string) {
+	start := time.Now()
+	log.Named("api").Info("Request received", zap.String("id", id), zap.Time("at", start), zap.Int64("goroutine", 42))
+	log.Named("api").Warn("Request slow", zap.String("id", id), zap.Duration("latency", time.Since(start)), zap.String("trace", id+"-trace"))
+}
+
+func TestCompareGolden(t *testing.T) {
+	lt := Capture(t)
+	defer lt.Restore()
+
+	logRequest("1234")
+	CompareGolden(t, lt.Entries(), "testdata/request.golden", "trace")
+}
+
+func TestCompareGoldenMismatch(t *testing.T) {
+	lt := Capture(t)
+	defer lt.Restore()
+
+	logRequest("5678")
+
+	rt := &recordingT{TB: t}
+	CompareGolden(rt, lt.Entries(), "testdata/request.golden", "trace")
+	CompareGolden(rt, lt.Entries(), "testdata/missing.golden")
+	if len(rt.failures) != 2 {
+		t.Errorf("Got failures %v, expecting 2", rt.failures)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	entries := []Entry{{
+		Entry:  zapcore.Entry{Level: zapcore.InfoLevel, Time: time.Now(), Message: "Hello", Caller: zapcore.NewEntryCaller(0, "main.go", 10, true), Stack: "main.main()"},
+		Fields: map[string]interface{}{"hostname": "node-1", "count": 3},
+	}}
+
+	normalized := Normalize(entries)
+	if e := normalized[0]; !e.Time.IsZero() || e.Caller.Defined || e.Stack != "" || len(e.Fields) != 1 {
+		t.Errorf("Got %+v, expecting the timestamp, caller, stack, and hostname dropped", e)
+	}
+	if _, ok := entries[0].Fields["hostname"]; !ok {
+		t.Error("Got the entries passed in modified, expecting them to be left as they are")
+	}
+
+	if s := Transcript(normalized); s != "info\t\tHello\t{\"count\":3}\n" {
+		t.Errorf("Got '%s', expecting the entry on a line", s)
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logtest collects the entries of the log package in memory, so that tests can check what
+// the code under test logs without scraping its output:
+//
+//		func TestDenial(t *testing.T) {
+//			lt := logtest.Capture(t)
+//			defer lt.Restore()
+//
+//			check(request)
+//
+//			lt.AssertContains(zapcore.WarnLevel, "denied", logtest.Field("user", "alice"))
+//		}
+//
+// Entries are collected at every level, whatever the levels the log was configured with. Whole
+// transcripts can be checked against golden files with CompareGolden, once stripped of what varies
+// from one run to the next, and a Clock makes the timestamps and the periodic output of the log
+// the same on every run.
+package logtest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"istio.io/istio/mixer/pkg/log"
+)
+
+// Entry is an entry collected, with its fields decoded.
+type Entry struct {
+	zapcore.Entry
+
+	// Fields holds the values of the fields of the entry, including those added with With, by key.
+	Fields map[string]interface{}
+}
+
+// Matcher tells whether an entry is one looked for.
+type Matcher func(Entry) bool
+
+// Level matches the entries at the given level.
+func Level(level zapcore.Level) Matcher {
+	return func(e Entry) bool { return e.Level == level }
+}
+
+// Message matches the entries whose message contains the given text.
+func Message(substring string) Matcher {
+	return func(e Entry) bool { return strings.Contains(e.Message, substring) }
+}
+
+// Scope matches the entries of the given scope, the empty one being the default scope.
+func Scope(scope string) Matcher {
+	return func(e Entry) bool { return e.LoggerName == scope }
+}
+
+// HasField matches the entries with a field with the given key.
+func HasField(key string) Matcher {
+	return func(e Entry) bool {
+		_, ok := e.Fields[key]
+		return ok
+	}
+}
+
+// Field matches the entries with a field with the given key and value. Values are compared by
+// their default formatting, so that zap.Int("n", 3) matches Field("n", 3), and zap.Error(err)
+// matches Field("error", err.Error()).
+func Field(key string, value interface{}) Matcher {
+	return func(e Entry) bool {
+		v, ok := e.Fields[key]
+		return ok && fmt.Sprint(v) == fmt.Sprint(value)
+	}
+}
+
+// Log collects the entries of the log package.
+type Log struct {
+	t       testing.TB
+	restore func()
+
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// cleaner is implemented by the tests which run functions once done.
+type cleaner interface {
+	Cleanup(func())
+}
+
+// Capture makes the log package output to a new Log until it is restored, which happens once the
+// test is done where the testing package supports it. Deferring Restore works everywhere.
+func Capture(t testing.TB) *Log {
+	l := &Log{t: t}
+	l.restore = log.ReplaceLogger(zap.New(&core{log: l}))
+
+	if c, ok := t.(cleaner); ok {
+		c.Cleanup(l.Restore)
+	}
+	return l
+}
+
+// Restore makes the log package output to where it did before the capture. Restoring more than
+// once has no effect.
+func (l *Log) Restore() {
+	l.restore()
+}
+
+// Entries returns the entries collected so far, in the order they were logged.
+func (l *Log) Entries() []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]Entry(nil), l.entries...)
+}
+
+// Find returns the entries collected so far which match all the given matchers.
+func (l *Log) Find(matchers ...Matcher) []Entry {
+	var found []Entry
+	for _, e := range l.Entries() {
+		if matches(e, matchers) {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+// Reset drops the entries collected so far.
+func (l *Log) Reset() {
+	l.mu.Lock()
+	l.entries = nil
+	l.mu.Unlock()
+}
+
+// AssertContains fails the test unless an entry at the given level has a message containing the
+// given text, and matches all the given matchers.
+func (l *Log) AssertContains(level zapcore.Level, substring string, matchers ...Matcher) {
+	l.t.Helper()
+
+	if len(l.Find(append([]Matcher{Level(level), Message(substring)}, matchers...)...)) == 0 {
+		l.t.Errorf("Got no %s entry containing '%s' among\n%s", level, substring, l)
+	}
+}
+
+// AssertNotContains fails the test if an entry at the given level has a message containing the
+// given text, and matches all the given matchers.
+func (l *Log) AssertNotContains(level zapcore.Level, substring string, matchers ...Matcher) {
+	l.t.Helper()
+
+	if found := l.Find(append([]Matcher{Level(level), Message(substring)}, matchers...)...); len(found) > 0 {
+		l.t.Errorf("Got %d %s entries containing '%s', expecting none among\n%s", len(found), level, substring, l)
+	}
+}
+
+// String lists the entries collected so far, one per line.
+func (l *Log) String() string {
+	var b strings.Builder
+	for _, e := range l.Entries() {
+		fmt.Fprintf(&b, "%s\t%s\t%s\t%v\n", e.Level, e.LoggerName, e.Message, e.Fields)
+	}
+	return b.String()
+}
+
+func (l *Log) add(e Entry) {
+	l.mu.Lock()
+	l.entries = append(l.entries, e)
+	l.mu.Unlock()
+}
+
+func matches(e Entry, matchers []Matcher) bool {
+	for _, m := range matchers {
+		if !m(e) {
+			return false
+		}
+	}
+	return true
+}
+
+// core collects the entries written to it into a Log.
+type core struct {
+	log    *Log
+	fields []zapcore.Field
+}
+
+func (c *core) Enabled(zapcore.Level) bool {
+	return true
+}
+
+func (c *core) With(fields []zapcore.Field) zapcore.Core {
+	return &core{log: c.log, fields: append(c.fields[:len(c.fields):len(c.fields)], fields...)}
+}
+
+func (c *core) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return ce.AddCore(ent, c)
+}
+
+func (c *core) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+
+	c.log.add(Entry{Entry: ent, Fields: enc.Fields})
+	return nil
+}
+
+func (c *core) Sync() error {
+	return nil
+}
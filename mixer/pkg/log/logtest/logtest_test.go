@@ -0,0 +1,109 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logtest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"istio.io/istio/mixer/pkg/log"
+)
+
+// recordingT records the failures of assertions rather than failing the test.
+type recordingT struct {
+	testing.TB
+	failures []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.failures = append(t.failures, fmt.Sprintf(format, args...))
+}
+
+func TestCapture(t *testing.T) {
+	lt := Capture(t)
+	defer lt.Restore()
+
+	log.Debug("Starting")
+	log.Named("policy").Warn("Request denied", zap.String("user", "alice"), zap.Int("attempt", 3))
+	log.With(zap.Error(errors.New("unavailable"))).Error("Check failed")
+
+	entries := lt.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("Got %d entries, expecting 3:\n%s", len(entries), lt)
+	}
+	if e := entries[1]; e.LoggerName != "policy" || e.Fields["user"] != "alice" {
+		t.Errorf("Got %+v, expecting the warning with its scope and fields", e)
+	}
+
+	lt.AssertContains(zapcore.DebugLevel, "Starting")
+	lt.AssertContains(zapcore.WarnLevel, "denied", Scope("policy"), Field("user", "alice"), Field("attempt", 3))
+	lt.AssertContains(zapcore.ErrorLevel, "failed", Field("error", "unavailable"), HasField("error"))
+	lt.AssertNotContains(zapcore.InfoLevel, "denied")
+
+	if found := lt.Find(Level(zapcore.WarnLevel), Field("user", "bob")); len(found) != 0 {
+		t.Errorf("Got %d entries, expecting none for another user", len(found))
+	}
+
+	lt.Reset()
+	if entries := lt.Entries(); len(entries) != 0 {
+		t.Errorf("Got %d entries, expecting none once reset", len(entries))
+	}
+}
+
+func TestAssertionFailures(t *testing.T) {
+	rt := &recordingT{TB: t}
+	lt := Capture(rt)
+	defer lt.Restore()
+
+	log.Info("Hello")
+
+	rt.failures = nil
+	lt.AssertContains(zapcore.InfoLevel, "Goodbye")
+	lt.AssertContains(zapcore.WarnLevel, "Hello")
+	lt.AssertContains(zapcore.InfoLevel, "Hello", HasField("user"))
+	lt.AssertNotContains(zapcore.InfoLevel, "Hello")
+
+	if len(rt.failures) != 4 {
+		t.Errorf("Got failures %v, expecting 4", rt.failures)
+	}
+	for _, f := range rt.failures {
+		if !strings.Contains(f, "info\t\tHello") {
+			t.Errorf("Got '%s', expecting the failure to list the entries", f)
+		}
+	}
+}
+
+func TestRestore(t *testing.T) {
+	outer := Capture(t)
+	defer outer.Restore()
+
+	inner := Capture(t)
+	log.Info("Inner")
+	inner.Restore()
+	inner.Restore()
+
+	log.Info("Outer")
+
+	if len(inner.Entries()) != 1 || len(outer.Entries()) != 1 {
+		t.Errorf("Got inner\n%s\nouter\n%s\nexpecting one entry each", inner, outer)
+	}
+}
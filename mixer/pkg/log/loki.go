@@ -0,0 +1,268 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Loki output
+//
+// Entries are pushed to Grafana Loki when OutputPaths contains loki://host[:port] or
+// loki+https://host[:port], the path defaulting to /loki/api/v1/push. Entries are JSON-encoded
+// and grouped into streams according to their labels. These query parameters are supported:
+//
+//		labels         the labels extracted from each entry, scope,level by default. scope and level
+//		               refer to the entry's scope and level, other names to string fields of the entry
+//		label.<name>   a label with a fixed value added to every stream, for example label.job=mixer
+//		tenant         the tenant ID sent in the X-Scope-OrgID header
+//		batch          the maximum number of entries pushed at once, 1000 by default
+//		flush          the maximum time an entry waits to be pushed, 1s by default
+//		buffer         the maximum number of entries held while Loki is unreachable, 10000 by default
+//		timeout        the timeout of each push, 10s by default
+//
+// Credentials included in the URL are sent using basic authentication.
+
+const lokiDefaultPath = "/loki/api/v1/push"
+
+var lokiDefaultBatch = batchSettings{
+	size:     1000,
+	interval: time.Second,
+	buffer:   10000,
+	timeout:  10 * time.Second,
+}
+
+func init() {
+	RegisterSink("loki", newLokiSink)
+	RegisterSink("loki+https", newLokiSink)
+}
+
+// lokiEntry is an entry waiting to be pushed.
+type lokiEntry struct {
+	labels map[string]string
+	time   time.Time
+	line   string
+}
+
+// lokiCore outputs entries to Loki.
+type lokiCore struct {
+	zapcore.LevelEnabler
+
+	enc     zapcore.Encoder
+	batcher *batcher
+
+	// the labels extracted from the entries, and the values found in the fields added with With
+	extract []string
+	labels  map[string]string
+}
+
+func newLokiSink(u *url.URL, enab zapcore.LevelEnabler) (zapcore.Core, io.Closer, error) {
+	if u.Host == "" {
+		return nil, nil, fmt.Errorf("missing loki address in %s", u)
+	}
+
+	q := u.Query()
+	settings, err := parseBatchSettings(q, lokiDefaultBatch)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid loki settings in %s: %v", u, err)
+	}
+
+	target := url.URL{Scheme: "http", Host: u.Host, Path: u.Path}
+	if u.Scheme == "loki+https" {
+		target.Scheme = "https"
+	}
+	if target.Path == "" {
+		target.Path = lokiDefaultPath
+	}
+
+	header := http.Header{"Content-Type": []string{"application/json"}}
+	if t := q.Get("tenant"); t != "" {
+		header.Set("X-Scope-OrgID", t)
+	}
+
+	if u.User != nil {
+		password, _ := u.User.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + password))
+		header.Set("Authorization", "Basic "+auth)
+	}
+
+	extract := []string{scopeLabel, levelLabel}
+	if l := q.Get("labels"); l != "" {
+		extract = strings.Split(l, ",")
+	}
+
+	static := make(map[string]string)
+	for k, v := range q {
+		if strings.HasPrefix(k, "label.") && len(v) > 0 {
+			static[lokiLabelName(strings.TrimPrefix(k, "label."))] = v[0]
+		}
+	}
+
+	client := newSinkHTTPClient(settings.timeout, false)
+	push := func(batch []interface{}) error {
+		body, err := lokiPushBody(batch, static)
+		if err != nil {
+			return err
+		}
+
+		_, err = postBatch(client, target.String(), body, false, header)
+		return err
+	}
+
+	b := newBatcher("loki at "+u.Host, settings, push)
+	return &lokiCore{
+		LevelEnabler: enab,
+		enc:          newJSONEncoder(sinkEncoder),
+		batcher:      b,
+		extract:      extract,
+		labels:       make(map[string]string),
+	}, b, nil
+}
+
+func (c *lokiCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.enc = c.enc.Clone()
+	clone.labels = make(map[string]string, len(c.labels))
+	for k, v := range c.labels {
+		clone.labels[k] = v
+	}
+
+	for _, f := range fields {
+		f.AddTo(clone.enc)
+		if f.Type == zapcore.StringType {
+			clone.labels[f.Key] = f.String
+		}
+	}
+
+	return &clone
+}
+
+func (c *lokiCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *lokiCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	line := strings.TrimRight(buf.String(), "\n")
+	buf.Free()
+
+	labels := make(map[string]string, len(c.extract))
+	for _, name := range c.extract {
+		switch name {
+		case scopeLabel:
+			labels[scopeLabel] = scopeOf(ent)
+		case levelLabel:
+			labels[levelLabel] = ent.Level.String()
+		default:
+			if v, ok := c.labels[name]; ok {
+				labels[lokiLabelName(name)] = v
+			}
+			for _, f := range fields {
+				if f.Key == name && f.Type == zapcore.StringType {
+					labels[lokiLabelName(name)] = f.String
+				}
+			}
+		}
+	}
+
+	return c.batcher.enqueue(&lokiEntry{labels: labels, time: ent.Time, line: line})
+}
+
+func (c *lokiCore) Sync() error {
+	return c.batcher.sync()
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// lokiPushBody groups a batch of entries into streams, in the order the streams first appear.
+func lokiPushBody(batch []interface{}, static map[string]string) ([]byte, error) {
+	var streams []*lokiStream
+	index := make(map[string]*lokiStream)
+
+	for _, e := range batch {
+		entry := e.(*lokiEntry)
+
+		labels := make(map[string]string, len(static)+len(entry.labels))
+		for k, v := range static {
+			labels[k] = v
+		}
+		for k, v := range entry.labels {
+			labels[k] = v
+		}
+
+		key := lokiStreamKey(labels)
+		s, ok := index[key]
+		if !ok {
+			s = &lokiStream{Stream: labels}
+			index[key] = s
+			streams = append(streams, s)
+		}
+
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(entry.time.UnixNano(), 10), entry.line})
+	}
+
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(struct {
+		Streams []*lokiStream `json:"streams"`
+	}{streams})
+	return buf.Bytes(), err
+}
+
+func lokiStreamKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b bytes.Buffer
+	for _, k := range keys {
+		b.WriteString(k + "=" + strconv.Quote(labels[k]) + ",")
+	}
+	return b.String()
+}
+
+// lokiLabelName makes a field key a valid label name, made of letters, digits, and underscores
+// and not starting with a digit.
+func lokiLabelName(key string) string {
+	b := []byte(key)
+	for i, ch := range b {
+		if !(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch == '_' || (i > 0 && ch >= '0' && ch <= '9')) {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,194 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type lokiPush struct {
+	r       *http.Request
+	streams []lokiStream
+}
+
+// newFakeLoki records the pushes it receives, failing the first ones with the given status codes.
+func newFakeLoki(t *testing.T, failures ...int) (*httptest.Server, chan lokiPush) {
+	pushes := make(chan lokiPush, 100)
+	var count int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := int(atomic.AddInt32(&count, 1)); n <= len(failures) {
+			w.WriteHeader(failures[n-1])
+			return
+		}
+
+		var body struct {
+			Streams []lokiStream `json:"streams"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Unable to decode push: %v", err)
+		}
+
+		pushes <- lokiPush{r: r, streams: body.Streams}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	return server, pushes
+}
+
+func nextLokiPush(t *testing.T, pushes chan lokiPush) lokiPush {
+	select {
+	case p := <-pushes:
+		return p
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for loki push")
+		return lokiPush{}
+	}
+}
+
+func TestLoki(t *testing.T) {
+	server, pushes := newFakeLoki(t)
+	defer server.Close()
+
+	u := strings.Replace(server.URL, "http://", "loki://user:secret@", 1) + "?labels=scope,level,pod&label.job=mixer&tenant=acme"
+
+	o := NewOptions()
+	o.OutputPaths = []string{u}
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	l := With(zap.String("pod", "mixer-1"))
+	l.Info("Hello", zap.Int("count", 3))
+	l.Warn("Careful")
+	l.Info("Again")
+	Sync()
+
+	p := nextLokiPush(t, pushes)
+
+	if p.r.URL.Path != lokiDefaultPath {
+		t.Errorf("Got path %s, expecting %s", p.r.URL.Path, lokiDefaultPath)
+	}
+
+	if tenant := p.r.Header.Get("X-Scope-OrgID"); tenant != "acme" {
+		t.Errorf("Got tenant %s, expecting acme", tenant)
+	}
+
+	if user, password, ok := p.r.BasicAuth(); !ok || user != "user" || password != "secret" {
+		t.Errorf("Got credentials %s:%s, expecting user:secret", user, password)
+	}
+
+	expected := []map[string]string{
+		{"scope": "default", "level": "info", "pod": "mixer-1", "job": "mixer"},
+		{"scope": "default", "level": "warn", "pod": "mixer-1", "job": "mixer"},
+	}
+	if len(p.streams) != len(expected) {
+		t.Fatalf("Got %d streams, expecting %d", len(p.streams), len(expected))
+	}
+
+	for i, s := range p.streams {
+		if !reflect.DeepEqual(s.Stream, expected[i]) {
+			t.Errorf("Got labels %v, expecting %v", s.Stream, expected[i])
+		}
+	}
+
+	if n := len(p.streams[0].Values); n != 2 {
+		t.Fatalf("Got %d info entries, expecting 2", n)
+	}
+
+	var line map[string]interface{}
+	if err := json.Unmarshal([]byte(p.streams[0].Values[0][1]), &line); err != nil {
+		t.Fatalf("Unable to decode line: %v", err)
+	}
+
+	if line["msg"] != "Hello" || line["count"] != float64(3) || line["pod"] != "mixer-1" {
+		t.Errorf("Got line %v, expecting the encoded entry", line)
+	}
+}
+
+func TestLokiRetry(t *testing.T) {
+	server, pushes := newFakeLoki(t, http.StatusTooManyRequests, http.StatusInternalServerError)
+	defer server.Close()
+
+	u := strings.Replace(server.URL, "http://", "loki://", 1) + "/custom/push?labels=user"
+	core, closer, err := newLokiSink(mustParseURL(t, u), zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = closer.Close() }()
+
+	ent := zapcore.Entry{Message: "Hello", Time: time.Unix(1, 5)}
+	if err := core.Write(ent, []zapcore.Field{zap.String("user", "bob/1")}); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	if err := core.Sync(); err != nil {
+		t.Errorf("Got err '%v', expecting success", err)
+	}
+
+	p := nextLokiPush(t, pushes)
+	if p.r.URL.Path != "/custom/push" {
+		t.Errorf("Got path %s, expecting /custom/push", p.r.URL.Path)
+	}
+
+	if len(p.streams) != 1 || !reflect.DeepEqual(p.streams[0].Stream, map[string]string{"user": "bob/1"}) {
+		t.Fatalf("Got %v, expecting a single stream labelled with the user", p.streams)
+	}
+
+	if ts := p.streams[0].Values[0][0]; ts != "1000000005" {
+		t.Errorf("Got timestamp %s, expecting 1000000005", ts)
+	}
+}
+
+func TestLokiLabelName(t *testing.T) {
+	cases := map[string]string{
+		"pod":        "pod",
+		"k8s.pod-id": "k8s_pod_id",
+		"1st":        "_st",
+		"_ok2":       "_ok2",
+	}
+
+	for in, expected := range cases {
+		if got := lokiLabelName(in); got != expected {
+			t.Errorf("Got %s for %s, expecting %s", got, in, expected)
+		}
+	}
+}
+
+func TestLokiErrors(t *testing.T) {
+	cases := []string{
+		"loki://",
+		"loki://localhost?batch=0",
+		"loki://localhost?flush=never",
+	}
+
+	for _, c := range cases {
+		t.Run(c, func(t *testing.T) {
+			if _, _, err := newLokiSink(mustParseURL(t, c), zapcore.InfoLevel); err == nil {
+				t.Error("Got success, expecting error")
+			}
+		})
+	}
+}
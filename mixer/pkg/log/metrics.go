@@ -0,0 +1,132 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	levelLabel = "level"
+	scopeLabel = "scope"
+	sinkLabel  = "sink"
+
+	// defaultScopeName is the scope reported for entries emitted by an unnamed logger.
+	defaultScopeName = "default"
+)
+
+var (
+	entriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "istio",
+			Subsystem: "log",
+			Name:      "entries_total",
+			Help:      "Total number of log entries written, by level and scope.",
+		}, []string{levelLabel, scopeLabel})
+
+	sampledEntriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "istio",
+			Subsystem: "log",
+			Name:      "sampling_dropped_entries_total",
+			Help:      "Total number of log entries discarded by sampling, by level and scope.",
+		}, []string{levelLabel, scopeLabel})
+
+	samplingFactor = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "istio",
+			Subsystem: "log",
+			Name:      "sampling_factor",
+			Help:      "The factor by which adaptive sampling is currently tightening the sampling of log entries.",
+		})
+
+	sinkDroppedEntriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "istio",
+			Subsystem: "log",
+			Name:      "sink_dropped_entries_total",
+			Help:      "Total number of log entries dropped by a sink, because its buffer was full or the entries could not be sent, by sink.",
+		}, []string{sinkLabel})
+
+	asyncQueueDepth = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "istio",
+			Subsystem: "log",
+			Name:      "async_queue_depth",
+			Help:      "The number of log entries waiting to be written in asynchronous mode.",
+		})
+
+	asyncFlushLatency = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "istio",
+			Subsystem: "log",
+			Name:      "async_flush_latency_seconds",
+			Help:      "The time taken to write out the log entries queued in asynchronous mode, each time the queue is emptied.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+		})
+
+	asyncDroppedEntriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "istio",
+			Subsystem: "log",
+			Name:      "async_dropped_entries_total",
+			Help:      "Total number of log entries dropped in asynchronous mode because the queue was full, by level and scope.",
+		}, []string{levelLabel, scopeLabel})
+
+	metrics = collectors{entriesTotal, sampledEntriesTotal, samplingFactor, sinkDroppedEntriesTotal,
+		asyncQueueDepth, asyncFlushLatency, asyncDroppedEntriesTotal}
+)
+
+// collectors is a prometheus.Collector which aggregates all of the package's metrics.
+type collectors []prometheus.Collector
+
+// Describe implements prometheus.Collector.
+func (c collectors) Describe(ch chan<- *prometheus.Desc) {
+	for _, col := range c {
+		col.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c collectors) Collect(ch chan<- prometheus.Metric) {
+	for _, col := range c {
+		col.Collect(ch)
+	}
+}
+
+// Metrics returns a Prometheus collector exposing the logging subsystem's metrics.
+//
+// The collector is not registered automatically, programs that want these metrics
+// exported should register it with their registry of choice:
+//
+//	prometheus.MustRegister(log.Metrics())
+func Metrics() prometheus.Collector {
+	return metrics
+}
+
+// scopeOf returns the scope name under which the given entry is reported.
+func scopeOf(ent zapcore.Entry) string {
+	if ent.LoggerName == "" {
+		return defaultScopeName
+	}
+	return ent.LoggerName
+}
+
+// countEntry is a zap hook which tallies every entry that makes it through the core.
+func countEntry(ent zapcore.Entry) error {
+	entriesTotal.WithLabelValues(ent.Level.String(), scopeOf(ent)).Inc()
+	return nil
+}
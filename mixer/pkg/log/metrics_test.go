@@ -0,0 +1,93 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestEntriesTotal(t *testing.T) {
+	_, _ = captureStdout(func() {
+		o := NewOptions()
+		_ = o.SetOutputLevel(zapcore.InfoLevel)
+		if err := Configure(o); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		infoBefore := counterValue(t, "istio_log_entries_total", "info", "default")
+		debugBefore := counterValue(t, "istio_log_entries_total", "debug", "default")
+		namedBefore := counterValue(t, "istio_log_entries_total", "warn", "foo")
+
+		Info("Hello")
+		Infof("Hello %s", "World")
+		Debug("Not output")
+		zap.L().Named("foo").Warn("Named")
+		Sync()
+
+		if got := counterValue(t, "istio_log_entries_total", "info", "default") - infoBefore; got != 2 {
+			t.Errorf("Got %v info entries, expecting 2", got)
+		}
+
+		if got := counterValue(t, "istio_log_entries_total", "debug", "default") - debugBefore; got != 0 {
+			t.Errorf("Got %v debug entries, expecting 0", got)
+		}
+
+		if got := counterValue(t, "istio_log_entries_total", "warn", "foo") - namedBefore; got != 1 {
+			t.Errorf("Got %v warn entries for scope foo, expecting 1", got)
+		}
+	})
+}
+
+// counterValue returns the current value of the counter with the given name and level/scope labels,
+// as reported by the collector returned from Metrics().
+func counterValue(t *testing.T, name string, level string, scope string) float64 {
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(Metrics()); err != nil {
+		t.Fatalf("Unable to register metrics: %v", err)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Unable to gather metrics: %v", err)
+	}
+
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+
+		for _, m := range f.GetMetric() {
+			if labelValue(m, levelLabel) == level && labelValue(m, scopeLabel) == scope {
+				return m.GetCounter().GetValue()
+			}
+		}
+	}
+
+	return 0
+}
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, lp := range m.GetLabel() {
+		if lp.GetName() == name {
+			return lp.GetValue()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,418 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// A minimal MessagePack implementation, covering what the sinks speaking MessagePack-based
+// protocols need: encoding the values produced by zapcore.MapObjectEncoder, and decoding
+// the responses of the servers.
+
+func appendMsgpackNil(b []byte) []byte {
+	return append(b, 0xc0)
+}
+
+func appendMsgpackBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 0xc3)
+	}
+	return append(b, 0xc2)
+}
+
+func appendMsgpackInt(b []byte, v int64) []byte {
+	switch {
+	case v >= 0:
+		return appendMsgpackUint(b, uint64(v))
+	case v >= -32:
+		return append(b, byte(v))
+	case v >= math.MinInt8:
+		return append(b, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		return append(b, 0xd1, byte(v>>8), byte(v))
+	case v >= math.MinInt32:
+		return append(b, 0xd2, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	default:
+		b = append(b, 0xd3)
+		return appendUint64(b, uint64(v))
+	}
+}
+
+func appendMsgpackUint(b []byte, v uint64) []byte {
+	switch {
+	case v <= 0x7f:
+		return append(b, byte(v))
+	case v <= math.MaxUint8:
+		return append(b, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		return append(b, 0xcd, byte(v>>8), byte(v))
+	case v <= math.MaxUint32:
+		return append(b, 0xce, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	default:
+		b = append(b, 0xcf)
+		return appendUint64(b, v)
+	}
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendMsgpackFloat(b []byte, v float64) []byte {
+	b = append(b, 0xcb)
+	return appendUint64(b, math.Float64bits(v))
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n <= 31:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xda, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0xdb, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(b, s...)
+}
+
+func appendMsgpackBinary(b []byte, v []byte) []byte {
+	n := len(v)
+	switch {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xc5, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0xc6, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(b, v...)
+}
+
+func appendMsgpackArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return append(b, 0xdc, byte(n>>8), byte(n))
+	default:
+		return append(b, 0xdd, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+func appendMsgpackMapHeader(b []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return append(b, 0xde, byte(n>>8), byte(n))
+	default:
+		return append(b, 0xdf, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+// appendMsgpackExt encodes an extension value. Only the fixed sizes are supported.
+func appendMsgpackExt(b []byte, typ int8, data []byte) []byte {
+	switch len(data) {
+	case 1:
+		b = append(b, 0xd4)
+	case 2:
+		b = append(b, 0xd5)
+	case 4:
+		b = append(b, 0xd6)
+	case 8:
+		b = append(b, 0xd7)
+	case 16:
+		b = append(b, 0xd8)
+	default:
+		panic(fmt.Sprintf("unsupported msgpack extension size %d", len(data)))
+	}
+	b = append(b, byte(typ))
+	return append(b, data...)
+}
+
+// appendMsgpackValue encodes an arbitrary value. Maps are encoded with their keys sorted, and
+// types without a MessagePack equivalent are encoded through their JSON representation.
+func appendMsgpackValue(b []byte, v interface{}) []byte {
+	switch val := v.(type) {
+	case nil:
+		return appendMsgpackNil(b)
+	case bool:
+		return appendMsgpackBool(b, val)
+	case int:
+		return appendMsgpackInt(b, int64(val))
+	case int8:
+		return appendMsgpackInt(b, int64(val))
+	case int16:
+		return appendMsgpackInt(b, int64(val))
+	case int32:
+		return appendMsgpackInt(b, int64(val))
+	case int64:
+		return appendMsgpackInt(b, val)
+	case uint:
+		return appendMsgpackUint(b, uint64(val))
+	case uint8:
+		return appendMsgpackUint(b, uint64(val))
+	case uint16:
+		return appendMsgpackUint(b, uint64(val))
+	case uint32:
+		return appendMsgpackUint(b, uint64(val))
+	case uint64:
+		return appendMsgpackUint(b, val)
+	case uintptr:
+		return appendMsgpackUint(b, uint64(val))
+	case float32:
+		return appendMsgpackFloat(b, float64(val))
+	case float64:
+		return appendMsgpackFloat(b, val)
+	case string:
+		return appendMsgpackString(b, val)
+	case []byte:
+		return appendMsgpackBinary(b, val)
+	case time.Time:
+		return appendMsgpackString(b, val.Format(time.RFC3339Nano))
+	case time.Duration:
+		return appendMsgpackString(b, val.String())
+	case complex64, complex128:
+		return appendMsgpackString(b, fmt.Sprint(val))
+	case error:
+		return appendMsgpackString(b, val.Error())
+	case []interface{}:
+		b = appendMsgpackArrayHeader(b, len(val))
+		for _, e := range val {
+			b = appendMsgpackValue(b, e)
+		}
+		return b
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		b = appendMsgpackMapHeader(b, len(val))
+		for _, k := range keys {
+			b = appendMsgpackString(b, k)
+			b = appendMsgpackValue(b, val[k])
+		}
+		return b
+	}
+
+	// go through JSON to turn arbitrary types into maps, arrays, and scalars
+	data, err := json.Marshal(v)
+	if err != nil {
+		return appendMsgpackString(b, fmt.Sprint(v))
+	}
+
+	var generic interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err = d.Decode(&generic); err != nil {
+		return appendMsgpackString(b, string(data))
+	}
+
+	return appendMsgpackValue(b, fromJSON(generic))
+}
+
+// fromJSON converts the numbers within a decoded JSON value to integers where possible.
+func fromJSON(v interface{}) interface{} {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		f, _ := val.Float64()
+		return f
+	case []interface{}:
+		for i := range val {
+			val[i] = fromJSON(val[i])
+		}
+	case map[string]interface{}:
+		for k := range val {
+			val[k] = fromJSON(val[k])
+		}
+	}
+	return v
+}
+
+// msgpackExt is a decoded extension value.
+type msgpackExt struct {
+	Type int8
+	Data []byte
+}
+
+// readMsgpackValue decodes a single value. Maps are decoded as map[string]interface{} and
+// only support string keys, arrays as []interface{}, strings and binary values as strings,
+// integers as int64 or uint64, and floats as float64.
+func readMsgpackValue(r *bufio.Reader) (interface{}, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case tag <= 0x7f:
+		return int64(tag), nil
+	case tag >= 0xe0:
+		return int64(int8(tag)), nil
+	case tag&0xf0 == 0x80:
+		return readMsgpackMap(r, int(tag&0x0f))
+	case tag&0xf0 == 0x90:
+		return readMsgpackArray(r, int(tag&0x0f))
+	case tag&0xe0 == 0xa0:
+		return readMsgpackBytes(r, int(tag&0x1f))
+	}
+
+	switch tag {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xd9:
+		return readMsgpackSized(r, 1, readMsgpackBytes)
+	case 0xc5, 0xda:
+		return readMsgpackSized(r, 2, readMsgpackBytes)
+	case 0xc6, 0xdb:
+		return readMsgpackSized(r, 4, readMsgpackBytes)
+	case 0xca:
+		v, err := readMsgpackUint(r, 4)
+		return float64(math.Float32frombits(uint32(v))), err
+	case 0xcb:
+		v, err := readMsgpackUint(r, 8)
+		return math.Float64frombits(v), err
+	case 0xcc:
+		return readMsgpackUint(r, 1)
+	case 0xcd:
+		return readMsgpackUint(r, 2)
+	case 0xce:
+		return readMsgpackUint(r, 4)
+	case 0xcf:
+		return readMsgpackUint(r, 8)
+	case 0xd0:
+		v, err := readMsgpackUint(r, 1)
+		return int64(int8(v)), err
+	case 0xd1:
+		v, err := readMsgpackUint(r, 2)
+		return int64(int16(v)), err
+	case 0xd2:
+		v, err := readMsgpackUint(r, 4)
+		return int64(int32(v)), err
+	case 0xd3:
+		v, err := readMsgpackUint(r, 8)
+		return int64(v), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return readMsgpackExt(r, 1<<(tag-0xd4))
+	case 0xdc:
+		return readMsgpackSized(r, 2, readMsgpackArray)
+	case 0xdd:
+		return readMsgpackSized(r, 4, readMsgpackArray)
+	case 0xde:
+		return readMsgpackSized(r, 2, readMsgpackMap)
+	case 0xdf:
+		return readMsgpackSized(r, 4, readMsgpackMap)
+	}
+
+	return nil, fmt.Errorf("unsupported msgpack value with tag 0x%x", tag)
+}
+
+func readMsgpackUint(r *bufio.Reader, size int) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[:size]); err != nil {
+		return 0, err
+	}
+
+	var v uint64
+	for _, b := range buf[:size] {
+		v = v<<8 | uint64(b)
+	}
+	return v, nil
+}
+
+// readMsgpackSized reads a length of the given size, and then the value of that length.
+func readMsgpackSized(r *bufio.Reader, size int, read func(*bufio.Reader, int) (interface{}, error)) (interface{}, error) {
+	n, err := readMsgpackUint(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return read(r, int(n))
+}
+
+func readMsgpackBytes(r *bufio.Reader, n int) (interface{}, error) {
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return string(buf), nil
+}
+
+func readMsgpackExt(r *bufio.Reader, n int) (interface{}, error) {
+	typ, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return msgpackExt{Type: int8(typ), Data: data}, nil
+}
+
+func readMsgpackArray(r *bufio.Reader, n int) (interface{}, error) {
+	a := make([]interface{}, n)
+	for i := range a {
+		v, err := readMsgpackValue(r)
+		if err != nil {
+			return nil, err
+		}
+		a[i] = v
+	}
+	return a, nil
+}
+
+func readMsgpackMap(r *bufio.Reader, n int) (interface{}, error) {
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := readMsgpackValue(r)
+		if err != nil {
+			return nil, err
+		}
+
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("unsupported msgpack map key %v", k)
+		}
+
+		if m[key], err = readMsgpackValue(r); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
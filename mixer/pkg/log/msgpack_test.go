@@ -0,0 +1,126 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func decodeMsgpack(t *testing.T, b []byte) interface{} {
+	v, err := readMsgpackValue(bufio.NewReader(bytes.NewReader(b)))
+	if err != nil {
+		t.Fatalf("Unable to decode %x: %v", b, err)
+	}
+	return v
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	cases := []struct {
+		in  interface{}
+		out interface{}
+	}{
+		{nil, nil},
+		{true, true},
+		{false, false},
+		{0, int64(0)},
+		{127, int64(127)},
+		{-1, int64(-1)},
+		{-32, int64(-32)},
+		{-33, int64(-33)},
+		{int8(math.MinInt8), int64(math.MinInt8)},
+		{int16(math.MinInt16), int64(math.MinInt16)},
+		{int32(math.MinInt32), int64(math.MinInt32)},
+		{int64(math.MinInt64), int64(math.MinInt64)},
+		{uint8(200), uint64(200)},
+		{uint16(math.MaxUint16), uint64(math.MaxUint16)},
+		{uint32(math.MaxUint32), uint64(math.MaxUint32)},
+		{uint64(math.MaxUint64), uint64(math.MaxUint64)},
+		{float32(1.5), 1.5},
+		{2.25, 2.25},
+		{"", ""},
+		{strings.Repeat("a", 31), strings.Repeat("a", 31)},
+		{strings.Repeat("a", 32), strings.Repeat("a", 32)},
+		{strings.Repeat("a", 256), strings.Repeat("a", 256)},
+		{strings.Repeat("a", 65536), strings.Repeat("a", 65536)},
+		{[]byte("bin"), "bin"},
+		{time.Second, "1s"},
+		{errors.New("boom"), "boom"},
+		{[]interface{}{1, "a"}, []interface{}{int64(1), "a"}},
+		{make([]interface{}, 16), make([]interface{}, 16)},
+		{map[string]interface{}{"a": 1, "b": []interface{}{true}}, map[string]interface{}{"a": int64(1), "b": []interface{}{true}}},
+		{struct {
+			Name  string
+			Count int
+		}{"x", 2}, map[string]interface{}{"Name": "x", "Count": int64(2)}},
+	}
+
+	for _, c := range cases {
+		if v := decodeMsgpack(t, appendMsgpackValue(nil, c.in)); !reflect.DeepEqual(v, c.out) {
+			t.Errorf("Got %#v for %#v, expecting %#v", v, c.in, c.out)
+		}
+	}
+}
+
+func TestMsgpackLargeCollections(t *testing.T) {
+	m := make(map[string]interface{})
+	for i := 0; i < 20; i++ {
+		m[strings.Repeat("k", i+1)] = int64(i)
+	}
+
+	if v := decodeMsgpack(t, appendMsgpackValue(nil, m)); !reflect.DeepEqual(v, m) {
+		t.Errorf("Got %v, expecting %v", v, m)
+	}
+
+	b := appendMsgpackArrayHeader(nil, 70000)
+	for i := 0; i < 70000; i++ {
+		b = appendMsgpackNil(b)
+	}
+	if v := decodeMsgpack(t, b); len(v.([]interface{})) != 70000 {
+		t.Errorf("Got %d elements, expecting 70000", len(v.([]interface{})))
+	}
+}
+
+func TestMsgpackExt(t *testing.T) {
+	for _, size := range []int{1, 2, 4, 8, 16} {
+		data := bytes.Repeat([]byte{7}, size)
+		v := decodeMsgpack(t, appendMsgpackExt(nil, 3, data))
+		if !reflect.DeepEqual(v, msgpackExt{Type: 3, Data: data}) {
+			t.Errorf("Got %v, expecting extension of size %d", v, size)
+		}
+	}
+}
+
+func TestMsgpackDecodeErrors(t *testing.T) {
+	cases := [][]byte{
+		{},
+		{0xc1},
+		{0x81, 0x01, 0x01},
+		{0xa5, 'a'},
+		{0xcd, 0x01},
+	}
+
+	for _, c := range cases {
+		if _, err := readMsgpackValue(bufio.NewReader(bytes.NewReader(c))); err == nil {
+			t.Errorf("Got success decoding %x, expecting error", c)
+		}
+	}
+}
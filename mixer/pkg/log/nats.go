@@ -0,0 +1,310 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// NATS output
+//
+// Entries are published as JSON messages to a subject of a NATS server when OutputPaths contains
+// nats://[user:password@]host[:port]/subject, or nats+tls://... for a server requiring TLS, the
+// port defaulting to 4222. A user given without a password is sent as an authentication token.
+// These query parameters are supported:
+//
+//		buffer    the maximum number of entries held while the server is unreachable, 8192 by default
+//		timeout   the timeout for connecting and for publishing a batch of entries, 5s by default
+//
+// Entries are buffered and published in batches by a background goroutine, each batch followed by
+// a PING whose PONG confirms the server processed it. The goroutine reconnects with a jittered,
+// increasing delay when the server can't be reached or drops the connection, and publishes the
+// batch again. Entries are dropped once the buffer is full, as are those larger than the maximum
+// payload of the server, and counted by the istio_log_sink_dropped_entries_total metric.
+
+const (
+	natsDefaultPort    = "4222"
+	natsDefaultBuffer  = 8192
+	natsDefaultTimeout = 5 * time.Second
+)
+
+func init() {
+	RegisterSink("nats", newNATSSink)
+	RegisterSink("nats+tls", newNATSSink)
+}
+
+// natsInfo holds the settings of the INFO message the server greets its clients with which the
+// publisher follows.
+type natsInfo struct {
+	MaxPayload  int  `json:"max_payload"`
+	TLSRequired bool `json:"tls_required"`
+}
+
+// natsConnect is the CONNECT message the publisher answers the INFO message with.
+type natsConnect struct {
+	Verbose   bool   `json:"verbose"`
+	Pedantic  bool   `json:"pedantic"`
+	Name      string `json:"name"`
+	Lang      string `json:"lang"`
+	Protocol  int    `json:"protocol"`
+	User      string `json:"user,omitempty"`
+	Pass      string `json:"pass,omitempty"`
+	AuthToken string `json:"auth_token,omitempty"`
+}
+
+// natsProtocol publishes the entries of a networkWriter to a NATS subject, each batch followed by a
+// PING whose PONG confirms the server processed it.
+type natsProtocol struct {
+	addr    string
+	subject string
+	options natsConnect
+	tls     *tls.Config
+	timeout time.Duration
+
+	// the reader of the current connection and the maximum payload of its server, only used by
+	// the background goroutine of the writer
+	r          *bufio.Reader
+	maxPayload int
+}
+
+// connect connects to the server, upgrading the connection to TLS once greeted when required, and
+// introduces the publisher.
+func (p *natsProtocol) connect() (net.Conn, error) {
+	conn, err := dialSink("tcp", p.addr, p.timeout, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = conn.SetDeadline(time.Now().Add(p.timeout)); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	line, err := readNATSLine(r)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("unable to read the greeting of the server: %v", err)
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		_ = conn.Close()
+		return nil, fmt.Errorf("unexpected greeting from the server: %s", line)
+	}
+
+	var info natsInfo
+	if err = json.Unmarshal([]byte(line[len("INFO "):]), &info); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("invalid greeting from the server: %v", err)
+	}
+
+	if p.tls != nil {
+		tlsConn := tls.Client(conn, p.tls)
+		if err = tlsConn.Handshake(); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		conn, r = tlsConn, bufio.NewReader(tlsConn)
+	} else if info.TLSRequired {
+		_ = conn.Close()
+		return nil, fmt.Errorf("the server requires TLS, use nats+tls://%s/%s", p.addr, p.subject)
+	}
+
+	connect, _ := json.Marshal(p.options)
+	p.r, p.maxPayload = r, info.MaxPayload
+	if _, err = conn.Write(append(append([]byte("CONNECT "), connect...), "\r\nPING\r\n"...)); err == nil {
+		err = p.awaitPong(conn)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (p *natsProtocol) send(conn net.Conn, entries [][]byte) ([][]byte, error) {
+	var msg []byte
+	sent := make([][]byte, 0, len(entries))
+	for _, e := range entries {
+		// the server would reject the entries larger than its maximum payload
+		if p.maxPayload > 0 && len(e) > p.maxPayload {
+			continue
+		}
+		msg = append(msg, "PUB "+p.subject+" "+strconv.Itoa(len(e))+"\r\n"...)
+		msg = append(append(msg, e...), "\r\n"...)
+		sent = append(sent, e)
+	}
+
+	if len(msg) == 0 {
+		return sent, nil
+	}
+	msg = append(msg, "PING\r\n"...)
+
+	err := conn.SetDeadline(time.Now().Add(p.timeout))
+	if err == nil {
+		if _, err = conn.Write(msg); err == nil {
+			err = p.awaitPong(conn)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sent, nil
+}
+
+// awaitPong reads the messages of the server until the PONG answering the last PING, answering
+// the PINGs of the server along the way. Errors reported by the server are returned.
+func (p *natsProtocol) awaitPong(conn net.Conn) error {
+	for {
+		line, err := readNATSLine(p.r)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err = conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("server error: %s", strings.TrimSpace(line[len("-ERR"):]))
+		}
+	}
+}
+
+// readNATSLine reads a line of the protocol, without its CRLF.
+func readNATSLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// natsCore encodes entries as JSON messages and hands them over to a networkWriter publishing them.
+type natsCore struct {
+	zapcore.LevelEnabler
+
+	enc zapcore.Encoder
+	w   *networkWriter
+}
+
+func newNATSSink(u *url.URL, enab zapcore.LevelEnabler) (zapcore.Core, io.Closer, error) {
+	if u.Hostname() == "" {
+		return nil, nil, fmt.Errorf("missing NATS server address in %s", u)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = natsDefaultPort
+	}
+
+	subject := strings.TrimPrefix(u.Path, "/")
+	if subject == "" {
+		return nil, nil, fmt.Errorf("missing NATS subject in %s", u)
+	}
+	if strings.ContainsAny(subject, " \t\r\n*>") {
+		return nil, nil, fmt.Errorf("invalid NATS subject %s", subject)
+	}
+
+	connect := natsConnect{Name: "istio", Lang: "go", Protocol: 1}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			connect.User, connect.Pass = u.User.Username(), pass
+		} else {
+			connect.AuthToken = u.User.Username()
+		}
+	}
+
+	q := u.Query()
+
+	buffer := natsDefaultBuffer
+	if b := q.Get("buffer"); b != "" {
+		var err error
+		if buffer, err = strconv.Atoi(b); err != nil || buffer < 1 {
+			return nil, nil, fmt.Errorf("invalid NATS buffer size %s", b)
+		}
+	}
+
+	timeout := natsDefaultTimeout
+	if t := q.Get("timeout"); t != "" {
+		var err error
+		if timeout, err = time.ParseDuration(t); err != nil || timeout <= 0 {
+			return nil, nil, fmt.Errorf("invalid NATS timeout %s", t)
+		}
+	}
+
+	var tlsConfig *tls.Config
+	if u.Scheme == "nats+tls" {
+		tlsConfig = sinkTLSConfig()
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = u.Hostname()
+		}
+	}
+
+	addr := net.JoinHostPort(u.Hostname(), port)
+	proto := &natsProtocol{addr: addr, subject: subject, options: connect, tls: tlsConfig, timeout: timeout}
+	w := newNetworkWriter(u.Scheme+"://"+addr+"/"+subject, proto, buffer, timeout)
+	return &natsCore{
+		LevelEnabler: enab,
+		enc:          newJSONEncoder(sinkEncoder),
+		w:            w,
+	}, w, nil
+}
+
+func (c *natsCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.enc = c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(clone.enc)
+	}
+	return &clone
+}
+
+func (c *natsCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *natsCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+
+	// each entry is a message of its own, without the line ending
+	entry := append([]byte(nil), bytes.TrimRight(buf.Bytes(), "\n")...)
+	buf.Free()
+	return c.w.enqueue(entry)
+}
+
+func (c *natsCore) Sync() error {
+	return c.w.sync()
+}
@@ -0,0 +1,204 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// natsMessage is a message published to the fake NATS server.
+type natsMessage struct {
+	subject string
+	payload string
+}
+
+// fakeNATSServer speaks enough of the NATS protocol to accept published messages.
+type fakeNATSServer struct {
+	l        net.Listener
+	connects chan natsConnect
+	messages chan natsMessage
+	conns    chan net.Conn
+}
+
+func newFakeNATSServer(t *testing.T) *fakeNATSServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+
+	s := &fakeNATSServer{
+		l:        l,
+		connects: make(chan natsConnect, 10),
+		messages: make(chan natsMessage, 100),
+		conns:    make(chan net.Conn, 10),
+	}
+	go s.serve()
+	return s
+}
+
+func (s *fakeNATSServer) serve() {
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		s.conns <- conn
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeNATSServer) handle(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	if _, err := fmt.Fprintf(conn, "INFO {\"server_id\":\"fake\",\"max_payload\":256}\r\n"); err != nil {
+		return
+	}
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := readNATSLine(r)
+		if err != nil {
+			return
+		}
+
+		switch {
+		case strings.HasPrefix(line, "CONNECT "):
+			var c natsConnect
+			_ = json.Unmarshal([]byte(line[len("CONNECT "):]), &c)
+			s.connects <- c
+
+		case line == "PING":
+			if _, err = conn.Write([]byte("PONG\r\n")); err != nil {
+				return
+			}
+
+		case strings.HasPrefix(line, "PUB "):
+			parts := strings.Fields(line)
+			n, _ := strconv.Atoi(parts[2])
+			payload := make([]byte, n+2)
+			if _, err = io.ReadFull(r, payload); err != nil {
+				return
+			}
+			s.messages <- natsMessage{parts[1], string(payload[:n])}
+		}
+	}
+}
+
+func (s *fakeNATSServer) close() {
+	_ = s.l.Close()
+}
+
+func (s *fakeNATSServer) next(t *testing.T) natsMessage {
+	select {
+	case m := <-s.messages:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a message")
+		return natsMessage{}
+	}
+}
+
+func TestNATSSink(t *testing.T) {
+	s := newFakeNATSServer(t)
+	defer s.close()
+
+	core, closer, err := newNATSSink(mustParseURL(t, "nats://bob:secret@"+s.l.Addr().String()+"/istio.logs"), zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = closer.Close() }()
+
+	logger := zap.New(core).With(zap.String("user", "bob"))
+	logger.Debug("Not output")
+	logger.Info("Hello", zap.Int("count", 3))
+	logger.Info("Too large", zap.String("data", strings.Repeat("a", 300)))
+	logger.Warn("World")
+
+	if err := core.Sync(); err != nil {
+		t.Errorf("Got err '%v', expecting success", err)
+	}
+
+	if c := <-s.connects; c.User != "bob" || c.Pass != "secret" || c.Verbose {
+		t.Errorf("Got %+v, expecting the credentials of the URL", c)
+	}
+
+	for _, expected := range []string{`"msg":"Hello","log_schema":2,"user":"bob","count":3}`, `"msg":"World","log_schema":2,"user":"bob"}`} {
+		if m := s.next(t); m.subject != "istio.logs" || !strings.HasSuffix(m.payload, expected) {
+			t.Errorf("Got %+v, expecting a message to istio.logs ending with %s", m, expected)
+		}
+	}
+	// the entry larger than the maximum payload of the server is dropped
+	var m dto.Metric
+	_ = sinkDroppedEntriesTotal.WithLabelValues("nats://" + s.l.Addr().String() + "/istio.logs").Write(&m)
+	if got := m.GetCounter().GetValue(); got != 1 {
+		t.Errorf("Got %v dropped entries, expecting 1", got)
+	}
+}
+
+func TestNATSSinkReconnect(t *testing.T) {
+	s := newFakeNATSServer(t)
+	defer s.close()
+
+	core, closer, err := newNATSSink(mustParseURL(t, "nats://token@"+s.l.Addr().String()+"/logs"), zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = closer.Close() }()
+
+	logger := zap.New(core)
+	logger.Info("One")
+	if m := s.next(t); !strings.Contains(m.payload, `"msg":"One"`) {
+		t.Errorf("Got %+v, expecting One", m)
+	}
+	if c := <-s.connects; c.AuthToken != "token" {
+		t.Errorf("Got %+v, expecting the token of the URL", c)
+	}
+
+	// the server drops the connection, the entry gets published over a new one
+	_ = (<-s.conns).Close()
+	logger.Info("Two")
+	if m := s.next(t); !strings.Contains(m.payload, `"msg":"Two"`) {
+		t.Errorf("Got %+v, expecting Two", m)
+	}
+}
+
+func TestNATSSinkErrors(t *testing.T) {
+	cases := []string{
+		"nats:///logs",
+		"nats://localhost",
+		"nats://localhost/",
+		"nats://localhost/logs.*",
+		"nats://localhost/logs?buffer=0",
+		"nats://localhost/logs?timeout=soon",
+	}
+
+	for _, c := range cases {
+		if _, _, err := newNATSSink(mustParseURL(t, c), zapcore.InfoLevel); err == nil {
+			t.Errorf("Got success for %s, expecting error", c)
+		}
+	}
+}
@@ -0,0 +1,438 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap/zapcore"
+)
+
+// Network output
+//
+// Entries are sent as JSON lines to a collector, such as the TCP input of fluent-bit or vector,
+// when OutputPaths contains tcp://host:port, tcp+tls://host:port, or udp://host:port, or to a
+// node-local agent when it contains unix:///path/to/socket, for a Unix domain stream socket.
+// Over UDP, each entry is sent in a datagram of its own. These query parameters are supported:
+//
+//		buffer    the maximum number of entries held while the collector is unreachable, 8192 by default
+//		timeout   the timeout for connecting and for writing entries, 5s by default
+//
+// Entries are buffered and written by a background goroutine, which reconnects with a jittered,
+// increasing delay when the collector can't be reached, such as while an agent restarts and
+// recreates its socket. Entries are dropped once the buffer is
+// full, and counted by the istio_log_sink_dropped_entries_total metric.
+
+const (
+	networkDefaultBuffer  = 8192
+	networkDefaultTimeout = 5 * time.Second
+	networkMaxBatch       = 512
+	networkMinBackoff     = 100 * time.Millisecond
+	networkMaxBackoff     = 10 * time.Second
+	networkErrorInterval  = 10 * time.Second
+)
+
+var errNetworkBufferFull = errors.New("network sink buffer full, entry dropped")
+
+// networkErrorKey rate-limits the reporting of failures.
+type networkErrorKey string
+
+func init() {
+	RegisterSink("tcp", newNetworkSink)
+	RegisterSink("tcp+tls", newNetworkSink)
+	RegisterSink("udp", newNetworkSink)
+	RegisterSink("unix", newNetworkSink)
+}
+
+// networkProtocol is how a networkWriter talks to its collector.
+type networkProtocol interface {
+	// connect establishes a connection to the collector.
+	connect() (net.Conn, error)
+
+	// send makes a single attempt at sending a batch of entries over the given connection, and
+	// returns the entries sent, leaving out those the collector would reject.
+	send(conn net.Conn, entries [][]byte) ([][]byte, error)
+}
+
+// networkWriter writes encoded entries to a collector from a background goroutine, in the protocol
+// it is given.
+type networkWriter struct {
+	name    string
+	proto   networkProtocol
+	timeout time.Duration
+	dropped prometheus.Counter
+
+	queue chan []byte
+	flush chan chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+
+	// the status of the output, if tracked
+	stats atomic.Value // *sinkStats
+
+	// only used by the background goroutine
+	conn net.Conn
+}
+
+func newNetworkWriter(name string, proto networkProtocol, buffer int, timeout time.Duration) *networkWriter {
+	w := &networkWriter{
+		name:    name,
+		proto:   proto,
+		timeout: timeout,
+		dropped: sinkDroppedEntriesTotal.WithLabelValues(name),
+		queue:   make(chan []byte, buffer),
+		flush:   make(chan chan struct{}),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	go w.run()
+	return w
+}
+
+// enqueue hands an encoded entry over to the background goroutine, without blocking.
+func (w *networkWriter) enqueue(entry []byte) error {
+	select {
+	case w.queue <- entry:
+		return nil
+	default:
+		w.dropped.Inc()
+		return errNetworkBufferFull
+	}
+}
+
+// sync waits for the entries buffered so far to be written.
+func (w *networkWriter) sync() error {
+	ch := make(chan struct{})
+	timeout := time.After(w.timeout)
+
+	select {
+	case w.flush <- ch:
+	case <-w.done:
+		return nil
+	case <-timeout:
+		return fmt.Errorf("timed out flushing log entries to %s", w.name)
+	}
+
+	select {
+	case <-ch:
+		return nil
+	case <-timeout:
+		return fmt.Errorf("timed out flushing log entries to %s", w.name)
+	}
+}
+
+func (w *networkWriter) reportStatus(s *sinkStats) {
+	s.background = true
+	w.stats.Store(s)
+}
+
+func (w *networkWriter) status() *sinkStats {
+	s, _ := w.stats.Load().(*sinkStats)
+	return s
+}
+
+// Close writes any buffered entries, giving up on those left once the timeout is over, and stops the
+// background goroutine.
+func (w *networkWriter) Close() error {
+	close(w.stop)
+	<-w.done
+	return nil
+}
+
+func (w *networkWriter) run() {
+	defer close(w.done)
+
+	for {
+		select {
+		case entry := <-w.queue:
+			w.deliver(w.batch(entry))
+
+		case ch := <-w.flush:
+			for len(w.queue) > 0 {
+				w.deliver(w.batch(<-w.queue))
+			}
+			close(ch)
+
+		case <-w.stop:
+			w.drain()
+
+			if w.conn != nil {
+				_ = w.conn.Close()
+			}
+			return
+		}
+	}
+}
+
+// batch gathers the given entry along with any others waiting in the queue.
+func (w *networkWriter) batch(first []byte) [][]byte {
+	entries := [][]byte{first}
+	for len(entries) < networkMaxBatch {
+		select {
+		case entry := <-w.queue:
+			entries = append(entries, entry)
+		default:
+			return entries
+		}
+	}
+	return entries
+}
+
+// deliver writes a batch of entries, retrying with a jittered, increasing delay until it succeeds
+// or the writer is stopped.
+func (w *networkWriter) deliver(entries [][]byte) {
+	backoff := networkMinBackoff
+
+	for {
+		err := w.send(entries)
+		if err == nil {
+			return
+		}
+		w.status().failed(err)
+
+		// this can't go through the logger itself
+		if limits.every(networkErrorKey(w.name), networkErrorInterval, now()) {
+			reportError("unable to send log entries to %s: %v", w.name, err)
+		}
+
+		select {
+		case <-w.stop:
+			w.drop(len(entries))
+			return
+		case <-time.After(jitter(backoff)):
+		}
+
+		if backoff *= 2; backoff > networkMaxBackoff {
+			backoff = networkMaxBackoff
+		}
+	}
+}
+
+// drain writes the entries left in the queue once the writer is stopped, retrying like deliver does
+// until the timeout is over, and counts those which couldn't be written as dropped.
+func (w *networkWriter) drain() {
+	deadline := time.After(w.timeout)
+	backoff := networkMinBackoff
+
+	for len(w.queue) > 0 {
+		select {
+		case <-deadline:
+			w.drop(len(w.queue))
+			return
+		default:
+		}
+
+		entries := w.batch(<-w.queue)
+		for err := w.send(entries); err != nil; err = w.send(entries) {
+			w.status().failed(err)
+
+			select {
+			case <-deadline:
+				w.drop(len(entries) + len(w.queue))
+				return
+			case <-time.After(jitter(backoff)):
+			}
+
+			if backoff *= 2; backoff > networkMaxBackoff {
+				backoff = networkMaxBackoff
+			}
+		}
+	}
+}
+
+// drop counts entries which won't be written.
+func (w *networkWriter) drop(n int) {
+	w.dropped.Add(float64(n))
+	w.status().drop(n)
+}
+
+// jitter spreads delays over [d/2, d), so that many processes losing the same collector don't
+// reconnect in lockstep.
+func jitter(d time.Duration) time.Duration {
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
+
+// send makes a single attempt at writing a batch of entries, connecting first if needed. The
+// connection is dropped on failure, to be established again by the next attempt.
+func (w *networkWriter) send(entries [][]byte) error {
+	if w.conn == nil {
+		conn, err := w.proto.connect()
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+	}
+
+	sent, err := w.proto.send(w.conn, entries)
+	if err != nil {
+		_ = w.conn.Close()
+		w.conn = nil
+		return err
+	}
+
+	// the entries the collector would reject are only counted once the batch is through, as it may
+	// be sent several times
+	if rejected := len(entries) - len(sent); rejected > 0 {
+		w.drop(rejected)
+	}
+	for _, e := range sent {
+		w.status().wrote(len(e))
+	}
+	w.status().recovered()
+	return nil
+}
+
+// socketProtocol writes the entries as they are to a socket: over TCP in a single write, and over
+// UDP in a datagram each.
+type socketProtocol struct {
+	network string
+	addr    string
+	tls     *tls.Config
+	timeout time.Duration
+}
+
+func (p *socketProtocol) connect() (net.Conn, error) {
+	return dialSink(p.network, p.addr, p.timeout, p.tls)
+}
+
+func (p *socketProtocol) send(conn net.Conn, entries [][]byte) ([][]byte, error) {
+	if err := conn.SetWriteDeadline(time.Now().Add(p.timeout)); err != nil {
+		return nil, err
+	}
+
+	if p.network == "udp" {
+		for _, e := range entries {
+			if _, err := conn.Write(e); err != nil {
+				return nil, err
+			}
+		}
+		return entries, nil
+	}
+
+	var size int
+	for _, e := range entries {
+		size += len(e)
+	}
+
+	msg := make([]byte, 0, size)
+	for _, e := range entries {
+		msg = append(msg, e...)
+	}
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// networkCore encodes entries as JSON lines and hands them over to a networkWriter.
+type networkCore struct {
+	zapcore.LevelEnabler
+
+	enc zapcore.Encoder
+	w   *networkWriter
+}
+
+func newNetworkSink(u *url.URL, enab zapcore.LevelEnabler) (zapcore.Core, io.Closer, error) {
+	var addr string
+	if u.Scheme == "unix" {
+		if u.Path == "" {
+			return nil, nil, fmt.Errorf("missing collector socket path in %s", u)
+		}
+		addr = u.Path
+	} else {
+		if u.Hostname() == "" {
+			return nil, nil, fmt.Errorf("missing collector address in %s", u)
+		}
+
+		if u.Port() == "" {
+			return nil, nil, fmt.Errorf("missing collector port in %s", u)
+		}
+		addr = net.JoinHostPort(u.Hostname(), u.Port())
+	}
+
+	q := u.Query()
+
+	buffer := networkDefaultBuffer
+	if b := q.Get("buffer"); b != "" {
+		var err error
+		if buffer, err = strconv.Atoi(b); err != nil || buffer < 1 {
+			return nil, nil, fmt.Errorf("invalid buffer size %s", b)
+		}
+	}
+
+	timeout := networkDefaultTimeout
+	if t := q.Get("timeout"); t != "" {
+		var err error
+		if timeout, err = time.ParseDuration(t); err != nil || timeout <= 0 {
+			return nil, nil, fmt.Errorf("invalid timeout %s", t)
+		}
+	}
+
+	var tlsConfig *tls.Config
+	if u.Scheme == "tcp+tls" {
+		tlsConfig = sinkTLSConfig()
+	}
+
+	proto := &socketProtocol{network: strings.TrimSuffix(u.Scheme, "+tls"), addr: addr, tls: tlsConfig, timeout: timeout}
+	w := newNetworkWriter(u.Scheme+"://"+addr, proto, buffer, timeout)
+	return &networkCore{
+		LevelEnabler: enab,
+		enc:          newJSONEncoder(sinkEncoder),
+		w:            w,
+	}, w, nil
+}
+
+func (c *networkCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.enc = c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(clone.enc)
+	}
+	return &clone
+}
+
+func (c *networkCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *networkCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+
+	entry := append([]byte(nil), buf.Bytes()...)
+	buf.Free()
+	return c.w.enqueue(entry)
+}
+
+func (c *networkCore) Sync() error {
+	return c.w.sync()
+}
@@ -0,0 +1,310 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// fakeCollector accepts stream connections and reads JSON lines from them.
+type fakeCollector struct {
+	l     net.Listener
+	lines chan string
+	conns chan net.Conn
+}
+
+func newFakeCollector(t *testing.T, network string, addr string) *fakeCollector {
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+
+	c := &fakeCollector{l: l, lines: make(chan string, 100), conns: make(chan net.Conn, 10)}
+	go c.serve()
+	return c
+}
+
+func (c *fakeCollector) serve() {
+	for {
+		conn, err := c.l.Accept()
+		if err != nil {
+			return
+		}
+		c.conns <- conn
+
+		go func() {
+			s := bufio.NewScanner(conn)
+			for s.Scan() {
+				c.lines <- s.Text()
+			}
+		}()
+	}
+}
+
+func (c *fakeCollector) close() {
+	_ = c.l.Close()
+}
+
+func (c *fakeCollector) next(t *testing.T) string {
+	select {
+	case line := <-c.lines:
+		return line
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for an entry")
+		return ""
+	}
+}
+
+func TestNetworkSinkTCP(t *testing.T) {
+	c := newFakeCollector(t, "tcp", "127.0.0.1:0")
+	defer c.close()
+
+	core, closer, err := newNetworkSink(mustParseURL(t, "tcp://"+c.l.Addr().String()), zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = closer.Close() }()
+
+	logger := zap.New(core).With(zap.String("user", "bob"))
+	logger.Debug("Not output")
+	logger.Info("Hello", zap.Int("count", 3))
+	logger.Warn("World")
+
+	if err := core.Sync(); err != nil {
+		t.Errorf("Got err '%v', expecting success", err)
+	}
+
+	for _, expected := range []string{`"msg":"Hello","log_schema":2,"user":"bob","count":3}`, `"msg":"World","log_schema":2,"user":"bob"}`} {
+		if line := c.next(t); !strings.HasSuffix(line, expected) {
+			t.Errorf("Got '%s', expecting it to end with %s", line, expected)
+		}
+	}
+}
+
+func TestNetworkSinkReconnect(t *testing.T) {
+	c := newFakeCollector(t, "tcp", "127.0.0.1:0")
+	defer c.close()
+
+	core, closer, err := newNetworkSink(mustParseURL(t, "tcp://"+c.l.Addr().String()), zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = closer.Close() }()
+
+	stats := &sinkStats{}
+	closer.(statusReporter).reportStatus(stats)
+
+	logger := zap.New(core)
+	logger.Info("One")
+	if line := c.next(t); !strings.Contains(line, `"msg":"One"`) {
+		t.Errorf("Got '%s', expecting One", line)
+	}
+
+	// the collector drops the connection, the entries following the failure are sent again
+	// over a new one
+	_ = (<-c.conns).Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		logger.Info("Two")
+		_ = core.Sync()
+
+		select {
+		case line := <-c.lines:
+			if !strings.Contains(line, `"msg":"Two"`) {
+				t.Errorf("Got '%s', expecting Two", line)
+			}
+			if s := stats.status(); s.Failing {
+				t.Errorf("Got %+v, expecting the output to have recovered", s)
+			}
+			return
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the entry to be sent again")
+		}
+	}
+}
+
+func TestNetworkSinkUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lognet")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	path := filepath.Join(dir, "collector.sock")
+	c := newFakeCollector(t, "unix", path)
+
+	core, closer, err := newNetworkSink(mustParseURL(t, "unix://"+path), zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = closer.Close() }()
+
+	stats := &sinkStats{}
+	closer.(statusReporter).reportStatus(stats)
+
+	logger := zap.New(core)
+	logger.Info("One")
+	if line := c.next(t); !strings.Contains(line, `"msg":"One"`) {
+		t.Errorf("Got '%s', expecting One", line)
+	}
+
+	// the agent restarts, recreating its socket
+	c.close()
+	_ = (<-c.conns).Close()
+	_ = os.Remove(path)
+	c = newFakeCollector(t, "unix", path)
+	defer c.close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		logger.Info("Two")
+		_ = core.Sync()
+
+		select {
+		case line := <-c.lines:
+			if !strings.Contains(line, `"msg":"Two"`) {
+				t.Errorf("Got '%s', expecting Two", line)
+			}
+			if s := stats.status(); s.Failing {
+				t.Errorf("Got %+v, expecting the output to have recovered", s)
+			}
+			return
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the entry to be sent over a new connection")
+		}
+	}
+}
+
+func TestNetworkSinkUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer func() { _ = pc.Close() }()
+
+	core, closer, err := newNetworkSink(mustParseURL(t, "udp://"+pc.LocalAddr().String()), zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = closer.Close() }()
+
+	stats := &sinkStats{}
+	closer.(statusReporter).reportStatus(stats)
+
+	logger := zap.New(core)
+	logger.Info("One")
+	logger.Info("Two")
+	_ = core.Sync()
+
+	_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, m := range []string{"One", "Two"} {
+		b := make([]byte, 65536)
+		n, _, err := pc.ReadFrom(b)
+		if err != nil {
+			t.Fatalf("Unable to read datagram: %v", err)
+		}
+
+		if s := string(b[:n]); !strings.Contains(s, `"msg":"`+m+`"`) || !strings.HasSuffix(s, "}\n") {
+			t.Errorf("Got '%s', expecting a single line with %s", s, m)
+		}
+	}
+}
+
+func TestNetworkSinkDropped(t *testing.T) {
+	// find a port nothing listens on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	core, closer, err := newNetworkSink(mustParseURL(t, "tcp://"+addr+"?buffer=1&timeout=100ms"), zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = closer.Close() }()
+
+	stats := &sinkStats{}
+	closer.(statusReporter).reportStatus(stats)
+
+	var m dto.Metric
+	dropped := sinkDroppedEntriesTotal.WithLabelValues("tcp://" + addr)
+	_ = dropped.Write(&m)
+	before := m.GetCounter().GetValue()
+
+	var failures int
+	for i := 0; i < 10; i++ {
+		if err := core.Write(zapcore.Entry{Message: "Hello"}, nil); err != nil {
+			failures++
+		}
+	}
+
+	// one entry may be held by the background goroutine, and one by the buffer
+	if failures < 8 {
+		t.Errorf("Got %d failed writes, expecting at least 8", failures)
+	}
+
+	_ = dropped.Write(&m)
+	if got := m.GetCounter().GetValue() - before; got != float64(failures) {
+		t.Errorf("Got %v dropped entries, expecting %d", got, failures)
+	}
+
+	if err := core.Sync(); err == nil {
+		t.Error("Got success, expecting Sync to time out")
+	}
+
+	if s := stats.status(); !s.Failing {
+		t.Errorf("Got %+v, expecting the output to be failing", s)
+	}
+}
+
+func TestNetworkSinkErrors(t *testing.T) {
+	cases := []string{
+		"tcp://",
+		"tcp://collector",
+		"udp://:5170",
+		"unix://",
+		"tcp://collector:5170?buffer=0",
+		"tcp://collector:5170?buffer=x",
+		"tcp://collector:5170?timeout=x",
+		"tcp://collector:5170?timeout=-1s",
+	}
+
+	for _, c := range cases {
+		t.Run(c, func(t *testing.T) {
+			if _, _, err := newNetworkSink(mustParseURL(t, c), zapcore.InfoLevel); err == nil {
+				t.Error("Got success, expecting error")
+			}
+		})
+	}
+}
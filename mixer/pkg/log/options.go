@@ -16,6 +16,8 @@ package log
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"go.uber.org/zap/zapcore"
@@ -30,19 +32,420 @@ const (
 type Options struct {
 	// OutputPaths is a list of file system paths to write the log data to.
 	// The special values stdout and stderr can be used to output to the
-	// standard I/O streams.
+	// standard I/O streams. Sink URLs such as syslog://, syslog+udp://host:port,
+	// syslog+tcp://host:port, or syslog+tls://host:port send the log data to syslog, and
+	// journald:// sends it to the systemd journal. fluentd://host:port or fluentd+tls://host:port
+	// ships it to a fluentd aggregator, kafka://broker1,broker2/topic produces it to a Kafka topic,
+	// nats://host:port/subject or nats+tls://host:port/subject publishes it to a NATS subject,
+	// loki://host:port pushes it to Grafana Loki, splunk+https://host:port?token=...
+	// sends it to a Splunk HTTP Event Collector, elasticsearch://host:port indexes
+	// it into Elasticsearch, cloudwatch://?group=name sends it to AWS CloudWatch Logs, and
+	// gelf+udp://host:port or gelf+tcp://host:port sends it to Graylog, and otlp://host:port or
+	// otlp+tls://host:port exports it to an OpenTelemetry collector. tcp://host:port,
+	// tcp+tls://host:port, and udp://host:port send it as JSON lines to a collector, and
+	// unix:///path/to/socket to a node-local agent. The sinks sending the log over TLS use the
+	// TLS settings below.
+	// On Windows, eventlog://source sends it to the Windows Event Log. Other URL schemes can
+	// be added with RegisterSink.
+	// When several files or standard streams are given, each is written from a goroutine of its
+	// own, so that one which hangs or fails doesn't hold up the others.
 	OutputPaths []string
 
+	// Outputs are additional outputs with settings of their own, alongside OutputPaths.
+	Outputs []OutputSpec
+
+	// CreateOutputDirs creates the missing directories of the files the log and audit entries are
+	// output to, rather than failing to configure the log.
+	CreateOutputDirs bool
+
+	// FilePermissions are the permissions of the files created for the log and audit entries, as an
+	// octal mode such as 0600. When empty, the files are created with the permissions allowed by the
+	// umask. The permissions of existing files are left as they are.
+	FilePermissions string
+
+	// FileOwner is the owner of the files created for the log and audit entries, as <uid> or
+	// <uid>:<gid>, for instance so that a log shipper running as another user can read them. When
+	// empty, the files belong to the user running the process. It isn't supported on Windows.
+	FileOwner string
+
+	// RotationInterval rotates the files in OutputPaths and Outputs every hour or every day, with
+	// hourly or daily. Files named with the %Y, %m, %d, and %H verbs, such as mixer-%Y%m%d.log, move
+	// on to the name of the new period, while the others are renamed with the timestamp of the period
+	// they hold, such as mixer-20171231.log. When empty, the files aren't rotated.
+	RotationInterval string
+
+	// RotationCompress gzips the files rotated by RotationInterval and AuditRotationInterval in the
+	// background, one at a time and at a bounded pace. Files left half-compressed by a crash are
+	// compressed again from the start.
+	RotationCompress bool
+
+	// DiskQuotaBytes caps the bytes taken by the current and rotated files of each of the paths in
+	// OutputPaths and Outputs. When exceeded, the oldest rotated files are deleted, and if the files
+	// still exceed it, only warnings and errors are output to them, following a notice. The audit
+	// stream isn't held to it. When 0, the files aren't limited.
+	DiskQuotaBytes int64
+
+	// ErrorOutputPaths is a list of file system paths to output the errors of the log itself to,
+	// such as failures to encode entries or to reach the sinks. The special values stdout and stderr
+	// can be used to output to the standard I/O streams. When empty, errors are output to stderr.
+	ErrorOutputPaths []string
+
+	// TLSCAFile is a PEM bundle of the certificate authorities trusted by the sinks sending the log
+	// over TLS. When empty, the system roots are trusted.
+	TLSCAFile string
+
+	// TLSCertFile and TLSKeyFile are the PEM-encoded client certificate and key presented by the
+	// sinks sending the log over TLS, for mutual TLS. The workload certificates provisioned by
+	// Istio can be used by setting these to /etc/certs/cert-chain.pem and /etc/certs/key.pem, and
+	// TLSCAFile to /etc/certs/root-cert.pem.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// TLSServerName is the name expected in the certificates of the servers the log is sent to.
+	// When empty, it is the host the sink connects to.
+	TLSServerName string
+
+	// TLSMinVersion is the minimum TLS version accepted by the sinks: 1.0, 1.1, or 1.2. When empty,
+	// TLS 1.2 is required.
+	TLSMinVersion string
+
+	// AuditOutputPaths is a list of file system paths to write audit entries to. The special
+	// values stdout and stderr can be used to output to the standard I/O streams. Audit entries
+	// are never sampled. Auditing is disabled if this list is empty.
+	AuditOutputPaths []string
+
+	// AuditRotationInterval rotates the files in AuditOutputPaths like RotationInterval does for
+	// the log, on a schedule of their own.
+	AuditRotationInterval string
+
+	// AuditEncoding selects the format of the audit stream: json, cef for the ArcSight Common
+	// Event Format, or leef for the QRadar Log Event Extended Format. When empty, audit entries
+	// are JSON-encoded. The hash chain requires json.
+	AuditEncoding string
+
+	// AuditHashChain makes the audit stream tamper-evident by chaining the hashes of its entries.
+	AuditHashChain bool
+
+	// AuditCheckpointInterval is how often to write checkpoints recording the state of the audit
+	// hash chain. A value of 0 disables checkpoints.
+	AuditCheckpointInterval time.Duration
+
+	// AuditSigningKeyPath is the path to a PEM-encoded private key used to sign audit checkpoints.
+	// Checkpoints are left unsigned if this is empty.
+	AuditSigningKeyPath string
+
 	// JSONEncoding controls whether the log is formatted as JSON.
 	JSONEncoding bool
 
+	// Encoding selects the format of the log: console, json, logfmt for key=value pairs,
+	// stackdriver for the structured format understood by GKE, ecs for the Elastic Common Schema,
+	// gelf for the Graylog Extended Log Format, cef and leef as for AuditEncoding, or protobuf for
+	// a compact binary format read by the binlog package. When empty, JSONEncoding decides between
+	// console and json.
+	Encoding string
+
+	// GlobalFields are fields stamped onto every entry of the log, each of the form <key>=<value>,
+	// for instance cluster=us-east1.
+	GlobalFields []string
+
+	// IncludeProcessIdentity stamps the identity of the process onto every entry of the log, so that
+	// the logs of several replicas can be told apart: the host name, the name and namespace of the
+	// pod when the POD_NAME and POD_NAMESPACE environment variables are set from the Kubernetes
+	// downward API, and the component.
+	IncludeProcessIdentity bool
+
+	// Component is the name of the component output along with the identity of the process, such as
+	// mixer. It is left out when empty.
+	Component string
+
+	// IncludeVersion stamps the version and git SHA of the binary onto every entry of the log, as set
+	// with SetVersionInfo.
+	IncludeVersion bool
+
+	// TimeFormat is the format of the timestamps: iso8601, rfc3339nano, epoch-millis for the
+	// milliseconds since the Unix epoch, or a layout for time.Format. When empty, timestamps are
+	// formatted as ISO 8601. It applies to the outputs and the audit stream, but not to the formats
+	// with timestamps of their own, such as stackdriver.
+	TimeFormat string
+
+	// UTC outputs the timestamps in UTC rather than in the local time zone.
+	UTC bool
+
+	// DurationEncoding is the format of durations: string for text such as 1.2ms, or seconds,
+	// millis, or nanos for numbers of these units, which can be aggregated once ingested. When
+	// empty, durations are output as strings.
+	DurationEncoding string
+
+	// CallerEncoding is the format of the source locations output with IncludeCallerSourceLocation:
+	// short for the file and its directory, such as log/log.go:42, full for the absolute path of the
+	// file, or trimmed for its path within the repository, such as mixer/pkg/log/log.go:42, which
+	// tells apart the files of the same name in different packages. When empty, callers are short.
+	CallerEncoding string
+
+	// LineEnding is what ends the entries of the outputs: lf for a newline, crlf for a carriage
+	// return and a newline as expected by some Windows tools, or nul or rs for a NUL or an ASCII
+	// record separator, for the collectors which frame entries spanning several lines, such as those
+	// of the console encoding with stack traces, with them. When empty, entries end with a newline.
+	// The sinks and the audit stream frame their entries their own way.
+	LineEnding string
+
+	// EncoderKeys rename the keys of the entries, so that the output can match an existing schema,
+	// such as the Elastic Common Schema. Each has the form <key>=<name>, where key is one of time,
+	// level, logger, caller, msg, or stack, for instance time=@timestamp or msg=message. An empty
+	// name leaves the key out. They apply to the outputs and the audit stream, but not to the
+	// formats with keys of their own, such as stackdriver.
+	EncoderKeys []string
+
+	// LogSchema is the version of the schema of the JSON entries, which carry it under log_schema.
+	// Setting it to the previous version during an upgrade keeps the entries in the layout the
+	// parsers and dashboards downstream expect until they are upgraded as well, version 1 standing
+	// for the entries from before they were stamped. When 0, the entries follow the current schema.
+	// It applies to the outputs and the sinks in the JSON encoding, but not to the audit stream.
+	LogSchema int
+
+	// JSONIndent indents the entries of the JSON encoding over several lines, so that developers can
+	// read them without piping the log through jq. It is not meant for production, as collectors
+	// expect an entry per line, and a warning is output when stdout isn't a terminal.
+	JSONIndent bool
+
+	// UseColoredLevels colors the levels of the console encoding, so that warnings and errors stand
+	// out, as long as the log is output to a terminal. Files and pipes stay free of color codes.
+	UseColoredLevels bool
+
+	// ForceColoredLevels colors the levels of the console encoding even when the log isn't output to
+	// a terminal, for instance when it is viewed with less -R.
+	ForceColoredLevels bool
+
+	// ConsoleEscaping controls the escaping of the newlines and other control characters of the
+	// messages of the console encoding, which keeps request data such as paths from forging entries
+	// or tampering with terminals: always, never, or auto to escape them unless the log is output to
+	// a terminal. When empty, auto applies.
+	ConsoleEscaping string
+
+	// StackTraceEncoding is the format of stack traces: multiline to output them over lines of their
+	// own after the entries of the console encoding, escaped for a field holding them on a single
+	// line, or frames for a field holding an array of the function, file, and line of each call.
+	// The last two keep stack traces from being split apart by the collectors reading the log line
+	// by line. When empty, stack traces span multiple lines.
+	StackTraceEncoding string
+
 	// IncludeCallerSourceLocation determines whether log messages include the source location of the caller.
 	IncludeCallerSourceLocation bool
 
+	// IncludeGoroutineID annotates entries with the ID of the goroutine logging them, which helps
+	// untangle the entries of concurrent work. Finding out the ID is expensive, so it should only be
+	// turned on while investigating a problem.
+	IncludeGoroutineID bool
+
+	// RecentEntries is the number of the last entries kept in memory, for RecentEntries and
+	// RecentEntriesHandler to return. The entries of every level are kept, whatever the output
+	// levels, so that the debug messages leading to an error can be retrieved without having been
+	// output. As every entry then gets encoded, it adds to the cost of the debug messages. When 0,
+	// no entries are kept.
+	RecentEntries int
+
+	// FailoverPath is where the entries of the outputs which keep failing to write them are written
+	// instead, such as stderr, so that they aren't lost while a collector restarts. A notice is
+	// written there when an output is failed over and when it recovers, at which point the entries
+	// go back to it; meanwhile, some entries may be written to both. When empty, there is no
+	// failover.
+	FailoverPath string
+
+	// DebugTriggerPath is the path of a file whose presence sets the output level to debug, such as
+	// DefaultDebugTriggerPath. Once the file is removed, the level it replaced is restored. Creating
+	// the file with kubectl exec lets debug messages be turned on in clusters where nothing else can
+	// be changed at runtime. When empty, no file is watched.
+	DebugTriggerPath string
+
+	// DebugSamplePercentage is the percentage of requests, from 0 to 100, whose debug entries are
+	// output whatever the output levels, so that a little debug output is always at hand in
+	// production. Requests are picked by their request ID, which Envoy passes to every service, so
+	// that every process configured with the same percentage logs the same requests in full. Only
+	// the loggers returned by FromContext for contexts carrying a request ID are sampled. When 0, no
+	// requests are.
+	DebugSamplePercentage float64
+
+	// DevelopmentMode tunes the output for developers running the code locally: the levels are
+	// colored on terminals, every entry is output rather than sampled, and entries logged at the
+	// DPanic level panic once written, so that the conditions which should never happen get noticed.
+	DevelopmentMode bool
+
+	// DetectDuplicateKeys warns about the entries carrying several fields with the same key, whether
+	// passed together or added with With, naming the code logging them. Such entries encode to
+	// ambiguous JSON which some parsers reject. Each call site is warned about once. It is meant for
+	// development, as it adds to the cost of every entry.
+	DetectDuplicateKeys bool
+
+	// TraceSpanEvents records the warn and error entries of the loggers returned by FromContext on
+	// the trace span of their context as well, so that the traces of failing requests carry the
+	// diagnostics explaining the failure.
+	TraceSpanEvents bool
+
+	// SamplingInitial is the number of entries with a given level and message that are
+	// output each second before sampling kicks in.
+	SamplingInitial int
+
+	// SamplingThereafter controls sampling once SamplingInitial entries with a given level
+	// and message have been output during a second, only every Nth entry is output after that.
+	SamplingThereafter int
+
+	// ScopeSampling sets the sampling of individual scopes apart from that of the others, as a
+	// comma-separated list of <scope>:<initial>/<thereafter>, or <scope>:none to output every entry
+	// of the scope. For instance, report:10/1000,config:none samples the hot path of the reports
+	// aggressively while leaving the processing of the configuration alone. DisableSampling
+	// overrides it.
+	ScopeSampling string
+
+	// SamplingBudget enables adaptive sampling when non-zero. Whenever more than this number
+	// of entries are output in a second, sampling is progressively tightened until the load
+	// drops again.
+	SamplingBudget int
+
+	// DisableSampling turns off sampling entirely, causing all entries to be output.
+	DisableSampling bool
+
+	// SamplingSummaryInterval is how often a summary of the entries dropped by sampling is output.
+	// A value of 0 disables the summary.
+	SamplingSummaryInterval time.Duration
+
+	// ErrorSummaryInterval is how often a summary of the warnings and errors logged is output, with
+	// their counts and the most frequent messages, which gives a signal when the log is sampled or
+	// rate-limited. A value of 0 disables the summary.
+	ErrorSummaryInterval time.Duration
+
+	// FieldAllowlist restricts the structured fields that are output to those whose key matches one of
+	// these patterns. A pattern is either an exact key or a key prefix followed by '*'. An empty
+	// allowlist lets all fields through.
+	FieldAllowlist []string
+
+	// FieldDenylist strips the structured fields whose key matches one of these patterns from the output.
+	// Patterns have the same syntax as for FieldAllowlist.
+	FieldDenylist []string
+
+	// MessageFilters control which messages are output based on their text. Each filter has
+	// the form include=<regexp> or exclude=<regexp>. When include filters are present, only
+	// messages matching at least one of them are output. Messages matching any of the exclude
+	// filters are never output.
+	MessageFilters []string
+
+	// MaxMessageBytes cuts the messages longer than this number of bytes down to size, marking the
+	// entries with truncated=true, so that they don't exceed the line limits of log collectors. A
+	// value of 0 leaves messages as they are.
+	MaxMessageBytes int
+
+	// MaxFieldBytes cuts the values of the string, stringer, and error fields longer than this number
+	// of bytes down to size, marking the entries like MaxMessageBytes. A value of 0 leaves fields as
+	// they are.
+	MaxFieldBytes int
+
+	// DedupWindow enables the suppression of consecutive identical messages when non-zero.
+	// Repeats of a message within this window are collapsed into a single entry annotated
+	// with the number of times the message was repeated.
+	DedupWindow time.Duration
+
+	// FlushInterval is how often the log is synced, writing out the entries buffered by the outputs
+	// and by the asynchronous mode, so that few entries are lost if the process gets killed. A value
+	// of 0 leaves syncing to the program.
+	FlushInterval time.Duration
+
+	// Async makes logging calls queue entries for a background goroutine to write them out, so that
+	// slow outputs don't hold up the code doing the logging. Sync waits for the queued entries to be
+	// written. Entries at the DPanic level or above are written right away.
+	Async bool
+
+	// AsyncBufferSize is the maximum number of entries queued in asynchronous mode, 8192 when 0.
+	AsyncBufferSize int
+
+	// AsyncDropPolicy decides what happens to the entries logged while the queue of the
+	// asynchronous mode is full: block waits for room in the queue, drop-newest drops the entry
+	// being logged, and drop-oldest drops the oldest entry of the queue. When empty, drop-newest
+	// applies, so that logging never holds up the program.
+	AsyncDropPolicy string
+
+	// AsyncDropSummaryInterval is how often a summary of the entries dropped because the queue of
+	// the asynchronous mode was full is output. A value of 0 disables the summary.
+	AsyncDropSummaryInterval time.Duration
+
+	// LevelOverrides set the output level of the code of some source files, whatever the levels of
+	// the scopes of their entries, so that verbose output can be turned on for a single file. Each
+	// has the form <pattern>=<level>, where pattern is matched with path.Match against the paths of
+	// the source files within the repository, for instance mixer/pkg/runtime/*.go=debug. The first
+	// override matching a file applies. As the code logging each entry gets looked up, overrides
+	// add to the cost of every entry and are meant for troubleshooting.
+	LevelOverrides []string
+
+	// LevelEnabler, when set, decides which entries are output in place of the output levels of the
+	// scopes, which SetOutputLevel and SetScopeOutputLevel then no longer affect. It lets programs
+	// embedding Mixer apply policies of their own, such as turning debug output on for a window of
+	// time or for a percentage of the entries, for instance with a zap.LevelEnablerFunc. It is
+	// called for every entry, from the goroutines logging, and should be cheap and safe for
+	// concurrent use. There is no flag for it.
+	LevelEnabler zapcore.LevelEnabler
+
+	// Clock, when set, tells the time of the entries, the rotation of the files, and the periodic
+	// summaries in place of the system clock, so that tests of them are deterministic. There is no
+	// flag for it.
+	Clock Clock
+
+	// Verbosity is the highest verbosity level of the messages output through V, which are output at
+	// the debug level. The default of 0 only outputs those of V(0).
+	Verbosity int
+
+	// CaptureStdLog redirects the output of the standard "log" package to the log, at the level of
+	// StdLogLevel unless the lines start with a level such as [ERROR] or [warn], as some third-party
+	// libraries write. It can be turned off for programs managing the standard logger themselves,
+	// which then gets back the settings it had before being redirected.
+	CaptureStdLog bool
+
+	// StdLogScope is the scope of the output of the standard "log" package, such as
+	// DefaultStdLogScope, so that it can be told apart and leveled separately. When empty, the
+	// default scope applies.
+	StdLogScope string
+
+	// StdLogLevel is the level of the lines of the standard "log" package without a level of their
+	// own: debug, info, warn, or error. When empty, info applies.
+	StdLogLevel string
+
+	// ReplaceGlobalZap makes the global zap loggers, zap.L() and zap.S(), output to the log. It can
+	// be turned off for programs and tests with global zap loggers of their own, which then get back
+	// the loggers they had before being replaced.
+	ReplaceGlobalZap bool
+
+	// CaptureGRPCLog redirects the output of the gRPC logging package to the log. The entries keep
+	// the levels of their gRPC severities, and the GRPC_GO_LOG_SEVERITY_LEVEL and
+	// GRPC_GO_LOG_VERBOSITY_LEVEL environment variables are honored like by the default logger of
+	// gRPC, except that all the severities are output when the former isn't set. It can be turned
+	// off for programs routing the gRPC logging elsewhere. The gRPC logging package can't be set
+	// back to a previous logger, so turning it off only keeps the gRPC logging from being captured
+	// from then on if it wasn't already.
+	CaptureGRPCLog bool
+
 	stackTraceLevel string
 	outputLevel     string
 }
 
+// OutputSpec describes an output with its own encoding, level, or fields, for instance console
+// output of warnings and errors on stderr alongside JSON output of everything to a file.
+type OutputSpec struct {
+	// Path is where to output the log: a file system path, stdout, stderr, or one of the URLs
+	// accepted in OutputPaths.
+	Path string
+
+	// Encoding is the format of this output, as for Options.Encoding. When empty, the output uses
+	// the same format as OutputPaths. Outputs to URLs have a format of their own, and don't
+	// support this.
+	Encoding string
+
+	// MinLevel is the minimum level of the entries sent to this output: debug, info, warn, error,
+	// or none. When empty or below the output level, the output level applies.
+	MinLevel string
+
+	// FieldAllowlist and FieldDenylist restrict the structured fields sent to this output, with the
+	// same patterns as Options.FieldAllowlist and Options.FieldDenylist, on top of those.
+	FieldAllowlist []string
+	FieldDenylist  []string
+}
+
 var levelToString = map[zapcore.Level]string{
 	zapcore.DebugLevel: "debug",
 	zapcore.InfoLevel:  "info",
@@ -59,12 +462,81 @@ var stringToLevel = map[string]zapcore.Level{
 	"none":  None,
 }
 
+// Level is an output or stack trace level, which other configuration can embed to be set by
+// name: debug, info, warn, error, or none. It converts to and from zapcore.Level, and marshals
+// to its name as text, JSON, and YAML.
+type Level zapcore.Level
+
+// ParseLevel returns the level with the given name.
+func ParseLevel(s string) (Level, error) {
+	l, ok := stringToLevel[s]
+	if !ok {
+		return 0, fmt.Errorf("unknown level: %s", s)
+	}
+
+	return Level(l), nil
+}
+
+// String returns the name of the level.
+func (l Level) String() string {
+	if s, ok := levelToString[zapcore.Level(l)]; ok {
+		return s
+	}
+	return fmt.Sprintf("Level(%d)", l)
+}
+
+// MarshalText marshals the level to its name. encoding/json uses it as well.
+func (l Level) MarshalText() ([]byte, error) {
+	s, ok := levelToString[zapcore.Level(l)]
+	if !ok {
+		return nil, fmt.Errorf("unknown level: %d", l)
+	}
+
+	return []byte(s), nil
+}
+
+// UnmarshalText unmarshals the level from its name. encoding/json uses it as well.
+func (l *Level) UnmarshalText(text []byte) error {
+	parsed, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+
+	*l = parsed
+	return nil
+}
+
+// MarshalYAML marshals the level to its name.
+func (l Level) MarshalYAML() (interface{}, error) {
+	text, err := l.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+
+	return string(text), nil
+}
+
+// UnmarshalYAML unmarshals the level from its name.
+func (l *Level) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	return l.UnmarshalText([]byte(s))
+}
+
 // NewOptions returns a new set of options, initialized to the defaults
 func NewOptions() *Options {
 	return &Options{
-		OutputPaths:     []string{"stdout"},
-		outputLevel:     "info",
-		stackTraceLevel: "none",
+		OutputPaths:        []string{"stdout"},
+		SamplingInitial:    100,
+		SamplingThereafter: 100,
+		CaptureStdLog:      true,
+		ReplaceGlobalZap:   true,
+		CaptureGRPCLog:     true,
+		outputLevel:        "info",
+		stackTraceLevel:    "none",
 	}
 }
 
@@ -93,7 +565,8 @@ func (o *Options) GetOutputLevel() (zapcore.Level, error) {
 	return l, nil
 }
 
-// SetStackTraceLevel sets the minimum stack trace capture level.
+// SetStackTraceLevel sets the minimum stack trace capture level, dropping the levels of individual
+// scopes.
 //
 // The level can be one of zapcore.DebugLevel, zapcore.InfoLevel,
 // zapcore.WarnLevel, zapcore.ErrorLevel, or None. The default is
@@ -108,14 +581,63 @@ func (o *Options) SetStackTraceLevel(level zapcore.Level) error {
 	return nil
 }
 
-// GetStackTraceLevel returns the current stack trace level.
+// GetStackTraceLevel returns the current stack trace level, that of the scopes without a level of
+// their own.
 func (o *Options) GetStackTraceLevel() (zapcore.Level, error) {
-	l, ok := stringToLevel[o.stackTraceLevel]
-	if !ok {
-		return 0, fmt.Errorf("unknown stack trace level: %s", o.stackTraceLevel)
+	l, _, err := parseScopedLevels(o.stackTraceLevel, "stack trace level", None)
+	return l, err
+}
+
+// GetScopeStackTraceLevels returns the stack trace levels of the scopes with a level of their own,
+// as set with --log_stacktrace_level=default:none,dispatcher:error for instance.
+func (o *Options) GetScopeStackTraceLevels() (map[string]zapcore.Level, error) {
+	_, scopes, err := parseScopedLevels(o.stackTraceLevel, "stack trace level", None)
+	return scopes, err
+}
+
+// parseScopedLevels parses a comma-separated list of levels, each either a plain level or a scope
+// followed by a colon and its level, as in "default:none,dispatcher:error". It returns the level of
+// the default scope, which is the fallback unless given, and those of the other scopes. The
+// description of the levels is used in the errors.
+func parseScopedLevels(s string, what string, fallback zapcore.Level) (zapcore.Level, map[string]zapcore.Level, error) {
+	level := fallback
+	var scopes map[string]zapcore.Level
+
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+
+		colon := strings.Index(item, ":")
+		if colon < 0 {
+			l, ok := stringToLevel[item]
+			if !ok {
+				return 0, nil, fmt.Errorf("unknown %s: %s", what, item)
+			}
+			level = l
+			continue
+		}
+
+		scope, name := strings.TrimSpace(item[:colon]), strings.TrimSpace(item[colon+1:])
+		if scope == "" {
+			return 0, nil, fmt.Errorf("invalid %s, missing the scope of '%s'", what, item)
+		}
+
+		l, ok := stringToLevel[name]
+		if !ok {
+			return 0, nil, fmt.Errorf("unknown %s for %s: %s", what, scope, name)
+		}
+
+		if scope == defaultScopeName {
+			level = l
+			continue
+		}
+
+		if scopes == nil {
+			scopes = make(map[string]zapcore.Level)
+		}
+		scopes[scope] = l
 	}
 
-	return l, nil
+	return level, scopes, nil
 }
 
 // AttachCobraFlags attaches a set of Cobra flags to the given Cobra command.
@@ -125,17 +647,229 @@ func (o *Options) GetStackTraceLevel() (zapcore.Level, error) {
 // logging options.
 func (o *Options) AttachCobraFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().StringArrayVar(&o.OutputPaths, "log_target", o.OutputPaths,
-		"The set of paths where to output the log. This can be any path as well as the special values stdout and stderr")
+		"The set of paths where to output the log. This can be any path as well as the special values stdout and stderr, "+
+			"a syslog URL such as syslog://, syslog+udp://host:port, syslog+tcp://host:port, or syslog+tls://host:port, journald://, fluentd://host:port, fluentd+tls://host:port, kafka://brokers/topic, nats://host:port/subject, loki://host:port, splunk+https://host:port?token=..., elasticsearch://host:port, cloudwatch://?group=name, gelf+udp://host:port, gelf+tcp://host:port, otlp://host:port, otlp+tls://host:port, tcp://host:port, tcp+tls://host:port, udp://host:port, unix:///path/to/socket, or eventlog://source on Windows")
+
+	cmd.PersistentFlags().BoolVar(&o.CreateOutputDirs, "log_create_dirs", o.CreateOutputDirs,
+		"Whether to create the missing directories of the files the log is output to")
+
+	cmd.PersistentFlags().StringVar(&o.FilePermissions, "log_file_permissions", o.FilePermissions,
+		"The octal permissions of the log files created, such as 0600, those allowed by the umask if empty")
+
+	cmd.PersistentFlags().StringVar(&o.FileOwner, "log_file_owner", o.FileOwner,
+		"The owner of the log files created, as <uid> or <uid>:<gid>, the user running the process if empty")
+
+	cmd.PersistentFlags().StringVar(&o.RotationInterval, "log_rotation_interval", o.RotationInterval,
+		"How often to rotate the log files, can be one of hourly or daily, never if empty")
+
+	cmd.PersistentFlags().BoolVar(&o.RotationCompress, "log_rotation_compress", o.RotationCompress,
+		"Whether to gzip the rotated log and audit files")
+
+	cmd.PersistentFlags().Int64Var(&o.DiskQuotaBytes, "log_disk_quota_bytes", o.DiskQuotaBytes,
+		"The most bytes the current and rotated files of each log file path may take, unlimited if 0")
+
+	cmd.PersistentFlags().StringArrayVar(&o.ErrorOutputPaths, "log_error_target", o.ErrorOutputPaths,
+		"The set of paths where to output the errors of the logging system itself, such as unreachable outputs. "+
+			"This can be any path as well as the special values stdout and stderr, stderr if empty")
+
+	cmd.PersistentFlags().StringVar(&o.TLSCAFile, "log_tls_ca", o.TLSCAFile,
+		"The path to a PEM bundle of the certificate authorities trusted by the outputs using TLS, the system roots if empty")
+
+	cmd.PersistentFlags().StringVar(&o.TLSCertFile, "log_tls_cert", o.TLSCertFile,
+		"The path to the PEM-encoded client certificate presented by the outputs using TLS")
+
+	cmd.PersistentFlags().StringVar(&o.TLSKeyFile, "log_tls_key", o.TLSKeyFile,
+		"The path to the PEM-encoded key of the client certificate presented by the outputs using TLS")
+
+	cmd.PersistentFlags().StringVar(&o.TLSServerName, "log_tls_server_name", o.TLSServerName,
+		"The name expected in the certificates of the servers the log is sent to, the host of the output if empty")
+
+	cmd.PersistentFlags().StringVar(&o.TLSMinVersion, "log_tls_min_version", o.TLSMinVersion,
+		"The minimum TLS version accepted by the outputs, can be one of 1.0, 1.1, or 1.2")
+
+	cmd.PersistentFlags().StringArrayVar(&o.AuditOutputPaths, "log_audit_target", o.AuditOutputPaths,
+		"The set of paths where to output audit entries. This can be any path as well as the special values stdout and stderr, auditing is disabled if empty")
+
+	cmd.PersistentFlags().StringVar(&o.AuditRotationInterval, "log_audit_rotation_interval", o.AuditRotationInterval,
+		"How often to rotate the audit files, can be one of hourly or daily, never if empty")
+
+	cmd.PersistentFlags().StringVar(&o.AuditEncoding, "log_audit_encoding", o.AuditEncoding,
+		"The format of audit entries, can be one of json, cef, or leef")
+
+	cmd.PersistentFlags().BoolVar(&o.AuditHashChain, "log_audit_hash_chain", o.AuditHashChain,
+		"Whether to chain the hashes of audit entries, making modifications of the audit log detectable")
+
+	cmd.PersistentFlags().DurationVar(&o.AuditCheckpointInterval, "log_audit_checkpoint_interval", o.AuditCheckpointInterval,
+		"How often to write checkpoints of the audit hash chain, 0 to disable")
+
+	cmd.PersistentFlags().StringVar(&o.AuditSigningKeyPath, "log_audit_signing_key", o.AuditSigningKeyPath,
+		"The path to a PEM-encoded private key used to sign audit checkpoints")
 
 	cmd.PersistentFlags().BoolVar(&o.JSONEncoding, "log_as_json", o.JSONEncoding,
 		"Whether to format output as JSON or in plain console-friendly format")
 
+	cmd.PersistentFlags().StringVar(&o.Encoding, "log_encoding", o.Encoding,
+		"The format of the output, can be one of console, json, logfmt, stackdriver, ecs, gelf, cef, leef, or protobuf. Overrides --log_as_json")
+
+	cmd.PersistentFlags().StringArrayVar(&o.GlobalFields, "log_field", o.GlobalFields,
+		"A field to add to every message, as <key>=<value>")
+
+	cmd.PersistentFlags().BoolVar(&o.IncludeProcessIdentity, "log_process_identity", o.IncludeProcessIdentity,
+		"Whether to add the host name, the pod name and namespace, and the component to every message")
+
+	cmd.PersistentFlags().StringVar(&o.Component, "log_component", o.Component,
+		"The name of the component added to every message by --log_process_identity")
+
+	cmd.PersistentFlags().BoolVar(&o.IncludeVersion, "log_version", o.IncludeVersion,
+		"Whether to add the version and git SHA of the binary to every message")
+
+	cmd.PersistentFlags().StringVar(&o.TimeFormat, "log_time_format", o.TimeFormat,
+		"The format of timestamps, can be one of iso8601, rfc3339nano, epoch-millis, or a Go time layout")
+
+	cmd.PersistentFlags().BoolVar(&o.UTC, "log_utc", o.UTC,
+		"Whether to output timestamps in UTC rather than in the local time zone")
+
+	cmd.PersistentFlags().StringVar(&o.DurationEncoding, "log_duration_encoding", o.DurationEncoding,
+		"The format of durations, can be one of string, seconds, millis, or nanos")
+
+	cmd.PersistentFlags().StringVar(&o.CallerEncoding, "log_caller_encoding", o.CallerEncoding,
+		"The format of the source locations of callers, can be one of short, full, or trimmed for the path within the repository")
+
+	cmd.PersistentFlags().StringVar(&o.LineEnding, "log_line_ending", o.LineEnding,
+		"What ends the entries of the output, can be one of lf, crlf, nul, or rs for an ASCII record separator")
+
+	cmd.PersistentFlags().StringArrayVar(&o.EncoderKeys, "log_encoder_key", o.EncoderKeys,
+		"Renames a key of the output, as <key>=<name> where key is one of time, level, logger, caller, msg, or stack, "+
+			"for instance time=@timestamp. An empty name leaves the key out")
+
+	cmd.PersistentFlags().IntVar(&o.LogSchema, "log_schema", o.LogSchema,
+		"The version of the schema of the JSON messages, to keep the previous one during upgrades, 0 for the current one")
+
+	cmd.PersistentFlags().StringVar(&o.ConsoleEscaping, "log_console_escaping", o.ConsoleEscaping,
+		"When to escape the control characters of messages in the console format, can be one of auto, always, or never. "+
+			"auto escapes them unless the output is a terminal")
+
+	cmd.PersistentFlags().StringVar(&o.StackTraceEncoding, "log_stacktrace_encoding", o.StackTraceEncoding,
+		"The format of stack traces, can be one of multiline, escaped for a single line, or frames for an array of calls")
+
+	cmd.PersistentFlags().BoolVar(&o.JSONIndent, "log_json_indent", o.JSONIndent,
+		"Whether to indent the JSON format over several lines, for reading on a terminal rather than for production")
+
+	cmd.PersistentFlags().BoolVar(&o.UseColoredLevels, "log_colors", o.UseColoredLevels,
+		"Whether to color the levels of the console format when the output is a terminal")
+
+	cmd.PersistentFlags().BoolVar(&o.ForceColoredLevels, "log_force_colors", o.ForceColoredLevels,
+		"Whether to color the levels of the console format even when the output isn't a terminal")
+
 	cmd.PersistentFlags().StringVar(&o.outputLevel, "log_output_level", o.outputLevel,
 		"The minimum logging level of messages to output, can be one of debug, info, warning, error, or none")
 
+	cmd.PersistentFlags().StringArrayVar(&o.LevelOverrides, "log_level_override", o.LevelOverrides,
+		"Sets the output level of the code of some source files, as <pattern>=<level> where pattern matches paths "+
+			"within the repository, for instance mixer/pkg/runtime/*.go=debug")
+
 	cmd.PersistentFlags().BoolVar(&o.IncludeCallerSourceLocation, "log_callers", o.IncludeCallerSourceLocation,
 		"Include caller information, useful for debugging")
 
+	cmd.PersistentFlags().BoolVar(&o.IncludeGoroutineID, "log_goroutine_ids", o.IncludeGoroutineID,
+		"Include the ID of the goroutine logging each message, which is expensive")
+
+	cmd.PersistentFlags().IntVar(&o.RecentEntries, "log_recent_entries", o.RecentEntries,
+		"The number of the last messages of every level to keep in memory for the debug endpoint, 0 to disable")
+
+	cmd.PersistentFlags().StringVar(&o.FailoverPath, "log_failover_path", o.FailoverPath,
+		"Where to write the messages of the outputs which keep failing, such as stderr, empty to disable")
+
+	cmd.PersistentFlags().StringVar(&o.DebugTriggerPath, "log_debug_trigger_path", o.DebugTriggerPath,
+		"The path of a file whose presence turns debug messages on, such as "+DefaultDebugTriggerPath+", empty to disable")
+
+	cmd.PersistentFlags().Float64Var(&o.DebugSamplePercentage, "log_debug_sample_percentage", o.DebugSamplePercentage,
+		"The percentage of requests whose debug messages are output whatever the output level, 0 to disable")
+
+	cmd.PersistentFlags().BoolVar(&o.DevelopmentMode, "log_dev", o.DevelopmentMode,
+		"Whether to output colored levels and every message, and to panic on messages at the dpanic level, for development")
+
+	cmd.PersistentFlags().BoolVar(&o.DetectDuplicateKeys, "log_detect_duplicate_keys", o.DetectDuplicateKeys,
+		"Warn about messages logged with several fields of the same key, for development")
+
+	cmd.PersistentFlags().BoolVar(&o.TraceSpanEvents, "log_trace_span_events", o.TraceSpanEvents,
+		"Record the warning and error messages logged for a request on its trace span as well")
+
 	cmd.PersistentFlags().StringVar(&o.stackTraceLevel, "log_stacktrace_level", o.stackTraceLevel,
-		"The minimum logging level at which stack traces are captured, can be one of debug, info, warning, error, or none")
+		"The minimum logging level at which stack traces are captured, can be one of debug, info, warning, error, or none, "+
+			"or a comma-separated list of <scope>:<level> such as default:none,dispatcher:error")
+
+	cmd.PersistentFlags().IntVar(&o.SamplingInitial, "log_sampling_initial", o.SamplingInitial,
+		"The number of messages with a given level and text that are output each second before sampling starts")
+
+	cmd.PersistentFlags().IntVar(&o.SamplingThereafter, "log_sampling_thereafter", o.SamplingThereafter,
+		"Once sampling starts, only every Nth message with a given level and text is output")
+
+	cmd.PersistentFlags().StringVar(&o.ScopeSampling, "log_scope_sampling", o.ScopeSampling,
+		"The sampling of individual scopes, as a comma-separated list of <scope>:<initial>/<thereafter> "+
+			"or <scope>:none, such as report:10/1000,config:none")
+
+	cmd.PersistentFlags().IntVar(&o.SamplingBudget, "log_sampling_budget", o.SamplingBudget,
+		"The number of messages per second above which sampling is progressively tightened, 0 to disable adaptive sampling")
+
+	cmd.PersistentFlags().BoolVar(&o.DisableSampling, "log_disable_sampling", o.DisableSampling,
+		"Disable sampling, causing every message to be output")
+
+	cmd.PersistentFlags().DurationVar(&o.SamplingSummaryInterval, "log_sampling_summary_interval", o.SamplingSummaryInterval,
+		"How often to output a summary of the messages dropped by sampling, 0 to disable")
+
+	cmd.PersistentFlags().DurationVar(&o.ErrorSummaryInterval, "log_error_summary_interval", o.ErrorSummaryInterval,
+		"How often to output a summary of the warning and error messages, 0 to disable")
+
+	cmd.PersistentFlags().StringArrayVar(&o.FieldAllowlist, "log_field_allowlist", o.FieldAllowlist,
+		"The structured fields to output, as exact keys or key prefixes followed by '*'. All fields are output if empty")
+
+	cmd.PersistentFlags().StringArrayVar(&o.FieldDenylist, "log_field_denylist", o.FieldDenylist,
+		"The structured fields to strip from the output, as exact keys or key prefixes followed by '*'")
+
+	cmd.PersistentFlags().StringArrayVar(&o.MessageFilters, "log_filter", o.MessageFilters,
+		"Filters messages based on their text, using include=<regexp> to only output matching messages or "+
+			"exclude=<regexp> to suppress matching messages")
+
+	cmd.PersistentFlags().IntVar(&o.MaxMessageBytes, "log_max_message_bytes", o.MaxMessageBytes,
+		"The length in bytes beyond which messages are truncated, 0 to disable")
+
+	cmd.PersistentFlags().IntVar(&o.MaxFieldBytes, "log_max_field_bytes", o.MaxFieldBytes,
+		"The length in bytes beyond which the values of structured fields are truncated, 0 to disable")
+
+	cmd.PersistentFlags().DurationVar(&o.DedupWindow, "log_dedup_window", o.DedupWindow,
+		"The window within which consecutive identical messages are collapsed into one, 0 to disable")
+
+	cmd.PersistentFlags().DurationVar(&o.FlushInterval, "log_flush_interval", o.FlushInterval,
+		"How often to write out buffered messages, 0 to only do so when the program asks for it")
+
+	cmd.PersistentFlags().IntVar(&o.Verbosity, "log_verbosity", o.Verbosity,
+		"The highest verbosity level of the debug messages to output, for code using glog-style verbosity levels")
+
+	cmd.PersistentFlags().BoolVar(&o.CaptureStdLog, "log_capture_stdlog", o.CaptureStdLog,
+		"Whether to redirect the output of the standard log package to the log")
+
+	cmd.PersistentFlags().StringVar(&o.StdLogScope, "log_stdlog_scope", o.StdLogScope,
+		"The scope of the output of the standard log package, such as "+DefaultStdLogScope+", empty for the default scope")
+
+	cmd.PersistentFlags().StringVar(&o.StdLogLevel, "log_stdlog_level", o.StdLogLevel,
+		"The level of the output of the standard log package without a level prefix, can be one of debug, info, warn, or error")
+
+	cmd.PersistentFlags().BoolVar(&o.ReplaceGlobalZap, "log_replace_global_zap", o.ReplaceGlobalZap,
+		"Whether to make the global zap loggers output to the log")
+
+	cmd.PersistentFlags().BoolVar(&o.CaptureGRPCLog, "log_capture_grpclog", o.CaptureGRPCLog,
+		"Whether to redirect the output of the gRPC logging package to the log")
+
+	cmd.PersistentFlags().BoolVar(&o.Async, "log_async", o.Async,
+		"Whether to write the log from a background goroutine, so that slow outputs don't hold up the program")
+
+	cmd.PersistentFlags().IntVar(&o.AsyncBufferSize, "log_async_buffer", o.AsyncBufferSize,
+		"The maximum number of messages waiting to be written when --log_async is set, 0 for the default of 8192")
+
+	cmd.PersistentFlags().StringVar(&o.AsyncDropPolicy, "log_async_drop_policy", o.AsyncDropPolicy,
+		"What to do with messages logged while the --log_async queue is full, can be one of block, drop-newest, or drop-oldest")
+
+	cmd.PersistentFlags().DurationVar(&o.AsyncDropSummaryInterval, "log_async_drop_summary_interval", o.AsyncDropSummaryInterval,
+		"How often to output a summary of the messages dropped because the --log_async queue was full, 0 to disable")
 }
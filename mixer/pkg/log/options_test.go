@@ -15,10 +15,12 @@
 package log
 
 import (
+	"encoding/json"
 	"reflect"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/cobra"
 	"go.uber.org/zap/zapcore"
@@ -31,104 +33,802 @@ func TestOpts(t *testing.T) {
 	}{
 		{"--log_as_json", Options{
 			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
 			outputLevel:                 "info",
 			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
 			IncludeCallerSourceLocation: false,
 			JSONEncoding:                true,
 		}},
 
+		{"--log_encoding stackdriver", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+			Encoding:                    "stackdriver",
+		}},
+
+		{"--log_audit_encoding cef", Options{
+			OutputPaths:                 []string{"stdout"},
+			AuditEncoding:               "cef",
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+		}},
+
 		{"--log_target stdout --log_target stderr", Options{
 			OutputPaths:                 []string{"stdout", "stderr"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
 			outputLevel:                 "info",
 			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
 			IncludeCallerSourceLocation: false,
 			JSONEncoding:                false,
 		}},
 
 		{"--log_callers", Options{
 			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
 			outputLevel:                 "info",
 			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
 			IncludeCallerSourceLocation: true,
 			JSONEncoding:                false,
 		}},
 
 		{"--log_stacktrace_level debug", Options{
 			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
 			outputLevel:                 "info",
 			stackTraceLevel:             "debug",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+			JSONEncoding:                false,
+		}},
+
+		{"--log_stacktrace_level default:none,dispatcher:error", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			outputLevel:                 "info",
+			stackTraceLevel:             "default:none,dispatcher:error",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+			JSONEncoding:                false,
+		}},
+
+		{"--log_scope_sampling report:10/1000,config:none", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			ScopeSampling:               "report:10/1000,config:none",
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
 			IncludeCallerSourceLocation: false,
 			JSONEncoding:                false,
 		}},
 
 		{"--log_stacktrace_level info", Options{
 			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
 			outputLevel:                 "info",
 			stackTraceLevel:             "info",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
 			IncludeCallerSourceLocation: false,
 			JSONEncoding:                false,
 		}},
 
 		{"--log_stacktrace_level warn", Options{
 			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
 			outputLevel:                 "info",
 			stackTraceLevel:             "warn",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
 			IncludeCallerSourceLocation: false,
 			JSONEncoding:                false,
 		}},
 
 		{"--log_stacktrace_level error", Options{
 			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
 			outputLevel:                 "info",
 			stackTraceLevel:             "error",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
 			IncludeCallerSourceLocation: false,
 			JSONEncoding:                false,
 		}},
 
 		{"--log_stacktrace_level none", Options{
 			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
 			outputLevel:                 "info",
 			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
 			IncludeCallerSourceLocation: false,
 			JSONEncoding:                false,
 		}},
 
 		{"--log_output_level debug", Options{
 			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
 			outputLevel:                 "debug",
 			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
 			IncludeCallerSourceLocation: false,
 			JSONEncoding:                false,
 		}},
 
 		{"--log_output_level info", Options{
 			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
 			outputLevel:                 "info",
 			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
 			IncludeCallerSourceLocation: false,
 			JSONEncoding:                false,
 		}},
 
 		{"--log_output_level warn", Options{
 			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
 			outputLevel:                 "warn",
 			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
 			IncludeCallerSourceLocation: false,
 			JSONEncoding:                false,
 		}},
 
 		{"--log_output_level error", Options{
 			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
 			outputLevel:                 "error",
 			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
 			IncludeCallerSourceLocation: false,
 			JSONEncoding:                false,
 		}},
 
 		{"--log_output_level none", Options{
 			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
 			outputLevel:                 "none",
 			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+			JSONEncoding:                false,
+		}},
+
+		{"--log_sampling_summary_interval 1m", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+			JSONEncoding:                false,
+			SamplingSummaryInterval:     time.Minute,
+		}},
+
+		{"--log_error_summary_interval 5m", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+			JSONEncoding:                false,
+			ErrorSummaryInterval:        5 * time.Minute,
+		}},
+
+		{"--log_recent_entries 1000", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+			JSONEncoding:                false,
+			RecentEntries:               1000,
+		}},
+
+		{"--log_stdlog_scope stdlog --log_stdlog_level warn", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+			JSONEncoding:                false,
+			StdLogScope:                 "stdlog",
+			StdLogLevel:                 "warn",
+		}},
+
+		{"--log_failover_path stderr", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+			JSONEncoding:                false,
+			FailoverPath:                "stderr",
+		}},
+
+		{"--log_level_override mixer/pkg/runtime/*.go=debug", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+			JSONEncoding:                false,
+			LevelOverrides:              []string{"mixer/pkg/runtime/*.go=debug"},
+		}},
+
+		{"--log_debug_trigger_path /var/run/istio/debug", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+			JSONEncoding:                false,
+			DebugTriggerPath:            "/var/run/istio/debug",
+		}},
+
+		{"--log_schema 1", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+			JSONEncoding:                false,
+			LogSchema:                   1,
+		}},
+
+		{"--log_debug_sample_percentage 0.5", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+			JSONEncoding:                false,
+			DebugSamplePercentage:       0.5,
+		}},
+
+		{"--log_json_indent", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+			JSONEncoding:                false,
+			JSONIndent:                  true,
+		}},
+
+		{"--log_dev", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+			JSONEncoding:                false,
+			DevelopmentMode:             true,
+		}},
+
+		{"--log_detect_duplicate_keys", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+			JSONEncoding:                false,
+			DetectDuplicateKeys:         true,
+		}},
+
+		{"--log_sampling_initial 10 --log_sampling_thereafter 5", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             10,
+			SamplingThereafter:          5,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+			JSONEncoding:                false,
+		}},
+
+		{"--log_sampling_budget 1000", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			SamplingBudget:              1000,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+			JSONEncoding:                false,
+		}},
+
+		{"--log_dedup_window 5s", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			DedupWindow:                 5 * time.Second,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+			JSONEncoding:                false,
+		}},
+
+		{"--log_field_allowlist foo --log_field_allowlist bar* --log_field_denylist barbaz", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			FieldAllowlist:              []string{"foo", "bar*"},
+			FieldDenylist:               []string{"barbaz"},
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+			JSONEncoding:                false,
+		}},
+
+		{"--log_filter include=.*RBAC.* --log_filter exclude=denied", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			MessageFilters:              []string{"include=.*RBAC.*", "exclude=denied"},
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+			JSONEncoding:                false,
+		}},
+
+		{"--log_audit_target /var/log/audit.log", Options{
+			OutputPaths:                 []string{"stdout"},
+			AuditOutputPaths:            []string{"/var/log/audit.log"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+			JSONEncoding:                false,
+		}},
+
+		{"--log_audit_hash_chain --log_audit_checkpoint_interval 1h --log_audit_signing_key key.pem", Options{
+			OutputPaths:                 []string{"stdout"},
+			AuditHashChain:              true,
+			AuditCheckpointInterval:     time.Hour,
+			AuditSigningKeyPath:         "key.pem",
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+			JSONEncoding:                false,
+		}},
+
+		{"--log_tls_ca ca.pem --log_tls_cert cert.pem --log_tls_key key.pem --log_tls_server_name collector --log_tls_min_version 1.1", Options{
+			OutputPaths:                 []string{"stdout"},
+			TLSCAFile:                   "ca.pem",
+			TLSCertFile:                 "cert.pem",
+			TLSKeyFile:                  "key.pem",
+			TLSServerName:               "collector",
+			TLSMinVersion:               "1.1",
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+		}},
+
+		{"--log_async --log_async_buffer 100 --log_async_drop_policy drop-oldest --log_async_drop_summary_interval 1m", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			Async:                       true,
+			AsyncBufferSize:             100,
+			AsyncDropPolicy:             "drop-oldest",
+			AsyncDropSummaryInterval:    time.Minute,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+		}},
+
+		{"--log_flush_interval 10s", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			FlushInterval:               10 * time.Second,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+		}},
+
+		{"--log_verbosity 4", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			Verbosity:                   4,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+		}},
+
+		{"--log_field cluster=us-east1 --log_process_identity --log_component mixer --log_version", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			GlobalFields:                []string{"cluster=us-east1"},
+			IncludeProcessIdentity:      true,
+			Component:                   "mixer",
+			IncludeVersion:              true,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+		}},
+
+		{"--log_time_format rfc3339nano --log_utc", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			TimeFormat:                  "rfc3339nano",
+			UTC:                         true,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+		}},
+
+		{"--log_max_message_bytes 1024 --log_max_field_bytes 256", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			MaxMessageBytes:             1024,
+			MaxFieldBytes:               256,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+		}},
+
+		{"--log_error_target /var/log/mixer-errors.log --log_create_dirs", Options{
+			OutputPaths:                 []string{"stdout"},
+			ErrorOutputPaths:            []string{"/var/log/mixer-errors.log"},
+			CreateOutputDirs:            true,
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+		}},
+
+		{"--log_file_permissions 0640 --log_file_owner 1337:1337", Options{
+			OutputPaths:                 []string{"stdout"},
+			FilePermissions:             "0640",
+			FileOwner:                   "1337:1337",
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+		}},
+
+		{"--log_rotation_interval daily --log_audit_rotation_interval hourly --log_rotation_compress", Options{
+			OutputPaths:                 []string{"stdout"},
+			RotationInterval:            "daily",
+			AuditRotationInterval:       "hourly",
+			RotationCompress:            true,
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+		}},
+
+		{"--log_disk_quota_bytes 1048576", Options{
+			OutputPaths:                 []string{"stdout"},
+			DiskQuotaBytes:              1048576,
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+		}},
+
+		{"--log_capture_stdlog=false", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			IncludeCallerSourceLocation: false,
+		}},
+
+		{"--log_replace_global_zap=false", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			CaptureStdLog:               true,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			IncludeCallerSourceLocation: false,
+		}},
+
+		{"--log_capture_grpclog=false", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			CaptureStdLog:               true,
+			ReplaceGlobalZap:            true,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			IncludeCallerSourceLocation: false,
+		}},
+
+		{"--log_goroutine_ids", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			IncludeGoroutineID:          true,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+		}},
+
+		{"--log_duration_encoding millis", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			DurationEncoding:            "millis",
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+		}},
+
+		{"--log_caller_encoding trimmed", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			CallerEncoding:              "trimmed",
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+		}},
+
+		{"--log_line_ending crlf", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			LineEnding:                  "crlf",
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+		}},
+
+		{"--log_stacktrace_encoding frames", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			StackTraceEncoding:          "frames",
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+		}},
+
+		{"--log_encoder_key time=@timestamp --log_encoder_key msg=message", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			EncoderKeys:                 []string{"time=@timestamp", "msg=message"},
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+		}},
+
+		{"--log_console_escaping never", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			ConsoleEscaping:             "never",
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+		}},
+
+		{"--log_colors --log_force_colors", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			UseColoredLevels:            true,
+			ForceColoredLevels:          true,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
+			IncludeCallerSourceLocation: false,
+		}},
+
+		{"--log_disable_sampling", Options{
+			OutputPaths:                 []string{"stdout"},
+			SamplingInitial:             100,
+			SamplingThereafter:          100,
+			DisableSampling:             true,
+			outputLevel:                 "info",
+			stackTraceLevel:             "none",
+			CaptureGRPCLog:              true,
+			ReplaceGlobalZap:            true,
+			CaptureStdLog:               true,
 			IncludeCallerSourceLocation: false,
 			JSONEncoding:                false,
 		}},
@@ -226,3 +926,102 @@ func TestLevel(t *testing.T) {
 		t.Errorf("Got success, expecting error")
 	}
 }
+
+func TestScopeStackTraceLevels(t *testing.T) {
+	cases := []struct {
+		value  string
+		level  zapcore.Level
+		scopes map[string]zapcore.Level
+	}{
+		{"error", zapcore.ErrorLevel, nil},
+		{"default:none,dispatcher:error", None, map[string]zapcore.Level{"dispatcher": zapcore.ErrorLevel}},
+		{"dispatcher:debug, api:warn", None, map[string]zapcore.Level{"dispatcher": zapcore.DebugLevel, "api": zapcore.WarnLevel}},
+		{"warn,dispatcher:none", zapcore.WarnLevel, map[string]zapcore.Level{"dispatcher": None}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.value, func(t *testing.T) {
+			o := NewOptions()
+			o.stackTraceLevel = c.value
+
+			level, err := o.GetStackTraceLevel()
+			if err != nil {
+				t.Fatalf("Got err '%v', expecting success", err)
+			}
+			if level != c.level {
+				t.Errorf("Got level %v, expecting %v", level, c.level)
+			}
+
+			scopes, err := o.GetScopeStackTraceLevels()
+			if err != nil {
+				t.Fatalf("Got err '%v', expecting success", err)
+			}
+			if !reflect.DeepEqual(scopes, c.scopes) {
+				t.Errorf("Got scope levels %v, expecting %v", scopes, c.scopes)
+			}
+		})
+	}
+
+	for _, value := range []string{"foobar", "dispatcher:foobar", ":error", "error,"} {
+		o := NewOptions()
+		o.stackTraceLevel = value
+		if _, err := o.GetStackTraceLevel(); err == nil {
+			t.Errorf("%s: got success, expecting an error", value)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, name := range []string{"debug", "info", "warn", "error", "none"} {
+		l, err := ParseLevel(name)
+		if err != nil {
+			t.Fatalf("Got err '%v', expecting %s to parse", err, name)
+		}
+		if l.String() != name || levelToString[zapcore.Level(l)] != name {
+			t.Errorf("Got %v, expecting %s", l, name)
+		}
+	}
+
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("Got success, expecting an unknown level to fail")
+	}
+	if s := Level(zapcore.FatalLevel).String(); s != "Level(5)" {
+		t.Errorf("Got '%s', expecting the number of a level without a name", s)
+	}
+}
+
+func TestLevelMarshaling(t *testing.T) {
+	type config struct {
+		Level Level `json:"level"`
+	}
+
+	b, err := json.Marshal(config{Level(zapcore.WarnLevel)})
+	if err != nil || string(b) != `{"level":"warn"}` {
+		t.Errorf("Got '%s' and err '%v', expecting the level marshaled by name", b, err)
+	}
+
+	var c config
+	if err = json.Unmarshal([]byte(`{"level":"none"}`), &c); err != nil || zapcore.Level(c.Level) != None {
+		t.Errorf("Got %v and err '%v', expecting none", c.Level, err)
+	}
+	if err = json.Unmarshal([]byte(`{"level":"loud"}`), &c); err == nil {
+		t.Error("Got success, expecting an unknown level to fail")
+	}
+	if _, err = json.Marshal(config{Level(zapcore.PanicLevel)}); err == nil {
+		t.Error("Got success, expecting a level without a name to fail")
+	}
+
+	y, err := Level(zapcore.DebugLevel).MarshalYAML()
+	if err != nil || y != "debug" {
+		t.Errorf("Got %v and err '%v', expecting debug", y, err)
+	}
+
+	var l Level
+	unmarshal := func(v interface{}) error {
+		*v.(*string) = "error"
+		return nil
+	}
+	if err = l.UnmarshalYAML(unmarshal); err != nil || zapcore.Level(l) != zapcore.ErrorLevel {
+		t.Errorf("Got %v and err '%v', expecting error", l, err)
+	}
+}
@@ -0,0 +1,446 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+)
+
+// OpenTelemetry output
+//
+// Entries are exported to an OpenTelemetry collector over OTLP/gRPC when OutputPaths contains
+// otlp://host[:port] or otlp+tls://host[:port], the port defaulting to 4317. Each scope is
+// exported as an instrumentation scope of its own, and the fields of the entries as attributes of
+// their log records. These query parameters are supported:
+//
+//		resource.<key>   a resource attribute, for example resource.service.name=mixer. service.name
+//		                 defaults to the name of the program, and host.name, k8s.pod.name, and
+//		                 k8s.namespace.name are set from the environment
+//		batch            the maximum number of entries exported at once, 512 by default
+//		flush            the maximum time an entry waits to be exported, 1s by default
+//		buffer           the maximum number of entries held while the collector is unreachable,
+//		                 10000 by default
+//		timeout          the timeout of each export, 10s by default
+//
+// Exports failing with a transient gRPC status are retried.
+
+const (
+	otlpDefaultPort   = "4317"
+	otlpExportMethod  = "/opentelemetry.proto.collector.logs.v1.LogsService/Export"
+	otlpResourceParam = "resource."
+)
+
+var otlpDefaultBatch = batchSettings{
+	size:     512,
+	interval: time.Second,
+	buffer:   10000,
+	timeout:  10 * time.Second,
+}
+
+// Field numbers of the OTLP messages.
+const (
+	otlpRequestResourceLogs = 1 // ExportLogsServiceRequest.resource_logs
+
+	otlpResourceLogsResource  = 1 // ResourceLogs.resource
+	otlpResourceLogsScopeLogs = 2 // ResourceLogs.scope_logs
+	otlpResourceAttributes    = 1 // Resource.attributes
+
+	otlpScopeLogsScope   = 1 // ScopeLogs.scope
+	otlpScopeLogsRecords = 2 // ScopeLogs.log_records
+	otlpScopeName        = 1 // InstrumentationScope.name
+
+	otlpRecordTime         = 1  // LogRecord.time_unix_nano
+	otlpRecordSeverity     = 2  // LogRecord.severity_number
+	otlpRecordSeverityText = 3  // LogRecord.severity_text
+	otlpRecordBody         = 5  // LogRecord.body
+	otlpRecordAttributes   = 6  // LogRecord.attributes
+	otlpRecordObservedTime = 11 // LogRecord.observed_time_unix_nano
+
+	otlpKeyValueKey   = 1 // KeyValue.key
+	otlpKeyValueValue = 2 // KeyValue.value
+
+	otlpValueString = 1 // AnyValue.string_value
+	otlpValueBool   = 2 // AnyValue.bool_value
+	otlpValueInt    = 3 // AnyValue.int_value
+	otlpValueDouble = 4 // AnyValue.double_value
+	otlpValueArray  = 5 // AnyValue.array_value
+	otlpValueKVList = 6 // AnyValue.kvlist_value
+
+	otlpArrayValues  = 1 // ArrayValue.values
+	otlpKVListValues = 1 // KeyValueList.values
+)
+
+// The OTLP severity numbers of the zap levels.
+var otlpSeverities = map[zapcore.Level]uint64{
+	zapcore.DebugLevel:  5,
+	zapcore.InfoLevel:   9,
+	zapcore.WarnLevel:   13,
+	zapcore.ErrorLevel:  17,
+	zapcore.DPanicLevel: 18,
+	zapcore.PanicLevel:  19,
+	zapcore.FatalLevel:  21,
+}
+
+func init() {
+	RegisterSink("otlp", newOTLPSink)
+	RegisterSink("otlp+tls", newOTLPSink)
+}
+
+// otlpEntry is an entry waiting to be exported, its log record already encoded.
+type otlpEntry struct {
+	scope  string
+	record []byte
+}
+
+// otlpCore outputs entries to an OpenTelemetry collector.
+type otlpCore struct {
+	zapcore.LevelEnabler
+
+	batcher *batcher
+	fields  []zapcore.Field
+}
+
+// otlpExporter holds the connection to the collector. It is closed along with the batcher.
+type otlpExporter struct {
+	conn     *grpc.ClientConn
+	resource []byte
+	timeout  time.Duration
+	batcher  *batcher
+}
+
+func newOTLPSink(u *url.URL, enab zapcore.LevelEnabler) (zapcore.Core, io.Closer, error) {
+	if u.Hostname() == "" {
+		return nil, nil, fmt.Errorf("missing OTLP collector address in %s", u)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = otlpDefaultPort
+	}
+
+	q := u.Query()
+	settings, err := parseBatchSettings(q, otlpDefaultBatch)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid OTLP settings in %s: %v", u, err)
+	}
+
+	creds := grpc.WithInsecure()
+	if u.Scheme == "otlp+tls" {
+		creds = grpc.WithTransportCredentials(credentials.NewTLS(sinkTLSConfig()))
+	}
+
+	// the connection is established in the background, and re-established as needed
+	conn, err := grpc.Dial(u.Hostname()+":"+port, creds, grpc.WithCodec(otlpCodec{}))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to connect to the OTLP collector at %s: %v", u.Host, err)
+	}
+
+	e := &otlpExporter{
+		conn:     conn,
+		resource: otlpResource(q),
+		timeout:  settings.timeout,
+	}
+	e.batcher = newBatcher("OTLP collector at "+u.Host, settings, e.export)
+
+	return &otlpCore{LevelEnabler: enab, batcher: e.batcher}, e, nil
+}
+
+// otlpResource encodes the resource attributes from the given query parameters and the
+// environment.
+func otlpResource(q url.Values) []byte {
+	attrs := map[string]string{"service.name": filepath.Base(os.Args[0])}
+	if host, err := os.Hostname(); err == nil {
+		attrs["host.name"] = host
+	}
+	if pod := os.Getenv(podNameEnv); pod != "" {
+		attrs["k8s.pod.name"] = pod
+	}
+	if ns := os.Getenv(podNamespaceEnv); ns != "" {
+		attrs["k8s.namespace.name"] = ns
+	}
+	for k, v := range q {
+		if strings.HasPrefix(k, otlpResourceParam) && len(v) > 0 {
+			attrs[strings.TrimPrefix(k, otlpResourceParam)] = v[0]
+		}
+	}
+
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b []byte
+	for _, k := range keys {
+		b = otlpAppendKeyValue(b, otlpResourceAttributes, k, attrs[k])
+	}
+	return b
+}
+
+func (e *otlpExporter) export(batch []interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	var reply []byte
+	err := grpc.Invoke(ctx, otlpExportMethod, otlpExportRequest(e.resource, batch), &reply, e.conn)
+	switch grpc.Code(err) {
+	case codes.OK:
+		return nil
+	case codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded, codes.Aborted:
+		return retryableError{error: err}
+	default:
+		return err
+	}
+}
+
+func (e *otlpExporter) reportStatus(s *sinkStats) {
+	e.batcher.reportStatus(s)
+}
+
+// Close exports the buffered entries and closes the connection.
+func (e *otlpExporter) Close() error {
+	_ = e.batcher.Close()
+	return e.conn.Close()
+}
+
+// otlpExportRequest encodes an ExportLogsServiceRequest holding the given entries, grouped by
+// scope in the order the scopes first appear.
+func otlpExportRequest(resource []byte, batch []interface{}) []byte {
+	var scopes []string
+	records := make(map[string][]byte)
+	for _, e := range batch {
+		entry := e.(*otlpEntry)
+		if _, ok := records[entry.scope]; !ok {
+			scopes = append(scopes, entry.scope)
+		}
+		records[entry.scope] = otlpAppendBytes(records[entry.scope], otlpScopeLogsRecords, entry.record)
+	}
+
+	var rl []byte
+	rl = otlpAppendBytes(rl, otlpResourceLogsResource, resource)
+	for _, s := range scopes {
+		sl := otlpAppendBytes(nil, otlpScopeLogsScope, otlpAppendString(nil, otlpScopeName, s))
+		rl = otlpAppendBytes(rl, otlpResourceLogsScopeLogs, append(sl, records[s]...))
+	}
+
+	return otlpAppendBytes(nil, otlpRequestResourceLogs, rl)
+}
+
+func (c *otlpCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = append(c.fields[:len(c.fields):len(c.fields)], fields...)
+	return &clone
+}
+
+func (c *otlpCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *otlpCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	scope := ent.LoggerName
+	if scope == "" {
+		scope = defaultScopeName
+	}
+	return c.batcher.enqueue(&otlpEntry{scope: scope, record: otlpLogRecord(ent, append(c.fields[:len(c.fields):len(c.fields)], fields...))})
+}
+
+func (c *otlpCore) Sync() error {
+	return c.batcher.sync()
+}
+
+// otlpLogRecord encodes a LogRecord for the given entry.
+func otlpLogRecord(ent zapcore.Entry, fields []zapcore.Field) []byte {
+	var b []byte
+	b = otlpAppendFixed64(b, otlpRecordTime, uint64(ent.Time.UnixNano()))
+	b = otlpAppendVarint(b, otlpRecordSeverity, otlpSeverities[ent.Level])
+	b = otlpAppendString(b, otlpRecordSeverityText, ent.Level.CapitalString())
+	b = otlpAppendBytes(b, otlpRecordBody, otlpAppendString(nil, otlpValueString, ent.Message))
+
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	if ent.Caller.Defined {
+		enc.Fields["code.filepath"] = ent.Caller.File
+		enc.Fields["code.lineno"] = int64(ent.Caller.Line)
+	}
+	if ent.Stack != "" {
+		enc.Fields["exception.stacktrace"] = ent.Stack
+	}
+
+	keys := make([]string, 0, len(enc.Fields))
+	for k := range enc.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b = otlpAppendKeyValue(b, otlpRecordAttributes, k, enc.Fields[k])
+	}
+
+	return otlpAppendFixed64(b, otlpRecordObservedTime, uint64(time.Now().UnixNano()))
+}
+
+// otlpAppendKeyValue appends a KeyValue as the given field.
+func otlpAppendKeyValue(b []byte, num int, key string, value interface{}) []byte {
+	kv := otlpAppendString(nil, otlpKeyValueKey, key)
+	kv = otlpAppendBytes(kv, otlpKeyValueValue, otlpAnyValue(value))
+	return otlpAppendBytes(b, num, kv)
+}
+
+// otlpAnyValue encodes an AnyValue holding a value decoded by a MapObjectEncoder.
+func otlpAnyValue(value interface{}) []byte {
+	switch v := value.(type) {
+	case string:
+		return otlpAppendString(nil, otlpValueString, v)
+	case bool:
+		if v {
+			return otlpAppendVarint(nil, otlpValueBool, 1)
+		}
+		return otlpAppendVarint(nil, otlpValueBool, 0)
+	case int64:
+		return otlpAppendVarint(nil, otlpValueInt, uint64(v))
+	case int32:
+		return otlpAppendVarint(nil, otlpValueInt, uint64(int64(v)))
+	case int16:
+		return otlpAppendVarint(nil, otlpValueInt, uint64(int64(v)))
+	case int8:
+		return otlpAppendVarint(nil, otlpValueInt, uint64(int64(v)))
+	case int:
+		return otlpAppendVarint(nil, otlpValueInt, uint64(int64(v)))
+	case uint64:
+		return otlpAppendVarint(nil, otlpValueInt, v)
+	case uint32:
+		return otlpAppendVarint(nil, otlpValueInt, uint64(v))
+	case uint16:
+		return otlpAppendVarint(nil, otlpValueInt, uint64(v))
+	case uint8:
+		return otlpAppendVarint(nil, otlpValueInt, uint64(v))
+	case uint:
+		return otlpAppendVarint(nil, otlpValueInt, uint64(v))
+	case float64:
+		return otlpAppendFixed64(nil, otlpValueDouble, math.Float64bits(v))
+	case float32:
+		return otlpAppendFixed64(nil, otlpValueDouble, math.Float64bits(float64(v)))
+	case time.Duration:
+		return otlpAppendVarint(nil, otlpValueInt, uint64(v))
+	case time.Time:
+		return otlpAppendString(nil, otlpValueString, v.Format(time.RFC3339Nano))
+	case []interface{}:
+		var arr []byte
+		for _, e := range v {
+			arr = otlpAppendBytes(arr, otlpArrayValues, otlpAnyValue(e))
+		}
+		return otlpAppendBytes(nil, otlpValueArray, arr)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		var kvs []byte
+		for _, k := range keys {
+			kvs = otlpAppendKeyValue(kvs, otlpKVListValues, k, v[k])
+		}
+		return otlpAppendBytes(nil, otlpValueKVList, kvs)
+	case error:
+		return otlpAppendString(nil, otlpValueString, v.Error())
+	case fmt.Stringer:
+		return otlpAppendString(nil, otlpValueString, v.String())
+	default:
+		if j, err := json.Marshal(v); err == nil {
+			return otlpAppendString(nil, otlpValueString, string(j))
+		}
+		return otlpAppendString(nil, otlpValueString, fmt.Sprint(v))
+	}
+}
+
+// The protocol buffer encoding of the OTLP messages, which are few enough not to warrant generated
+// code.
+
+func otlpAppendUvarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func otlpAppendTag(b []byte, num int, wireType int) []byte {
+	return otlpAppendUvarint(b, uint64(num)<<3|uint64(wireType))
+}
+
+func otlpAppendVarint(b []byte, num int, v uint64) []byte {
+	return otlpAppendUvarint(otlpAppendTag(b, num, 0), v)
+}
+
+func otlpAppendFixed64(b []byte, num int, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(otlpAppendTag(b, num, 1), buf[:]...)
+}
+
+func otlpAppendBytes(b []byte, num int, v []byte) []byte {
+	b = otlpAppendUvarint(otlpAppendTag(b, num, 2), uint64(len(v)))
+	return append(b, v...)
+}
+
+func otlpAppendString(b []byte, num int, v string) []byte {
+	b = otlpAppendUvarint(otlpAppendTag(b, num, 2), uint64(len(v)))
+	return append(b, v...)
+}
+
+// otlpCodec passes the encoded requests and replies of the exporter through to gRPC as they are.
+type otlpCodec struct{}
+
+func (otlpCodec) Marshal(v interface{}) ([]byte, error) {
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected OTLP message %T", v)
+	}
+	return b, nil
+}
+
+func (otlpCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("unexpected OTLP message %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+func (otlpCodec) String() string {
+	return "proto"
+}
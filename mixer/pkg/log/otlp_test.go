@@ -0,0 +1,280 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// pbMessage holds the fields of a decoded protocol buffer message, by number: uint64 for varints
+// and fixed64 values, []byte for length-delimited ones.
+type pbMessage map[int][]interface{}
+
+func decodePB(t *testing.T, b []byte) pbMessage {
+	m := make(pbMessage)
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		b = b[n:]
+		num := int(tag >> 3)
+
+		switch tag & 7 {
+		case 0:
+			v, n := binary.Uvarint(b)
+			m[num] = append(m[num], v)
+			b = b[n:]
+		case 1:
+			m[num] = append(m[num], binary.LittleEndian.Uint64(b))
+			b = b[8:]
+		case 2:
+			size, n := binary.Uvarint(b)
+			m[num] = append(m[num], b[n:n+int(size)])
+			b = b[n+int(size):]
+		default:
+			t.Fatalf("Unexpected wire type %d", tag&7)
+		}
+	}
+	return m
+}
+
+func (m pbMessage) message(t *testing.T, num int) pbMessage {
+	return decodePB(t, m[num][0].([]byte))
+}
+
+func (m pbMessage) messages(t *testing.T, num int) []pbMessage {
+	var ms []pbMessage
+	for _, b := range m[num] {
+		ms = append(ms, decodePB(t, b.([]byte)))
+	}
+	return ms
+}
+
+func (m pbMessage) string(num int) string {
+	if len(m[num]) == 0 {
+		return ""
+	}
+	return string(m[num][0].([]byte))
+}
+
+// attributes decodes the given KeyValue fields, with the values of AnyValue as strings, int64,
+// float64, or bool.
+func (m pbMessage) attributes(t *testing.T, num int) map[string]interface{} {
+	attrs := make(map[string]interface{})
+	for _, kv := range m.messages(t, num) {
+		v := kv.message(t, otlpKeyValueValue)
+		switch {
+		case len(v[otlpValueString]) > 0:
+			attrs[kv.string(otlpKeyValueKey)] = v.string(otlpValueString)
+		case len(v[otlpValueInt]) > 0:
+			attrs[kv.string(otlpKeyValueKey)] = int64(v[otlpValueInt][0].(uint64))
+		case len(v[otlpValueDouble]) > 0:
+			attrs[kv.string(otlpKeyValueKey)] = math.Float64frombits(v[otlpValueDouble][0].(uint64))
+		case len(v[otlpValueBool]) > 0:
+			attrs[kv.string(otlpKeyValueKey)] = v[otlpValueBool][0].(uint64) == 1
+		default:
+			attrs[kv.string(otlpKeyValueKey)] = v
+		}
+	}
+	return attrs
+}
+
+// newFakeOTLPCollector records the export requests it receives, failing the first one holding the
+// given text with the given code. gRPC logs its connections, which are exported too.
+func newFakeOTLPCollector(t *testing.T, failing string, code codes.Code) (string, chan []byte, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+
+	requests := make(chan []byte, 100)
+	var failed int32
+
+	server := grpc.NewServer(grpc.CustomCodec(otlpCodec{}))
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "opentelemetry.proto.collector.logs.v1.LogsService",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Export",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				var req []byte
+				if err := dec(&req); err != nil {
+					return nil, err
+				}
+				if strings.Contains(string(req), failing) && atomic.AddInt32(&failed, 1) == 1 {
+					return nil, status.Error(code, "failing")
+				}
+				requests <- req
+				return []byte{}, nil
+			},
+		}},
+	}, struct{}{})
+
+	go func() { _ = server.Serve(l) }()
+
+	// the transports log their shutdown from goroutines of their own, which mustn't outlast the test
+	stop := func() {
+		server.Stop()
+		time.Sleep(100 * time.Millisecond)
+	}
+	return l.Addr().String(), requests, stop
+}
+
+type otlpRecord struct {
+	scope  string
+	record pbMessage
+}
+
+// nextOTLPRecords waits for the records with the given messages to be exported, and returns all the
+// records exported by then, by message.
+func nextOTLPRecords(t *testing.T, requests chan []byte, messages ...string) (pbMessage, map[string]otlpRecord) {
+	var resource pbMessage
+	records := make(map[string]otlpRecord)
+
+	for {
+		missing := false
+		for _, m := range messages {
+			if _, ok := records[m]; !ok {
+				missing = true
+			}
+		}
+		if !missing {
+			return resource, records
+		}
+
+		var req []byte
+		select {
+		case req = <-requests:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for %v, got %v", messages, records)
+		}
+
+		rl := decodePB(t, req).message(t, otlpRequestResourceLogs)
+		resource = rl.message(t, otlpResourceLogsResource)
+		for _, sl := range rl.messages(t, otlpResourceLogsScopeLogs) {
+			scope := sl.message(t, otlpScopeLogsScope).string(otlpScopeName)
+			for _, r := range sl.messages(t, otlpScopeLogsRecords) {
+				records[r.message(t, otlpRecordBody).string(otlpValueString)] = otlpRecord{scope, r}
+			}
+		}
+	}
+}
+
+func TestOTLP(t *testing.T) {
+	addr, requests, stop := newFakeOTLPCollector(t, "Hello", codes.Unavailable)
+	defer stop()
+
+	o := NewOptions()
+	o.OutputPaths = []string{"otlp://" + addr + "?resource.service.name=mixer&resource.deployment.environment=test&flush=10ms"}
+	o.AuditOutputPaths = nil
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer configureWithoutOutput(t)
+
+	Info("Hello", zap.Int("count", 3), zap.Bool("ok", true))
+	Named("dispatcher").With(zap.String("adapter", "a")).Warn("Slow", zap.Float64("ratio", 0.5))
+
+	resource, records := nextOTLPRecords(t, requests, "Hello", "Slow")
+
+	attrs := resource.attributes(t, otlpResourceAttributes)
+	if attrs["service.name"] != "mixer" || attrs["deployment.environment"] != "test" || attrs["host.name"] == nil {
+		t.Errorf("Got resource %v, expecting the attributes of the URL and the host", attrs)
+	}
+
+	expected := []struct {
+		scope    string
+		severity uint64
+		text     string
+		body     string
+		attrs    map[string]interface{}
+	}{
+		{"default", 9, "INFO", "Hello", map[string]interface{}{"count": int64(3), "ok": true}},
+		{"dispatcher", 13, "WARN", "Slow", map[string]interface{}{"adapter": "a", "ratio": 0.5}},
+	}
+	for _, e := range expected {
+		rec := records[e.body]
+		if rec.scope != e.scope {
+			t.Errorf("Got scope %s, expecting %s", rec.scope, e.scope)
+		}
+
+		r := rec.record
+		if r[otlpRecordSeverity][0] != e.severity || r.string(otlpRecordSeverityText) != e.text || len(r[otlpRecordTime]) != 1 {
+			t.Errorf("Got record %v, expecting severity %s", r, e.text)
+		}
+
+		attrs := r.attributes(t, otlpRecordAttributes)
+		for k, v := range e.attrs {
+			if attrs[k] != v {
+				t.Errorf("Got attributes %v, expecting %s=%v", attrs, k, v)
+			}
+		}
+	}
+}
+
+func TestOTLPPermanentFailure(t *testing.T) {
+	addr, requests, stop := newFakeOTLPCollector(t, "Rejected", codes.InvalidArgument)
+	defer stop()
+
+	o := NewOptions()
+	o.OutputPaths = []string{"otlp://" + addr + "?flush=10ms"}
+	o.AuditOutputPaths = nil
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer configureWithoutOutput(t)
+
+	Info("Rejected")
+	Sync()
+	Info("Accepted")
+
+	if _, records := nextOTLPRecords(t, requests, "Accepted"); len(records["Rejected"].record) > 0 {
+		t.Error("Got the rejected entry exported again, expecting it dropped")
+	}
+}
+
+func TestOTLPAnyValue(t *testing.T) {
+	v := decodePB(t, otlpAnyValue(map[string]interface{}{"list": []interface{}{"a", int64(-2)}}))
+	kv := v.message(t, otlpValueKVList).messages(t, otlpKVListValues)
+	if len(kv) != 1 || kv[0].string(otlpKeyValueKey) != "list" {
+		t.Fatalf("Got %v, expecting a single key", kv)
+	}
+
+	values := kv[0].message(t, otlpKeyValueValue).message(t, otlpValueArray).messages(t, otlpArrayValues)
+	if len(values) != 2 || values[0].string(otlpValueString) != "a" || int64(values[1][otlpValueInt][0].(uint64)) != -2 {
+		t.Errorf("Got %v, expecting the array", values)
+	}
+}
+
+func TestOTLPInvalidURL(t *testing.T) {
+	for _, u := range []string{"otlp://", "otlp://collector?batch=0"} {
+		o := NewOptions()
+		o.OutputPaths = []string{u}
+		if err := Configure(o); err == nil || !strings.Contains(err.Error(), "OTLP") {
+			t.Errorf("%s: got err '%v', expecting an OTLP error", u, err)
+		}
+	}
+	configureWithoutOutput(t)
+}
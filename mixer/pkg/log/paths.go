@@ -0,0 +1,178 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// outputDirMode is the mode of the directories created for the output files.
+const outputDirMode = 0755
+
+// fileSettings describe how the output files are created.
+type fileSettings struct {
+	// whether to create the missing directories
+	createDirs bool
+
+	// the permissions of the files, 0 to leave them to the umask
+	mode os.FileMode
+
+	// the owner and group of the files, -1 to leave them to the process
+	uid int
+	gid int
+}
+
+// newFileSettings produces the settings of the output files described by the options.
+func newFileSettings(o *Options) (*fileSettings, error) {
+	fs := &fileSettings{createDirs: o.CreateOutputDirs, uid: -1, gid: -1}
+
+	if o.FilePermissions != "" {
+		mode, err := strconv.ParseUint(o.FilePermissions, 8, 32)
+		if err != nil || mode > 0777 {
+			return nil, fmt.Errorf("invalid file permissions %s, expecting an octal mode such as 0640", o.FilePermissions)
+		}
+		fs.mode = os.FileMode(mode)
+	}
+
+	if o.FileOwner != "" {
+		if runtime.GOOS == "windows" {
+			return nil, fmt.Errorf("setting the owner of the log files isn't supported on %s", runtime.GOOS)
+		}
+
+		owner := strings.SplitN(o.FileOwner, ":", 2)
+		ids := make([]int, len(owner))
+		for i, s := range owner {
+			id, err := strconv.Atoi(s)
+			if err != nil || id < 0 {
+				return nil, fmt.Errorf("invalid file owner %s, expecting <uid> or <uid>:<gid>", o.FileOwner)
+			}
+			ids[i] = id
+		}
+
+		fs.uid = ids[0]
+		if len(ids) > 1 {
+			fs.gid = ids[1]
+		}
+	}
+
+	return fs, nil
+}
+
+// prepareOutputPaths checks that the given output paths can be written to before the outputs get
+// built, returning an error naming the offending path otherwise. The files are created according
+// to the given settings. Sink URLs are left to the sinks.
+func prepareOutputPaths(paths []string, fs *fileSettings) error {
+	files, _ := splitOutputPaths(paths)
+	for _, p := range files {
+		if err := prepareOutputFile(p, fs); err != nil {
+			return fmt.Errorf("unable to output the log to %s: %v", p, err)
+		}
+	}
+	return nil
+}
+
+// outputStreams returns the standard streams, stdout or stderr, which the outputs and the error
+// output described by the options write to.
+func outputStreams(options *Options, outputLevel zapcore.Level) []string {
+	paths := options.ErrorOutputPaths
+	if len(paths) == 0 {
+		paths = []string{"stderr"}
+	}
+	if outputLevel != None {
+		paths = append(append([]string(nil), paths...), options.OutputPaths...)
+		for _, o := range options.Outputs {
+			paths = append(paths, o.Path)
+		}
+		paths = append(paths, options.FailoverPath)
+	}
+
+	var streams []string
+	for _, p := range paths {
+		if p == "stdout" || p == "stderr" {
+			streams = append(streams, p)
+		}
+	}
+	return streams
+}
+
+// logOutputsTo returns whether the log currently writes to the given standard stream, stdout or
+// stderr.
+func logOutputsTo(stream string) bool {
+	configureMu.Lock()
+	defer configureMu.Unlock()
+
+	for _, s := range activeGeneration.streams {
+		if s == stream {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareOutputFile checks that the file at the given path can be written to, creating it like the
+// outputs would, but with the given settings.
+func prepareOutputFile(path string, fs *fileSettings) error {
+	if path == "stdout" || path == "stderr" {
+		return nil
+	}
+
+	// one-letter schemes are Windows drive letters
+	if u, err := url.Parse(path); err == nil && len(u.Scheme) > 1 {
+		if u.Scheme != "file" {
+			return fmt.Errorf("unknown scheme %s, expecting a file path or one of the supported URLs", u.Scheme)
+		}
+		path = u.Path
+	}
+
+	dir := filepath.Dir(path)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if !fs.createDirs {
+			return fmt.Errorf("the directory %s doesn't exist", dir)
+		}
+		if err = os.MkdirAll(dir, outputDirMode); err != nil {
+			return err
+		}
+	}
+
+	_, err := os.Stat(path)
+	created := os.IsNotExist(err)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil || !created {
+		return err
+	}
+
+	// the mode passed when creating the file is subject to the umask
+	if fs.mode != 0 {
+		if err = os.Chmod(path, fs.mode); err != nil {
+			return err
+		}
+	}
+	if fs.uid >= 0 || fs.gid >= 0 {
+		return os.Chown(path, fs.uid, fs.gid)
+	}
+	return nil
+}
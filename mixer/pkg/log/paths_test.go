@@ -0,0 +1,152 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestPrepareOutputPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	readOnly := filepath.Join(dir, "readonly")
+	if err = os.Mkdir(readOnly, 0555); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	type pathCase struct {
+		path       string
+		createDirs bool
+		errPart    string
+	}
+
+	cases := []pathCase{
+		{"stdout", false, ""},
+		{"stderr", false, ""},
+		{filepath.Join(dir, "mixer.log"), false, ""},
+		{"file://" + filepath.Join(dir, "audit.log"), false, ""},
+		{"syslog://", false, ""},
+		{filepath.Join(dir, "logs", "mixer.log"), false, "doesn't exist"},
+		{filepath.Join(dir, "logs", "nested", "mixer.log"), true, ""},
+		{"ftp://host/mixer.log", false, "unknown scheme ftp"},
+	}
+	if os.Geteuid() != 0 {
+		cases = append(cases, pathCase{filepath.Join(readOnly, "mixer.log"), false, "permission denied"})
+	}
+
+	for _, c := range cases {
+		err := prepareOutputPaths([]string{c.path}, &fileSettings{createDirs: c.createDirs, uid: -1, gid: -1})
+		if c.errPart == "" {
+			if err != nil {
+				t.Errorf("Got err '%v' for %s, expecting success", err, c.path)
+			}
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), c.path) || !strings.Contains(err.Error(), c.errPart) {
+			t.Errorf("Got err '%v' for %s, expecting it to name the path and mention '%s'", err, c.path, c.errPart)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "logs", "nested", "mixer.log")); err != nil {
+		t.Errorf("Got err '%v', expecting the file to be created along with its directories", err)
+	}
+}
+
+func TestConfigureOutputPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	path := filepath.Join(dir, "logs", "mixer.log")
+	o := NewOptions()
+	o.OutputPaths = []string{path}
+	o.AuditOutputPaths = nil
+	if err := Configure(o); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("Got err '%v', expecting an error naming %s", err, path)
+	}
+
+	o.CreateOutputDirs = true
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer configureWithoutOutput(t)
+
+	Info("Hello")
+	Sync()
+
+	if content, err := ioutil.ReadFile(path); err != nil || !strings.Contains(string(content), "\tinfo\tHello") {
+		t.Errorf("Got '%s', %v, expecting the entry", content, err)
+	}
+}
+
+func TestFileSettings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	existing := filepath.Join(dir, "existing.log")
+	if err = ioutil.WriteFile(existing, nil, 0644); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	o := NewOptions()
+	o.FilePermissions = "0600"
+	if runtime.GOOS != "windows" {
+		o.FileOwner = fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+	}
+	fs, err := newFileSettings(o)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	created := filepath.Join(dir, "audit.log")
+	if err = prepareOutputPaths([]string{created, existing}, fs); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	// only the files created get the permissions
+	if fi, err := os.Stat(created); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("Got %v, %v, expecting the created file to have mode 0600", fi.Mode(), err)
+	}
+	if fi, err := os.Stat(existing); err != nil || fi.Mode().Perm() != 0644 {
+		t.Errorf("Got %v, %v, expecting the existing file to keep mode 0644", fi.Mode(), err)
+	}
+
+	for _, bad := range []*Options{
+		{FilePermissions: "rw-r-----"},
+		{FilePermissions: "01777"},
+		{FileOwner: "mixer"},
+		{FileOwner: "1337:-1"},
+	} {
+		if _, err := newFileSettings(bad); err == nil {
+			t.Errorf("Got success for %+v, expecting error", bad)
+		}
+	}
+}
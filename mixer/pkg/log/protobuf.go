@@ -0,0 +1,35 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"go.uber.org/zap/zapcore"
+
+	"istio.io/istio/mixer/pkg/log/binlog"
+)
+
+// Protobuf encoding
+//
+// The protobuf encoding outputs entries as length-prefixed protocol buffer messages, which are
+// much cheaper to produce than JSON. The format is described in the binlog package, which also
+// reads it back. The logdump tool converts binary logs to JSON or console output.
+
+const protobufEncoding = "protobuf"
+
+func init() {
+	registerEncoder(protobufEncoding, func(zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		return binlog.NewEncoder(), nil
+	})
+}
@@ -0,0 +1,78 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"istio.io/istio/mixer/pkg/log/binlog"
+)
+
+func TestProtobufEncoding(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	path := filepath.Join(dir, "mixer.log")
+
+	o := NewOptions()
+	o.OutputPaths = []string{path}
+	o.Encoding = protobufEncoding
+	o.IncludeCallerSourceLocation = true
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	Warn("Hello", zap.String("user", "bob"), zap.Int("count", 3))
+	Error("World")
+	Sync()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Unable to open log: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	r := binlog.NewReader(f)
+
+	e, err := r.Next()
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	if e.Message != "Hello" || e.Level != zapcore.WarnLevel || !strings.HasPrefix(e.Caller, "log/protobuf_test.go:") {
+		t.Errorf("Got %+v, expecting the warning", e)
+	}
+	if len(e.Fields) != 2 || e.Fields[0].Value != "bob" || e.Fields[1].Value != int64(3) {
+		t.Errorf("Got fields %+v, expecting user and count", e.Fields)
+	}
+
+	if e, err = r.Next(); err != nil || e.Message != "World" || e.Level != zapcore.ErrorLevel {
+		t.Errorf("Got %+v, %v, expecting the error", e, err)
+	}
+
+	if _, err = r.Next(); err != io.EOF {
+		t.Errorf("Got %v, expecting the end of the log", err)
+	}
+}
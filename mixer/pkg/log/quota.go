@@ -0,0 +1,148 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// quotaState tracks whether the files of an output path exceed their disk quota.
+type quotaState struct {
+	// 1 once the quota is exceeded, until the files are back within it
+	over int32
+
+	// 1 while the notice of the quota being exceeded remains to be output
+	notice int32
+}
+
+// exceeded returns whether the quota is exceeded.
+func (q *quotaState) exceeded() bool {
+	return atomic.LoadInt32(&q.over) == 1
+}
+
+// setExceeded records whether the quota is exceeded, raising the notice when it starts to be.
+func (q *quotaState) setExceeded(over bool) {
+	if !over {
+		atomic.StoreInt32(&q.over, 0)
+		atomic.StoreInt32(&q.notice, 0)
+		return
+	}
+
+	if atomic.CompareAndSwapInt32(&q.over, 0, 1) {
+		atomic.StoreInt32(&q.notice, 1)
+	}
+}
+
+// takeNotice returns whether the notice of the quota being exceeded remains to be output, clearing
+// it.
+func (q *quotaState) takeNotice() bool {
+	return atomic.CompareAndSwapInt32(&q.notice, 1, 0)
+}
+
+// enforceQuota deletes the oldest rotated files until the current and rotated files, along with the
+// given bytes about to be written, fit in the disk quota. If they still don't, the quota is recorded
+// as exceeded. It is called with the file locked.
+func (f *rotatingFile) enforceQuota(incoming int64) {
+	if f.rs.quota == 0 {
+		return
+	}
+
+	type backup struct {
+		name string
+		info os.FileInfo
+	}
+
+	var backups []backup
+	if pattern := f.backupPattern(); pattern != "" {
+		for _, p := range []string{pattern, pattern + compressedSuffix} {
+			matches, _ := filepath.Glob(p)
+			for _, m := range matches {
+				if fi, err := os.Stat(m); err == nil && m != f.name {
+					backups = append(backups, backup{m, fi})
+				}
+			}
+		}
+	}
+
+	f.backupBytes = 0
+	for _, b := range backups {
+		f.backupBytes += b.info.Size()
+	}
+
+	sort.Slice(backups, func(i, j int) bool { return backups[i].info.ModTime().Before(backups[j].info.ModTime()) })
+	for _, b := range backups {
+		if f.size+f.backupBytes+incoming <= f.rs.quota {
+			break
+		}
+		if err := os.Remove(b.name); err != nil {
+			reportError("unable to remove the rotated log file %s: %v", b.name, err)
+			continue
+		}
+		f.backupBytes -= b.info.Size()
+	}
+
+	f.setExceeded(f.size+f.backupBytes+incoming > f.rs.quota)
+}
+
+// quotaCore outputs entries to a file held to a disk quota. Once the quota is exceeded, only
+// warnings and errors get through, preceded by a notice.
+type quotaCore struct {
+	zapcore.Core
+
+	// the core without the fields added with With, which outputs the notice
+	base zapcore.Core
+	f    *rotatingFile
+}
+
+func newQuotaCore(core zapcore.Core, f *rotatingFile) zapcore.Core {
+	return &quotaCore{core, core, f}
+}
+
+func (c *quotaCore) Enabled(lvl zapcore.Level) bool {
+	if c.f.exceeded() && lvl < zapcore.WarnLevel {
+		return false
+	}
+	return c.Core.Enabled(lvl)
+}
+
+func (c *quotaCore) With(fields []zapcore.Field) zapcore.Core {
+	return &quotaCore{c.Core.With(fields), c.base, c.f}
+}
+
+func (c *quotaCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *quotaCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	// entries checked before the quota was exceeded are let through all the same
+	err := c.Core.Write(ent, fields)
+
+	if c.f.takeNotice() {
+		msg := fmt.Sprintf("the log files at %s exceed their disk quota of %d bytes, only warnings and errors are output to them from now on",
+			c.f.path, c.f.rs.quota)
+		reportError("%s", msg)
+		_ = c.base.Write(zapcore.Entry{Level: zapcore.ErrorLevel, Time: ent.Time, Message: msg}, nil)
+	}
+	return err
+}
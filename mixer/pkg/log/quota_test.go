@@ -0,0 +1,130 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestEnforceQuota(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	// three rotated files of 10 bytes, the oldest first
+	backups := []string{"mixer-20171228.log.gz", "mixer-20171229.log", "mixer-20171230.log"}
+	for i, name := range backups {
+		path := filepath.Join(dir, name)
+		if err = ioutil.WriteFile(path, []byte("0123456789"), 0644); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+		mtime := time.Date(2017, time.December, 28+i, 12, 0, 0, 0, time.Local)
+		if err = os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+	}
+
+	now := time.Date(2017, time.December, 31, 12, 0, 0, 0, time.Local)
+	rs := &rotationSettings{interval: rotateDaily, quota: 25}
+	f, err := openRotatingFile(filepath.Join(dir, "mixer.log"), rs, &fileSettings{uid: -1, gid: -1}, func() time.Time { return now })
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if f.exceeded() {
+		t.Error("Got the quota exceeded, expecting the oldest rotated file to make room")
+	}
+	if _, err := os.Stat(filepath.Join(dir, backups[0])); !os.IsNotExist(err) {
+		t.Errorf("Got err '%v', expecting the oldest rotated file to be deleted", err)
+	}
+
+	// the next write deletes another rotated file
+	_, _ = f.Write([]byte("0123456789"))
+	if f.exceeded() {
+		t.Error("Got the quota exceeded, expecting the next rotated file to make room")
+	}
+	if _, err := os.Stat(filepath.Join(dir, backups[1])); !os.IsNotExist(err) {
+		t.Errorf("Got err '%v', expecting the next rotated file to be deleted", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, backups[2])); err != nil {
+		t.Errorf("Got err '%v', expecting the newest rotated file to be kept", err)
+	}
+
+	// with every rotated file deleted, the current file alone exceeds the quota
+	_, _ = f.Write([]byte("01234567890123456789"))
+	if !f.exceeded() {
+		t.Error("Got the quota within bounds, expecting it to be exceeded")
+	}
+}
+
+func TestQuotaCore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	path := filepath.Join(dir, "mixer.log")
+	rs := &rotationSettings{quota: 100}
+	cfg := &zap.Config{Encoding: "json", EncoderConfig: zapcore.EncoderConfig{MessageKey: "msg", LevelKey: "level", EncodeLevel: zapcore.LowercaseLevelEncoder}, Level: zap.NewAtomicLevelAt(zapcore.DebugLevel)}
+	core, closer, err := newRotatingCore(path, rs, cfg, &fileSettings{uid: -1, gid: -1})
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = closer.Close() }()
+
+	l := zap.New(core)
+	for i := 0; i < 10; i++ {
+		l.Info("Hello")
+	}
+
+	if core.Enabled(zapcore.InfoLevel) || !core.Enabled(zapcore.WarnLevel) {
+		t.Error("Got info entries enabled or warnings disabled, expecting only warnings and errors past the quota")
+	}
+	l.Warn("Careful")
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	if n := strings.Count(string(content), "disk quota of 100 bytes"); n != 1 {
+		t.Errorf("Got %d notices in '%s', expecting 1", n, content)
+	}
+	if !strings.Contains(string(content), "Careful") {
+		t.Errorf("Got '%s', expecting the warning past the quota", content)
+	}
+	if n := strings.Count(string(content), "Hello"); n >= 10 {
+		t.Errorf("Got %d info entries, expecting those past the quota to be dropped", n)
+	}
+}
+
+func TestConfigureDiskQuota(t *testing.T) {
+	o := NewOptions()
+	o.DiskQuotaBytes = -1
+	if err := Configure(o); err == nil || !strings.Contains(err.Error(), "disk quota") {
+		t.Errorf("Got err '%v', expecting an invalid disk quota error", err)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// The buffer of recent entries set up by the last call to Configure, holding a *recentBuffer, or
+// nil when disabled.
+var currentRecent atomic.Value
+
+func init() {
+	currentRecent.Store((*recentBuffer)(nil))
+}
+
+// recentBuffer keeps the last entries logged, encoded, in a ring.
+type recentBuffer struct {
+	encoder zapcore.Encoder
+
+	mu      sync.Mutex
+	entries []string
+	next    int
+	full    bool
+}
+
+func newRecentBuffer(size int, cfg zapcore.EncoderConfig) *recentBuffer {
+	// the entries are kept without their line endings, which are set here to be trimmed
+	cfg.LineEnding = zapcore.DefaultLineEnding
+	return &recentBuffer{encoder: zapcore.NewJSONEncoder(cfg), entries: make([]string, size)}
+}
+
+// record encodes the given entry into the buffer, in place of the oldest one once full.
+func (r *recentBuffer) record(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := r.encoder.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	s := strings.TrimSuffix(buf.String(), "\n")
+	buf.Free()
+
+	r.mu.Lock()
+	r.entries[r.next] = s
+	r.next++
+	if r.next == len(r.entries) {
+		r.next, r.full = 0, true
+	}
+	r.mu.Unlock()
+	return nil
+}
+
+// snapshot returns the entries of the buffer, oldest first.
+func (r *recentBuffer) snapshot() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return append([]string(nil), r.entries[:r.next]...)
+	}
+	return append(append([]string(nil), r.entries[r.next:]...), r.entries[:r.next]...)
+}
+
+// recentCore records every entry logged into a buffer, whatever the output levels, and hands them
+// on to the wrapped core.
+type recentCore struct {
+	zapcore.Core
+	recent *recentBuffer
+	fields []zapcore.Field
+}
+
+func newRecentCore(core zapcore.Core, recent *recentBuffer) zapcore.Core {
+	return &recentCore{Core: core, recent: recent}
+}
+
+func (c *recentCore) Enabled(zapcore.Level) bool {
+	return true
+}
+
+func (c *recentCore) With(fields []zapcore.Field) zapcore.Core {
+	return &recentCore{
+		Core:   c.Core.With(fields),
+		recent: c.recent,
+		fields: append(c.fields[:len(c.fields):len(c.fields)], fields...),
+	}
+}
+
+func (c *recentCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	// the entry is added after the wrapped core checked it, so that the stack trace core tells
+	// whether it was accepted
+	return c.Core.Check(ent, ce).AddCore(ent, c)
+}
+
+func (c *recentCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if len(c.fields) > 0 {
+		fields = append(c.fields[:len(c.fields):len(c.fields)], fields...)
+	}
+	return c.recent.record(ent, fields)
+}
+
+func (c *recentCore) Sync() error {
+	return nil
+}
+
+// recording returns whether the entries are recorded into a buffer of recent entries, which
+// requires them to be logged at every level.
+func recording() bool {
+	return currentRecent.Load().(*recentBuffer) != nil
+}
+
+// RecentEntries returns the last entries logged, oldest first, encoded in JSON. The entries of
+// every level are kept, including those below the output levels, so that the context of an error
+// can be retrieved without debug messages having been output. It returns nil unless the
+// RecentEntries option is set.
+func RecentEntries() []string {
+	r := currentRecent.Load().(*recentBuffer)
+	if r == nil {
+		return nil
+	}
+	return r.snapshot()
+}
+
+// RecentEntriesHandler returns an HTTP handler responding with the entries of RecentEntries, one
+// per line, for mounting on a debug endpoint.
+//
+//		mux.Handle("/debug/log", log.RecentEntriesHandler())
+func RecentEntriesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entries := RecentEntries()
+		if entries == nil {
+			http.Error(w, "recent entries aren't kept", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for _, e := range entries {
+			_, _ = w.Write([]byte(e + "\n"))
+		}
+	})
+}
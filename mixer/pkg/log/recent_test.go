@@ -0,0 +1,136 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func configureRecentEntries(t *testing.T, n int) {
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.RecentEntries = n
+	o.EncoderKeys = []string{"time="}
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+}
+
+func TestRecentEntries(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+
+	configureRecentEntries(t, 3)
+	defer configureWithoutOutput(t)
+
+	Debug("Resolving attributes")
+	Debugf("Resolved %d attributes", 3)
+	Named("dispatcher").With(String("adapter", "a")).Info("Dispatching")
+	Error("Unable to dispatch")
+
+	// the debug messages are kept, without being output
+	if strings.Contains(buf.String(), "Resolved") {
+		t.Errorf("Got '%s', expecting the debug messages left out of the output", buf)
+	}
+
+	entries := RecentEntries()
+	expected := []string{
+		`"level":"debug","msg":"Resolved 3 attributes"}`,
+		`"level":"info","logger":"dispatcher","msg":"Dispatching","adapter":"a"}`,
+		`"level":"error","msg":"Unable to dispatch"}`,
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Got %v, expecting the last %d entries", entries, len(expected))
+	}
+	for i, e := range expected {
+		if !strings.HasSuffix(entries[i], e) {
+			t.Errorf("Got '%s', expecting it to end with '%s'", entries[i], e)
+		}
+	}
+
+	configureWithoutOutput(t)
+	if entries := RecentEntries(); entries != nil {
+		t.Errorf("Got %v, expecting none once disabled", entries)
+	}
+}
+
+func TestRecentEntriesStackTrace(t *testing.T) {
+	core, _ := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.RecentEntries = 2
+	_ = o.SetStackTraceLevel(zapcore.DebugLevel)
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer configureWithoutOutput(t)
+
+	// the stack traces are only taken for the entries output
+	Debug("Resolving attributes")
+	Info("Dispatching")
+
+	entries := RecentEntries()
+	if len(entries) != 2 || strings.Contains(entries[0], `"stack"`) || !strings.Contains(entries[1], `"stack"`) {
+		t.Errorf("Got %v, expecting a stack trace for the info entry only", entries)
+	}
+}
+
+func TestRecentBuffer(t *testing.T) {
+	r := newRecentBuffer(2, zapcore.EncoderConfig{MessageKey: "msg"})
+	if s := r.snapshot(); len(s) != 0 {
+		t.Errorf("Got %v, expecting no entries", s)
+	}
+
+	for _, msg := range []string{"a", "b", "c"} {
+		if err := r.record(zapcore.Entry{Message: msg}, nil); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+	}
+	if s := strings.Join(r.snapshot(), ","); s != `{"msg":"b"},{"msg":"c"}` {
+		t.Errorf("Got %s, expecting the last 2 entries, oldest first", s)
+	}
+}
+
+func TestRecentEntriesHandler(t *testing.T) {
+	configureWithoutOutput(t)
+
+	w := httptest.NewRecorder()
+	RecentEntriesHandler().ServeHTTP(w, httptest.NewRequest("GET", "/debug/log", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Got status %d, expecting not found while no entries are kept", w.Code)
+	}
+
+	configureRecentEntries(t, 10)
+	defer configureWithoutOutput(t)
+
+	Info("Hello")
+	Debug("World")
+
+	w = httptest.NewRecorder()
+	RecentEntriesHandler().ServeHTTP(w, httptest.NewRequest("GET", "/debug/log", nil))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if w.Code != http.StatusOK || len(lines) != 2 || !strings.Contains(lines[1], `"msg":"World"`) {
+		t.Errorf("Got status %d and '%v', expecting the entries", w.Code, lines)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"go.uber.org/zap"
+)
+
+// RecoverAndLog recovers from a panic and outputs it at the error level under the given scope, with
+// the stack trace of the panicking goroutine. It must be called directly by a deferred statement,
+// as recovering has no effect anywhere else.
+//
+//		defer log.RecoverAndLog("adapters")
+func RecoverAndLog(scope string) {
+	if r := recover(); r != nil {
+		logPanic(scope, r)
+	}
+}
+
+// RecoverLogAndPanic is like RecoverAndLog, but panics again with the same value once the entry is
+// output and the log synced, for the goroutines whose panics must still bring the process down.
+//
+//		defer log.RecoverLogAndPanic("dispatcher")
+func RecoverLogAndPanic(scope string) {
+	if r := recover(); r != nil {
+		logPanic(scope, r)
+		Sync()
+		panic(r)
+	}
+}
+
+// Go runs the given function in a new goroutine, outputting any panic of the function at the error
+// level rather than letting it crash the process.
+func Go(fn func()) {
+	go func() {
+		defer RecoverAndLog("")
+		fn()
+	}()
+}
+
+// logPanic outputs an entry for a recovered panic. It is called from the deferred function, so the
+// stack trace still includes the frames which panicked.
+func logPanic(scope string, r interface{}) {
+	l := zap.New(newGlobalCore()).Named(scope)
+	if ce := l.Check(zap.ErrorLevel, "Recovered from panic"); ce != nil {
+		ce.Write(zap.Any("panic", r), zap.Stack("stack"))
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func panickingAdapter() {
+	panic("adapter failed")
+}
+
+func TestRecoverAndLog(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	configureWithoutOutput(t)
+
+	func() {
+		defer RecoverAndLog("adapters")
+		panickingAdapter()
+	}()
+
+	// nothing is output without a panic
+	func() {
+		defer RecoverAndLog("adapters")
+	}()
+
+	s := buf.String()
+	if !strings.HasPrefix(s, `{"level":"error","logger":"adapters","msg":"Recovered from panic","panic":"adapter failed","stack":"`) {
+		t.Errorf("Got '%s', expecting the panic", s)
+	}
+	if !strings.Contains(s, "panickingAdapter") {
+		t.Errorf("Got '%s', expecting the stack trace to include the panicking function", s)
+	}
+	if strings.Count(s, "\n") != 1 {
+		t.Errorf("Got '%s', expecting a single entry", s)
+	}
+}
+
+func TestRecoverLogAndPanic(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	configureWithoutOutput(t)
+
+	var r interface{}
+	func() {
+		defer func() { r = recover() }()
+		defer RecoverLogAndPanic("dispatcher")
+		panickingAdapter()
+	}()
+
+	if r != "adapter failed" {
+		t.Errorf("Got %v, expecting the panic to be raised again", r)
+	}
+	if s := buf.String(); !strings.HasPrefix(s, `{"level":"error","logger":"dispatcher","msg":"Recovered from panic"`) {
+		t.Errorf("Got '%s', expecting the panic", s)
+	}
+}
+
+func TestGo(t *testing.T) {
+	messages := make(chan string, 1)
+	defer AddCore(&messageCore{LevelEnabler: zapcore.DebugLevel, messages: messages})()
+	configureWithoutOutput(t)
+
+	Go(panickingAdapter)
+
+	select {
+	case msg := <-messages:
+		if msg != "Recovered from panic" {
+			t.Errorf("Got '%s', expecting the panic", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the panic to be output")
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Redacted is the value substituted for sensitive data by the built-in redactors.
+const Redacted = "[REDACTED]"
+
+// Redactor inspects the key and value of a structured field before it is encoded. If the value
+// contains sensitive data, the redactor returns a replacement value and true, otherwise it returns
+// false and the value is left untouched.
+//
+// Redactors are invoked for string, byte string, error, stringer, and arbitrary (zap.Any/zap.Reflect)
+// fields. For fields holding a map[string]string or a map[string][]string (such as an http.Header),
+// redactors are also invoked for each of the map's entries.
+type Redactor func(key string, val interface{}) (interface{}, bool)
+
+var (
+	stringMapType  = reflect.TypeOf(map[string]string{})
+	stringsMapType = reflect.TypeOf(map[string][]string{})
+
+	redactorsMu sync.Mutex
+	redactors   atomic.Value // []Redactor
+)
+
+func init() {
+	redactors.Store([]Redactor{RedactAuthorization, RedactBearerTokens, RedactCookies})
+}
+
+// RegisterRedactor adds a redactor which is applied to the fields of every log entry.
+//
+// The built-in RedactAuthorization, RedactBearerTokens, and RedactCookies redactors are
+// registered by default.
+func RegisterRedactor(r Redactor) {
+	redactorsMu.Lock()
+	current := redactors.Load().([]Redactor)
+	updated := make([]Redactor, len(current), len(current)+1)
+	copy(updated, current)
+	redactors.Store(append(updated, r))
+	redactorsMu.Unlock()
+}
+
+// RedactAuthorization redacts the value of authorization headers.
+func RedactAuthorization(key string, val interface{}) (interface{}, bool) {
+	k := strings.ToLower(key)
+	if k == "authorization" || k == "proxy-authorization" || strings.HasSuffix(k, ".authorization") {
+		return Redacted, true
+	}
+	return nil, false
+}
+
+// RedactBearerTokens redacts string values carrying bearer tokens.
+func RedactBearerTokens(key string, val interface{}) (interface{}, bool) {
+	const prefix = "bearer "
+
+	s, ok := val.(string)
+	if !ok || len(s) <= len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+		return nil, false
+	}
+
+	return s[:len(prefix)] + Redacted, true
+}
+
+// RedactCookies redacts the values of cookie headers, leaving the cookie names visible.
+func RedactCookies(key string, val interface{}) (interface{}, bool) {
+	k := strings.ToLower(key)
+	if k != "cookie" && k != "set-cookie" && !strings.HasSuffix(k, ".cookie") {
+		return nil, false
+	}
+
+	s, ok := val.(string)
+	if !ok {
+		return Redacted, true
+	}
+
+	cookies := strings.Split(s, ";")
+	for i, c := range cookies {
+		if eq := strings.Index(c, "="); eq >= 0 {
+			cookies[i] = c[:eq+1] + Redacted
+		}
+	}
+
+	return strings.Join(cookies, ";"), true
+}
+
+// redactingCore applies the registered redactors to all the fields going through it.
+type redactingCore struct {
+	zapcore.Core
+}
+
+func newRedactingCore(core zapcore.Core) zapcore.Core {
+	return &redactingCore{core}
+}
+
+func (r *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{r.Core.With(redactFields(fields))}
+}
+
+func (r *redactingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if r.Enabled(ent.Level) {
+		return ce.AddCore(ent, r)
+	}
+	return ce
+}
+
+func (r *redactingCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return r.Core.Write(ent, redactFields(fields))
+}
+
+// redactFields returns the given fields with any sensitive values replaced. The input slice
+// is left untouched.
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	rs := redactors.Load().([]Redactor)
+	if len(rs) == 0 {
+		return fields
+	}
+
+	var result []zapcore.Field
+	for i, f := range fields {
+		val, ok := fieldValue(f)
+		if !ok {
+			continue
+		}
+
+		if v, redacted := redactValue(rs, f.Key, val); redacted {
+			if result == nil {
+				result = make([]zapcore.Field, len(fields))
+				copy(result, fields)
+			}
+			result[i] = zap.Any(f.Key, v)
+		}
+	}
+
+	if result == nil {
+		return fields
+	}
+	return result
+}
+
+func redactValue(rs []Redactor, key string, val interface{}) (interface{}, bool) {
+	for _, r := range rs {
+		if v, ok := r(key, val); ok {
+			return v, true
+		}
+	}
+
+	// also look inside string maps, including named types such as http.Header
+	v := reflect.ValueOf(val)
+	if v.Kind() != reflect.Map {
+		return nil, false
+	}
+
+	switch {
+	case v.Type().ConvertibleTo(stringMapType):
+		m := v.Convert(stringMapType).Interface().(map[string]string)
+		var result map[string]string
+		for k, v := range m {
+			if rv, ok := redactValue(rs, k, v); ok {
+				if result == nil {
+					result = make(map[string]string, len(m))
+					for k2, v2 := range m {
+						result[k2] = v2
+					}
+				}
+				result[k] = stringValue(rv)
+			}
+		}
+		return result, result != nil
+
+	case v.Type().ConvertibleTo(stringsMapType):
+		m := v.Convert(stringsMapType).Interface().(map[string][]string)
+		var result map[string][]string
+		for k, vs := range m {
+			for i, v := range vs {
+				if rv, ok := redactValue(rs, k, v); ok {
+					if result == nil {
+						result = make(map[string][]string, len(m))
+						for k2, v2 := range m {
+							result[k2] = append([]string(nil), v2...)
+						}
+					}
+					result[k][i] = stringValue(rv)
+				}
+			}
+		}
+		return result, result != nil
+	}
+
+	return nil, false
+}
+
+// fieldValue returns the value of the field as seen by redactors, if redactors apply to the field.
+func fieldValue(f zapcore.Field) (interface{}, bool) {
+	switch f.Type {
+	case zapcore.StringType:
+		return f.String, true
+	case zapcore.ByteStringType:
+		return string(f.Interface.([]byte)), true
+	case zapcore.ErrorType, zapcore.StringerType, zapcore.ReflectType:
+		return f.Interface, true
+	}
+	return nil, false
+}
+
+func stringValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return Redacted
+}
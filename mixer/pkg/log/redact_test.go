@@ -0,0 +1,144 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestBuiltinRedactors(t *testing.T) {
+	cases := []struct {
+		r        Redactor
+		key      string
+		val      interface{}
+		result   interface{}
+		redacted bool
+	}{
+		{RedactAuthorization, "Authorization", "Basic Zm9vOmJhcg==", Redacted, true},
+		{RedactAuthorization, "proxy-authorization", "secret", Redacted, true},
+		{RedactAuthorization, "request.headers.authorization", "secret", Redacted, true},
+		{RedactAuthorization, "path", "/authorization", nil, false},
+
+		{RedactBearerTokens, "token", "Bearer abc.def.ghi", "Bearer " + Redacted, true},
+		{RedactBearerTokens, "token", "bearer abc", "bearer " + Redacted, true},
+		{RedactBearerTokens, "token", "Bearer ", nil, false},
+		{RedactBearerTokens, "token", "Basic abc", nil, false},
+		{RedactBearerTokens, "token", 42, nil, false},
+
+		{RedactCookies, "Cookie", "session=abc; theme=dark", "session=" + Redacted + "; theme=" + Redacted, true},
+		{RedactCookies, "set-cookie", "id=1", "id=" + Redacted, true},
+		{RedactCookies, "cookie", errors.New("boom"), Redacted, true},
+		{RedactCookies, "cookies_eaten", "3", nil, false},
+	}
+
+	for i, c := range cases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			result, redacted := c.r(c.key, c.val)
+			if redacted != c.redacted {
+				t.Errorf("Got redacted %v, expecting %v", redacted, c.redacted)
+			}
+
+			if redacted && result != c.result {
+				t.Errorf("Got %v, expecting %v", result, c.result)
+			}
+		})
+	}
+}
+
+func TestRedactFields(t *testing.T) {
+	header := http.Header{"Authorization": {"Bearer abc"}, "Accept": {"*/*"}}
+	fields := []zapcore.Field{
+		zap.String("user", "bob"),
+		zap.String("authorization", "Bearer abc"),
+		zap.Int("count", 3),
+		zap.Any("headers", map[string]string{"cookie": "a=b", "host": "foo"}),
+		zap.Any("header", header),
+	}
+
+	result := redactFields(fields)
+
+	if result[0] != fields[0] || result[2] != fields[2] {
+		t.Errorf("Got %v, expecting non-sensitive fields to be left untouched", result)
+	}
+
+	if result[1].String != Redacted {
+		t.Errorf("Got %v, expecting the authorization field to be redacted", result[1])
+	}
+
+	expectedMap := map[string]string{"cookie": "a=" + Redacted, "host": "foo"}
+	if !reflect.DeepEqual(result[3].Interface, expectedMap) {
+		t.Errorf("Got %v, expecting %v", result[3].Interface, expectedMap)
+	}
+
+	expectedHeader := map[string][]string{"Authorization": {Redacted}, "Accept": {"*/*"}}
+	if !reflect.DeepEqual(result[4].Interface, expectedHeader) {
+		t.Errorf("Got %v, expecting %v", result[4].Interface, expectedHeader)
+	}
+
+	// the original header must not be modified
+	if header.Get("Authorization") != "Bearer abc" {
+		t.Errorf("Got %v, expecting the input to be left untouched", header)
+	}
+
+	if fields[1].String != "Bearer abc" {
+		t.Errorf("Got %v, expecting the input to be left untouched", fields[1])
+	}
+}
+
+func TestRegisterRedactor(t *testing.T) {
+	old := redactors.Load().([]Redactor)
+	defer redactors.Store(old)
+
+	RegisterRedactor(func(key string, val interface{}) (interface{}, bool) {
+		if key == "ssn" {
+			return "xxx-xx-xxxx", true
+		}
+		return nil, false
+	})
+
+	lines, err := captureStdout(func() {
+		if err := Configure(NewOptions()); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		l := With(zap.String("ssn", "123-45-6789"))
+		l.Info("Hello", zap.String("authorization", "secret"))
+		Infow("Hello", "ssn", "123-45-6789")
+		Sync()
+	})
+
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	patterns := []string{
+		"\tinfo\tHello\t{\"ssn\": \"xxx-xx-xxxx\", \"authorization\": \"\\[REDACTED\\]\"}$",
+		"\tinfo\tHello\t{\"ssn\": \"xxx-xx-xxxx\"}$",
+	}
+
+	for i, pat := range patterns {
+		if match, _ := regexp.MatchString(pat, lines[i]); !match {
+			t.Errorf("Got '%s', expecting to match '%s'", lines[i], pat)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// RequestIDHeader is the header carrying the IDs of requests, in HTTP requests and responses and in
+// gRPC metadata. Envoy sets it on the requests it proxies.
+const RequestIDHeader = "x-request-id"
+
+// requestIDKey is the key of the request IDs of contexts.
+type requestIDKey struct{}
+
+// the number of request IDs generated without a source of randomness
+var fallbackRequestIDs uint64
+
+// NewRequestID returns a random ID for a request, made of 32 hexadecimal digits.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// still tell the requests apart, if not across processes
+		n := atomic.AddUint64(&fallbackRequestIDs, 1)
+		return strconv.FormatInt(time.Now().UnixNano(), 16) + strconv.FormatUint(n, 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// WithRequestID returns a copy of the given context carrying the given request ID, which the
+// loggers of FromContext output with every entry, and which the gRPC client interceptors pass
+// along to the servers called.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried by the given context, or an empty string
+// when it carries none.
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestIDField returns the request ID carried by the given context as a field, skipped when it
+// carries none.
+func requestIDField(ctx context.Context) zapcore.Field {
+	if id := RequestIDFromContext(ctx); id != "" {
+		return zap.String("requestId", id)
+	}
+	return zap.Skip()
+}
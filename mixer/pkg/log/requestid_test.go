@@ -0,0 +1,56 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestNewRequestID(t *testing.T) {
+	a, b := NewRequestID(), NewRequestID()
+	if match, _ := regexp.MatchString("^[0-9a-f]{32}$", a); !match {
+		t.Errorf("Got '%s', expecting 32 hexadecimal digits", a)
+	}
+	if a == b {
+		t.Errorf("Got '%s' twice, expecting different IDs", a)
+	}
+}
+
+func TestRequestIDFromContext(t *testing.T) {
+	if id := RequestIDFromContext(context.Background()); id != "" {
+		t.Errorf("Got '%s', expecting no request ID", id)
+	}
+	if id := RequestIDFromContext(nil); id != "" { // nolint: staticcheck
+		t.Errorf("Got '%s', expecting no request ID", id)
+	}
+
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	configureWithoutOutput(t)
+
+	ctx := WithRequestID(context.Background(), "abc")
+	if id := RequestIDFromContext(ctx); id != "abc" {
+		t.Errorf("Got '%s', expecting abc", id)
+	}
+
+	FromContext(ctx).Info("Checked")
+	if expected := `{"level":"info","msg":"Checked","requestId":"abc"}` + "\n"; buf.String() != expected {
+		t.Errorf("Got '%s', expecting '%s'", buf, expected)
+	}
+}
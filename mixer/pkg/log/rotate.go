@@ -0,0 +1,406 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Settings of Options.RotationInterval and Options.AuditRotationInterval.
+const (
+	rotateHourly = "hourly"
+	rotateDaily  = "daily"
+)
+
+// The layouts of the timestamps added to the names of the rotated files, by rotation interval.
+var rotationLayouts = map[string]string{
+	rotateHourly: "2006010215",
+	rotateDaily:  "20060102",
+}
+
+// checkRotationInterval returns an error if the given rotation interval isn't one of the known
+// ones.
+func checkRotationInterval(interval string) error {
+	if _, ok := rotationLayouts[interval]; interval != "" && !ok {
+		return fmt.Errorf("unknown rotation interval: %s", interval)
+	}
+	return nil
+}
+
+// rotationStart returns the start of the rotation period the given time falls in.
+func rotationStart(interval string, t time.Time) time.Time {
+	hour := 0
+	if interval == rotateHourly {
+		hour = t.Hour()
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), hour, 0, 0, 0, t.Location())
+}
+
+// rotationEnd returns the end of the rotation period starting at the given time.
+func rotationEnd(interval string, start time.Time) time.Time {
+	if interval == rotateHourly {
+		return start.Add(time.Hour)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// rotationVerbs matches the timestamp verbs of file paths.
+var rotationVerbs = regexp.MustCompile(`%[YmdH%]`)
+
+// isRotationPattern returns whether the given file path holds timestamp verbs.
+func isRotationPattern(path string) bool {
+	return strings.Contains(path, "%")
+}
+
+// expandRotationPattern replaces the %Y, %m, %d, and %H verbs of the given file path with the year,
+// month, day, and hour of the given time, and %% with a percent sign.
+func expandRotationPattern(pattern string, t time.Time) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i == len(pattern)-1 {
+			b.WriteByte(pattern[i])
+			continue
+		}
+
+		i++
+		switch pattern[i] {
+		case 'Y':
+			fmt.Fprintf(&b, "%04d", t.Year())
+		case 'm':
+			fmt.Fprintf(&b, "%02d", t.Month())
+		case 'd':
+			fmt.Fprintf(&b, "%02d", t.Day())
+		case 'H':
+			fmt.Fprintf(&b, "%02d", t.Hour())
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(pattern[i])
+		}
+	}
+	return b.String()
+}
+
+// rotationPaths returns the given output paths with the timestamp verbs of the files rotated at the
+// given interval expanded for the current period.
+func rotationPaths(paths []string, interval string) []string {
+	if interval == "" {
+		return paths
+	}
+
+	start := rotationStart(interval, now())
+	out := make([]string, len(paths))
+	for i, p := range paths {
+		out[i] = expandRotationPattern(p, start)
+	}
+	return out
+}
+
+// splitRotatedFiles separates the files to rotate or hold to a disk quota with the given settings
+// from the rest of the given output paths. The standard streams and sinks are never rotated.
+func splitRotatedFiles(paths []string, rs *rotationSettings) (rest []string, rotated []string) {
+	if rs.interval == "" && rs.quota == 0 {
+		return paths, nil
+	}
+
+	for _, p := range paths {
+		if files, _ := splitOutputPaths([]string{p}); len(files) > 0 && p != "stdout" && p != "stderr" {
+			rotated = append(rotated, p)
+		} else {
+			rest = append(rest, p)
+		}
+	}
+	return rest, rotated
+}
+
+// rotationSettings describe how the output files are rotated.
+type rotationSettings struct {
+	// how often to rotate the files, hourly or daily
+	interval string
+
+	// whether to compress the rotated files
+	compress bool
+
+	// the most bytes the current and rotated files of an output path may take, 0 for no limit
+	quota int64
+}
+
+// newRotatingCore builds a core writing to the file at the given path, rotated and created with the
+// given settings, encoded and leveled as configured.
+func newRotatingCore(path string, rs *rotationSettings, cfg *zap.Config, fs *fileSettings) (zapcore.Core, io.Closer, error) {
+	enc, err := newEncoder(cfg.Encoding, cfg.EncoderConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := newRotatingFile(path, rs, fs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	core := zapcore.NewCore(enc, f, cfg.Level)
+	if rs.quota > 0 {
+		core = newQuotaCore(core, f)
+	}
+	return core, f, nil
+}
+
+// rotatingFile is an output file switching to a new file at the start of every rotation period.
+// Files named with timestamp verbs move on to the name of the new period, while the others are
+// renamed with the timestamp of the period they hold, before being replaced. Without a rotation
+// interval, the file is only held to its disk quota.
+type rotatingFile struct {
+	mu sync.Mutex
+
+	// the path or pattern of the file, and how to rotate and create it
+	path string
+	rs   *rotationSettings
+	fs   *fileSettings
+
+	// the current time, replaced by tests
+	now func() time.Time
+
+	file   *os.File
+	name   string
+	closed bool
+
+	// the period of the current file
+	start time.Time
+	end   time.Time
+
+	// the bytes taken by the current and rotated files, and whether they exceed the disk quota
+	size        int64
+	backupBytes int64
+	quotaState
+
+	// the status of the output, if tracked
+	stats *sinkStats
+}
+
+// newRotatingFile opens the file at the given path, rotated and created with the given settings. A
+// file left over from a past period is rotated right away, and the compression of the rotated files
+// is picked up where it was left off.
+func newRotatingFile(path string, rs *rotationSettings, fs *fileSettings) (*rotatingFile, error) {
+	return openRotatingFile(path, rs, fs, now)
+}
+
+func openRotatingFile(path string, rs *rotationSettings, fs *fileSettings, now func() time.Time) (*rotatingFile, error) {
+	if u, err := url.Parse(path); err == nil && u.Scheme == "file" {
+		path = u.Path
+	}
+	f := &rotatingFile{path: path, rs: rs, fs: fs, now: now}
+
+	if rs.interval != "" && !isRotationPattern(path) {
+		if fi, err := os.Stat(path); err == nil {
+			start := rotationStart(rs.interval, fi.ModTime())
+			if start.Before(rotationStart(rs.interval, now())) {
+				if err = os.Rename(path, f.backupName(start)); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	if rs.compress {
+		resumeCompression(f.backups(), fs)
+	}
+	f.enforceQuota(0)
+	return f, nil
+}
+
+// backupName returns the name a file holding the period starting at the given time is renamed to.
+func (f *rotatingFile) backupName(start time.Time) string {
+	ext := filepath.Ext(f.path)
+	return strings.TrimSuffix(f.path, ext) + "-" + start.Format(rotationLayouts[f.rs.interval]) + ext
+}
+
+// patterned returns whether the file is named after its rotation period.
+func (f *rotatingFile) patterned() bool {
+	return f.rs.interval != "" && isRotationPattern(f.path)
+}
+
+// backups returns the names of the files rotated so far, not counting their compressed copies.
+func (f *rotatingFile) backups() []string {
+	pattern := f.backupPattern()
+	if pattern == "" {
+		return nil
+	}
+
+	matches, _ := filepath.Glob(pattern)
+	backups := matches[:0]
+	for _, m := range matches {
+		if m != f.name {
+			backups = append(backups, m)
+		}
+	}
+	return backups
+}
+
+// backupPattern returns the glob pattern matching the names of the rotated files.
+func (f *rotatingFile) backupPattern() string {
+	if f.rs.interval == "" {
+		// nothing is rotated
+		return ""
+	}
+
+	var pattern string
+	if isRotationPattern(f.path) {
+		pattern = rotationVerbs.ReplaceAllStringFunc(f.path, func(verb string) string {
+			if verb == "%%" {
+				return "%"
+			}
+			return "[0-9]*"
+		})
+	} else {
+		ext := filepath.Ext(f.path)
+		pattern = strings.TrimSuffix(f.path, ext) + "-[0-9]*" + ext
+	}
+	return pattern
+}
+
+// open opens the file of the current period.
+func (f *rotatingFile) open() error {
+	f.start = rotationStart(f.rs.interval, f.now())
+	f.end = rotationEnd(f.rs.interval, f.start)
+
+	name := f.path
+	if f.patterned() {
+		name = expandRotationPattern(name, f.start)
+	}
+
+	if err := prepareOutputFile(name, f.fs); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	f.file = file
+	f.name = name
+
+	f.size = 0
+	if fi, err := file.Stat(); err == nil {
+		f.size = fi.Size()
+	}
+	return nil
+}
+
+// rotate closes the current file and opens the file of the current period.
+func (f *rotatingFile) rotate() error {
+	err := f.file.Close()
+	f.file = nil
+
+	rotated := f.name
+	if !f.patterned() {
+		rotated = f.backupName(f.start)
+		if renameErr := os.Rename(f.path, rotated); err == nil {
+			err = renameErr
+		}
+	}
+
+	if err == nil && f.rs.compress {
+		compressLater(rotated, f.fs)
+	}
+
+	// keep writing to some file whatever happened to the previous one
+	if openErr := f.open(); openErr != nil {
+		return openErr
+	}
+	f.enforceQuota(0)
+	return err
+}
+
+// Write writes the given bytes to the file of the current period, rotating it first if its period
+// is over.
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+
+	var rotateErr error
+	if f.file == nil || (f.rs.interval != "" && !f.now().Before(f.end)) {
+		if f.file == nil {
+			rotateErr = f.open()
+		} else {
+			rotateErr = f.rotate()
+		}
+		if f.file == nil {
+			return 0, rotateErr
+		}
+	}
+
+	if f.rs.quota > 0 && !f.exceeded() && f.size+f.backupBytes+int64(len(p)) > f.rs.quota {
+		f.enforceQuota(int64(len(p)))
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	f.stats.wrote(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+func (f *rotatingFile) reportStatus(s *sinkStats) {
+	f.mu.Lock()
+	f.stats = s
+	f.mu.Unlock()
+}
+
+// Sync flushes the current file.
+func (f *rotatingFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Sync()
+}
+
+// Close closes the current file.
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,184 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpandRotationPattern(t *testing.T) {
+	now := time.Date(2017, time.March, 4, 5, 6, 7, 0, time.UTC)
+
+	cases := []struct {
+		pattern string
+		result  string
+	}{
+		{"mixer.log", "mixer.log"},
+		{"mixer-%Y%m%d.log", "mixer-20170304.log"},
+		{"mixer-%Y%m%d%H.log", "mixer-2017030405.log"},
+		{"100%%-%d.log", "100%-04.log"},
+		{"mixer-%x.log", "mixer-%x.log"},
+		{"mixer%", "mixer%"},
+	}
+
+	for _, c := range cases {
+		if result := expandRotationPattern(c.pattern, now); result != c.result {
+			t.Errorf("Got %s for %s, expecting %s", result, c.pattern, c.result)
+		}
+	}
+}
+
+func TestRotationPeriod(t *testing.T) {
+	now := time.Date(2017, time.December, 31, 23, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		interval string
+		start    time.Time
+		end      time.Time
+	}{
+		{rotateHourly, time.Date(2017, time.December, 31, 23, 0, 0, 0, time.UTC), time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{rotateDaily, time.Date(2017, time.December, 31, 0, 0, 0, 0, time.UTC), time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, c := range cases {
+		start := rotationStart(c.interval, now)
+		if end := rotationEnd(c.interval, start); !start.Equal(c.start) || !end.Equal(c.end) {
+			t.Errorf("Got %v - %v for %s, expecting %v - %v", start, end, c.interval, c.start, c.end)
+		}
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	cases := []struct {
+		path    string
+		current string
+		rotated string
+	}{
+		{filepath.Join(dir, "mixer.log"), "mixer.log", "mixer-20171231.log"},
+		{filepath.Join(dir, "mixer-%Y%m%d.log"), "mixer-20180101.log", "mixer-20171231.log"},
+	}
+
+	for _, c := range cases {
+		now := time.Date(2017, time.December, 31, 23, 30, 0, 0, time.Local)
+		f, err := openRotatingFile(c.path, &rotationSettings{interval: rotateDaily}, &fileSettings{uid: -1, gid: -1}, func() time.Time { return now })
+		if err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		if _, err = f.Write([]byte("before\n")); err != nil {
+			t.Errorf("Got err '%v', expecting success", err)
+		}
+		now = now.Add(time.Hour)
+		if _, err = f.Write([]byte("after\n")); err != nil {
+			t.Errorf("Got err '%v', expecting success", err)
+		}
+		if err = f.Close(); err != nil {
+			t.Errorf("Got err '%v', expecting success", err)
+		}
+
+		if content, err := ioutil.ReadFile(filepath.Join(dir, c.rotated)); err != nil || string(content) != "before\n" {
+			t.Errorf("Got '%s', %v for %s, expecting the entry of the past period", content, err, c.rotated)
+		}
+		if content, err := ioutil.ReadFile(filepath.Join(dir, c.current)); err != nil || string(content) != "after\n" {
+			t.Errorf("Got '%s', %v for %s, expecting the entry of the current period", content, err, c.current)
+		}
+
+		if _, err = f.Write([]byte("closed\n")); err == nil {
+			t.Error("Got success, expecting writes to a closed file to fail")
+		}
+
+		for _, name := range []string{c.current, c.rotated} {
+			_ = os.Remove(filepath.Join(dir, name))
+		}
+	}
+}
+
+func TestRotatingFileLeftOver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	path := filepath.Join(dir, "mixer.log")
+	if err = ioutil.WriteFile(path, []byte("old\n"), 0644); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	past := time.Date(2017, time.December, 30, 12, 0, 0, 0, time.Local)
+	if err = os.Chtimes(path, past, past); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	now := time.Date(2017, time.December, 31, 12, 0, 0, 0, time.Local)
+	f, err := openRotatingFile(path, &rotationSettings{interval: rotateDaily}, &fileSettings{uid: -1, gid: -1}, func() time.Time { return now })
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	_ = f.Close()
+
+	if content, err := ioutil.ReadFile(filepath.Join(dir, "mixer-20171230.log")); err != nil || string(content) != "old\n" {
+		t.Errorf("Got '%s', %v, expecting the left-over file to be rotated", content, err)
+	}
+}
+
+func TestConfigureRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	o := NewOptions()
+	o.RotationInterval = "weekly"
+	if err := Configure(o); err == nil || !strings.Contains(err.Error(), "weekly") {
+		t.Errorf("Got err '%v', expecting an unknown rotation interval error", err)
+	}
+
+	o = NewOptions()
+	o.OutputPaths = []string{filepath.Join(dir, "mixer-%Y%m%d.log")}
+	o.RotationInterval = rotateDaily
+	o.AuditOutputPaths = []string{filepath.Join(dir, "audit-%Y%m%d%H.log")}
+	o.AuditRotationInterval = rotateHourly
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer configureWithoutOutput(t)
+
+	now := time.Now()
+	Info("Hello")
+	Audit("Changed")
+	Sync()
+
+	logPath := expandRotationPattern(o.OutputPaths[0], now)
+	if content, err := ioutil.ReadFile(logPath); err != nil || !strings.Contains(string(content), "\tinfo\tHello") {
+		t.Errorf("Got '%s', %v, expecting the entry in %s", content, err, logPath)
+	}
+
+	auditPath := expandRotationPattern(o.AuditOutputPaths[0], now)
+	if content, err := ioutil.ReadFile(auditPath); err != nil || !strings.Contains(string(content), "Changed") {
+		t.Errorf("Got '%s', %v, expecting the audit entry in %s", content, err, auditPath)
+	}
+}
@@ -0,0 +1,352 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	numLevels        = int(zapcore.FatalLevel-zapcore.DebugLevel) + 1
+	countersPerLevel = 4096
+
+	// maxThrottleFactor caps how aggressively adaptive sampling can tighten.
+	maxThrottleFactor = 1024
+)
+
+// counter tracks the number of times a given level/message combination was seen during the current tick.
+type counter struct {
+	resetAt int64
+	count   uint64
+}
+
+type counters [numLevels][countersPerLevel]counter
+
+func (cs *counters) get(lvl zapcore.Level, key string) *counter {
+	i := int(lvl - zapcore.DebugLevel)
+	j := fnv32a(key) % countersPerLevel
+	return &cs[i][j]
+}
+
+// getScoped returns the counter of a key within a scope, apart from the counters of the key in
+// other scopes.
+func (cs *counters) getScoped(lvl zapcore.Level, scope string, key string) *counter {
+	i := int(lvl - zapcore.DebugLevel)
+	j := fnv32aAppend(fnv32a(key), scope) % countersPerLevel
+	return &cs[i][j]
+}
+
+const (
+	offset32 = 2166136261
+	prime32  = 16777619
+)
+
+// fnv32a is adapted from "hash/fnv", but without a []byte(string) alloc
+func fnv32a(s string) uint32 {
+	return fnv32aAppend(offset32, s)
+}
+
+// fnv32aAppend continues the given hash with the bytes of a string.
+func fnv32aAppend(hash uint32, s string) uint32 {
+	for i := 0; i < len(s); i++ {
+		hash ^= uint32(s[i])
+		hash *= prime32
+	}
+	return hash
+}
+
+func (c *counter) incCheckReset(t time.Time, tick time.Duration) uint64 {
+	tn := t.UnixNano()
+	resetAfter := atomic.LoadInt64(&c.resetAt)
+	if resetAfter > tn {
+		return atomic.AddUint64(&c.count, 1)
+	}
+
+	atomic.StoreUint64(&c.count, 1)
+
+	newResetAfter := tn + tick.Nanoseconds()
+	if !atomic.CompareAndSwapInt64(&c.resetAt, resetAfter, newResetAfter) {
+		// we raced with another goroutine trying to reset, and it also reset
+		// the counter to 1, so we need to reincrement the counter.
+		return atomic.AddUint64(&c.count, 1)
+	}
+
+	return 1
+}
+
+// throttle tracks the overall rate of entries being output and computes a factor by which
+// sampling is tightened whenever that rate exceeds a budget.
+//
+// The factor doubles for every tick during which more than budget entries were output, and
+// halves for every tick during which less than half the budget was output, including ticks
+// during which nothing was output at all.
+type throttle struct {
+	windowEnd int64
+	written   uint64
+	factor    uint64
+
+	budget uint64
+	tick   time.Duration
+}
+
+func newThrottle(budget int, tick time.Duration) *throttle {
+	return &throttle{
+		factor: 1,
+		budget: uint64(budget),
+		tick:   tick,
+	}
+}
+
+// currentFactor returns the factor to apply to sampling for an entry at the given time.
+func (t *throttle) currentFactor(now time.Time) uint64 {
+	tn := now.UnixNano()
+	windowEnd := atomic.LoadInt64(&t.windowEnd)
+	if tn < windowEnd || !atomic.CompareAndSwapInt64(&t.windowEnd, windowEnd, tn+t.tick.Nanoseconds()) {
+		return atomic.LoadUint64(&t.factor)
+	}
+
+	// we won the race to start a new window, adjust the factor based on the last one
+	written := atomic.SwapUint64(&t.written, 0)
+	factor := atomic.LoadUint64(&t.factor)
+	if written > t.budget && factor < maxThrottleFactor {
+		factor *= 2
+	} else if written < t.budget/2 && factor > 1 {
+		factor /= 2
+	}
+
+	if windowEnd != 0 {
+		// relax further for every tick that went by without anything being output
+		for idle := (tn - windowEnd) / t.tick.Nanoseconds(); idle > 0 && factor > 1; idle-- {
+			factor /= 2
+		}
+	}
+	atomic.StoreUint64(&t.factor, factor)
+	samplingFactor.Set(float64(factor))
+
+	return factor
+}
+
+// wrote records that an entry is being output.
+func (t *throttle) wrote() {
+	atomic.AddUint64(&t.written, 1)
+}
+
+// scopeSampling is the sampling of a scope set apart from that of the others.
+type scopeSampling struct {
+	first, thereafter uint64
+
+	// whether every entry of the scope is output
+	disabled bool
+}
+
+// parseScopeSampling parses a comma-separated list of <scope>:<initial>/<thereafter> and
+// <scope>:none, returning nil when empty.
+func parseScopeSampling(s string) (map[string]scopeSampling, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	scopes := make(map[string]scopeSampling)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+
+		colon := strings.Index(item, ":")
+		if colon <= 0 {
+			return nil, fmt.Errorf("invalid scope sampling '%s', expecting <scope>:<initial>/<thereafter> or <scope>:none", item)
+		}
+
+		scope, value := strings.TrimSpace(item[:colon]), strings.TrimSpace(item[colon+1:])
+		if value == "none" {
+			scopes[scope] = scopeSampling{disabled: true}
+			continue
+		}
+
+		parts := strings.Split(value, "/")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid sampling of %s: %s, expecting <initial>/<thereafter> or none", scope, value)
+		}
+
+		first, err := strconv.Atoi(parts[0])
+		if err != nil || first < 0 {
+			return nil, fmt.Errorf("invalid sampling initial value of %s: %s", scope, parts[0])
+		}
+
+		thereafter, err := strconv.Atoi(parts[1])
+		if err != nil || thereafter < 1 {
+			return nil, fmt.Errorf("invalid sampling thereafter value of %s: %s", scope, parts[1])
+		}
+
+		scopes[scope] = scopeSampling{first: uint64(first), thereafter: uint64(thereafter)}
+	}
+
+	return scopes, nil
+}
+
+// sampler is a core which behaves like zap's built-in sampler, except that it keeps
+// track of the entries it drops so they can be reported.
+//
+// Within each tick, the first entries with a given level and message are output and
+// thereafter only every Nth one is. When a throttle is supplied, both of these values
+// are scaled by the throttle's current factor. Scopes can be sampled with values of their
+// own, or not at all.
+type sampler struct {
+	zapcore.Core
+
+	counts            *counters
+	drops             *dropTally
+	throttle          *throttle
+	tick              time.Duration
+	first, thereafter uint64
+	scopes            map[string]scopeSampling
+}
+
+func newSampler(core zapcore.Core, tick time.Duration, first, thereafter int, scopes map[string]scopeSampling,
+	drops *dropTally, t *throttle) zapcore.Core {
+	return &sampler{
+		Core:       core,
+		counts:     &counters{},
+		drops:      drops,
+		throttle:   t,
+		tick:       tick,
+		first:      uint64(first),
+		thereafter: uint64(thereafter),
+		scopes:     scopes,
+	}
+}
+
+func (s *sampler) With(fields []zapcore.Field) zapcore.Core {
+	return &sampler{
+		Core:       s.Core.With(fields),
+		counts:     s.counts,
+		drops:      s.drops,
+		throttle:   s.throttle,
+		tick:       s.tick,
+		first:      s.first,
+		thereafter: s.thereafter,
+		scopes:     s.scopes,
+	}
+}
+
+func (s *sampler) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !s.Enabled(ent.Level) {
+		return ce
+	}
+
+	first, thereafter := s.first, s.thereafter
+	name, scoped := scopeOf(ent), false
+	if scope, ok := s.scopes[name]; ok {
+		if scope.disabled {
+			if s.throttle != nil {
+				s.throttle.wrote()
+			}
+			return s.Core.Check(ent, ce)
+		}
+		first, thereafter, scoped = scope.first, scope.thereafter, true
+	}
+
+	if s.throttle != nil {
+		f := s.throttle.currentFactor(ent.Time)
+		first /= f
+		thereafter *= f
+	}
+
+	c := s.counts.get(ent.Level, ent.Message)
+	if scoped {
+		// the scopes sampled apart from the others count their entries apart as well
+		c = s.counts.getScoped(ent.Level, name, ent.Message)
+	}
+
+	n := c.incCheckReset(ent.Time, s.tick)
+	if n > first && (n-first)%thereafter != 0 {
+		s.drops.record(ent)
+		return ce
+	}
+
+	if s.throttle != nil {
+		s.throttle.wrote()
+	}
+
+	return s.Core.Check(ent, ce)
+}
+
+type dropKey struct {
+	level zapcore.Level
+	scope string
+}
+
+// dropTally counts the entries discarded by a sampler or by the queue of the asynchronous mode,
+// in the given counter and for reporting by reportDrops. The reason, if any, is appended to the
+// reports.
+type dropTally struct {
+	counter *prometheus.CounterVec
+	reason  string
+
+	mu      sync.Mutex
+	dropped map[dropKey]uint64
+}
+
+func newDropTally(counter *prometheus.CounterVec, reason string) *dropTally {
+	return &dropTally{counter: counter, reason: reason, dropped: make(map[dropKey]uint64)}
+}
+
+func (d *dropTally) record(ent zapcore.Entry) {
+	scope := scopeOf(ent)
+	d.counter.WithLabelValues(ent.Level.String(), scope).Inc()
+
+	d.mu.Lock()
+	d.dropped[dropKey{ent.Level, scope}]++
+	d.mu.Unlock()
+}
+
+// reset returns the drops recorded since the last call and starts a new tally.
+func (d *dropTally) reset() map[dropKey]uint64 {
+	d.mu.Lock()
+	dropped := d.dropped
+	d.dropped = make(map[dropKey]uint64)
+	d.mu.Unlock()
+
+	return dropped
+}
+
+// reportDrops periodically outputs a summary of the entries recorded by a dropTally to the given
+// logger, until the stop channel is closed.
+func reportDrops(l *zap.Logger, d *dropTally, interval time.Duration, stop <-chan struct{}) {
+	t := newTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C():
+			for k, n := range d.reset() {
+				msg := fmt.Sprintf("dropped %d %s messages in the last %v", n, k.level, interval)
+				if d.reason != "" {
+					msg += " " + d.reason
+				}
+				l.Info(msg, zap.String(scopeLabel, k.scope))
+			}
+		}
+	}
+}
@@ -0,0 +1,265 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSampling(t *testing.T) {
+	var before float64
+	lines, err := captureStdout(func() {
+		o := NewOptions()
+		if err := Configure(o); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		before = counterValue(t, "istio_log_sampling_dropped_entries_total", "info", "default")
+		for i := 0; i < 150; i++ {
+			Info("Hello")
+		}
+		Sync()
+	})
+
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	// the last line is empty
+	if len(lines)-1 != 100 {
+		t.Errorf("Got %d lines, expecting 100", len(lines)-1)
+	}
+
+	if got := counterValue(t, "istio_log_sampling_dropped_entries_total", "info", "default") - before; got != 50 {
+		t.Errorf("Got %v dropped entries, expecting 50", got)
+	}
+}
+
+func TestSamplingOptions(t *testing.T) {
+	cases := []struct {
+		initial    int
+		thereafter int
+		disable    bool
+		lines      int
+	}{
+		{100, 100, false, 100},
+		{10, 5, false, 38},
+		{0, 1, false, 150},
+		{1, 1000, false, 1},
+		{100, 100, true, 150},
+		{-1, 0, true, 150},
+	}
+
+	for i, c := range cases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			lines, err := captureStdout(func() {
+				o := NewOptions()
+				o.SamplingInitial = c.initial
+				o.SamplingThereafter = c.thereafter
+				o.DisableSampling = c.disable
+				if err := Configure(o); err != nil {
+					t.Fatalf("Got err '%v', expecting success", err)
+				}
+
+				for i := 0; i < 150; i++ {
+					Info("Hello")
+				}
+				Sync()
+			})
+
+			if err != nil {
+				t.Fatalf("Got error '%v', expected success", err)
+			}
+
+			if len(lines)-1 != c.lines {
+				t.Errorf("Got %d lines, expecting %d", len(lines)-1, c.lines)
+			}
+		})
+	}
+
+	o := NewOptions()
+	o.SamplingInitial = -1
+	if err := Configure(o); err == nil {
+		t.Errorf("Got success, expecting failure")
+	}
+
+	o = NewOptions()
+	o.SamplingThereafter = 0
+	if err := Configure(o); err == nil {
+		t.Errorf("Got success, expecting failure")
+	}
+}
+
+func TestScopeSampling(t *testing.T) {
+	lines, err := captureStdout(func() {
+		o := NewOptions()
+		o.ScopeSampling = "report:10/1000, config:none"
+		if err := Configure(o); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		for i := 0; i < 150; i++ {
+			Info("Hello")
+			Named("report").Info("Hello")
+			Named("config").Info("Hello")
+		}
+		Sync()
+	})
+
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	counts := map[string]int{}
+	for _, line := range lines {
+		switch {
+		case strings.Contains(line, "\treport\t"):
+			counts["report"]++
+		case strings.Contains(line, "\tconfig\t"):
+			counts["config"]++
+		case line != "":
+			counts["default"]++
+		}
+	}
+
+	expected := map[string]int{"default": 100, "report": 10, "config": 150}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("Got %v entries per scope, expecting %v", counts, expected)
+	}
+}
+
+func TestParseScopeSampling(t *testing.T) {
+	scopes, err := parseScopeSampling("report:10/1000, config:none")
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	expected := map[string]scopeSampling{
+		"report": {first: 10, thereafter: 1000},
+		"config": {disabled: true},
+	}
+	if len(scopes) != len(expected) || scopes["report"] != expected["report"] || scopes["config"] != expected["config"] {
+		t.Errorf("Got %v, expecting %v", scopes, expected)
+	}
+
+	if scopes, err := parseScopeSampling(""); err != nil || scopes != nil {
+		t.Errorf("Got %v and err '%v', expecting nothing", scopes, err)
+	}
+
+	for _, s := range []string{"report", ":10/10", "report:10", "report:x/10", "report:10/0", "report:-1/10", "report:10/10/10"} {
+		if _, err := parseScopeSampling(s); err == nil {
+			t.Errorf("%s: got success, expecting an error", s)
+		}
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	th := newThrottle(10, time.Second)
+	start := time.Unix(1000, 0)
+
+	cases := []struct {
+		at      time.Duration
+		written int
+		factor  uint64
+	}{
+		{0, 20, 1},
+		{time.Second, 20, 2},
+		{2 * time.Second, 6, 4},
+		{3 * time.Second, 4, 4},
+		{4 * time.Second, 0, 2},
+		{4*time.Second + 500*time.Millisecond, 0, 2},
+		{10 * time.Second, 0, 1},
+	}
+
+	for i, c := range cases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			if f := th.currentFactor(start.Add(c.at)); f != c.factor {
+				t.Errorf("Got factor %d, expecting %d", f, c.factor)
+			}
+
+			for j := 0; j < c.written; j++ {
+				th.wrote()
+			}
+		})
+	}
+}
+
+func TestAdaptiveSampling(t *testing.T) {
+	lines, err := captureStdout(func() {
+		o := NewOptions()
+		o.SamplingBudget = 10
+		if err := Configure(o); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		for i := 0; i < 150; i++ {
+			Info("Hello")
+		}
+		Sync()
+	})
+
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	// the budget is only enforced once a full second has gone by
+	if len(lines)-1 != 100 {
+		t.Errorf("Got %d lines, expecting 100", len(lines)-1)
+	}
+
+	o := NewOptions()
+	o.SamplingBudget = -1
+	if err := Configure(o); err == nil {
+		t.Errorf("Got success, expecting failure")
+	}
+}
+
+func TestSamplingSummary(t *testing.T) {
+	lines, err := captureStdout(func() {
+		o := NewOptions()
+		o.SamplingSummaryInterval = 10 * time.Millisecond
+		if err := Configure(o); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+
+		for i := 0; i < 150; i++ {
+			Info("Hello")
+		}
+
+		time.Sleep(100 * time.Millisecond)
+		Sync()
+
+		// stop the summary reporting
+		_ = Configure(NewOptions())
+	})
+
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	pat := ".*Z\tinfo\tdropped 50 info messages in the last 10ms\t{\"scope\": \"default\"}"
+	for _, l := range lines {
+		if match, _ := regexp.MatchString(pat, l); match {
+			return
+		}
+	}
+
+	t.Errorf("Got '%v', expecting a line matching '%v'", strings.Join(lines, "\n"), pat)
+}
@@ -0,0 +1,90 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// logSchemaKey is the key of the version of the schema the JSON entries are stamped with.
+const logSchemaKey = "log_schema"
+
+// currentLogSchema is the version of the schema of the JSON entries output by default.
+const currentLogSchema = 2
+
+// versionedJSONEncoding is the JSON encoding stamping the entries with the version of their
+// schema, which the outputs in the JSON encoding are built with.
+const versionedJSONEncoding = "json-versioned"
+
+// logSchema describes how the JSON entries of a version of the schema differ from those of the
+// current version, so that Options.LogSchema can keep the entries in an older schema while the
+// parsers and dashboards downstream are upgraded. Releases changing the layout of the entries bump
+// currentLogSchema, and describe the previous layout here.
+type logSchema struct {
+	// whether the entries carry the version under log_schema
+	stamped bool
+
+	// the keys named differently from the current version, as <key>=<name> like in
+	// Options.EncoderKeys
+	keys []string
+}
+
+// logSchemas are the versions of the schema Options.LogSchema can be set to.
+var logSchemas = map[int]logSchema{
+	// the entries before they were stamped with the version of their schema
+	1: {},
+
+	currentLogSchema: {stamped: true},
+}
+
+// The version of the schema of the JSON entries of the outputs opened by the last call to
+// Configure.
+var outputLogSchema = currentLogSchema
+
+func init() {
+	registerEncoder(versionedJSONEncoding, func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		return newJSONEncoder(cfg), nil
+	})
+}
+
+// checkLogSchema returns an error for an unknown version of the schema, 0 standing for the current
+// one.
+func checkLogSchema(version int) error {
+	if _, ok := logSchemas[version]; !ok && version != 0 {
+		return fmt.Errorf("unknown log schema: %d", version)
+	}
+	return nil
+}
+
+// setLogSchema sets the version of the schema of the JSON entries of the outputs opened from now
+// on, 0 standing for the current one.
+func setLogSchema(version int) {
+	if version == 0 {
+		version = currentLogSchema
+	}
+	outputLogSchema = version
+}
+
+// newJSONEncoder builds a JSON encoder, which stamps the entries with the version of their schema
+// unless they are in a version predating the stamp.
+func newJSONEncoder(cfg zapcore.EncoderConfig) zapcore.Encoder {
+	enc := zapcore.NewJSONEncoder(cfg)
+	if logSchemas[outputLogSchema].stamped {
+		enc.AddInt(logSchemaKey, outputLogSchema)
+	}
+	return enc
+}
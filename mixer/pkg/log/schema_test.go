@@ -0,0 +1,77 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"testing"
+)
+
+func TestLogSchema(t *testing.T) {
+	cases := []struct {
+		schema   int
+		expected string
+	}{
+		{0, `{"level":"info","msg":"Hello","log_schema":2,"user":"bob"}`},
+		{2, `{"level":"info","msg":"Hello","log_schema":2,"user":"bob"}`},
+		{1, `{"level":"info","msg":"Hello","user":"bob"}`},
+	}
+
+	for _, c := range cases {
+		lines, err := captureStdout(func() {
+			o := NewOptions()
+			o.AuditOutputPaths = nil
+			o.EncoderKeys = []string{"time="}
+			o.JSONEncoding = true
+			o.LogSchema = c.schema
+			if err := Configure(o); err != nil {
+				t.Fatalf("Got err '%v', expecting success", err)
+			}
+
+			Info("Hello", String("user", "bob"))
+			Sync()
+		})
+		if err != nil {
+			t.Fatalf("Got error '%v', expected success", err)
+		}
+
+		if lines[0] != c.expected {
+			t.Errorf("Got '%s' in schema %d, expecting '%s'", lines[0], c.schema, c.expected)
+		}
+	}
+	configureWithoutOutput(t)
+}
+
+func TestLogSchemaKeys(t *testing.T) {
+	// a version from before msg was renamed to message
+	logSchemas[99] = logSchema{keys: []string{"msg=message"}}
+	defer delete(logSchemas, 99)
+
+	cfg, err := newOutputEncoderConfig(&Options{LogSchema: 99})
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	if cfg.MessageKey != "message" {
+		t.Errorf("Got %s, expecting the key of the schema", cfg.MessageKey)
+	}
+
+	// the options rename the keys further
+	cfg, err = newOutputEncoderConfig(&Options{LogSchema: 99, EncoderKeys: []string{"msg=text"}})
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	if cfg.MessageKey != "text" {
+		t.Errorf("Got %s, expecting the key of the options", cfg.MessageKey)
+	}
+}
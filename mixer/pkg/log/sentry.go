@@ -0,0 +1,212 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Sentry exporter
+//
+// A SentryExporter sends the entries handed to its Hook to Sentry as events, with their scope,
+// level, stack trace, and fields. It is registered with RegisterErrorHook:
+//
+//		s, err := log.NewSentryExporter(os.Getenv("SENTRY_DSN"))
+//		if err != nil {
+//			// print an error and quit
+//		}
+//		defer s.Close()
+//		defer log.RegisterErrorHook(s.Hook)()
+//
+// Events are sent from a background goroutine, except for those of the entries above the error
+// level, which are waited for since the process may be about to exit. The DSN accepts these query
+// parameters:
+//
+//		buffer         the maximum number of events held while Sentry is unreachable, 1000 by default
+//		timeout        the time waited for the events of fatal entries to be sent, 10s by default
+
+const sentryClient = "istio-log/1.0"
+
+var sentryDefaultBatch = batchSettings{
+	size:     100,
+	interval: 100 * time.Millisecond,
+	buffer:   1000,
+	timeout:  10 * time.Second,
+}
+
+// SentryExporter sends error entries to Sentry.
+type SentryExporter struct {
+	client  *http.Client
+	url     string
+	header  http.Header
+	server  string
+	batcher *batcher
+}
+
+// sentryEvent is an event as accepted by the store endpoint of Sentry.
+type sentryEvent struct {
+	EventID    string                 `json:"event_id"`
+	Timestamp  string                 `json:"timestamp"`
+	Level      string                 `json:"level"`
+	Logger     string                 `json:"logger,omitempty"`
+	Platform   string                 `json:"platform"`
+	Message    string                 `json:"message"`
+	ServerName string                 `json:"server_name,omitempty"`
+	Extra      map[string]interface{} `json:"extra,omitempty"`
+	Stacktrace *sentryStacktrace      `json:"stacktrace,omitempty"`
+}
+
+type sentryStacktrace struct {
+	Frames []sentryFrame `json:"frames"`
+}
+
+type sentryFrame struct {
+	Function string `json:"function"`
+	Filename string `json:"filename"`
+	Lineno   int    `json:"lineno"`
+}
+
+// NewSentryExporter returns an exporter sending events to the Sentry project of the given DSN, of
+// the form https://<key>@<host>/<project>.
+func NewSentryExporter(dsn string) (*SentryExporter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil || u.User.Username() == "" || u.Host == "" {
+		return nil, errors.New("invalid Sentry DSN, expecting <scheme>://<key>@<host>/<project>")
+	}
+
+	slash := strings.LastIndex(u.Path, "/")
+	project := u.Path[slash+1:]
+	if slash < 0 || project == "" {
+		return nil, fmt.Errorf("missing Sentry project in the DSN for %s", u.Host)
+	}
+
+	settings, err := parseBatchSettings(u.Query(), sentryDefaultBatch)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Sentry settings: %v", err)
+	}
+
+	auth := fmt.Sprintf("Sentry sentry_version=7, sentry_client=%s, sentry_key=%s", sentryClient, u.User.Username())
+	if secret, ok := u.User.Password(); ok {
+		auth += ", sentry_secret=" + secret
+	}
+
+	store := url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path[:slash] + "/api/" + project + "/store/"}
+	s := &SentryExporter{
+		client: newSinkHTTPClient(settings.timeout, false),
+		url:    store.String(),
+		header: http.Header{
+			"Content-Type":  []string{"application/json"},
+			"X-Sentry-Auth": []string{auth},
+		},
+	}
+	s.server, _ = os.Hostname()
+	s.batcher = newBatcher("sentry", settings, s.send)
+
+	return s, nil
+}
+
+// Hook sends the given entry to Sentry. It is meant to be registered with RegisterErrorHook.
+func (s *SentryExporter) Hook(entry zapcore.Entry, fields []zapcore.Field) {
+	body, err := json.Marshal(s.event(entry, fields))
+	if err == nil {
+		err = s.batcher.enqueue(body)
+	}
+	s.batcher.report(err)
+
+	if entry.Level > zapcore.ErrorLevel {
+		s.batcher.report(s.batcher.sync())
+	}
+}
+
+// Close sends the events still buffered, and stops the exporter.
+func (s *SentryExporter) Close() error {
+	return s.batcher.Close()
+}
+
+func (s *SentryExporter) event(ent zapcore.Entry, fields []zapcore.Field) *sentryEvent {
+	ev := &sentryEvent{
+		EventID:    newSentryEventID(),
+		Timestamp:  ent.Time.UTC().Format("2006-01-02T15:04:05"),
+		Level:      "error",
+		Logger:     ent.LoggerName,
+		Platform:   "go",
+		Message:    ent.Message,
+		ServerName: s.server,
+	}
+	if ent.Level > zapcore.ErrorLevel {
+		ev.Level = "fatal"
+	}
+
+	if len(fields) > 0 {
+		enc := zapcore.NewMapObjectEncoder()
+		for _, f := range fields {
+			f.AddTo(enc)
+		}
+		ev.Extra = enc.Fields
+	}
+
+	if frames := parseSentryFrames(ent.Stack); len(frames) > 0 {
+		ev.Stacktrace = &sentryStacktrace{Frames: frames}
+	}
+
+	return ev
+}
+
+// send posts each event of the batch, retrying the events from the first one failing with a
+// retryable error.
+func (s *SentryExporter) send(batch []interface{}) error {
+	var err error
+	for i, body := range batch {
+		_, e := postBatch(s.client, s.url, body.([]byte), false, s.header)
+		if r, ok := e.(retryableError); ok {
+			r.retry = batch[i:]
+			return r
+		}
+		if e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// newSentryEventID returns a random event ID, a UUID in hexadecimal without dashes.
+func newSentryEventID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// parseSentryFrames turns a stack trace as formatted by zap into Sentry frames, ordered from the
+// outermost call as Sentry expects, without the frames of zap and of this package.
+func parseSentryFrames(stack string) []sentryFrame {
+	calls := parseStack(stack)
+
+	var frames []sentryFrame
+	for i := len(calls) - 1; i >= 0; i-- {
+		frames = append(frames, sentryFrame{Function: calls[i].function, Filename: calls[i].file, Lineno: calls[i].line})
+	}
+	return frames
+}
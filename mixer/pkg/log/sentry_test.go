@@ -0,0 +1,138 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type sentryRequest struct {
+	r     *http.Request
+	event sentryEvent
+}
+
+// newFakeSentry records the events it receives.
+func newFakeSentry(t *testing.T) (*httptest.Server, chan sentryRequest) {
+	requests := make(chan sentryRequest, 100)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev sentryEvent
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Errorf("Unable to decode event: %v", err)
+		}
+
+		requests <- sentryRequest{r: r, event: ev}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	return server, requests
+}
+
+func TestSentryExporter(t *testing.T) {
+	server, requests := newFakeSentry(t)
+	defer server.Close()
+
+	s, err := NewSentryExporter(strings.Replace(server.URL, "http://", "http://public:secret@", 1) + "/sentry/42")
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer s.Close()
+
+	configureWithoutOutput(t)
+	defer RegisterErrorHook(s.Hook)()
+
+	Named("dispatcher").Error("Unable to dispatch", zap.String("adapter", "a"), zap.Int("attempt", 3))
+
+	var req sentryRequest
+	select {
+	case req = <-requests:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the event")
+	}
+
+	if req.r.URL.Path != "/sentry/api/42/store/" {
+		t.Errorf("Got path %s, expecting the store endpoint of the project", req.r.URL.Path)
+	}
+	if auth := req.r.Header.Get("X-Sentry-Auth"); !strings.Contains(auth, "sentry_key=public") || !strings.Contains(auth, "sentry_secret=secret") {
+		t.Errorf("Got auth '%s', expecting the key and secret of the DSN", auth)
+	}
+
+	ev := req.event
+	if ev.Level != "error" || ev.Logger != "dispatcher" || ev.Message != "Unable to dispatch" || len(ev.EventID) != 32 {
+		t.Errorf("Got %+v, expecting the entry", ev)
+	}
+	if ev.Extra["adapter"] != "a" || ev.Extra["attempt"] != float64(3) {
+		t.Errorf("Got extra %v, expecting the fields", ev.Extra)
+	}
+	if ev.Stacktrace == nil || len(ev.Stacktrace.Frames) == 0 {
+		t.Fatalf("Got %+v, expecting a stack trace", ev.Stacktrace)
+	}
+	if f := ev.Stacktrace.Frames[len(ev.Stacktrace.Frames)-1]; f.Function != "testing.tRunner" || f.Lineno == 0 {
+		t.Errorf("Got innermost frame %+v, expecting the frames of the log package left out", f)
+	}
+}
+
+func TestSentryExporterWaitsForFatalEntries(t *testing.T) {
+	server, requests := newFakeSentry(t)
+	defer server.Close()
+
+	s, err := NewSentryExporter(strings.Replace(server.URL, "http://", "http://public@", 1) + "/7")
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer s.Close()
+
+	configureWithoutOutput(t)
+	defer RegisterErrorHook(s.Hook)()
+
+	Logger().DPanic("Inconsistent state")
+
+	select {
+	case req := <-requests:
+		if req.event.Level != "fatal" {
+			t.Errorf("Got level %s, expecting fatal", req.event.Level)
+		}
+	default:
+		t.Error("Got no event, expecting it sent before the entry returned")
+	}
+}
+
+func TestNewSentryExporterErrors(t *testing.T) {
+	for _, dsn := range []string{"", "https://sentry.io/42", "https://key@sentry.io/", "https://key@sentry.io/42?buffer=0"} {
+		if s, err := NewSentryExporter(dsn); err == nil {
+			_ = s.Close()
+			t.Errorf("%s: got success, expecting an error", dsn)
+		}
+	}
+}
+
+func TestParseSentryFrames(t *testing.T) {
+	stack := "go.uber.org/zap.Stack\n\t/go/zap/field.go:191\n" +
+		"main.handle\n\t/src/main.go:20\n" +
+		"main.main\n\t/src/main.go:10"
+
+	frames := parseSentryFrames(stack)
+	expected := []sentryFrame{{"main.main", "/src/main.go", 10}, {"main.handle", "/src/main.go", 20}}
+	if len(frames) != len(expected) || frames[0] != expected[0] || frames[1] != expected[1] {
+		t.Errorf("Got %+v, expecting %+v", frames, expected)
+	}
+}
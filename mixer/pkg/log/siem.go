@@ -0,0 +1,262 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+
+	"istio.io/istio/mixer/pkg/version"
+)
+
+// CEF and LEEF encodings
+//
+// The cef and leef encodings output entries in the ArcSight Common Event Format and the QRadar
+// Log Event Extended Format, so they can be ingested by SIEM systems directly. They are mainly
+// meant for the audit stream, see AuditEncoding, but can be used for the diagnostic output too.
+//
+// The header identifies the device as Istio Mixer. In CEF, the signature ID is the scope and the
+// name is the message. In LEEF, the event ID is the message and the scope goes in the cat
+// attribute. The fields with a well-known meaning are mapped to the corresponding CEF extension
+// or LEEF attribute, as listed in siemKeys. Other fields keep their key.
+
+const (
+	cefEncoding  = "cef"
+	leefEncoding = "leef"
+
+	siemVendor  = "Istio"
+	siemProduct = "Mixer"
+
+	leefTimeLayout = "2006-01-02T15:04:05.000-0700"
+	leefTimeFormat = "yyyy-MM-dd'T'HH:mm:ss.SSSZ"
+)
+
+// siemKey is the name of a field in CEF and LEEF. CEF custom strings such as cs1 are labeled
+// with the key of the field.
+type siemKey struct {
+	cef  string
+	leef string
+}
+
+// siemKeys maps field keys to CEF extensions and LEEF attributes.
+var siemKeys = map[string]siemKey{
+	"source.ip":           {"src", "src"},
+	"source.port":         {"spt", "srcPort"},
+	"user":                {"suser", "usrName"},
+	"destination.ip":      {"dst", "dst"},
+	"destination.port":    {"dpt", "dstPort"},
+	"destination.service": {"dhost", "resource"},
+	"protocol":            {"app", "proto"},
+	"request.method":      {"requestMethod", "requestMethod"},
+	"request.path":        {"request", "url"},
+	"request.useragent":   {"requestClientApplication", "userAgent"},
+	"action":              {"act", "action"},
+	"outcome":             {"outcome", "outcome"},
+	"reason":              {"reason", "reason"},
+	"policy":              {"cs1", "policy"},
+	"rule":                {"cs2", "rule"},
+}
+
+// siemSeverities maps levels to CEF severities and LEEF sev values, from 1 to 10.
+var siemSeverities = map[zapcore.Level]int{
+	zapcore.DebugLevel:  1,
+	zapcore.InfoLevel:   3,
+	zapcore.WarnLevel:   5,
+	zapcore.ErrorLevel:  7,
+	zapcore.DPanicLevel: 8,
+	zapcore.PanicLevel:  9,
+	zapcore.FatalLevel:  10,
+}
+
+var siemPool = buffer.NewPool()
+
+func init() {
+	registerEncoder(cefEncoding, func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		return newSIEMEncoder(false, cfg.LineEnding), nil
+	})
+	registerEncoder(leefEncoding, func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		return newSIEMEncoder(true, cfg.LineEnding), nil
+	})
+}
+
+// siemEncoder encodes entries as CEF or LEEF events. Fields added with With are kept in the
+// embedded MapObjectEncoder.
+type siemEncoder struct {
+	*zapcore.MapObjectEncoder
+
+	leef       bool
+	host       string
+	lineEnding string
+}
+
+func newSIEMEncoder(leef bool, lineEnding string) *siemEncoder {
+	host, _ := os.Hostname()
+	return &siemEncoder{
+		MapObjectEncoder: zapcore.NewMapObjectEncoder(),
+		leef:             leef,
+		host:             host,
+		lineEnding:       lineEnding,
+	}
+}
+
+func (e *siemEncoder) Clone() zapcore.Encoder {
+	clone := &siemEncoder{
+		MapObjectEncoder: zapcore.NewMapObjectEncoder(),
+		leef:             e.leef,
+		host:             e.host,
+		lineEnding:       e.lineEnding,
+	}
+	for k, v := range e.Fields {
+		clone.Fields[k] = v
+	}
+	return clone
+}
+
+func (e *siemEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	all := zapcore.NewMapObjectEncoder()
+	for k, v := range e.Fields {
+		all.Fields[k] = v
+	}
+	for _, f := range fields {
+		f.AddTo(all)
+	}
+
+	if ent.Caller.Defined {
+		all.Fields["caller"] = ent.Caller.TrimmedPath()
+	}
+	if ent.Stack != "" {
+		all.Fields["stack"] = ent.Stack
+	}
+
+	keys := make([]string, 0, len(all.Fields))
+	for k := range all.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf := siemPool.Get()
+	if e.leef {
+		e.encodeLEEF(buf, ent, keys, all.Fields)
+	} else {
+		e.encodeCEF(buf, ent, keys, all.Fields)
+	}
+	buf.AppendString(e.lineEnding)
+	return buf, nil
+}
+
+// encodeCEF outputs CEF:0|vendor|product|version|signature ID|name|severity|extensions.
+func (e *siemEncoder) encodeCEF(buf *buffer.Buffer, ent zapcore.Entry, keys []string, fields map[string]interface{}) {
+	buf.AppendString("CEF:0|")
+	for _, s := range []string{siemVendor, siemProduct, version.Info.Version, scopeOf(ent), ent.Message} {
+		buf.AppendString(siemHeaderEscape(s))
+		buf.AppendByte('|')
+	}
+	buf.AppendInt(int64(siemSeverities[ent.Level]))
+	buf.AppendByte('|')
+
+	buf.AppendString("rt=")
+	buf.AppendInt(ent.Time.UnixNano() / int64(time.Millisecond))
+	if e.host != "" {
+		buf.AppendString(" dvchost=")
+		buf.AppendString(cefValueEscape(e.host))
+	}
+
+	for _, k := range keys {
+		key, mapped := siemKeys[k]
+		name := key.cef
+		if !mapped {
+			name = siemKeyName(k)
+		}
+
+		buf.AppendByte(' ')
+		buf.AppendString(name)
+		buf.AppendByte('=')
+		buf.AppendString(cefValueEscape(siemValue(fields[k])))
+
+		if mapped && strings.HasPrefix(name, "cs") {
+			buf.AppendByte(' ')
+			buf.AppendString(name)
+			buf.AppendString("Label=")
+			buf.AppendString(cefValueEscape(k))
+		}
+	}
+}
+
+// encodeLEEF outputs LEEF:1.0|vendor|product|version|event ID|attributes, the attributes being
+// separated by tabs.
+func (e *siemEncoder) encodeLEEF(buf *buffer.Buffer, ent zapcore.Entry, keys []string, fields map[string]interface{}) {
+	buf.AppendString("LEEF:1.0|")
+	for _, s := range []string{siemVendor, siemProduct, version.Info.Version, ent.Message} {
+		buf.AppendString(siemHeaderEscape(s))
+		buf.AppendByte('|')
+	}
+
+	buf.AppendString("devTime=")
+	buf.AppendString(ent.Time.Format(leefTimeLayout))
+	buf.AppendString("\tdevTimeFormat=")
+	buf.AppendString(leefTimeFormat)
+	buf.AppendString("\tsev=")
+	buf.AppendInt(int64(siemSeverities[ent.Level]))
+	buf.AppendString("\tcat=")
+	buf.AppendString(leefValueEscape(scopeOf(ent)))
+
+	for _, k := range keys {
+		key, mapped := siemKeys[k]
+		name := key.leef
+		if !mapped {
+			name = siemKeyName(k)
+		}
+
+		buf.AppendByte('\t')
+		buf.AppendString(name)
+		buf.AppendByte('=')
+		buf.AppendString(leefValueEscape(siemValue(fields[k])))
+	}
+}
+
+// siemValue formats a field value, times as RFC 3339.
+func siemValue(v interface{}) string {
+	if t, ok := v.(time.Time); ok {
+		return t.Format(time.RFC3339Nano)
+	}
+	return flatValue(v)
+}
+
+// siemKeyName turns the key of an unmapped field into a name made of letters, digits, dots, and
+// underscores.
+func siemKeyName(key string) string {
+	b := []byte(key)
+	for i, ch := range b {
+		if !(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch == '_' || ch == '.') {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+var (
+	siemHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefValueEscaper   = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+	leefValueEscaper  = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\r", `\r`, "\n", `\n`)
+)
+
+func siemHeaderEscape(s string) string { return siemHeaderEscaper.Replace(s) }
+func cefValueEscape(s string) string   { return cefValueEscaper.Replace(s) }
+func leefValueEscape(s string) string  { return leefValueEscaper.Replace(s) }
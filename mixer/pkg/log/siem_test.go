@@ -0,0 +1,147 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"istio.io/istio/mixer/pkg/version"
+)
+
+func TestCEF(t *testing.T) {
+	enc := newSIEMEncoder(false, "")
+	enc.host = "mixer-1"
+	enc.AddString("source.ip", "10.0.0.1")
+
+	buf, err := enc.Clone().EncodeEntry(zapcore.Entry{
+		Message:    "Policy denied",
+		Level:      zapcore.WarnLevel,
+		LoggerName: "audit",
+		Time:       time.Unix(1500000000, 123e6),
+	}, []zapcore.Field{
+		zap.String("user", "bob"),
+		zap.String("policy", "deny-all"),
+		zap.Int("destination.port", 8080),
+		zap.String("request.path", "/a=b"),
+		zap.String("detail", "line1\nline2 \\ end"),
+	})
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	expected := "CEF:0|Istio|Mixer|" + version.Info.Version + "|audit|Policy denied|5|rt=1500000000123 dvchost=mixer-1 " +
+		`dpt=8080 detail=line1\nline2 \\ end cs1=deny-all cs1Label=policy request=/a\=b src=10.0.0.1 suser=bob`
+	if buf.String() != expected {
+		t.Errorf("Got\n%s\nexpecting\n%s", buf, expected)
+	}
+}
+
+func TestLEEF(t *testing.T) {
+	enc := newSIEMEncoder(true, "\n")
+
+	ts := time.Date(2017, 7, 14, 2, 40, 0, 123e6, time.UTC)
+	buf, err := enc.EncodeEntry(zapcore.Entry{
+		Message: "Config | changed",
+		Level:   zapcore.ErrorLevel,
+		Time:    ts,
+	}, []zapcore.Field{
+		zap.String("user", "bob"),
+		zap.String("source.ip", "10.0.0.1"),
+		zap.String("note", "a\tb"),
+	})
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	expected := "LEEF:1.0|Istio|Mixer|" + version.Info.Version + `|Config \| changed|` +
+		"devTime=2017-07-14T02:40:00.123+0000\tdevTimeFormat=yyyy-MM-dd'T'HH:mm:ss.SSSZ\tsev=7\tcat=default\t" +
+		"note=a\\tb\tsrc=10.0.0.1\tusrName=bob\n"
+	if buf.String() != expected {
+		t.Errorf("Got\n%q\nexpecting\n%q", buf, expected)
+	}
+}
+
+func TestSIEMKeyName(t *testing.T) {
+	cases := map[string]string{
+		"user":       "user",
+		"request.id": "request.id",
+		"user name":  "user_name",
+		"a=b":        "a_b",
+	}
+
+	for in, expected := range cases {
+		if got := siemKeyName(in); got != expected {
+			t.Errorf("Got %s for %s, expecting %s", got, in, expected)
+		}
+	}
+}
+
+func TestAuditCEF(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	auditPath := filepath.Join(dir, "audit.log")
+
+	o := NewOptions()
+	o.AuditOutputPaths = []string{auditPath}
+	o.AuditEncoding = cefEncoding
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	Audit("Policy denied", zap.String("user", "bob"), zap.String("authorization", "secret"))
+
+	content, err := ioutil.ReadFile(auditPath)
+	if err != nil {
+		t.Fatalf("Unable to read audit log: %v", err)
+	}
+
+	entry := string(content)
+	if !strings.HasPrefix(entry, "CEF:0|Istio|Mixer|") || !strings.Contains(entry, "|audit|Policy denied|3|") ||
+		!strings.Contains(entry, " suser=bob") || !strings.Contains(entry, " authorization=[REDACTED]") {
+		t.Errorf("Got '%s', expecting a redacted CEF event", entry)
+	}
+}
+
+func TestAuditEncodingErrors(t *testing.T) {
+	cases := []struct {
+		encoding  string
+		hashChain bool
+	}{
+		{"xml", false},
+		{cefEncoding, true},
+		{leefEncoding, true},
+	}
+
+	for _, c := range cases {
+		o := NewOptions()
+		o.AuditEncoding = c.encoding
+		o.AuditHashChain = c.hashChain
+		if err := Configure(o); err == nil {
+			t.Errorf("Got success for %s, expecting error", c.encoding)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// SinkFactory creates a core which outputs entries to the destination identified by a URL, along
+// with a closer which releases the resources held by the core. The core only outputs the entries
+// enabled by enab. The closer is called when the log is reconfigured.
+type SinkFactory func(u *url.URL, enab zapcore.LevelEnabler) (zapcore.Core, io.Closer, error)
+
+// The sinks available through OutputPaths, indexed by URL scheme. Sinks register
+// themselves from their own files, which lets platform-specific sinks live behind build tags.
+var (
+	sinkFactoriesMu sync.RWMutex
+	sinkFactories   = make(map[string]SinkFactory)
+)
+
+// RegisterSink makes a sink available through OutputPaths, for the URLs with the given scheme,
+// replacing any sink previously registered for that scheme. This lets programs output the log
+// to destinations not supported by this package.
+func RegisterSink(scheme string, factory SinkFactory) {
+	sinkFactoriesMu.Lock()
+	sinkFactories[strings.ToLower(scheme)] = factory
+	sinkFactoriesMu.Unlock()
+}
+
+func lookupSink(scheme string) SinkFactory {
+	sinkFactoriesMu.RLock()
+	defer sinkFactoriesMu.RUnlock()
+	return sinkFactories[scheme]
+}
+
+// splitOutputPaths separates the plain output paths handled by zap from the URLs of registered sinks.
+func splitOutputPaths(paths []string) ([]string, []*url.URL) {
+	var files []string
+	var sinks []*url.URL
+
+	for _, p := range paths {
+		if u, err := url.Parse(p); err == nil && lookupSink(u.Scheme) != nil {
+			sinks = append(sinks, u)
+		} else {
+			files = append(files, p)
+		}
+	}
+
+	return files, sinks
+}
+
+// sinkName returns the name under which the given sink is reported, by its scheme and host only,
+// leaving out the credentials and settings the URL can hold.
+func sinkName(u *url.URL) string {
+	if u.Host == "" {
+		return u.Scheme + "://" + u.Path
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// newSinkCores opens the given sinks. On failure, any sinks already opened are closed again.
+func newSinkCores(sinks []*url.URL, enab zapcore.LevelEnabler) ([]zapcore.Core, []io.Closer, error) {
+	cores := make([]zapcore.Core, 0, len(sinks))
+	closers := make([]io.Closer, 0, len(sinks))
+
+	for _, u := range sinks {
+		core, closer, err := lookupSink(u.Scheme)(u, enab)
+		if err != nil {
+			closeSinks(closers)
+			return nil, nil, err
+		}
+
+		cores = append(cores, core)
+		closers = append(closers, closer)
+	}
+
+	return cores, closers, nil
+}
+
+// closerFunc turns the close functions returned by zap.Open into closers.
+type closerFunc func()
+
+func (f closerFunc) Close() error {
+	f()
+	return nil
+}
+
+func closeSinks(closers []io.Closer) {
+	for _, c := range closers {
+		_ = c.Close()
+	}
+}
+
+// flattenFields turns structured fields into key/value pairs for sinks that only deal in strings,
+// preserving the order of the fields. Nested objects and arrays are JSON-encoded.
+func flattenFields(fields []zapcore.Field) [][2]string {
+	params := make([][2]string, 0, len(fields))
+
+	for _, f := range fields {
+		enc := zapcore.NewMapObjectEncoder()
+		f.AddTo(enc)
+
+		keys := make([]string, 0, len(enc.Fields))
+		for k := range enc.Fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			params = append(params, [2]string{k, flatValue(enc.Fields[k])})
+		}
+	}
+
+	return params
+}
+
+func flatValue(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case map[string]interface{}, []interface{}:
+		if b, err := json.Marshal(val); err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,139 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type testCloser struct {
+	closed bool
+}
+
+func (c *testCloser) Close() error {
+	c.closed = true
+	return nil
+}
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatalf("Unable to parse %s: %v", s, err)
+	}
+	return u
+}
+
+func TestSplitOutputPaths(t *testing.T) {
+	sinkFactories["test"] = func(*url.URL, zapcore.LevelEnabler) (zapcore.Core, io.Closer, error) {
+		return zapcore.NewNopCore(), &testCloser{}, nil
+	}
+	defer delete(sinkFactories, "test")
+
+	files, sinks := splitOutputPaths([]string{"stdout", "test://a", "/tmp/foo.log", "unknown://b", "test:///c"})
+
+	expected := []string{"stdout", "/tmp/foo.log", "unknown://b"}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Got files %v, expecting %v", files, expected)
+	}
+
+	if len(sinks) != 2 || sinks[0].String() != "test://a" || sinks[1].String() != "test:///c" {
+		t.Errorf("Got sinks %v, expecting test://a and test:///c", sinks)
+	}
+}
+
+func TestNewSinkCoresError(t *testing.T) {
+	opened := &testCloser{}
+	sinkFactories["good"] = func(*url.URL, zapcore.LevelEnabler) (zapcore.Core, io.Closer, error) {
+		return zapcore.NewNopCore(), opened, nil
+	}
+	sinkFactories["bad"] = func(*url.URL, zapcore.LevelEnabler) (zapcore.Core, io.Closer, error) {
+		return nil, nil, errors.New("bad sink")
+	}
+	defer delete(sinkFactories, "good")
+	defer delete(sinkFactories, "bad")
+
+	_, sinks := splitOutputPaths([]string{"good://", "bad://"})
+	if _, _, err := newSinkCores(sinks, zapcore.InfoLevel); err == nil {
+		t.Error("Got success, expecting error")
+	}
+
+	if !opened.closed {
+		t.Error("Expecting the sinks already opened to be closed")
+	}
+
+	o := NewOptions()
+	o.OutputPaths = []string{"good://", "bad://"}
+	if err := Configure(o); err == nil {
+		t.Error("Got success, expecting error")
+	}
+}
+
+func TestRegisterSink(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	closer := &testCloser{}
+
+	var opened *url.URL
+	RegisterSink("Custom", func(u *url.URL, enab zapcore.LevelEnabler) (zapcore.Core, io.Closer, error) {
+		opened = u
+		return core, closer, nil
+	})
+	defer func() {
+		sinkFactoriesMu.Lock()
+		delete(sinkFactories, "custom")
+		sinkFactoriesMu.Unlock()
+	}()
+
+	o := NewOptions()
+	o.OutputPaths = []string{"custom://host/path?x=1"}
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	Info("Hello")
+
+	if opened == nil || opened.Host != "host" || opened.Query().Get("x") != "1" {
+		t.Errorf("Got URL %v, expecting the output path", opened)
+	}
+
+	if !strings.Contains(buf.String(), `"msg":"Hello"`) {
+		t.Errorf("Got '%s', expecting the entry", buf)
+	}
+
+	configureWithoutOutput(t)
+	if !closer.closed {
+		t.Error("Expecting the sink to be closed when reconfiguring")
+	}
+}
+
+func TestFlattenFields(t *testing.T) {
+	params := flattenFields([]zapcore.Field{
+		zap.String("a", "x"),
+		zap.Strings("b", []string{"y", "z"}),
+		zap.Bool("c", true),
+	})
+
+	expected := [][2]string{{"a", "x"}, {"b", `["y","z"]`}, {"c", "true"}}
+	if !reflect.DeepEqual(params, expected) {
+		t.Errorf("Got %v, expecting %v", params, expected)
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// SinkHealth is the health of an output of the log, as returned by SinkStatus.
+type SinkHealth struct {
+	// Name is the path of the output, or the scheme and host of its URL, which leave out the
+	// credentials and settings the URL can hold.
+	Name string `json:"name"`
+
+	// Entries is the number of entries written to the output.
+	Entries uint64 `json:"entries"`
+
+	// Bytes is the number of bytes written to the output, as far as the output counts them, which
+	// the rotated files and the network collectors do. It is 0 for the other outputs.
+	Bytes uint64 `json:"bytes"`
+
+	// Errors is the number of failures to write to the output.
+	Errors uint64 `json:"errors"`
+
+	// Dropped is the number of entries dropped as the output stalled, which happens to the output
+	// files written independently of one another when there are several of them, and to the
+	// entries the outputs sending to a collector give up on, such as when it rejects them or
+	// can't take them before the output is closed.
+	Dropped uint64 `json:"dropped"`
+
+	// Failing is whether the last attempt at writing to the output failed. For the outputs sending
+	// the entries from the background, such as to a collector, it is whether the last attempt at
+	// delivering them failed.
+	Failing bool `json:"failing"`
+
+	// LastError and LastErrorTime are the last failure, if any.
+	LastError     string    `json:"lastError,omitempty"`
+	LastErrorTime time.Time `json:"lastErrorTime,omitempty"`
+}
+
+// the status of the outputs set up by the last call to Configure
+var currentSinkStats atomic.Value // []*sinkStats
+
+func init() {
+	currentSinkStats.Store([]*sinkStats(nil))
+}
+
+// sinkStats tracks the health of an output. Its methods can be called on nil, for the writers
+// which aren't tracked.
+type sinkStats struct {
+	name    string
+	entries uint64
+	bytes   uint64
+	errors  uint64
+	dropped uint64
+	failing int32
+
+	// whether the output delivers the entries from the background, and tells whether it is failing
+	// itself, set by the writers reporting the status
+	background bool
+
+	mu            sync.Mutex
+	lastError     string
+	lastErrorTime time.Time
+}
+
+func (s *sinkStats) wrote(n int) {
+	if s != nil {
+		atomic.AddUint64(&s.bytes, uint64(n))
+	}
+}
+
+func (s *sinkStats) drop(n int) {
+	if s != nil {
+		atomic.AddUint64(&s.dropped, uint64(n))
+	}
+}
+
+func (s *sinkStats) failed(err error) {
+	if s == nil {
+		return
+	}
+
+	atomic.AddUint64(&s.errors, 1)
+	atomic.StoreInt32(&s.failing, 1)
+	s.mu.Lock()
+	s.lastError, s.lastErrorTime = err.Error(), now()
+	s.mu.Unlock()
+}
+
+func (s *sinkStats) recovered() {
+	if s != nil {
+		atomic.StoreInt32(&s.failing, 0)
+	}
+}
+
+func (s *sinkStats) status() SinkHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return SinkHealth{
+		Name:          s.name,
+		Entries:       atomic.LoadUint64(&s.entries),
+		Bytes:         atomic.LoadUint64(&s.bytes),
+		Errors:        atomic.LoadUint64(&s.errors),
+		Dropped:       atomic.LoadUint64(&s.dropped),
+		Failing:       atomic.LoadInt32(&s.failing) != 0,
+		LastError:     s.lastError,
+		LastErrorTime: s.lastErrorTime,
+	}
+}
+
+// statusReporter is implemented by the writers of the outputs which report the bytes they write
+// and the errors they run into in the background. Those sending the entries from the background
+// also report when they get through again, as the entries handed over to them are yet to be
+// delivered.
+type statusReporter interface {
+	reportStatus(s *sinkStats)
+}
+
+// sinkStatusCore tracks the entries written to the output it wraps and the errors it returns.
+type sinkStatusCore struct {
+	zapcore.Core
+	stats *sinkStats
+}
+
+func newSinkStatusCore(core zapcore.Core, stats *sinkStats) zapcore.Core {
+	return &sinkStatusCore{core, stats}
+}
+
+func (c *sinkStatusCore) With(fields []zapcore.Field) zapcore.Core {
+	return &sinkStatusCore{c.Core.With(fields), c.stats}
+}
+
+func (c *sinkStatusCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *sinkStatusCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	err := c.Core.Write(ent, fields)
+	if err != nil {
+		c.stats.failed(err)
+	} else {
+		atomic.AddUint64(&c.stats.entries, 1)
+		if !c.stats.background {
+			c.stats.recovered()
+		}
+	}
+	return err
+}
+
+// SinkStatus returns the health of the outputs set up by the last call to Configure, so that a
+// broken output can be told apart from a quiet program. The outputs attached with AddCore and the
+// logger given to SetLogger aren't included.
+func SinkStatus() []SinkHealth {
+	stats := currentSinkStats.Load().([]*sinkStats)
+
+	status := make([]SinkHealth, 0, len(stats))
+	for _, s := range stats {
+		status = append(status, s.status())
+	}
+	return status
+}
+
+// SinkStatusHandler returns an HTTP handler responding with the health of the outputs returned by
+// SinkStatus in JSON, for mounting on a debug endpoint.
+//
+//		mux.Handle("/debug/log/sinks", log.SinkStatusHandler())
+func SinkStatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(SinkStatus())
+	})
+}
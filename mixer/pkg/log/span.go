@@ -0,0 +1,161 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync/atomic"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	tracelog "github.com/opentracing/opentracing-go/log"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// whether the warn and error entries of the loggers of FromContext are recorded on their span, 1
+// when they are
+var traceSpanEvents int32
+
+func setTraceSpanEvents(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&traceSpanEvents, v)
+}
+
+// FromContext returns a logger for the work of the given context. It outputs like the loggers
+// returned by Logger and follows later calls to Configure. When the context carries a request ID,
+// as set with WithRequestID or by the interceptors and middleware of the package, it is output
+// with every entry under "requestId", and the request may be sampled for its debug entries to be
+// output, as set with the DebugSamplePercentage option.
+//
+// When the context carries an OpenTracing span and the TraceSpanEvents option is set, the entries
+// at the warn level and above are also logged on the span, with their level, message, fields, and
+// stack trace, and those at the error level and above tag the span as failed. Only the entries
+// which pass the output levels are recorded.
+func FromContext(ctx context.Context) *zap.Logger {
+	l := Logger()
+	if ctx == nil {
+		return l
+	}
+
+	if id := RequestIDFromContext(ctx); id != "" {
+		if debugSampled(id) {
+			l = l.With(requestIDField(ctx), debugSampledField())
+		} else {
+			l = l.With(requestIDField(ctx))
+		}
+	}
+
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return l
+	}
+
+	return l.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &spanCore{Core: core, span: span}
+	}))
+}
+
+// spanCore records the warn and error entries passing the wrapped core on a span.
+type spanCore struct {
+	zapcore.Core
+	span   opentracing.Span
+	fields []zapcore.Field
+}
+
+func (c *spanCore) With(fields []zapcore.Field) zapcore.Core {
+	return &spanCore{
+		Core:   c.Core.With(fields),
+		span:   c.span,
+		fields: append(c.fields[:len(c.fields):len(c.fields)], fields...),
+	}
+}
+
+func (c *spanCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	ce = c.Core.Check(ent, ce)
+	if ce == nil || ent.Level < zapcore.WarnLevel || atomic.LoadInt32(&traceSpanEvents) == 0 {
+		return ce
+	}
+	return ce.AddCore(ent, spanRecorder{c})
+}
+
+// spanRecorder is the core added to the entries to be recorded on the span, which writes them to
+// the span only.
+type spanRecorder struct {
+	*spanCore
+}
+
+func (r spanRecorder) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	logFields := []tracelog.Field{
+		tracelog.String("event", ent.Level.String()),
+		tracelog.String("message", ent.Message),
+	}
+	if ent.LoggerName != "" {
+		logFields = append(logFields, tracelog.String("scope", ent.LoggerName))
+	}
+
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range r.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	keys := make([]string, 0, len(enc.Fields))
+	for k := range enc.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		logFields = append(logFields, spanField(k, enc.Fields[k]))
+	}
+
+	if ent.Stack != "" {
+		logFields = append(logFields, tracelog.String("stack", ent.Stack))
+	}
+
+	r.span.LogFields(logFields...)
+	if ent.Level >= zapcore.ErrorLevel {
+		r.span.SetTag("error", true)
+	}
+	return nil
+}
+
+func (r spanRecorder) Sync() error {
+	return nil
+}
+
+// spanField turns a field value as added to a map encoder into a span log field.
+func spanField(key string, v interface{}) tracelog.Field {
+	switch v := v.(type) {
+	case string:
+		return tracelog.String(key, v)
+	case bool:
+		return tracelog.Bool(key, v)
+	case int64:
+		return tracelog.Int64(key, v)
+	case float64:
+		return tracelog.Float64(key, v)
+	case error:
+		return tracelog.String(key, v.Error())
+	case fmt.Stringer:
+		return tracelog.String(key, v.String())
+	}
+	return tracelog.Object(key, v)
+}
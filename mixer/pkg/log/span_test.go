@@ -0,0 +1,148 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	tracelog "github.com/opentracing/opentracing-go/log"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// fakeSpan collects what is logged and tagged on it.
+type fakeSpan struct {
+	opentracing.Span
+	logs [][]tracelog.Field
+	tags map[string]interface{}
+}
+
+func (s *fakeSpan) LogFields(fields ...tracelog.Field) {
+	s.logs = append(s.logs, fields)
+}
+
+func (s *fakeSpan) SetTag(key string, value interface{}) opentracing.Span {
+	if s.tags == nil {
+		s.tags = map[string]interface{}{}
+	}
+	s.tags[key] = value
+	return s
+}
+
+// fieldMap returns the values of the given span log fields by key.
+func fieldMap(fields []tracelog.Field) map[string]interface{} {
+	m := map[string]interface{}{}
+	for _, f := range fields {
+		m[f.Key()] = f.Value()
+	}
+	return m
+}
+
+func configureTraceSpanEvents(t *testing.T, enabled bool) {
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.TraceSpanEvents = enabled
+	_ = o.SetStackTraceLevel(zapcore.ErrorLevel)
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+}
+
+func TestFromContextRecordsOnSpan(t *testing.T) {
+	configureTraceSpanEvents(t, true)
+	defer configureWithoutOutput(t)
+
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+
+	span := &fakeSpan{}
+	l := FromContext(opentracing.ContextWithSpan(context.Background(), span))
+
+	l.Info("Not recorded")
+	l.Named("dispatcher").With(zap.String("adapter", "a")).Warn("Slow check", zap.Int("attempt", 3))
+	l.Error("Check failed", zap.Error(errors.New("unavailable")))
+	l.Debug("Not output")
+
+	if n := strings.Count(buf.String(), "\n"); n != 3 {
+		t.Errorf("Got %d entries output, expecting 3", n)
+	}
+
+	if len(span.logs) != 2 {
+		t.Fatalf("Got %d span logs, expecting 2", len(span.logs))
+	}
+
+	warn := fieldMap(span.logs[0])
+	if warn["event"] != "warn" || warn["message"] != "Slow check" || warn["scope"] != "dispatcher" {
+		t.Errorf("Got %v, expecting the warn entry", warn)
+	}
+	if warn["adapter"] != "a" || warn["attempt"] != int64(3) {
+		t.Errorf("Got %v, expecting the fields of the logger and of the entry", warn)
+	}
+
+	failed := fieldMap(span.logs[1])
+	if failed["event"] != "error" || failed["error"] != "unavailable" {
+		t.Errorf("Got %v, expecting the error entry", failed)
+	}
+	if stack, _ := failed["stack"].(string); !strings.Contains(stack, "testing.tRunner") {
+		t.Errorf("Got %v, expecting the stack trace of the error entry", failed)
+	}
+
+	if span.tags["error"] != true {
+		t.Errorf("Got tags %v, expecting the span tagged as failed", span.tags)
+	}
+}
+
+func TestFromContextDisabled(t *testing.T) {
+	configureTraceSpanEvents(t, false)
+
+	span := &fakeSpan{}
+	FromContext(opentracing.ContextWithSpan(context.Background(), span)).Error("Not recorded")
+
+	if len(span.logs) != 0 || len(span.tags) != 0 {
+		t.Errorf("Got logs %v and tags %v, expecting nothing recorded on the span", span.logs, span.tags)
+	}
+}
+
+func TestFromContextWithoutSpan(t *testing.T) {
+	configureTraceSpanEvents(t, true)
+	defer configureWithoutOutput(t)
+
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+
+	FromContext(context.Background()).Error("Output")
+
+	if n := strings.Count(buf.String(), "\n"); n != 1 {
+		t.Errorf("Got %d entries, expecting 1", n)
+	}
+}
+
+func TestFromContextFiltered(t *testing.T) {
+	configureTraceSpanEvents(t, true)
+	defer configureWithoutOutput(t)
+	_ = SetScopeOutputLevel("quiet", None)
+
+	span := &fakeSpan{}
+	FromContext(opentracing.ContextWithSpan(context.Background(), span)).Named("quiet").Error("Not recorded")
+
+	if len(span.logs) != 0 {
+		t.Errorf("Got %v, expecting the entries filtered out not to be recorded", span.logs)
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Splunk output
+//
+// Entries are sent to a Splunk HTTP Event Collector when OutputPaths contains
+// splunk://host[:port]?token=... or splunk+https://host[:port]?token=..., the port defaulting
+// to 8088. Each entry becomes the JSON event of a HEC event. These query parameters are supported:
+//
+//		token        the HEC token, required
+//		index        the index the events are stored in, the token's default index otherwise
+//		source       the source of the events
+//		sourcetype   the source type of the events, _json by default
+//		gzip         whether to compress the requests, true by default
+//		insecure     whether to skip verifying the collector's certificate, false by default
+//		batch        the maximum number of entries sent at once, 500 by default
+//		flush        the maximum time an entry waits to be sent, 1s by default
+//		buffer       the maximum number of entries held while the collector is unreachable, 10000 by default
+//		timeout      the timeout of each request, 10s by default
+
+const (
+	splunkDefaultPort       = "8088"
+	splunkDefaultSourceType = "_json"
+	splunkEventPath         = "/services/collector/event"
+)
+
+var splunkDefaultBatch = batchSettings{
+	size:     500,
+	interval: time.Second,
+	buffer:   10000,
+	timeout:  10 * time.Second,
+}
+
+func init() {
+	RegisterSink("splunk", newSplunkSink)
+	RegisterSink("splunk+https", newSplunkSink)
+}
+
+// splunkEvent is the HEC representation of an entry.
+type splunkEvent struct {
+	Time       json.Number     `json:"time"`
+	Host       string          `json:"host,omitempty"`
+	Index      string          `json:"index,omitempty"`
+	Source     string          `json:"source,omitempty"`
+	SourceType string          `json:"sourcetype,omitempty"`
+	Event      json.RawMessage `json:"event"`
+}
+
+// splunkCore outputs entries to a Splunk HTTP Event Collector.
+type splunkCore struct {
+	zapcore.LevelEnabler
+
+	enc     zapcore.Encoder
+	batcher *batcher
+
+	// the metadata of each event
+	host       string
+	index      string
+	source     string
+	sourceType string
+}
+
+func newSplunkSink(u *url.URL, enab zapcore.LevelEnabler) (zapcore.Core, io.Closer, error) {
+	if u.Hostname() == "" {
+		return nil, nil, fmt.Errorf("missing splunk address in %s", u)
+	}
+
+	q := u.Query()
+	token := q.Get("token")
+	if token == "" {
+		return nil, nil, fmt.Errorf("missing splunk token in %s", u)
+	}
+
+	settings, err := parseBatchSettings(q, splunkDefaultBatch)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid splunk settings in %s: %v", u, err)
+	}
+
+	compress := true
+	if g := q.Get("gzip"); g != "" {
+		if compress, err = strconv.ParseBool(g); err != nil {
+			return nil, nil, fmt.Errorf("invalid splunk gzip setting %s: %v", g, err)
+		}
+	}
+
+	insecure := false
+	if i := q.Get("insecure"); i != "" {
+		if insecure, err = strconv.ParseBool(i); err != nil {
+			return nil, nil, fmt.Errorf("invalid splunk insecure setting %s: %v", i, err)
+		}
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = splunkDefaultPort
+	}
+
+	target := url.URL{Scheme: "http", Host: net.JoinHostPort(u.Hostname(), port), Path: splunkEventPath}
+	if u.Scheme == "splunk+https" {
+		target.Scheme = "https"
+	}
+
+	client := newSinkHTTPClient(settings.timeout, insecure)
+
+	header := http.Header{
+		"Authorization": []string{"Splunk " + token},
+		"Content-Type":  []string{"application/json"},
+	}
+
+	send := func(batch []interface{}) error {
+		var body bytes.Buffer
+		for _, e := range batch {
+			body.Write(e.([]byte))
+		}
+
+		resp, err := postBatch(client, target.String(), body.Bytes(), compress, header)
+		if err != nil {
+			return err
+		}
+		return splunkResponseError(resp)
+	}
+
+	sourceType := q.Get("sourcetype")
+	if sourceType == "" {
+		sourceType = splunkDefaultSourceType
+	}
+
+	host, _ := os.Hostname()
+
+	b := newBatcher("splunk at "+target.Host, settings, send)
+	return &splunkCore{
+		LevelEnabler: enab,
+		enc:          newJSONEncoder(sinkEncoder),
+		batcher:      b,
+		host:         host,
+		index:        q.Get("index"),
+		source:       q.Get("source"),
+		sourceType:   sourceType,
+	}, b, nil
+}
+
+// splunkResponseError reports the failures signalled in the body of a successful response.
+func splunkResponseError(resp []byte) error {
+	var status struct {
+		Text string `json:"text"`
+		Code int    `json:"code"`
+	}
+
+	if err := json.Unmarshal(resp, &status); err != nil || status.Code == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("collector responded with code %d: %s", status.Code, status.Text)
+}
+
+func (c *splunkCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.enc = c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(clone.enc)
+	}
+	return &clone
+}
+
+func (c *splunkCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *splunkCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+
+	// HEC times are in seconds, with millisecond precision
+	ms := ent.Time.UnixNano() / int64(time.Millisecond)
+	event, err := json.Marshal(&splunkEvent{
+		Time:       json.Number(fmt.Sprintf("%d.%03d", ms/1000, ms%1000)),
+		Host:       c.host,
+		Index:      c.index,
+		Source:     c.source,
+		SourceType: c.sourceType,
+		Event:      json.RawMessage(bytes.TrimRight(buf.Bytes(), "\n")),
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.batcher.enqueue(event)
+}
+
+func (c *splunkCore) Sync() error {
+	return c.batcher.sync()
+}
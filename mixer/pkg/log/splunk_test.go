@@ -0,0 +1,195 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type splunkRequest struct {
+	r      *http.Request
+	events []map[string]interface{}
+}
+
+// newFakeSplunk records the events it receives, failing the first requests with the given status codes.
+func newFakeSplunk(t *testing.T, failures ...int) (*httptest.Server, chan splunkRequest) {
+	requests := make(chan splunkRequest, 100)
+	var count int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := int(atomic.AddInt32(&count, 1)); n <= len(failures) {
+			w.WriteHeader(failures[n-1])
+			_, _ = w.Write([]byte(`{"text":"Server is busy","code":9}`))
+			return
+		}
+
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Errorf("Unable to decompress request: %v", err)
+				return
+			}
+			body = zr
+		}
+
+		req := splunkRequest{r: r}
+		for dec := json.NewDecoder(body); dec.More(); {
+			var event map[string]interface{}
+			if err := dec.Decode(&event); err != nil {
+				t.Errorf("Unable to decode event: %v", err)
+				return
+			}
+			req.events = append(req.events, event)
+		}
+
+		requests <- req
+		_, _ = w.Write([]byte(`{"text":"Success","code":0}`))
+	}))
+
+	return server, requests
+}
+
+func nextSplunkRequest(t *testing.T, requests chan splunkRequest) splunkRequest {
+	select {
+	case r := <-requests:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for splunk request")
+		return splunkRequest{}
+	}
+}
+
+func TestSplunk(t *testing.T) {
+	server, requests := newFakeSplunk(t)
+	defer server.Close()
+
+	u := strings.Replace(server.URL, "http://", "splunk://", 1) + "?token=abc&index=istio&source=mixer"
+
+	o := NewOptions()
+	o.OutputPaths = []string{u}
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	With(zap.String("pod", "mixer-1")).Info("Hello", zap.Int("count", 3))
+	Sync()
+
+	r := nextSplunkRequest(t, requests)
+
+	if r.r.URL.Path != splunkEventPath {
+		t.Errorf("Got path %s, expecting %s", r.r.URL.Path, splunkEventPath)
+	}
+
+	if auth := r.r.Header.Get("Authorization"); auth != "Splunk abc" {
+		t.Errorf("Got authorization %s, expecting Splunk abc", auth)
+	}
+
+	if enc := r.r.Header.Get("Content-Encoding"); enc != "gzip" {
+		t.Errorf("Got encoding %s, expecting gzip", enc)
+	}
+
+	if len(r.events) != 1 {
+		t.Fatalf("Got %d events, expecting 1", len(r.events))
+	}
+
+	e := r.events[0]
+	if e["index"] != "istio" || e["source"] != "mixer" || e["sourcetype"] != splunkDefaultSourceType {
+		t.Errorf("Got metadata %v, expecting index, source, and sourcetype", e)
+	}
+
+	if _, ok := e["time"].(float64); !ok {
+		t.Errorf("Got time %v, expecting a number", e["time"])
+	}
+
+	event := e["event"].(map[string]interface{})
+	if event["msg"] != "Hello" || event["count"] != float64(3) || event["pod"] != "mixer-1" {
+		t.Errorf("Got event %v, expecting the encoded entry", event)
+	}
+}
+
+func TestSplunkRetry(t *testing.T) {
+	server, requests := newFakeSplunk(t, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	u := strings.Replace(server.URL, "http://", "splunk://", 1) + "?token=abc&gzip=false"
+	core, closer, err := newSplunkSink(mustParseURL(t, u), zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = closer.Close() }()
+
+	for _, msg := range []string{"one", "two"} {
+		if err := core.Write(zapcore.Entry{Message: msg, Time: time.Unix(1, 5e8)}, nil); err != nil {
+			t.Fatalf("Got err '%v', expecting success", err)
+		}
+	}
+
+	if err := core.Sync(); err != nil {
+		t.Errorf("Got err '%v', expecting success", err)
+	}
+
+	r := nextSplunkRequest(t, requests)
+	if enc := r.r.Header.Get("Content-Encoding"); enc != "" {
+		t.Errorf("Got encoding %s, expecting none", enc)
+	}
+
+	if len(r.events) != 2 {
+		t.Fatalf("Got %d events, expecting 2", len(r.events))
+	}
+
+	if ts := r.events[0]["time"]; ts != 1.5 {
+		t.Errorf("Got time %v, expecting 1.5", ts)
+	}
+}
+
+func TestSplunkResponseError(t *testing.T) {
+	if err := splunkResponseError([]byte(`{"text":"Success","code":0}`)); err != nil {
+		t.Errorf("Got err '%v', expecting success", err)
+	}
+
+	if err := splunkResponseError([]byte(`{"text":"Invalid data format","code":6}`)); err == nil {
+		t.Error("Got success, expecting error")
+	}
+}
+
+func TestSplunkErrors(t *testing.T) {
+	cases := []string{
+		"splunk://?token=abc",
+		"splunk://localhost",
+		"splunk://localhost?token=abc&gzip=maybe",
+		"splunk://localhost?token=abc&insecure=maybe",
+		"splunk://localhost?token=abc&batch=0",
+	}
+
+	for _, c := range cases {
+		t.Run(c, func(t *testing.T) {
+			if _, _, err := newSplunkSink(mustParseURL(t, c), zapcore.InfoLevel); err == nil {
+				t.Error("Got success, expecting error")
+			}
+		})
+	}
+}
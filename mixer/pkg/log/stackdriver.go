@@ -0,0 +1,155 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// Stackdriver encoding
+//
+// The stackdriver encoding outputs JSON entries in the structured format understood by the
+// logging agent of GKE, so entries show up in Cloud Logging with the right severity, time, and
+// source location. Fields keyed trace and span are turned into the trace and span IDs Cloud Logging
+// associates the entries with, trace IDs being qualified with the project found in
+// $GOOGLE_CLOUD_PROJECT when not already qualified.
+
+const (
+	stackdriverEncoding = "stackdriver"
+
+	traceKey = "trace"
+	spanKey  = "span"
+
+	stackdriverTraceKey          = "logging.googleapis.com/trace"
+	stackdriverSpanKey           = "logging.googleapis.com/spanId"
+	stackdriverSourceLocationKey = "logging.googleapis.com/sourceLocation"
+)
+
+var stackdriverSeverities = map[zapcore.Level]string{
+	zapcore.DebugLevel:  "DEBUG",
+	zapcore.InfoLevel:   "INFO",
+	zapcore.WarnLevel:   "WARNING",
+	zapcore.ErrorLevel:  "ERROR",
+	zapcore.DPanicLevel: "CRITICAL",
+	zapcore.PanicLevel:  "ALERT",
+	zapcore.FatalLevel:  "EMERGENCY",
+}
+
+func init() {
+	registerEncoder(stackdriverEncoding, func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		return newStackdriverEncoder(os.Getenv("GOOGLE_CLOUD_PROJECT"), cfg.LineEnding), nil
+	})
+}
+
+// stackdriverEncoder wraps a JSON encoder, moving the trace, span, and caller information of
+// entries to the fields Cloud Logging recognizes.
+type stackdriverEncoder struct {
+	zapcore.Encoder
+	project string
+}
+
+func newStackdriverEncoder(project, lineEnding string) zapcore.Encoder {
+	return &stackdriverEncoder{
+		Encoder: zapcore.NewJSONEncoder(zapcore.EncoderConfig{
+			TimeKey:        "timestamp",
+			LevelKey:       "severity",
+			NameKey:        "logger",
+			MessageKey:     "message",
+			StacktraceKey:  "stack_trace",
+			LineEnding:     lineEnding,
+			EncodeLevel:    encodeStackdriverSeverity,
+			EncodeTime:     encodeStackdriverTime,
+			EncodeDuration: zapcore.StringDurationEncoder,
+		}),
+		project: project,
+	}
+}
+
+func encodeStackdriverSeverity(l zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
+	if s, ok := stackdriverSeverities[l]; ok {
+		enc.AppendString(s)
+	} else {
+		enc.AppendString("DEFAULT")
+	}
+}
+
+func encodeStackdriverTime(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
+	enc.AppendString(t.UTC().Format(time.RFC3339Nano))
+}
+
+func (e *stackdriverEncoder) Clone() zapcore.Encoder {
+	return &stackdriverEncoder{Encoder: e.Encoder.Clone(), project: e.project}
+}
+
+func (e *stackdriverEncoder) AddString(key, value string) {
+	switch key {
+	case traceKey:
+		e.Encoder.AddString(stackdriverTraceKey, e.qualifyTrace(value))
+	case spanKey:
+		e.Encoder.AddString(stackdriverSpanKey, value)
+	default:
+		e.Encoder.AddString(key, value)
+	}
+}
+
+func (e *stackdriverEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	out := make([]zapcore.Field, 0, len(fields)+1)
+	for _, f := range fields {
+		if f.Type == zapcore.StringType {
+			switch f.Key {
+			case traceKey:
+				f = zap.String(stackdriverTraceKey, e.qualifyTrace(f.String))
+			case spanKey:
+				f = zap.String(stackdriverSpanKey, f.String)
+			}
+		}
+		out = append(out, f)
+	}
+
+	if ent.Caller.Defined {
+		out = append(out, zap.Object(stackdriverSourceLocationKey, sourceLocation(ent.Caller)))
+		ent.Caller = zapcore.EntryCaller{}
+	}
+
+	return e.Encoder.EncodeEntry(ent, out)
+}
+
+// qualifyTrace turns a trace ID into the resource name Cloud Logging expects.
+func (e *stackdriverEncoder) qualifyTrace(trace string) string {
+	if e.project == "" || strings.HasPrefix(trace, "projects/") {
+		return trace
+	}
+	return "projects/" + e.project + "/traces/" + trace
+}
+
+// sourceLocation is the location in the code an entry was logged from.
+type sourceLocation zapcore.EntryCaller
+
+func (s sourceLocation) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("file", s.File)
+	enc.AddString("line", strconv.Itoa(s.Line))
+	if fn := runtime.FuncForPC(s.PC); fn != nil {
+		enc.AddString("function", fn.Name())
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"encoding/json"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestStackdriver(t *testing.T) {
+	lines, err := captureStdout(func() {
+		o := NewOptions()
+		o.Encoding = stackdriverEncoding
+		o.IncludeCallerSourceLocation = true
+		if err := Configure(o); err != nil {
+			t.Errorf("Got err '%v', expecting success", err)
+		}
+
+		Warn("Hello", zap.String("trace", "abc"), zap.String("span", "123"), zap.Int("count", 3))
+		Sync()
+	})
+	if err != nil {
+		t.Fatalf("Got error '%v', expected success", err)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("Unable to decode '%s': %v", lines[0], err)
+	}
+
+	expected := map[string]interface{}{
+		"severity":          "WARNING",
+		"message":           "Hello",
+		"count":             float64(3),
+		stackdriverTraceKey: "abc",
+		stackdriverSpanKey:  "123",
+	}
+	for k, v := range expected {
+		if entry[k] != v {
+			t.Errorf("Got %s=%v, expecting %v", k, entry[k], v)
+		}
+	}
+
+	if _, err := time.Parse(time.RFC3339Nano, entry["timestamp"].(string)); err != nil {
+		t.Errorf("Got timestamp %v, expecting RFC 3339: %v", entry["timestamp"], err)
+	}
+
+	if _, ok := entry["caller"]; ok {
+		t.Error("Got a caller field, expecting the source location only")
+	}
+
+	loc, ok := entry[stackdriverSourceLocationKey].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Got %v, expecting a source location", entry)
+	}
+
+	if !strings.HasSuffix(loc["file"].(string), "stackdriver_test.go") || loc["line"] == "" ||
+		!strings.HasSuffix(loc["function"].(string), "TestStackdriver.func1") {
+		t.Errorf("Got source location %v, expecting this test", loc)
+	}
+}
+
+func TestStackdriverTrace(t *testing.T) {
+	enc := newStackdriverEncoder("my-project", zapcore.DefaultLineEnding)
+	enc.AddString("trace", "abc")
+
+	buf, err := enc.EncodeEntry(zapcore.Entry{Level: zapcore.ErrorLevel}, []zapcore.Field{
+		zap.String("span", "123"),
+		zap.String("other", "projects/p/traces/def"),
+	})
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Unable to decode '%s': %v", buf, err)
+	}
+
+	if trace := entry[stackdriverTraceKey]; trace != "projects/my-project/traces/abc" {
+		t.Errorf("Got trace %v, expecting it qualified with the project", trace)
+	}
+
+	if entry["severity"] != "ERROR" || entry[stackdriverSpanKey] != "123" || entry["other"] != "projects/p/traces/def" {
+		t.Errorf("Got %v, expecting the span and other fields unchanged", entry)
+	}
+
+	if trace := enc.(*stackdriverEncoder).qualifyTrace("projects/p/traces/def"); trace != "projects/p/traces/def" {
+		t.Errorf("Got %s, expecting qualified traces to be left alone", trace)
+	}
+}
+
+func TestStackdriverSeverity(t *testing.T) {
+	for l, expected := range stackdriverSeverities {
+		enc := newStackdriverEncoder("", zapcore.DefaultLineEnding)
+		buf, _ := enc.EncodeEntry(zapcore.Entry{Level: l}, nil)
+		if !strings.Contains(buf.String(), `"severity":"`+expected+`"`) {
+			t.Errorf("Got %s for %v, expecting %s", buf, l, expected)
+		}
+	}
+}
+
+func TestSourceLocationFunction(t *testing.T) {
+	pc, file, line, _ := runtime.Caller(0)
+	enc := zapcore.NewMapObjectEncoder()
+	_ = sourceLocation(zapcore.NewEntryCaller(pc, file, line, true)).MarshalLogObject(enc)
+
+	if fn := enc.Fields["function"]; !strings.HasSuffix(fn.(string), "TestSourceLocationFunction") {
+		t.Errorf("Got function %v, expecting this test", fn)
+	}
+}
+
+func TestUnknownEncoding(t *testing.T) {
+	o := NewOptions()
+	o.Encoding = "xml"
+	if err := Configure(o); err == nil {
+		t.Errorf("Got success, expecting failure")
+	}
+}
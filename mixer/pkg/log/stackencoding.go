@@ -0,0 +1,102 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Settings of Options.StackTraceEncoding.
+const (
+	stackMultiline = "multiline"
+	stackEscaped   = "escaped"
+	stackFrames    = "frames"
+)
+
+// checkStackTraceEncoding verifies that the stack trace encoding is one of those supported.
+func checkStackTraceEncoding(encoding string) error {
+	switch encoding {
+	case "", stackMultiline, stackEscaped, stackFrames:
+		return nil
+	}
+	return fmt.Errorf("unknown stack trace encoding: %s", encoding)
+}
+
+// stackEncodingCore turns the stack traces of the entries into a field of theirs, so that the
+// console encoding doesn't output them over lines of their own: a string with its line breaks
+// escaped, or an array of frames.
+type stackEncodingCore struct {
+	zapcore.Core
+	key    string
+	frames bool
+}
+
+func newStackEncodingCore(core zapcore.Core, key string, encoding string) zapcore.Core {
+	return &stackEncodingCore{Core: core, key: key, frames: encoding == stackFrames}
+}
+
+func (c *stackEncodingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &stackEncodingCore{c.Core.With(fields), c.key, c.frames}
+}
+
+func (c *stackEncodingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *stackEncodingCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if ent.Stack == "" {
+		return c.Core.Write(ent, fields)
+	}
+
+	stack := ent.Stack
+	ent.Stack = ""
+
+	// an empty key leaves the stack traces out, as it does with the encoders
+	if c.key == "" {
+		return c.Core.Write(ent, fields)
+	}
+
+	f := zap.String(c.key, stack)
+	if c.frames {
+		f = zap.Array(c.key, stackFrameArray(parseStack(stack)))
+	}
+	return c.Core.Write(ent, append(fields[:len(fields):len(fields)], f))
+}
+
+// stackFrameArray encodes the frames of a stack trace as objects with the function, file, and
+// line of each.
+type stackFrameArray []stackFrame
+
+func (a stackFrameArray) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, f := range a {
+		if err := enc.AppendObject(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f stackFrame) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("function", f.function)
+	enc.AddString("file", f.file)
+	enc.AddInt("line", f.line)
+	return nil
+}
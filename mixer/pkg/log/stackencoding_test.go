@@ -0,0 +1,96 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestStackTraceEncoding(t *testing.T) {
+	cases := []struct {
+		encoding string
+		lines    int
+		field    string
+	}{
+		{"", 0, ""},
+		{"multiline", 0, ""},
+		{"escaped", 1, `"stack": "testing.tRunner\n\t`},
+		{"frames", 1, `"stack": [{"function": "testing.tRunner", "file": "`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.encoding, func(t *testing.T) {
+			lines, err := captureStdout(func() {
+				o := NewOptions()
+				o.AuditOutputPaths = nil
+				o.ConsoleEscaping = "never"
+				o.StackTraceEncoding = c.encoding
+				_ = o.SetStackTraceLevel(zapcore.ErrorLevel)
+				if err := Configure(o); err != nil {
+					t.Fatalf("Got err '%v', expecting success", err)
+				}
+
+				Error("Unable to dispatch", zap.String("adapter", "a"))
+				Sync()
+			})
+			configureWithoutOutput(t)
+			if err != nil {
+				t.Fatalf("Got error '%v', expected success", err)
+			}
+
+			if c.lines == 0 {
+				if len(lines) < 2 || !strings.Contains(lines[1], "testing.tRunner") {
+					t.Errorf("Got '%v', expecting the stack trace on lines of its own", lines)
+				}
+				return
+			}
+
+			// the output ends with a line break
+			if len(lines) != c.lines+1 {
+				t.Fatalf("Got '%v', expecting %d line", lines, c.lines)
+			}
+			if !strings.Contains(lines[0], `{"adapter": "a", `+c.field) {
+				t.Errorf("Got '%s', expecting it to contain '%s'", lines[0], c.field)
+			}
+		})
+	}
+}
+
+func TestStackTraceEncodingWithoutKey(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	c := newStackEncodingCore(core, "", stackEscaped)
+
+	if err := c.Write(zapcore.Entry{Message: "Unable to dispatch", Stack: "main.main\n\t/main.go:1"}, nil); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	if strings.Contains(buf.String(), "main.go") {
+		t.Errorf("Got '%s', expecting the stack trace left out", buf.String())
+	}
+}
+
+func TestCheckStackTraceEncoding(t *testing.T) {
+	for _, e := range []string{"", "multiline", "escaped", "frames"} {
+		if err := checkStackTraceEncoding(e); err != nil {
+			t.Errorf("Got err '%v', expecting %s to be supported", err, e)
+		}
+	}
+	if err := checkStackTraceEncoding("flat"); err == nil {
+		t.Error("Got success, expecting an error")
+	}
+}
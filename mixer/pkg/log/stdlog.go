@@ -0,0 +1,102 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// DefaultStdLogScope is the scope to which Options.StdLogScope can route the output of the standard
+// "log" package, so that its level can be set apart from that of the default scope.
+const DefaultStdLogScope = "stdlog"
+
+// the calls between the code using the standard logger and the check of stdLogWriter: the write
+// itself, log.Output, and the function of the standard logger called
+const stdLogCallerSkip = 3
+
+// stdLogLevels are the level prefixes of the lines of the standard logger, as written by
+// third-party libraries, along with the levels they stand for.
+var stdLogLevels = map[string]zapcore.Level{
+	"trace":   zapcore.DebugLevel,
+	"debug":   zapcore.DebugLevel,
+	"info":    zapcore.InfoLevel,
+	"notice":  zapcore.InfoLevel,
+	"warn":    zapcore.WarnLevel,
+	"warning": zapcore.WarnLevel,
+	"err":     zapcore.ErrorLevel,
+	"error":   zapcore.ErrorLevel,
+	"crit":    zapcore.ErrorLevel,
+	"fatal":   zapcore.ErrorLevel,
+}
+
+// parseStdLogLevel returns the level of the given line of the standard logger, given by a prefix
+// such as [ERROR] or [warn], along with the rest of the line. The lines without one are at the
+// given level.
+func parseStdLogLevel(line string, level zapcore.Level) (zapcore.Level, string) {
+	if !strings.HasPrefix(line, "[") {
+		return level, line
+	}
+
+	end := strings.IndexByte(line, ']')
+	if end < 0 {
+		return level, line
+	}
+
+	l, ok := stdLogLevels[strings.ToLower(line[1:end])]
+	if !ok {
+		return level, line
+	}
+	return l, strings.TrimLeft(line[end+1:], " :")
+}
+
+// stdLogWriter outputs the lines of the standard logger to a logger, at the levels of their
+// prefixes.
+type stdLogWriter struct {
+	logger *zap.Logger
+	level  zapcore.Level
+}
+
+func (w *stdLogWriter) Write(p []byte) (int, error) {
+	level, msg := parseStdLogLevel(strings.TrimSuffix(string(p), "\n"), w.level)
+	if ce := w.logger.Check(level, msg); ce != nil {
+		ce.Write()
+	}
+	return len(p), nil
+}
+
+// redirectStdLog makes the standard logger output to the given logger, under the given scope
+// unless empty, and returns a function putting back its settings. Like with zap.RedirectStdLog,
+// the standard logger then outputs to stderr.
+func redirectStdLog(l *zap.Logger, scope string, level zapcore.Level) func() {
+	if scope != "" {
+		l = l.Named(scope)
+	}
+
+	flags, prefix := log.Flags(), log.Prefix()
+	log.SetFlags(0)
+	log.SetPrefix("")
+	log.SetOutput(&stdLogWriter{l.WithOptions(zap.AddCallerSkip(stdLogCallerSkip)), level})
+
+	return func() {
+		log.SetFlags(flags)
+		log.SetPrefix(prefix)
+		log.SetOutput(os.Stderr)
+	}
+}
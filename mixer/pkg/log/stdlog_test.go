@@ -0,0 +1,84 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestParseStdLogLevel(t *testing.T) {
+	cases := []struct {
+		line    string
+		level   zapcore.Level
+		message string
+	}{
+		{"Listening on :9091", zapcore.InfoLevel, "Listening on :9091"},
+		{"[ERROR] connection reset", zapcore.ErrorLevel, "connection reset"},
+		{"[warn]: retrying", zapcore.WarnLevel, "retrying"},
+		{"[Debug]", zapcore.DebugLevel, ""},
+		{"[dispatcher] started", zapcore.InfoLevel, "[dispatcher] started"},
+		{"[ERROR connection reset", zapcore.InfoLevel, "[ERROR connection reset"},
+	}
+
+	for _, c := range cases {
+		level, message := parseStdLogLevel(c.line, zapcore.InfoLevel)
+		if level != c.level || message != c.message {
+			t.Errorf("Got %v and '%s', expecting %v and '%s' for '%s'", level, message, c.level, c.message, c.line)
+		}
+	}
+}
+
+func TestStdLogScope(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	defer configureWithoutOutput(t)
+
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.IncludeCallerSourceLocation = true
+	o.StdLogScope = DefaultStdLogScope
+	o.StdLogLevel = "debug"
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	log.Println("Not output")
+	log.Printf("[ERROR] Unable to connect to %s", "localhost:9091")
+
+	if err := SetScopeOutputLevel(DefaultStdLogScope, zapcore.DebugLevel); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	log.Println("Connected")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	patterns := []string{
+		`^{"level":"error","logger":"stdlog","caller":"log/stdlog_test.go:.*","msg":"Unable to connect to localhost:9091"}$`,
+		`^{"level":"debug","logger":"stdlog","caller":"log/stdlog_test.go:.*","msg":"Connected"}$`,
+	}
+	if len(lines) != len(patterns) {
+		t.Fatalf("Got '%v', expecting %d entries", lines, len(patterns))
+	}
+	for i, pat := range patterns {
+		if match, _ := regexp.MatchString(pat, lines[i]); !match {
+			t.Errorf("Got '%s', expecting to match '%s'", lines[i], pat)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Syslog output
+//
+// Entries are sent to syslog in the RFC 5424 format when OutputPaths contains one of these URLs:
+//
+//		syslog://                  the local syslog daemon, through /dev/log
+//		syslog:///path/to/socket   the local syslog daemon, through the given socket
+//		syslog+udp://host[:port]   a remote syslog server over UDP, port 514 by default
+//		syslog+tcp://host[:port]   a remote syslog server over TCP, port 514 by default
+//		syslog+tls://host[:port]   a remote syslog server over TLS, port 6514 by default
+//
+// The facility and the application name reported can be set with the facility and app query
+// parameters, for example syslog+udp://loghost?facility=local0&app=mixer. The logger name is
+// reported as the message ID and structured fields are output as structured data parameters.
+
+const (
+	syslogDefaultPort    = "514"
+	syslogDefaultTLSPort = "6514"
+
+	// The SD-ID for structured fields. 32473 is the private enterprise number reserved for documentation.
+	syslogSDID = "fields@32473"
+)
+
+var syslogLocalSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+var syslogFacilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+func init() {
+	RegisterSink("syslog", newSyslogSink)
+	RegisterSink("syslog+udp", newSyslogSink)
+	RegisterSink("syslog+tcp", newSyslogSink)
+	RegisterSink("syslog+tls", newSyslogSink)
+}
+
+// syslogSeverity maps a zap level to a syslog severity.
+func syslogSeverity(l zapcore.Level) int {
+	switch l {
+	case zapcore.DebugLevel:
+		return 7 // debug
+	case zapcore.InfoLevel:
+		return 6 // informational
+	case zapcore.WarnLevel:
+		return 4 // warning
+	case zapcore.ErrorLevel:
+		return 3 // error
+	case zapcore.DPanicLevel:
+		return 2 // critical
+	case zapcore.PanicLevel:
+		return 1 // alert
+	default:
+		return 0 // emergency
+	}
+}
+
+// syslogConn is a connection to a syslog daemon or server, which is re-established if a write fails.
+type syslogConn struct {
+	mu      sync.Mutex
+	network string
+	addrs   []string
+	framed  bool
+	tls     *tls.Config
+	conn    net.Conn
+}
+
+func (c *syslogConn) dialLocked() error {
+	var err error
+	for _, addr := range c.addrs {
+		if c.conn, err = dialSink(c.network, addr, 0, c.tls); err == nil {
+			return nil
+		}
+
+		// some daemons only listen on stream sockets
+		if c.network == "unixgram" {
+			if c.conn, err = net.Dial("unix", addr); err == nil {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("unable to connect to %s: %v", strings.Join(c.addrs, ", "), err)
+}
+
+func (c *syslogConn) write(msg []byte) error {
+	if c.framed {
+		// octet counting, as per RFC 6587
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != nil {
+		if _, err := c.conn.Write(msg); err == nil {
+			return nil
+		}
+		_ = c.conn.Close()
+		c.conn = nil
+	}
+
+	if err := c.dialLocked(); err != nil {
+		return err
+	}
+
+	_, err := c.conn.Write(msg)
+	return err
+}
+
+func (c *syslogConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// syslogCore outputs entries to syslog.
+type syslogCore struct {
+	zapcore.LevelEnabler
+
+	conn     *syslogConn
+	facility int
+	hostname string
+	app      string
+	pid      string
+	fields   []zapcore.Field
+}
+
+func newSyslogSink(u *url.URL, enab zapcore.LevelEnabler) (zapcore.Core, io.Closer, error) {
+	c := &syslogCore{
+		LevelEnabler: enab,
+		conn:         &syslogConn{},
+		facility:     syslogFacilities["user"],
+		hostname:     "-",
+		app:          syslogName(filepath.Base(os.Args[0]), 48),
+		pid:          strconv.Itoa(os.Getpid()),
+	}
+
+	if h, err := os.Hostname(); err == nil {
+		c.hostname = syslogName(h, 255)
+	}
+
+	q := u.Query()
+	if f := q.Get("facility"); f != "" {
+		var ok bool
+		if c.facility, ok = syslogFacilities[strings.ToLower(f)]; !ok {
+			return nil, nil, fmt.Errorf("unknown syslog facility %s", f)
+		}
+	}
+
+	if a := q.Get("app"); a != "" {
+		c.app = syslogName(a, 48)
+	}
+
+	switch u.Scheme {
+	case "syslog":
+		c.conn.network = "unixgram"
+		c.conn.addrs = syslogLocalSockets
+		if u.Path != "" {
+			c.conn.addrs = []string{u.Path}
+		}
+
+	case "syslog+udp", "syslog+tcp", "syslog+tls":
+		if u.Hostname() == "" {
+			return nil, nil, fmt.Errorf("missing syslog server address in %s", u)
+		}
+
+		port := u.Port()
+		c.conn.network = strings.TrimPrefix(u.Scheme, "syslog+")
+		if c.conn.network == "tls" {
+			// as per RFC 5425
+			c.conn.network = "tcp"
+			c.conn.tls = sinkTLSConfig()
+			if port == "" {
+				port = syslogDefaultTLSPort
+			}
+		}
+		if port == "" {
+			port = syslogDefaultPort
+		}
+
+		c.conn.addrs = []string{net.JoinHostPort(u.Hostname(), port)}
+		c.conn.framed = c.conn.network == "tcp"
+	}
+
+	c.conn.mu.Lock()
+	err := c.conn.dialLocked()
+	c.conn.mu.Unlock()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c, c.conn, nil
+}
+
+func (c *syslogCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	clone.fields = append(append(clone.fields, c.fields...), fields...)
+	return &clone
+}
+
+func (c *syslogCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *syslogCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.conn.write(c.format(ent, fields))
+}
+
+func (c *syslogCore) Sync() error {
+	return nil
+}
+
+// format produces the RFC 5424 representation of an entry.
+func (c *syslogCore) format(ent zapcore.Entry, fields []zapcore.Field) []byte {
+	var buf bytes.Buffer
+
+	msgID := "-"
+	if ent.LoggerName != "" {
+		msgID = syslogName(ent.LoggerName, 32)
+	}
+
+	fmt.Fprintf(&buf, "<%d>1 %s %s %s %s %s ",
+		c.facility*8+syslogSeverity(ent.Level),
+		ent.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		c.hostname, c.app, c.pid, msgID)
+
+	params := flattenFields(append(c.fields[:len(c.fields):len(c.fields)], fields...))
+	if ent.Caller.Defined {
+		params = append(params, [2]string{"caller", ent.Caller.TrimmedPath()})
+	}
+
+	if len(params) == 0 {
+		buf.WriteByte('-')
+	} else {
+		buf.WriteString("[" + syslogSDID)
+		for _, p := range params {
+			buf.WriteString(" " + syslogParamName(p[0]) + `="` + syslogParamValue(p[1]) + `"`)
+		}
+		buf.WriteByte(']')
+	}
+
+	buf.WriteString(" " + ent.Message)
+	if ent.Stack != "" {
+		buf.WriteString("\n" + ent.Stack)
+	}
+
+	return buf.Bytes()
+}
+
+// syslogName restricts a header field to printable ASCII characters and to the given length.
+func syslogName(s string, max int) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(b) < max; i++ {
+		if s[i] > ' ' && s[i] < 127 {
+			b = append(b, s[i])
+		}
+	}
+
+	if len(b) == 0 {
+		return "-"
+	}
+	return string(b)
+}
+
+// syslogParamName makes a field key a valid structured data parameter name.
+func syslogParamName(s string) string {
+	b := []byte(syslogName(s, 32))
+	for i, ch := range b {
+		if ch == '=' || ch == ']' || ch == '"' {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+var syslogParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// syslogParamValue escapes the characters which are special within structured data parameter values.
+func syslogParamValue(s string) string {
+	return syslogParamEscaper.Replace(s)
+}
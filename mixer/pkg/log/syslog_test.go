@@ -0,0 +1,189 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSyslogUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	o := NewOptions()
+	o.OutputPaths = []string{"syslog+udp://" + conn.LocalAddr().String() + "?facility=local0&app=mixer"}
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	Warn("Hello", zap.String("user", `bob "the" [builder]`), zap.Int("count", 3))
+	Sync()
+
+	buf := make([]byte, 2048)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Unable to read syslog message: %v", err)
+	}
+
+	pat := `^<132>1 \S+ \S+ mixer ` + strconv.Itoa(os.Getpid()) + ` - \[fields@32473 user="bob \\"the\\" \[builder\\]" count="3"\] Hello$`
+	if match, _ := regexp.MatchString(pat, string(buf[:n])); !match {
+		t.Errorf("Got '%s', expecting to match '%s'", buf[:n], pat)
+	}
+}
+
+func TestSyslogTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer func() { _ = l.Close() }()
+
+	received := make(chan string, 2)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = c.Close() }()
+
+		r := bufio.NewReader(c)
+		for i := 0; i < 2; i++ {
+			length, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(length))
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(r, msg); err != nil {
+				return
+			}
+			received <- string(msg)
+		}
+	}()
+
+	o := NewOptions()
+	o.OutputPaths = []string{"syslog+tcp://" + l.Addr().String()}
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	Info("First")
+	Error("Second")
+
+	for _, pat := range []string{`^<14>1 .* - - First$`, `^<11>1 .* - - Second$`} {
+		select {
+		case msg := <-received:
+			if match, _ := regexp.MatchString(pat, msg); !match {
+				t.Errorf("Got '%s', expecting to match '%s'", msg, pat)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for syslog message")
+		}
+	}
+}
+
+func TestSyslogLocal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_test")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	path := filepath.Join(dir, "log.sock")
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Skipf("Unix datagram sockets unavailable: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	u := "syslog://" + path
+	core, closer, err := newSyslogSink(mustParseURL(t, u), zapcore.DebugLevel)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = closer.Close() }()
+
+	l := zap.New(core).Named("adapters").With(zap.String("adapter", "denier"))
+	l.Debug("Hello")
+
+	buf := make([]byte, 2048)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Unable to read syslog message: %v", err)
+	}
+
+	pat := `^<15>1 .* adapters \[fields@32473 adapter="denier"\] Hello$`
+	if match, _ := regexp.MatchString(pat, string(buf[:n])); !match {
+		t.Errorf("Got '%s', expecting to match '%s'", buf[:n], pat)
+	}
+}
+
+func TestSyslogErrors(t *testing.T) {
+	cases := []string{
+		"syslog+udp://127.0.0.1?facility=bogus",
+		"syslog+udp://",
+		"syslog:///nonexistent/log.sock",
+	}
+
+	for _, c := range cases {
+		t.Run(c, func(t *testing.T) {
+			if _, _, err := newSyslogSink(mustParseURL(t, c), zapcore.InfoLevel); err == nil {
+				t.Error("Got success, expecting error")
+			}
+		})
+	}
+}
+
+func TestSyslogSeverity(t *testing.T) {
+	cases := map[zapcore.Level]int{
+		zapcore.DebugLevel:  7,
+		zapcore.InfoLevel:   6,
+		zapcore.WarnLevel:   4,
+		zapcore.ErrorLevel:  3,
+		zapcore.DPanicLevel: 2,
+		zapcore.PanicLevel:  1,
+		zapcore.FatalLevel:  0,
+	}
+
+	for level, expected := range cases {
+		if s := syslogSeverity(level); s != expected {
+			t.Errorf("Got severity %d for %v, expecting %d", s, level, expected)
+		}
+	}
+}
+
+func TestSyslogParamName(t *testing.T) {
+	if n := syslogParamName(`bad key="]`); n != "badkey___" {
+		t.Errorf("Got '%s', expecting 'badkey___'", n)
+	}
+}
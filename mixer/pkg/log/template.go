@@ -0,0 +1,176 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Template is an entry prepared with Prepare, for the code logging the same entry over and over
+// with different values, such as the report path of Mixer. Its message and the keys and types of
+// its fields are set once, and the fields added with With are encoded once per call to Configure
+// rather than for every entry. Templates are safe for concurrent use.
+type Template struct {
+	msg string
+
+	// the fields taking the values given when logging, and those with values of their own
+	variable []zapcore.Field
+	constant []zapcore.Field
+
+	// the logger of the package-level functions along with the constant fields, for the loggers
+	// it was derived from
+	cache atomic.Value // *templateCache
+}
+
+type templateCache struct {
+	loggers *loggers
+	logger  *zap.Logger
+}
+
+// Prepare returns a template of the entries with the given message and fields, whose values are
+// given when logging them, in the same order. The values of the fields given here are only
+// placeholders, which set the types of the fields.
+//
+//		var dispatched = log.Prepare("dispatch complete", log.String("adapter", ""), log.Duration("latency", 0))
+//
+//		dispatched.Info(adapter, time.Since(start))
+func Prepare(msg string, fields ...zapcore.Field) *Template {
+	return &Template{msg: msg, variable: fields}
+}
+
+// With returns a template adding the given fields to the entries of this one, with the values
+// given here.
+func (t *Template) With(fields ...zapcore.Field) *Template {
+	return &Template{
+		msg:      t.msg,
+		variable: t.variable,
+		constant: append(t.constant[:len(t.constant):len(t.constant)], fields...),
+	}
+}
+
+// logger returns the logger of the package-level functions with the constant fields added.
+func (t *Template) logger() *zap.Logger {
+	l := currentLoggers.Load().(*loggers)
+	if cache, ok := t.cache.Load().(*templateCache); ok && cache.loggers == l {
+		return cache.logger
+	}
+
+	// skip the methods of the template, as for the package-level functions
+	logger := l.logger.WithOptions(zap.AddCallerSkip(1))
+	if len(t.constant) > 0 {
+		logger = logger.With(t.constant...)
+	}
+	t.cache.Store(&templateCache{l, logger})
+	return logger
+}
+
+// log outputs the entry at the given level, with the given values, unless the level is disabled.
+// The fields are only built once the entry is known to be output, in a slice of their own as the
+// cores may hold on to them.
+func (t *Template) log(level zapcore.Level, values []interface{}) {
+	ce := t.logger().Check(level, t.msg)
+	if ce == nil {
+		return
+	}
+
+	fields := make([]zapcore.Field, len(t.variable))
+	for i, f := range t.variable {
+		if i < len(values) {
+			f = fillField(f, values[i])
+		}
+		fields[i] = f
+	}
+	ce.Write(fields...)
+}
+
+// fillField returns the given field with the given value, which falls back to zap.Any when it
+// doesn't match the type of the field.
+func fillField(f zapcore.Field, v interface{}) zapcore.Field {
+	switch f.Type {
+	case zapcore.StringType:
+		if s, ok := v.(string); ok {
+			f.String = s
+			return f
+		}
+	case zapcore.BoolType:
+		if b, ok := v.(bool); ok {
+			f.Integer = 0
+			if b {
+				f.Integer = 1
+			}
+			return f
+		}
+	case zapcore.DurationType:
+		if d, ok := v.(time.Duration); ok {
+			f.Integer = int64(d)
+			return f
+		}
+	case zapcore.Int64Type, zapcore.Int32Type, zapcore.Int16Type, zapcore.Int8Type:
+		switch n := v.(type) {
+		case int:
+			f.Integer = int64(n)
+			return f
+		case int64:
+			f.Integer = n
+			return f
+		case int32:
+			f.Integer = int64(n)
+			return f
+		}
+	case zapcore.Uint64Type, zapcore.Uint32Type, zapcore.Uint16Type, zapcore.Uint8Type:
+		switch n := v.(type) {
+		case uint:
+			f.Integer = int64(n)
+			return f
+		case uint64:
+			f.Integer = int64(n)
+			return f
+		case uint32:
+			f.Integer = int64(n)
+			return f
+		}
+	case zapcore.Float64Type:
+		if x, ok := v.(float64); ok {
+			f.Integer = int64(math.Float64bits(x))
+			return f
+		}
+	}
+	return zap.Any(f.Key, v)
+}
+
+// Debug outputs the entry at debug level, with the given values of its fields.
+func (t *Template) Debug(values ...interface{}) {
+	t.log(zapcore.DebugLevel, values)
+}
+
+// Info outputs the entry at info level, with the given values of its fields.
+func (t *Template) Info(values ...interface{}) {
+	t.log(zapcore.InfoLevel, values)
+}
+
+// Warn outputs the entry at warn level, with the given values of its fields.
+func (t *Template) Warn(values ...interface{}) {
+	t.log(zapcore.WarnLevel, values)
+}
+
+// Error outputs the entry at error level, with the given values of its fields.
+func (t *Template) Error(values ...interface{}) {
+	t.log(zapcore.ErrorLevel, values)
+}
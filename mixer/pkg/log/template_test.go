@@ -0,0 +1,75 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestTemplate(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	defer configureWithoutOutput(t)
+
+	// templates prepared ahead of Configure follow it
+	dispatched := Prepare("dispatch complete", String("adapter", ""), Duration("latency", 0), Int("attempts", 0))
+	reported := dispatched.With(String("method", "report"))
+
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.IncludeCallerSourceLocation = true
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	dispatched.Debug("prometheus", time.Second, 1)
+	dispatched.Info("prometheus", 2*time.Millisecond, 1)
+	reported.Warn("stackdriver", time.Second)
+	reported.Error("denier", "slow", 3, "ignored")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	patterns := []string{
+		`^{"level":"info","caller":"log/template_test.go:.*","msg":"dispatch complete","adapter":"prometheus","latency":"2ms","attempts":1}$`,
+		`^{"level":"warn","caller":"log/template_test.go:.*","msg":"dispatch complete","method":"report","adapter":"stackdriver","latency":"1s","attempts":0}$`,
+		`^{"level":"error","caller":"log/template_test.go:.*","msg":"dispatch complete","method":"report","adapter":"denier","latency":"slow","attempts":3}$`,
+	}
+	if len(lines) != len(patterns) {
+		t.Fatalf("Got '%v', expecting %d entries", lines, len(patterns))
+	}
+	for i, pat := range patterns {
+		if match, _ := regexp.MatchString(pat, lines[i]); !match {
+			t.Errorf("Got '%s', expecting to match '%s'", lines[i], pat)
+		}
+	}
+}
+
+func BenchmarkTemplate(b *testing.B) {
+	core, _ := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	configureWithoutOutput(b)
+
+	dispatched := Prepare("dispatch complete", String("adapter", ""), Duration("latency", 0)).With(String("method", "report"))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dispatched.Info("prometheus", time.Millisecond)
+	}
+}
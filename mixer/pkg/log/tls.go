@@ -0,0 +1,174 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLS
+//
+// The sinks sending the log over the network use TLS when given a URL with one of these schemes:
+// syslog+tls, tcp+tls, fluentd+tls, elasticsearch+https, loki+https, and splunk+https. Their
+// connections are set up according to the TLS options: the certificate authorities trusted, the
+// client certificate presented for mutual TLS, the server name expected, and the minimum version.
+// The client certificate is loaded again whenever its files change, so that rotated certificates,
+// such as the workload certificates provisioned by Istio, are picked up without reconfiguring.
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+}
+
+// The TLS settings of the sinks opened by the last call to Configure, nil when there are none.
+var sinkTLS *tls.Config
+
+// newTLSConfig produces the TLS settings described by the options, returning nil if the options
+// don't set any.
+func newTLSConfig(o *Options) (*tls.Config, error) {
+	if o.TLSCAFile == "" && o.TLSCertFile == "" && o.TLSKeyFile == "" && o.TLSServerName == "" && o.TLSMinVersion == "" {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		ServerName: o.TLSServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if o.TLSMinVersion != "" {
+		v, ok := tlsVersions[o.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS version: %s", o.TLSMinVersion)
+		}
+		cfg.MinVersion = v
+	}
+
+	if o.TLSCAFile != "" {
+		pem, err := ioutil.ReadFile(o.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read TLS CA bundle: %v", err)
+		}
+
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in TLS CA bundle %s", o.TLSCAFile)
+		}
+	}
+
+	if (o.TLSCertFile == "") != (o.TLSKeyFile == "") {
+		return nil, errors.New("a TLS client certificate requires both a certificate and a key")
+	}
+
+	if o.TLSCertFile != "" {
+		r := &certReloader{certFile: o.TLSCertFile, keyFile: o.TLSKeyFile}
+		if _, err := r.certificate(); err != nil {
+			return nil, err
+		}
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return r.certificate()
+		}
+	}
+
+	return cfg, nil
+}
+
+// certReloader loads a key pair, loading it again when either file has been modified.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func (r *certReloader) certificate() (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTime, err := latestModTime(r.certFile, r.keyFile)
+	if err == nil && r.cert != nil && !modTime.After(r.modTime) {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			// the files may be halfway through being replaced, stick with what we have
+			return r.cert, nil
+		}
+		return nil, fmt.Errorf("unable to load TLS client certificate: %v", err)
+	}
+
+	r.cert, r.modTime = &cert, modTime
+	return r.cert, nil
+}
+
+func latestModTime(paths ...string) (time.Time, error) {
+	var latest time.Time
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return latest, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// sinkTLSConfig returns the TLS settings for a sink connection. The server name defaults to the
+// host the sink connects to.
+func sinkTLSConfig() *tls.Config {
+	if sinkTLS == nil {
+		return &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return sinkTLS.Clone()
+}
+
+// dialSink connects to addr, over TLS when given TLS settings.
+func dialSink(network string, addr string, timeout time.Duration, tlsConfig *tls.Config) (net.Conn, error) {
+	d := &net.Dialer{Timeout: timeout}
+	if tlsConfig == nil {
+		return d.Dial(network, addr)
+	}
+	return tls.DialWithDialer(d, network, addr, tlsConfig)
+}
+
+// newSinkHTTPClient returns the client used by the sinks sending the log over HTTP. When insecure
+// is set, the certificate of the server isn't verified.
+func newSinkHTTPClient(timeout time.Duration, insecure bool) *http.Client {
+	client := &http.Client{Timeout: timeout}
+	if sinkTLS != nil || insecure {
+		tlsConfig := sinkTLSConfig()
+		tlsConfig.InsecureSkipVerify = insecure
+		client.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		}
+	}
+	return client
+}
@@ -0,0 +1,431 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// testPKI is a certificate authority along with the certificates it issued, written to a directory.
+type testPKI struct {
+	dir    string
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	caFile string
+	serial int64
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	dir, err := ioutil.TempDir("", "logtls")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+
+	p := &testPKI{dir: dir, caFile: filepath.Join(dir, "root-cert.pem")}
+	p.caKey, p.ca = p.issue(t, "root", nil, nil)
+	p.write(t, p.caFile, "CERTIFICATE", p.ca.Raw)
+	return p
+}
+
+func (p *testPKI) cleanup() {
+	_ = os.RemoveAll(p.dir)
+}
+
+// issue creates a key and a certificate for it, self-signed when parent is nil.
+func (p *testPKI) issue(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*ecdsa.PrivateKey, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %v", err)
+	}
+
+	p.serial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(p.serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{cn},
+	}
+
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		parent, parentKey = tmpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("Unable to create certificate: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Unable to parse certificate: %v", err)
+	}
+	return key, cert
+}
+
+// issueFiles issues a certificate and writes it along with its key, returning the paths.
+func (p *testPKI) issueFiles(t *testing.T, cn string) (string, string) {
+	key, cert := p.issue(t, cn, p.ca, p.caKey)
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Unable to marshal key: %v", err)
+	}
+
+	certFile, keyFile := filepath.Join(p.dir, cn+"-cert.pem"), filepath.Join(p.dir, cn+"-key.pem")
+	p.write(t, certFile, "CERTIFICATE", cert.Raw)
+	p.write(t, keyFile, "EC PRIVATE KEY", der)
+	return certFile, keyFile
+}
+
+func (p *testPKI) write(t *testing.T, path string, typ string, der []byte) {
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatalf("Unable to write %s: %v", path, err)
+	}
+}
+
+// serverConfig returns the settings of a server requiring client certificates issued by the CA.
+func (p *testPKI) serverConfig(t *testing.T) *tls.Config {
+	certFile, keyFile := p.issueFiles(t, "server")
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Unable to load server certificate: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(p.ca)
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+}
+
+// useSinkTLS sets the TLS settings of the sinks as Configure does, returning a function
+// restoring the previous settings.
+func useSinkTLS(t *testing.T, o *Options) func() {
+	cfg, err := newTLSConfig(o)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	prev := sinkTLS
+	sinkTLS = cfg
+	return func() { sinkTLS = prev }
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	p := newTestPKI(t)
+	defer p.cleanup()
+
+	certFile, keyFile := p.issueFiles(t, "client")
+
+	if cfg, err := newTLSConfig(NewOptions()); cfg != nil || err != nil {
+		t.Errorf("Got %v, %v, expecting no TLS settings", cfg, err)
+	}
+
+	o := NewOptions()
+	o.TLSCAFile = p.caFile
+	o.TLSCertFile = certFile
+	o.TLSKeyFile = keyFile
+	o.TLSServerName = "collector"
+	o.TLSMinVersion = "1.1"
+
+	cfg, err := newTLSConfig(o)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	if cfg.ServerName != "collector" || cfg.MinVersion != tls.VersionTLS11 || cfg.RootCAs == nil {
+		t.Errorf("Got %+v, expecting the settings of the options", cfg)
+	}
+
+	if cert, err := cfg.GetClientCertificate(nil); err != nil || cert == nil {
+		t.Errorf("Got %v, %v, expecting the client certificate", cert, err)
+	}
+
+	o = NewOptions()
+	o.TLSServerName = "collector"
+	if cfg, err = newTLSConfig(o); err != nil || cfg.MinVersion != tls.VersionTLS12 {
+		t.Errorf("Got %v, %v, expecting TLS 1.2 by default", cfg, err)
+	}
+}
+
+func TestNewTLSConfigErrors(t *testing.T) {
+	p := newTestPKI(t)
+	defer p.cleanup()
+
+	certFile, keyFile := p.issueFiles(t, "client")
+	garbage := filepath.Join(p.dir, "garbage.pem")
+	if err := ioutil.WriteFile(garbage, []byte("garbage"), 0600); err != nil {
+		t.Fatalf("Unable to write %s: %v", garbage, err)
+	}
+
+	cases := []struct {
+		name  string
+		apply func(o *Options)
+	}{
+		{"version", func(o *Options) { o.TLSMinVersion = "0.9" }},
+		{"missing CA", func(o *Options) { o.TLSCAFile = filepath.Join(p.dir, "missing.pem") }},
+		{"invalid CA", func(o *Options) { o.TLSCAFile = garbage }},
+		{"no key", func(o *Options) { o.TLSCertFile = certFile }},
+		{"no cert", func(o *Options) { o.TLSKeyFile = keyFile }},
+		{"invalid key", func(o *Options) { o.TLSCertFile, o.TLSKeyFile = certFile, garbage }},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			o := NewOptions()
+			c.apply(o)
+			if _, err := newTLSConfig(o); err == nil {
+				t.Error("Got success, expecting error")
+			}
+
+			o.OutputPaths = nil
+			if err := Configure(o); err == nil {
+				t.Error("Got success, expecting Configure to fail")
+			}
+		})
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	p := newTestPKI(t)
+	defer p.cleanup()
+
+	certFile, keyFile := p.issueFiles(t, "client")
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+
+	first, err := r.certificate()
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+
+	if again, _ := r.certificate(); again != first {
+		t.Error("Got a new certificate, expecting the loaded one to be reused")
+	}
+
+	// the certificate gets rotated
+	rotatedCert, rotatedKey := p.issueFiles(t, "rotated")
+	for _, f := range [][2]string{{rotatedCert, certFile}, {rotatedKey, keyFile}} {
+		if err := os.Rename(f[0], f[1]); err != nil {
+			t.Fatalf("Unable to rename %s: %v", f[0], err)
+		}
+	}
+	later := time.Now().Add(time.Minute)
+	_ = os.Chtimes(certFile, later, later)
+
+	rotated, err := r.certificate()
+	if err != nil || rotated == first {
+		t.Fatalf("Got %v, %v, expecting the rotated certificate", rotated, err)
+	}
+
+	// a half-written certificate doesn't replace the loaded one
+	if err := ioutil.WriteFile(keyFile, nil, 0600); err != nil {
+		t.Fatalf("Unable to write %s: %v", keyFile, err)
+	}
+	later = later.Add(time.Minute)
+	_ = os.Chtimes(keyFile, later, later)
+
+	if cert, err := r.certificate(); err != nil || cert != rotated {
+		t.Errorf("Got %v, %v, expecting the rotated certificate", cert, err)
+	}
+}
+
+func TestNetworkSinkMutualTLS(t *testing.T) {
+	p := newTestPKI(t)
+	defer p.cleanup()
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", p.serverConfig(t))
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer func() { _ = l.Close() }()
+
+	type result struct {
+		line   string
+		client string
+	}
+	results := make(chan result, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		state := conn.(*tls.Conn).ConnectionState()
+		results <- result{line, state.PeerCertificates[0].Subject.CommonName}
+	}()
+
+	certFile, keyFile := p.issueFiles(t, "client")
+	o := NewOptions()
+	o.TLSCAFile, o.TLSCertFile, o.TLSKeyFile = p.caFile, certFile, keyFile
+	defer useSinkTLS(t, o)()
+
+	core, closer, err := newNetworkSink(mustParseURL(t, "tcp+tls://"+l.Addr().String()), zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = closer.Close() }()
+
+	zap.New(core).Info("Hello")
+	_ = core.Sync()
+
+	select {
+	case r := <-results:
+		if !strings.Contains(r.line, `"msg":"Hello"`) || r.client != "client" {
+			t.Errorf("Got '%s' from %s, expecting Hello from client", r.line, r.client)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the entry")
+	}
+}
+
+func TestNetworkSinkUntrustedServer(t *testing.T) {
+	p := newTestPKI(t)
+	defer p.cleanup()
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", p.serverConfig(t))
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer func() { _ = l.Close() }()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			_ = conn.Close()
+		}
+	}()
+
+	// the CA isn't trusted without TLSCAFile
+	o := NewOptions()
+	o.TLSServerName = "server"
+	defer useSinkTLS(t, o)()
+
+	core, closer, err := newNetworkSink(mustParseURL(t, "tcp+tls://"+l.Addr().String()+"?timeout=200ms"), zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = closer.Close() }()
+
+	zap.New(core).Info("Hello")
+	if err := core.Sync(); err == nil {
+		t.Error("Got success, expecting the entry not to be delivered")
+	}
+}
+
+func TestSyslogSinkTLS(t *testing.T) {
+	p := newTestPKI(t)
+	defer p.cleanup()
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", p.serverConfig(t))
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer func() { _ = l.Close() }()
+
+	lines := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		line, _ := bufio.NewReader(conn).ReadString(']')
+		lines <- line
+	}()
+
+	certFile, keyFile := p.issueFiles(t, "client")
+	o := NewOptions()
+	o.TLSCAFile, o.TLSCertFile, o.TLSKeyFile = p.caFile, certFile, keyFile
+	defer useSinkTLS(t, o)()
+
+	core, closer, err := newSyslogSink(mustParseURL(t, "syslog+tls://"+l.Addr().String()), zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = closer.Close() }()
+
+	zap.New(core).Info("Hello", zap.String("user", "bob"))
+
+	select {
+	case line := <-lines:
+		if !strings.Contains(line, `user="bob"]`) {
+			t.Errorf("Got '%s', expecting the structured data of the entry", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the entry")
+	}
+}
+
+func TestSinkHTTPClient(t *testing.T) {
+	p := newTestPKI(t)
+	defer p.cleanup()
+
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	s.TLS = p.serverConfig(t)
+	s.StartTLS()
+	defer s.Close()
+
+	certFile, keyFile := p.issueFiles(t, "client")
+	o := NewOptions()
+	o.TLSCAFile, o.TLSCertFile, o.TLSKeyFile = p.caFile, certFile, keyFile
+	defer useSinkTLS(t, o)()
+
+	resp, err := newSinkHTTPClient(5*time.Second, false).Get(s.URL)
+	if err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if b, _ := ioutil.ReadAll(resp.Body); string(b) != "client" {
+		t.Errorf("Got '%s', expecting the client certificate to be presented", b)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// truncatedKey is the key of the marker added to the entries which were cut down to size.
+const truncatedKey = "truncated"
+
+// truncate cuts a string down to at most max bytes, without splitting a UTF-8 sequence. It returns
+// whether the string was cut.
+func truncate(s string, max int) (string, bool) {
+	if max <= 0 || len(s) <= max {
+		return s, false
+	}
+
+	i := max
+	for i > 0 && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return s[:i], true
+}
+
+// truncateField returns the field with its value cut down to max bytes, and whether it was cut.
+// Strings, byte strings, stringers, and errors are cut; other values are left as they are.
+func truncateField(f zapcore.Field, max int) (zapcore.Field, bool) {
+	var s string
+	switch f.Type {
+	case zapcore.StringType:
+		s = f.String
+	case zapcore.ByteStringType:
+		s = string(f.Interface.([]byte))
+	case zapcore.StringerType:
+		s = f.Interface.(fmt.Stringer).String()
+	case zapcore.ErrorType:
+		s = f.Interface.(error).Error()
+	default:
+		return f, false
+	}
+
+	if t, cut := truncate(s, max); cut {
+		return zap.String(f.Key, t), true
+	}
+	return f, false
+}
+
+// truncateFields returns the given fields with their values cut down to max bytes, and whether any
+// was cut. The input slice is left untouched.
+func truncateFields(fields []zapcore.Field, max int) ([]zapcore.Field, bool) {
+	if max <= 0 {
+		return fields, false
+	}
+
+	var result []zapcore.Field
+	for i, f := range fields {
+		if t, cut := truncateField(f, max); cut {
+			if result == nil {
+				result = make([]zapcore.Field, len(fields))
+				copy(result, fields)
+			}
+			result[i] = t
+		}
+	}
+
+	if result == nil {
+		return fields, false
+	}
+	return result, true
+}
+
+// truncatingCore cuts oversized messages and field values down to size, marking the entries it
+// cut with truncated=true, so that they don't exceed the line limits of log collectors.
+type truncatingCore struct {
+	zapcore.Core
+	maxMessage int
+	maxField   int
+}
+
+func newTruncatingCore(core zapcore.Core, maxMessage int, maxField int) zapcore.Core {
+	return &truncatingCore{core, maxMessage, maxField}
+}
+
+func (c *truncatingCore) With(fields []zapcore.Field) zapcore.Core {
+	fields, cut := truncateFields(fields, c.maxField)
+	if cut {
+		fields = append(fields, zap.Bool(truncatedKey, true))
+	}
+	return &truncatingCore{c.Core.With(fields), c.maxMessage, c.maxField}
+}
+
+func (c *truncatingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *truncatingCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	var msgCut bool
+	ent.Message, msgCut = truncate(ent.Message, c.maxMessage)
+
+	fields, fieldsCut := truncateFields(fields, c.maxField)
+	if msgCut || fieldsCut {
+		fields = append(fields[:len(fields):len(fields)], zap.Bool(truncatedKey, true))
+	}
+
+	return c.Core.Write(ent, fields)
+}
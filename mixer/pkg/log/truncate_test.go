@@ -0,0 +1,81 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestTruncate(t *testing.T) {
+	cases := []struct {
+		in       string
+		max      int
+		expected string
+		cut      bool
+	}{
+		{"hello", 0, "hello", false},
+		{"hello", 5, "hello", false},
+		{"hello", 3, "hel", true},
+		{"héllo", 2, "h", true},
+		{"héllo", 3, "hé", true},
+	}
+
+	for _, c := range cases {
+		if s, cut := truncate(c.in, c.max); s != c.expected || cut != c.cut {
+			t.Errorf("Got '%s', %v for '%s' at %d, expecting '%s', %v", s, cut, c.in, c.max, c.expected, c.cut)
+		}
+	}
+}
+
+func TestTruncatingCore(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.MaxMessageBytes = 8
+	o.MaxFieldBytes = 4
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	defer configureWithoutOutput(t)
+
+	Info("Short", String("a", "abc"), Int("count", 123456))
+	Info("A long message")
+	Info("Hello",
+		String("s", "abcdef"),
+		ByteString("b", []byte("ghijkl")),
+		Stringer("ip", net.IPv4(10, 0, 0, 1)),
+		Err(errors.New("timeout")))
+	With(String("bag", "attributes")).Info("Hello")
+
+	expected := `{"level":"info","msg":"Short","a":"abc","count":123456}` + "\n" +
+		`{"level":"info","msg":"A long m","truncated":true}` + "\n" +
+		`{"level":"info","msg":"Hello","s":"abcd","b":"ghij","ip":"10.0","error":"time","truncated":true}` + "\n" +
+		`{"level":"info","msg":"Hello","bag":"attr","truncated":true}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Got\n%s\nexpecting\n%s", buf, expected)
+	}
+
+	o.MaxFieldBytes = -1
+	if err := Configure(o); err == nil {
+		t.Error("Got success, expecting error")
+	}
+}
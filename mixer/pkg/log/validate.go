@@ -0,0 +1,225 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// optionErrors collects the problems found with options, each prefixed with the field at fault.
+type optionErrors []string
+
+func (e *optionErrors) add(field string, err error) {
+	if err != nil {
+		*e = append(*e, fmt.Sprintf("%s: %v", field, err))
+	}
+}
+
+func (e optionErrors) Error() string {
+	if len(e) == 1 {
+		return "invalid log option " + e[0]
+	}
+	return fmt.Sprintf("%d invalid log options: %s", len(e), strings.Join(e, "; "))
+}
+
+// Validate checks the options without applying them, so that bad settings can be reported before
+// Configure is called. The error returned names every field at fault.
+//
+// Validate doesn't touch the file system: output files which can't be written to, and TLS files
+// which can't be read, are reported by Configure.
+func (o *Options) Validate() error {
+	var errs optionErrors
+
+	_, err := o.GetOutputLevel()
+	errs.add("OutputLevel", err)
+
+	_, err = o.GetStackTraceLevel()
+	errs.add("StackTraceLevel", err)
+
+	if !o.DisableSampling {
+		if o.SamplingInitial < 0 {
+			errs.add("SamplingInitial", fmt.Errorf("invalid sampling initial value: %d", o.SamplingInitial))
+		}
+
+		if o.SamplingThereafter < 1 {
+			errs.add("SamplingThereafter", fmt.Errorf("invalid sampling thereafter value: %d", o.SamplingThereafter))
+		}
+
+		if o.SamplingBudget < 0 {
+			errs.add("SamplingBudget", fmt.Errorf("invalid sampling budget: %d", o.SamplingBudget))
+		}
+
+		_, err = parseScopeSampling(o.ScopeSampling)
+		errs.add("ScopeSampling", err)
+	}
+
+	errs.add("Encoding", checkEncoding(o.Encoding))
+
+	for i, p := range o.OutputPaths {
+		errs.add(fmt.Sprintf("OutputPaths[%d]", i), checkOutputPath(p, o.RotationInterval))
+	}
+
+	for i, out := range o.Outputs {
+		field := fmt.Sprintf("Outputs[%d]", i)
+
+		errs.add(field+".Path", checkOutputPath(out.Path, o.RotationInterval))
+		errs.add(field+".Encoding", checkEncoding(out.Encoding))
+
+		if _, sinks := splitOutputPaths([]string{out.Path}); len(sinks) > 0 && out.Encoding != "" {
+			errs.add(field+".Encoding", fmt.Errorf("output %s doesn't support setting the encoding", out.Path))
+		}
+
+		if _, ok := stringToLevel[out.MinLevel]; out.MinLevel != "" && !ok {
+			errs.add(field+".MinLevel", fmt.Errorf("unknown output level for %s: %s", out.Path, out.MinLevel))
+		}
+	}
+
+	for i, p := range o.AuditOutputPaths {
+		errs.add(fmt.Sprintf("AuditOutputPaths[%d]", i), checkOutputPath(p, o.AuditRotationInterval))
+	}
+
+	for i, p := range o.ErrorOutputPaths {
+		if u, err := url.Parse(p); err == nil && len(u.Scheme) > 1 && u.Scheme != "file" {
+			errs.add(fmt.Sprintf("ErrorOutputPaths[%d]", i), fmt.Errorf("unknown scheme %s, expecting a file path", u.Scheme))
+		}
+	}
+
+	switch o.AuditEncoding {
+	case "", "json":
+	case cefEncoding, leefEncoding:
+		if o.AuditHashChain {
+			errs.add("AuditHashChain", fmt.Errorf("the audit hash chain requires the json audit encoding, not %s", o.AuditEncoding))
+		}
+	default:
+		errs.add("AuditEncoding", fmt.Errorf("unknown audit encoding: %s", o.AuditEncoding))
+	}
+
+	errs.add("ConsoleEscaping", checkConsoleEscaping(o.ConsoleEscaping))
+	errs.add("StackTraceEncoding", checkStackTraceEncoding(o.StackTraceEncoding))
+	errs.add("RotationInterval", checkRotationInterval(o.RotationInterval))
+	errs.add("AuditRotationInterval", checkRotationInterval(o.AuditRotationInterval))
+
+	if o.RotationCompress && o.RotationInterval == "" {
+		errs.add("RotationCompress", errors.New("compressing the rotated files requires a rotation interval"))
+	}
+
+	if o.DiskQuotaBytes < 0 {
+		errs.add("DiskQuotaBytes", fmt.Errorf("invalid disk quota: %d", o.DiskQuotaBytes))
+	}
+
+	if o.RecentEntries < 0 {
+		errs.add("RecentEntries", fmt.Errorf("invalid number of recent entries: %d", o.RecentEntries))
+	}
+
+	if o.DebugSamplePercentage < 0 || o.DebugSamplePercentage > 100 {
+		errs.add("DebugSamplePercentage", fmt.Errorf("invalid debug sample percentage: %g", o.DebugSamplePercentage))
+	}
+
+	if l, ok := stringToLevel[o.StdLogLevel]; o.StdLogLevel != "" && (!ok || l == None) {
+		errs.add("StdLogLevel", fmt.Errorf("unknown standard log level: %s", o.StdLogLevel))
+	}
+
+	if o.Verbosity < 0 {
+		errs.add("Verbosity", fmt.Errorf("invalid verbosity: %d", o.Verbosity))
+	}
+
+	if o.MaxMessageBytes < 0 {
+		errs.add("MaxMessageBytes", fmt.Errorf("invalid max message bytes: %d", o.MaxMessageBytes))
+	}
+
+	if o.MaxFieldBytes < 0 {
+		errs.add("MaxFieldBytes", fmt.Errorf("invalid max field bytes: %d", o.MaxFieldBytes))
+	}
+
+	if o.AsyncBufferSize < 0 {
+		errs.add("AsyncBufferSize", fmt.Errorf("invalid async buffer size: %d", o.AsyncBufferSize))
+	}
+
+	switch o.AsyncDropPolicy {
+	case "", asyncBlock, asyncDropNewest, asyncDropOldest:
+	default:
+		errs.add("AsyncDropPolicy", fmt.Errorf("unknown async drop policy: %s", o.AsyncDropPolicy))
+	}
+
+	_, err = parseMessageFilter(o.MessageFilters)
+	errs.add("MessageFilters", err)
+
+	_, err = parseLevelOverrides(o.LevelOverrides)
+	errs.add("LevelOverrides", err)
+
+	_, err = newOutputEncoderConfig(&Options{DurationEncoding: o.DurationEncoding})
+	errs.add("DurationEncoding", err)
+
+	_, err = newOutputEncoderConfig(&Options{CallerEncoding: o.CallerEncoding})
+	errs.add("CallerEncoding", err)
+
+	_, err = newOutputEncoderConfig(&Options{LineEnding: o.LineEnding})
+	errs.add("LineEnding", err)
+
+	_, err = newOutputEncoderConfig(&Options{EncoderKeys: o.EncoderKeys})
+	errs.add("EncoderKeys", err)
+
+	errs.add("LogSchema", checkLogSchema(o.LogSchema))
+
+	for _, f := range o.GlobalFields {
+		if strings.Index(f, "=") <= 0 {
+			errs.add("GlobalFields", fmt.Errorf("invalid global field '%s', expecting <key>=<value>", f))
+		}
+	}
+
+	_, err = newFileSettings(&Options{FilePermissions: o.FilePermissions})
+	errs.add("FilePermissions", err)
+
+	_, err = newFileSettings(&Options{FileOwner: o.FileOwner})
+	errs.add("FileOwner", err)
+
+	if _, ok := tlsVersions[o.TLSMinVersion]; o.TLSMinVersion != "" && !ok {
+		errs.add("TLSMinVersion", fmt.Errorf("unknown TLS version: %s", o.TLSMinVersion))
+	}
+
+	if o.TLSCertFile != "" && o.TLSKeyFile == "" {
+		errs.add("TLSKeyFile", errors.New("a TLS client certificate requires both a certificate and a key"))
+	} else if o.TLSCertFile == "" && o.TLSKeyFile != "" {
+		errs.add("TLSCertFile", errors.New("a TLS client certificate requires both a certificate and a key"))
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// checkOutputPath returns an error if the given output path has a scheme which is neither that of
+// a file nor that of a sink, or is that of a file holding timestamp verbs without a rotation
+// interval to expand them.
+func checkOutputPath(path string, rotationInterval string) error {
+	// one-letter schemes are Windows drive letters
+	if u, err := url.Parse(path); err == nil && len(u.Scheme) > 1 {
+		if lookupSink(u.Scheme) != nil {
+			return nil
+		}
+		if u.Scheme != "file" {
+			return fmt.Errorf("unknown scheme %s, expecting a file path or one of the supported URLs", u.Scheme)
+		}
+	}
+
+	if rotationInterval == "" && isRotationPattern(path) {
+		return fmt.Errorf("the timestamp verbs of %s require a rotation interval", path)
+	}
+	return nil
+}
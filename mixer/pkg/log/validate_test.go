@@ -0,0 +1,103 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	if err := NewOptions().Validate(); err != nil {
+		t.Errorf("Got err '%v', expecting the defaults to be valid", err)
+	}
+
+	cases := []struct {
+		name   string
+		change func(o *Options)
+		field  string
+	}{
+		{"output level", func(o *Options) { o.outputLevel = "loud" }, "OutputLevel: unknown output level: loud"},
+		{"stack trace level", func(o *Options) { o.stackTraceLevel = "deep" }, "StackTraceLevel:"},
+		{"level override", func(o *Options) { o.LevelOverrides = []string{"mixer/pkg/runtime/*.go=loud"} }, "LevelOverrides: unknown level"},
+		{"standard log level", func(o *Options) { o.StdLogLevel = "none" }, "StdLogLevel: unknown standard log level: none"},
+		{"sampling", func(o *Options) { o.SamplingThereafter = 0 }, "SamplingThereafter:"},
+		{"scope sampling", func(o *Options) { o.ScopeSampling = "report:10" }, "ScopeSampling: invalid sampling of report"},
+		{"encoding", func(o *Options) { o.Encoding = "xml" }, "Encoding: unknown encoding: xml"},
+		{"scheme", func(o *Options) { o.OutputPaths = []string{"stdout", "ftp://host/log"} }, "OutputPaths[1]: unknown scheme ftp"},
+		{"verbs", func(o *Options) { o.AuditOutputPaths = []string{"audit-%Y.log"} }, "AuditOutputPaths[0]: the timestamp verbs"},
+		{"output level of an output", func(o *Options) { o.Outputs = []OutputSpec{{Path: "stderr", MinLevel: "all"}} }, "Outputs[0].MinLevel:"},
+		{"error output", func(o *Options) { o.ErrorOutputPaths = []string{"syslog://"} }, "ErrorOutputPaths[0]:"},
+		{"hash chain", func(o *Options) { o.AuditEncoding = cefEncoding; o.AuditHashChain = true }, "AuditHashChain:"},
+		{"rotation", func(o *Options) { o.RotationInterval = "weekly" }, "RotationInterval: unknown rotation interval: weekly"},
+		{"compression", func(o *Options) { o.RotationCompress = true }, "RotationCompress:"},
+		{"quota", func(o *Options) { o.DiskQuotaBytes = -1 }, "DiskQuotaBytes:"},
+		{"recent entries", func(o *Options) { o.RecentEntries = -1 }, "RecentEntries: invalid number of recent entries: -1"},
+		{"log schema", func(o *Options) { o.LogSchema = 7 }, "LogSchema: unknown log schema: 7"},
+		{"debug sample percentage", func(o *Options) { o.DebugSamplePercentage = 150 }, "DebugSamplePercentage: invalid debug sample percentage: 150"},
+		{"drop policy", func(o *Options) { o.AsyncDropPolicy = "random" }, "AsyncDropPolicy:"},
+		{"duration encoding", func(o *Options) { o.DurationEncoding = "hours" }, "DurationEncoding:"},
+		{"caller encoding", func(o *Options) { o.CallerEncoding = "long" }, "CallerEncoding: unknown caller encoding: long"},
+		{"line ending", func(o *Options) { o.LineEnding = "cr" }, "LineEnding: unknown line ending: cr"},
+		{"stack trace encoding", func(o *Options) { o.StackTraceEncoding = "flat" }, "StackTraceEncoding: unknown stack trace encoding: flat"},
+		{"global fields", func(o *Options) { o.GlobalFields = []string{"=value"} }, "GlobalFields:"},
+		{"file permissions", func(o *Options) { o.FilePermissions = "rw" }, "FilePermissions:"},
+		{"TLS version", func(o *Options) { o.TLSMinVersion = "1.9" }, "TLSMinVersion:"},
+		{"TLS key", func(o *Options) { o.TLSCertFile = "cert.pem" }, "TLSKeyFile:"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			o := NewOptions()
+			c.change(o)
+
+			if err := o.Validate(); err == nil || !strings.Contains(err.Error(), c.field) {
+				t.Errorf("Got err '%v', expecting it to contain '%s'", err, c.field)
+			}
+		})
+	}
+}
+
+func TestValidateAggregates(t *testing.T) {
+	o := NewOptions()
+	o.outputLevel = "loud"
+	o.Verbosity = -1
+	o.OutputPaths = []string{"mixer-%Y%m%d.log"}
+
+	err := o.Validate()
+	if err == nil {
+		t.Fatal("Got success, expecting an error")
+	}
+	for _, field := range []string{"3 invalid log options", "OutputLevel:", "Verbosity:", "OutputPaths[0]:"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("Got err '%v', expecting it to contain '%s'", err, field)
+		}
+	}
+
+	// the sinks don't have their own timestamp verbs
+	o = NewOptions()
+	o.OutputPaths = []string{"syslog://?tag=mixer%20log"}
+	if err = o.Validate(); err != nil {
+		t.Errorf("Got err '%v', expecting a sink URL to be valid", err)
+	}
+}
+
+func TestConfigureValidates(t *testing.T) {
+	o := NewOptions()
+	o.MaxFieldBytes = -1
+	if err := Configure(o); err == nil || !strings.Contains(err.Error(), "MaxFieldBytes") {
+		t.Errorf("Got err '%v', expecting the invalid field to be named", err)
+	}
+}
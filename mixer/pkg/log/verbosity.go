@@ -0,0 +1,84 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// The highest verbosity level of the messages output through V.
+var currentVerbosity int32
+
+// SetVerbosity changes the highest verbosity level of the messages output through V, taking effect
+// right away. Configure resets it to the verbosity of the options.
+func SetVerbosity(verbosity int) error {
+	if verbosity < 0 {
+		return fmt.Errorf("invalid verbosity: %d", verbosity)
+	}
+
+	atomic.StoreInt32(&currentVerbosity, int32(verbosity))
+	return nil
+}
+
+// GetVerbosity returns the highest verbosity level of the messages output through V.
+func GetVerbosity() int {
+	return int(atomic.LoadInt32(&currentVerbosity))
+}
+
+// Verbose outputs debug messages at a verbosity level, as returned by V.
+type Verbose bool
+
+// V returns a handle for outputting debug messages at the given verbosity level, in the manner of
+// glog, which makes it easy to port code using glog's verbosity levels. The messages are output at
+// the debug level, when it is enabled and the level is at most the verbosity.
+//
+//		if log.V(4).Enabled() {
+//			log.V(4).Infof("Resolved %d attributes", len(attrs))
+//		}
+func V(level int) Verbose {
+	return Verbose(level <= GetVerbosity() && enabled(zap.DebugLevel))
+}
+
+// Enabled returns whether the messages of the verbosity level are output.
+func (v Verbose) Enabled() bool {
+	return bool(v)
+}
+
+// Info outputs a message at debug level, if the verbosity level is enabled.
+func (v Verbose) Info(msg string, fields ...zapcore.Field) {
+	if v {
+		currentLogger().Debug(msg, fields...)
+	}
+}
+
+// Infoa uses fmt.Sprint to construct and log a message at debug level, if the verbosity level is
+// enabled.
+func (v Verbose) Infoa(args ...interface{}) {
+	if v {
+		currentSugar().Debug(args...)
+	}
+}
+
+// Infof uses fmt.Sprintf to construct and log a message at debug level, if the verbosity level is
+// enabled.
+func (v Verbose) Infof(template string, args ...interface{}) {
+	if v {
+		currentSugar().Debugf(template, args...)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func configureVerbosity(t *testing.T, level zapcore.Level, verbosity int) {
+	o := NewOptions()
+	o.OutputPaths = nil
+	o.AuditOutputPaths = nil
+	o.Verbosity = verbosity
+	_ = o.SetOutputLevel(level)
+	if err := Configure(o); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+}
+
+func TestVerbosity(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	defer configureWithoutOutput(t)
+
+	configureVerbosity(t, zapcore.DebugLevel, 2)
+
+	if !V(2).Enabled() || V(3).Enabled() {
+		t.Errorf("Got V(2) %v and V(3) %v, expecting up to V(2) enabled", V(2).Enabled(), V(3).Enabled())
+	}
+
+	V(0).Info("One", Int("count", 1))
+	V(2).Infof("Two %d", 2)
+	V(3).Info("Not output")
+	V(1).Infoa("Three")
+
+	// raising the verbosity at runtime
+	if err := SetVerbosity(3); err != nil {
+		t.Fatalf("Got err '%v', expecting success", err)
+	}
+	V(3).Info("Four")
+
+	// nothing is output unless the debug level is enabled
+	configureVerbosity(t, zapcore.InfoLevel, 5)
+	if V(0).Enabled() {
+		t.Error("Got V(0) enabled, expecting it disabled without the debug level")
+	}
+	V(0).Info("Not output")
+
+	expected := `{"level":"debug","msg":"One","count":1}` + "\n" +
+		`{"level":"debug","msg":"Two 2"}` + "\n" +
+		`{"level":"debug","msg":"Three"}` + "\n" +
+		`{"level":"debug","msg":"Four"}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Got\n%s\nexpecting\n%s", buf, expected)
+	}
+
+	if err := SetVerbosity(-1); err == nil {
+		t.Error("Got success, expecting error")
+	}
+
+	o := NewOptions()
+	o.Verbosity = -1
+	if err := Configure(o); err == nil {
+		t.Error("Got success, expecting error")
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Lines longer than this are output in pieces.
+const maxWriterLine = 64 * 1024
+
+// Writer returns a writer which outputs each line written to it as a message at the given level,
+// under the given scope, or the default scope when empty. This wires libraries which only accept an
+// io.Writer into the log, for example:
+//
+//		srv := &http.Server{ErrorLog: stdlog.New(log.Writer(zapcore.ErrorLevel, "http"), "", 0)}
+//
+// Blank lines are skipped. An incomplete last line is held until the line is completed, or until
+// the writer is closed: it also implements io.Closer. The writer may be used from any number of
+// goroutines, and follows later calls to Configure.
+func Writer(level zapcore.Level, scope string) io.Writer {
+	return &lineWriter{core: newGlobalCore(), level: level, scope: scope}
+}
+
+// lineWriter outputs the lines written to it as entries.
+type lineWriter struct {
+	core  zapcore.Core
+	level zapcore.Level
+	scope string
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 && len(w.buf) < maxWriterLine {
+			break
+		}
+		if i < 0 || i > maxWriterLine {
+			i = maxWriterLine
+		}
+
+		w.output(w.buf[:i])
+		if i < len(w.buf) && w.buf[i] == '\n' {
+			i++
+		}
+		w.buf = w.buf[i:]
+	}
+
+	// don't hold on to the memory of long lines
+	if len(w.buf) == 0 {
+		w.buf = nil
+	}
+
+	return len(p), nil
+}
+
+// Close outputs the incomplete last line, if any.
+func (w *lineWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.output(w.buf)
+	w.buf = nil
+	return nil
+}
+
+func (w *lineWriter) output(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if len(bytes.TrimSpace(line)) == 0 {
+		return
+	}
+
+	ent := zapcore.Entry{Level: w.level, Time: now(), LoggerName: w.scope, Message: string(line)}
+	if ce := w.core.Check(ent, nil); ce != nil {
+		ce.Write()
+	}
+}
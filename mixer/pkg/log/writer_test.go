@@ -0,0 +1,67 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"io"
+	stdlog "log"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestWriter(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	configureWithoutOutput(t)
+
+	w := Writer(zapcore.WarnLevel, "http")
+	_, _ = io.WriteString(w, "One\nTw")
+	_, _ = io.WriteString(w, "o\r\n\n  \nThree")
+	if err := w.(io.Closer).Close(); err != nil {
+		t.Errorf("Got err '%v', expecting success", err)
+	}
+
+	// the way http.Server reports errors
+	l := stdlog.New(Writer(zapcore.ErrorLevel, ""), "", 0)
+	l.Printf("http: TLS handshake error from %s: EOF", "10.0.0.1:1234")
+
+	// entries below the output level are discarded
+	_, _ = io.WriteString(Writer(zapcore.DebugLevel, "exec"), "Not output\n")
+
+	expected := `{"level":"warn","logger":"http","msg":"One"}` + "\n" +
+		`{"level":"warn","logger":"http","msg":"Two"}` + "\n" +
+		`{"level":"warn","logger":"http","msg":"Three"}` + "\n" +
+		`{"level":"error","msg":"http: TLS handshake error from 10.0.0.1:1234: EOF"}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Got\n%s\nexpecting\n%s", buf, expected)
+	}
+}
+
+func TestWriterLongLines(t *testing.T) {
+	core, buf := newCollectingCore(zapcore.DebugLevel)
+	defer AddCore(core)()
+	configureWithoutOutput(t)
+
+	w := Writer(zapcore.InfoLevel, "")
+	_, _ = fmt.Fprintf(w, "%s\n", strings.Repeat("x", maxWriterLine+10))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], `"msg":"xxxxxxxxxx"`) {
+		t.Errorf("Got %d entries, expecting the line to be split in two", len(lines))
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap/zapcore"
+
+	"istio.io/istio/mixer/pkg/log/binlog"
+)
+
+func withArgs(args []string, errorf func(format string, a ...interface{})) {
+	var encoding string
+
+	rootCmd := cobra.Command{
+		Use:   "logdump [file...]",
+		Short: "Converts binary Mixer logs to JSON or console output",
+		Long: "Converts logs written with --log_encoding protobuf to JSON or console output, reading the given files or stdin.\n" +
+			"Example: logdump --encoding console mixer.log",
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg := zapcore.EncoderConfig{
+				TimeKey:        "time",
+				LevelKey:       "level",
+				NameKey:        "logger",
+				CallerKey:      "caller",
+				MessageKey:     "msg",
+				StacktraceKey:  "stack",
+				LineEnding:     zapcore.DefaultLineEnding,
+				EncodeLevel:    zapcore.LowercaseLevelEncoder,
+				EncodeCaller:   zapcore.ShortCallerEncoder,
+				EncodeTime:     zapcore.ISO8601TimeEncoder,
+				EncodeDuration: zapcore.StringDurationEncoder,
+			}
+
+			var enc zapcore.Encoder
+			switch encoding {
+			case "json":
+				enc = zapcore.NewJSONEncoder(cfg)
+			case "console":
+				enc = zapcore.NewConsoleEncoder(cfg)
+			default:
+				errorf("unknown encoding '%s', can be one of json or console", encoding)
+				return
+			}
+
+			if len(args) == 0 {
+				if err := binlog.Dump(os.Stdout, os.Stdin, enc); err != nil {
+					errorf("%v", err)
+				}
+				return
+			}
+
+			for _, path := range args {
+				if err := dumpFile(path, enc); err != nil {
+					errorf("%v", err)
+					return
+				}
+			}
+		},
+	}
+
+	rootCmd.SetArgs(args)
+
+	rootCmd.PersistentFlags().StringVarP(&encoding, "encoding", "e", "json", "the output format, json or console")
+
+	if err := rootCmd.Execute(); err != nil {
+		errorf("%v", err)
+	}
+}
+
+func dumpFile(path string, enc zapcore.Encoder) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not open '%s': %v", path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if err := binlog.Dump(os.Stdout, f, enc); err != nil {
+		return fmt.Errorf("could not read '%s': %v", path, err)
+	}
+	return nil
+}
+
+func main() {
+	withArgs(os.Args[1:],
+		func(format string, a ...interface{}) {
+			fmt.Fprintf(os.Stderr, format+"\n", a...) // nolint: gas
+			os.Exit(1)
+		})
+}